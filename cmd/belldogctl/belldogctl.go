@@ -0,0 +1,314 @@
+// belldogctl manages token records directly in storage, for operations without Slack commands or the
+// DynamoDB console.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/caarlos0/env/v11"
+	"github.com/cockroachdb/errors"
+	"github.com/phsym/console-slog"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/kmsenvelope"
+	"github.com/Finatext/belldog/internal/s3object"
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/secretenv"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/storage"
+	"github.com/Finatext/ssmenv-go"
+)
+
+// ctlConfig is the subset of appconfig.Config for the storage. Slack settings are not required.
+type ctlConfig struct {
+	ArchivedRecordTTL     time.Duration `env:"ARCHIVED_RECORD_TTL" envDefault:"720h"`
+	DdbChannelIDIndexName string        `env:"DDB_CHANNEL_ID_INDEX_NAME"`
+	DdbEndpointURL        string        `env:"DDB_ENDPOINT_URL"`
+	DdbKmsKeyArn          string        `env:"DDB_KMS_KEY_ARN"`
+	DdbRetryMaxAttempts   int           `env:"DDB_RETRY_MAX_ATTEMPTS" envDefault:"5"`
+	DdbRetryMaxBackoff    time.Duration `env:"DDB_RETRY_MAX_BACKOFF" envDefault:"1s"`
+	DdbTokenIndexName     string        `env:"DDB_TOKEN_INDEX_NAME"`
+	DdbTableName          string        `env:"DDB_TABLE_NAME,required"`
+	GoLog                 slog.Level    `env:"GO_LOG" envDefault:"info"`
+	RevokeGracePeriod     time.Duration `env:"REVOKE_GRACE_PERIOD" envDefault:"168h"`
+}
+
+const usage = `Usage: belldogctl <command> [arguments]
+
+Commands:
+  list [channel name]   List records. Without a channel name, list all records including tombstones.
+  revoke <token>        Revoke the token. Revoked tokens can be restored during REVOKE_GRACE_PERIOD.
+  export [destination]  Write all records including tombstones as JSON lines to s3://bucket/key, the file or stdout.
+  import [source]       Save records read from s3://bucket/key, the file or stdin. Existing records are skipped.
+  verify <URL>          Check the token of the webhook URL is valid, without updating last_used_at.
+  migrate [--dry-run]   Create the table, GSIs and TTL setting if absent, and migrate records saved by older versions.
+
+Configured with the same environment variables as belldog: DDB_TABLE_NAME, DDB_CHANNEL_ID_INDEX_NAME, etc.
+`
+
+func main() {
+	if err := doMain(); err != nil {
+		slog.Error("failed to run", slog.String("error", fmt.Sprintf("%+v", err)))
+		os.Exit(1)
+	}
+}
+
+func doMain() error {
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	logLevel := new(slog.LevelVar)
+	slog.SetDefault(slog.New(console.NewHandler(os.Stderr, &console.HandlerOptions{Level: logLevel})))
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load AWS config")
+	}
+	replacedEnv, err := ssmenv.ReplacedEnv(ctx, ssm.NewFromConfig(awsConfig), os.Environ())
+	if err != nil {
+		return errors.Wrap(err, "failed to replace env")
+	}
+	replacedEnv, err = secretenv.ReplacedEnv(ctx, secretenv.NewClient(awsConfig), replacedEnv)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace env with Secrets Manager")
+	}
+	config, err := env.ParseAsWithOptions[ctlConfig](env.Options{
+		Environment: replacedEnv,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to process config from env")
+	}
+	logLevel.Set(config.GoLog)
+
+	ddbConfig := appconfig.Config{DdbEndpointURL: config.DdbEndpointURL, DdbRetryMaxAttempts: config.DdbRetryMaxAttempts, DdbRetryMaxBackoff: config.DdbRetryMaxBackoff}
+	ddb, err := storage.NewDDB(ctx, storage.DynamoDBConfig(awsConfig, ddbConfig), config.DdbTableName, config.DdbChannelIDIndexName, config.DdbTokenIndexName)
+	if err != nil {
+		return err
+	}
+	if config.DdbKmsKeyArn != "" {
+		if err := ddb.EncryptTokens(kmsenvelope.NewCipher(kmsenvelope.NewClient(awsConfig), config.DdbKmsKeyArn)); err != nil {
+			return err
+		}
+	}
+	ctl := controller{
+		ddb:      &ddb,
+		table:    &ddb,
+		tokenSvc: service.NewTokenService(&ddb, config.RevokeGracePeriod),
+		s3:       s3object.NewClient(awsConfig),
+		in:       os.Stdin,
+		out:      os.Stdout,
+	}
+
+	args := flag.Args()
+	switch cmd, rest := args[0], args[1:]; {
+	case cmd == "list" && len(rest) <= 1:
+		return ctl.list(ctx, strings.Join(rest, ""))
+	case cmd == "revoke" && len(rest) == 1:
+		return ctl.revoke(ctx, secret.Token(rest[0]))
+	case cmd == "export" && len(rest) <= 1:
+		return ctl.export(ctx, strings.Join(rest, ""))
+	case cmd == "import" && len(rest) <= 1:
+		return ctl.importRecords(ctx, strings.Join(rest, ""))
+	case cmd == "verify" && len(rest) == 1:
+		return ctl.verify(ctx, rest[0])
+	case cmd == "migrate" && (len(rest) == 0 || len(rest) == 1 && rest[0] == "--dry-run"):
+		opts := storage.MigrateOptions{
+			ArchivedRecordTTL: config.ArchivedRecordTTL,
+			RevokeGracePeriod: config.RevokeGracePeriod,
+			DryRun:            len(rest) == 1,
+		}
+		return ctl.migrate(ctx, opts)
+	default:
+		flag.Usage()
+		os.Exit(2)
+		return nil
+	}
+}
+
+type controller struct {
+	ddb      storage.Storage
+	table    *storage.DDB
+	tokenSvc service.TokenService
+	s3       *s3object.Client
+	in       io.Reader
+	out      io.Writer
+}
+
+func (c *controller) list(ctx context.Context, channelName string) error {
+	var recs []storage.Record
+	var err error
+	if channelName == "" {
+		recs, err = c.ddb.ScanAll(ctx)
+	} else {
+		recs, err = c.ddb.QueryByChannelName(ctx, channelName)
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL_NAME\tCHANNEL_ID\tTOKEN\tVERSION\tSCOPE\tCREATED_AT\tLAST_USED_AT\tSTATE")
+	for _, rec := range recs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", rec.ChannelName, rec.ChannelID, rec.Token, rec.Version, orDash(rec.Scope), rec.CreatedAt, orDash(rec.LastUsedAt), state(rec))
+	}
+	return w.Flush()
+}
+
+// revoke finds the channel of the token with scanning, so the token GSI is not required.
+func (c *controller) revoke(ctx context.Context, token secret.Token) error {
+	recs, err := c.ddb.ScanAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if rec.Token != token.Reveal() || rec.Tombstone() {
+			continue
+		}
+		if err := c.tokenSvc.RevokeToken(ctx, rec.ChannelName, token); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Revoked: channel_name=%s, channel_id=%s\n", rec.ChannelName, rec.ChannelID)
+		return nil
+	}
+	return errors.Newf("no token found: %s", token)
+}
+
+// export writes records to the S3 object, the file or stdout when dest is empty.
+func (c *controller) export(ctx context.Context, dest string) error {
+	var buf bytes.Buffer
+	count, err := storage.Export(ctx, c.ddb, &buf)
+	if err != nil {
+		return err
+	}
+	if loc, ok := s3object.ParseLocation(dest); ok {
+		err = c.s3.PutObject(ctx, loc, buf.Bytes())
+	} else if dest != "" {
+		err = errors.Wrapf(os.WriteFile(dest, buf.Bytes(), 0o600), "failed to write file: %s", dest)
+	} else {
+		_, err = c.out.Write(buf.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "exported records", slog.Int("count", count), slog.String("destination", dest))
+	return nil
+}
+
+// importRecords reads records from the S3 object, the file or stdin when src is empty.
+func (c *controller) importRecords(ctx context.Context, src string) error {
+	var r io.Reader = c.in
+	if loc, ok := s3object.ParseLocation(src); ok {
+		body, err := c.s3.GetObject(ctx, loc)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(body)
+	} else if src != "" {
+		f, err := os.Open(src)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open file: %s", src)
+		}
+		defer f.Close()
+		r = f
+	}
+	result, err := storage.Import(ctx, c.ddb, r)
+	slog.InfoContext(ctx, "imported records", slog.Int("saved", result.Saved), slog.Int("skipped", result.Skipped))
+	return err
+}
+
+// verify checks the token like webhook requests do. TokenService.VerifyToken is not used because it records
+// the usage, which would keep stale tokens alive.
+func (c *controller) verify(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse URL: %s", rawURL)
+	}
+	// `/p/:channel_name/:token` or `/c/:channel_id/:token`, optionally followed by `/update` etc.
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 3 {
+		return errors.Newf("not a webhook URL: %s", rawURL)
+	}
+	key, token := segments[1], segments[2]
+
+	var recs []storage.Record
+	switch segments[0] {
+	case "p":
+		recs, err = c.ddb.QueryByChannelName(ctx, key)
+	case "c":
+		recs, err = c.ddb.QueryByChannelID(ctx, key)
+	default:
+		return errors.Newf("not a webhook URL: %s", rawURL)
+	}
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if rec.Token == token {
+			fmt.Fprintf(c.out, "Valid: channel_name=%s, channel_id=%s, scope=%s, last_used_at=%s\n", rec.ChannelName, rec.ChannelID, orDash(rec.Scope), orDash(rec.LastUsedAt))
+			return nil
+		}
+	}
+	if len(recs) == 0 {
+		return errors.Newf("no token found for the channel: %s", key)
+	}
+	return errors.New("token unmatched")
+}
+
+// migrate bootstraps and migrates the table. Running it on migrated tables changes nothing.
+func (c *controller) migrate(ctx context.Context, opts storage.MigrateOptions) error {
+	result, err := storage.Migrate(ctx, c.table, opts)
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if opts.DryRun {
+		prefix = "Dry run: "
+	}
+	fmt.Fprintf(c.out, "%stable_created=%t, indexes_created=[%s], ttl_enabled=%t, records=%d\n",
+		prefix, result.TableCreated, strings.Join(result.IndexesCreated, ", "), result.TTLEnabled, result.Records)
+	names := make([]string, 0, len(result.Migrated))
+	for name := range result.Migrated {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(c.out, "%smigrated: %s=%d\n", prefix, name, result.Migrated[name])
+	}
+	return nil
+}
+
+func state(rec storage.Record) string {
+	switch {
+	case rec.Revoked():
+		return "revoked, expires_at=" + time.Unix(rec.ExpiresAt, 0).UTC().Format(time.RFC3339)
+	case rec.Archived():
+		return "archived, expires_at=" + time.Unix(rec.ExpiresAt, 0).UTC().Format(time.RFC3339)
+	default:
+		return "active"
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
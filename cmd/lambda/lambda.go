@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/Finatext/lambdaurl-buffered"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -13,11 +15,20 @@ import (
 	"github.com/caarlos0/env/v11"
 	"github.com/cockroachdb/errors"
 
+	"github.com/Finatext/belldog/internal/apigateway"
 	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/eventbridge"
 	"github.com/Finatext/belldog/internal/handler"
+	"github.com/Finatext/belldog/internal/lambdainvoke"
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/middlewares"
+	"github.com/Finatext/belldog/internal/receipt"
+	"github.com/Finatext/belldog/internal/runtimeconfig"
+	"github.com/Finatext/belldog/internal/secretenv"
 	"github.com/Finatext/belldog/internal/service"
 	"github.com/Finatext/belldog/internal/slack"
 	"github.com/Finatext/belldog/internal/storage"
+	"github.com/Finatext/belldog/internal/telemetry"
 	"github.com/Finatext/ssmenv-go"
 )
 
@@ -28,14 +39,18 @@ func main() {
 	}
 }
 
+// Slack API is reached within a second usually. Don't let prewarming delay cold starts much.
+const slackPrewarmTimeout = 2 * time.Second
+
 func doMain() error {
+	start := time.Now()
 	ctx := context.Background()
 	logLevel := new(slog.LevelVar)
 	ops := slog.HandlerOptions{
 		AddSource: true,
 		Level:     logLevel,
 	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &ops))
+	logger := slog.New(logging.NewContextHandler(slog.NewJSONHandler(os.Stdout, &ops)))
 	slog.SetDefault(logger)
 
 	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
@@ -47,6 +62,10 @@ func doMain() error {
 	if err != nil {
 		return errors.Wrap(err, "failed to replace env")
 	}
+	replacedEnv, err = secretenv.ReplacedEnv(ctx, secretenv.NewClient(awsConfig), replacedEnv)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace env with Secrets Manager")
+	}
 	config, err := env.ParseAsWithOptions[appconfig.Config](env.Options{
 		Environment: replacedEnv,
 	})
@@ -55,23 +74,163 @@ func doMain() error {
 	}
 
 	logLevel.Set(config.GoLog)
+	if err := runtimeconfig.ValidateRegionRole(config.RegionRole); err != nil {
+		return err
+	}
+	if err := middlewares.ValidateAccessLog(config); err != nil {
+		return err
+	}
+	if err := handler.ValidateOpsRouting(config); err != nil {
+		return err
+	}
+	if err := slack.ValidateChannelTypes(config); err != nil {
+		return err
+	}
+	settings := runtimeconfig.NewStore(config, ssmClient, logLevel)
 
-	slackClient := slack.NewClient(config)
-	ddb, err := storage.NewDDB(ctx, awsConfig, config.DdbTableName)
+	shutdownTelemetry, err := telemetry.Setup(ctx, config)
 	if err != nil {
 		return err
 	}
-	tokenSvc := service.NewTokenService(&ddb)
+
+	slackClient, err := slack.NewClient(config)
+	if err != nil {
+		return err
+	}
+	slackClient.SetCircuitListener(handler.CircuitNotifier(config, &slackClient, settings))
+	ddb, err := storage.NewStorage(ctx, awsConfig, config)
+	if err != nil {
+		return err
+	}
+	if dual, ok := ddb.(*storage.DualWrite); ok {
+		dual.SetDriftListener(handler.DriftNotifier(config, &slackClient, settings))
+	}
+	tokenSvc := service.NewTokenService(ddb, config.RevokeGracePeriod)
+	auditSvc := service.NewAuditService(nil)
+	if config.AuditTableName != "" {
+		auditDDB, err := storage.NewAuditDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.AuditTableName)
+		if err != nil {
+			return err
+		}
+		auditSvc = service.NewAuditService(&auditDDB)
+	}
+	mentionSvc := service.NewMentionService(nil, config.MentionCacheTTL)
+	if config.MentionResolution {
+		mentionSvc = service.NewMentionService(&slackClient, config.MentionCacheTTL)
+	}
+	channelConfigSvc := service.NewChannelConfigService(nil)
+	if config.ChannelConfigTableName != "" {
+		channelConfigDDB, err := storage.NewChannelConfigDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.ChannelConfigTableName)
+		if err != nil {
+			return err
+		}
+		channelConfigSvc = service.NewChannelConfigService(&channelConfigDDB)
+	}
+	idempotencySvc := service.NewIdempotencyService(nil, config.IdempotencyTTL)
+	if config.IdempotencyTableName != "" {
+		idempotencyDDB, err := storage.NewIdempotencyDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.IdempotencyTableName)
+		if err != nil {
+			return err
+		}
+		idempotencySvc = service.NewIdempotencyService(&idempotencyDDB, config.IdempotencyTTL)
+	}
+	inventorySvc := service.NewInventoryService(nil, config.ChannelInventoryMaxAge)
+	if config.ChannelInventoryTableName != "" {
+		inventoryDDB, err := storage.NewInventoryDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.ChannelInventoryTableName)
+		if err != nil {
+			return err
+		}
+		inventorySvc = service.NewInventoryService(&inventoryDDB, config.ChannelInventoryMaxAge)
+	}
+	lifecycleSvc := service.NewLifecycleService(nil, config.LifecycleEventBusName)
+	if config.LifecycleEvents {
+		lifecycleSvc = service.NewLifecycleService(eventbridge.NewClient(awsConfig), config.LifecycleEventBusName)
+	}
+	digestSvc := service.NewDigestService(nil)
+	if config.DigestTableName != "" {
+		digestDDB, err := storage.NewDigestDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.DigestTableName)
+		if err != nil {
+			return err
+		}
+		digestSvc = service.NewDigestService(&digestDDB)
+	}
+	broadcastSvc := service.NewBroadcastService(nil)
+	if config.BroadcastTableName != "" {
+		broadcastDDB, err := storage.NewBroadcastDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.BroadcastTableName)
+		if err != nil {
+			return err
+		}
+		broadcastSvc = service.NewBroadcastService(&broadcastDDB)
+	}
+	receiptDest, err := receipt.ParseDestination(config.ReceiptDestination)
+	if err != nil {
+		return err
+	}
+	receipts := receipt.NewClient(awsConfig, receiptDest)
+
+	// All clients are built above once per execution environment and reused across invocations.
+	if config.SlackPrewarm {
+		prewarmCtx, cancel := context.WithTimeout(ctx, slackPrewarmTimeout)
+		if err := slackClient.Prewarm(prewarmCtx); err != nil {
+			slog.Warn("failed to prewarm Slack API connection", slog.String("error", err.Error()))
+		}
+		cancel()
+	}
+	coldStart := time.Since(start)
+	telemetry.RecordColdStart(ctx, config.Mode, coldStart)
+	slog.Info("initialized", slog.String("mode", config.Mode), slog.Duration("cold_start", coldStart))
 
 	switch config.Mode {
 	case "proxy":
-		e := handler.NewEchoHandler(config, &slackClient, &tokenSvc)
-		lambda.Start(lambdaurl.Wrap(e))
+		// Deferred slash commands are processed by invoking this function itself.
+		deferrer := handler.NewLambdaDeferrer(lambdainvoke.NewClient(awsConfig), os.Getenv("AWS_LAMBDA_FUNCTION_NAME"), os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"))
+		e := handler.NewEchoHandler(config, &slackClient, &tokenSvc, &auditSvc, &channelConfigSvc, mentionSvc, &idempotencySvc, &digestSvc, &broadcastSvc, ddb, settings, deferrer, receipts, &lifecycleSvc, &inventorySvc)
+		h, err := wrapHTTPHandler(config.LambdaEventFormat, e)
+		if err != nil {
+			return err
+		}
+		warmup := handler.NewWarmupHandler(&slackClient, ddb)
+		lambda.StartWithOptions(deferrer.Wrap(e, warmup.Wrap(lambda.NewHandler(h))), lambda.WithEnableSIGTERM(flushTelemetry(shutdownTelemetry)))
 	case "batch":
-		h := handler.NewBatchHandler(config, &slackClient, &ddb)
-		lambda.Start(h.HandleCloudWatchEvent)
+		h := handler.NewBatchHandler(config, &slackClient, ddb, settings, &auditSvc, &idempotencySvc, &lifecycleSvc, &idempotencySvc, &inventorySvc)
+		lambda.StartWithOptions(h.HandleCloudWatchEvent, lambda.WithEnableSIGTERM(flushTelemetry(shutdownTelemetry)))
+	case "batch_step":
+		// Checkpoints are saved in the idempotency table.
+		if !idempotencySvc.Enabled() {
+			return errors.New("`batch_step` mode requires IDEMPOTENCY_TABLE_NAME")
+		}
+		h := handler.NewBatchHandler(config, &slackClient, ddb, settings, &auditSvc, &idempotencySvc, &lifecycleSvc, &idempotencySvc, &inventorySvc)
+		lambda.StartWithOptions(h.HandleStep, lambda.WithEnableSIGTERM(flushTelemetry(shutdownTelemetry)))
+	case "digest":
+		h := handler.NewDigestHandler(config, &slackClient, &digestSvc, &channelConfigSvc)
+		lambda.StartWithOptions(h.HandleCloudWatchEvent, lambda.WithEnableSIGTERM(flushTelemetry(shutdownTelemetry)))
 	default:
 		return errors.Newf("Unknown `mode` env given: %s", config.Mode)
 	}
 	return nil
 }
+
+// wrapHTTPHandler converts the handler for the Lambda event format selected by LAMBDA_EVENT_FORMAT.
+func wrapHTTPHandler(format string, h http.Handler) (interface{}, error) {
+	switch format {
+	case apigateway.FormatFunctionURL:
+		return lambdaurl.Wrap(h), nil
+	case apigateway.FormatHTTPAPI:
+		return apigateway.WrapHTTPAPI(h), nil
+	case apigateway.FormatRESTAPI:
+		return apigateway.WrapRESTAPI(h), nil
+	case apigateway.FormatAuto:
+		return apigateway.WrapAuto(h), nil
+	default:
+		return nil, errors.Newf("Unknown `LAMBDA_EVENT_FORMAT` env given: %s", format)
+	}
+}
+
+// Lambda sends SIGTERM before shutting down the execution environment only when extensions are registered.
+func flushTelemetry(shutdown func(context.Context) error) func() {
+	return func() {
+		if err := shutdown(context.Background()); err != nil {
+			slog.Error("failed to shutdown telemetry", slog.String("error", err.Error()))
+		}
+	}
+}
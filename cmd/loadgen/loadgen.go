@@ -0,0 +1,259 @@
+// loadgen replays synthetic webhook traffic and reports the latency percentiles, to measure the webhook path
+// before and after optimizations. Without -url, it serves Belldog in process with the memory storage and the
+// stub Slack client, and reports allocations per request too.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/cockroachdb/errors"
+	"github.com/phsym/console-slog"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/handler"
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+const usage = `Usage: loadgen [flags]
+
+Posts the payload to the webhook URL and reports p50/p90/p99 latencies. Without -url, Belldog is served in process
+with STORAGE_BACKEND=memory and SLACK_STUB=true, and allocations per request are reported, including the client.
+
+Flags:
+`
+
+// Synthetic payload with blocks, similar to deployment notifications.
+const defaultPayload = `{
+  "text": "Deployment finished",
+  "blocks": [
+    {"type": "header", "text": {"type": "plain_text", "text": "Deployment finished"}},
+    {"type": "section", "fields": [
+      {"type": "mrkdwn", "text": "*Service:*\nbelldog"},
+      {"type": "mrkdwn", "text": "*Version:*\nv1.2.3"},
+      {"type": "mrkdwn", "text": "*Environment:*\nproduction"},
+      {"type": "mrkdwn", "text": "*Duration:*\n3m12s"}
+    ]},
+    {"type": "context", "elements": [{"type": "mrkdwn", "text": "Triggered by <https://example.com/runs/1|run #1>"}]}
+  ]
+}`
+
+func main() {
+	if err := doMain(); err != nil {
+		slog.Error("failed to run", slog.String("error", fmt.Sprintf("%+v", err)))
+		os.Exit(1)
+	}
+}
+
+func doMain() error {
+	targetURL := flag.String("url", "", "Webhook URL to post to. Serves Belldog in process if empty.")
+	requests := flag.Int("requests", 10000, "Number of requests.")
+	concurrency := flag.Int("concurrency", 16, "Number of concurrent clients.")
+	payloadFile := flag.String("payload", "", "File having the JSON payload. A synthetic payload with blocks if empty.")
+	serverLog := flag.Bool("server-log", false, "Write logs of the in-process server to stderr instead of discarding them. Logs are formatted as JSON either way.")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *requests <= 0 || *concurrency <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	slog.SetDefault(slog.New(console.NewHandler(os.Stderr, &console.HandlerOptions{Level: slog.LevelInfo})))
+
+	payload := []byte(defaultPayload)
+	if *payloadFile != "" {
+		b, err := os.ReadFile(*payloadFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read payload file")
+		}
+		payload = b
+	}
+
+	inProcess := *targetURL == ""
+	if inProcess {
+		// Log as Lambda does, so the cost of logging is measured.
+		var logOut io.Writer = io.Discard
+		if *serverLog {
+			logOut = os.Stderr
+		}
+		slog.SetDefault(slog.New(logging.NewContextHandler(slog.NewJSONHandler(logOut, &slog.HandlerOptions{AddSource: true}))))
+		hookURL, stop, err := serveLocal(ctx)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		*targetURL = hookURL
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency},
+		Timeout:   30 * time.Second,
+	}
+	// Warm up connections and lazily initialized code paths.
+	if _, err := post(ctx, client, *targetURL, payload); err != nil {
+		return err
+	}
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	res := run(ctx, client, *targetURL, payload, *requests, *concurrency)
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	fmt.Printf("requests=%d errors=%d concurrency=%d duration=%s rps=%.1f\n", *requests, res.errors, *concurrency, res.elapsed.Round(time.Millisecond), float64(*requests)/res.elapsed.Seconds())
+	fmt.Printf("latency p50=%s p90=%s p99=%s max=%s\n", res.percentile(0.5), res.percentile(0.9), res.percentile(0.99), res.percentile(1))
+	if inProcess {
+		n := uint64(*requests)
+		fmt.Printf("allocs/req=%d bytes/req=%d\n", (after.Mallocs-before.Mallocs)/n, (after.TotalAlloc-before.TotalAlloc)/n)
+	}
+	if res.errors > 0 {
+		return errors.Newf("%d requests failed, the last error: %v", res.errors, res.lastErr)
+	}
+	return nil
+}
+
+// serveLocal serves Belldog on a random local port with a token generated for the `loadgen` channel. Returns the
+// webhook URL.
+func serveLocal(ctx context.Context) (string, func(), error) {
+	config, err := env.ParseAsWithOptions[appconfig.Config](env.Options{
+		Environment: map[string]string{
+			"DDB_TABLE_NAME":                "loadgen",
+			"MODE":                          "proxy",
+			"OPS_NOTIFICATION_CHANNEL_NAME": "ops",
+			"SLACK_SIGNING_SECRET":          "loadgen",
+			"SLACK_STUB":                    "true",
+			"SLACK_TOKEN":                   "loadgen",
+			"STORAGE_BACKEND":               storage.BackendMemory,
+		},
+	})
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to process config")
+	}
+	slackClient, err := slack.NewClient(config)
+	if err != nil {
+		return "", nil, err
+	}
+	ddb := storage.NewMemory()
+	tokenSvc := service.NewTokenService(ddb, config.RevokeGracePeriod)
+	generated, err := tokenSvc.GenerateAndSaveToken(ctx, "C0LOADGEN", "loadgen", service.ScopePost)
+	if err != nil {
+		return "", nil, err
+	}
+	auditSvc := service.NewAuditService(nil)
+	channelConfigSvc := service.NewChannelConfigService(nil)
+	mentionSvc := service.NewMentionService(nil, config.MentionCacheTTL)
+	idempotencySvc := service.NewIdempotencyService(nil, config.IdempotencyTTL)
+	digestSvc := service.NewDigestService(nil)
+	broadcastSvc := service.NewBroadcastService(nil)
+	e := handler.NewEchoHandler(config, &slackClient, &tokenSvc, &auditSvc, &channelConfigSvc, mentionSvc, &idempotencySvc, &digestSvc, &broadcastSvc, ddb, nil, nil, nil, nil, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to listen")
+	}
+	server := &http.Server{Handler: e, ReadTimeout: config.ServerReadTimeout, WriteTimeout: config.ServerWriteTimeout}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server stopped", slog.String("error", err.Error()))
+		}
+	}()
+	stop := func() {
+		if err := server.Shutdown(context.Background()); err != nil {
+			slog.Error("failed to shutdown server", slog.String("error", err.Error()))
+		}
+	}
+	return fmt.Sprintf("http://%s/p/loadgen/%s", listener.Addr(), generated.Token.Reveal()), stop, nil
+}
+
+type result struct {
+	latencies []time.Duration
+	elapsed   time.Duration
+	errors    int
+	lastErr   error
+}
+
+// percentile returns the latency at p, 0 < p <= 1, of the sorted latencies.
+func (r result) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.latencies)-1) * p)
+	return r.latencies[i].Round(time.Microsecond)
+}
+
+func run(ctx context.Context, client *http.Client, targetURL string, payload []byte, requests int, concurrency int) result {
+	var (
+		next      atomic.Int64
+		mu        sync.Mutex
+		res       result
+		wg        sync.WaitGroup
+		latencies = make([]time.Duration, 0, requests)
+	)
+	start := time.Now()
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next.Add(1) <= int64(requests) {
+				latency, err := post(ctx, client, targetURL, payload)
+				mu.Lock()
+				if err != nil {
+					res.errors++
+					res.lastErr = err
+				} else {
+					latencies = append(latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	slices.Sort(latencies)
+	res.latencies = latencies
+	return res
+}
+
+func post(ctx context.Context, client *http.Client, targetURL string, payload []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to post")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	latency := time.Since(start)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.Newf("unexpected response: status=%d, body=%s", resp.StatusCode, string(body))
+	}
+	return latency, nil
+}
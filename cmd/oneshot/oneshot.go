@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
@@ -14,9 +15,14 @@ import (
 	"github.com/phsym/console-slog"
 
 	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/eventbridge"
 	"github.com/Finatext/belldog/internal/handler"
+	"github.com/Finatext/belldog/internal/runtimeconfig"
+	"github.com/Finatext/belldog/internal/secretenv"
+	"github.com/Finatext/belldog/internal/service"
 	"github.com/Finatext/belldog/internal/slack"
 	"github.com/Finatext/belldog/internal/storage"
+	"github.com/Finatext/belldog/internal/telemetry"
 	"github.com/Finatext/ssmenv-go"
 )
 
@@ -28,6 +34,9 @@ func main() {
 }
 
 func doMain() error {
+	dryRun := flag.Bool("dry-run", false, "Log what the batch job would do without deleting records or posting messages. Same as BATCH_DRY_RUN=true.")
+	flag.Parse()
+
 	ctx := context.Background()
 	logLevel := new(slog.LevelVar)
 	slog.SetDefault(slog.New(console.NewHandler(os.Stderr, &console.HandlerOptions{Level: logLevel})))
@@ -41,6 +50,10 @@ func doMain() error {
 	if err != nil {
 		return errors.Wrap(err, "failed to replace env")
 	}
+	replacedEnv, err = secretenv.ReplacedEnv(ctx, secretenv.NewClient(awsConfig), replacedEnv)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace env with Secrets Manager")
+	}
 	config, err := env.ParseAsWithOptions[appconfig.Config](env.Options{
 		Environment: replacedEnv,
 	})
@@ -48,14 +61,69 @@ func doMain() error {
 		return errors.Wrap(err, "failed to process config from env")
 	}
 
+	if *dryRun {
+		config.BatchDryRun = true
+	}
 	logLevel.Set(config.GoLog)
+	if err := runtimeconfig.ValidateRegionRole(config.RegionRole); err != nil {
+		return err
+	}
+	if err := handler.ValidateOpsRouting(config); err != nil {
+		return err
+	}
+	settings := runtimeconfig.NewStore(config, ssmClient, logLevel)
+
+	shutdownTelemetry, err := telemetry.Setup(ctx, config)
+	if err != nil {
+		return err
+	}
 
-	slackClient := slack.NewClient(config)
-	ddb, err := storage.NewDDB(ctx, awsConfig, config.DdbTableName)
+	slackClient, err := slack.NewClient(config)
+	if err != nil {
+		return err
+	}
+	slackClient.SetCircuitListener(handler.CircuitNotifier(config, &slackClient, settings))
+	ddb, err := storage.NewStorage(ctx, awsConfig, config)
 	if err != nil {
 		return err
 	}
+	if dual, ok := ddb.(*storage.DualWrite); ok {
+		dual.SetDriftListener(handler.DriftNotifier(config, &slackClient, settings))
+	}
 
-	h := handler.NewBatchHandler(config, &slackClient, &ddb)
-	return h.HandleCloudWatchEvent(ctx, events.CloudWatchEvent{})
+	auditSvc := service.NewAuditService(nil)
+	if config.AuditTableName != "" {
+		auditDDB, err := storage.NewAuditDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.AuditTableName)
+		if err != nil {
+			return err
+		}
+		auditSvc = service.NewAuditService(&auditDDB)
+	}
+	idempotencySvc := service.NewIdempotencyService(nil, config.IdempotencyTTL)
+	if config.IdempotencyTableName != "" {
+		idempotencyDDB, err := storage.NewIdempotencyDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.IdempotencyTableName)
+		if err != nil {
+			return err
+		}
+		idempotencySvc = service.NewIdempotencyService(&idempotencyDDB, config.IdempotencyTTL)
+	}
+	inventorySvc := service.NewInventoryService(nil, config.ChannelInventoryMaxAge)
+	if config.ChannelInventoryTableName != "" {
+		inventoryDDB, err := storage.NewInventoryDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.ChannelInventoryTableName)
+		if err != nil {
+			return err
+		}
+		inventorySvc = service.NewInventoryService(&inventoryDDB, config.ChannelInventoryMaxAge)
+	}
+	lifecycleSvc := service.NewLifecycleService(nil, config.LifecycleEventBusName)
+	if config.LifecycleEvents {
+		lifecycleSvc = service.NewLifecycleService(eventbridge.NewClient(awsConfig), config.LifecycleEventBusName)
+	}
+
+	h := handler.NewBatchHandler(config, &slackClient, ddb, settings, &auditSvc, &idempotencySvc, &lifecycleSvc, &idempotencySvc, &inventorySvc)
+	err = h.HandleCloudWatchEvent(ctx, events.CloudWatchEvent{})
+	if shutdownErr := shutdownTelemetry(ctx); shutdownErr != nil {
+		slog.Error("failed to shutdown telemetry", slog.String("error", shutdownErr.Error()))
+	}
+	return err
 }
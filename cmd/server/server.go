@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
@@ -13,10 +16,17 @@ import (
 	"github.com/phsym/console-slog"
 
 	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/eventbridge"
 	"github.com/Finatext/belldog/internal/handler"
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/middlewares"
+	"github.com/Finatext/belldog/internal/receipt"
+	"github.com/Finatext/belldog/internal/runtimeconfig"
+	"github.com/Finatext/belldog/internal/secretenv"
 	"github.com/Finatext/belldog/internal/service"
 	"github.com/Finatext/belldog/internal/slack"
 	"github.com/Finatext/belldog/internal/storage"
+	"github.com/Finatext/belldog/internal/telemetry"
 	"github.com/Finatext/ssmenv-go"
 )
 
@@ -30,7 +40,7 @@ func main() {
 func doMain() error {
 	ctx := context.Background()
 	logLevel := new(slog.LevelVar)
-	slog.SetDefault(slog.New(console.NewHandler(os.Stderr, &console.HandlerOptions{Level: logLevel})))
+	slog.SetDefault(slog.New(logging.NewContextHandler(console.NewHandler(os.Stderr, &console.HandlerOptions{Level: logLevel}))))
 
 	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
 	if err != nil {
@@ -41,6 +51,10 @@ func doMain() error {
 	if err != nil {
 		return errors.Wrap(err, "failed to replace env")
 	}
+	replacedEnv, err = secretenv.ReplacedEnv(ctx, secretenv.NewClient(awsConfig), replacedEnv)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace env with Secrets Manager")
+	}
 	config, err := env.ParseAsWithOptions[appconfig.Config](env.Options{
 		Environment: replacedEnv,
 	})
@@ -49,15 +63,150 @@ func doMain() error {
 	}
 
 	logLevel.Set(config.GoLog)
+	if err := runtimeconfig.ValidateRegionRole(config.RegionRole); err != nil {
+		return err
+	}
+	if err := middlewares.ValidateAccessLog(config); err != nil {
+		return err
+	}
+	if err := handler.ValidateOpsRouting(config); err != nil {
+		return err
+	}
+	if err := slack.ValidateChannelTypes(config); err != nil {
+		return err
+	}
+	settings := runtimeconfig.NewStore(config, ssmClient, logLevel)
 
-	slackClient := slack.NewClient(config)
-	ddb, err := storage.NewDDB(ctx, awsConfig, config.DdbTableName)
+	if (config.ServerTLSCertFile == "") != (config.ServerTLSKeyFile == "") {
+		return errors.New("both of SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE must be set to enable TLS")
+	}
+
+	shutdownTelemetry, err := telemetry.Setup(ctx, config)
 	if err != nil {
 		return err
 	}
-	tokenSvc := service.NewTokenService(&ddb)
+	defer func() {
+		if err := shutdownTelemetry(context.Background()); err != nil {
+			slog.Error("failed to shutdown telemetry", slog.String("error", err.Error()))
+		}
+	}()
 
-	e := handler.NewEchoHandler(config, &slackClient, &tokenSvc)
-	e.Logger.Fatal(e.Start(":3000"))
+	slackClient, err := slack.NewClient(config)
+	if err != nil {
+		return err
+	}
+	slackClient.SetCircuitListener(handler.CircuitNotifier(config, &slackClient, settings))
+	ddb, err := storage.NewStorage(ctx, awsConfig, config)
+	if err != nil {
+		return err
+	}
+	if dual, ok := ddb.(*storage.DualWrite); ok {
+		dual.SetDriftListener(handler.DriftNotifier(config, &slackClient, settings))
+	}
+	tokenSvc := service.NewTokenService(ddb, config.RevokeGracePeriod)
+	auditSvc := service.NewAuditService(nil)
+	if config.AuditTableName != "" {
+		auditDDB, err := storage.NewAuditDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.AuditTableName)
+		if err != nil {
+			return err
+		}
+		auditSvc = service.NewAuditService(&auditDDB)
+	}
+	mentionSvc := service.NewMentionService(nil, config.MentionCacheTTL)
+	if config.MentionResolution {
+		mentionSvc = service.NewMentionService(&slackClient, config.MentionCacheTTL)
+	}
+	channelConfigSvc := service.NewChannelConfigService(nil)
+	if config.ChannelConfigTableName != "" {
+		channelConfigDDB, err := storage.NewChannelConfigDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.ChannelConfigTableName)
+		if err != nil {
+			return err
+		}
+		channelConfigSvc = service.NewChannelConfigService(&channelConfigDDB)
+	}
+	idempotencySvc := service.NewIdempotencyService(nil, config.IdempotencyTTL)
+	if config.IdempotencyTableName != "" {
+		idempotencyDDB, err := storage.NewIdempotencyDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.IdempotencyTableName)
+		if err != nil {
+			return err
+		}
+		idempotencySvc = service.NewIdempotencyService(&idempotencyDDB, config.IdempotencyTTL)
+	}
+	inventorySvc := service.NewInventoryService(nil, config.ChannelInventoryMaxAge)
+	if config.ChannelInventoryTableName != "" {
+		inventoryDDB, err := storage.NewInventoryDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.ChannelInventoryTableName)
+		if err != nil {
+			return err
+		}
+		inventorySvc = service.NewInventoryService(&inventoryDDB, config.ChannelInventoryMaxAge)
+	}
+	lifecycleSvc := service.NewLifecycleService(nil, config.LifecycleEventBusName)
+	if config.LifecycleEvents {
+		lifecycleSvc = service.NewLifecycleService(eventbridge.NewClient(awsConfig), config.LifecycleEventBusName)
+	}
+	digestSvc := service.NewDigestService(nil)
+	if config.DigestTableName != "" {
+		digestDDB, err := storage.NewDigestDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.DigestTableName)
+		if err != nil {
+			return err
+		}
+		digestSvc = service.NewDigestService(&digestDDB)
+	}
+	broadcastSvc := service.NewBroadcastService(nil)
+	if config.BroadcastTableName != "" {
+		broadcastDDB, err := storage.NewBroadcastDDB(ctx, storage.DynamoDBConfig(awsConfig, config), config.BroadcastTableName)
+		if err != nil {
+			return err
+		}
+		broadcastSvc = service.NewBroadcastService(&broadcastDDB)
+	}
+	receiptDest, err := receipt.ParseDestination(config.ReceiptDestination)
+	if err != nil {
+		return err
+	}
+	receipts := receipt.NewClient(awsConfig, receiptDest)
+
+	e := handler.NewEchoHandler(config, &slackClient, &tokenSvc, &auditSvc, &channelConfigSvc, mentionSvc, &idempotencySvc, &digestSvc, &broadcastSvc, ddb, settings, nil, receipts, &lifecycleSvc, &inventorySvc)
+	server := &http.Server{
+		Addr:           config.ServerAddr,
+		Handler:        e,
+		ReadTimeout:    config.ServerReadTimeout,
+		WriteTimeout:   config.ServerWriteTimeout,
+		IdleTimeout:    config.ServerIdleTimeout,
+		MaxHeaderBytes: config.ServerMaxHeaderBytes,
+	}
+	return serve(ctx, server, config)
+}
+
+// serve runs the server until SIGINT or SIGTERM, then stops accepting new connections and waits in-flight
+// requests up to SERVER_SHUTDOWN_TIMEOUT.
+func serve(ctx context.Context, server *http.Server, config appconfig.Config) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tls := config.ServerTLSCertFile != ""
+	errCh := make(chan error, 1)
+	go func() {
+		if tls {
+			errCh <- server.ListenAndServeTLS(config.ServerTLSCertFile, config.ServerTLSKeyFile)
+		} else {
+			errCh <- server.ListenAndServe()
+		}
+	}()
+	slog.InfoContext(ctx, "server started", slog.String("addr", server.Addr), slog.Bool("tls", tls))
+
+	select {
+	case err := <-errCh:
+		return errors.Wrap(err, "server stopped")
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server", slog.Duration("timeout", config.ServerShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ServerShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return errors.Wrap(err, "failed to shutdown server gracefully")
+	}
+	slog.Info("server stopped")
 	return nil
 }
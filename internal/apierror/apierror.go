@@ -0,0 +1,141 @@
+// Package apierror responds errors of Belldog endpoints. Legacy callers get the plain text message as before,
+// and callers preferring JSON get the error envelope having a machine-readable code, so automated callers can
+// branch on the code instead of parsing messages.
+package apierror
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+)
+
+// Code is the machine-readable error code. Callers branch on codes, so never change existing values.
+type Code string
+
+const (
+	CodeTokenNotFound            Code = "not_found"
+	CodeTokenUnmatch             Code = "unmatch"
+	CodeScopeUnmatch             Code = "scope_unmatch"
+	CodeExpired                  Code = "expired"
+	CodeGroupNotFound            Code = "group_not_found"
+	CodeInvalidBody              Code = "invalid_body"
+	CodeInvalidPayload           Code = "invalid_payload"
+	CodeSchemaViolation          Code = "schema_violation"
+	CodeInvalidMentions          Code = "invalid_mentions"
+	CodeInvalidAction            Code = "invalid_action"
+	CodeInvalidIdempotencyKey    Code = "invalid_idempotency_key"
+	CodeIdempotencyKeyInProgress Code = "idempotency_key_in_progress"
+	CodeFileRequired             Code = "file_required"
+	CodeBodyTooLarge             Code = "body_too_large"
+	CodeUnsupportedContentType   Code = "unsupported_content_type"
+	CodeInvalidSignature         Code = "invalid_signature"
+	CodeChannelNotFound          Code = "channel_not_found"
+	CodeNotInChannel             Code = "not_in_channel"
+	CodeChannelUndeliverable     Code = "channel_undeliverable"
+	CodeSlackTimeout             Code = "slack_timeout"
+	CodeDeadlineExceeded         Code = "deadline_exceeded"
+	CodeSlackRateLimited         Code = "slack_rate_limited"
+	CodeSlackUnavailable         Code = "slack_unavailable"
+	CodeSlackServerError         Code = "slack_server_error"
+	CodeSlackClientError         Code = "slack_client_error"
+	CodeSlackAPIError            Code = "slack_api_error"
+	CodeStorageThrottled         Code = "storage_throttled"
+	CodeRouteNotFound            Code = "route_not_found"
+	CodeMethodNotAllowed         Code = "method_not_allowed"
+	CodeInternalError            Code = "internal_error"
+)
+
+// DocsURL describes the error codes.
+const DocsURL = "https://github.com/Finatext/belldog#error-responses"
+
+// Context key to respond JSON regardless of the request, for JSON only endpoints.
+const preferJSONKey = "apierror.prefer_json"
+
+// Response is the JSON error envelope.
+type Response struct {
+	Ok        bool   `json:"ok"`
+	Code      Code   `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	DocsURL   string `json:"docs_url"`
+}
+
+// WantsJSON tells whether the caller prefers JSON responses. Legacy clients expect plain text responses, so
+// JSON is opt-in with `Accept: application/json` header field or `response=json` query parameter.
+func WantsJSON(c echo.Context) bool {
+	if prefer, _ := c.Get(preferJSONKey).(bool); prefer {
+		return true
+	}
+	req := c.Request()
+	if req.URL.Query().Get("response") == "json" {
+		return true
+	}
+	for _, accept := range req.Header.Values(echo.HeaderAccept) {
+		if strings.Contains(accept, echo.MIMEApplicationJSON) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferJSON makes errors of the request responded with JSON, for endpoints always responding JSON.
+func PreferJSON(c echo.Context) {
+	c.Set(preferJSONKey, true)
+}
+
+// Respond writes the error response: the envelope for callers preferring JSON, otherwise msg as plain text.
+func Respond(c echo.Context, status int, code Code, msg string) error {
+	if !WantsJSON(c) {
+		return c.String(status, msg)
+	}
+	return c.JSON(status, Response{
+		Ok:        false,
+		Code:      code,
+		Message:   strings.TrimSpace(msg),
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+		DocsURL:   DocsURL,
+	})
+}
+
+// HTTPErrorHandler responds errors returned from handlers, e.g. unknown routes and unexpected errors, with the
+// envelope for callers preferring JSON. Other callers get the echo's default responses as before.
+func HTTPErrorHandler(e *echo.Echo) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed || !WantsJSON(c) {
+			e.DefaultHTTPErrorHandler(err, c)
+			return
+		}
+		status := http.StatusInternalServerError
+		code := CodeInternalError
+		msg := "Internal server error."
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			status = he.Code
+			msg = http.StatusText(status)
+			if m, ok := he.Message.(string); ok {
+				msg = m
+			}
+			switch status {
+			case http.StatusNotFound:
+				code = CodeRouteNotFound
+			case http.StatusMethodNotAllowed:
+				code = CodeMethodNotAllowed
+			case http.StatusRequestEntityTooLarge:
+				code = CodeBodyTooLarge
+			case http.StatusUnsupportedMediaType:
+				code = CodeUnsupportedContentType
+			}
+		}
+		var respErr error
+		if c.Request().Method == http.MethodHead {
+			respErr = c.NoContent(status)
+		} else {
+			respErr = Respond(c, status, code, msg)
+		}
+		if respErr != nil {
+			e.Logger.Error(respErr)
+		}
+	}
+}
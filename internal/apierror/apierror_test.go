@@ -0,0 +1,62 @@
+package apierror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		want   bool
+	}{
+		{name: "default", target: "/", want: false},
+		{name: "accept header", target: "/", accept: "application/json", want: true},
+		{name: "query parameter", target: "/?response=json", want: true},
+		{name: "other accept", target: "/", accept: "text/plain", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set(echo.HeaderAccept, tt.accept)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			assert.Equal(t, tt.want, WantsJSON(c))
+		})
+	}
+}
+
+func TestPreferJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+	PreferJSON(c)
+
+	assert.NoError(t, Respond(c, http.StatusBadRequest, CodeInvalidBody, "Invalid body given.\n"))
+	assert.JSONEq(t, `{"ok": false, "code": "invalid_body", "message": "Invalid body given.", "docs_url": "https://github.com/Finatext/belldog#error-responses"}`, rec.Body.String())
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler(e)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/unknown", nil)
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"ok": false, "code": "route_not_found", "message": "Not Found", "docs_url": "https://github.com/Finatext/belldog#error-responses"}`, rec.Body.String())
+
+	// Legacy callers get the echo's default response.
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"message": "Not Found"}`, rec.Body.String())
+}
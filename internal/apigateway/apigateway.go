@@ -0,0 +1,177 @@
+// Package apigateway converts an http.Handler into Lambda request handlers for API Gateway events, in addition
+// to Lambda Function URLs supported by github.com/Finatext/lambdaurl-buffered. Responses are buffered.
+package apigateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/cockroachdb/errors"
+)
+
+// Event formats selected with LAMBDA_EVENT_FORMAT.
+const (
+	// Lambda Function URLs.
+	FormatFunctionURL = "function_url"
+	// API Gateway HTTP API with payload format version 2.0.
+	FormatHTTPAPI = "http_api"
+	// API Gateway REST API, or HTTP API with payload format version 1.0.
+	FormatRESTAPI = "rest_api"
+	// Detect the format from each event.
+	FormatAuto = "auto"
+)
+
+// WrapHTTPAPI converts an http.Handler into a Lambda handler for API Gateway HTTP API payload format 2.0.
+// Function URL events have the same format, so this also handles them.
+func WrapHTTPAPI(handler http.Handler) func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		// Named stages prefix the raw path, e.g. `/prod/p/...`.
+		path := request.RawPath
+		if stage := request.RequestContext.Stage; stage != "" && stage != "$default" {
+			path = strings.TrimPrefix(path, "/"+stage)
+		}
+		httpRequest, err := newRequest(ctx, request.RequestContext.HTTP.Method, request.RequestContext.DomainName, path, request.RawQueryString, request.Body, request.IsBase64Encoded)
+		if err != nil {
+			return events.APIGatewayV2HTTPResponse{}, err
+		}
+		httpRequest.RemoteAddr = request.RequestContext.HTTP.SourceIP
+		for k, v := range request.Headers {
+			httpRequest.Header.Add(k, v)
+		}
+		if len(request.Cookies) > 0 {
+			httpRequest.Header.Set("Cookie", strings.Join(request.Cookies, "; "))
+		}
+
+		res := serve(handler, httpRequest)
+		response := events.APIGatewayV2HTTPResponse{
+			StatusCode: res.code,
+			Body:       res.body.String(),
+			Headers:    make(map[string]string, len(res.Header())),
+		}
+		for k, v := range res.Header() {
+			if k == "Set-Cookie" {
+				response.Cookies = v
+			} else {
+				response.Headers[k] = strings.Join(v, ",")
+			}
+		}
+		return response, nil
+	}
+}
+
+// WrapRESTAPI converts an http.Handler into a Lambda handler for API Gateway REST API proxy integrations.
+func WrapRESTAPI(handler http.Handler) func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		query := url.Values{}
+		for k, vs := range request.MultiValueQueryStringParameters {
+			for _, v := range vs {
+				query.Add(k, v)
+			}
+		}
+		if len(request.MultiValueQueryStringParameters) == 0 {
+			for k, v := range request.QueryStringParameters {
+				query.Add(k, v)
+			}
+		}
+		httpRequest, err := newRequest(ctx, request.HTTPMethod, request.RequestContext.DomainName, request.Path, query.Encode(), request.Body, request.IsBase64Encoded)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		httpRequest.RemoteAddr = request.RequestContext.Identity.SourceIP
+		for k, vs := range request.MultiValueHeaders {
+			for _, v := range vs {
+				httpRequest.Header.Add(k, v)
+			}
+		}
+		if len(request.MultiValueHeaders) == 0 {
+			for k, v := range request.Headers {
+				httpRequest.Header.Add(k, v)
+			}
+		}
+
+		res := serve(handler, httpRequest)
+		return events.APIGatewayProxyResponse{
+			StatusCode:        res.code,
+			Body:              res.body.String(),
+			MultiValueHeaders: res.Header(),
+		}, nil
+	}
+}
+
+// WrapAuto detects the event format: REST API events have `httpMethod` field, others have `version` field
+// of the payload format.
+func WrapAuto(handler http.Handler) func(context.Context, json.RawMessage) (interface{}, error) {
+	httpAPI := WrapHTTPAPI(handler)
+	restAPI := WrapRESTAPI(handler)
+	return func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var probe struct {
+			Version    string `json:"version"`
+			HTTPMethod string `json:"httpMethod"`
+		}
+		if err := json.Unmarshal(payload, &probe); err != nil {
+			return nil, errors.Wrap(err, "failed to detect event format")
+		}
+		switch {
+		case probe.HTTPMethod != "":
+			var request events.APIGatewayProxyRequest
+			if err := json.Unmarshal(payload, &request); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal API Gateway REST API event")
+			}
+			return restAPI(ctx, request)
+		case probe.Version == "2.0":
+			var request events.APIGatewayV2HTTPRequest
+			if err := json.Unmarshal(payload, &request); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal API Gateway HTTP API event")
+			}
+			return httpAPI(ctx, request)
+		default:
+			return nil, errors.Newf("unknown event format: version=%s", probe.Version)
+		}
+	}
+}
+
+func newRequest(ctx context.Context, method string, domainName string, path string, rawQuery string, body string, isBase64Encoded bool) (*http.Request, error) {
+	var reader io.Reader = strings.NewReader(body)
+	if isBase64Encoded {
+		reader = base64.NewDecoder(base64.StdEncoding, reader)
+	}
+	u := "https://" + domainName + path
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert Lambda request to http.Request")
+	}
+	return req, nil
+}
+
+type bufferedResponseWriter struct {
+	header http.Header
+	code   int
+	body   strings.Builder
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	w.code = statusCode
+}
+
+func serve(handler http.Handler, req *http.Request) *bufferedResponseWriter {
+	w := &bufferedResponseWriter{header: http.Header{}, code: http.StatusOK}
+	handler.ServeHTTP(w, req)
+	return w
+}
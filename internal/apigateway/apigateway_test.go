@@ -0,0 +1,99 @@
+package apigateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoHandler responds the request line and body, so tests can check the conversion.
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Add("Set-Cookie", "a=1")
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte(r.Method + " " + r.Host + r.URL.RequestURI() + " " + r.Header.Get("X-Test") + " " + string(body)))
+})
+
+func TestWrapHTTPAPI(t *testing.T) {
+	req := events.APIGatewayV2HTTPRequest{
+		Version:         "2.0",
+		RawPath:         "/prod/p/test/deadbeef",
+		RawQueryString:  "response=json",
+		Headers:         map[string]string{"x-test": "header"},
+		Body:            base64.StdEncoding.EncodeToString([]byte("body")),
+		IsBase64Encoded: true,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			DomainName: "example.com",
+			Stage:      "prod",
+			HTTP:       events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: http.MethodPost},
+		},
+	}
+	res, err := WrapHTTPAPI(echoHandler)(context.Background(), req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	assert.Equal(t, "POST example.com/p/test/deadbeef?response=json header body", res.Body)
+	assert.Equal(t, "text/plain", res.Headers["Content-Type"])
+	assert.Equal(t, []string{"a=1"}, res.Cookies)
+}
+
+func TestWrapRESTAPI(t *testing.T) {
+	req := events.APIGatewayProxyRequest{
+		HTTPMethod:                      http.MethodPost,
+		Path:                            "/p/test/deadbeef",
+		MultiValueQueryStringParameters: map[string][]string{"response": {"json"}},
+		MultiValueHeaders:               map[string][]string{"X-Test": {"header"}},
+		Body:                            "body",
+		RequestContext:                  events.APIGatewayProxyRequestContext{DomainName: "example.com"},
+	}
+	res, err := WrapRESTAPI(echoHandler)(context.Background(), req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	assert.Equal(t, "POST example.com/p/test/deadbeef?response=json header body", res.Body)
+	assert.Equal(t, []string{"a=1"}, res.MultiValueHeaders["Set-Cookie"])
+}
+
+func TestWrapAuto(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   string
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "function url",
+			event: `{"version":"2.0","rawPath":"/hc","requestContext":{"domainName":"example.com","stage":"$default","http":{"method":"GET"}}}`,
+			want:  events.APIGatewayV2HTTPResponse{},
+		},
+		{
+			name:  "rest api",
+			event: `{"httpMethod":"GET","path":"/hc","requestContext":{"domainName":"example.com"}}`,
+			want:  events.APIGatewayProxyResponse{},
+		},
+		{
+			name:    "unknown",
+			event:   `{"source":"aws.events"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := WrapAuto(echoHandler)(context.Background(), json.RawMessage(tt.event))
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.IsType(t, tt.want, res)
+		})
+	}
+}
@@ -11,15 +11,89 @@ import (
 // Default HTTP client timeout covers from dialing (initiating TCP connection) to reading response body.
 // https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts
 type Config struct {
-	CustomDomainName           string        `env:"CUSTOM_DOMAIN_NAME"`
-	DdbTableName               string        `env:"DDB_TABLE_NAME,required"`
-	GoLog                      slog.Level    `env:"GO_LOG" envDefault:"info"`
-	Mode                       string        `env:"MODE,required"`
-	OpsNotificationChannelName string        `env:"OPS_NOTIFICATION_CHANNEL_NAME,required"`
-	SlackSigningSecret         string        `env:"SLACK_SIGNING_SECRET,required"`
-	SlackToken                 string        `env:"SLACK_TOKEN,required"`
-	RetryMax                   int           `env:"RETRY_MAX" envDefault:"3"`
-	RetryReadTimeoutDuration   time.Duration `env:"RETRY_READ_TIMEOUT_DURATION" envDefault:"5s"`
-	RetryWaitMaxDuration       time.Duration `env:"RETRY_WAIT_MAX_DURATION" envDefault:"10s"`
-	RetryWaitMinDuration       time.Duration `env:"RETRY_WAIT_MIN_DURATION" envDefault:"1s"`
+	AccessLogExcludeAttributes   []string      `env:"ACCESS_LOG_EXCLUDE_ATTRIBUTES"`
+	AccessLogLevels              []string      `env:"ACCESS_LOG_LEVELS"`
+	AccessLogSampleRate          int           `env:"ACCESS_LOG_SAMPLE_RATE" envDefault:"1"`
+	ArchivedRecordTTL            time.Duration `env:"ARCHIVED_RECORD_TTL" envDefault:"720h"`
+	AuditTableName               string        `env:"AUDIT_TABLE_NAME"`
+	BatchChunkSize               int           `env:"BATCH_CHUNK_SIZE" envDefault:"500"`
+	BatchConcurrency             int           `env:"BATCH_CONCURRENCY" envDefault:"4"`
+	BatchDryRun                  bool          `env:"BATCH_DRY_RUN" envDefault:"false"`
+	BatchScanSegments            int           `env:"BATCH_SCAN_SEGMENTS" envDefault:"1"`
+	BroadcastTableName           string        `env:"BROADCAST_TABLE_NAME"`
+	ChannelConfigTableName       string        `env:"CHANNEL_CONFIG_TABLE_NAME"`
+	ChannelInventoryMaxAge       time.Duration `env:"CHANNEL_INVENTORY_MAX_AGE" envDefault:"24h"`
+	ChannelInventoryTableName    string        `env:"CHANNEL_INVENTORY_TABLE_NAME"`
+	ChannelTypes                 []string      `env:"CHANNEL_TYPES" envDefault:"public,private,shared"`
+	CustomDomainName             string        `env:"CUSTOM_DOMAIN_NAME"`
+	DdbChannelIDIndexName        string        `env:"DDB_CHANNEL_ID_INDEX_NAME"`
+	DdbEndpointURL               string        `env:"DDB_ENDPOINT_URL"`
+	DdbKmsKeyArn                 string        `env:"DDB_KMS_KEY_ARN"`
+	DdbRetryMaxAttempts          int           `env:"DDB_RETRY_MAX_ATTEMPTS" envDefault:"5"`
+	DdbRetryMaxBackoff           time.Duration `env:"DDB_RETRY_MAX_BACKOFF" envDefault:"1s"`
+	DdbSecondaryTableName        string        `env:"DDB_SECONDARY_TABLE_NAME"`
+	DdbTokenIndexName            string        `env:"DDB_TOKEN_INDEX_NAME"`
+	DdbTableName                 string        `env:"DDB_TABLE_NAME,required"`
+	DeliveryFailureThreshold     int           `env:"DELIVERY_FAILURE_THRESHOLD"`
+	DigestTableName              string        `env:"DIGEST_TABLE_NAME"`
+	GoLog                        slog.Level    `env:"GO_LOG" envDefault:"info"`
+	IdempotencyTableName         string        `env:"IDEMPOTENCY_TABLE_NAME"`
+	IdempotencyTTL               time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	LambdaDeadlineReserve        time.Duration `env:"LAMBDA_DEADLINE_RESERVE" envDefault:"500ms"`
+	LambdaEventFormat            string        `env:"LAMBDA_EVENT_FORMAT" envDefault:"function_url"`
+	LifecycleEventBusName        string        `env:"LIFECYCLE_EVENT_BUS_NAME"`
+	LifecycleEvents              bool          `env:"LIFECYCLE_EVENTS" envDefault:"false"`
+	MaintenanceMode              bool          `env:"MAINTENANCE_MODE" envDefault:"false"`
+	MaxBodyBytes                 int64         `env:"MAX_BODY_BYTES" envDefault:"262144"`
+	MaxTokenCount                int           `env:"MAX_TOKEN_COUNT" envDefault:"2"`
+	MentionCacheTTL              time.Duration `env:"MENTION_CACHE_TTL" envDefault:"1h"`
+	MentionResolution            bool          `env:"MENTION_RESOLUTION" envDefault:"false"`
+	MetricsExporter              string        `env:"METRICS_EXPORTER"`
+	MetricsExportInterval        time.Duration `env:"METRICS_EXPORT_INTERVAL" envDefault:"60s"`
+	Mode                         string        `env:"MODE,required"`
+	OpsNotificationChannelName   string        `env:"OPS_NOTIFICATION_CHANNEL_NAME,required"`
+	OpsRouting                   string        `env:"OPS_ROUTING"`
+	OpsThreadTimeZone            string        `env:"OPS_THREAD_TIME_ZONE" envDefault:"UTC"`
+	PanicNotification            bool          `env:"PANIC_NOTIFICATION" envDefault:"false"`
+	PermissionAdminUserIDs       []string      `env:"PERMISSION_ADMIN_USER_IDS"`
+	PermissionRoles              []string      `env:"PERMISSION_ROLES"`
+	PermissionUserGroupID        string        `env:"PERMISSION_USERGROUP_ID"`
+	PresignMaxTTL                time.Duration `env:"PRESIGN_MAX_TTL" envDefault:"168h"`
+	ReceiptDestination           string        `env:"RECEIPT_DESTINATION"`
+	RegionRole                   string        `env:"REGION_ROLE"`
+	RuntimeConfigParameterName   string        `env:"RUNTIME_CONFIG_PARAMETER_NAME"`
+	RuntimeConfigTTL             time.Duration `env:"RUNTIME_CONFIG_TTL" envDefault:"1m"`
+	SandboxChannelName           string        `env:"SANDBOX_CHANNEL_NAME"`
+	ServerAddr                   string        `env:"SERVER_ADDR" envDefault:":3000"`
+	ServerIdleTimeout            time.Duration `env:"SERVER_IDLE_TIMEOUT" envDefault:"120s"`
+	ServerMaxHeaderBytes         int           `env:"SERVER_MAX_HEADER_BYTES" envDefault:"1048576"`
+	ServerReadTimeout            time.Duration `env:"SERVER_READ_TIMEOUT" envDefault:"10s"`
+	ServerShutdownTimeout        time.Duration `env:"SERVER_SHUTDOWN_TIMEOUT" envDefault:"30s"`
+	ServerTLSCertFile            string        `env:"SERVER_TLS_CERT_FILE"`
+	ServerTLSKeyFile             string        `env:"SERVER_TLS_KEY_FILE"`
+	ServerWriteTimeout           time.Duration `env:"SERVER_WRITE_TIMEOUT" envDefault:"60s"`
+	SlackAPIBaseURL              string        `env:"SLACK_API_BASE_URL" envDefault:"https://slack.com/api/"`
+	SlackCABundle                string        `env:"SLACK_CA_BUNDLE"`
+	SlackCircuitBreakerCooldown  time.Duration `env:"SLACK_CIRCUIT_BREAKER_COOLDOWN" envDefault:"30s"`
+	SlackCircuitBreakerThreshold int           `env:"SLACK_CIRCUIT_BREAKER_THRESHOLD" envDefault:"5"`
+	SlackPrewarm                 bool          `env:"SLACK_PREWARM" envDefault:"true"`
+	SlackRequestIDMetadata       bool          `env:"SLACK_REQUEST_ID_METADATA" envDefault:"false"`
+	SlackSignatureTolerance      time.Duration `env:"SLACK_SIGNATURE_TOLERANCE" envDefault:"5m"`
+	SlackSigningSecret           string        `env:"SLACK_SIGNING_SECRET,required"`
+	SlackSigningSecretPrevious   string        `env:"SLACK_SIGNING_SECRET_PREVIOUS"`
+	SlackStub                    bool          `env:"SLACK_STUB" envDefault:"false"`
+	SlackToken                   string        `env:"SLACK_TOKEN,required"`
+	SlashCommandDefer            bool          `env:"SLASH_COMMAND_DEFER" envDefault:"false"`
+	StaleTokenRetentionDays      int           `env:"STALE_TOKEN_RETENTION_DAYS"`
+	StorageBackend               string        `env:"STORAGE_BACKEND" envDefault:"dynamodb"`
+	StorageSecondaryBackend      string        `env:"STORAGE_SECONDARY_BACKEND"`
+	TokenResponseEphemeral       bool          `env:"TOKEN_RESPONSE_EPHEMERAL" envDefault:"true"`
+	TokenRotationDays            int           `env:"TOKEN_ROTATION_DAYS"`
+	TokenRotationGracePeriod     time.Duration `env:"TOKEN_ROTATION_GRACE_PERIOD" envDefault:"336h"`
+	RetryMax                     int           `env:"RETRY_MAX" envDefault:"3"`
+	RetryReadTimeoutDuration     time.Duration `env:"RETRY_READ_TIMEOUT_DURATION" envDefault:"5s"`
+	RetryWaitMaxDuration         time.Duration `env:"RETRY_WAIT_MAX_DURATION" envDefault:"10s"`
+	RetryWaitMinDuration         time.Duration `env:"RETRY_WAIT_MIN_DURATION" envDefault:"1s"`
+	RevokeConfirmation           bool          `env:"REVOKE_CONFIRMATION" envDefault:"true"`
+	RevokeGracePeriod            time.Duration `env:"REVOKE_GRACE_PERIOD" envDefault:"168h"`
 }
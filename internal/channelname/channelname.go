@@ -0,0 +1,35 @@
+// Package channelname normalizes Slack channel names, so names given by URLs, Slack and stored records compare
+// equal regardless of case, width and encoding.
+package channelname
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize returns the channel name Slack would show for the name:
+//   - percent-encoded names are decoded, e.g. names in URLs encoded twice by clients
+//   - NFKC folds fullwidth ASCII and halfwidth katakana, e.g. `ｄｅｖ` becomes `dev`
+//   - the leading `#` and surrounding spaces are removed
+//   - letters are lowercased and inner spaces become hyphens, as Slack does for new channels
+//
+// Japanese and other non-Latin names are kept as is apart from the width folding.
+func Normalize(name string) string {
+	if strings.Contains(name, "%") {
+		if decoded, err := url.PathUnescape(name); err == nil {
+			name = decoded
+		}
+	}
+	name = norm.NFKC.String(name)
+	name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.Join(strings.FieldsFunc(name, unicode.IsSpace), "-")
+}
+
+// Equal reports whether the names refer to the same channel name.
+func Equal(a string, b string) bool {
+	return Normalize(a) == Normalize(b)
+}
@@ -0,0 +1,38 @@
+package channelname
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		given    string
+		expected string
+	}{
+		{"canonical", "dev-alerts", "dev-alerts"},
+		{"uppercase", "Dev-Alerts", "dev-alerts"},
+		{"spaces", "  dev alerts ", "dev-alerts"},
+		{"hash prefix", "#dev-alerts", "dev-alerts"},
+		{"fullwidth ASCII", "ｄｅｖ－ａｌｅｒｔｓ", "dev-alerts"},
+		{"ideographic space", "開発　通知", "開発-通知"},
+		{"Japanese", "開発-通知", "開発-通知"},
+		{"halfwidth katakana", "ｱﾗｰﾄ", "アラート"},
+		{"percent-encoded", "%E9%96%8B%E7%99%BA-%E9%80%9A%E7%9F%A5", "開発-通知"},
+		{"invalid percent-encoding", "dev%zz", "dev%zz"},
+		{"emoji", "🔥-incident", "🔥-incident"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Normalize(tt.given))
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	assert.True(t, Equal("開発-通知", "%E9%96%8B%E7%99%BA-%E9%80%9A%E7%9F%A5"))
+	assert.True(t, Equal("General", "general"))
+	assert.False(t, Equal("general", "random"))
+}
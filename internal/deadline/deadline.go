@@ -0,0 +1,60 @@
+// Package deadline derives timeouts of request steps from the remaining execution time of Lambda invocations,
+// so requests are aborted gracefully before Lambda kills the invocation, e.g. in the middle of Slack API calls.
+//
+// Contexts without deadlines, e.g. requests of server mode, are not limited.
+package deadline
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// Step is a step of request processing. Steps get a share of the remaining time, so earlier steps leave time
+// for later steps.
+type Step struct {
+	name  string
+	share float64
+}
+
+var (
+	// DynamoDB operations before posting, e.g. token verification. Leaves most of the time to Slack API.
+	StepStorage = Step{name: "storage", share: 0.3}
+	// Slack API calls get the rest of the time.
+	StepSlack = Step{name: "slack", share: 1}
+)
+
+// WithBudget shortens the deadline of the context by reserve, the time to respond after aborting. The context
+// is returned as is when it has no deadline.
+func WithBudget(ctx context.Context, reserve time.Duration) (context.Context, context.CancelFunc) {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, d.Add(-reserve))
+}
+
+// Begin starts the step having the share of the remaining time. Call the returned function when the step ends:
+// it records the metric when the step runs out of the time.
+func Begin(ctx context.Context, step Step) (context.Context, func()) {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return ctx, func() {}
+	}
+	timeout := time.Duration(float64(time.Until(d)) * step.share)
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	return stepCtx, func() {
+		if Exceeded(stepCtx) {
+			telemetry.RecordDeadlineExceeded(ctx, step.name)
+		}
+		cancel()
+	}
+}
+
+// Exceeded tells whether the context has run out of the time.
+func Exceeded(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
@@ -0,0 +1,50 @@
+package deadline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBegin(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stepCtx, done := Begin(ctx, StepStorage)
+	defer done()
+	d, ok := stepCtx.Deadline()
+	require.True(t, ok)
+	// 30% of the remaining time.
+	assert.WithinDuration(t, time.Now().Add(3*time.Second), d, 100*time.Millisecond)
+}
+
+func TestWithBudget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	original, _ := ctx.Deadline()
+
+	budgetCtx, cancelBudget := WithBudget(ctx, time.Second)
+	defer cancelBudget()
+	d, ok := budgetCtx.Deadline()
+	require.True(t, ok)
+	assert.Equal(t, original.Add(-time.Second), d)
+
+	noDeadline, cancelNoDeadline := WithBudget(context.Background(), time.Second)
+	defer cancelNoDeadline()
+	_, ok = noDeadline.Deadline()
+	assert.False(t, ok)
+}
+
+func TestExceeded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	assert.True(t, Exceeded(ctx))
+
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	assert.False(t, Exceeded(canceled))
+}
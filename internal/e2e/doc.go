@@ -0,0 +1,3 @@
+// Package e2e has end-to-end tests driving the HTTP handler and the batch job against a fake Slack API server,
+// to catch regressions the mocks of unit tests miss: request encoding, pagination, rate limits and storage.
+package e2e
@@ -0,0 +1,288 @@
+package e2e
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/caarlos0/env/v11"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/handler"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+const (
+	testSlackToken    = "xoxb-e2e"
+	testSigningSecret = "e2e-signing-secret"
+	testOpsChannel    = "ops"
+)
+
+// testEnv runs Belldog as server mode does, except for Slack API served by fakeSlack.
+type testEnv struct {
+	cfg         appconfig.Config
+	fake        *fakeSlack
+	slackClient *slack.Client
+	ddb         storage.Storage
+	auditSvc    service.AuditService
+	server      *httptest.Server
+}
+
+// setupEnv builds the config from the env vars, overridden by given ones. Records are stored in memory, or in
+// DynamoDB Local when DDB_ENDPOINT_URL is set.
+func setupEnv(t *testing.T, fake *fakeSlack, overrides map[string]string) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+	// DynamoDB Local accepts any credentials.
+	awsConfig := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "dummy", SecretAccessKey: "dummy"}, nil
+		}),
+	}
+	environment := map[string]string{
+		"MODE":                          "server",
+		"OPS_NOTIFICATION_CHANNEL_NAME": testOpsChannel,
+		"SLACK_API_BASE_URL":            fake.apiURL(),
+		"SLACK_SIGNING_SECRET":          testSigningSecret,
+		"SLACK_TOKEN":                   testSlackToken,
+		"STORAGE_BACKEND":               storage.BackendMemory,
+		"DDB_TABLE_NAME":                "belldog",
+	}
+	if endpointURL := os.Getenv("DDB_ENDPOINT_URL"); endpointURL != "" {
+		tableName := fmt.Sprintf("belldog-e2e-%d", time.Now().UnixNano())
+		createTable(ctx, t, dynamodb.NewFromConfig(storage.DynamoDBConfig(awsConfig, appconfig.Config{DdbEndpointURL: endpointURL})), tableName)
+		environment["STORAGE_BACKEND"] = storage.BackendDynamoDB
+		environment["DDB_ENDPOINT_URL"] = endpointURL
+		environment["DDB_TABLE_NAME"] = tableName
+		environment["DDB_CHANNEL_ID_INDEX_NAME"] = channelIDIndexName
+		environment["DDB_TOKEN_INDEX_NAME"] = tokenIndexName
+	}
+	for k, v := range overrides {
+		environment[k] = v
+	}
+	cfg, err := env.ParseAsWithOptions[appconfig.Config](env.Options{Environment: environment})
+	require.NoError(t, err)
+
+	slackClient, err := slack.NewClient(cfg)
+	require.NoError(t, err)
+	ddb, err := storage.NewStorage(ctx, awsConfig, cfg)
+	require.NoError(t, err)
+	tokenSvc := service.NewTokenService(ddb, cfg.RevokeGracePeriod)
+	auditSvc := service.NewAuditService(nil)
+	channelConfigSvc := service.NewChannelConfigService(nil)
+	mentionSvc := service.NewMentionService(nil, cfg.MentionCacheTTL)
+	idempotencySvc := service.NewIdempotencyService(nil, cfg.IdempotencyTTL)
+	digestSvc := service.NewDigestService(nil)
+	broadcastSvc := service.NewBroadcastService(nil)
+
+	e := handler.NewEchoHandler(cfg, &slackClient, &tokenSvc, &auditSvc, &channelConfigSvc, mentionSvc, &idempotencySvc, &digestSvc, &broadcastSvc, ddb, nil, nil, nil, nil, nil)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return &testEnv{cfg: cfg, fake: fake, slackClient: &slackClient, ddb: ddb, auditSvc: auditSvc, server: server}
+}
+
+const (
+	channelIDIndexName = "channel_id-index"
+	tokenIndexName     = "token-index"
+)
+
+// createTable creates the table as the storage integration tests do, and deletes it after the test.
+func createTable(ctx context.Context, t *testing.T, client *dynamodb.Client, tableName string) {
+	t.Helper()
+	gsi := func(name string, key string) types.GlobalSecondaryIndex {
+		return types.GlobalSecondaryIndex{
+			IndexName:  aws.String(name),
+			KeySchema:  []types.KeySchemaElement{{AttributeName: aws.String(key), KeyType: types.KeyTypeHash}},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}
+	}
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("channel_name"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("version"), AttributeType: types.ScalarAttributeTypeN},
+			{AttributeName: aws.String("channel_id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("token"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("channel_name"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("version"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			gsi(channelIDIndexName, "channel_id"),
+			gsi(tokenIndexName, "token"),
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(tableName)})
+		assert.NoError(t, err)
+	})
+
+	waiter := dynamodb.NewTableExistsWaiter(client)
+	require.NoError(t, waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)}, time.Minute))
+}
+
+// slash sends the slash command signed as Slack does. Returns the decoded response, nil for empty responses.
+func (e *testEnv) slash(t *testing.T, command string, channel fakeChannel, text string) map[string]interface{} {
+	t.Helper()
+	body := url.Values{
+		"command":      {command},
+		"channel_id":   {channel.ID},
+		"channel_name": {channel.Name},
+		"text":         {text},
+		"user_id":      {"U123456"},
+		"user_name":    {"e2e"},
+		"response_url": {e.fake.responseURL()},
+	}.Encode()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	req, err := http.NewRequest(http.MethodPost, e.server.URL+"/slash", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(b))
+	if len(b) == 0 {
+		return nil
+	}
+	var res map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &res), string(b))
+	return res
+}
+
+var webhookPathPattern = regexp.MustCompile(`https://[^/\s]+(/p/[^\s,]+)`)
+
+// generateWebhook generates a token with the slash command and returns the path of the webhook URL.
+func (e *testEnv) generateWebhook(t *testing.T, channel fakeChannel) string {
+	t.Helper()
+	res := e.slash(t, "/belldog-generate", channel, "")
+	text, _ := res["text"].(string)
+	require.Contains(t, text, "Token generated")
+	m := webhookPathPattern.FindStringSubmatch(text)
+	require.NotNil(t, m, text)
+	return m[1]
+}
+
+func (e *testEnv) postWebhook(t *testing.T, path string, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(e.server.URL+path, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestSlashCommandGenerateAndWebhook(t *testing.T) {
+	dev := fakeChannel{ID: "C100001", Name: "dev"}
+	e := setupEnv(t, newFakeSlack(t, dev), nil)
+
+	path := e.generateWebhook(t, dev)
+	assert.Equal(t, 1, e.fake.callCount("conversations.info"))
+
+	resp := e.postWebhook(t, path, `{"text": "hello"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	messages := e.fake.postedMessages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, dev.ID, messages[0]["channel"])
+	assert.Equal(t, "hello", messages[0]["text"])
+
+	resp = e.postWebhook(t, strings.Replace(path, "/p/dev/", "/p/dev/x", 1), `{"text": "hello"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Len(t, e.fake.postedMessages(), 1)
+}
+
+func TestWebhookRetriesRateLimitedPostMessage(t *testing.T) {
+	dev := fakeChannel{ID: "C100001", Name: "dev"}
+	e := setupEnv(t, newFakeSlack(t, dev), nil)
+	path := e.generateWebhook(t, dev)
+
+	e.fake.rateLimit("chat.postMessage", 1, "0")
+	resp := e.postWebhook(t, path, `{"text": "hello"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, e.fake.callCount("chat.postMessage"))
+	assert.Len(t, e.fake.postedMessages(), 1)
+}
+
+func TestWebhookRateLimitedLongerThanRetryWait(t *testing.T) {
+	dev := fakeChannel{ID: "C100001", Name: "dev"}
+	e := setupEnv(t, newFakeSlack(t, dev), nil)
+	path := e.generateWebhook(t, dev)
+
+	e.fake.rateLimit("chat.postMessage", 1, "60")
+	resp := e.postWebhook(t, path, `{"text": "hello"}`)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+	assert.Empty(t, e.fake.postedMessages())
+}
+
+func TestSlashCommandDeferred(t *testing.T) {
+	dev := fakeChannel{ID: "C100001", Name: "dev"}
+	e := setupEnv(t, newFakeSlack(t, dev), map[string]string{"SLASH_COMMAND_DEFER": "true"})
+
+	assert.Nil(t, e.slash(t, "/belldog-generate", dev, ""))
+	require.Eventually(t, func() bool { return len(e.fake.postedResponses()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	text, _ := e.fake.postedResponses()[0]["text"].(string)
+	assert.Contains(t, text, "Token generated")
+}
+
+func TestBatchArchivesChannelsAcrossPages(t *testing.T) {
+	ctx := context.Background()
+	dev := fakeChannel{ID: "C100001", Name: "dev"}
+	old := fakeChannel{ID: "C100002", Name: "old"}
+	fake := newFakeSlack(t, dev, old)
+	e := setupEnv(t, fake, nil)
+	e.generateWebhook(t, dev)
+	e.generateWebhook(t, old)
+
+	// The archived channel is on the second page, after a rate limited request.
+	fake.channels[1].Archived = true
+	fake.rateLimit("conversations.list", 1, "0")
+	h := handler.NewBatchHandler(e.cfg, e.slackClient, e.ddb, nil, &e.auditSvc, nil, nil, nil, nil)
+	require.NoError(t, h.HandleCloudWatchEvent(ctx, events.CloudWatchEvent{}))
+	assert.Equal(t, 3, fake.callCount("conversations.list"))
+
+	recs, err := e.ddb.QueryByChannelName(ctx, old.Name)
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+	recs, err = e.ddb.QueryByChannelName(ctx, dev.Name)
+	require.NoError(t, err)
+	assert.Len(t, recs, 1)
+
+	var summary string
+	for _, m := range fake.postedMessages() {
+		if m["channel"] == testOpsChannel && strings.HasPrefix(fmt.Sprint(m["text"]), "Batch process") {
+			summary = fmt.Sprint(m["text"])
+		}
+	}
+	assert.Contains(t, summary, "archived=1")
+}
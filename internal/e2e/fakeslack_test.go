@@ -0,0 +1,176 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeChannel struct {
+	ID       string
+	Name     string
+	Archived bool
+}
+
+// fakeSlack serves the Web API methods Belldog calls, under /api/, and response_url under /response.
+type fakeSlack struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	channels []fakeChannel
+	// Payloads of chat.postMessage.
+	messages []map[string]interface{}
+	// Payloads posted to response_url.
+	responses []map[string]interface{}
+	// Number of 429 responses left for each method, and their Retry-After in seconds.
+	rateLimits map[string]int
+	retryAfter string
+	calls      map[string]int
+}
+
+// Channels of conversations.list pages.
+const fakePageSize = 1
+
+func newFakeSlack(t *testing.T, channels ...fakeChannel) *fakeSlack {
+	t.Helper()
+	f := &fakeSlack{
+		channels:   channels,
+		rateLimits: map[string]int{},
+		retryAfter: "0",
+		calls:      map[string]int{},
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeSlack) apiURL() string {
+	return f.server.URL + "/api/"
+}
+
+func (f *fakeSlack) responseURL() string {
+	return f.server.URL + "/response"
+}
+
+// rateLimit makes the next n calls of the method respond 429.
+func (f *fakeSlack) rateLimit(method string, n int, retryAfter string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rateLimits[method] = n
+	f.retryAfter = retryAfter
+}
+
+func (f *fakeSlack) callCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+func (f *fakeSlack) postedMessages() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}{}, f.messages...)
+}
+
+func (f *fakeSlack) postedResponses() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}{}, f.responses...)
+}
+
+func (f *fakeSlack) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/response" {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.responses = append(f.responses, payload)
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	f.calls[method]++
+	if f.rateLimits[method] > 0 {
+		f.rateLimits[method]--
+		w.Header().Set("Retry-After", f.retryAfter)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+testSlackToken && r.FormValue("token") != testSlackToken {
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "invalid_auth"})
+		return
+	}
+
+	switch method {
+	case "api.test", "auth.test":
+		writeJSON(w, map[string]interface{}{"ok": true})
+	case "chat.postMessage":
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.messages = append(f.messages, payload)
+		writeJSON(w, map[string]interface{}{"ok": true, "channel": payload["channel"], "ts": "1700000000.000100"})
+	case "conversations.info":
+		for _, ch := range f.channels {
+			if ch.ID == r.FormValue("channel") {
+				writeJSON(w, map[string]interface{}{"ok": true, "channel": channelJSON(ch)})
+				return
+			}
+		}
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "channel_not_found"})
+	case "conversations.list":
+		f.listConversations(w, r)
+	default:
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "unknown_method"})
+	}
+}
+
+// listConversations paginates with the index of the next channel as the cursor.
+func (f *fakeSlack) listConversations(w http.ResponseWriter, r *http.Request) {
+	start := 0
+	if cursor := r.FormValue("cursor"); cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil {
+			writeJSON(w, map[string]interface{}{"ok": false, "error": "invalid_cursor"})
+			return
+		}
+	}
+	end := min(start+fakePageSize, len(f.channels))
+	page := make([]map[string]interface{}, 0, end-start)
+	for _, ch := range f.channels[start:end] {
+		page = append(page, channelJSON(ch))
+	}
+	next := ""
+	if end < len(f.channels) {
+		next = strconv.Itoa(end)
+	}
+	writeJSON(w, map[string]interface{}{
+		"ok":                true,
+		"channels":          page,
+		"response_metadata": map[string]string{"next_cursor": next},
+	})
+}
+
+func channelJSON(ch fakeChannel) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          ch.ID,
+		"name":        ch.Name,
+		"is_channel":  true,
+		"is_archived": ch.Archived,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,105 @@
+// Package eventbridge puts events to EventBridge event buses, e.g. delivery receipts and token lifecycle events.
+package eventbridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/cockroachdb/errors"
+)
+
+// Entry is an event to put. Detail is a JSON object.
+type Entry struct {
+	Source     string
+	DetailType string
+	Detail     string
+	// Name or ARN of the event bus, empty for the default event bus.
+	EventBusName string `json:",omitempty"`
+}
+
+// Client calls PutEvents API of EventBridge. Like secretenv.Client, the API is called directly with SigV4 signed
+// requests because only a single API is needed.
+type Client struct {
+	cfg    aws.Config
+	signer *v4.Signer
+}
+
+func NewClient(cfg aws.Config) *Client {
+	return &Client{cfg: cfg, signer: v4.NewSigner()}
+}
+
+// PutEvents puts the entries. PutEvents API succeeds with failed entries, they are returned as an error.
+// https://docs.aws.amazon.com/eventbridge/latest/APIReference/API_PutEvents.html
+func (c *Client) PutEvents(ctx context.Context, entries []Entry) error {
+	payload, err := json.Marshal(map[string]interface{}{"Entries": entries})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(), bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSEvents.PutEvents")
+
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve AWS credentials")
+	}
+	sum := sha256.Sum256(payload)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "events", c.cfg.Region, time.Now()); err != nil {
+		return errors.Wrap(err, "failed to sign request")
+	}
+
+	var httpClient aws.HTTPClient = http.DefaultClient
+	if c.cfg.HTTPClient != nil {
+		httpClient = c.cfg.HTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to call PutEvents")
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Newf("PutEvents failed: status=%d, body=%s", resp.StatusCode, respBody)
+	}
+	var output struct {
+		FailedEntryCount int
+		Entries          []struct {
+			ErrorCode    string
+			ErrorMessage string
+		}
+	}
+	if err := json.Unmarshal(respBody, &output); err != nil {
+		return errors.Wrap(err, "failed to unmarshal PutEvents response")
+	}
+	if output.FailedEntryCount > 0 {
+		for i, e := range output.Entries {
+			if e.ErrorCode != "" && i < len(entries) {
+				return errors.Newf("PutEvents failed: failed_entries=%d, detail_type=%s, code=%s, message=%s", output.FailedEntryCount, entries[i].DetailType, e.ErrorCode, e.ErrorMessage)
+			}
+		}
+		return errors.Newf("PutEvents failed: failed_entries=%d", output.FailedEntryCount)
+	}
+	return nil
+}
+
+func (c *Client) endpoint() string {
+	if c.cfg.BaseEndpoint != nil {
+		return *c.cfg.BaseEndpoint
+	}
+	return fmt.Sprintf("https://events.%s.amazonaws.com", c.cfg.Region)
+}
@@ -0,0 +1,70 @@
+package eventbridge
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(url string) aws.Config {
+	return aws.Config{
+		Region:       "ap-northeast-1",
+		BaseEndpoint: aws.String(url),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+}
+
+func TestPutEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AWSEvents.PutEvents", r.Header.Get("X-Amz-Target"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/events/aws4_request")
+		body, _ := io.ReadAll(r.Body)
+		var req struct{ Entries []map[string]string }
+		require.NoError(t, json.Unmarshal(body, &req))
+		assert.Equal(t, []map[string]string{
+			{"Source": "belldog", "DetailType": "TokenGenerated", "Detail": `{"channel_id":"C01"}`, "EventBusName": "security"},
+			{"Source": "belldog", "DetailType": "TokenRevoked", "Detail": `{"channel_id":"C01"}`},
+		}, req.Entries)
+		_, _ = w.Write([]byte(`{"FailedEntryCount":0,"Entries":[{"EventId":"1"},{"EventId":"2"}]}`))
+	}))
+	defer srv.Close()
+
+	err := NewClient(testConfig(srv.URL)).PutEvents(context.Background(), []Entry{
+		{Source: "belldog", DetailType: "TokenGenerated", Detail: `{"channel_id":"C01"}`, EventBusName: "security"},
+		{Source: "belldog", DetailType: "TokenRevoked", Detail: `{"channel_id":"C01"}`},
+	})
+	require.NoError(t, err)
+}
+
+func TestPutEventsFailedEntries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"FailedEntryCount":1,"Entries":[{"ErrorCode":"InternalFailure","ErrorMessage":"failed"}]}`))
+	}))
+	defer srv.Close()
+
+	err := NewClient(testConfig(srv.URL)).PutEvents(context.Background(), []Entry{{Source: "belldog", DetailType: "TokenGenerated", Detail: "{}"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "code=InternalFailure")
+	assert.Contains(t, err.Error(), "detail_type=TokenGenerated")
+}
+
+func TestPutEventsErrorResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Event bus security does not exist."}`))
+	}))
+	defer srv.Close()
+
+	err := NewClient(testConfig(srv.URL)).PutEvents(context.Background(), []Entry{{Source: "belldog", DetailType: "TokenGenerated", Detail: "{}"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ResourceNotFoundException")
+}
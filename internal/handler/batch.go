@@ -4,31 +4,58 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/cockroachdb/errors"
+	slackgo "github.com/slack-go/slack"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/Finatext/belldog/internal/appconfig"
-	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/channelname"
+	"github.com/Finatext/belldog/internal/secret"
 	"github.com/Finatext/belldog/internal/storage"
+	"github.com/Finatext/belldog/internal/telemetry"
 )
 
 type BatchHandler struct {
 	cfg         appconfig.Config
 	slackClient slackClient
 	ddb         storageDDB
+	settings    runtimeSettings
+	maintainer  recordMaintainer
+	// Only for checkpointed runs with HandleStep.
+	checkpoints batchCheckpointStore
+	// Optional, all channels are listed every run without it.
+	inventorySvc inventoryService
 }
 
-func NewBatchHandler(cfg appconfig.Config, slackClient slackClient, ddb storageDDB) BatchHandler {
+func NewBatchHandler(cfg appconfig.Config, slackClient slackClient, ddb storageDDB, settings runtimeSettings, auditSvc auditService, threadStore opsThreadStore, lifecycleSvc lifecycleService, checkpoints batchCheckpointStore, inventorySvc inventoryService) BatchHandler {
 	return BatchHandler{
-		cfg:         cfg,
-		slackClient: slackClient,
-		ddb:         ddb,
+		cfg:          cfg,
+		slackClient:  slackClient,
+		ddb:          ddb,
+		settings:     settings,
+		maintainer:   newRecordMaintainer(cfg, slackClient, ddb, settings, auditSvc, threadStore, lifecycleSvc),
+		checkpoints:  checkpoints,
+		inventorySvc: inventorySvc,
 	}
 }
 
 // Bypass domain layer because we don't have enough logic and tests yet for batch app code.
-func (h *BatchHandler) HandleCloudWatchEvent(ctx context.Context, _ events.CloudWatchEvent) error {
+func (h *BatchHandler) HandleCloudWatchEvent(ctx context.Context, _ events.CloudWatchEvent) (err error) {
+	var notify func(context.Context, string) error
+	if h.cfg.PanicNotification {
+		notify = h.maintainer.notifyPanic
+	}
+	defer recoverEventPanic(ctx, "batch", notify, &err)
+	// Records are replicated from the active region, which processes them. Processing in both regions would notify
+	// channels twice.
+	if currentSettings(ctx, h.cfg, h.settings).Passive() {
+		slog.InfoContext(ctx, "skip batch process in passive region")
+		return nil
+	}
 	if err := h.handleWithErrorLogging(ctx); err != nil {
 		slog.ErrorContext(ctx, "failed to handle", slog.String("error", fmt.Sprintf("%+v", err)))
 		return err
@@ -36,156 +63,370 @@ func (h *BatchHandler) HandleCloudWatchEvent(ctx context.Context, _ events.Cloud
 	return nil
 }
 
-func (h *BatchHandler) handleWithErrorLogging(ctx context.Context) error {
-	olds, err := h.ddb.ScanAll(ctx)
-	if err != nil {
-		return err
+// batchSummary is posted to the ops channel and recorded as metrics after each run. Checkpointed runs save it
+// between steps.
+type batchSummary struct {
+	Records  int `json:"records"`
+	Archived int `json:"archived"`
+	Restored int `json:"restored"`
+	// Expired tombstones of archived channels and revoked tokens.
+	Purged     int `json:"purged"`
+	Migrations int `json:"migrations"`
+	Renames    int `json:"renames"`
+	// Channels notified that unused tokens will be revoked.
+	StaleNotices int `json:"stale_notices"`
+	StaleRevokes int `json:"stale_revokes"`
+	// Tokens replaced by the token rotation, and rotated tokens revoked after the grace period.
+	Rotations       int `json:"rotations"`
+	RotationRevokes int `json:"rotation_revokes"`
+	Errors          int `json:"errors"`
+}
+
+func (s batchSummary) message() string {
+	status := "completed"
+	if s.Errors > 0 {
+		status = "completed with errors"
 	}
-	slog.InfoContext(ctx, "target record size", slog.Int("size", len(olds)))
+	return fmt.Sprintf("Batch process %s: records=%d, archived=%d, restored=%d, purged=%d, migrations=%d, renames=%d, stale_notices=%d, stale_revokes=%d, rotations=%d, rotation_revokes=%d, errors=%d\n",
+		status, s.Records, s.Archived, s.Restored, s.Purged, s.Migrations, s.Renames, s.StaleNotices, s.StaleRevokes, s.Rotations, s.RotationRevokes, s.Errors)
+}
 
-	channels, err := h.slackClient.GetAllChannels(ctx)
-	if err != nil {
-		return err
+func (s batchSummary) add(o batchSummary) batchSummary {
+	return batchSummary{
+		Records:         s.Records + o.Records,
+		Archived:        s.Archived + o.Archived,
+		Restored:        s.Restored + o.Restored,
+		Purged:          s.Purged + o.Purged,
+		Migrations:      s.Migrations + o.Migrations,
+		Renames:         s.Renames + o.Renames,
+		StaleNotices:    s.StaleNotices + o.StaleNotices,
+		StaleRevokes:    s.StaleRevokes + o.StaleRevokes,
+		Rotations:       s.Rotations + o.Rotations,
+		RotationRevokes: s.RotationRevokes + o.RotationRevokes,
+		Errors:          s.Errors + o.Errors,
 	}
-	slog.InfoContext(ctx, "target channel size", slog.Int("size", len(channels)))
+}
 
-	// Check channel is_archived.
-	var archived []archiveEvent
-	recs := make([]storage.Record, 0, len(olds))
-	for _, rec := range olds {
-		isArchived := false
-		for _, channel := range channels {
-			if rec.ChannelID == channel.ID {
-				slog.DebugContext(ctx, "channel", slog.String("channel_id", rec.ChannelID), slog.String("channel_name", rec.ChannelName), slog.String("slack_channel_name", channel.Name))
-
-				if channel.IsArchived {
-					isArchived = true
-					event := archiveEvent{record: rec, SlackChannelName: channel.Name}
-					archived = append(archived, event) //nolint:staticcheck // false positive of append
-				}
-				break
-			}
+// batchEvents are detected from records by eventDetector and processed after the scan.
+type batchEvents struct {
+	archived   []archiveEvent
+	restores   []restoreEvent
+	purges     []storage.Record
+	migrations map[string]storage.Record
+	renames    []renameEvent
+	stales     []staleEvent
+	rotations  []rotationEvent
+}
+
+func (e batchEvents) summary(records int) batchSummary {
+	summary := batchSummary{Records: records, Archived: len(e.archived), Restored: len(e.restores), Purged: len(e.purges), Migrations: len(e.migrations), Renames: len(e.renames)}
+	for _, evt := range e.stales {
+		if evt.revoke {
+			summary.StaleRevokes++
+		} else {
+			summary.StaleNotices++
 		}
-		if !isArchived {
-			recs = append(recs, rec)
+	}
+	for _, evt := range e.rotations {
+		if evt.revoke {
+			summary.RotationRevokes++
+		} else {
+			summary.Rotations++
 		}
 	}
+	return summary
+}
 
-	slog.InfoContext(ctx, "processing archived channels", slog.Int("size", len(archived)))
-	for _, event := range archived {
-		slog.InfoContext(ctx, "Channel is archived, deleting", slog.String("channel_id", event.record.ChannelID), slog.String("record_channel_name", event.record.ChannelName), slog.String("slack_channel_name", event.SlackChannelName))
-		msg := fmt.Sprintf("Channel is archived, deleting record: channel_id=%s, record_channel_name=%s, slack_channel_name=%s\n", event.record.ChannelID, event.record.ChannelName, event.SlackChannelName)
-		if err := h.notifyOps(ctx, msg); err != nil {
-			return err
-		}
-		if err := h.ddb.Delete(ctx, event.record); err != nil {
-			return err
-		}
+// eventDetector detects events of records. Only events and a token per channel are kept, so records can be
+// streamed to keep memory flat for large tables. Not safe for concurrent use.
+type eventDetector struct {
+	cfg          appconfig.Config
+	now          time.Time
+	retention    time.Duration
+	rotationAge  time.Duration
+	channelsByID map[string]slackgo.Channel
+	records      int
+	events       batchEvents
+	// The first token seen for each channel, to find channels having multiple tokens.
+	tokens map[channelKey]string
+	// Live records of each channel, only kept when the token rotation is enabled.
+	channelRecords map[channelKey][]storage.Record
+}
+
+func newEventDetector(cfg appconfig.Config, channels []slackgo.Channel, now time.Time) (eventDetector, error) {
+	retention := time.Duration(cfg.StaleTokenRetentionDays) * 24 * time.Hour
+	if retention > 0 && retention <= staleNoticePeriod {
+		return eventDetector{}, errors.Newf("STALE_TOKEN_RETENTION_DAYS must be longer than the notice period: %d", cfg.StaleTokenRetentionDays)
+	}
+	rotationAge := time.Duration(cfg.TokenRotationDays) * 24 * time.Hour
+	if rotationAge > 0 && cfg.TokenRotationGracePeriod <= 0 {
+		return eventDetector{}, errors.Newf("TOKEN_ROTATION_GRACE_PERIOD must be positive: %s", cfg.TokenRotationGracePeriod)
+	}
+	channelsByID := make(map[string]slackgo.Channel, len(channels))
+	for _, channel := range channels {
+		channelsByID[channel.ID] = channel
 	}
+	return eventDetector{
+		cfg:            cfg,
+		now:            now,
+		retention:      retention,
+		rotationAge:    rotationAge,
+		channelsByID:   channelsByID,
+		events:         batchEvents{migrations: make(map[string]storage.Record)},
+		tokens:         make(map[channelKey]string),
+		channelRecords: make(map[channelKey][]storage.Record),
+	}, nil
+}
 
-	migrations := make(map[string]storage.Record)
-	var renames []renameEvent
+func (d *eventDetector) detect(ctx context.Context, rec storage.Record) {
+	d.records++
 
-	for _, rec := range recs {
-		name := rec.ChannelName
-		// Check token is in migration.
-		for _, other := range recs {
-			if rec.ChannelID == other.ChannelID && name == other.ChannelName && rec.Token != other.Token {
-				migrations[name] = rec
-			}
-		}
-		// Check saved channel has been renamed.
-		for _, channel := range channels {
-			if rec.ChannelID == channel.ID && name != channel.Name {
-				renames = append(renames, renameEvent{channelID: rec.ChannelID, oldName: name, newName: channel.Name, savedToken: rec.Token})
-			}
+	// Check channel is_archived.
+	channel, ok := d.channelsByID[rec.ChannelID]
+	if ok {
+		slog.DebugContext(ctx, "channel", slog.String("channel_id", rec.ChannelID), slog.String("channel_name", rec.ChannelName), slog.String("slack_channel_name", channel.Name))
+	}
+	if rec.Tombstone() {
+		switch {
+		case rec.Expired(d.now):
+			d.events.purges = append(d.events.purges, rec)
+		// Restore the tombstone if the channel is unarchived. Revoked tokens are restored only by users.
+		case !rec.Revoked() && ok && !channel.IsArchived:
+			d.events.restores = append(d.events.restores, restoreEvent{record: rec, slackChannelName: channel.Name})
 		}
+		return
+	}
+	if ok && channel.IsArchived {
+		d.events.archived = append(d.events.archived, archiveEvent{record: rec, SlackChannelName: channel.Name})
+		return
 	}
 
-	slog.InfoContext(ctx, "processing migrations", slog.Int("size", len(migrations)))
-	for _, rec := range migrations {
-		slog.InfoContext(ctx, "Token is in migration", slog.String("channel_name", rec.ChannelName), slog.String("channel_id", rec.ChannelID))
-		msgOps := fmt.Sprintf("Token is in migration: channel_name=%s, channel_id=%s\n", rec.ChannelName, rec.ChannelID)
-		msg := fmt.Sprintf("Token is in migration. Once all old webhook URLs are replaced, revoke old token: channel_name=%s, channel_id=%s\n", rec.ChannelName, rec.ChannelID)
-		if err := h.notify(ctx, rec.ChannelID, rec.ChannelName, msg, msgOps); err != nil {
-			return err
+	name := rec.ChannelName
+	// Check token is in migration.
+	key := channelKey{channelName: name, channelID: rec.ChannelID}
+	// Rotated tokens are revoked automatically, so channels are notified of the rotation instead.
+	if rec.RotatedAt == "" {
+		if token, seen := d.tokens[key]; !seen {
+			d.tokens[key] = rec.Token
+		} else if token != rec.Token {
+			d.events.migrations[name] = rec
 		}
 	}
-
-	slog.InfoContext(ctx, "processing renames", slog.Int("size", len(renames)))
-	for _, evt := range renames {
-		slog.InfoContext(ctx, "Channel name and channel id pair updated",
-			slog.String("channel_id", evt.channelID),
-			slog.String("old_channel_name", evt.oldName),
-			slog.String("renamed_channel_name", evt.newName),
-			slog.String("saved_token", evt.savedToken),
-		)
-		msgOps := fmt.Sprintf("Channel name and channel id pair updated: channel_id=%s, old_channel_name=%s, renamed_channel_name=%s\n", evt.channelID, evt.oldName, evt.newName)
-		format := `
-Detect channel renaming for this channel: channel_id=%s, old_channel_name=%s, renamed_channel_name=%s
-
-1. Generate new token in this channel.
-2. Replace old webhook URLs with new URLs.
-3. When all old URLs are replaced, revoke old token with the "revoke renamed slash command" with channel_name=%s and token=%s
-		`
-		msg := fmt.Sprintf(format, evt.channelID, evt.oldName, evt.newName, evt.oldName, evt.savedToken)
-		if err := h.notify(ctx, evt.channelID, evt.newName, msg, msgOps); err != nil {
-			return err
+	if d.rotationAge > 0 {
+		d.channelRecords[key] = append(d.channelRecords[key], rec)
+	}
+	// Check saved channel has been renamed.
+	if ok && !channelname.Equal(name, channel.Name) {
+		d.events.renames = append(d.events.renames, renameEvent{channelID: rec.ChannelID, oldName: name, newName: channel.Name, savedToken: secret.Token(rec.Token)})
+	}
+	// Check token is unused.
+	if d.retention > 0 {
+		if evt, stale := detectStaleToken(ctx, rec, d.retention, d.now); stale {
+			d.events.stales = append(d.events.stales, evt)
 		}
 	}
-
-	slog.InfoContext(ctx, "batch process completed")
-	return nil
 }
 
-func (h *BatchHandler) notify(ctx context.Context, channelID string, channelName string, msg string, msgOps string) error {
-	payload := map[string]interface{}{"text": msg}
-	{
-		result, err := h.slackClient.PostMessage(ctx, channelID, channelName, payload)
-		if err != nil {
-			return err
-		}
-		if e := handlePostMessageFailure(result); e != nil {
-			return e
-		}
+// finish returns the events after all records of the channels are detected, as rotations need all tokens of each
+// channel.
+func (d *eventDetector) finish(ctx context.Context) batchEvents {
+	events := d.events
+	for _, recs := range d.channelRecords {
+		events.rotations = append(events.rotations, detectRotations(ctx, recs, d.rotationAge, d.cfg.TokenRotationGracePeriod, d.cfg.MaxTokenCount, d.now)...)
 	}
-	return h.notifyOps(ctx, msgOps)
+	return events
 }
 
-func (h *BatchHandler) notifyOps(ctx context.Context, msg string) error {
-	result, err := h.slackClient.PostMessage(ctx, h.cfg.OpsNotificationChannelName, h.cfg.OpsNotificationChannelName, map[string]interface{}{"text": msg})
+func (h *BatchHandler) handleWithErrorLogging(ctx context.Context) (err error) {
+	var summary batchSummary
+	defer func() { telemetry.RecordBatchRun(ctx, summary.Records, err == nil) }()
+
+	channels, err := h.listChannels(ctx)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "target channel size", slog.Int("size", len(channels)))
+	detector, err := newEventDetector(h.cfg, channels, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var recMu sync.Mutex
+	err = h.ddb.ForEachRecord(ctx, h.cfg.BatchScanSegments, func(rec storage.Record) error {
+		recMu.Lock()
+		defer recMu.Unlock()
+		detector.detect(ctx, rec)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	if e := handlePostMessageFailure(result); e != nil {
-		return e
+	slog.InfoContext(ctx, "target record size", slog.Int("size", detector.records))
+	events := detector.finish(ctx)
+	summary = events.summary(detector.records)
+
+	if h.cfg.BatchDryRun {
+		reportDryRun(ctx, events)
+		slog.InfoContext(ctx, "dry run completed, nothing is archived, restored, deleted or posted", slog.String("summary", summary.message()))
+		return nil
+	}
+
+	errs := h.processEvents(ctx, events)
+	summary.Errors = len(errs)
+	// Failing to post the summary doesn't hide the event errors.
+	if err := h.notifySummary(ctx, summary); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errors.Wrapf(errors.Join(errs...), "batch process failed for %d event(s)", len(errs))
 	}
+	slog.InfoContext(ctx, "batch process completed")
 	return nil
 }
 
-type renameEvent struct {
-	channelID  string
-	oldName    string
-	newName    string
-	savedToken string
+// processEvents returns errors of failed events.
+func (h *BatchHandler) processEvents(ctx context.Context, events batchEvents) []error {
+	slog.InfoContext(ctx, "processing events",
+		slog.Int("archived_size", len(events.archived)),
+		slog.Int("restores_size", len(events.restores)),
+		slog.Int("purges_size", len(events.purges)),
+		slog.Int("migrations_size", len(events.migrations)),
+		slog.Int("renames_size", len(events.renames)),
+		slog.Int("stales_size", len(events.stales)),
+		slog.Int("rotations_size", len(events.rotations)),
+		slog.Int("concurrency", h.cfg.BatchConcurrency),
+	)
+
+	// Each event targets a different record or channel, so process them concurrently. A failure of one event
+	// doesn't stop processing others; all errors are reported at the end.
+	var (
+		g    errgroup.Group
+		mu   sync.Mutex
+		errs []error
+	)
+	g.SetLimit(max(h.cfg.BatchConcurrency, 1))
+	run := func(eventType string, f func() error) {
+		g.Go(func() error {
+			err := f()
+			telemetry.RecordBatchEvent(ctx, eventType, err == nil)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to process event", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("event_type", eventType))
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+
+	for _, event := range events.archived {
+		run("archived", func() error { return h.maintainer.processArchived(ctx, event) })
+	}
+	for _, event := range events.restores {
+		run("restored", func() error { return h.maintainer.processRestore(ctx, event) })
+	}
+	for _, rec := range events.purges {
+		run("purged", func() error { return h.maintainer.processPurge(ctx, rec) })
+	}
+	for _, rec := range events.migrations {
+		run("migration", func() error { return h.maintainer.processMigration(ctx, rec) })
+	}
+	for _, evt := range events.renames {
+		run("rename", func() error { return h.maintainer.processRename(ctx, evt) })
+	}
+	for _, evt := range events.stales {
+		if evt.revoke {
+			run("stale_revoke", func() error { return h.maintainer.processStaleRevoke(ctx, evt) })
+		} else {
+			run("stale_notice", func() error { return h.maintainer.processStaleNotice(ctx, evt) })
+		}
+	}
+	for _, evt := range events.rotations {
+		if evt.revoke {
+			run("rotation_revoke", func() error { return h.maintainer.processRotationRevoke(ctx, evt) })
+		} else {
+			run("rotation", func() error { return h.maintainer.processRotation(ctx, evt) })
+		}
+	}
+	_ = g.Wait()
+	return errs
 }
 
-type archiveEvent struct {
-	record           storage.Record
-	SlackChannelName string
+// notifySummary posts the summary to the ops channel, as an error when events failed.
+func (h *BatchHandler) notifySummary(ctx context.Context, summary batchSummary) error {
+	summaryClass := opsClassBatchSummary
+	if summary.Errors > 0 {
+		summaryClass = opsClassError
+	}
+	if err := h.maintainer.notifyOps(ctx, summaryClass, summary.message()); err != nil {
+		slog.ErrorContext(ctx, "failed to post batch summary", slog.String("error", fmt.Sprintf("%+v", err)))
+		return errors.Wrap(err, "failed to post batch summary")
+	}
+	return nil
 }
 
-func handlePostMessageFailure(result slack.PostMessageResult) error {
-	switch result.Type {
-	case slack.PostMessageResultOK:
-		return nil
-	case slack.PostMessageResultServerTimeoutFailure:
-		return errors.New("slack server timeout")
-	case slack.PostMessageResultServerFailure:
-		return errors.Newf("slack server error: code=%d, body=%s", result.StatusCode, result.Body)
-	case slack.PostMessageResultAPIFailure:
-		return errors.Newf("slack API error: channelName=%s, channelID=%s, reason=%s", result.ChannelName, result.ChannelID, result.Reason)
-	default:
-		return errors.Newf("unknown PostMessageResult type: %d", result.Type)
+// reportDryRun logs the records to archive, restore or delete and the channels to notify instead of processing
+// the events.
+func reportDryRun(ctx context.Context, events batchEvents) {
+	for _, event := range events.archived {
+		slog.InfoContext(ctx, "dry run: would archive the record of archived channel and notify ops",
+			slog.String("channel_id", event.record.ChannelID),
+			slog.String("record_channel_name", event.record.ChannelName),
+			slog.String("slack_channel_name", event.SlackChannelName),
+		)
+	}
+	for _, event := range events.restores {
+		slog.InfoContext(ctx, "dry run: would restore the record of unarchived channel and notify the channel and ops",
+			slog.String("channel_id", event.record.ChannelID),
+			slog.String("record_channel_name", event.record.ChannelName),
+			slog.String("slack_channel_name", event.slackChannelName),
+		)
+	}
+	for _, rec := range events.purges {
+		slog.InfoContext(ctx, "dry run: would purge the expired tombstone",
+			slog.String("channel_id", rec.ChannelID),
+			slog.String("channel_name", rec.ChannelName),
+			slog.Int("version", rec.Version),
+		)
+	}
+	for _, rec := range events.migrations {
+		slog.InfoContext(ctx, "dry run: would notify token migration to the channel and ops",
+			slog.String("channel_id", rec.ChannelID),
+			slog.String("channel_name", rec.ChannelName),
+		)
+	}
+	for _, evt := range events.renames {
+		slog.InfoContext(ctx, "dry run: would notify channel rename to the channel and ops",
+			slog.String("channel_id", evt.channelID),
+			slog.String("old_channel_name", evt.oldName),
+			slog.String("renamed_channel_name", evt.newName),
+		)
+	}
+	for _, evt := range events.stales {
+		msg := "dry run: would notify the channel that the unused token will be revoked"
+		if evt.revoke {
+			msg = "dry run: would revoke the unused token and notify the channel and ops"
+		}
+		slog.InfoContext(ctx, msg,
+			slog.String("channel_id", evt.record.ChannelID),
+			slog.String("channel_name", evt.record.ChannelName),
+			slog.Time("last_used", evt.lastUsed),
+		)
+	}
+	for _, evt := range events.rotations {
+		msg := "dry run: would generate the replacement of the old token and notify the channel and ops"
+		if evt.revoke {
+			msg = "dry run: would revoke the rotated token and notify the channel and ops"
+		}
+		slog.InfoContext(ctx, msg,
+			slog.String("channel_id", evt.record.ChannelID),
+			slog.String("channel_name", evt.record.ChannelName),
+			slog.Int("version", evt.record.Version),
+		)
 	}
 }
+
+type channelKey struct {
+	channelName string
+	channelID   string
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
 	"github.com/Finatext/belldog/internal/slack"
 	"github.com/Finatext/belldog/internal/storage"
 	"github.com/aws/aws-lambda-go/events"
@@ -25,7 +27,7 @@ func TestBatchOk(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	ddb := &mockStorageDDB{}
 
-	ddb.On("ScanAll", mock.Anything).Return([]storage.Record{
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
 		{
 			ChannelID:   channelID,
 			ChannelName: channelName,
@@ -43,7 +45,8 @@ func TestBatchOk(t *testing.T) {
 		},
 	}, nil)
 
-	h := NewBatchHandler(defaultConfig, slackClient, ddb)
+	expectBatchSummary(slackClient, defaultConfig, "")
+	h := NewBatchHandler(defaultConfig, slackClient, ddb, nil, nil, nil, nil, nil, nil)
 	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
 	require.NoError(t, err)
 }
@@ -56,7 +59,7 @@ func TestBatchMigration(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	ddb := &mockStorageDDB{}
 
-	ddb.On("ScanAll", mock.Anything).Return([]storage.Record{
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
 		{
 			ChannelID:   channelID,
 			ChannelName: channelName,
@@ -85,7 +88,8 @@ func TestBatchMigration(t *testing.T) {
 	slackClient.On("PostMessage", mock.Anything, channelID, channelName, mock.Anything).Return(slack.PostMessageResult{}, nil)
 	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil)
 
-	h := NewBatchHandler(cfg, slackClient, ddb)
+	expectBatchSummary(slackClient, cfg, "")
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, nil, nil, nil, nil, nil)
 	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
 	require.NoError(t, err)
 	slackClient.AssertExpectations(t)
@@ -99,7 +103,7 @@ func TestBatchRename(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	ddb := &mockStorageDDB{}
 
-	ddb.On("ScanAll", mock.Anything).Return([]storage.Record{
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
 		{
 			ChannelID:   channelID,
 			ChannelName: channelName,
@@ -123,7 +127,8 @@ func TestBatchRename(t *testing.T) {
 	slackClient.On("PostMessage", mock.Anything, channelID, "renamed", mock.Anything).Return(slack.PostMessageResult{}, nil)
 	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil)
 
-	h := NewBatchHandler(cfg, slackClient, ddb)
+	expectBatchSummary(slackClient, cfg, "")
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, nil, nil, nil, nil, nil)
 	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
 	require.NoError(t, err)
 	slackClient.AssertExpectations(t)
@@ -144,7 +149,7 @@ func TestBatchArchived(t *testing.T) {
 		ChannelName: arcvhiedChannelName,
 		Token:       "token_b",
 	}
-	ddb.On("ScanAll", mock.Anything).Return([]storage.Record{
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
 		{
 			ChannelID:   channelID,
 			ChannelName: channelName,
@@ -171,14 +176,15 @@ func TestBatchArchived(t *testing.T) {
 			},
 		},
 	}, nil)
-	ddb.On("Delete", mock.Anything, rec).Return(nil)
+	ddb.On("Archive", mock.Anything, rec, mock.Anything, mock.Anything).Return(nil)
 
 	messageMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
-		return payload["text"].(string) == "Channel is archived, deleting record: channel_id=C789012, record_channel_name=archived, slack_channel_name=archived\n"
+		return strings.HasPrefix(payload["text"].(string), "Channel is archived, archiving record: channel_id=C789012, record_channel_name=archived, slack_channel_name=archived, expires_at=")
 	})
 	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil)
 
-	h := NewBatchHandler(cfg, slackClient, ddb)
+	expectBatchSummary(slackClient, cfg, "")
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, nil, nil, nil, nil, nil)
 	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
 	require.NoError(t, err)
 	slackClient.AssertExpectations(t)
@@ -200,7 +206,7 @@ func TestBatchRenameArchived(t *testing.T) {
 		ChannelName: arcvhiedChannelName,
 		Token:       "token_b",
 	}
-	ddb.On("ScanAll", mock.Anything).Return([]storage.Record{
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
 		{
 			ChannelID:   channelID,
 			ChannelName: channelName,
@@ -227,16 +233,258 @@ func TestBatchRenameArchived(t *testing.T) {
 			},
 		},
 	}, nil)
-	ddb.On("Delete", mock.Anything, rec).Return(nil)
+	ddb.On("Archive", mock.Anything, rec, mock.Anything, mock.Anything).Return(nil)
 
 	messageMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
-		return payload["text"].(string) == "Channel is archived, deleting record: channel_id=C789012, record_channel_name=archived, slack_channel_name=renamed_and_archived\n"
+		return strings.HasPrefix(payload["text"].(string), "Channel is archived, archiving record: channel_id=C789012, record_channel_name=archived, slack_channel_name=renamed_and_archived, expires_at=")
 	})
 	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil)
 
-	h := NewBatchHandler(cfg, slackClient, ddb)
+	expectBatchSummary(slackClient, cfg, "")
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, nil, nil, nil, nil, nil)
 	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
 	require.NoError(t, err)
 	slackClient.AssertExpectations(t)
 	ddb.AssertExpectations(t)
 }
+
+func TestBatchContinuesPastFailure(t *testing.T) {
+	cfg := defaultConfig
+	cfg.BatchConcurrency = 2
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
+		{
+			ChannelID:   "C111111",
+			ChannelName: "first",
+			Token:       "token_a",
+		},
+		{
+			ChannelID:   "C222222",
+			ChannelName: "second",
+			Token:       "token_b",
+		},
+	}, nil)
+	slackClient.On("GetAllChannels", mock.Anything).Return([]slackgo.Channel{
+		{
+			GroupConversation: slackgo.GroupConversation{
+				Name: "first_renamed",
+				Conversation: slackgo.Conversation{
+					ID: "C111111",
+				},
+			},
+		},
+		{
+			GroupConversation: slackgo.GroupConversation{
+				Name: "second_renamed",
+				Conversation: slackgo.Conversation{
+					ID: "C222222",
+				},
+			},
+		},
+	}, nil)
+
+	slackClient.On("PostMessage", mock.Anything, "C111111", "first_renamed", mock.Anything).Return(slack.PostMessageResult{
+		Type:   slack.PostMessageResultAPIFailure,
+		Reason: "channel_not_found",
+	}, nil)
+	slackClient.On("PostMessage", mock.Anything, "C222222", "second_renamed", mock.Anything).Return(slack.PostMessageResult{}, nil)
+	messageMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		return strings.HasPrefix(payload["text"].(string), "Channel name and channel id pair updated: channel_id=C222222")
+	})
+	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil)
+
+	expectBatchSummary(slackClient, cfg, "Batch process completed with errors: records=2, archived=0, restored=0, purged=0, migrations=0, renames=2, stale_notices=0, stale_revokes=0, rotations=0, rotation_revokes=0, errors=1\n")
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, nil, nil, nil, nil, nil)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "channel_not_found")
+	slackClient.AssertExpectations(t)
+}
+
+// expectBatchSummary expects the summary message posted to the ops channel. Empty message matches any summary.
+func expectBatchSummary(slackClient *mockSlackClient, cfg appconfig.Config, message string) {
+	matcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		if message == "" {
+			return strings.HasPrefix(text, "Batch process completed")
+		}
+		return text == message
+	})
+	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, matcher).Return(slack.PostMessageResult{}, nil)
+}
+
+func TestBatchDryRun(t *testing.T) {
+	cfg := defaultConfig
+	cfg.BatchDryRun = true
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
+		{
+			ChannelID:   "C111111",
+			ChannelName: "archived",
+			Token:       "token_a",
+		},
+		{
+			ChannelID:   "C222222",
+			ChannelName: "old",
+			Token:       "token_b",
+		},
+	}, nil)
+	slackClient.On("GetAllChannels", mock.Anything).Return([]slackgo.Channel{
+		{
+			GroupConversation: slackgo.GroupConversation{
+				Name: "archived",
+				Conversation: slackgo.Conversation{
+					ID: "C111111",
+				},
+				IsArchived: true,
+			},
+		},
+		{
+			GroupConversation: slackgo.GroupConversation{
+				Name: "renamed",
+				Conversation: slackgo.Conversation{
+					ID: "C222222",
+				},
+			},
+		},
+	}, nil)
+
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, nil, nil, nil, nil, nil)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+	require.NoError(t, err)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	ddb.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	ddb.AssertNotCalled(t, "Archive", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBatchRestore(t *testing.T) {
+	cfg := defaultConfig
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	restored := storage.Record{
+		ChannelID:   "C111111",
+		ChannelName: "unarchived",
+		Token:       "token_a",
+		ArchivedAt:  "2024-01-01T00:00:00Z",
+		ExpiresAt:   expiresAt,
+	}
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
+		restored,
+		// Still archived, left to DynamoDB TTL.
+		{
+			ChannelID:   "C222222",
+			ChannelName: "archived",
+			Token:       "token_b",
+			ArchivedAt:  "2024-01-01T00:00:00Z",
+			ExpiresAt:   expiresAt,
+		},
+	}, nil)
+	slackClient.On("GetAllChannels", mock.Anything).Return([]slackgo.Channel{
+		{
+			GroupConversation: slackgo.GroupConversation{
+				Name: "unarchived",
+				Conversation: slackgo.Conversation{
+					ID: "C111111",
+				},
+			},
+		},
+		{
+			GroupConversation: slackgo.GroupConversation{
+				Name: "archived",
+				Conversation: slackgo.Conversation{
+					ID: "C222222",
+				},
+				IsArchived: true,
+			},
+		},
+	}, nil)
+	ddb.On("Restore", mock.Anything, restored).Return(nil)
+	slackClient.On("PostMessage", mock.Anything, "C111111", "unarchived", mock.Anything).Return(slack.PostMessageResult{}, nil)
+	messageMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		return payload["text"].(string) == "Channel is unarchived, restored record: channel_id=C111111, record_channel_name=unarchived\n"
+	})
+	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil)
+
+	expectBatchSummary(slackClient, cfg, "Batch process completed: records=2, archived=0, restored=1, purged=0, migrations=0, renames=0, stale_notices=0, stale_revokes=0, rotations=0, rotation_revokes=0, errors=0\n")
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, nil, nil, nil, nil, nil)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+	require.NoError(t, err)
+	slackClient.AssertExpectations(t)
+	ddb.AssertExpectations(t)
+	ddb.AssertNotCalled(t, "Archive", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBatchPurge(t *testing.T) {
+	cfg := defaultConfig
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+
+	expired := storage.Record{
+		ChannelID:   "C111111",
+		ChannelName: "test",
+		Token:       "token_a",
+		RevokedAt:   "2024-01-01T00:00:00Z",
+		ExpiresAt:   time.Now().Add(-time.Hour).Unix(),
+	}
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
+		expired,
+		// Revoked tokens in the grace period are kept and not restored by the batch job.
+		{
+			ChannelID:   "C111111",
+			ChannelName: "test",
+			Token:       "token_b",
+			Version:     1,
+			RevokedAt:   "2024-01-01T00:00:00Z",
+			ExpiresAt:   time.Now().Add(time.Hour).Unix(),
+		},
+	}, nil)
+	slackClient.On("GetAllChannels", mock.Anything).Return([]slackgo.Channel{
+		{
+			GroupConversation: slackgo.GroupConversation{
+				Name: "test",
+				Conversation: slackgo.Conversation{
+					ID: "C111111",
+				},
+			},
+		},
+	}, nil)
+	ddb.On("Delete", mock.Anything, expired).Return(nil)
+
+	expectBatchSummary(slackClient, cfg, "Batch process completed: records=2, archived=0, restored=0, purged=1, migrations=0, renames=0, stale_notices=0, stale_revokes=0, rotations=0, rotation_revokes=0, errors=0\n")
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, nil, nil, nil, nil, nil)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+	require.NoError(t, err)
+	slackClient.AssertExpectations(t)
+	ddb.AssertExpectations(t)
+	ddb.AssertNotCalled(t, "Restore", mock.Anything, mock.Anything)
+}
+
+func TestProcessArchivedPublishesLifecycleEvent(t *testing.T) {
+	rec := storage.Record{ChannelID: "C123456", ChannelName: "test", Token: "bd_ab12_deadbeef", TokenPrefix: "bd_ab12", Version: 1}
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	lifecycleSvc := &mockLifecycleService{}
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", mock.Anything).Return(slack.PostMessageResult{}, nil)
+	ddb.On("Archive", mock.Anything, rec, mock.AnythingOfType("string"), mock.AnythingOfType("int64")).Return(nil)
+	lifecycleSvc.On("Publish", mock.Anything, service.LifecycleEvent{
+		Type:         service.LifecycleRecordDeletedArchived,
+		ChannelID:    "C123456",
+		ChannelName:  "test",
+		TokenPrefix:  "bd_ab12",
+		TokenVersion: 1,
+		Reason:       service.LifecycleReasonChannelArchived,
+	}).Return(nil)
+
+	m := newRecordMaintainer(defaultConfig, slackClient, ddb, nil, nil, nil, lifecycleSvc)
+	err := m.processArchived(context.Background(), archiveEvent{record: rec, SlackChannelName: "test"})
+
+	require.NoError(t, err)
+	ddb.AssertExpectations(t)
+	lifecycleSvc.AssertExpectations(t)
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// batchCheckpointStore saves the state of checkpointed batch runs between steps, e.g. service.IdempotencyService.
+type batchCheckpointStore interface {
+	SaveBatchCheckpoint(ctx context.Context, id string, state string) error
+	GetBatchCheckpoint(ctx context.Context, id string) (string, bool, error)
+}
+
+// BatchStepInput is the input of each step of checkpointed batch runs: the checkpoint of the previous output,
+// empty for the first step.
+type BatchStepInput struct {
+	Checkpoint string `json:"checkpoint"`
+}
+
+// BatchStepOutput is the partial progress of checkpointed batch runs. Give it as the input of the next step until
+// Done, e.g. with a Choice state of Step Functions.
+type BatchStepOutput struct {
+	Checkpoint string `json:"checkpoint"`
+	Done       bool   `json:"done"`
+	// Progress of the run so far.
+	Chunks  int `json:"chunks"`
+	Records int `json:"records"`
+	Errors  int `json:"errors"`
+}
+
+// batchCheckpoint is the state of checkpointed batch runs saved after each step.
+type batchCheckpoint struct {
+	// Empty before the first chunk and after the last chunk.
+	Cursor  string       `json:"cursor"`
+	Done    bool         `json:"done"`
+	Chunks  int          `json:"chunks"`
+	Summary batchSummary `json:"summary"`
+}
+
+// HandleStep processes a chunk of BATCH_CHUNK_SIZE records per invocation, so runs over large tables don't hit the
+// Lambda timeout. Slack channels of the chunk are fetched one by one instead of listing all channels. The summary is
+// posted to the ops channel after the last chunk.
+//
+// Failed events are counted in the output instead of failing the step, because retrying the step processes the
+// chunk again. A step failing before saving the checkpoint can be retried with the same input; notifications of the
+// chunk may be posted twice.
+func (h *BatchHandler) HandleStep(ctx context.Context, input BatchStepInput) (output BatchStepOutput, err error) {
+	var notify func(context.Context, string) error
+	if h.cfg.PanicNotification {
+		notify = h.maintainer.notifyPanic
+	}
+	defer recoverEventPanic(ctx, "batch", notify, &err)
+	if currentSettings(ctx, h.cfg, h.settings).Passive() {
+		slog.InfoContext(ctx, "skip batch process in passive region")
+		return BatchStepOutput{Checkpoint: input.Checkpoint, Done: true}, nil
+	}
+	output, err = h.handleStep(ctx, input)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to handle", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("checkpoint", input.Checkpoint))
+		return BatchStepOutput{}, err
+	}
+	return output, nil
+}
+
+func (h *BatchHandler) handleStep(ctx context.Context, input BatchStepInput) (BatchStepOutput, error) {
+	if h.checkpoints == nil {
+		return BatchStepOutput{}, errors.New("checkpointed batch runs require the checkpoint store")
+	}
+	id := input.Checkpoint
+	var state batchCheckpoint
+	if id == "" {
+		id = generateCheckpointID()
+		slog.InfoContext(ctx, "starting checkpointed batch run", slog.String("checkpoint", id))
+	} else {
+		saved, found, err := h.checkpoints.GetBatchCheckpoint(ctx, id)
+		if err != nil {
+			return BatchStepOutput{}, err
+		}
+		if !found {
+			return BatchStepOutput{}, errors.Newf("checkpoint not found or expired: %s", id)
+		}
+		if err := json.Unmarshal([]byte(saved), &state); err != nil {
+			return BatchStepOutput{}, errors.Wrapf(err, "failed to unmarshal checkpoint: %s", id)
+		}
+		// Retried last step.
+		if state.Done {
+			return state.output(id), nil
+		}
+	}
+
+	summary, cursor, err := h.processChunk(ctx, state.Cursor)
+	if err != nil {
+		return BatchStepOutput{}, err
+	}
+	state.Cursor = cursor
+	state.Chunks++
+	state.Summary = state.Summary.add(summary)
+	state.Done = cursor == ""
+	slog.InfoContext(ctx, "processed chunk", slog.String("checkpoint", id), slog.Int("chunks", state.Chunks), slog.Int("records", summary.Records), slog.Bool("done", state.Done))
+
+	if state.Done {
+		telemetry.RecordBatchRun(ctx, state.Summary.Records, state.Summary.Errors == 0)
+		if h.cfg.BatchDryRun {
+			slog.InfoContext(ctx, "dry run completed, nothing is archived, restored, deleted or posted", slog.String("summary", state.Summary.message()))
+		} else if err := h.notifySummary(ctx, state.Summary); err == nil {
+			slog.InfoContext(ctx, "batch process completed")
+		}
+	}
+	saved, err := json.Marshal(state)
+	if err != nil {
+		return BatchStepOutput{}, errors.Wrap(err, "failed to marshal checkpoint")
+	}
+	if err := h.checkpoints.SaveBatchCheckpoint(ctx, id, string(saved)); err != nil {
+		return BatchStepOutput{}, err
+	}
+	return state.output(id), nil
+}
+
+// processChunk detects and processes the events of the chunk after the cursor. Chunks contain whole channels, so
+// migrations and rotations are detected like full runs.
+func (h *BatchHandler) processChunk(ctx context.Context, cursor string) (batchSummary, string, error) {
+	recs, next, err := h.ddb.ScanChunk(ctx, cursor, max(h.cfg.BatchChunkSize, 1))
+	if err != nil {
+		return batchSummary{}, "", err
+	}
+	var channelIDs []string
+	seen := make(map[string]bool)
+	for _, rec := range recs {
+		if !seen[rec.ChannelID] {
+			seen[rec.ChannelID] = true
+			channelIDs = append(channelIDs, rec.ChannelID)
+		}
+	}
+	channels, err := h.slackClient.GetChannelsByID(ctx, channelIDs)
+	if err != nil {
+		return batchSummary{}, "", err
+	}
+	detector, err := newEventDetector(h.cfg, channels, time.Now())
+	if err != nil {
+		return batchSummary{}, "", err
+	}
+	for _, rec := range recs {
+		detector.detect(ctx, rec)
+	}
+	events := detector.finish(ctx)
+	summary := events.summary(detector.records)
+
+	if h.cfg.BatchDryRun {
+		reportDryRun(ctx, events)
+		return summary, next, nil
+	}
+	summary.Errors = len(h.processEvents(ctx, events))
+	return summary, next, nil
+}
+
+func (c batchCheckpoint) output(id string) BatchStepOutput {
+	return BatchStepOutput{Checkpoint: id, Done: c.Done, Chunks: c.Chunks, Records: c.Summary.Records, Errors: c.Summary.Errors}
+}
+
+func generateCheckpointID() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never returns an error.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
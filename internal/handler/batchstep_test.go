@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	slackgo "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+type memoryCheckpointStore map[string]string
+
+func (m memoryCheckpointStore) SaveBatchCheckpoint(ctx context.Context, id string, state string) error {
+	m[id] = state
+	return nil
+}
+
+func (m memoryCheckpointStore) GetBatchCheckpoint(ctx context.Context, id string) (string, bool, error) {
+	state, found := m[id]
+	return state, found, nil
+}
+
+func TestBatchStep(t *testing.T) {
+	cfg := defaultConfig
+	cfg.BatchChunkSize = 1
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	checkpoints := memoryCheckpointStore{}
+
+	live := storage.Record{ChannelID: "C1", ChannelName: "alerts", Token: "token_a"}
+	archived := storage.Record{ChannelID: "C2", ChannelName: "old", Token: "token_b"}
+	ddb.On("ScanChunk", mock.Anything, "", 1).Return([]storage.Record{live}, "alerts", nil).Once()
+	ddb.On("ScanChunk", mock.Anything, "alerts", 1).Return([]storage.Record{archived}, "", nil).Once()
+	ddb.On("Archive", mock.Anything, archived, mock.Anything, mock.Anything).Return(nil).Once()
+	slackClient.On("GetChannelsByID", mock.Anything, []string{"C1"}).Return([]slackgo.Channel{
+		{GroupConversation: slackgo.GroupConversation{Name: "alerts", Conversation: slackgo.Conversation{ID: "C1"}}},
+	}, nil).Once()
+	slackClient.On("GetChannelsByID", mock.Anything, []string{"C2"}).Return([]slackgo.Channel{
+		{GroupConversation: slackgo.GroupConversation{Name: "old", IsArchived: true, Conversation: slackgo.Conversation{ID: "C2"}}},
+	}, nil).Once()
+	archiveMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		return strings.HasPrefix(text, "Channel is archived")
+	})
+	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, archiveMatcher).Return(slack.PostMessageResult{}, nil).Once()
+	expectBatchSummary(slackClient, cfg, "Batch process completed: records=2, archived=1, restored=0, purged=0, migrations=0, renames=0, stale_notices=0, stale_revokes=0, rotations=0, rotation_revokes=0, errors=0\n")
+
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, nil, nil, nil, checkpoints, nil)
+	ctx := context.Background()
+	out, err := h.HandleStep(ctx, BatchStepInput{})
+	require.NoError(t, err)
+	require.NotEmpty(t, out.Checkpoint)
+	assert.Equal(t, BatchStepOutput{Checkpoint: out.Checkpoint, Chunks: 1, Records: 1}, out)
+
+	out, err = h.HandleStep(ctx, BatchStepInput{Checkpoint: out.Checkpoint})
+	require.NoError(t, err)
+	assert.Equal(t, BatchStepOutput{Checkpoint: out.Checkpoint, Done: true, Chunks: 2, Records: 2}, out)
+
+	// Retrying the last step neither scans nor posts the summary again.
+	retried, err := h.HandleStep(ctx, BatchStepInput{Checkpoint: out.Checkpoint})
+	require.NoError(t, err)
+	assert.Equal(t, out, retried)
+	slackClient.AssertExpectations(t)
+	ddb.AssertExpectations(t)
+}
+
+func TestBatchStepUnknownCheckpoint(t *testing.T) {
+	h := NewBatchHandler(defaultConfig, &mockSlackClient{}, &mockStorageDDB{}, nil, nil, nil, nil, memoryCheckpointStore{}, nil)
+	_, err := h.HandleStep(context.Background(), BatchStepInput{Checkpoint: "unknown"})
+	require.Error(t, err)
+}
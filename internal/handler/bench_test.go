@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// Benchmarks of the webhook path with the memory storage and the stub Slack client, so they measure Belldog
+// itself: routing, token verification, JSON parsing and logging. Logs are written as JSON like Lambda does, to
+// io.Discard.
+//
+//	go test ./internal/handler -run '^$' -bench Webhook -benchmem
+
+const benchPayloadBlocks = `{
+  "text": "Deployment finished",
+  "blocks": [
+    {"type": "header", "text": {"type": "plain_text", "text": "Deployment finished"}},
+    {"type": "section", "fields": [
+      {"type": "mrkdwn", "text": "*Service:*\nbelldog"},
+      {"type": "mrkdwn", "text": "*Version:*\nv1.2.3"},
+      {"type": "mrkdwn", "text": "*Environment:*\nproduction"},
+      {"type": "mrkdwn", "text": "*Duration:*\n3m12s"}
+    ]},
+    {"type": "context", "elements": [{"type": "mrkdwn", "text": "Triggered by <https://example.com/runs/1|run #1>"}]}
+  ]
+}`
+
+func setupBenchWebhook(b *testing.B) (*echo.Echo, string) {
+	b.Helper()
+	original := slog.Default()
+	slog.SetDefault(slog.New(logging.NewContextHandler(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{AddSource: true}))))
+	b.Cleanup(func() { slog.SetDefault(original) })
+
+	cfg := appconfig.Config{
+		MaxBodyBytes:               1 << 20,
+		OpsNotificationChannelName: "ops",
+		SlackStub:                  true,
+	}
+	slackClient, err := slack.NewClient(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ddb := storage.NewMemory()
+	tokenSvc := service.NewTokenService(ddb, cfg.RevokeGracePeriod)
+	res, err := tokenSvc.GenerateAndSaveToken(context.Background(), "C123456", "bench", service.ScopePost)
+	if err != nil {
+		b.Fatal(err)
+	}
+	auditSvc := service.NewAuditService(nil)
+	channelConfigSvc := service.NewChannelConfigService(nil)
+	idempotencySvc := service.NewIdempotencyService(nil, cfg.IdempotencyTTL)
+	digestSvc := service.NewDigestService(nil)
+	broadcastSvc := service.NewBroadcastService(nil)
+	e := NewEchoHandler(cfg, &slackClient, &tokenSvc, &auditSvc, &channelConfigSvc, service.NewMentionService(nil, 0), &idempotencySvc, &digestSvc, &broadcastSvc, ddb, nil, nil, nil, nil, nil)
+	return e, "/p/bench/" + res.Token.Reveal()
+}
+
+func benchmarkWebhook(b *testing.B, payload string) {
+	e, path := setupBenchWebhook(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			b.Fatalf("unexpected status: %d, %s", rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func BenchmarkWebhookText(b *testing.B) {
+	benchmarkWebhook(b, `{"text": "hello"}`)
+}
+
+func BenchmarkWebhookBlocks(b *testing.B) {
+	benchmarkWebhook(b, benchPayloadBlocks)
+}
+
+func BenchmarkWebhookParallel(b *testing.B) {
+	e, path := setupBenchWebhook(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(benchPayloadBlocks))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				b.Errorf("unexpected status: %d, %s", rec.Code, rec.Body.String())
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+type broadcastResponse struct {
+	Ok      bool              `json:"ok"`
+	Group   string            `json:"group"`
+	Results []broadcastResult `json:"results"`
+}
+
+type broadcastResult struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Ok          bool   `json:"ok"`
+	TS          string `json:"ts,omitempty"`
+	// The channel is paused, the message is not delivered to the channel.
+	Paused bool   `json:"paused,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// WebhookBroadcast posts the payload to all member channels of the broadcast group concurrently. The response
+// is always JSON having the result of each channel: 200 when all succeeded, 207 when some failed and 502 when
+// all failed.
+func (h *ProxyHandler) WebhookBroadcast(c echo.Context) (err error) {
+	ctx := c.Request().Context()
+	defer func() { recordWebhookRequest(c, err) }()
+	apierror.PreferJSON(c)
+
+	groupName := c.Param("group_name")
+	group, err := h.broadcastSvc.VerifyGroupToken(ctx, groupName, secret.Token(c.Param("token")))
+	if err != nil {
+		code, ok := service.CodeOf(err)
+		if !ok {
+			return err
+		}
+		telemetry.RecordVerifyFailure(ctx, groupName, string(code))
+		status, errCode, msg := broadcastError(code, groupName)
+		slog.InfoContext(ctx, "group token verification failed", slog.String("code", string(code)), slog.String("group", groupName), slog.Int("status", status))
+		return apierror.Respond(c, status, errCode, msg)
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read request body")
+	}
+	telemetry.RecordPayloadSize(ctx, groupName, len(body))
+	payload, err := parseRequestBody(c.Request(), body)
+	if err != nil {
+		slog.InfoContext(ctx, "parseRequestBody failed, response bad request", slog.String("error", err.Error()), slog.String("body", string(body)))
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid body given. JSON Unmarshal failed.\n")
+	}
+	// Resolve once for all members, instead of using withMentions.
+	if err := h.mentionSvc.ResolveMentions(ctx, payload); err != nil {
+		if errors.Is(err, service.ErrInvalidMentions) {
+			slog.InfoContext(ctx, "invalid mentions given", slog.String("error", err.Error()))
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidMentions, "Invalid mentions given.\n")
+		}
+		slog.WarnContext(ctx, "failed to resolve mentions", slog.String("error", err.Error()), slog.String("group", groupName))
+	}
+
+	send := h.withChannelDefaults(h.slackClient.PostMessage)
+	results := make([]broadcastResult, len(group.Members))
+	var wg sync.WaitGroup
+	for i, member := range group.Members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = h.broadcastTo(c, member, maps.Clone(payload), send)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if !r.Ok {
+			failed++
+		}
+	}
+	status := http.StatusOK
+	switch {
+	case failed > 0 && failed == len(results):
+		status = http.StatusBadGateway
+	case failed > 0:
+		status = http.StatusMultiStatus
+	}
+	slog.InfoContext(ctx, "broadcast finished", slog.String("group", groupName), slog.Int("members", len(results)), slog.Int("failed", failed))
+	return c.JSON(status, broadcastResponse{Ok: failed == 0, Group: groupName, Results: results})
+}
+
+// broadcastTo posts the payload to a member channel. Errors are reported in the result to not fail other
+// members. The payload must be a copy for the member because channel defaults modify it.
+func (h *ProxyHandler) broadcastTo(c echo.Context, member service.BroadcastMember, payload map[string]interface{}, send sendFunc) broadcastResult {
+	ctx := logging.WithChannel(c.Request().Context(), member.ChannelID, member.ChannelName)
+	res := broadcastResult{ChannelID: member.ChannelID, ChannelName: member.ChannelName}
+	if h.isPaused(ctx, member.ChannelID) {
+		res.Ok = true
+		res.Paused = true
+		return res
+	}
+
+	result, err := send(ctx, member.ChannelID, member.ChannelName, payload)
+	if err != nil {
+		slog.ErrorContext(ctx, "PostMessage failed",
+			slog.String("error", err.Error()),
+		)
+		res.Error = "internal_error"
+		return res
+	}
+	if err := handlePostMessageFailure(result); err != nil {
+		slog.WarnContext(ctx, "broadcast to member failed", slog.String("error", err.Error()))
+		res.Error = broadcastFailureReason(result)
+		return res
+	}
+	res.Ok = true
+	res.TS = result.TS
+	return res
+}
+
+func broadcastFailureReason(result slack.PostMessageResult) string {
+	switch result.Type {
+	case slack.PostMessageResultServerTimeoutFailure:
+		return "timeout"
+	case slack.PostMessageResultServerFailure:
+		return "server_error"
+	case slack.PostMessageResultRateLimited:
+		return "rate_limited"
+	case slack.PostMessageResultCircuitOpen:
+		return "slack_unavailable"
+	case slack.PostMessageResultAPIFailure:
+		return result.Reason
+	default:
+		return "internal_error"
+	}
+}
+
+func broadcastError(code service.Code, groupName string) (status int, errCode apierror.Code, msg string) {
+	switch code {
+	case service.CodeTokenNotFound:
+		return http.StatusNotFound, apierror.CodeGroupNotFound, "No broadcast group found: " + groupName + "\n"
+	case service.CodeTokenUnmatch:
+		return http.StatusUnauthorized, apierror.CodeTokenUnmatch, "Invalid token given. Check the group URL.\n"
+	default:
+		return webhookError(code, groupName)
+	}
+}
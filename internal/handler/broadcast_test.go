@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func setupBroadcastContext() (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, "/b/deploys/deadbeef", strings.NewReader(defaultPayloadJSON()))
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetPath("/b/:group_name/:token")
+	c.SetParamNames("group_name", "token")
+	c.SetParamValues("deploys", "deadbeef")
+	return c, rec
+}
+
+var testBroadcastGroup = service.BroadcastGroup{
+	Name:  "deploys",
+	Token: "deadbeef",
+	Members: []service.BroadcastMember{
+		{ChannelID: "C111111", ChannelName: "first"},
+		{ChannelID: "C222222", ChannelName: "second"},
+	},
+}
+
+func TestWebhookBroadcastPartialFailure(t *testing.T) {
+	broadcastSvc := &mockBroadcastService{}
+	broadcastSvc.On("VerifyGroupToken", mock.Anything, "deploys", "deadbeef").Return(testBroadcastGroup, nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C111111", "first", defaultPayload).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+		TS:   "1700000000.000100",
+	}, nil)
+	slackClient.On("PostMessage", mock.Anything, "C222222", "second", defaultPayload).Return(slack.PostMessageResult{
+		Type:   slack.PostMessageResultAPIFailure,
+		Reason: "channel_not_found",
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		broadcastSvc:     broadcastSvc,
+	}
+	c, rec := setupBroadcastContext()
+	err := h.WebhookBroadcast(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	var resp broadcastResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.False(t, resp.Ok)
+	assert.Equal(t, []broadcastResult{
+		{ChannelID: "C111111", ChannelName: "first", Ok: true, TS: "1700000000.000100"},
+		{ChannelID: "C222222", ChannelName: "second", Error: "channel_not_found"},
+	}, resp.Results)
+}
+
+func TestWebhookBroadcastSkipsPausedChannels(t *testing.T) {
+	broadcastSvc := &mockBroadcastService{}
+	broadcastSvc.On("VerifyGroupToken", mock.Anything, "deploys", "deadbeef").Return(testBroadcastGroup, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{MaintenanceMode: true},
+		slackClient:      &mockSlackClient{},
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		broadcastSvc:     broadcastSvc,
+	}
+	c, rec := setupBroadcastContext()
+	err := h.WebhookBroadcast(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp broadcastResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.True(t, resp.Ok)
+	for _, r := range resp.Results {
+		assert.True(t, r.Paused)
+	}
+}
+
+func TestWebhookBroadcastInvalidToken(t *testing.T) {
+	broadcastSvc := &mockBroadcastService{}
+	broadcastSvc.On("VerifyGroupToken", mock.Anything, "deploys", "deadbeef").Return(service.BroadcastGroup{}, service.ErrTokenUnmatch)
+
+	h := ProxyHandler{
+		cfg:          appconfig.Config{},
+		broadcastSvc: broadcastSvc,
+	}
+	c, rec := setupBroadcastContext()
+	err := h.WebhookBroadcast(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// Slash command arguments are separated by spaces. Values containing spaces are quoted with `"` or `'`, or with
+// the smart quotes Slack clients may convert them to. Quotes only open at the start of words and values, e.g.
+// `"Deploy Bot"` and `key="a b"`, so apostrophes in words are kept as is. Backslashes are not escape characters.
+// `key=value` words are flags, e.g. `scope=manage`; quote the word to pass it as a positional argument.
+
+// usageError is the invalid argument of a slash command. The reason is shown to the user with the usage.
+type usageError struct {
+	reason string
+}
+
+func (e *usageError) Error() string {
+	return e.reason
+}
+
+func usageErrorf(format string, args ...any) *usageError {
+	return &usageError{reason: fmt.Sprintf(format, args...)}
+}
+
+// flagSpec describes a `key=value` flag a command accepts.
+type flagSpec struct {
+	name string
+	// Optional. Returns the reason when the value is invalid.
+	validate func(value string) error
+}
+
+// commandArgs are the parsed arguments of a slash command.
+type commandArgs struct {
+	text       string
+	positional []string
+	// Byte offsets of the positional arguments in the text.
+	offsets []int
+	flags   map[string]string
+	// `--public` is given.
+	public bool
+}
+
+var flagNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+var closingQuotes = map[rune]rune{'"': '"', '\'': '\'', '“': '”', '‘': '’'}
+
+func parseCommandArgs(text string) (commandArgs, error) {
+	args := commandArgs{text: text, flags: map[string]string{}}
+	i := 0
+	for {
+		for i < len(text) {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			i += size
+		}
+		if i >= len(text) {
+			return args, nil
+		}
+		start := i
+		var word strings.Builder
+		// The byte offset in the word where the first quote starts, or -1.
+		quotedAt := -1
+		prev := ' '
+		for i < len(text) {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			if unicode.IsSpace(r) {
+				break
+			}
+			i += size
+			closing, ok := closingQuotes[r]
+			if !ok || (prev != ' ' && prev != '=') {
+				word.WriteRune(r)
+				prev = r
+				continue
+			}
+			prev = closing
+			if quotedAt < 0 {
+				quotedAt = word.Len()
+			}
+			end := strings.IndexRune(text[i:], closing)
+			if end < 0 {
+				return commandArgs{}, usageErrorf("unterminated quote: %s", text[start:])
+			}
+			word.WriteString(text[i : i+end])
+			i += end + utf8.RuneLen(closing)
+		}
+		if err := args.add(word.String(), start, quotedAt); err != nil {
+			return commandArgs{}, err
+		}
+	}
+}
+
+func (a *commandArgs) add(word string, offset int, quotedAt int) error {
+	if quotedAt < 0 && word == publicFlag {
+		a.public = true
+		return nil
+	}
+	if key, value, ok := strings.Cut(word, "="); ok && (quotedAt < 0 || len(key) < quotedAt) && flagNameRegexp.MatchString(key) {
+		if _, dup := a.flags[key]; dup {
+			return usageErrorf("%s is given twice", key)
+		}
+		a.flags[key] = value
+		return nil
+	}
+	a.positional = append(a.positional, word)
+	a.offsets = append(a.offsets, offset)
+	return nil
+}
+
+// arg returns the i-th positional argument, or empty string.
+func (a commandArgs) arg(i int) string {
+	if i >= len(a.positional) {
+		return ""
+	}
+	return a.positional[i]
+}
+
+// rest returns the text from the i-th positional argument as is, for free-form arguments like mapping rules.
+func (a commandArgs) rest(i int) string {
+	if i >= len(a.offsets) {
+		return ""
+	}
+	return strings.TrimSpace(a.text[a.offsets[i]:])
+}
+
+// validate checks the arguments against the command spec.
+func (a commandArgs) validate(spec commandSpec) error {
+	if n := len(a.positional); !spec.args.accepts(n) {
+		if n < spec.args.min {
+			return usageErrorf("missing arguments")
+		}
+		return usageErrorf("too many arguments")
+	}
+	keys := make([]string, 0, len(a.flags))
+	for key := range a.flags {
+		keys = append(keys, key)
+	}
+	// Report the first invalid flag in a stable order.
+	slices.Sort(keys)
+	for _, key := range keys {
+		i := slices.IndexFunc(spec.flags, func(f flagSpec) bool { return f.name == key })
+		if i < 0 {
+			return usageErrorf("unknown flag: %s", key)
+		}
+		if validate := spec.flags[i].validate; validate != nil {
+			if err := validate(a.flags[key]); err != nil {
+				return usageErrorf("invalid %s=%s: %s", key, a.flags[key], err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// commandArgsOf returns the arguments of the command. The text has been validated by validateArgs.
+func commandArgsOf(cmdReq slack.SlashCommandRequest) commandArgs {
+	args, err := parseCommandArgs(cmdReq.Text)
+	if err != nil {
+		return commandArgs{flags: map[string]string{}}
+	}
+	return args
+}
+
+// usageResponse responds with the reason of the usage error and the usage of the command.
+func usageResponse(c echo.Context, spec commandSpec, err error) error {
+	return commandResponse(c, fmt.Sprintf("Invalid arguments for the slash command: %s. Usage: `%s`\n", err.Error(), commandUsage(spec)))
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommandArgs(t *testing.T) {
+	tests := []struct {
+		name           string
+		text           string
+		wantPositional []string
+		wantFlags      map[string]string
+		wantPublic     bool
+	}{
+		{name: "empty", text: "  ", wantFlags: map[string]string{}},
+		{name: "positional", text: " set  username\tbot ", wantPositional: []string{"set", "username", "bot"}, wantFlags: map[string]string{}},
+		{name: "quoted", text: `set username "Deploy Bot"`, wantPositional: []string{"set", "username", "Deploy Bot"}, wantFlags: map[string]string{}},
+		{name: "smart quotes", text: "set username “Deploy Bot”", wantPositional: []string{"set", "username", "Deploy Bot"}, wantFlags: map[string]string{}},
+		{name: "apostrophe", text: "set username Bob's", wantPositional: []string{"set", "username", "Bob's"}, wantFlags: map[string]string{}},
+		{name: "flags", text: "scope=manage ttl=30d --public", wantFlags: map[string]string{"scope": "manage", "ttl": "30d"}, wantPublic: true},
+		{name: "quoted flag value", text: `name='a b'`, wantFlags: map[string]string{"name": "a b"}},
+		{name: "quoted flag-like word", text: `"scope=manage" '--public'`, wantPositional: []string{"scope=manage", "--public"}, wantFlags: map[string]string{}},
+		{name: "not flag name", text: "$.a[?(@.b==1)]", wantPositional: []string{"$.a[?(@.b==1)]"}, wantFlags: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := parseCommandArgs(tt.text)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPositional, args.positional)
+			assert.Equal(t, tt.wantFlags, args.flags)
+			assert.Equal(t, tt.wantPublic, args.public)
+		})
+	}
+}
+
+func TestParseCommandArgsErrors(t *testing.T) {
+	_, err := parseCommandArgs(`set username "Deploy Bot`)
+	assert.EqualError(t, err, `unterminated quote: "Deploy Bot`)
+	_, err = parseCommandArgs("scope=post scope=manage")
+	assert.EqualError(t, err, "scope is given twice")
+}
+
+func TestCommandArgsRest(t *testing.T) {
+	args, err := parseCommandArgs(`deadbeef text <- $["a b"];  color <- $.severity `)
+	require.NoError(t, err)
+	assert.Equal(t, "deadbeef", args.arg(0))
+	assert.Equal(t, `text <- $["a b"];  color <- $.severity`, args.rest(1))
+	assert.Empty(t, args.rest(10))
+	assert.Empty(t, args.arg(10))
+}
+
+func TestCommandArgsValidate(t *testing.T) {
+	spec, ok := findCommand(cmdGenerate)
+	require.True(t, ok)
+	tests := []struct {
+		text    string
+		wantErr string
+	}{
+		{text: "scope=manage --public"},
+		{text: "manage"},
+		{text: "manage post", wantErr: "too many arguments"},
+		{text: "ttl=30d", wantErr: "unknown flag: ttl"},
+		{text: "scope=admin", wantErr: "invalid scope=admin: available scopes: post, manage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			args, err := parseCommandArgs(tt.text)
+			require.NoError(t, err)
+			err = args.validate(spec)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
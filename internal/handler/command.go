@@ -1,17 +1,23 @@
 package handler
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/labstack/echo/v4"
 
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/service"
 	"github.com/Finatext/belldog/internal/slack"
 )
 
@@ -21,6 +27,28 @@ const (
 	cmdRegenerate    = "/belldog-regenerate"
 	cmdRevoke        = "/belldog-revoke"
 	cmdRevokeRenamed = "/belldog-revoke-renamed"
+	cmdRestore       = "/belldog-restore"
+	cmdMapping       = "/belldog-mapping"
+	cmdAudit         = "/belldog-audit"
+	cmdConfig        = "/belldog-config"
+	cmdLookup        = "/belldog-lookup"
+	cmdTest          = "/belldog-test"
+	cmdPause         = "/belldog-pause"
+	cmdResume        = "/belldog-resume"
+	cmdBroadcast     = "/belldog-broadcast"
+	cmdHelp          = "/belldog-help"
+)
+
+// Audit results of token lifecycle commands. Failures are recorded with service.Code.
+const (
+	auditResultGenerated        = "generated"
+	auditResultAlreadyGenerated = "already_generated"
+	auditResultRevoked          = "revoked"
+	auditResultRestored         = "restored"
+	auditResultPaused           = "paused"
+	auditResultResumed          = "resumed"
+	auditResultMappingUpdated   = "mapping_updated"
+	auditResultMappingCleared   = "mapping_cleared"
 )
 
 func (h *ProxyHandler) SlashCommand(c echo.Context) error {
@@ -29,35 +57,21 @@ func (h *ProxyHandler) SlashCommand(c echo.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to read request body")
 	}
-	if !slack.VerifySlackRequest(ctx, h.cfg.SlackSigningSecret, c.Request().Header, string(body)) {
-		return c.String(http.StatusUnauthorized, "Invalid request signature.\n")
+	if !h.verifySlackRequest(ctx, c.Request().Header, string(body)) {
+		return apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidSignature, "Invalid request signature.\n")
 	}
+	c.Set(ctxKeyCommandBody, string(body))
 
 	cmdReq, err := h.slackClient.GetFullCommandRequest(ctx, string(body))
 	if err != nil {
 		return err
 	}
-	logCommandRequest(ctx, cmdReq)
-	if !cmdReq.Supported {
-		return inChannelResponse(c, "Belldog only supports public/private channels. If this is a private channel, invite Belldog.\n")
-	}
-
-	// https://api.slack.com/interactivity/slash-commands#creating_commands
-	switch cmdReq.Command {
-	case cmdShow:
-		return h.processCmdShow(c, cmdReq)
-	case cmdGenerate:
-		return h.processCmdGenerate(c, cmdReq)
-	case cmdRegenerate:
-		return h.processCmdRegenerate(c, cmdReq)
-	case cmdRevoke:
-		return h.processCmdRevoke(c, cmdReq)
-	case cmdRevokeRenamed:
-		return h.processCmdRevokeRenamed(c, cmdReq)
-	default:
+	spec, ok := findCommand(cmdReq.Command)
+	if !ok {
 		slog.InfoContext(ctx, "missing command given", slog.String("command", cmdReq.Command))
-		return inChannelResponse(c, "Missing command.\n")
 	}
+	// https://api.slack.com/interactivity/slash-commands#creating_commands
+	return h.runCommand(spec, c, cmdReq)
 }
 
 func (h *ProxyHandler) processCmdShow(c echo.Context, cmdReq slack.SlashCommandRequest) error {
@@ -68,8 +82,8 @@ func (h *ProxyHandler) processCmdShow(c echo.Context, cmdReq slack.SlashCommandR
 	}
 	tokenURLList := make([]string, 0, len(entries))
 	for _, entry := range entries {
-		hookURL := h.buildWebhookURL(entry.Token, cmdReq.ChannelName, c.Request().Host)
-		tokenURLList = append(tokenURLList, fmt.Sprintf("- %s (v%v, %s): %s", entry.Token, entry.Version, entry.CreatedAt.Format(time.RFC3339), hookURL))
+		hookURL := h.buildWebhookURL(entry.Token, cmdReq.ChannelID, cmdReq.ChannelName, c.Request().Host)
+		tokenURLList = append(tokenURLList, fmt.Sprintf("- %s (v%v, %s, scope=%s): %s", entry.Prefix, entry.Version, entry.CreatedAt.Format(time.RFC3339), entry.Scope, hookURL))
 	}
 	listStr := strings.Join(tokenURLList, "\n")
 	var msg string
@@ -78,100 +92,654 @@ func (h *ProxyHandler) processCmdShow(c echo.Context, cmdReq slack.SlashCommandR
 	} else {
 		msg = fmt.Sprintf("Available tokens for this channel:\n%s\n", listStr)
 	}
-	return inChannelResponse(c, msg)
+	return h.tokenResponse(c, cmdReq, msg)
 }
 
+// processCmdGenerate generates a token having the scope given with `scope=` flag or as a positional argument,
+// `post` by default.
 func (h *ProxyHandler) processCmdGenerate(c echo.Context, cmdReq slack.SlashCommandRequest) error {
 	ctx := c.Request().Context()
-	res, err := h.tokenSvc.GenerateAndSaveToken(ctx, cmdReq.ChannelID, cmdReq.ChannelName)
+	scope := service.ScopePost
+	args := commandArgsOf(cmdReq)
+	if arg := cmp.Or(args.flags["scope"], args.arg(0)); arg != "" {
+		s, err := service.ParseScope(arg)
+		if err != nil {
+			return inChannelResponse(c, fmt.Sprintf("Invalid scope: %s. Available scopes: %s, %s\n", arg, service.ScopePost, service.ScopeManage))
+		}
+		scope = s
+	}
+	res, err := h.tokenSvc.GenerateAndSaveToken(ctx, cmdReq.ChannelID, cmdReq.ChannelName, scope)
 	if err != nil {
 		return err
 	}
 	if !res.IsGenerated {
+		h.recordAudit(ctx, cmdReq, auditResultAlreadyGenerated)
 		msg := fmt.Sprintf("Token already generated. To check generated token, use `%s`. To generate another token, use `%s`.\n", cmdShow, cmdRegenerate)
 		return inChannelResponse(c, msg)
 	}
+	h.recordTokenAudit(ctx, cmdReq, auditResultGenerated, res.Token)
+
+	hookURL := h.buildWebhookURL(res.Token, cmdReq.ChannelID, cmdReq.ChannelName, c.Request().Host)
+	return h.tokenResponse(c, cmdReq, fmt.Sprintf("Token generated: %s, %s (scope=%s)", res.Token.Reveal(), hookURL, scope))
+}
 
-	hookURL := h.buildWebhookURL(res.Token, cmdReq.ChannelName, c.Request().Host)
-	return inChannelResponse(c, fmt.Sprintf("Token generated: %s, %s", res.Token, hookURL))
+func validateScope(value string) error {
+	if _, err := service.ParseScope(value); err != nil {
+		return errors.Newf("available scopes: %s, %s", service.ScopePost, service.ScopeManage)
+	}
+	return nil
 }
 
 func (h *ProxyHandler) processCmdRegenerate(c echo.Context, cmdReq slack.SlashCommandRequest) error {
 	ctx := c.Request().Context()
-	res, err := h.tokenSvc.RegenerateToken(ctx, cmdReq.ChannelID, cmdReq.ChannelName)
-	if err != nil {
-		return err
-	}
-	if res.NoTokenFound {
+	maxTokenCount := h.maxTokenCount(ctx, cmdReq.ChannelID)
+	res, err := h.tokenSvc.RegenerateToken(ctx, cmdReq.ChannelID, cmdReq.ChannelName, maxTokenCount)
+	switch code, _ := h.auditFailure(ctx, cmdReq, err); {
+	case code == service.CodeNoTokenFound:
 		return inChannelResponse(c, fmt.Sprintf("No token have been generated for this channel. Use `%s` to generate token.\n", cmdGenerate))
+	case code == service.CodeTooManyToken:
+		msg := fmt.Sprintf("%d tokens have been generated for this channel, the maximum. Ensure old token is not used, then revoke it with `%s <token>` or `%s version=<version>`. Use `%s` to list the tokens.\n", maxTokenCount, cmdRevoke, cmdRevoke, cmdShow)
+		return inChannelResponse(c, msg)
+	case err != nil:
+		return err
 	}
-	if res.TooManyToken {
-		return inChannelResponse(c, fmt.Sprintf("Two tokens have been generated for this channel. Ensure old token is not used, then revoke it with `%s`.\n", cmdRevoke))
-	}
+	h.recordTokenAudit(ctx, cmdReq, auditResultGenerated, res.Token)
 
 	token := res.Token
-	hookURL := h.buildWebhookURL(token, cmdReq.ChannelName, c.Request().Host)
-	return inChannelResponse(c, fmt.Sprintf("Another token generated for this chennel: %s", hookURL))
+	hookURL := h.buildWebhookURL(token, cmdReq.ChannelID, cmdReq.ChannelName, c.Request().Host)
+	return h.tokenResponse(c, cmdReq, fmt.Sprintf("Another token generated for this chennel: %s", hookURL))
 }
 
+// processCmdRevoke revokes the token given as the argument, or the token of the version given with `version=`.
 func (h *ProxyHandler) processCmdRevoke(c echo.Context, cmdReq slack.SlashCommandRequest) error {
 	ctx := c.Request().Context()
-	res, err := h.tokenSvc.RevokeToken(ctx, cmdReq.ChannelName, cmdReq.Text)
+	args := commandArgsOf(cmdReq)
+	if _, ok := args.flags["version"]; ok == (len(args.positional) > 0) {
+		spec, _ := findCommand(cmdRevoke)
+		return usageResponse(c, spec, usageErrorf("give either the token or version"))
+	}
+	if h.cfg.RevokeConfirmation {
+		token, msg, err := h.revokeTarget(ctx, cmdReq)
+		if err != nil {
+			return err
+		}
+		if msg != "" {
+			return inChannelResponse(c, msg)
+		}
+		return confirmRevokeResponse(c, cmdReq, cmdReq.ChannelName, token)
+	}
+	msg, err := h.revoke(ctx, cmdReq)
 	if err != nil {
 		return err
 	}
-	if res.NotFound {
-		msg := fmt.Sprintf("No pair found, check the token: channel_name=%s, token=%s\n", cmdReq.ChannelName, cmdReq.Text)
-		return inChannelResponse(c, msg)
-	}
-	msg := fmt.Sprintf("Token revoked: channel_name=%s, token=%s\n", cmdReq.ChannelName, cmdReq.Text)
 	return inChannelResponse(c, msg)
 }
 
+// revokeTarget returns the token to revoke. msg is the response when no token of the given version found.
+func (h *ProxyHandler) revokeTarget(ctx context.Context, cmdReq slack.SlashCommandRequest) (token secret.Token, msg string, err error) {
+	args := commandArgsOf(cmdReq)
+	version, ok := args.flags["version"]
+	if !ok {
+		return secret.Token(args.arg(0)), "", nil
+	}
+	entries, err := h.tokenSvc.GetTokens(ctx, cmdReq.ChannelName)
+	if err != nil {
+		return "", "", err
+	}
+	for _, entry := range entries {
+		if strconv.Itoa(entry.Version) == version {
+			return entry.Token, "", nil
+		}
+	}
+	return "", fmt.Sprintf("No token found for the version: channel_name=%s, version=%s. Use `%s` to list the tokens.\n", cmdReq.ChannelName, version, cmdShow), nil
+}
+
+func validateVersion(value string) error {
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		return errors.New("version must be a non-negative number")
+	}
+	return nil
+}
+
+func (h *ProxyHandler) revoke(ctx context.Context, cmdReq slack.SlashCommandRequest) (string, error) {
+	token, msg, err := h.revokeTarget(ctx, cmdReq)
+	if err != nil || msg != "" {
+		return msg, err
+	}
+	err = h.tokenSvc.RevokeToken(ctx, cmdReq.ChannelName, token)
+	if _, ok := h.auditFailure(ctx, cmdReq, err); ok {
+		return fmt.Sprintf("No pair found, check the token: channel_name=%s, token=%s\n", cmdReq.ChannelName, token.Reveal()), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	h.recordTokenAudit(ctx, cmdReq, auditResultRevoked, token)
+	return fmt.Sprintf("Token revoked: channel_name=%s, token=%s\n", cmdReq.ChannelName, token.Prefix()) + h.restoreHint(token), nil
+}
+
+// restoreHint tells how to undo the revocation when revoked tokens are soft-deleted. Revoked tokens can be restored
+// until the grace period passes, so they are referenced by their prefixes.
+func (h *ProxyHandler) restoreHint(token secret.Token) string {
+	if h.cfg.RevokeGracePeriod <= 0 {
+		return ""
+	}
+	until := time.Now().Add(h.cfg.RevokeGracePeriod).Format(time.RFC3339)
+	return fmt.Sprintf("Revoked by mistake? Restore the token with `%s %s` in this channel until %s.\n", cmdRestore, token.Prefix(), until)
+}
+
 const slashCommandArgSize = 2
 
 func (h *ProxyHandler) processCmdRevokeRenamed(c echo.Context, cmdReq slack.SlashCommandRequest) error {
-	ctx := c.Request().Context()
-	args := strings.Fields(cmdReq.Text)
+	args := commandArgsOf(cmdReq).positional
+	// With the token index, the old channel name can be omitted.
+	if len(args) == 1 && h.cfg.DdbTokenIndexName != "" {
+		res, err := h.tokenSvc.LookupToken(c.Request().Context(), secret.Token(args[0]))
+		if errors.Is(err, service.ErrTokenNotFound) {
+			return inChannelResponse(c, fmt.Sprintf("No token found: token=%s\n", args[0]))
+		}
+		if err != nil {
+			return err
+		}
+		args = []string{res.ChannelName, args[0]}
+		// Keep the channel name for the confirmation and the audit log.
+		cmdReq.Text = strings.Join(args, " ")
+	}
 	if len(args) != slashCommandArgSize {
 		return inChannelResponse(c, "Invalid arguments for the slash command. This command expects `<channel name> <token>` as arguments.\n")
 	}
 
-	channelName, token := args[0], args[1]
-	res, err := h.tokenSvc.RevokeRenamedToken(ctx, cmdReq.ChannelID, channelName, token)
+	channelName, token := args[0], secret.Token(args[1])
+	if h.cfg.RevokeConfirmation {
+		return confirmRevokeResponse(c, cmdReq, channelName, token)
+	}
+	msg, err := h.revokeRenamed(c.Request().Context(), cmdReq, channelName, token)
 	if err != nil {
 		return err
 	}
-	if res.NotFound {
-		msg := fmt.Sprintf("No pair found, check the token: channel_name=%s, token=%s\n", channelName, token)
-		return inChannelResponse(c, msg)
+	return inChannelResponse(c, msg)
+}
+
+func (h *ProxyHandler) revokeRenamed(ctx context.Context, cmdReq slack.SlashCommandRequest, channelName string, token secret.Token) (string, error) {
+	err := h.tokenSvc.RevokeRenamedToken(ctx, cmdReq.ChannelID, channelName, token)
+	var unmatchErr *service.ChannelIDUnmatchError
+	switch _, ok := h.auditFailure(ctx, cmdReq, err); {
+	case errors.As(err, &unmatchErr):
+		return fmt.Sprintf("Found pair but this channel does not own the token: channel_name=%s, token=%s, linked_channel_id=%s, channel_id=%s\n", channelName, token.Reveal(), unmatchErr.LinkedChannelID, cmdReq.ChannelID), nil
+	case ok:
+		return fmt.Sprintf("No pair found, check the token: channel_name=%s, token=%s\n", channelName, token.Reveal()), nil
+	case err != nil:
+		return "", err
 	}
-	if res.ChannelIDUnmatch {
-		msg := fmt.Sprintf("Found pair but this channel does not own the token: channel_name=%s, token=%s, linked_channel_id=%s, channel_id=%s\n", channelName, token, res.LinkedChannelID, cmdReq.ChannelID)
-		return inChannelResponse(c, msg)
+	h.recordTokenAudit(ctx, cmdReq, auditResultRevoked, token)
+	return fmt.Sprintf("Token revoked: old_channel_name=%s, token=%s\n", channelName, token.Prefix()), nil
+}
+
+// processCmdRestore restores the token revoked in this channel within REVOKE_GRACE_PERIOD. Renamed tokens
+// are revoked in the new channel but keep the old channel name, so they can't be restored.
+func (h *ProxyHandler) processCmdRestore(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	ctx := c.Request().Context()
+	token := secret.Token(commandArgsOf(cmdReq).arg(0))
+	maxTokenCount := h.maxTokenCount(ctx, cmdReq.ChannelID)
+	restored, err := h.tokenSvc.RestoreToken(ctx, cmdReq.ChannelName, token, maxTokenCount)
+	switch code, _ := h.auditFailure(ctx, cmdReq, err); {
+	case code == service.CodeTokenNotFound:
+		return inChannelResponse(c, fmt.Sprintf("No revoked token found, check the token. Tokens can be restored within %s after revoked: channel_name=%s, token=%s\n", h.cfg.RevokeGracePeriod, cmdReq.ChannelName, token.Prefix()))
+	case code == service.CodeTooManyToken:
+		return inChannelResponse(c, fmt.Sprintf("%d tokens have been generated for this channel, the maximum. Revoke one of them with `%s` to restore the token.\n", maxTokenCount, cmdRevoke))
+	case err != nil:
+		return err
+	}
+	h.recordTokenAudit(ctx, cmdReq, auditResultRestored, restored)
+	return inChannelResponse(c, fmt.Sprintf("Token restored: channel_name=%s, token=%s\n", cmdReq.ChannelName, restored.Prefix()))
+}
+
+const mappingSubcmdClear = "clear"
+
+// processCmdMapping shows or sets the mapping rules of the token:
+//   - `/belldog-mapping <token>`: show the rules
+//   - `/belldog-mapping <token> <rule>; <rule>`: replace the rules, e.g. `text <- $.alert.description`
+//   - `/belldog-mapping <token> clear`
+func (h *ProxyHandler) processCmdMapping(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	ctx := c.Request().Context()
+	args := commandArgsOf(cmdReq)
+	arg, rules := args.arg(0), args.rest(1)
+	token := secret.Token(arg)
+	if rules == "" {
+		entries, err := h.tokenSvc.GetTokens(ctx, cmdReq.ChannelName)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(entries, func(e service.Entry) bool { return e.Token == token || e.Prefix == arg })
+		if i < 0 {
+			return inChannelResponse(c, fmt.Sprintf("No token found in this channel, check tokens with `%s`: token=%s\n", cmdShow, token.Reveal()))
+		}
+		return inChannelResponse(c, formatMappingRules(fmt.Sprintf("Mapping rules of %s:", entries[i].Prefix), entries[i].Mappings))
+	}
+	if rules == mappingSubcmdClear {
+		rules = ""
+	}
+	parsed, err := h.tokenSvc.SetMappings(ctx, cmdReq.ChannelName, token, rules)
+	switch code, _ := h.auditFailure(ctx, cmdReq, err); {
+	case code == service.CodeTokenNotFound:
+		return inChannelResponse(c, fmt.Sprintf("No token found in this channel, check tokens with `%s`: token=%s\n", cmdShow, token.Reveal()))
+	case code == service.CodeInvalidMapping:
+		return inChannelResponse(c, "Invalid mapping rules. Rules look like `text <- $.alert.description`, separated by `;`.\n")
+	case err != nil:
+		return err
+	}
+	if len(parsed) == 0 {
+		h.recordTokenAudit(ctx, cmdReq, auditResultMappingCleared, token)
+		return inChannelResponse(c, "Mapping rules cleared. Payloads are posted to Slack as is.\n")
+	}
+	h.recordTokenAudit(ctx, cmdReq, auditResultMappingUpdated, token)
+	return inChannelResponse(c, formatMappingRules("Mapping rules updated:", parsed))
+}
+
+func formatMappingRules(header string, rules []service.MappingRule) string {
+	if len(rules) == 0 {
+		return header + " none. Payloads are posted to Slack as is.\n"
+	}
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, fmt.Sprintf("- `%s`", rule))
+	}
+	return fmt.Sprintf("%s\n%s\n", header, strings.Join(lines, "\n"))
+}
+
+func (h *ProxyHandler) processCmdAudit(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	ctx := c.Request().Context()
+	if !h.auditSvc.Enabled() {
+		return inChannelResponse(c, "Audit log is not enabled for this Belldog instance.\n")
 	}
-	msg := fmt.Sprintf("Token revoked: old_channel_name=%s, token=%s\n", channelName, token)
+	entries, err := h.auditSvc.GetRecentEntries(ctx, cmdReq.ChannelID)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return inChannelResponse(c, "No audit entries found for this channel.\n")
+	}
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		line := fmt.Sprintf("- %s %s (%s) `%s`: %s, channel_name=%s", entry.Timestamp.Format(time.RFC3339), entry.UserName, entry.UserID, entry.Command, entry.Result, entry.ChannelName)
+		if entry.TokenPrefix != "" {
+			line += ", token=" + entry.TokenPrefix
+		}
+		lines = append(lines, line)
+	}
+	msg := fmt.Sprintf("Recent token operations for this channel:\n%s\n", strings.Join(lines, "\n"))
 	return inChannelResponse(c, msg)
 }
 
-func (h *ProxyHandler) buildWebhookURL(token string, channelName string, domainName string) string {
+// processCmdLookup finds the channel linked to the token, e.g. to find the owner of a leaked token.
+// The response is ephemeral not to spread the token.
+func (h *ProxyHandler) processCmdLookup(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	if h.cfg.DdbTokenIndexName == "" {
+		return ephemeralResponse(c, "Token lookup is not enabled for this Belldog instance.\n")
+	}
+	token := secret.Token(commandArgsOf(cmdReq).arg(0))
+	res, err := h.tokenSvc.LookupToken(c.Request().Context(), token)
+	if errors.Is(err, service.ErrTokenNotFound) {
+		return ephemeralResponse(c, fmt.Sprintf("No token found: token=%s\n", token.Reveal()))
+	}
+	if err != nil {
+		return err
+	}
+	return ephemeralResponse(c, fmt.Sprintf("Token found: token=%s, channel_name=%s, channel_id=%s (<#%s>)\n", token.Reveal(), res.ChannelName, res.ChannelID, res.ChannelID))
+}
+
+// processCmdTest posts a sample message through the webhook delivery path, so users can check end to end that
+// Belldog can post to this channel and the token is valid. Paused channels and digests are bypassed to post
+// immediately.
+func (h *ProxyHandler) processCmdTest(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	ctx := c.Request().Context()
+	token := secret.Token(commandArgsOf(cmdReq).arg(0))
+	if token != "" {
+		_, err := h.tokenSvc.VerifyToken(ctx, cmdReq.ChannelName, token)
+		switch code, _ := service.CodeOf(err); {
+		case code == service.CodeTokenNotFound:
+			return commandResponse(c, fmt.Sprintf("No token generated for this channel, generate token with `%s`.\n", cmdGenerate))
+		case code == service.CodeTokenUnmatch:
+			return commandResponse(c, fmt.Sprintf("Invalid token for this channel, check tokens with `%s`: token=%s\n", cmdShow, token.Reveal()))
+		case err != nil:
+			return err
+		}
+	} else {
+		entries, err := h.tokenSvc.GetTokens(ctx, cmdReq.ChannelName)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return commandResponse(c, fmt.Sprintf("No token generated for this channel, generate token with `%s`.\n", cmdGenerate))
+		}
+	}
+
+	send := h.withMentions(h.withChannelDefaults(h.slackClient.PostMessage))
+	payload := map[string]interface{}{
+		"text": fmt.Sprintf(":white_check_mark: Test message from Belldog, requested by <@%s>. Webhook messages can be delivered to this channel.", cmdReq.UserID),
+	}
+	result, err := send(ctx, cmdReq.ChannelID, cmdReq.ChannelName, payload)
+	if err != nil {
+		return err
+	}
+	if result.Type == slack.PostMessageResultAPIFailure && result.Reason == "not_in_channel" {
+		return commandResponse(c, "Failed to post the test message: Belldog is not in this channel. Invite Belldog to the channel.\n")
+	}
+	if e := handlePostMessageFailure(result); e != nil {
+		slog.InfoContext(ctx, "test message failed", slog.String("error", e.Error()))
+		return commandResponse(c, fmt.Sprintf("Failed to post the test message: %s\n", e.Error()))
+	}
+	return commandResponse(c, "Test message posted. Webhook delivery to this channel works.\n")
+}
+
+const (
+	configSubcmdSet   = "set"
+	configSubcmdUnset = "unset"
+)
+
+// processCmdConfig shows or updates per-channel default message options:
+//   - `/belldog-config`: show current defaults
+//   - `/belldog-config set <key> <value>`: values may contain spaces, e.g. username, quoted or not
+//   - `/belldog-config unset <key>`
+func (h *ProxyHandler) processCmdConfig(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	ctx := c.Request().Context()
+	if !h.channelConfigSvc.Enabled() {
+		return inChannelResponse(c, "Per-channel config is not enabled for this Belldog instance.\n")
+	}
+
+	args := commandArgsOf(cmdReq)
+	subcmd, key, value := args.arg(0), args.arg(1), args.arg(2)
+	// Unquoted values having spaces, e.g. JSON schemas, are taken as is.
+	if len(args.positional) > 3 {
+		value = args.rest(2)
+	}
+	// Token limits are a policy of the workspace, not a message option of the channel.
+	if subcmd != "" && key == service.ChannelConfigKeyMaxTokenCount && !h.isAdmin(cmdReq.UserID) {
+		return inChannelResponse(c, fmt.Sprintf("Permission denied: only users in PERMISSION_ADMIN_USER_IDS can change %s.\n", key))
+	}
+	var defaults service.ChannelDefaults
+	var err error
+	switch {
+	case subcmd == "":
+		defaults, err := h.channelConfigSvc.GetDefaults(ctx, cmdReq.ChannelID)
+		if err != nil {
+			return err
+		}
+		return inChannelResponse(c, formatChannelDefaults("Default message options for this channel:", defaults))
+	case subcmd == configSubcmdSet && key != "" && value != "":
+		defaults, err = h.channelConfigSvc.SetDefault(ctx, cmdReq.ChannelID, key, value)
+	case subcmd == configSubcmdUnset && key != "" && value == "":
+		defaults, err = h.channelConfigSvc.UnsetDefault(ctx, cmdReq.ChannelID, key)
+	default:
+		return inChannelResponse(c, fmt.Sprintf("Invalid arguments for the slash command. This command expects no arguments, `%s <key> <value>` or `%s <key>`.\n", configSubcmdSet, configSubcmdUnset))
+	}
+	switch code, _ := service.CodeOf(err); {
+	case code == service.CodeInvalidKey:
+		return inChannelResponse(c, fmt.Sprintf("Unknown key: %s. Available keys: %s\n", key, strings.Join(service.ChannelConfigKeys, ", ")))
+	case code == service.CodeInvalidValue:
+		return inChannelResponse(c, fmt.Sprintf("Invalid value for %s: %s\n", key, value))
+	case err != nil:
+		return err
+	}
+	return inChannelResponse(c, formatChannelDefaults("Default message options updated:", defaults))
+}
+
+// processCmdPause stops delivering webhook requests to the channel, e.g. during noisy incidents. Requests are
+// acknowledged with 202 and dropped until resumed.
+func (h *ProxyHandler) processCmdPause(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	ctx := c.Request().Context()
+	if !h.channelConfigSvc.Enabled() {
+		return inChannelResponse(c, "Per-channel config is not enabled for this Belldog instance.\n")
+	}
+	prev, err := h.channelConfigSvc.Pause(ctx, cmdReq.ChannelID, cmdReq.UserID)
+	if err != nil {
+		return err
+	}
+	if prev.Paused {
+		msg := fmt.Sprintf("Webhook requests to this channel have already been paused by <@%s> at %s. Use `%s` to resume.\n", prev.UserID, prev.PausedAt.Format(time.RFC3339), cmdResume)
+		return inChannelResponse(c, msg)
+	}
+	h.recordAudit(ctx, cmdReq, auditResultPaused)
+	return inChannelResponse(c, fmt.Sprintf("Webhook requests to this channel are paused. Messages are dropped until resumed with `%s`.\n", cmdResume))
+}
+
+func (h *ProxyHandler) processCmdResume(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	ctx := c.Request().Context()
+	if !h.channelConfigSvc.Enabled() {
+		return inChannelResponse(c, "Per-channel config is not enabled for this Belldog instance.\n")
+	}
+	prev, err := h.channelConfigSvc.Resume(ctx, cmdReq.ChannelID)
+	if err != nil {
+		return err
+	}
+	if !prev.Paused {
+		return inChannelResponse(c, "Webhook requests to this channel are not paused.\n")
+	}
+	h.recordAudit(ctx, cmdReq, auditResultResumed)
+	return inChannelResponse(c, "Webhook requests to this channel are resumed.\n")
+}
+
+const (
+	broadcastSubcmdCreate = "create"
+	broadcastSubcmdDelete = "delete"
+	broadcastSubcmdAdd    = "add"
+	broadcastSubcmdRemove = "remove"
+	broadcastSubcmdShow   = "show"
+)
+
+// processCmdBroadcast manages broadcast groups. Members are added and removed from the member channel itself,
+// so only members of the channel can link it to a group. Only the user who created the group and admins can change,
+// show or delete it, because the group URL posts to every member channel. Membership grants no management rights:
+//   - `/belldog-broadcast create <group>`: create a group and show its URL
+//   - `/belldog-broadcast add <group>`, `/belldog-broadcast remove <group>`: add or remove this channel
+//   - `/belldog-broadcast show <group>`: show the URL and members
+//   - `/belldog-broadcast delete <group>`
+func (h *ProxyHandler) processCmdBroadcast(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	ctx := c.Request().Context()
+	if !h.broadcastSvc.Enabled() {
+		return inChannelResponse(c, "Broadcast groups are not enabled for this Belldog instance.\n")
+	}
+	// The number of arguments is validated by validateArgs.
+	args := commandArgsOf(cmdReq)
+	subcmd, groupName := args.arg(0), args.arg(1)
+
+	var (
+		group service.BroadcastGroup
+		err   error
+	)
+	switch subcmd {
+	case broadcastSubcmdCreate:
+		group, err = h.broadcastSvc.CreateGroup(ctx, groupName, cmdReq.UserID)
+	case broadcastSubcmdDelete, broadcastSubcmdShow, broadcastSubcmdAdd, broadcastSubcmdRemove:
+		group, err = h.broadcastSvc.GetGroup(ctx, groupName)
+		if err == nil && !h.canManageBroadcastGroup(group, cmdReq) {
+			return inChannelResponse(c, fmt.Sprintf("Broadcast group %s can be managed only by the user who created it or Belldog admins.\n", groupName))
+		}
+		if err != nil {
+			break
+		}
+		switch subcmd {
+		case broadcastSubcmdDelete:
+			err = h.broadcastSvc.DeleteGroup(ctx, groupName)
+		case broadcastSubcmdAdd:
+			group, err = h.broadcastSvc.AddMember(ctx, groupName, cmdReq.ChannelID, cmdReq.ChannelName)
+		case broadcastSubcmdRemove:
+			group, err = h.broadcastSvc.RemoveMember(ctx, groupName, cmdReq.ChannelID)
+		}
+	default:
+		return inChannelResponse(c, fmt.Sprintf("Unknown subcommand: %s. Available subcommands: create, delete, add, remove, show\n", subcmd))
+	}
+	switch code, _ := service.CodeOf(err); {
+	case code == service.CodeGroupNotFound:
+		return inChannelResponse(c, fmt.Sprintf("No broadcast group found: %s. Create one with `%s %s %s`.\n", groupName, cmdBroadcast, broadcastSubcmdCreate, groupName))
+	case code == service.CodeGroupAlreadyExists:
+		return inChannelResponse(c, fmt.Sprintf("Broadcast group already exists: %s\n", groupName))
+	case code == service.CodeInvalidGroupName:
+		return inChannelResponse(c, "Invalid group name. Use up to 80 lowercase letters, numbers, hyphens and underscores.\n")
+	case code == service.CodeTooManyMembers:
+		return inChannelResponse(c, fmt.Sprintf("Too many members in broadcast group: %s\n", groupName))
+	case err != nil:
+		return err
+	}
+
+	hookURL := h.buildBroadcastURL(groupName, group.Token, c.Request().Host)
+	switch subcmd {
+	case broadcastSubcmdCreate:
+		h.recordTokenAudit(ctx, cmdReq, auditResultGenerated, group.Token)
+		msg := fmt.Sprintf("Broadcast group created: %s. Add channels with `%s %s %s` in each channel.\n", hookURL, cmdBroadcast, broadcastSubcmdAdd, groupName)
+		return h.tokenResponse(c, cmdReq, msg)
+	case broadcastSubcmdDelete:
+		slog.InfoContext(ctx, "broadcast group deleted",
+			slog.String("group_name", groupName),
+			slog.String("created_by", group.CreatedBy),
+			slog.String("deleted_by", cmdReq.UserID),
+		)
+		h.recordTokenAudit(ctx, cmdReq, auditResultRevoked, group.Token)
+		return inChannelResponse(c, fmt.Sprintf("Broadcast group deleted: %s\n", groupName))
+	case broadcastSubcmdAdd:
+		return inChannelResponse(c, fmt.Sprintf("This channel is added to broadcast group %s.\n", groupName))
+	case broadcastSubcmdRemove:
+		return inChannelResponse(c, fmt.Sprintf("This channel is removed from broadcast group %s.\n", groupName))
+	default:
+		return h.tokenResponse(c, cmdReq, formatBroadcastGroup(group, hookURL))
+	}
+}
+
+// canManageBroadcastGroup reports whether the user created the group or is in PERMISSION_ADMIN_USER_IDS.
+func (h *ProxyHandler) canManageBroadcastGroup(group service.BroadcastGroup, cmdReq slack.SlashCommandRequest) bool {
+	return group.CreatedBy == cmdReq.UserID || h.isAdmin(cmdReq.UserID)
+}
+
+func formatBroadcastGroup(group service.BroadcastGroup, hookURL string) string {
+	if len(group.Members) == 0 {
+		return fmt.Sprintf("Broadcast group %s: %s\nNo member channels.\n", group.Name, hookURL)
+	}
+	lines := make([]string, 0, len(group.Members))
+	for _, m := range group.Members {
+		lines = append(lines, fmt.Sprintf("- <#%s> (%s)", m.ChannelID, m.ChannelName))
+	}
+	return fmt.Sprintf("Broadcast group %s: %s\nMember channels:\n%s\n", group.Name, hookURL, strings.Join(lines, "\n"))
+}
+
+func formatChannelDefaults(header string, defaults service.ChannelDefaults) string {
+	values := defaults.Values()
+	if len(values) == 0 {
+		return fmt.Sprintf("%s none\n", header)
+	}
+	lines := make([]string, 0, len(values))
+	// Keep the key order stable.
+	for _, key := range service.ChannelConfigKeys {
+		if v, ok := values[key]; ok {
+			lines = append(lines, fmt.Sprintf("- %s: %s", key, v))
+		}
+	}
+	return fmt.Sprintf("%s\n%s\n", header, strings.Join(lines, "\n"))
+}
+
+// maxTokenCount returns max_token_count of the channel config, or MAX_TOKEN_COUNT. When the channel config can't be
+// read, it falls back to MAX_TOKEN_COUNT, the limit every channel had before overrides existed.
+func (h *ProxyHandler) maxTokenCount(ctx context.Context, channelID string) int {
+	defaults, err := h.channelConfigSvc.GetDefaults(ctx, channelID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to get channel config, use MAX_TOKEN_COUNT", slog.String("error", err.Error()))
+	}
+	if defaults.MaxTokenCount > 0 {
+		return defaults.MaxTokenCount
+	}
+	return max(h.cfg.MaxTokenCount, 1)
+}
+
+// auditFailure records the audit entry when err is an expected failure of the service, and returns its code.
+// ok is false for nil and unexpected errors.
+func (h *ProxyHandler) auditFailure(ctx context.Context, cmdReq slack.SlashCommandRequest, err error) (code service.Code, ok bool) {
+	code, ok = service.CodeOf(err)
+	if ok {
+		h.recordAudit(ctx, cmdReq, string(code))
+	}
+	return code, ok
+}
+
+// recordAudit doesn't fail the command: the token operation itself has already completed.
+func (h *ProxyHandler) recordAudit(ctx context.Context, cmdReq slack.SlashCommandRequest, result string) {
+	h.recordTokenAudit(ctx, cmdReq, result, "")
+}
+
+// recordTokenAudit records the audit entry with the prefix of the operated token. Tokens are never recorded.
+func (h *ProxyHandler) recordTokenAudit(ctx context.Context, cmdReq slack.SlashCommandRequest, result string, token secret.Token) {
+	entry := service.AuditEntry{
+		ChannelID:   cmdReq.ChannelID,
+		ChannelName: cmdReq.ChannelName,
+		UserID:      cmdReq.UserID,
+		UserName:    cmdReq.UserName,
+		Command:     cmdReq.Command,
+		Result:      result,
+	}
+	if token != "" {
+		entry.TokenPrefix = token.Prefix()
+	}
+	if err := h.auditSvc.Record(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "failed to record audit entry",
+			slog.String("error", fmt.Sprintf("%+v", err)),
+			slog.String("command", cmdReq.Command),
+			slog.String("result", result),
+		)
+	}
+	if evtType, ok := lifecycleEventTypes[result]; ok {
+		h.maintainer.publishLifecycle(ctx, service.LifecycleEvent{
+			Type:        evtType,
+			ChannelID:   cmdReq.ChannelID,
+			ChannelName: cmdReq.ChannelName,
+			TokenPrefix: entry.TokenPrefix,
+			UserID:      cmdReq.UserID,
+			Reason:      service.LifecycleReasonCommand,
+		})
+	}
+}
+
+// Audit results published as lifecycle events.
+var lifecycleEventTypes = map[string]string{
+	auditResultGenerated: service.LifecycleTokenGenerated,
+	auditResultRevoked:   service.LifecycleTokenRevoked,
+}
+
+// Build channel ID based URLs when the channel ID index is configured, so URLs survive channel renames.
+func (h *ProxyHandler) buildWebhookURL(token secret.Token, channelID string, channelName string, domainName string) string {
 	if h.cfg.CustomDomainName != "" {
 		domainName = h.cfg.CustomDomainName
 	}
-	return fmt.Sprintf("https://%s/p/%s/%s/", domainName, channelName, token)
+	if h.cfg.DdbChannelIDIndexName != "" {
+		return fmt.Sprintf("https://%s/c/%s/%s/", domainName, channelID, token.Reveal())
+	}
+	return fmt.Sprintf("https://%s/p/%s/%s/", domainName, channelName, token.Reveal())
 }
 
 func logCommandRequest(ctx context.Context, cmdReq slack.SlashCommandRequest) {
 	slog.InfoContext(ctx, "command given",
 		slog.String("command", cmdReq.Command),
-		slog.String("channel_id", cmdReq.ChannelID),
-		slog.String("channel_name", cmdReq.ChannelName),
 		slog.String("original_channel_name", cmdReq.OriginalChannelName),
-		slog.String("text", cmdReq.Text),
+		slog.String("text", secret.MaskTokens(cmdReq.Text)),
+		slog.String("user_id", cmdReq.UserID),
 		slog.Bool("supported", cmdReq.Supported),
 	)
 }
 
+func (h *ProxyHandler) buildBroadcastURL(groupName string, token secret.Token, domainName string) string {
+	if h.cfg.CustomDomainName != "" {
+		domainName = h.cfg.CustomDomainName
+	}
+	return fmt.Sprintf("https://%s/b/%s/%s/", domainName, groupName, token.Reveal())
+}
+
+const publicFlag = "--public"
+
+// tokenResponse responds with messages revealing tokens. The response is ephemeral by default so tokens
+// don't remain in the channel history. Users can override it with `--public` argument.
+func (h *ProxyHandler) tokenResponse(c echo.Context, cmdReq slack.SlashCommandRequest, msg string) error {
+	if !h.cfg.TokenResponseEphemeral || commandArgsOf(cmdReq).public {
+		return inChannelResponse(c, msg)
+	}
+	return ephemeralResponse(c, msg)
+}
+
 // Marshal to json to use "in_channel" type response: https://api.slack.com/interactivity/slash-commands
 func inChannelResponse(c echo.Context, msg string) error {
 	payload := map[string]string{
@@ -180,3 +748,12 @@ func inChannelResponse(c echo.Context, msg string) error {
 	}
 	return c.JSON(http.StatusOK, payload)
 }
+
+// Only the user who invoked the command can see "ephemeral" type response.
+func ephemeralResponse(c echo.Context, msg string) error {
+	payload := map[string]string{
+		"text":          msg,
+		"response_type": "ephemeral",
+	}
+	return c.JSON(http.StatusOK, payload)
+}
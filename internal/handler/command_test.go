@@ -0,0 +1,885 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// Token having a prefix, to test responses referencing tokens by their prefixes.
+const testPrefixedToken = "bd_ab12_0123456789abcdef0123456789abcdef"
+
+var defaultCmdReq = slack.SlashCommandRequest{
+	OriginalSlashCommandRequest: slack.OriginalSlashCommandRequest{
+		ChannelID:           "C123456",
+		OriginalChannelName: "test",
+		UserID:              "U123456",
+		UserName:            "alice",
+	},
+	ChannelName: "test",
+	Supported:   true,
+}
+
+func setupCommandContext() (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, "/slash", nil)
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func decodeCommandResponse(t *testing.T, rec *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestCmdGenerateRecordsAudit(t *testing.T) {
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	svc.On("GenerateAndSaveToken", mock.Anything, "C123456", "test", service.ScopePost).Return(service.GenerateResult{IsGenerated: true, Token: "bd_ab12_deadbeef"}, nil)
+	auditSvc.On("Record", mock.Anything, service.AuditEntry{
+		ChannelID:   "C123456",
+		ChannelName: "test",
+		UserID:      "U123456",
+		UserName:    "alice",
+		Command:     cmdGenerate,
+		Result:      auditResultGenerated,
+		TokenPrefix: "bd_ab12",
+	}).Return(nil)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{},
+		tokenSvc: svc,
+		auditSvc: auditSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdGenerate
+	c, rec := setupCommandContext()
+	err := h.processCmdGenerate(c, cmdReq)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	auditSvc.AssertExpectations(t)
+}
+
+func TestCmdRevokePublishesLifecycleEvent(t *testing.T) {
+	svc := &mockTokenService{}
+	lifecycleSvc := &mockLifecycleService{}
+	auditSvc := &mockAuditService{}
+	svc.On("RevokeToken", mock.Anything, "test", "bd_ab12_deadbeef").Return(nil)
+	auditSvc.On("Record", mock.Anything, mock.Anything).Return(nil)
+	lifecycleSvc.On("Publish", mock.Anything, service.LifecycleEvent{
+		Type:        service.LifecycleTokenRevoked,
+		ChannelID:   "C123456",
+		ChannelName: "test",
+		TokenPrefix: "bd_ab12",
+		UserID:      "U123456",
+		Reason:      service.LifecycleReasonCommand,
+	}).Return(errors.New("event bus not found"))
+
+	h := ProxyHandler{
+		cfg:        appconfig.Config{},
+		tokenSvc:   svc,
+		auditSvc:   auditSvc,
+		maintainer: newRecordMaintainer(appconfig.Config{}, nil, nil, nil, nil, nil, lifecycleSvc),
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRevoke
+	cmdReq.Text = "bd_ab12_deadbeef"
+	c, rec := setupCommandContext()
+	err := h.processCmdRevoke(c, cmdReq)
+
+	// Failing to publish doesn't fail the command.
+	require.NoError(t, err)
+	assert.Contains(t, decodeCommandResponse(t, rec)["text"], "Token revoked")
+	lifecycleSvc.AssertExpectations(t)
+}
+
+func TestCmdAudit(t *testing.T) {
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Enabled").Return(true)
+	auditSvc.On("GetRecentEntries", mock.Anything, "C123456").Return([]service.AuditEntry{
+		{
+			ChannelID:   "C123456",
+			ChannelName: "test",
+			UserID:      "U123456",
+			UserName:    "alice",
+			Command:     cmdRevoke,
+			Result:      auditResultRevoked,
+			TokenPrefix: "bd_ab12",
+			Timestamp:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{},
+		auditSvc: auditSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdAudit
+	c, rec := setupCommandContext()
+	err := h.processCmdAudit(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "2024-01-02T03:04:05Z alice (U123456) `/belldog-revoke`: revoked, channel_name=test, token=bd_ab12")
+}
+
+func TestCmdAuditDisabled(t *testing.T) {
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Enabled").Return(false)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{},
+		auditSvc: auditSvc,
+	}
+	c, rec := setupCommandContext()
+	err := h.processCmdAudit(c, defaultCmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "not enabled")
+	auditSvc.AssertNotCalled(t, "GetRecentEntries", mock.Anything, mock.Anything)
+}
+
+func TestCmdShowResponseType(t *testing.T) {
+	cases := []struct {
+		name      string
+		ephemeral bool
+		text      string
+		expected  string
+	}{
+		{name: "ephemeral by default", ephemeral: true, text: "", expected: "ephemeral"},
+		{name: "public flag", ephemeral: true, text: "--public", expected: "in_channel"},
+		{name: "config disabled", ephemeral: false, text: "", expected: "in_channel"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &mockTokenService{}
+			svc.On("GetTokens", mock.Anything, "test").Return([]service.Entry{
+				{Token: "deadbeef", Version: 0, CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			}, nil)
+			h := ProxyHandler{
+				cfg:      appconfig.Config{TokenResponseEphemeral: tc.ephemeral},
+				tokenSvc: svc,
+			}
+			cmdReq := defaultCmdReq
+			cmdReq.Command = cmdShow
+			cmdReq.Text = tc.text
+			c, rec := setupCommandContext()
+			err := h.processCmdShow(c, cmdReq)
+
+			require.NoError(t, err)
+			resp := decodeCommandResponse(t, rec)
+			assert.Equal(t, tc.expected, resp["response_type"])
+			assert.Contains(t, resp["text"], "deadbeef")
+		})
+	}
+}
+
+func TestCmdConfigSet(t *testing.T) {
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("Enabled").Return(true)
+	configSvc.On("SetDefault", mock.Anything, "C123456", "username", "CI Bot").Return(service.ChannelDefaults{Username: "CI Bot", IconEmoji: ":robot_face:"}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		channelConfigSvc: configSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdConfig
+	cmdReq.Text = "set username CI Bot"
+	c, rec := setupCommandContext()
+	err := h.processCmdConfig(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Default message options updated:\n- icon_emoji: :robot_face:\n- username: CI Bot\n", resp["text"])
+	configSvc.AssertExpectations(t)
+}
+
+func TestCmdConfigInvalidKey(t *testing.T) {
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("Enabled").Return(true)
+	configSvc.On("UnsetDefault", mock.Anything, "C123456", "channel").Return(service.ChannelDefaults{}, service.ErrInvalidConfigKey)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		channelConfigSvc: configSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdConfig
+	cmdReq.Text = "unset channel"
+	c, rec := setupCommandContext()
+	err := h.processCmdConfig(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "Unknown key: channel")
+}
+
+func TestCmdConfigInvalidArguments(t *testing.T) {
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("Enabled").Return(true)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		channelConfigSvc: configSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdConfig
+	cmdReq.Text = "set icon_emoji"
+	c, rec := setupCommandContext()
+	err := h.processCmdConfig(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "Invalid arguments")
+	configSvc.AssertNotCalled(t, "SetDefault", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCmdPause(t *testing.T) {
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("Enabled").Return(true)
+	configSvc.On("Pause", mock.Anything, "C123456", "U123456").Return(service.PauseState{}, nil)
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.Command == cmdPause && entry.Result == auditResultPaused
+	})).Return(nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		auditSvc:         auditSvc,
+		channelConfigSvc: configSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdPause
+	c, rec := setupCommandContext()
+	err := h.processCmdPause(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "Webhook requests to this channel are paused.")
+	auditSvc.AssertExpectations(t)
+}
+
+func TestCmdPauseAlreadyPaused(t *testing.T) {
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("Enabled").Return(true)
+	pausedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	configSvc.On("Pause", mock.Anything, "C123456", "U123456").Return(service.PauseState{Paused: true, UserID: "U999999", PausedAt: pausedAt}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		channelConfigSvc: configSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdPause
+	c, rec := setupCommandContext()
+	err := h.processCmdPause(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "already been paused by <@U999999> at 2024-01-02T03:04:05Z")
+}
+
+func TestCmdResumeNotPaused(t *testing.T) {
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("Enabled").Return(true)
+	configSvc.On("Resume", mock.Anything, "C123456").Return(service.PauseState{}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		channelConfigSvc: configSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdResume
+	c, rec := setupCommandContext()
+	err := h.processCmdResume(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Webhook requests to this channel are not paused.\n", resp["text"])
+}
+
+func TestBuildWebhookURL(t *testing.T) {
+	h := ProxyHandler{cfg: appconfig.Config{CustomDomainName: "belldog.example.com"}}
+	assert.Equal(t, "https://belldog.example.com/p/test/deadbeef/", h.buildWebhookURL("deadbeef", "C123456", "test", "localhost"))
+
+	h.cfg.DdbChannelIDIndexName = "channel_id-index"
+	assert.Equal(t, "https://belldog.example.com/c/C123456/deadbeef/", h.buildWebhookURL("deadbeef", "C123456", "test", "localhost"))
+}
+
+func TestCmdLookup(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("LookupToken", mock.Anything, "deadbeef").Return(service.LookupResult{ChannelID: "C999999", ChannelName: "leaked"}, nil)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{DdbTokenIndexName: "token-index"},
+		tokenSvc: svc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdLookup
+	cmdReq.Text = "deadbeef"
+	c, rec := setupCommandContext()
+	err := h.processCmdLookup(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "ephemeral", resp["response_type"])
+	assert.Contains(t, resp["text"], "channel_name=leaked, channel_id=C999999")
+}
+
+func TestCmdRevokeRenamedWithTokenOnly(t *testing.T) {
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	svc.On("LookupToken", mock.Anything, testPrefixedToken).Return(service.LookupResult{ChannelID: "C123456", ChannelName: "old-name"}, nil)
+	svc.On("RevokeRenamedToken", mock.Anything, "C123456", "old-name", testPrefixedToken).Return(nil)
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.Result == auditResultRevoked
+	})).Return(nil)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{DdbTokenIndexName: "token-index"},
+		tokenSvc: svc,
+		auditSvc: auditSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRevokeRenamed
+	cmdReq.Text = testPrefixedToken
+	c, rec := setupCommandContext()
+	err := h.processCmdRevokeRenamed(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Token revoked: old_channel_name=old-name, token=bd_ab12\n", resp["text"])
+	svc.AssertExpectations(t)
+}
+
+func TestCmdRevokeRenamedChannelIDUnmatch(t *testing.T) {
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	svc.On("RevokeRenamedToken", mock.Anything, "C123456", "old-name", "deadbeef").Return(&service.ChannelIDUnmatchError{LinkedChannelID: "C999999"})
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.Result == string(service.CodeChannelIDUnmatch)
+	})).Return(nil)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{},
+		tokenSvc: svc,
+		auditSvc: auditSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRevokeRenamed
+	cmdReq.Text = "old-name deadbeef"
+	c, rec := setupCommandContext()
+	err := h.processCmdRevokeRenamed(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "linked_channel_id=C999999")
+	auditSvc.AssertExpectations(t)
+}
+
+func TestCmdRestore(t *testing.T) {
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	svc.On("RestoreToken", mock.Anything, "test", "bd_ab12", 2).Return(testPrefixedToken, nil)
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.Command == cmdRestore && entry.Result == auditResultRestored && entry.TokenPrefix == "bd_ab12"
+	})).Return(nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{MaxTokenCount: 2, RevokeGracePeriod: 24 * time.Hour},
+		tokenSvc:         svc,
+		auditSvc:         auditSvc,
+		channelConfigSvc: disabledChannelConfigService(),
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRestore
+	cmdReq.Text = "bd_ab12"
+	c, rec := setupCommandContext()
+	err := h.processCmdRestore(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Token restored: channel_name=test, token=bd_ab12\n", resp["text"])
+	auditSvc.AssertExpectations(t)
+}
+
+func TestCmdRestoreNotFound(t *testing.T) {
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	svc.On("RestoreToken", mock.Anything, "test", testPrefixedToken, 2).Return("", service.ErrTokenNotFound)
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.Result == string(service.CodeTokenNotFound)
+	})).Return(nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{MaxTokenCount: 2, RevokeGracePeriod: 24 * time.Hour},
+		tokenSvc:         svc,
+		auditSvc:         auditSvc,
+		channelConfigSvc: disabledChannelConfigService(),
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRestore
+	cmdReq.Text = testPrefixedToken
+	c, rec := setupCommandContext()
+	err := h.processCmdRestore(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "No revoked token found, check the token. Tokens can be restored within 24h0m0s after revoked")
+	assert.NotContains(t, resp["text"], "0123456789abcdef")
+}
+
+func TestCmdRegenerateTooManyWithChannelMaxTokenCount(t *testing.T) {
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("GetDefaults", mock.Anything, "C123456").Return(service.ChannelDefaults{MaxTokenCount: 3}, nil)
+	svc.On("RegenerateToken", mock.Anything, "C123456", "test", 3).Return(service.RegenerateResult{}, service.ErrTooManyToken)
+	auditSvc.On("Record", mock.Anything, mock.Anything).Return(nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{MaxTokenCount: 2},
+		tokenSvc:         svc,
+		auditSvc:         auditSvc,
+		channelConfigSvc: configSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRegenerate
+	c, rec := setupCommandContext()
+	err := h.processCmdRegenerate(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "3 tokens have been generated for this channel, the maximum.")
+	assert.Contains(t, resp["text"], "`/belldog-revoke version=<version>`")
+	svc.AssertExpectations(t)
+}
+
+func TestCmdRevokeByVersion(t *testing.T) {
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	svc.On("GetTokens", mock.Anything, "test").Return([]service.Entry{
+		{Token: "deadbeef", Version: 0},
+		{Token: testPrefixedToken, Version: 1},
+	}, nil)
+	svc.On("RevokeToken", mock.Anything, "test", testPrefixedToken).Return(nil)
+	auditSvc.On("Record", mock.Anything, mock.Anything).Return(nil)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{},
+		tokenSvc: svc,
+		auditSvc: auditSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRevoke
+	cmdReq.Text = "version=1"
+	c, rec := setupCommandContext()
+	err := h.processCmdRevoke(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Token revoked: channel_name=test, token=bd_ab12\n", resp["text"])
+	svc.AssertExpectations(t)
+}
+
+func TestCmdRevokeByUnknownVersion(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("GetTokens", mock.Anything, "test").Return([]service.Entry{{Token: "deadbeef", Version: 0}}, nil)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{RevokeConfirmation: true},
+		tokenSvc: svc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRevoke
+	cmdReq.Text = "version=3"
+	c, rec := setupCommandContext()
+	err := h.processCmdRevoke(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "No token found for the version: channel_name=test, version=3.")
+	svc.AssertNotCalled(t, "RevokeToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCmdRevokeWithTokenAndVersion(t *testing.T) {
+	h := ProxyHandler{
+		cfg:      appconfig.Config{},
+		tokenSvc: &mockTokenService{},
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRevoke
+	cmdReq.Text = "deadbeef version=0"
+	c, rec := setupCommandContext()
+	err := h.processCmdRevoke(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "Invalid arguments for the slash command: give either the token or version.")
+}
+
+func TestCmdConfigMaxTokenCountRequiresAdmin(t *testing.T) {
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("Enabled").Return(true)
+	configSvc.On("SetDefault", mock.Anything, "C123456", "max_token_count", "3").Return(service.ChannelDefaults{MaxTokenCount: 3}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		channelConfigSvc: configSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdConfig
+	cmdReq.Text = "set max_token_count 3"
+	c, rec := setupCommandContext()
+	err := h.processCmdConfig(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Permission denied: only users in PERMISSION_ADMIN_USER_IDS can change max_token_count.\n", resp["text"])
+	configSvc.AssertNotCalled(t, "SetDefault", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	h.cfg.PermissionAdminUserIDs = []string{"U123456"}
+	c, rec = setupCommandContext()
+	err = h.processCmdConfig(c, cmdReq)
+
+	require.NoError(t, err)
+	resp = decodeCommandResponse(t, rec)
+	assert.Equal(t, "Default message options updated:\n- max_token_count: 3\n", resp["text"])
+}
+
+func TestCmdBroadcastCreate(t *testing.T) {
+	broadcastSvc := &mockBroadcastService{}
+	broadcastSvc.On("Enabled").Return(true)
+	broadcastSvc.On("CreateGroup", mock.Anything, "deploys", "U123456").Return(service.BroadcastGroup{Name: "deploys", Token: "deadbeef"}, nil)
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.Command == cmdBroadcast && entry.Result == auditResultGenerated
+	})).Return(nil)
+
+	h := ProxyHandler{
+		cfg:          appconfig.Config{TokenResponseEphemeral: true, CustomDomainName: "belldog.example.com"},
+		auditSvc:     auditSvc,
+		broadcastSvc: broadcastSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdBroadcast
+	cmdReq.Text = "create deploys"
+	c, rec := setupCommandContext()
+	err := h.processCmdBroadcast(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "ephemeral", resp["response_type"])
+	assert.Contains(t, resp["text"], "https://belldog.example.com/b/deploys/deadbeef/")
+	auditSvc.AssertExpectations(t)
+}
+
+func TestCmdBroadcastAddGroupNotFound(t *testing.T) {
+	broadcastSvc := &mockBroadcastService{}
+	broadcastSvc.On("Enabled").Return(true)
+	broadcastSvc.On("GetGroup", mock.Anything, "deploys").Return(service.BroadcastGroup{}, service.ErrGroupNotFound)
+
+	h := ProxyHandler{
+		cfg:          appconfig.Config{},
+		broadcastSvc: broadcastSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdBroadcast
+	cmdReq.Text = "add deploys"
+	c, rec := setupCommandContext()
+	err := h.processCmdBroadcast(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "No broadcast group found: deploys.")
+}
+
+func TestCmdBroadcastRejectsNonCreators(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []service.BroadcastMember
+	}{
+		{name: "non-member channel"},
+		// Adding the channel to the group doesn't grant management rights.
+		{name: "member channel", members: []service.BroadcastMember{{ChannelID: "C123456", ChannelName: "test"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broadcastSvc := &mockBroadcastService{}
+			broadcastSvc.On("Enabled").Return(true)
+			broadcastSvc.On("GetGroup", mock.Anything, "deploys").Return(service.BroadcastGroup{
+				Name:      "deploys",
+				Token:     "deadbeef",
+				CreatedBy: "U999999",
+				Members:   tt.members,
+			}, nil)
+
+			h := ProxyHandler{
+				cfg:          appconfig.Config{},
+				broadcastSvc: broadcastSvc,
+			}
+			for _, text := range []string{"add deploys", "remove deploys", "show deploys", "delete deploys"} {
+				cmdReq := defaultCmdReq
+				cmdReq.Command = cmdBroadcast
+				cmdReq.Text = text
+				c, rec := setupCommandContext()
+				err := h.processCmdBroadcast(c, cmdReq)
+
+				require.NoError(t, err)
+				resp := decodeCommandResponse(t, rec)
+				assert.Equal(t, "Broadcast group deploys can be managed only by the user who created it or Belldog admins.\n", resp["text"], text)
+				assert.NotContains(t, resp["text"], "deadbeef", text)
+			}
+			broadcastSvc.AssertNotCalled(t, "AddMember", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			broadcastSvc.AssertNotCalled(t, "RemoveMember", mock.Anything, mock.Anything, mock.Anything)
+			broadcastSvc.AssertNotCalled(t, "DeleteGroup", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestCmdBroadcastDeleteByCreator(t *testing.T) {
+	broadcastSvc := &mockBroadcastService{}
+	broadcastSvc.On("Enabled").Return(true)
+	broadcastSvc.On("GetGroup", mock.Anything, "deploys").Return(service.BroadcastGroup{
+		Name:      "deploys",
+		Token:     "deadbeef",
+		CreatedBy: "U123456",
+	}, nil)
+	broadcastSvc.On("DeleteGroup", mock.Anything, "deploys").Return(nil)
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.Command == cmdBroadcast && entry.Result == auditResultRevoked && entry.UserID == "U123456" && entry.TokenPrefix != ""
+	})).Return(nil)
+
+	h := ProxyHandler{
+		cfg:          appconfig.Config{},
+		auditSvc:     auditSvc,
+		broadcastSvc: broadcastSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdBroadcast
+	cmdReq.Text = "delete deploys"
+	c, rec := setupCommandContext()
+	err := h.processCmdBroadcast(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Broadcast group deleted: deploys\n", resp["text"])
+	broadcastSvc.AssertExpectations(t)
+	auditSvc.AssertExpectations(t)
+}
+
+func TestCmdBroadcastAddByAdmin(t *testing.T) {
+	group := service.BroadcastGroup{Name: "deploys", Token: "deadbeef", CreatedBy: "U999999"}
+	broadcastSvc := &mockBroadcastService{}
+	broadcastSvc.On("Enabled").Return(true)
+	broadcastSvc.On("GetGroup", mock.Anything, "deploys").Return(group, nil)
+	broadcastSvc.On("AddMember", mock.Anything, "deploys", "C123456", "test").Return(group, nil)
+
+	h := ProxyHandler{
+		cfg:          appconfig.Config{PermissionAdminUserIDs: []string{"U123456"}},
+		broadcastSvc: broadcastSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdBroadcast
+	cmdReq.Text = "add deploys"
+	c, rec := setupCommandContext()
+	err := h.processCmdBroadcast(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "This channel is added to broadcast group deploys.\n", resp["text"])
+	broadcastSvc.AssertExpectations(t)
+}
+
+func TestCmdGenerateWithScope(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("GenerateAndSaveToken", mock.Anything, "C123456", "test", service.ScopeManage).Return(service.GenerateResult{IsGenerated: true, Token: "deadbeef"}, nil)
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Record", mock.Anything, mock.Anything).Return(nil)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{},
+		tokenSvc: svc,
+		auditSvc: auditSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdGenerate
+	cmdReq.Text = "manage --public"
+	c, rec := setupCommandContext()
+	err := h.processCmdGenerate(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "scope=manage")
+	svc.AssertExpectations(t)
+}
+
+func TestCmdGenerateWithScopeFlag(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("GenerateAndSaveToken", mock.Anything, "C123456", "test", service.ScopeManage).Return(service.GenerateResult{IsGenerated: true, Token: "deadbeef"}, nil)
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Record", mock.Anything, mock.Anything).Return(nil)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{},
+		tokenSvc: svc,
+		auditSvc: auditSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdGenerate
+	cmdReq.Text = "scope=manage"
+	c, rec := setupCommandContext()
+	err := h.processCmdGenerate(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "scope=manage")
+	svc.AssertExpectations(t)
+}
+
+func TestCmdTest(t *testing.T) {
+	svc := &mockTokenService{}
+	slackClient := &mockSlackClient{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	slackClient.On("PostMessage", mock.Anything, defaultCmdReq.ChannelID, "test", mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		return strings.Contains(text, "Test message from Belldog")
+	})).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK}, nil)
+
+	h := ProxyHandler{
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdTest
+	cmdReq.Text = "deadbeef"
+	c, rec := setupCommandContext()
+	err := h.processCmdTest(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Test message posted. Webhook delivery to this channel works.\n", resp["text"])
+	slackClient.AssertExpectations(t)
+}
+
+func TestCmdTestNotInChannel(t *testing.T) {
+	svc := &mockTokenService{}
+	slackClient := &mockSlackClient{}
+	svc.On("GetTokens", mock.Anything, "test").Return([]service.Entry{{Token: "deadbeef"}}, nil)
+	slackClient.On("PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(slack.PostMessageResult{
+		Type:   slack.PostMessageResultAPIFailure,
+		Reason: "not_in_channel",
+	}, nil)
+
+	h := ProxyHandler{
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdTest
+	c, rec := setupCommandContext()
+	err := h.processCmdTest(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "Invite Belldog")
+}
+
+func TestCmdTestInvalidToken(t *testing.T) {
+	svc := &mockTokenService{}
+	slackClient := &mockSlackClient{}
+	svc.On("VerifyToken", mock.Anything, "test", "wrong").Return(service.VerifyResult{}, service.ErrTokenUnmatch)
+
+	h := ProxyHandler{slackClient: slackClient, tokenSvc: svc}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdTest
+	cmdReq.Text = "wrong"
+	c, rec := setupCommandContext()
+	err := h.processCmdTest(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "Invalid token for this channel")
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCmdMapping(t *testing.T) {
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	rules, err := service.ParseMappingRules("text <- $.alert.description")
+	require.NoError(t, err)
+	svc.On("SetMappings", mock.Anything, "test", "deadbeef", "text <- $.alert.description").Return(rules, nil)
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.Command == cmdMapping && entry.Result == auditResultMappingUpdated
+	})).Return(nil)
+
+	h := ProxyHandler{tokenSvc: svc, auditSvc: auditSvc}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdMapping
+	cmdReq.Text = "deadbeef text <- $.alert.description"
+	c, rec := setupCommandContext()
+	err = h.processCmdMapping(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Mapping rules updated:\n- `text <- $.alert.description`\n", resp["text"])
+	auditSvc.AssertExpectations(t)
+}
+
+func TestCmdMappingInvalid(t *testing.T) {
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	svc.On("SetMappings", mock.Anything, "test", "deadbeef", "text").Return([]service.MappingRule(nil), service.ErrInvalidMapping)
+	auditSvc.On("Record", mock.Anything, mock.Anything).Return(nil)
+
+	h := ProxyHandler{tokenSvc: svc, auditSvc: auditSvc}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdMapping
+	cmdReq.Text = "deadbeef text"
+	c, rec := setupCommandContext()
+	err := h.processCmdMapping(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "Invalid mapping rules.")
+}
+
+func TestCmdMappingShow(t *testing.T) {
+	svc := &mockTokenService{}
+	rules, err := service.ParseMappingRules("text <- $.message")
+	require.NoError(t, err)
+	svc.On("GetTokens", mock.Anything, "test").Return([]service.Entry{{Token: "deadbeefcafe", Prefix: "deadbeef", Mappings: rules}}, nil)
+
+	h := ProxyHandler{tokenSvc: svc}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdMapping
+	cmdReq.Text = "deadbeef"
+	c, rec := setupCommandContext()
+	err = h.processCmdMapping(c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Mapping rules of deadbeef:\n- `text <- $.message`\n", resp["text"])
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// Query parameters of content-hash deduplication. Identical payloads sent with the same token within
+// `dedup_window` are suppressed, or counted on the first message with `dedup_mode=count`.
+const (
+	dedupWindowQuery  = "dedup_window"
+	dedupModeQuery    = "dedup_mode"
+	dedupModeSuppress = "suppress"
+	dedupModeCount    = "count"
+)
+
+// Responded to suppressed duplicates with the number of identical payloads including the first one.
+const duplicateCountHeader = "Duplicate-Count"
+
+type dedupOptions struct {
+	// Zero when deduplication is disabled.
+	window time.Duration
+	mode   string
+}
+
+// parseDedupOptions returns the message for the response when the query parameters are invalid.
+func parseDedupOptions(query url.Values) (dedupOptions, string) {
+	value := query.Get(dedupWindowQuery)
+	mode := query.Get(dedupModeQuery)
+	if value == "" {
+		if mode != "" {
+			return dedupOptions{}, fmt.Sprintf("%s query parameter requires %s.\n", dedupModeQuery, dedupWindowQuery)
+		}
+		return dedupOptions{}, ""
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 || window > service.MaxDedupWindow {
+		return dedupOptions{}, fmt.Sprintf("Invalid %s query parameter given. It must be a duration up to %s.\n", dedupWindowQuery, service.MaxDedupWindow)
+	}
+	switch mode {
+	case "":
+		mode = dedupModeSuppress
+	case dedupModeSuppress, dedupModeCount:
+	default:
+		return dedupOptions{}, fmt.Sprintf("Invalid %s query parameter given. It must be %s or %s.\n", dedupModeQuery, dedupModeSuppress, dedupModeCount)
+	}
+	return dedupOptions{window: window, mode: mode}, ""
+}
+
+// withDedup suppresses payloads identical to one sent with the same token within the window, responding the
+// first message instead. With count mode, the first message is updated with the number of duplicates. Failing to
+// deduplicate doesn't fail the request: the payload is sent as usual.
+func (h *ProxyHandler) withDedup(c echo.Context, send sendFunc, res service.VerifyResult, opts dedupOptions) sendFunc {
+	return func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+		hash, err := service.ContentHash(res.Version, payload)
+		if err != nil {
+			return slack.PostMessageResult{}, err
+		}
+		duplicate, found, err := h.idempotencySvc.BeginDedup(ctx, channelID, hash, opts.window)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to begin deduplication, process without deduplication", slog.String("error", err.Error()))
+			return send(ctx, channelID, channelName, payload)
+		}
+		if found {
+			slog.InfoContext(ctx, "duplicate payload suppressed", slog.Int("count", duplicate.Count), slog.String("ts", duplicate.TS))
+			c.Response().Header().Set(duplicateCountHeader, strconv.Itoa(duplicate.Count))
+			if opts.mode == dedupModeCount && duplicate.TS != "" {
+				h.updateDuplicateCount(ctx, channelID, channelName, payload, duplicate)
+			}
+			return slack.PostMessageResult{Type: slack.PostMessageResultOK, TS: duplicate.TS}, nil
+		}
+
+		result, err := send(ctx, channelID, channelName, payload)
+		if err == nil && result.Type == slack.PostMessageResultOK {
+			if err := h.idempotencySvc.CompleteDedup(ctx, channelID, hash, result.TS); err != nil {
+				slog.ErrorContext(ctx, "failed to save deduplication result", slog.String("error", err.Error()))
+			}
+		} else if err := h.idempotencySvc.AbortDedup(ctx, channelID, hash); err != nil {
+			slog.ErrorContext(ctx, "failed to abort deduplication", slog.String("error", err.Error()))
+		}
+		return result, err
+	}
+}
+
+// updateDuplicateCount updates the first message with the payload annotated with the count. The duplicate has
+// been suppressed anyway, so failures are only logged.
+func (h *ProxyHandler) updateDuplicateCount(ctx context.Context, channelID string, channelName string, payload map[string]interface{}, duplicate service.Duplicate) {
+	annotateDuplicateCount(payload, duplicate.Count)
+	payload[tsKey] = duplicate.TS
+	update := h.withMentions(h.withChannelDefaults(h.slackClient.UpdateMessage))
+	result, err := update(ctx, channelID, channelName, payload)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to update duplicate count", slog.String("error", err.Error()))
+		return
+	}
+	if result.Type != slack.PostMessageResultOK {
+		slog.WarnContext(ctx, "failed to update duplicate count", slog.Any("result_type", result.Type), slog.String("reason", result.Reason))
+	}
+}
+
+// annotateDuplicateCount appends the count like `(x3)` to the text, and to the blocks which hide the text.
+func annotateDuplicateCount(payload map[string]interface{}, count int) {
+	note := fmt.Sprintf("(x%d)", count)
+	if text, ok := payload["text"].(string); ok && text != "" {
+		payload["text"] = text + " " + note
+	} else {
+		payload["text"] = note
+	}
+	if blocks, ok := payload["blocks"].([]interface{}); ok {
+		annotation := map[string]interface{}{
+			"type":     "context",
+			"elements": []interface{}{map[string]interface{}{"type": "mrkdwn", "text": note}},
+		}
+		payload["blocks"] = append(blocks, annotation)
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func newDedupTestHandler(slackClient *mockSlackClient, idempotencySvc *mockIdempotencyService) ProxyHandler {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	return ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		idempotencySvc:   idempotencySvc,
+		digestSvc:        disabledDigestService(),
+	}
+}
+
+func TestWebhookDedupFirst(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK, TS: "1405894322.002768"}, nil)
+	idempotencySvc := &mockIdempotencyService{}
+	idempotencySvc.On("BeginDedup", mock.Anything, "C123456", mock.Anything, 5*time.Minute).Return(service.Duplicate{}, false, nil)
+	idempotencySvc.On("CompleteDedup", mock.Anything, "C123456", mock.Anything, "1405894322.002768").Return(nil)
+
+	h := newDedupTestHandler(slackClient, idempotencySvc)
+	payload := `{"text": "disk full"}`
+	c := setupContext(&payload)
+	c.Request().URL.RawQuery = "dedup_window=5m"
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	assert.Empty(t, c.Response().Header().Get(duplicateCountHeader))
+	idempotencySvc.AssertExpectations(t)
+}
+
+func TestWebhookDedupSuppress(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	idempotencySvc := &mockIdempotencyService{}
+	idempotencySvc.On("BeginDedup", mock.Anything, "C123456", mock.Anything, 5*time.Minute).Return(service.Duplicate{TS: "1405894322.002768", Count: 3}, true, nil)
+
+	h := newDedupTestHandler(slackClient, idempotencySvc)
+	payload := `{"text": "disk full"}`
+	c := setupContext(&payload)
+	c.Request().URL.RawQuery = "dedup_window=5m&response=json"
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	assert.Equal(t, "3", c.Response().Header().Get(duplicateCountHeader))
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "ts": "1405894322.002768"}`, rec.Body.String())
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	slackClient.AssertNotCalled(t, "UpdateMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookDedupCount(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	slackClient.On("UpdateMessage", mock.Anything, "C123456", "test", map[string]interface{}{
+		"text": "disk full (x3)",
+		"ts":   "1405894322.002768",
+	}).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK, TS: "1405894322.002768"}, nil)
+	idempotencySvc := &mockIdempotencyService{}
+	idempotencySvc.On("BeginDedup", mock.Anything, "C123456", mock.Anything, 5*time.Minute).Return(service.Duplicate{TS: "1405894322.002768", Count: 3}, true, nil)
+
+	h := newDedupTestHandler(slackClient, idempotencySvc)
+	payload := `{"text": "disk full"}`
+	c := setupContext(&payload)
+	c.Request().URL.RawQuery = "dedup_window=5m&dedup_mode=count"
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	slackClient.AssertExpectations(t)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookDedupInvalidQuery(t *testing.T) {
+	for _, query := range []string{"dedup_window=2h", "dedup_window=soon", "dedup_window=5m&dedup_mode=drop", "dedup_mode=count"} {
+		t.Run(query, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			h := newDedupTestHandler(slackClient, &mockIdempotencyService{})
+			payload := `{"text": "disk full"}`
+			c := setupContext(&payload)
+			c.Request().URL.RawQuery = query
+			err := h.Webhook(c)
+
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+			slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestAnnotateDuplicateCount(t *testing.T) {
+	payload := map[string]interface{}{
+		"blocks": []interface{}{map[string]interface{}{"type": "divider"}},
+	}
+	annotateDuplicateCount(payload, 2)
+
+	assert.Equal(t, "(x2)", payload["text"])
+	blocks := payload["blocks"].([]interface{})
+	require.Len(t, blocks, 2)
+	assert.Equal(t, "context", blocks[1].(map[string]interface{})["type"])
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// Slack gives up slash commands not responded in 3 seconds. With SLASH_COMMAND_DEFER, commands marked as deferred
+// are acknowledged with an empty response first, and processed afterwards: the response is sent to the
+// `response_url` instead. Commands failed transiently are deferred too, to retry them. The deferred request goes
+// through SlashCommand again, so the signature and the permissions are checked as usual.
+
+// DeferredCommandDetailType is the `detail-type` of events invoking the proxy function to process deferred
+// commands.
+const DeferredCommandDetailType = "belldog.deferred_command"
+
+// DeferredCommand has the signed slash command request.
+type DeferredCommand struct {
+	Body      string `json:"body"`
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature"`
+	// Used to build webhook URLs unless CUSTOM_DOMAIN_NAME is set.
+	Host string `json:"host"`
+	// The deferred run logs with the request ID of the acknowledged request.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// commandDeferrer hands the command over to be processed after the response.
+type commandDeferrer interface {
+	Defer(ctx context.Context, cmd DeferredCommand) error
+}
+
+const ctxKeyCommandBody = "belldog.command_body"
+
+type deferredRunKey struct{}
+
+func (h *ProxyHandler) deferCommand(spec commandSpec, next commandFunc) commandFunc {
+	return func(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+		ctx := c.Request().Context()
+		if h.deferrer == nil || cmdReq.ResponseURL == "" {
+			return next(c, cmdReq)
+		}
+		if isDeferredRun(ctx) {
+			return h.respondDeferred(c, cmdReq, next)
+		}
+		if !spec.deferred || !h.cfg.SlashCommandDefer {
+			return next(c, cmdReq)
+		}
+
+		if err := h.deferrer.Defer(ctx, deferredCommandOf(c)); err != nil {
+			slog.ErrorContext(ctx, "failed to defer command, process it now", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("command", spec.name))
+			return next(c, cmdReq)
+		}
+		slog.InfoContext(ctx, "command deferred", slog.String("command", spec.name))
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// retryCommand retries commands failed with transient errors, e.g. DynamoDB throttling, once after responding:
+// the command is deferred and the result is sent to the response_url. Users get an apology instead of Slack's
+// generic error when it can't be deferred.
+func (h *ProxyHandler) retryCommand(spec commandSpec, next commandFunc) commandFunc {
+	return func(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+		ctx := c.Request().Context()
+		err := next(c, cmdReq)
+		if err == nil || !storage.IsTransient(err) || h.deferrer == nil || cmdReq.ResponseURL == "" || isDeferredRun(ctx) || c.Response().Committed {
+			return err
+		}
+		slog.WarnContext(ctx, "command failed transiently, retry after responding", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("command", spec.name))
+		if deferErr := h.deferrer.Defer(ctx, deferredCommandOf(c)); deferErr != nil {
+			slog.ErrorContext(ctx, "failed to defer command retry", slog.String("error", fmt.Sprintf("%+v", deferErr)), slog.String("command", spec.name))
+			return ephemeralResponse(c, "Belldog is temporarily unavailable. Retry later.\n")
+		}
+		return ephemeralResponse(c, "Belldog is busy. Retrying the command, the result will be posted here shortly.\n")
+	}
+}
+
+func deferredCommandOf(c echo.Context) DeferredCommand {
+	body, _ := c.Get(ctxKeyCommandBody).(string)
+	return DeferredCommand{
+		Body:      body,
+		Timestamp: c.Request().Header.Get("X-Slack-Request-Timestamp"),
+		Signature: c.Request().Header.Get("X-Slack-Signature"),
+		Host:      c.Request().Host,
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+}
+
+func isDeferredRun(ctx context.Context) bool {
+	return ctx.Value(deferredRunKey{}) != nil
+}
+
+// respondDeferred sends the response of the command to the response_url. Failures are told to the user and
+// logged, but not returned: retrying commands may operate tokens twice.
+func (h *ProxyHandler) respondDeferred(c echo.Context, cmdReq slack.SlashCommandRequest, next commandFunc) error {
+	ctx := c.Request().Context()
+	original := c.Response()
+	var buf bytes.Buffer
+	c.SetResponse(echo.NewResponse(&bufferedResponseWriter{header: http.Header{}, body: &buf}, c.Echo()))
+	err := next(c, cmdReq)
+	c.SetResponse(original)
+
+	var payload map[string]interface{}
+	if err != nil {
+		slog.ErrorContext(ctx, "deferred command failed", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("command", cmdReq.Command))
+		payload = map[string]interface{}{
+			"text":          "Failed to process the command. Retry later.\n",
+			"response_type": "ephemeral",
+		}
+	} else if jsonErr := json.Unmarshal(buf.Bytes(), &payload); jsonErr != nil {
+		payload = map[string]interface{}{"text": buf.String(), "response_type": "ephemeral"}
+	}
+	if err := h.slackClient.PostResponse(ctx, cmdReq.ResponseURL, payload); err != nil {
+		slog.ErrorContext(ctx, "failed to post deferred command response", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("command", cmdReq.Command))
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// ServeDeferredCommand processes the deferred command with the handler returned by NewEchoHandler.
+func ServeDeferredCommand(ctx context.Context, handler http.Handler, cmd DeferredCommand) error {
+	ctx = context.WithValue(ctx, deferredRunKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/slash", strings.NewReader(cmd.Body))
+	if err != nil {
+		return errors.Wrap(err, "failed to build deferred command request")
+	}
+	req.Host = cmd.Host
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.Header.Set("X-Slack-Request-Timestamp", cmd.Timestamp)
+	req.Header.Set("X-Slack-Signature", cmd.Signature)
+	if cmd.RequestID != "" {
+		req.Header.Set(echo.HeaderXRequestID, cmd.RequestID)
+	}
+	w := &bufferedResponseWriter{header: http.Header{}, body: &bytes.Buffer{}, code: http.StatusOK}
+	handler.ServeHTTP(w, req)
+	if w.code != http.StatusOK {
+		return errors.Newf("failed to process deferred command: status=%d, body=%s", w.code, w.body.String())
+	}
+	return nil
+}
+
+type bufferedResponseWriter struct {
+	header http.Header
+	body   *bytes.Buffer
+	code   int
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	w.code = statusCode
+}
+
+// inProcessDeferrer processes deferred commands in goroutines of the server process. Don't use this on Lambda,
+// which freezes the execution environment after responding.
+type inProcessDeferrer struct {
+	handler http.Handler
+}
+
+func (d *inProcessDeferrer) Defer(ctx context.Context, cmd DeferredCommand) error {
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		if err := ServeDeferredCommand(ctx, d.handler, cmd); err != nil {
+			slog.ErrorContext(ctx, "failed to process deferred command", slog.String("error", fmt.Sprintf("%+v", err)))
+		}
+	}()
+	return nil
+}
+
+type asyncInvoker interface {
+	InvokeAsync(ctx context.Context, functionName string, qualifier string, payload []byte) error
+}
+
+// LambdaDeferrer invokes the running function asynchronously with the deferred command. The function receives it
+// as an event having DeferredCommandDetailType: see Wrap.
+type LambdaDeferrer struct {
+	invoker      asyncInvoker
+	functionName string
+	qualifier    string
+}
+
+func NewLambdaDeferrer(invoker asyncInvoker, functionName string, qualifier string) *LambdaDeferrer {
+	return &LambdaDeferrer{invoker: invoker, functionName: functionName, qualifier: qualifier}
+}
+
+type deferredCommandEvent struct {
+	DetailType string          `json:"detail-type"`
+	Detail     DeferredCommand `json:"detail"`
+}
+
+func (d *LambdaDeferrer) Defer(ctx context.Context, cmd DeferredCommand) error {
+	payload, err := json.Marshal(deferredCommandEvent{DetailType: DeferredCommandDetailType, Detail: cmd})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal deferred command event")
+	}
+	return d.invoker.InvokeAsync(ctx, d.functionName, d.qualifier, payload)
+}
+
+// Wrap returns the Lambda handler processing deferred command events with the handler, and passing other events
+// to the next handler. Failures are logged but not returned, so Lambda doesn't retry the command.
+func (d *LambdaDeferrer) Wrap(handler http.Handler, next lambda.Handler) lambda.Handler {
+	return deferredCommandInvoker{handler: handler, next: next}
+}
+
+type deferredCommandInvoker struct {
+	handler http.Handler
+	next    lambda.Handler
+}
+
+func (i deferredCommandInvoker) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var ev deferredCommandEvent
+	if err := json.Unmarshal(payload, &ev); err != nil || ev.DetailType != DeferredCommandDetailType {
+		return i.next.Invoke(ctx, payload)
+	}
+	if err := ServeDeferredCommand(ctx, i.handler, ev.Detail); err != nil {
+		slog.ErrorContext(ctx, "failed to process deferred command", slog.String("error", fmt.Sprintf("%+v", err)))
+	}
+	return []byte(`{"ok":true}`), nil
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+const testResponseURL = "https://hooks.slack.com/commands/T123/456/abc"
+
+type fakeDeferrer struct {
+	deferred []DeferredCommand
+	err      error
+}
+
+func (d *fakeDeferrer) Defer(ctx context.Context, cmd DeferredCommand) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.deferred = append(d.deferred, cmd)
+	return nil
+}
+
+type fakeInvoker struct {
+	functionName string
+	qualifier    string
+	payload      []byte
+}
+
+func (i *fakeInvoker) InvokeAsync(ctx context.Context, functionName string, qualifier string, payload []byte) error {
+	i.functionName = functionName
+	i.qualifier = qualifier
+	i.payload = payload
+	return nil
+}
+
+func TestRunCommandDefers(t *testing.T) {
+	deferrer := &fakeDeferrer{}
+	h := ProxyHandler{cfg: appconfig.Config{SlashCommandDefer: true}, deferrer: deferrer}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdShow
+	cmdReq.ResponseURL = testResponseURL
+	spec, ok := findCommand(cmdShow)
+	require.True(t, ok)
+	c, rec := setupCommandContext()
+	c.Request().Host = "belldog.example.com"
+	c.Request().Header.Set("X-Slack-Request-Timestamp", "1700000000")
+	c.Request().Header.Set("X-Slack-Signature", "v0=abc")
+	c.Set(ctxKeyCommandBody, "command=%2Fbelldog-show")
+	err := h.runCommand(spec, c, cmdReq)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	require.Len(t, deferrer.deferred, 1)
+	assert.Equal(t, DeferredCommand{
+		Body:      "command=%2Fbelldog-show",
+		Timestamp: "1700000000",
+		Signature: "v0=abc",
+		Host:      "belldog.example.com",
+	}, deferrer.deferred[0])
+}
+
+// Slack always gives response_url, but process the command now just in case.
+func TestRunCommandWithoutResponseURL(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("GetTokens", mock.Anything, "test").Return([]service.Entry{
+		{Token: "deadbeef", Version: 0, CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}, nil)
+	deferrer := &fakeDeferrer{}
+	h := ProxyHandler{cfg: appconfig.Config{}, tokenSvc: svc, deferrer: deferrer}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdShow
+	spec, ok := findCommand(cmdShow)
+	require.True(t, ok)
+	c, rec := setupCommandContext()
+	err := h.runCommand(spec, c, cmdReq)
+
+	require.NoError(t, err)
+	assert.Empty(t, deferrer.deferred)
+	assert.Contains(t, decodeCommandResponse(t, rec)["text"], "deadbeef")
+}
+
+func TestRunDeferredCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantText string
+	}{
+		{name: "ok", wantText: "deadbeef"},
+		{name: "failure", err: errors.New("ddb down"), wantText: "Failed to process the command."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &mockTokenService{}
+			svc.On("GetTokens", mock.Anything, "test").Return([]service.Entry{
+				{Token: "deadbeef", Version: 0, CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			}, tt.err)
+			slackClient := &mockSlackClient{}
+			slackClient.On("PostResponse", mock.Anything, testResponseURL, mock.MatchedBy(func(payload map[string]interface{}) bool {
+				text, _ := payload["text"].(string)
+				return assert.Contains(t, text, tt.wantText)
+			})).Return(nil)
+			h := ProxyHandler{cfg: appconfig.Config{}, tokenSvc: svc, slackClient: slackClient, deferrer: &fakeDeferrer{}}
+			cmdReq := defaultCmdReq
+			cmdReq.Command = cmdShow
+			cmdReq.ResponseURL = testResponseURL
+			spec, ok := findCommand(cmdShow)
+			require.True(t, ok)
+			c, rec := setupCommandContext()
+			c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), deferredRunKey{}, true)))
+			err := h.runCommand(spec, c, cmdReq)
+
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Empty(t, rec.Body.String())
+			slackClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRunCommandRetriesTransientFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		deferErr     error
+		wantErr      bool
+		wantText     string
+		wantDeferred int
+	}{
+		{name: "throttled", err: &types.ProvisionedThroughputExceededException{}, wantText: "Retrying the command", wantDeferred: 1},
+		{name: "defer failed", err: &types.ProvisionedThroughputExceededException{}, deferErr: errors.New("not authorized"), wantText: "temporarily unavailable"},
+		{name: "not transient", err: errors.New("broken record"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &mockTokenService{}
+			svc.On("GetTokens", mock.Anything, "test").Return([]service.Entry{}, errors.Wrap(tt.err, "failed to query"))
+			deferrer := &fakeDeferrer{err: tt.deferErr}
+			h := ProxyHandler{cfg: appconfig.Config{}, tokenSvc: svc, deferrer: deferrer}
+			cmdReq := defaultCmdReq
+			cmdReq.Command = cmdShow
+			cmdReq.ResponseURL = testResponseURL
+			spec, ok := findCommand(cmdShow)
+			require.True(t, ok)
+			c, rec := setupCommandContext()
+			err := h.runCommand(spec, c, cmdReq)
+
+			assert.Len(t, deferrer.deferred, tt.wantDeferred)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			resp := decodeCommandResponse(t, rec)
+			assert.Equal(t, "ephemeral", resp["response_type"])
+			assert.Contains(t, resp["text"], tt.wantText)
+		})
+	}
+}
+
+func TestLambdaDeferrer(t *testing.T) {
+	invoker := &fakeInvoker{}
+	d := NewLambdaDeferrer(invoker, "belldog-proxy", "3")
+	cmd := DeferredCommand{Body: "command=%2Fbelldog-show", Timestamp: "1700000000", Signature: "v0=abc", Host: "belldog.example.com"}
+	require.NoError(t, d.Defer(context.Background(), cmd))
+	assert.Equal(t, "belldog-proxy", invoker.functionName)
+	assert.Equal(t, "3", invoker.qualifier)
+
+	var served *http.Request
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = r
+		w.WriteHeader(http.StatusOK)
+	})
+	next := lambda.NewHandler(func(context.Context, json.RawMessage) (string, error) {
+		t.Fatal("deferred command events must not be passed to the next handler")
+		return "", nil
+	})
+	_, err := d.Wrap(handler, next).Invoke(context.Background(), invoker.payload)
+
+	require.NoError(t, err)
+	require.NotNil(t, served)
+	assert.Equal(t, "/slash", served.URL.Path)
+	assert.Equal(t, "belldog.example.com", served.Host)
+	assert.Equal(t, "v0=abc", served.Header.Get("X-Slack-Signature"))
+	assert.Equal(t, "1700000000", served.Header.Get("X-Slack-Request-Timestamp"))
+	assert.NotNil(t, served.Context().Value(deferredRunKey{}))
+}
+
+func TestVerifySlackRequestReplay(t *testing.T) {
+	h := ProxyHandler{cfg: appconfig.Config{SlackSigningSecret: testSigningSecret}, replayCache: slack.NewReplayCache()}
+	body := "command=%2Fbelldog-show"
+	c, _ := setupSignedContext("/slash", body)
+	ctx := c.Request().Context()
+
+	assert.True(t, h.verifySlackRequest(ctx, c.Request().Header, body))
+	assert.False(t, h.verifySlackRequest(ctx, c.Request().Header, body))
+	// Deferred commands are verified again with the same signature.
+	assert.True(t, h.verifySlackRequest(context.WithValue(ctx, deferredRunKey{}, true), c.Request().Header, body))
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// Slack API errors meaning that the channel can't receive messages until someone fixes the channel or the token.
+// Retrying doesn't help, so consecutive ones are escalated with DELIVERY_FAILURE_THRESHOLD.
+var undeliverableReasons = []string{"channel_not_found", "not_in_channel", "is_archived"}
+
+// trackDelivery counts consecutive undeliverable failures of the token. Returns the number of failures when the
+// token has reached DELIVERY_FAILURE_THRESHOLD, zero otherwise. Reaching the threshold marks the token in the
+// storage and notifies ops once. Tracking failures never fails the request.
+func (h *ProxyHandler) trackDelivery(ctx context.Context, res service.VerifyResult, result slack.PostMessageResult) int {
+	threshold := h.cfg.DeliveryFailureThreshold
+	if threshold <= 0 {
+		return 0
+	}
+	if result.Type == slack.PostMessageResultOK {
+		if res.DeliveryFailures > 0 {
+			if err := h.tokenSvc.ResetDeliveryFailures(ctx, res); err != nil {
+				slog.WarnContext(ctx, "failed to reset delivery failures", slog.String("error", err.Error()))
+			}
+		}
+		return 0
+	}
+	// Test mode posts to the sandbox channel, whose failures are not of the token.
+	if result.Type != slack.PostMessageResultAPIFailure || !slices.Contains(undeliverableReasons, result.Reason) || result.ChannelID != res.ChannelID {
+		return 0
+	}
+	count, err := h.tokenSvc.RecordDeliveryFailure(ctx, res, result.Reason)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to record delivery failure", slog.String("error", err.Error()))
+		return 0
+	}
+	if count < threshold {
+		return 0
+	}
+	// Counts are incremented atomically, so only one request escalates.
+	if count == threshold {
+		h.escalateDeliveryFailure(ctx, res, result.Reason, count)
+	}
+	return count
+}
+
+func (h *ProxyHandler) escalateDeliveryFailure(ctx context.Context, res service.VerifyResult, reason string, count int) {
+	slog.WarnContext(ctx, "delivery failures reached threshold, escalating", slog.String("channel_id", res.ChannelID), slog.String("channel_name", res.ChannelName), slog.String("reason", reason), slog.Int("failures", count))
+	if err := h.tokenSvc.MarkUndeliverable(ctx, res); err != nil {
+		slog.WarnContext(ctx, "failed to mark token undeliverable", slog.String("error", err.Error()))
+	}
+	format := `Webhook requests keep failing: channel_id=%s, channel_name=%s, token_version=%d, reason=%s, failures=%d
+
+%s
+Callers receive %s errors until a message is delivered again.
+`
+	msg := fmt.Sprintf(format, res.ChannelID, res.ChannelName, res.Version, reason, count, remediation(reason), apierror.CodeChannelUndeliverable)
+	if err := h.maintainer.notifyOps(context.WithoutCancel(ctx), opsClassUndeliverable, msg); err != nil {
+		slog.ErrorContext(ctx, "failed to notify delivery failures", slog.String("error", err.Error()))
+	}
+}
+
+func remediation(reason string) string {
+	if reason == "is_archived" {
+		return "1. Unarchive the channel, or\n2. Ask the owner of the webhook to generate a token in another channel and revoke this token."
+	}
+	return "1. Invite the bot to the channel if it is private, or\n2. Ask the owner of the webhook to generate a token in another channel and revoke this token if the channel was deleted."
+}
+
+func respondUndeliverable(c echo.Context, result slack.PostMessageResult, count int) error {
+	msg := fmt.Sprintf("Channel is undeliverable after %d consecutive failures, ops is notified: channelName=%s, channelID=%s, reason=%s\n", count, result.ChannelName, result.ChannelID, result.Reason)
+	return apierror.Respond(c, http.StatusGone, apierror.CodeChannelUndeliverable, msg)
+}
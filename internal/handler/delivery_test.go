@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func newDeliveryTestHandler(slackClient *mockSlackClient, svc *mockTokenService) ProxyHandler {
+	cfg := appconfig.Config{DeliveryFailureThreshold: 3, OpsNotificationChannelName: "ops"}
+	return ProxyHandler{
+		cfg:              cfg,
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+		maintainer:       newRecordMaintainer(cfg, slackClient, nil, nil, nil, nil, nil),
+	}
+}
+
+func archivedResult() slack.PostMessageResult {
+	return slack.PostMessageResult{Type: slack.PostMessageResultAPIFailure, Reason: "is_archived", ChannelID: "C123456", ChannelName: "test"}
+}
+
+func TestWebhookDeliveryFailureBelowThreshold(t *testing.T) {
+	res := service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(res, nil)
+	svc.On("RecordDeliveryFailure", mock.Anything, res, "is_archived").Return(1, nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(archivedResult(), nil)
+
+	h := newDeliveryTestHandler(slackClient, svc)
+	c := setupContext(nil)
+	c.Request().URL.RawQuery = "response=json"
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Contains(t, rec.Body.String(), `"code":"slack_api_error"`)
+	svc.AssertExpectations(t)
+	svc.AssertNotCalled(t, "MarkUndeliverable", mock.Anything, mock.Anything)
+}
+
+func TestWebhookDeliveryFailureEscalation(t *testing.T) {
+	res := service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost, Version: 1, DeliveryFailures: 2}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(res, nil)
+	svc.On("RecordDeliveryFailure", mock.Anything, res, "is_archived").Return(3, nil)
+	svc.On("MarkUndeliverable", mock.Anything, res).Return(nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(archivedResult(), nil)
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		return strings.Contains(text, "channel_name=test, token_version=1, reason=is_archived, failures=3") && strings.Contains(text, "Unarchive the channel")
+	})).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK}, nil)
+
+	h := newDeliveryTestHandler(slackClient, svc)
+	c := setupContext(nil)
+	c.Request().URL.RawQuery = "response=json"
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGone, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Contains(t, rec.Body.String(), `"code":"channel_undeliverable"`)
+	svc.AssertExpectations(t)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookDeliveryFailureEscalatedOnce(t *testing.T) {
+	res := service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost, DeliveryFailures: 3}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(res, nil)
+	svc.On("RecordDeliveryFailure", mock.Anything, res, "is_archived").Return(4, nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(archivedResult(), nil)
+
+	h := newDeliveryTestHandler(slackClient, svc)
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGone, c.Response().Status)
+	svc.AssertNotCalled(t, "MarkUndeliverable", mock.Anything, mock.Anything)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, "ops", "ops", mock.Anything)
+}
+
+func TestWebhookDeliveryFailureReset(t *testing.T) {
+	res := service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost, DeliveryFailures: 4}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(res, nil)
+	svc.On("ResetDeliveryFailures", mock.Anything, res).Return(nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK}, nil)
+
+	h := newDeliveryTestHandler(slackClient, svc)
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	svc.AssertExpectations(t)
+}
+
+func TestWebhookDeliveryFailureOtherReasons(t *testing.T) {
+	res := service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(res, nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultAPIFailure, Reason: "invalid_blocks", ChannelID: "C123456", ChannelName: "test",
+	}, nil)
+
+	h := newDeliveryTestHandler(slackClient, svc)
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	svc.AssertNotCalled(t, "RecordDeliveryFailure", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// DigestHandler posts messages buffered by channels having digest_window configured. Schedule this more
+// frequently than the shortest window, e.g. every minute.
+type DigestHandler struct {
+	cfg              appconfig.Config
+	slackClient      slackClient
+	digestSvc        digestService
+	channelConfigSvc channelConfigService
+}
+
+func NewDigestHandler(cfg appconfig.Config, slackClient slackClient, digestSvc digestService, channelConfigSvc channelConfigService) DigestHandler {
+	return DigestHandler{
+		cfg:              cfg,
+		slackClient:      slackClient,
+		digestSvc:        digestSvc,
+		channelConfigSvc: channelConfigSvc,
+	}
+}
+
+func (h *DigestHandler) HandleCloudWatchEvent(ctx context.Context, _ events.CloudWatchEvent) (err error) {
+	defer recoverEventPanic(ctx, "digest", nil, &err)
+	if err := h.flush(ctx, time.Now()); err != nil {
+		slog.ErrorContext(ctx, "failed to flush digests", slog.String("error", fmt.Sprintf("%+v", err)))
+		return err
+	}
+	return nil
+}
+
+// A failure of one channel doesn't stop flushing others; all errors are reported at the end.
+func (h *DigestHandler) flush(ctx context.Context, now time.Time) error {
+	digests, err := h.digestSvc.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "pending digests", slog.Int("size", len(digests)))
+
+	var errs []error
+	for _, digest := range digests {
+		if err := h.flushDigest(ctx, digest, now); err != nil {
+			slog.ErrorContext(ctx, "failed to flush digest", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("channel_id", digest.ChannelID))
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Wrapf(errors.Join(errs...), "digest flush failed for %d channel(s)", len(errs))
+	}
+	return nil
+}
+
+func (h *DigestHandler) flushDigest(ctx context.Context, digest service.PendingDigest, now time.Time) error {
+	defaults, err := h.channelConfigSvc.GetDefaults(ctx, digest.ChannelID)
+	if err != nil {
+		return err
+	}
+	// Unset digest_window makes the window zero, so remaining messages are flushed immediately.
+	if now.Before(digest.Since.Add(defaults.DigestWindow)) {
+		return nil
+	}
+
+	payload := service.MergeDigest(digest.Payloads)
+	defaults.ApplyTo(payload)
+	result, err := h.slackClient.PostMessage(ctx, digest.ChannelID, digest.ChannelName, payload)
+	if err != nil {
+		return err
+	}
+	failure := handlePostMessageFailure(result)
+	// Retrying API failures like channel_not_found doesn't help, so drop the messages.
+	if failure != nil && result.Type != slack.PostMessageResultAPIFailure {
+		return failure
+	}
+	if err := h.digestSvc.Ack(ctx, digest); err != nil {
+		return err
+	}
+	if failure != nil {
+		return errors.Wrapf(failure, "digest dropped: message_size=%d", len(digest.Payloads))
+	}
+	slog.InfoContext(ctx, "digest flushed", slog.String("channel_id", digest.ChannelID), slog.Int("message_size", len(digest.Payloads)))
+	return nil
+}
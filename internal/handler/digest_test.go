@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestDigestFlush(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expired := service.PendingDigest{
+		ChannelID:   "C123456",
+		ChannelName: "test",
+		Since:       now.Add(-2 * time.Minute),
+		Payloads:    []map[string]interface{}{{"text": "first"}, {"text": "second"}},
+	}
+	fresh := service.PendingDigest{
+		ChannelID:   "C789012",
+		ChannelName: "fresh",
+		Since:       now.Add(-10 * time.Second),
+		Payloads:    []map[string]interface{}{{"text": "third"}},
+	}
+	digestSvc := &mockDigestService{}
+	digestSvc.On("Pending", mock.Anything).Return([]service.PendingDigest{expired, fresh}, nil)
+	digestSvc.On("Ack", mock.Anything, expired).Return(nil)
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("GetDefaults", mock.Anything, mock.AnythingOfType("string")).Return(service.ChannelDefaults{Username: "CI", DigestWindow: time.Minute}, nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", map[string]interface{}{
+		"text":     "2 messages received:\n\nfirst\n\nsecond",
+		"username": "CI",
+	}).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK}, nil)
+
+	h := NewDigestHandler(appconfig.Config{}, slackClient, digestSvc, configSvc)
+	err := h.flush(context.Background(), now)
+
+	require.NoError(t, err)
+	digestSvc.AssertExpectations(t)
+	slackClient.AssertNumberOfCalls(t, "PostMessage", 1)
+}
+
+func TestDigestFlushKeepsMessagesOnServerFailure(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	digest := service.PendingDigest{
+		ChannelID:   "C123456",
+		ChannelName: "test",
+		Since:       now.Add(-2 * time.Minute),
+		Payloads:    []map[string]interface{}{{"text": "first"}},
+	}
+	digestSvc := &mockDigestService{}
+	digestSvc.On("Pending", mock.Anything).Return([]service.PendingDigest{digest}, nil)
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("GetDefaults", mock.Anything, "C123456").Return(service.ChannelDefaults{DigestWindow: time.Minute}, nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{Type: slack.PostMessageResultServerTimeoutFailure}, nil)
+
+	h := NewDigestHandler(appconfig.Config{}, slackClient, digestSvc, configSvc)
+	err := h.flush(context.Background(), now)
+
+	require.Error(t, err)
+	digestSvc.AssertNotCalled(t, "Ack", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/service"
+)
+
+// webhookError maps expected service failures to webhook responses. Unexpected errors are not handled here:
+// they are returned to the echo error handler and responded with 500.
+func webhookError(code service.Code, channel string) (status int, errCode apierror.Code, msg string) {
+	switch code {
+	case service.CodeTokenNotFound:
+		return http.StatusNotFound, apierror.CodeTokenNotFound, fmt.Sprintf("No token generated for %s, generate token with `%s` slash command.\n", channel, cmdGenerate)
+	case service.CodeTokenUnmatch:
+		return http.StatusUnauthorized, apierror.CodeTokenUnmatch, "Invalid token given. Check generated URL.\n"
+	case service.CodePresignExpired:
+		return http.StatusUnauthorized, apierror.CodeExpired, "The pre-signed URL has expired. Ask the channel for a new URL.\n"
+	default:
+		return http.StatusBadRequest, apierror.Code(code), fmt.Sprintf("Invalid request: %s\n", code)
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/channelname"
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// The Events API archive events don't contain the channel name.
+const unknownChannelName = "(unknown)"
+
+// Events handles Slack Events API requests to apply channel lifecycle changes in real time. The batch job
+// still detects the same changes, so missed events are eventually handled.
+// https://api.slack.com/apis/connections/events-api
+func (h *ProxyHandler) Events(c echo.Context) error {
+	ctx := c.Request().Context()
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read request body")
+	}
+	if !h.verifySlackRequest(ctx, c.Request().Header, string(body)) {
+		return apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidSignature, "Invalid request signature.\n")
+	}
+
+	evt, err := slack.ParseEvent(string(body))
+	if err != nil {
+		slog.InfoContext(ctx, "ParseEvent failed, response bad request", slog.String("error", err.Error()))
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid body given.\n")
+	}
+
+	h.updateInventory(ctx, evt)
+	switch evt.Type {
+	case slack.EventURLVerification:
+		return c.JSON(http.StatusOK, map[string]string{"challenge": evt.Challenge})
+	case slack.EventChannelRename:
+		err = h.processEventChannelRename(ctx, evt)
+	case slack.EventChannelArchive:
+		err = h.processEventChannelArchive(ctx, evt)
+	case slack.EventChannelUnarchive:
+		err = h.processEventChannelUnarchive(ctx, evt)
+	case slack.EventUnsupported:
+		slog.InfoContext(ctx, "unsupported event given", slog.String("name", evt.Name))
+	default:
+		return errors.Newf("unexpected Event type: %v", evt.Type)
+	}
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// Records are keyed by channel name and existing webhook URLs contain the old channel name, so records
+// are kept as is. Notify users to migrate like the batch job does.
+func (h *ProxyHandler) processEventChannelRename(ctx context.Context, evt slack.Event) error {
+	recs, err := h.ddb.ScanByChannelID(ctx, evt.ChannelID)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "channel renamed", slog.String("channel_id", evt.ChannelID), slog.String("channel_name", evt.ChannelName), slog.Int("record_size", len(recs)))
+	for _, rec := range recs {
+		if channelname.Equal(rec.ChannelName, evt.ChannelName) || rec.Tombstone() {
+			continue
+		}
+		renamed := renameEvent{channelID: rec.ChannelID, oldName: rec.ChannelName, newName: evt.ChannelName, savedToken: secret.Token(rec.Token)}
+		if err := h.maintainer.processRename(ctx, renamed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *ProxyHandler) processEventChannelArchive(ctx context.Context, evt slack.Event) error {
+	recs, err := h.ddb.ScanByChannelID(ctx, evt.ChannelID)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "channel archived", slog.String("channel_id", evt.ChannelID), slog.String("user_id", evt.UserID), slog.Int("record_size", len(recs)))
+	for _, rec := range recs {
+		if rec.Tombstone() {
+			continue
+		}
+		if err := h.maintainer.processArchived(ctx, archiveEvent{record: rec, SlackChannelName: unknownChannelName}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore tombstones archived with the channel. Tombstones expired by ARCHIVED_RECORD_TTL have been deleted,
+// so users need to generate new token in that case.
+func (h *ProxyHandler) processEventChannelUnarchive(ctx context.Context, evt slack.Event) error {
+	recs, err := h.ddb.ScanByChannelID(ctx, evt.ChannelID)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "channel unarchived", slog.String("channel_id", evt.ChannelID), slog.String("user_id", evt.UserID), slog.Int("record_size", len(recs)))
+	restored := 0
+	for _, rec := range recs {
+		// Revoked tokens are restored only by users.
+		if !rec.Archived() || rec.Revoked() || rec.Expired(time.Now()) {
+			continue
+		}
+		if err := h.maintainer.processRestore(ctx, restoreEvent{record: rec, slackChannelName: unknownChannelName}); err != nil {
+			return err
+		}
+		restored++
+	}
+	if restored > 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("This channel was unarchived. Tokens for this channel were revoked when archived, generate new token with `%s` if needed.\n", cmdGenerate)
+	msgOps := fmt.Sprintf("Channel is unarchived: channel_id=%s\n", evt.ChannelID)
+	return h.maintainer.notify(ctx, opsClassRestore, evt.ChannelID, unknownChannelName, msg, msgOps)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+const testSigningSecret = "test_signing_secret"
+
+func setupSignedContext(path string, body string) (echo.Context, *httptest.ResponseRecorder) {
+	timestamp := time.Now().Unix()
+	mac := hmac.New(sha256.New, []byte(testSigningSecret))
+	mac.Write([]byte(fmt.Sprintf("v0:%d:%s", timestamp, body)))
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("X-Slack-Request-Timestamp", fmt.Sprintf("%d", timestamp))
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func newEventsTestHandler(slackClient *mockSlackClient, ddb *mockStorageDDB) ProxyHandler {
+	cfg := defaultConfig
+	cfg.SlackSigningSecret = testSigningSecret
+	return ProxyHandler{
+		cfg:         cfg,
+		slackClient: slackClient,
+		ddb:         ddb,
+		maintainer:  newRecordMaintainer(cfg, slackClient, ddb, nil, nil, nil, nil),
+	}
+}
+
+func callbackBody(inner string) string {
+	return `{"token": "x", "team_id": "T123456", "type": "event_callback", "event": ` + inner + `}`
+}
+
+func TestEventsURLVerification(t *testing.T) {
+	h := newEventsTestHandler(&mockSlackClient{}, &mockStorageDDB{})
+	c, rec := setupSignedContext("/events", `{"token": "x", "challenge": "challenge_value", "type": "url_verification"}`)
+	err := h.Events(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"challenge": "challenge_value"}`, rec.Body.String())
+}
+
+func TestEventsInvalidSignature(t *testing.T) {
+	h := newEventsTestHandler(&mockSlackClient{}, &mockStorageDDB{})
+	c, rec := setupSignedContext("/events", `{"type": "url_verification"}`)
+	c.Request().Header.Set("X-Slack-Signature", "v0=invalid")
+	err := h.Events(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestEventsChannelArchive(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	rec := storage.Record{ChannelID: "C123456", ChannelName: "test", Token: "token_a"}
+	ddb.On("ScanByChannelID", mock.Anything, "C123456").Return([]storage.Record{rec}, nil)
+	ddb.On("Archive", mock.Anything, rec, mock.Anything, mock.Anything).Return(nil)
+	messageMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		return strings.HasPrefix(payload["text"].(string), "Channel is archived, archiving record: channel_id=C123456, record_channel_name=test, slack_channel_name=(unknown), expires_at=")
+	})
+	slackClient.On("PostMessage", mock.Anything, defaultConfig.OpsNotificationChannelName, defaultConfig.OpsNotificationChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil)
+
+	h := newEventsTestHandler(slackClient, ddb)
+	c, resp := setupSignedContext("/events", callbackBody(`{"type": "channel_archive", "channel": "C123456", "user": "U123456"}`))
+	err := h.Events(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	slackClient.AssertExpectations(t)
+	ddb.AssertExpectations(t)
+}
+
+func TestEventsChannelRename(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	ddb.On("ScanByChannelID", mock.Anything, "C123456").Return([]storage.Record{
+		{ChannelID: "C123456", ChannelName: "test", Token: "token_a"},
+		{ChannelID: "C123456", ChannelName: "renamed", Token: "token_b"},
+	}, nil)
+	messageMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		return strings.HasPrefix(payload["text"].(string), "Channel name and channel id pair updated: channel_id=C123456, old_channel_name=test, renamed_channel_name=renamed")
+	})
+	slackClient.On("PostMessage", mock.Anything, "C123456", "renamed", mock.Anything).Return(slack.PostMessageResult{}, nil).Once()
+	slackClient.On("PostMessage", mock.Anything, defaultConfig.OpsNotificationChannelName, defaultConfig.OpsNotificationChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil).Once()
+
+	h := newEventsTestHandler(slackClient, ddb)
+	c, resp := setupSignedContext("/events", callbackBody(`{"type": "channel_rename", "channel": {"id": "C123456", "name": "renamed", "created": 1360782804}}`))
+	err := h.Events(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	slackClient.AssertExpectations(t)
+	ddb.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
+
+func TestEventsChannelUnarchive(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	ddb.On("ScanByChannelID", mock.Anything, "C123456").Return([]storage.Record{}, nil)
+	messageMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		return strings.HasPrefix(payload["text"].(string), "This channel was unarchived. Tokens for this channel were revoked")
+	})
+	slackClient.On("PostMessage", mock.Anything, "C123456", unknownChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil)
+	slackClient.On("PostMessage", mock.Anything, defaultConfig.OpsNotificationChannelName, defaultConfig.OpsNotificationChannelName, mock.Anything).Return(slack.PostMessageResult{}, nil)
+
+	h := newEventsTestHandler(slackClient, ddb)
+	c, resp := setupSignedContext("/events", callbackBody(`{"type": "channel_unarchive", "channel": "C123456", "user": "U123456"}`))
+	err := h.Events(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	slackClient.AssertExpectations(t)
+}
+
+func TestEventsChannelUnarchiveRestore(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	tombstone := storage.Record{ChannelID: "C123456", ChannelName: "test", Token: "bd_ab12_0123456789abcdef0123456789abcdef", ArchivedAt: "2024-01-01T00:00:00Z", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	ddb.On("ScanByChannelID", mock.Anything, "C123456").Return([]storage.Record{tombstone}, nil)
+	ddb.On("Restore", mock.Anything, tombstone).Return(nil)
+	messageMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		return payload["text"].(string) == "This channel was unarchived, the token archived with the channel works again: channel_name=test, token=bd_ab12\n"
+	})
+	slackClient.On("PostMessage", mock.Anything, "C123456", unknownChannelName, messageMatcher).Return(slack.PostMessageResult{}, nil)
+	slackClient.On("PostMessage", mock.Anything, defaultConfig.OpsNotificationChannelName, defaultConfig.OpsNotificationChannelName, mock.Anything).Return(slack.PostMessageResult{}, nil)
+
+	h := newEventsTestHandler(slackClient, ddb)
+	c, resp := setupSignedContext("/events", callbackBody(`{"type": "channel_unarchive", "channel": "C123456", "user": "U123456"}`))
+	err := h.Events(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	slackClient.AssertExpectations(t)
+	ddb.AssertExpectations(t)
+}
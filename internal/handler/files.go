@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// Multipart form field names for WebhookFiles.
+const (
+	fileFormKey           = "file"
+	filenameFormKey       = "filename"
+	titleFormKey          = "title"
+	initialCommentFormKey = "initial_comment"
+	threadTSFormKey       = "thread_ts"
+)
+
+// WebhookFiles uploads the file given as multipart/form-data to the channel, so CI systems can attach logs or
+// reports with the same token.
+func (h *ProxyHandler) WebhookFiles(c echo.Context) (err error) {
+	defer func() { recordWebhookRequest(c, err) }()
+	res, ok, err := h.verifyWebhookToken(c, service.ScopeManage)
+	if !ok {
+		return err
+	}
+	ctx := c.Request().Context()
+	if paused, err := h.respondIfPaused(c, res, apierror.WantsJSON(c)); paused {
+		return err
+	}
+
+	fh, err := c.FormFile(fileFormKey)
+	if err != nil {
+		slog.InfoContext(ctx, "FormFile failed, response bad request", slog.String("error", err.Error()))
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeFileRequired, "`file` field is required in multipart/form-data body.\n")
+	}
+	telemetry.RecordPayloadSize(ctx, webhookChannelLabel(c), int(fh.Size))
+	f, err := fh.Open()
+	if err != nil {
+		return errors.Wrap(err, "failed to open uploaded file")
+	}
+	defer f.Close()
+
+	filename := c.FormValue(filenameFormKey)
+	if filename == "" {
+		filename = fh.Filename
+	}
+	params := slack.UploadFileParams{
+		Reader:         f,
+		Size:           int(fh.Size),
+		Filename:       filename,
+		Title:          c.FormValue(titleFormKey),
+		InitialComment: c.FormValue(initialCommentFormKey),
+		ThreadTS:       c.FormValue(threadTSFormKey),
+	}
+	result, err := h.slackClient.UploadFile(ctx, res.ChannelID, res.ChannelName, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "UploadFile failed",
+			slog.String("error", err.Error()),
+			slog.Int64("file size", fh.Size),
+		)
+		return err
+	}
+	return respondSendResult(c, res, result, apierror.WantsJSON(c))
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func setupFilesContext(t *testing.T, fields map[string]string, content string) echo.Context {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		require.NoError(t, w.WriteField(k, v))
+	}
+	if content != "" {
+		fw, err := w.CreateFormFile("file", "build.log")
+		require.NoError(t, err)
+		_, err = io.WriteString(fw, content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/p/test/deadbeef/files", &buf)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetPath("/p/:channel_name/:token/files")
+	c.SetParamNames("channel_name", "token")
+	c.SetParamValues("test", "deadbeef")
+	return c
+}
+
+func TestWebhookFilesOk(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	content := "build failed\n"
+	slackClient.On("UploadFile", mock.Anything, "C123456", "test", mock.MatchedBy(func(p slack.UploadFileParams) bool {
+		b, err := io.ReadAll(p.Reader)
+		return err == nil && string(b) == content &&
+			p.Size == len(content) &&
+			p.Filename == "build.log" &&
+			p.Title == "Build log" &&
+			p.ThreadTS == "1405894322.002768"
+	})).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK, FileID: "F123456"}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+	}
+	c := setupFilesContext(t, map[string]string{"title": "Build log", "thread_ts": "1405894322.002768"}, content)
+	c.Request().Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	err := h.WebhookFiles(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "file_id": "F123456"}`, rec.Body.String())
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookFilesFilenameOverride(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	slackClient.On("UploadFile", mock.Anything, "C123456", "test", mock.MatchedBy(func(p slack.UploadFileParams) bool {
+		return p.Filename == "report.txt"
+	})).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK, FileID: "F123456"}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+	}
+	c := setupFilesContext(t, map[string]string{"filename": "report.txt"}, "content")
+	err := h.WebhookFiles(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, "ok.\n", rec.Body.String())
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookFilesMissingFile(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+	}
+	c := setupFilesContext(t, map[string]string{"title": "no file"}, "")
+	err := h.WebhookFiles(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	slackClient.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookFilesUnmatchToken(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{}, service.ErrTokenUnmatch)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+	}
+	c := setupFilesContext(t, nil, "content")
+	err := h.WebhookFiles(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	slackClient.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -2,9 +2,14 @@ package handler
 
 import (
 	"context"
+	"time"
 
 	slackgo "github.com/slack-go/slack"
 
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/receipt"
+	"github.com/Finatext/belldog/internal/runtimeconfig"
+	"github.com/Finatext/belldog/internal/secret"
 	"github.com/Finatext/belldog/internal/service"
 	"github.com/Finatext/belldog/internal/slack"
 	"github.com/Finatext/belldog/internal/storage"
@@ -12,22 +17,131 @@ import (
 
 type slackClient interface {
 	PostMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error)
+	ScheduleMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error)
+	UpdateMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error)
+	DeleteMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error)
+	AddPin(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error)
+	AddReaction(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error)
+	UploadFile(ctx context.Context, channelID string, channelName string, params slack.UploadFileParams) (slack.PostMessageResult, error)
+	UpsertBookmark(ctx context.Context, channelID string, channelName string, params slack.BookmarkParams) (slack.PostMessageResult, error)
+	UpdateChannelCanvas(ctx context.Context, channelID string, channelName string, markdown string) (slack.PostMessageResult, error)
 	GetAllChannels(ctx context.Context) ([]slackgo.Channel, error)
+	GetChannelsByID(ctx context.Context, channelIDs []string) ([]slackgo.Channel, error)
 	GetFullCommandRequest(ctx context.Context, body string) (slack.SlashCommandRequest, error)
+	PostResponse(ctx context.Context, responseURL string, payload map[string]interface{}) error
+	LookupUserIDByEmail(ctx context.Context, email string) (string, bool, error)
+	GetUserRole(ctx context.Context, userID string) (slack.UserRole, error)
+	GetUserGroupMembers(ctx context.Context, userGroupID string) ([]string, error)
+	GetChannelMembership(ctx context.Context, channelID string) (slack.ChannelMembership, bool, error)
+	AuthTest(ctx context.Context) error
 }
 
 type storageDDB interface {
 	Save(ctx context.Context, rec storage.Record) error
 	QueryByChannelName(ctx context.Context, channelName string) ([]storage.Record, error)
 	Delete(ctx context.Context, rec storage.Record) error
-	ScanAll(ctx context.Context) ([]storage.Record, error)
+	ForEachRecord(ctx context.Context, segments int, fn func(storage.Record) error) error
+	ScanChunk(ctx context.Context, cursor string, limit int) ([]storage.Record, string, error)
+	UpdateStaleNotifiedAt(ctx context.Context, rec storage.Record, timestamp string) error
+	UpdateRotatedAt(ctx context.Context, rec storage.Record, timestamp string) error
+	Archive(ctx context.Context, rec storage.Record, archivedAt string, expiresAt int64) error
+	Revoke(ctx context.Context, rec storage.Record, revokedAt string, expiresAt int64) error
+	Restore(ctx context.Context, rec storage.Record) error
+	ScanByChannelID(ctx context.Context, channelID string) ([]storage.Record, error)
+	Ping(ctx context.Context) error
 }
 
 type tokenService interface {
 	GetTokens(ctx context.Context, channelName string) ([]service.Entry, error)
-	VerifyToken(ctx context.Context, channelName string, givenToken string) (service.VerifyResult, error)
-	GenerateAndSaveToken(ctx context.Context, channelID string, channelName string) (service.GenerateResult, error)
-	RegenerateToken(ctx context.Context, channelID string, channelName string) (service.RegenerateResult, error)
-	RevokeToken(ctx context.Context, channelName string, givenToken string) (service.RevokeResult, error)
-	RevokeRenamedToken(ctx context.Context, channelID string, givenChannelName string, givenToken string) (service.RevokeRenamedResult, error)
+	VerifyToken(ctx context.Context, channelName string, givenToken secret.Token) (service.VerifyResult, error)
+	VerifyTokenByChannelID(ctx context.Context, channelID string, givenToken secret.Token) (service.VerifyResult, error)
+	VerifyTokenByToken(ctx context.Context, givenToken secret.Token) (service.VerifyResult, error)
+	GenerateAndSaveToken(ctx context.Context, channelID string, channelName string, scope service.Scope) (service.GenerateResult, error)
+	RegenerateToken(ctx context.Context, channelID string, channelName string, maxTokenCount int) (service.RegenerateResult, error)
+	RevokeToken(ctx context.Context, channelName string, givenToken secret.Token) error
+	RevokeRenamedToken(ctx context.Context, channelID string, givenChannelName string, givenToken secret.Token) error
+	RestoreToken(ctx context.Context, channelName string, givenToken secret.Token, maxTokenCount int) (secret.Token, error)
+	LookupToken(ctx context.Context, givenToken secret.Token) (service.LookupResult, error)
+	SetMappings(ctx context.Context, channelName string, givenToken secret.Token, rules string) ([]service.MappingRule, error)
+	Presign(ctx context.Context, channelName string, givenToken secret.Token, expiresAt time.Time) (service.PresignResult, error)
+	VerifyPresigned(ctx context.Context, channelName string, prefix string, expires string, signature string) (service.VerifyResult, error)
+	RecordDeliveryFailure(ctx context.Context, res service.VerifyResult, reason string) (int, error)
+	MarkUndeliverable(ctx context.Context, res service.VerifyResult) error
+	ResetDeliveryFailures(ctx context.Context, res service.VerifyResult) error
+}
+
+type auditService interface {
+	Enabled() bool
+	Record(ctx context.Context, entry service.AuditEntry) error
+	GetRecentEntries(ctx context.Context, channelID string) ([]service.AuditEntry, error)
+}
+
+type channelConfigService interface {
+	Enabled() bool
+	GetDefaults(ctx context.Context, channelID string) (service.ChannelDefaults, error)
+	SetDefault(ctx context.Context, channelID string, key string, value string) (service.ChannelDefaults, error)
+	UnsetDefault(ctx context.Context, channelID string, key string) (service.ChannelDefaults, error)
+	GetPauseState(ctx context.Context, channelID string) (service.PauseState, error)
+	Pause(ctx context.Context, channelID string, userID string) (service.PauseState, error)
+	Resume(ctx context.Context, channelID string) (service.PauseState, error)
+}
+
+type idempotencyService interface {
+	Begin(ctx context.Context, channelID string, key string) (service.IdempotentResult, bool, error)
+	Complete(ctx context.Context, channelID string, key string, result service.IdempotentResult) error
+	Abort(ctx context.Context, channelID string, key string) error
+	BeginDedup(ctx context.Context, channelID string, hash string, window time.Duration) (service.Duplicate, bool, error)
+	CompleteDedup(ctx context.Context, channelID string, hash string, ts string) error
+	AbortDedup(ctx context.Context, channelID string, hash string) error
+	opsThreadStore
+}
+
+type digestService interface {
+	Enabled() bool
+	Buffer(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) error
+	Pending(ctx context.Context) ([]service.PendingDigest, error)
+	Ack(ctx context.Context, digest service.PendingDigest) error
+}
+
+type broadcastService interface {
+	Enabled() bool
+	CreateGroup(ctx context.Context, groupName string, userID string) (service.BroadcastGroup, error)
+	GetGroup(ctx context.Context, groupName string) (service.BroadcastGroup, error)
+	VerifyGroupToken(ctx context.Context, groupName string, givenToken secret.Token) (service.BroadcastGroup, error)
+	AddMember(ctx context.Context, groupName string, channelID string, channelName string) (service.BroadcastGroup, error)
+	RemoveMember(ctx context.Context, groupName string, channelID string) (service.BroadcastGroup, error)
+	DeleteGroup(ctx context.Context, groupName string) error
+}
+
+type mentionService interface {
+	ResolveMentions(ctx context.Context, payload map[string]interface{}) error
+}
+
+type lifecycleService interface {
+	Publish(ctx context.Context, evt service.LifecycleEvent) error
+}
+
+type inventoryService interface {
+	Cached(ctx context.Context) ([]service.InventoryChannel, bool, error)
+	Replace(ctx context.Context, channels []service.InventoryChannel) error
+	Rename(ctx context.Context, channelID string, name string) error
+	SetArchived(ctx context.Context, channelID string, archived bool) error
+}
+
+type receiptEmitter interface {
+	Enabled() bool
+	Emit(ctx context.Context, r receipt.Receipt) error
+}
+
+// runtimeSettings provides the settings changeable without deployment.
+type runtimeSettings interface {
+	Settings(ctx context.Context) runtimeconfig.Settings
+}
+
+// currentSettings falls back to the env config when no runtime settings are given, e.g. in tests.
+func currentSettings(ctx context.Context, cfg appconfig.Config, settings runtimeSettings) runtimeconfig.Settings {
+	if settings == nil {
+		return runtimeconfig.FromConfig(cfg)
+	}
+	return settings.Settings(ctx)
 }
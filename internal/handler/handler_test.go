@@ -2,10 +2,12 @@ package handler
 
 import (
 	"context"
+	"time"
 
 	slackgo "github.com/slack-go/slack"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/Finatext/belldog/internal/secret"
 	"github.com/Finatext/belldog/internal/service"
 	"github.com/Finatext/belldog/internal/slack"
 	"github.com/Finatext/belldog/internal/storage"
@@ -20,38 +22,163 @@ func (m *mockSlackClient) PostMessage(ctx context.Context, channelID string, cha
 	return args.Get(0).(slack.PostMessageResult), args.Error(1)
 }
 
+func (m *mockSlackClient) ScheduleMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+	args := m.Called(ctx, channelID, channelName, payload)
+	return args.Get(0).(slack.PostMessageResult), args.Error(1)
+}
+
+func (m *mockSlackClient) UpdateMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+	args := m.Called(ctx, channelID, channelName, payload)
+	return args.Get(0).(slack.PostMessageResult), args.Error(1)
+}
+
+func (m *mockSlackClient) DeleteMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+	args := m.Called(ctx, channelID, channelName, payload)
+	return args.Get(0).(slack.PostMessageResult), args.Error(1)
+}
+
+func (m *mockSlackClient) AddPin(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+	args := m.Called(ctx, channelID, channelName, payload)
+	return args.Get(0).(slack.PostMessageResult), args.Error(1)
+}
+
+func (m *mockSlackClient) AddReaction(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+	args := m.Called(ctx, channelID, channelName, payload)
+	return args.Get(0).(slack.PostMessageResult), args.Error(1)
+}
+
+func (m *mockSlackClient) UploadFile(ctx context.Context, channelID string, channelName string, params slack.UploadFileParams) (slack.PostMessageResult, error) {
+	args := m.Called(ctx, channelID, channelName, params)
+	return args.Get(0).(slack.PostMessageResult), args.Error(1)
+}
+
+func (m *mockSlackClient) UpsertBookmark(ctx context.Context, channelID string, channelName string, params slack.BookmarkParams) (slack.PostMessageResult, error) {
+	args := m.Called(ctx, channelID, channelName, params)
+	return args.Get(0).(slack.PostMessageResult), args.Error(1)
+}
+
+func (m *mockSlackClient) UpdateChannelCanvas(ctx context.Context, channelID string, channelName string, markdown string) (slack.PostMessageResult, error) {
+	args := m.Called(ctx, channelID, channelName, markdown)
+	return args.Get(0).(slack.PostMessageResult), args.Error(1)
+}
+
 func (m *mockSlackClient) GetAllChannels(ctx context.Context) ([]slackgo.Channel, error) {
 	args := m.Called(ctx)
 	return args.Get(0).([]slackgo.Channel), args.Error(1)
 }
 
+func (m *mockSlackClient) GetChannelsByID(ctx context.Context, channelIDs []string) ([]slackgo.Channel, error) {
+	args := m.Called(ctx, channelIDs)
+	return args.Get(0).([]slackgo.Channel), args.Error(1)
+}
+
 func (m *mockSlackClient) GetFullCommandRequest(ctx context.Context, body string) (slack.SlashCommandRequest, error) {
 	args := m.Called(ctx, body)
 	return args.Get(0).(slack.SlashCommandRequest), args.Error(1)
 }
 
+func (m *mockSlackClient) PostResponse(ctx context.Context, responseURL string, payload map[string]interface{}) error {
+	args := m.Called(ctx, responseURL, payload)
+	return args.Error(0)
+}
+
+func (m *mockSlackClient) GetUserRole(ctx context.Context, userID string) (slack.UserRole, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(slack.UserRole), args.Error(1)
+}
+
+func (m *mockSlackClient) GetUserGroupMembers(ctx context.Context, userGroupID string) ([]string, error) {
+	args := m.Called(ctx, userGroupID)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockSlackClient) GetChannelMembership(ctx context.Context, channelID string) (slack.ChannelMembership, bool, error) {
+	args := m.Called(ctx, channelID)
+	return args.Get(0).(slack.ChannelMembership), args.Bool(1), args.Error(2)
+}
+
+func (m *mockSlackClient) LookupUserIDByEmail(ctx context.Context, email string) (string, bool, error) {
+	args := m.Called(ctx, email)
+	return args.String(0), args.Bool(1), args.Error(2)
+}
+
+func (m *mockSlackClient) AuthTest(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
 type mockTokenService struct {
 	mock.Mock
 }
 
-func (m *mockTokenService) VerifyToken(ctx context.Context, channelName string, givenToken string) (service.VerifyResult, error) {
-	args := m.Called(ctx, channelName, givenToken)
+func (m *mockTokenService) VerifyToken(ctx context.Context, channelName string, givenToken secret.Token) (service.VerifyResult, error) {
+	args := m.Called(ctx, channelName, givenToken.Reveal())
 	return args.Get(0).(service.VerifyResult), args.Error(1)
 }
 
-func (m *mockTokenService) GenerateAndSaveToken(ctx context.Context, channelID string, channelName string) (service.GenerateResult, error) {
-	args := m.Called(ctx, channelID, channelName)
+func (m *mockTokenService) VerifyTokenByChannelID(ctx context.Context, channelID string, givenToken secret.Token) (service.VerifyResult, error) {
+	args := m.Called(ctx, channelID, givenToken.Reveal())
+	return args.Get(0).(service.VerifyResult), args.Error(1)
+}
+
+func (m *mockTokenService) GenerateAndSaveToken(ctx context.Context, channelID string, channelName string, scope service.Scope) (service.GenerateResult, error) {
+	args := m.Called(ctx, channelID, channelName, scope)
 	return args.Get(0).(service.GenerateResult), args.Error(1)
 }
 
-func (m *mockTokenService) RevokeToken(ctx context.Context, channelName string, givenToken string) (service.RevokeResult, error) {
-	args := m.Called(ctx, channelName, givenToken)
-	return args.Get(0).(service.RevokeResult), args.Error(1)
+func (m *mockTokenService) RevokeToken(ctx context.Context, channelName string, givenToken secret.Token) error {
+	args := m.Called(ctx, channelName, givenToken.Reveal())
+	return args.Error(0)
+}
+
+func (m *mockTokenService) RevokeRenamedToken(ctx context.Context, channelID string, givenChannelName string, givenToken secret.Token) error {
+	args := m.Called(ctx, channelID, givenChannelName, givenToken.Reveal())
+	return args.Error(0)
 }
 
-func (m *mockTokenService) RevokeRenamedToken(ctx context.Context, channelID string, givenChannelName string, givenToken string) (service.RevokeRenamedResult, error) {
-	args := m.Called(ctx, channelID, givenChannelName, givenToken)
-	return args.Get(0).(service.RevokeRenamedResult), args.Error(1)
+func (m *mockTokenService) RestoreToken(ctx context.Context, channelName string, givenToken secret.Token, maxTokenCount int) (secret.Token, error) {
+	args := m.Called(ctx, channelName, givenToken.Reveal(), maxTokenCount)
+	return secret.Token(args.String(0)), args.Error(1)
+}
+
+func (m *mockTokenService) SetMappings(ctx context.Context, channelName string, givenToken secret.Token, rules string) ([]service.MappingRule, error) {
+	args := m.Called(ctx, channelName, givenToken.Reveal(), rules)
+	return args.Get(0).([]service.MappingRule), args.Error(1)
+}
+
+func (m *mockTokenService) RecordDeliveryFailure(ctx context.Context, res service.VerifyResult, reason string) (int, error) {
+	args := m.Called(ctx, res, reason)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockTokenService) MarkUndeliverable(ctx context.Context, res service.VerifyResult) error {
+	args := m.Called(ctx, res)
+	return args.Error(0)
+}
+
+func (m *mockTokenService) ResetDeliveryFailures(ctx context.Context, res service.VerifyResult) error {
+	args := m.Called(ctx, res)
+	return args.Error(0)
+}
+
+func (m *mockTokenService) Presign(ctx context.Context, channelName string, givenToken secret.Token, expiresAt time.Time) (service.PresignResult, error) {
+	args := m.Called(ctx, channelName, givenToken.Reveal(), expiresAt)
+	return args.Get(0).(service.PresignResult), args.Error(1)
+}
+
+func (m *mockTokenService) VerifyPresigned(ctx context.Context, channelName string, prefix string, expires string, signature string) (service.VerifyResult, error) {
+	args := m.Called(ctx, channelName, prefix, expires, signature)
+	return args.Get(0).(service.VerifyResult), args.Error(1)
+}
+
+func (m *mockTokenService) VerifyTokenByToken(ctx context.Context, givenToken secret.Token) (service.VerifyResult, error) {
+	args := m.Called(ctx, givenToken.Reveal())
+	return args.Get(0).(service.VerifyResult), args.Error(1)
+}
+
+func (m *mockTokenService) LookupToken(ctx context.Context, givenToken secret.Token) (service.LookupResult, error) {
+	args := m.Called(ctx, givenToken.Reveal())
+	return args.Get(0).(service.LookupResult), args.Error(1)
 }
 
 func (m *mockTokenService) GetTokens(ctx context.Context, channelName string) ([]service.Entry, error) {
@@ -59,8 +186,8 @@ func (m *mockTokenService) GetTokens(ctx context.Context, channelName string) ([
 	return args.Get(0).([]service.Entry), args.Error(1)
 }
 
-func (m *mockTokenService) RegenerateToken(ctx context.Context, channelID string, channelName string) (service.RegenerateResult, error) {
-	args := m.Called(ctx, channelID, channelName)
+func (m *mockTokenService) RegenerateToken(ctx context.Context, channelID string, channelName string, maxTokenCount int) (service.RegenerateResult, error) {
+	args := m.Called(ctx, channelID, channelName, maxTokenCount)
 	return args.Get(0).(service.RegenerateResult), args.Error(1)
 }
 
@@ -83,7 +210,282 @@ func (m *mockStorageDDB) Delete(ctx context.Context, rec storage.Record) error {
 	return args.Error(0)
 }
 
-func (m *mockStorageDDB) ScanAll(ctx context.Context) ([]storage.Record, error) {
+func (m *mockStorageDDB) Archive(ctx context.Context, rec storage.Record, archivedAt string, expiresAt int64) error {
+	args := m.Called(ctx, rec, archivedAt, expiresAt)
+	return args.Error(0)
+}
+
+func (m *mockStorageDDB) Revoke(ctx context.Context, rec storage.Record, revokedAt string, expiresAt int64) error {
+	args := m.Called(ctx, rec, revokedAt, expiresAt)
+	return args.Error(0)
+}
+
+func (m *mockStorageDDB) Restore(ctx context.Context, rec storage.Record) error {
+	args := m.Called(ctx, rec)
+	return args.Error(0)
+}
+
+func (m *mockStorageDDB) UpdateStaleNotifiedAt(ctx context.Context, rec storage.Record, timestamp string) error {
+	args := m.Called(ctx, rec, timestamp)
+	return args.Error(0)
+}
+
+func (m *mockStorageDDB) UpdateRotatedAt(ctx context.Context, rec storage.Record, timestamp string) error {
+	args := m.Called(ctx, rec, timestamp)
+	return args.Error(0)
+}
+
+// ForEachRecord calls fn with the records given to Return.
+func (m *mockStorageDDB) ForEachRecord(ctx context.Context, segments int, fn func(storage.Record) error) error {
 	args := m.Called(ctx)
+	for _, rec := range args.Get(0).([]storage.Record) {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *mockStorageDDB) ScanChunk(ctx context.Context, cursor string, limit int) ([]storage.Record, string, error) {
+	args := m.Called(ctx, cursor, limit)
+	return args.Get(0).([]storage.Record), args.String(1), args.Error(2)
+}
+
+func (m *mockStorageDDB) ScanByChannelID(ctx context.Context, channelID string) ([]storage.Record, error) {
+	args := m.Called(ctx, channelID)
 	return args.Get(0).([]storage.Record), args.Error(1)
 }
+
+func (m *mockStorageDDB) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+type mockAuditService struct {
+	mock.Mock
+}
+
+func (m *mockAuditService) Enabled() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+func (m *mockAuditService) Record(ctx context.Context, entry service.AuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *mockAuditService) GetRecentEntries(ctx context.Context, channelID string) ([]service.AuditEntry, error) {
+	args := m.Called(ctx, channelID)
+	return args.Get(0).([]service.AuditEntry), args.Error(1)
+}
+
+type mockLifecycleService struct {
+	mock.Mock
+}
+
+func (m *mockLifecycleService) Publish(ctx context.Context, evt service.LifecycleEvent) error {
+	args := m.Called(ctx, evt)
+	return args.Error(0)
+}
+
+type mockInventoryService struct {
+	mock.Mock
+}
+
+func (m *mockInventoryService) Cached(ctx context.Context) ([]service.InventoryChannel, bool, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]service.InventoryChannel), args.Bool(1), args.Error(2)
+}
+
+func (m *mockInventoryService) Replace(ctx context.Context, channels []service.InventoryChannel) error {
+	args := m.Called(ctx, channels)
+	return args.Error(0)
+}
+
+func (m *mockInventoryService) Rename(ctx context.Context, channelID string, name string) error {
+	args := m.Called(ctx, channelID, name)
+	return args.Error(0)
+}
+
+func (m *mockInventoryService) SetArchived(ctx context.Context, channelID string, archived bool) error {
+	args := m.Called(ctx, channelID, archived)
+	return args.Error(0)
+}
+
+type mockChannelConfigService struct {
+	mock.Mock
+}
+
+func (m *mockChannelConfigService) Enabled() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+func (m *mockChannelConfigService) GetDefaults(ctx context.Context, channelID string) (service.ChannelDefaults, error) {
+	args := m.Called(ctx, channelID)
+	return args.Get(0).(service.ChannelDefaults), args.Error(1)
+}
+
+func (m *mockChannelConfigService) SetDefault(ctx context.Context, channelID string, key string, value string) (service.ChannelDefaults, error) {
+	args := m.Called(ctx, channelID, key, value)
+	return args.Get(0).(service.ChannelDefaults), args.Error(1)
+}
+
+func (m *mockChannelConfigService) UnsetDefault(ctx context.Context, channelID string, key string) (service.ChannelDefaults, error) {
+	args := m.Called(ctx, channelID, key)
+	return args.Get(0).(service.ChannelDefaults), args.Error(1)
+}
+
+func (m *mockChannelConfigService) GetPauseState(ctx context.Context, channelID string) (service.PauseState, error) {
+	args := m.Called(ctx, channelID)
+	return args.Get(0).(service.PauseState), args.Error(1)
+}
+
+func (m *mockChannelConfigService) Pause(ctx context.Context, channelID string, userID string) (service.PauseState, error) {
+	args := m.Called(ctx, channelID, userID)
+	return args.Get(0).(service.PauseState), args.Error(1)
+}
+
+func (m *mockChannelConfigService) Resume(ctx context.Context, channelID string) (service.PauseState, error) {
+	args := m.Called(ctx, channelID)
+	return args.Get(0).(service.PauseState), args.Error(1)
+}
+
+// For tests not related to per-channel defaults.
+func disabledChannelConfigService() *service.ChannelConfigService {
+	svc := service.NewChannelConfigService(nil)
+	return &svc
+}
+
+type mockMentionService struct {
+	mock.Mock
+}
+
+func (m *mockMentionService) ResolveMentions(ctx context.Context, payload map[string]interface{}) error {
+	args := m.Called(ctx, payload)
+	return args.Error(0)
+}
+
+// For tests not related to mentions.
+func disabledMentionService() *service.MentionService {
+	return service.NewMentionService(nil, 0)
+}
+
+type mockIdempotencyService struct {
+	mock.Mock
+}
+
+func (m *mockIdempotencyService) Begin(ctx context.Context, channelID string, key string) (service.IdempotentResult, bool, error) {
+	args := m.Called(ctx, channelID, key)
+	return args.Get(0).(service.IdempotentResult), args.Bool(1), args.Error(2)
+}
+
+func (m *mockIdempotencyService) Complete(ctx context.Context, channelID string, key string, result service.IdempotentResult) error {
+	args := m.Called(ctx, channelID, key, result)
+	return args.Error(0)
+}
+
+func (m *mockIdempotencyService) Abort(ctx context.Context, channelID string, key string) error {
+	args := m.Called(ctx, channelID, key)
+	return args.Error(0)
+}
+
+func (m *mockIdempotencyService) BeginDedup(ctx context.Context, channelID string, hash string, window time.Duration) (service.Duplicate, bool, error) {
+	args := m.Called(ctx, channelID, hash, window)
+	return args.Get(0).(service.Duplicate), args.Bool(1), args.Error(2)
+}
+
+func (m *mockIdempotencyService) CompleteDedup(ctx context.Context, channelID string, hash string, ts string) error {
+	args := m.Called(ctx, channelID, hash, ts)
+	return args.Error(0)
+}
+
+func (m *mockIdempotencyService) AbortDedup(ctx context.Context, channelID string, hash string) error {
+	args := m.Called(ctx, channelID, hash)
+	return args.Error(0)
+}
+
+func (m *mockIdempotencyService) BeginOpsThread(ctx context.Context, channel string, day string) (string, bool, error) {
+	args := m.Called(ctx, channel, day)
+	return args.String(0), args.Bool(1), args.Error(2)
+}
+
+func (m *mockIdempotencyService) CompleteOpsThread(ctx context.Context, channel string, day string, ts string, expiresAt time.Time) error {
+	args := m.Called(ctx, channel, day, ts, expiresAt)
+	return args.Error(0)
+}
+
+func (m *mockIdempotencyService) AbortOpsThread(ctx context.Context, channel string, day string) error {
+	args := m.Called(ctx, channel, day)
+	return args.Error(0)
+}
+
+type mockDigestService struct {
+	mock.Mock
+}
+
+func (m *mockDigestService) Enabled() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+func (m *mockDigestService) Buffer(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) error {
+	args := m.Called(ctx, channelID, channelName, payload)
+	return args.Error(0)
+}
+
+func (m *mockDigestService) Pending(ctx context.Context) ([]service.PendingDigest, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]service.PendingDigest), args.Error(1)
+}
+
+func (m *mockDigestService) Ack(ctx context.Context, digest service.PendingDigest) error {
+	args := m.Called(ctx, digest)
+	return args.Error(0)
+}
+
+// For tests not related to digests.
+func disabledDigestService() *service.DigestService {
+	svc := service.NewDigestService(nil)
+	return &svc
+}
+
+type mockBroadcastService struct {
+	mock.Mock
+}
+
+func (m *mockBroadcastService) Enabled() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+func (m *mockBroadcastService) CreateGroup(ctx context.Context, groupName string, userID string) (service.BroadcastGroup, error) {
+	args := m.Called(ctx, groupName, userID)
+	return args.Get(0).(service.BroadcastGroup), args.Error(1)
+}
+
+func (m *mockBroadcastService) GetGroup(ctx context.Context, groupName string) (service.BroadcastGroup, error) {
+	args := m.Called(ctx, groupName)
+	return args.Get(0).(service.BroadcastGroup), args.Error(1)
+}
+
+func (m *mockBroadcastService) VerifyGroupToken(ctx context.Context, groupName string, givenToken secret.Token) (service.BroadcastGroup, error) {
+	args := m.Called(ctx, groupName, givenToken.Reveal())
+	return args.Get(0).(service.BroadcastGroup), args.Error(1)
+}
+
+func (m *mockBroadcastService) AddMember(ctx context.Context, groupName string, channelID string, channelName string) (service.BroadcastGroup, error) {
+	args := m.Called(ctx, groupName, channelID, channelName)
+	return args.Get(0).(service.BroadcastGroup), args.Error(1)
+}
+
+func (m *mockBroadcastService) RemoveMember(ctx context.Context, groupName string, channelID string) (service.BroadcastGroup, error) {
+	args := m.Called(ctx, groupName, channelID)
+	return args.Get(0).(service.BroadcastGroup), args.Error(1)
+}
+
+func (m *mockBroadcastService) DeleteGroup(ctx context.Context, groupName string) error {
+	args := m.Called(ctx, groupName)
+	return args.Error(0)
+}
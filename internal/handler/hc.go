@@ -1,19 +1,108 @@
 package handler
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
+// Each dependency check is bounded by this timeout, so monitors get the response before their own timeout.
+const deepHealthCheckTimeout = 3 * time.Second
+
+const (
+	healthOK = "ok"
+	healthNG = "ng"
+)
+
+type dependencyHealth struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+type deepHealthResponse struct {
+	Message      string                      `json:"message"`
+	RegionRole   string                      `json:"region_role,omitempty"`
+	Dependencies map[string]dependencyHealth `json:"dependencies"`
+}
+
+// HealthCheck responds the process is alive. With `?deep=1`, it also checks DynamoDB and Slack API connectivity
+// and responds per-dependency status. Errors are logged but not responded because `/hc` is not authenticated.
+// The region role is responded so failover tooling can tell which region is active.
 func (h *ProxyHandler) HealthCheck(c echo.Context) error {
 	resp := map[string]string{
-		"message": "ok",
+		"message": healthOK,
+	}
+	if role := currentSettings(c.Request().Context(), h.cfg, h.settings).RegionRole; role != "" {
+		resp["region_role"] = role
 	}
 	if os.Getenv("HEALTH_CHECK_OK") == "0" {
-		resp["message"] = "ng"
+		resp["message"] = healthNG
 		return c.JSON(http.StatusServiceUnavailable, resp)
 	}
+	if c.QueryParam("deep") == "1" {
+		return h.deepHealthCheck(c)
+	}
 	return c.JSON(http.StatusOK, resp)
 }
+
+func (h *ProxyHandler) deepHealthCheck(c echo.Context) error {
+	ctx := c.Request().Context()
+	deps := checkDependencies(ctx, h.ddb, h.slackClient)
+	resp := deepHealthResponse{
+		Message:      overallHealth(deps),
+		RegionRole:   currentSettings(ctx, h.cfg, h.settings).RegionRole,
+		Dependencies: deps,
+	}
+
+	if resp.Message != healthOK {
+		return c.JSON(http.StatusServiceUnavailable, resp)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// checkDependencies calls DynamoDB and Slack API concurrently without side effects. Failures are logged.
+func checkDependencies(ctx context.Context, ddb storageDDB, slackClient slackClient) map[string]dependencyHealth {
+	checks := map[string]func(context.Context) error{
+		"dynamodb": ddb.Ping,
+		"slack":    slackClient.AuthTest,
+	}
+	ret := make(map[string]dependencyHealth, len(checks))
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, deepHealthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			err := check(ctx)
+			health := dependencyHealth{Status: healthOK, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				slog.WarnContext(ctx, "dependency health check failed", slog.String("dependency", name), slog.String("error", err.Error()))
+				health.Status = healthNG
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			ret[name] = health
+		}()
+	}
+	wg.Wait()
+	return ret
+}
+
+func overallHealth(deps map[string]dependencyHealth) string {
+	for _, health := range deps {
+		if health.Status != healthOK {
+			return healthNG
+		}
+	}
+	return healthOK
+}
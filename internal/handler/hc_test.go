@@ -1,12 +1,15 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/cockroachdb/errors"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
 	"github.com/Finatext/belldog/internal/appconfig"
@@ -29,3 +32,60 @@ func TestHcOK(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, http.StatusOK, c.Response().Status)
 }
+
+func TestHcDeep(t *testing.T) {
+	tests := []struct {
+		name       string
+		pingErr    error
+		authErr    error
+		wantStatus int
+		wantBody   deepHealthResponse
+	}{
+		{
+			name:       "ok",
+			wantStatus: http.StatusOK,
+			wantBody: deepHealthResponse{Message: "ok", Dependencies: map[string]dependencyHealth{
+				"dynamodb": {Status: "ok"},
+				"slack":    {Status: "ok"},
+			}},
+		},
+		{
+			name:       "slack outage",
+			authErr:    errors.New("invalid_auth"),
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody: deepHealthResponse{Message: "ng", Dependencies: map[string]dependencyHealth{
+				"dynamodb": {Status: "ok"},
+				"slack":    {Status: "ng"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			slackClient.On("AuthTest", mock.Anything).Return(tt.authErr)
+			ddb := &mockStorageDDB{}
+			ddb.On("Ping", mock.Anything).Return(tt.pingErr)
+			h := ProxyHandler{
+				cfg:         appconfig.Config{},
+				slackClient: slackClient,
+				ddb:         ddb,
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/hc?deep=1", nil)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			err := h.HealthCheck(c)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			var body deepHealthResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			// Latency varies.
+			for name, health := range body.Dependencies {
+				health.LatencyMs = 0
+				body.Dependencies[name] = health
+			}
+			assert.Equal(t, tt.wantBody, body)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	slackgo "github.com/slack-go/slack"
+
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// processCmdHelp lists the commands available for this Belldog instance. Unknown commands also show this.
+func (h *ProxyHandler) processCmdHelp(c echo.Context, _ slack.SlashCommandRequest) error {
+	blocks := []slackgo.Block{
+		slackgo.NewHeaderBlock(slackgo.NewTextBlockObject(slackgo.PlainTextType, "Belldog commands", false, false)),
+	}
+	registry := commandRegistry()
+	lines := make([]string, 0, len(registry))
+	for _, spec := range registry {
+		if spec.enabled != nil && !spec.enabled(h) {
+			continue
+		}
+		text := fmt.Sprintf("*`%s`*\n%s", commandUsage(spec), spec.description)
+		for _, example := range spec.examples {
+			text += fmt.Sprintf("\nExample: `%s`", example)
+		}
+		blocks = append(blocks, slackgo.NewSectionBlock(slackgo.NewTextBlockObject(slackgo.MarkdownType, text, false, false), nil, nil))
+		lines = append(lines, fmt.Sprintf("- %s: %s", commandUsage(spec), spec.description))
+	}
+
+	// Text is the fallback for notifications and clients not supporting blocks.
+	payload := map[string]interface{}{
+		"text":          fmt.Sprintf("Belldog commands:\n%s\n", strings.Join(lines, "\n")),
+		"blocks":        blocks,
+		"response_type": "ephemeral",
+	}
+	return c.JSON(http.StatusOK, payload)
+}
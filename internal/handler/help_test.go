@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+)
+
+func TestCmdHelpListsEnabledCommands(t *testing.T) {
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Enabled").Return(true)
+	broadcastSvc := service.NewBroadcastService(nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		auditSvc:         auditSvc,
+		channelConfigSvc: disabledChannelConfigService(),
+		broadcastSvc:     &broadcastSvc,
+	}
+	c, rec := setupCommandContext()
+	err := h.processCmdHelp(c, defaultCmdReq)
+
+	require.NoError(t, err)
+	var resp struct {
+		Text         string                   `json:"text"`
+		ResponseType string                   `json:"response_type"`
+		Blocks       []map[string]interface{} `json:"blocks"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "ephemeral", resp.ResponseType)
+	assert.Contains(t, resp.Text, cmdAudit)
+	assert.Contains(t, resp.Text, cmdRevoke+" <token>")
+	assert.NotContains(t, resp.Text, cmdPause)
+	assert.NotContains(t, resp.Text, cmdLookup)
+	assert.NotContains(t, resp.Text, cmdBroadcast)
+	// header and a section per enabled command
+	assert.Len(t, resp.Blocks, 10)
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+	slackgo "github.com/slack-go/slack"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+const (
+	actionIDRevokeApprove = "revoke_approve"
+	actionIDRevokeCancel  = "revoke_cancel"
+)
+
+// revokeState is embedded into the confirmation buttons to carry the original command to the interaction.
+// Slack signs interaction payloads, so users cannot tamper with it.
+type revokeState struct {
+	Command     string `json:"command"`
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Text        string `json:"text"`
+}
+
+// Respond with ephemeral confirmation message instead of revoking immediately. The token is revoked when
+// the user approves it: see Interactive.
+func confirmRevokeResponse(c echo.Context, cmdReq slack.SlashCommandRequest, channelName string, token secret.Token) error {
+	state, err := json.Marshal(revokeState{
+		Command:     cmdReq.Command,
+		ChannelID:   cmdReq.ChannelID,
+		ChannelName: cmdReq.ChannelName,
+		Text:        cmdReq.Text,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal revoke state")
+	}
+
+	text := fmt.Sprintf("Revoke token? Webhook URLs using this token will stop working: channel_name=%s, token=%s", channelName, token.Reveal())
+	approve := slackgo.NewButtonBlockElement(actionIDRevokeApprove, string(state), slackgo.NewTextBlockObject(slackgo.PlainTextType, "Revoke", false, false))
+	approve.Style = slackgo.StyleDanger
+	cancel := slackgo.NewButtonBlockElement(actionIDRevokeCancel, string(state), slackgo.NewTextBlockObject(slackgo.PlainTextType, "Cancel", false, false))
+	blocks := []slackgo.Block{
+		slackgo.NewSectionBlock(slackgo.NewTextBlockObject(slackgo.MarkdownType, text, false, false), nil, nil),
+		slackgo.NewActionBlock("revoke_confirmation", approve, cancel),
+	}
+
+	payload := map[string]interface{}{
+		"text":          text,
+		"blocks":        blocks,
+		"response_type": "ephemeral",
+	}
+	return c.JSON(http.StatusOK, payload)
+}
+
+// Interactive handles button clicks on confirmation messages.
+// https://api.slack.com/interactivity/handling
+func (h *ProxyHandler) Interactive(c echo.Context) error {
+	ctx := c.Request().Context()
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read request body")
+	}
+	if !h.verifySlackRequest(ctx, c.Request().Header, string(body)) {
+		return apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidSignature, "Invalid request signature.\n")
+	}
+
+	action, err := slack.ParseBlockAction(string(body))
+	if err != nil {
+		slog.InfoContext(ctx, "ParseBlockAction failed, response bad request", slog.String("error", err.Error()))
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid body given.\n")
+	}
+	var state revokeState
+	if err := json.Unmarshal([]byte(action.Value), &state); err != nil {
+		slog.InfoContext(ctx, "invalid action value given, response bad request", slog.String("error", err.Error()))
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAction, "Invalid action value given.\n")
+	}
+	slog.InfoContext(ctx, "action given",
+		slog.String("action_id", action.ActionID),
+		slog.String("command", state.Command),
+		slog.String("channel_id", action.ChannelID),
+		slog.String("user_id", action.UserID),
+	)
+	if action.ChannelID != state.ChannelID {
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAction, "Channel mismatch.\n")
+	}
+
+	var msg string
+	switch action.ActionID {
+	case actionIDRevokeApprove:
+		cmdReq := revokeCommandRequest(action, state)
+		// Approvals revoke tokens without the command middlewares, so check the region and the user who approves here.
+		if currentSettings(ctx, h.cfg, h.settings).Passive() {
+			slog.InfoContext(ctx, "token operation refused in passive region", slog.String("command", state.Command))
+			msg = passiveRegionMessage
+			break
+		}
+		allowed, err := h.isAuthorized(ctx, action.UserID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			slog.InfoContext(ctx, "permission denied", slog.String("command", state.Command), slog.String("user_id", action.UserID))
+			h.recordAudit(ctx, cmdReq, auditResultPermissionDenied)
+			msg = permissionDeniedMessage
+			break
+		}
+		msg, err = h.approveRevoke(ctx, cmdReq)
+		if err != nil {
+			return err
+		}
+	case actionIDRevokeCancel:
+		msg = "Revocation canceled.\n"
+	default:
+		slog.InfoContext(ctx, "unknown action given", slog.String("action_id", action.ActionID))
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAction, "Unknown action.\n")
+	}
+
+	// Responses to block_actions are ignored, so update the confirmation message via response_url.
+	payload := map[string]interface{}{
+		"text":             msg,
+		"replace_original": true,
+	}
+	if err := h.slackClient.PostResponse(ctx, action.ResponseURL, payload); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// revokeCommandRequest rebuilds the revoke command confirmed by the user.
+func revokeCommandRequest(action slack.BlockAction, state revokeState) slack.SlashCommandRequest {
+	return slack.SlashCommandRequest{
+		OriginalSlashCommandRequest: slack.OriginalSlashCommandRequest{
+			Command:   state.Command,
+			ChannelID: state.ChannelID,
+			Text:      state.Text,
+			UserID:    action.UserID,
+			UserName:  action.UserName,
+		},
+		ChannelName: state.ChannelName,
+		Supported:   true,
+	}
+}
+
+func (h *ProxyHandler) approveRevoke(ctx context.Context, cmdReq slack.SlashCommandRequest) (string, error) {
+	switch cmdReq.Command {
+	case cmdRevoke:
+		return h.revoke(ctx, cmdReq)
+	case cmdRevokeRenamed:
+		args := commandArgsOf(cmdReq).positional
+		if len(args) != slashCommandArgSize {
+			return "", errors.Newf("invalid revoke renamed state: %s", cmdReq.Text)
+		}
+		return h.revokeRenamed(ctx, cmdReq, args[0], secret.Token(args[1]))
+	default:
+		return "", errors.Newf("unexpected command in revoke state: %s", cmdReq.Command)
+	}
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/runtimeconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func blockActionBody(t *testing.T, actionID string, channelID string, state revokeState) string {
+	t.Helper()
+	value, err := json.Marshal(state)
+	require.NoError(t, err)
+	payload := map[string]interface{}{
+		"type":         "block_actions",
+		"user":         map[string]string{"id": "U123456", "name": "alice"},
+		"channel":      map[string]string{"id": channelID, "name": "test"},
+		"response_url": "https://hooks.slack.com/actions/T123/456/abc",
+		"actions": []map[string]string{
+			{"type": "button", "action_id": actionID, "block_id": "revoke_confirmation", "value": string(value)},
+		},
+	}
+	b, err := json.Marshal(payload)
+	require.NoError(t, err)
+	f := make(url.Values)
+	f.Set("payload", string(b))
+	return f.Encode()
+}
+
+func newInteractiveTestHandler(slackClient *mockSlackClient, svc *mockTokenService) ProxyHandler {
+	cfg := defaultConfig
+	cfg.SlackSigningSecret = testSigningSecret
+	cfg.RevokeConfirmation = true
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Record", mock.Anything, mock.Anything).Return(nil)
+	return ProxyHandler{
+		cfg:         cfg,
+		slackClient: slackClient,
+		tokenSvc:    svc,
+		auditSvc:    auditSvc,
+	}
+}
+
+var defaultRevokeState = revokeState{
+	Command:     cmdRevoke,
+	ChannelID:   "C123456",
+	ChannelName: "test",
+	Text:        "deadbeef",
+}
+
+func TestCmdRevokeConfirmation(t *testing.T) {
+	svc := &mockTokenService{}
+	h := newInteractiveTestHandler(&mockSlackClient{}, svc)
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRevoke
+	cmdReq.Text = "deadbeef"
+	c, rec := setupCommandContext()
+	err := h.processCmdRevoke(c, cmdReq)
+
+	require.NoError(t, err)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "ephemeral", resp["response_type"])
+	assert.Len(t, resp["blocks"], 2)
+	svc.AssertNotCalled(t, "RevokeToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestInteractiveApproveRevoke(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("RevokeToken", mock.Anything, "test", testPrefixedToken).Return(nil)
+	// Revoked tokens can be restored in the grace period, so the response references the token by its prefix.
+	responseMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		return strings.HasPrefix(text, "Token revoked: channel_name=test, token=bd_ab12\nRevoked by mistake? Restore the token with `/belldog-restore bd_ab12`") &&
+			!strings.Contains(text, "0123456789abcdef") && payload["replace_original"] == true
+	})
+	slackClient.On("PostResponse", mock.Anything, "https://hooks.slack.com/actions/T123/456/abc", responseMatcher).Return(nil)
+
+	h := newInteractiveTestHandler(slackClient, svc)
+	h.cfg.RevokeGracePeriod = 24 * time.Hour
+	state := defaultRevokeState
+	state.Text = testPrefixedToken
+	c, rec := setupSignedContext("/interactive", blockActionBody(t, actionIDRevokeApprove, "C123456", state))
+	err := h.Interactive(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	svc.AssertExpectations(t)
+	slackClient.AssertExpectations(t)
+}
+
+func TestInteractiveCancelRevoke(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	slackClient.On("PostResponse", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	h := newInteractiveTestHandler(slackClient, svc)
+	c, rec := setupSignedContext("/interactive", blockActionBody(t, actionIDRevokeCancel, "C123456", defaultRevokeState))
+	err := h.Interactive(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	svc.AssertNotCalled(t, "RevokeToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestInteractiveChannelMismatch(t *testing.T) {
+	svc := &mockTokenService{}
+	h := newInteractiveTestHandler(&mockSlackClient{}, svc)
+	c, rec := setupSignedContext("/interactive", blockActionBody(t, actionIDRevokeApprove, "C999999", defaultRevokeState))
+	err := h.Interactive(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	svc.AssertNotCalled(t, "RevokeToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestInteractiveApproveRevokeInPassiveRegion(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	responseMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		return payload["text"] == passiveRegionMessage
+	})
+	slackClient.On("PostResponse", mock.Anything, mock.Anything, responseMatcher).Return(nil)
+
+	h := newInteractiveTestHandler(slackClient, svc)
+	h.cfg.RegionRole = runtimeconfig.RegionRolePassive
+	c, rec := setupSignedContext("/interactive", blockActionBody(t, actionIDRevokeApprove, "C123456", defaultRevokeState))
+	err := h.Interactive(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	svc.AssertNotCalled(t, "RevokeToken", mock.Anything, mock.Anything, mock.Anything)
+	slackClient.AssertExpectations(t)
+}
+
+func TestInteractiveApproveRevokePermissionDenied(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	slackClient.On("GetUserRole", mock.Anything, "U123456").Return(slack.UserRoleMember, nil)
+	responseMatcher := mock.MatchedBy(func(payload map[string]interface{}) bool {
+		return payload["text"] == permissionDeniedMessage
+	})
+	slackClient.On("PostResponse", mock.Anything, mock.Anything, responseMatcher).Return(nil)
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.UserID == "U123456" && entry.Command == cmdRevoke && entry.Result == auditResultPermissionDenied
+	})).Return(nil)
+
+	h := newInteractiveTestHandler(slackClient, svc)
+	h.cfg.PermissionRoles = []string{"owner", "admin"}
+	h.auditSvc = auditSvc
+	c, rec := setupSignedContext("/interactive", blockActionBody(t, actionIDRevokeApprove, "C123456", defaultRevokeState))
+	err := h.Interactive(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	svc.AssertNotCalled(t, "RevokeToken", mock.Anything, mock.Anything, mock.Anything)
+	slackClient.AssertExpectations(t)
+	auditSvc.AssertExpectations(t)
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	slackgo "github.com/slack-go/slack"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// listChannels returns the channel inventory if it's synced within CHANNEL_INVENTORY_MAX_AGE. Otherwise, lists all
+// channels with conversations.list and replaces the inventory with them. Failures of the inventory fall back to
+// listing all channels, the inventory is only a cache.
+func (h *BatchHandler) listChannels(ctx context.Context) ([]slackgo.Channel, error) {
+	if h.inventorySvc == nil {
+		return h.slackClient.GetAllChannels(ctx)
+	}
+	cached, found, err := h.inventorySvc.Cached(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to read channel inventory, listing all channels", slog.String("error", fmt.Sprintf("%+v", err)))
+	} else if found {
+		slog.InfoContext(ctx, "using channel inventory", slog.Int("size", len(cached)))
+		channels := make([]slackgo.Channel, 0, len(cached))
+		for _, ch := range cached {
+			channels = append(channels, fromInventoryChannel(ch))
+		}
+		return channels, nil
+	}
+
+	channels, err := h.slackClient.GetAllChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inventory := make([]service.InventoryChannel, 0, len(channels))
+	for _, ch := range channels {
+		inventory = append(inventory, service.InventoryChannel{ID: ch.ID, Name: ch.Name, IsArchived: ch.IsArchived, IsPrivate: ch.IsPrivate})
+	}
+	if err := h.inventorySvc.Replace(ctx, inventory); err != nil {
+		slog.WarnContext(ctx, "failed to save channel inventory", slog.String("error", fmt.Sprintf("%+v", err)))
+	}
+	return channels, nil
+}
+
+func fromInventoryChannel(ch service.InventoryChannel) slackgo.Channel {
+	return slackgo.Channel{
+		GroupConversation: slackgo.GroupConversation{
+			Name:       ch.Name,
+			IsArchived: ch.IsArchived,
+			Conversation: slackgo.Conversation{
+				ID:        ch.ID,
+				IsPrivate: ch.IsPrivate,
+			},
+		},
+	}
+}
+
+// updateInventory applies the change of Events API to the channel inventory. Failures are only logged not to make
+// Slack retry the event, the next full sync fixes the inventory.
+func (h *ProxyHandler) updateInventory(ctx context.Context, evt slack.Event) {
+	if h.inventorySvc == nil {
+		return
+	}
+	var err error
+	switch evt.Type {
+	case slack.EventChannelRename:
+		err = h.inventorySvc.Rename(ctx, evt.ChannelID, evt.ChannelName)
+	case slack.EventChannelArchive:
+		err = h.inventorySvc.SetArchived(ctx, evt.ChannelID, true)
+	case slack.EventChannelUnarchive:
+		err = h.inventorySvc.SetArchived(ctx, evt.ChannelID, false)
+	default:
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to update channel inventory", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("channel_id", evt.ChannelID))
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/cockroachdb/errors"
+	slackgo "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+func TestBatchUsesChannelInventory(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	inventorySvc := &mockInventoryService{}
+
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{
+		{ChannelID: "C123456", ChannelName: "test", Token: "token_a"},
+	}, nil)
+	inventorySvc.On("Cached", mock.Anything).Return([]service.InventoryChannel{{ID: "C123456", Name: "test"}}, true, nil)
+	expectBatchSummary(slackClient, defaultConfig, "")
+
+	h := NewBatchHandler(defaultConfig, slackClient, ddb, nil, nil, nil, nil, nil, inventorySvc)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+	require.NoError(t, err)
+	slackClient.AssertNotCalled(t, "GetAllChannels", mock.Anything)
+	inventorySvc.AssertNotCalled(t, "Replace", mock.Anything, mock.Anything)
+}
+
+func TestBatchSyncsChannelInventory(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	inventorySvc := &mockInventoryService{}
+
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{}, nil)
+	slackClient.On("GetAllChannels", mock.Anything).Return([]slackgo.Channel{
+		{GroupConversation: slackgo.GroupConversation{Name: "test", IsArchived: true, Conversation: slackgo.Conversation{ID: "C123456", IsPrivate: true}}},
+	}, nil)
+	// Stale or broken inventory falls back to the full sync.
+	inventorySvc.On("Cached", mock.Anything).Return([]service.InventoryChannel{}, false, errors.New("throttled"))
+	inventorySvc.On("Replace", mock.Anything, []service.InventoryChannel{{ID: "C123456", Name: "test", IsArchived: true, IsPrivate: true}}).Return(nil)
+	expectBatchSummary(slackClient, defaultConfig, "")
+
+	h := NewBatchHandler(defaultConfig, slackClient, ddb, nil, nil, nil, nil, nil, inventorySvc)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+	require.NoError(t, err)
+	inventorySvc.AssertExpectations(t)
+}
+
+func TestEventsUpdateChannelInventory(t *testing.T) {
+	ddb := &mockStorageDDB{}
+	ddb.On("ScanByChannelID", mock.Anything, "C123456").Return([]storage.Record{}, nil)
+	inventorySvc := &mockInventoryService{}
+	// Failures of the inventory don't fail the event.
+	inventorySvc.On("Rename", mock.Anything, "C123456", "renamed").Return(errors.New("throttled"))
+
+	h := newEventsTestHandler(&mockSlackClient{}, ddb)
+	h.inventorySvc = inventorySvc
+	c, resp := setupSignedContext("/events", callbackBody(`{"type": "channel_rename", "channel": {"id": "C123456", "name": "renamed", "created": 1360782804}}`))
+	err := h.Events(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	inventorySvc.AssertExpectations(t)
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// recordMaintainer applies channel lifecycle changes (archive, unarchive, rename, token migration) to records and
+// notifies the channel and ops. Shared by the batch job and the Events API handler.
+type recordMaintainer struct {
+	cfg         appconfig.Config
+	slackClient slackClient
+	ddb         storageDDB
+	settings    runtimeSettings
+	auditSvc    auditService
+	// Optional, lifecycle events are not published without it.
+	lifecycleSvc lifecycleService
+	// Validated with ValidateOpsRouting.
+	opsRoutes  map[opsClass]opsRoute
+	opsThreads *opsThreads
+}
+
+// threadStore is optional, see opsThreads.
+func newRecordMaintainer(cfg appconfig.Config, slackClient slackClient, ddb storageDDB, settings runtimeSettings, auditSvc auditService, threadStore opsThreadStore, lifecycleSvc lifecycleService) recordMaintainer {
+	opsRoutes, _ := parseOpsRouting(cfg.OpsRouting)
+	return recordMaintainer{
+		cfg:          cfg,
+		slackClient:  slackClient,
+		ddb:          ddb,
+		settings:     settings,
+		auditSvc:     auditSvc,
+		lifecycleSvc: lifecycleSvc,
+		opsRoutes:    opsRoutes,
+		opsThreads:   newOpsThreads(cfg.OpsThreadTimeZone, threadStore),
+	}
+}
+
+// processArchived keeps the record as a tombstone until ARCHIVED_RECORD_TTL passes, so the token works again
+// when the channel is unarchived.
+func (m *recordMaintainer) processArchived(ctx context.Context, event archiveEvent) error {
+	now := time.Now()
+	expiresAt := now.Add(m.cfg.ArchivedRecordTTL)
+	slog.InfoContext(ctx, "Channel is archived, archiving record", slog.String("channel_id", event.record.ChannelID), slog.String("record_channel_name", event.record.ChannelName), slog.String("slack_channel_name", event.SlackChannelName), slog.Time("expires_at", expiresAt))
+	msg := fmt.Sprintf("Channel is archived, archiving record: channel_id=%s, record_channel_name=%s, slack_channel_name=%s, expires_at=%s\n", event.record.ChannelID, event.record.ChannelName, event.SlackChannelName, expiresAt.Format(time.DateOnly))
+	if err := m.notifyOps(ctx, opsClassArchive, msg); err != nil {
+		return err
+	}
+	if err := m.ddb.Archive(ctx, event.record, now.UTC().Format(time.RFC3339Nano), expiresAt.Unix()); err != nil {
+		return err
+	}
+	m.publishLifecycle(ctx, service.LifecycleEvent{
+		Type:         service.LifecycleRecordDeletedArchived,
+		ChannelID:    event.record.ChannelID,
+		ChannelName:  event.record.ChannelName,
+		TokenPrefix:  secret.Token(event.record.Token).Prefix(),
+		TokenVersion: event.record.Version,
+		Reason:       service.LifecycleReasonChannelArchived,
+	})
+	return nil
+}
+
+func (m *recordMaintainer) processRestore(ctx context.Context, event restoreEvent) error {
+	rec := event.record
+	slog.InfoContext(ctx, "Channel is unarchived, restoring record", slog.String("channel_id", rec.ChannelID), slog.String("channel_name", rec.ChannelName), slog.String("archived_at", rec.ArchivedAt))
+	if err := m.ddb.Restore(ctx, rec); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("This channel was unarchived, the token archived with the channel works again: channel_name=%s, token=%s\n", rec.ChannelName, secret.Token(rec.Token).Prefix())
+	msgOps := fmt.Sprintf("Channel is unarchived, restored record: channel_id=%s, record_channel_name=%s\n", rec.ChannelID, rec.ChannelName)
+	return m.notify(ctx, opsClassRestore, rec.ChannelID, event.slackChannelName, msg, msgOps)
+}
+
+func (m *recordMaintainer) processMigration(ctx context.Context, rec storage.Record) error {
+	slog.InfoContext(ctx, "Token is in migration", slog.String("channel_name", rec.ChannelName), slog.String("channel_id", rec.ChannelID))
+	msgOps := fmt.Sprintf("Token is in migration: channel_name=%s, channel_id=%s\n", rec.ChannelName, rec.ChannelID)
+	msg := fmt.Sprintf("Token is in migration. Once all old webhook URLs are replaced, revoke old token: channel_name=%s, channel_id=%s\n", rec.ChannelName, rec.ChannelID)
+	return m.notify(ctx, opsClassMigration, rec.ChannelID, rec.ChannelName, msg, msgOps)
+}
+
+func (m *recordMaintainer) processRename(ctx context.Context, evt renameEvent) error {
+	slog.InfoContext(ctx, "Channel name and channel id pair updated",
+		slog.String("channel_id", evt.channelID),
+		slog.String("old_channel_name", evt.oldName),
+		slog.String("renamed_channel_name", evt.newName),
+		slog.String("saved_token_prefix", evt.savedToken.Prefix()),
+	)
+	msgOps := fmt.Sprintf("Channel name and channel id pair updated: channel_id=%s, old_channel_name=%s, renamed_channel_name=%s\n", evt.channelID, evt.oldName, evt.newName)
+	format := `
+Detect channel renaming for this channel: channel_id=%s, old_channel_name=%s, renamed_channel_name=%s
+
+1. Generate new token in this channel.
+2. Replace old webhook URLs with new URLs.
+3. When all old URLs are replaced, revoke old token with the "revoke renamed slash command" with channel_name=%s and token=%s
+		`
+	msg := fmt.Sprintf(format, evt.channelID, evt.oldName, evt.newName, evt.oldName, evt.savedToken.Reveal())
+	if m.cfg.DdbChannelIDIndexName != "" {
+		msg += "Webhook URLs having channel ID (`/c/<channel_id>/<token>`) keep working, no action is required for them.\n"
+	}
+	m.publishLifecycle(ctx, service.LifecycleEvent{
+		Type:           service.LifecycleChannelRenamedDetected,
+		ChannelID:      evt.channelID,
+		ChannelName:    evt.newName,
+		OldChannelName: evt.oldName,
+		TokenPrefix:    evt.savedToken.Prefix(),
+		Reason:         service.LifecycleReasonChannelRenamed,
+	})
+	return m.notify(ctx, opsClassRename, evt.channelID, evt.newName, msg, msgOps)
+}
+
+// revoke soft-deletes the record like service.TokenService, so users can restore the token.
+func (m *recordMaintainer) revoke(ctx context.Context, rec storage.Record) error {
+	if m.cfg.RevokeGracePeriod <= 0 {
+		return m.ddb.Delete(ctx, rec)
+	}
+	now := time.Now()
+	return m.ddb.Revoke(ctx, rec, now.UTC().Format(time.RFC3339Nano), now.Add(m.cfg.RevokeGracePeriod).Unix())
+}
+
+// processPurge deletes the expired tombstone. DynamoDB TTL usually deletes expired items within a few days, and
+// the memory backend doesn't have TTL.
+func (m *recordMaintainer) processPurge(ctx context.Context, rec storage.Record) error {
+	slog.InfoContext(ctx, "Tombstone expired, purging", slog.String("channel_name", rec.ChannelName), slog.String("channel_id", rec.ChannelID), slog.Int("version", rec.Version))
+	if err := m.ddb.Delete(ctx, rec); err != nil {
+		return err
+	}
+	m.publishLifecycle(ctx, service.LifecycleEvent{
+		Type:         service.LifecycleRecordDeletedArchived,
+		ChannelID:    rec.ChannelID,
+		ChannelName:  rec.ChannelName,
+		TokenPrefix:  secret.Token(rec.Token).Prefix(),
+		TokenVersion: rec.Version,
+		Reason:       service.LifecycleReasonPurged,
+	})
+	return nil
+}
+
+// publishLifecycle doesn't fail the operation, like audit entries: the operation itself has already completed.
+func (m *recordMaintainer) publishLifecycle(ctx context.Context, evt service.LifecycleEvent) {
+	if m.lifecycleSvc == nil {
+		return
+	}
+	if err := m.lifecycleSvc.Publish(ctx, evt); err != nil {
+		slog.ErrorContext(ctx, "failed to publish lifecycle event",
+			slog.String("error", fmt.Sprintf("%+v", err)),
+			slog.String("type", evt.Type),
+			slog.String("channel_id", evt.ChannelID),
+		)
+	}
+}
+
+func (m *recordMaintainer) notify(ctx context.Context, class opsClass, channelID string, channelName string, msg string, msgOps string) error {
+	payload := map[string]interface{}{"text": msg}
+	{
+		result, err := m.slackClient.PostMessage(ctx, channelID, channelName, payload)
+		if err != nil {
+			return err
+		}
+		if e := handlePostMessageFailure(result); e != nil {
+			return e
+		}
+	}
+	return m.notifyOps(ctx, class, msgOps)
+}
+
+// notifyOps posts the message to the channel routed for the class with OPS_ROUTING, or the ops channel.
+func (m *recordMaintainer) notifyOps(ctx context.Context, class opsClass, msg string) error {
+	opsChannel := currentSettings(ctx, m.cfg, m.settings).OpsNotificationChannelName
+	route := m.opsRoutes[class]
+	if route.suppress {
+		slog.DebugContext(ctx, "ops notification suppressed", slog.String("class", string(class)))
+		return nil
+	}
+	if route.channel != "" {
+		opsChannel = route.channel
+	}
+	text, err := route.render(class, msg)
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{"text": text}
+	if route.thread {
+		// Posting the notification is more important than threading it.
+		if ts, err := m.opsThreads.parent(ctx, m.slackClient, opsChannel); err != nil {
+			slog.WarnContext(ctx, "failed to find ops thread, post at the top level", slog.String("error", err.Error()))
+		} else if ts != "" {
+			payload["thread_ts"] = ts
+		}
+	}
+	result, err := m.slackClient.PostMessage(ctx, opsChannel, opsChannel, payload)
+	if err != nil {
+		return err
+	}
+	if e := handlePostMessageFailure(result); e != nil {
+		return e
+	}
+	return nil
+}
+
+func (m *recordMaintainer) notifyPanic(ctx context.Context, msg string) error {
+	return m.notifyOps(ctx, opsClassPanic, msg)
+}
+
+type renameEvent struct {
+	channelID  string
+	oldName    string
+	newName    string
+	savedToken secret.Token
+}
+
+type archiveEvent struct {
+	record           storage.Record
+	SlackChannelName string
+}
+
+type restoreEvent struct {
+	// The tombstone.
+	record           storage.Record
+	slackChannelName string
+}
+
+func handlePostMessageFailure(result slack.PostMessageResult) error {
+	switch result.Type {
+	case slack.PostMessageResultOK:
+		return nil
+	case slack.PostMessageResultServerTimeoutFailure:
+		return errors.New("slack server timeout")
+	case slack.PostMessageResultServerFailure:
+		return errors.Newf("slack server error: code=%d, body=%s", result.StatusCode, result.Body)
+	case slack.PostMessageResultAPIFailure:
+		return errors.Newf("slack API error: channelName=%s, channelID=%s, reason=%s", result.ChannelName, result.ChannelID, result.Reason)
+	case slack.PostMessageResultRateLimited:
+		return errors.Newf("slack API rate limited: retry_after=%s", result.RetryAfter)
+	case slack.PostMessageResultCircuitOpen:
+		return errors.Newf("slack API circuit breaker open: retry_after=%s", result.RetryAfter)
+	default:
+		return errors.Newf("unknown PostMessageResult type: %d", result.Type)
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Webhook requests with `convert=markdown` query parameter have GitHub-flavored Markdown converted into Slack
+// mrkdwn, for tools emitting Markdown which Slack shows as raw symbols.
+const (
+	convertQuery         = "convert"
+	convertQueryMarkdown = "markdown"
+)
+
+var (
+	markdownImagePattern   = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	markdownHeadingPattern = regexp.MustCompile(`^#{1,6}\s+(.+?)(?:\s+#+)?\s*$`)
+	markdownListPattern    = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	markdownBoldPattern    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	markdownItalicPattern  = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	markdownStrikePattern  = regexp.MustCompile(`~~(.+?)~~`)
+	// Slack bold, replaced to `*` after converting italic.
+	boldPlaceholder = "\x00"
+)
+
+// convertMarkdown converts Markdown of `text` field and attachment texts into mrkdwn in place. MessageCards are
+// translated with their own Markdown rules, see translateMessageCard.
+func convertMarkdown(payload map[string]interface{}) {
+	if text, ok := payload["text"].(string); ok {
+		payload["text"] = markdownToMrkdwn(text)
+	}
+	attachments, _ := payload["attachments"].([]interface{})
+	for _, a := range attachments {
+		if attachment, ok := a.(map[string]interface{}); ok {
+			if text, ok := attachment["text"].(string); ok {
+				attachment["text"] = markdownToMrkdwn(text)
+			}
+		}
+	}
+}
+
+// markdownToMrkdwn converts headings, lists, links, images, bold, italic and strikethrough. Code blocks and
+// inline code are kept as is, except the language of code fences which Slack doesn't support.
+func markdownToMrkdwn(text string) string {
+	lines := strings.Split(text, "\n")
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if !inFence {
+				// Drop the language, e.g. ```go.
+				lines[i] = line[:strings.Index(line, "```")+3]
+			}
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if m := markdownHeadingPattern.FindStringSubmatch(line); m != nil {
+			line = "**" + m[1] + "**"
+		}
+		line = markdownListPattern.ReplaceAllString(line, "$1• ")
+		lines[i] = convertInlineMarkdown(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// convertInlineMarkdown converts the line except inline code spans.
+func convertInlineMarkdown(line string) string {
+	parts := strings.Split(line, "`")
+	// Odd parts are code spans. An unpaired backtick is not a code span.
+	for i := range parts {
+		if i%2 == 1 && i < len(parts)-1 {
+			continue
+		}
+		p := markdownImagePattern.ReplaceAllStringFunc(parts[i], func(image string) string {
+			m := markdownImagePattern.FindStringSubmatch(image)
+			if m[1] == "" {
+				return "<" + m[2] + ">"
+			}
+			return "<" + m[2] + "|" + m[1] + ">"
+		})
+		p = teamsLinkPattern.ReplaceAllString(p, "<$2|$1>")
+		p = markdownBoldPattern.ReplaceAllString(p, boldPlaceholder+"$1$2"+boldPlaceholder)
+		p = markdownItalicPattern.ReplaceAllString(p, "_${1}_")
+		p = markdownStrikePattern.ReplaceAllString(p, "~$1~")
+		parts[i] = strings.ReplaceAll(p, boldPlaceholder, "*")
+	}
+	return strings.Join(parts, "`")
+}
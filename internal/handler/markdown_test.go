@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestMarkdownToMrkdwn(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		mrkdwn   string
+	}{
+		{name: "plain", markdown: "deploy finished", mrkdwn: "deploy finished"},
+		{name: "bold", markdown: "**api** and __web__", mrkdwn: "*api* and *web*"},
+		{name: "italic", markdown: "*api* and _web_", mrkdwn: "_api_ and _web_"},
+		{name: "bold and italic", markdown: "**bold** *italic*", mrkdwn: "*bold* _italic_"},
+		{name: "strikethrough", markdown: "~~old~~", mrkdwn: "~old~"},
+		{name: "link", markdown: "see [PR #1](https://example.com/pull/1)", mrkdwn: "see <https://example.com/pull/1|PR #1>"},
+		{name: "image", markdown: "![graph](https://example.com/a.png) ![](https://example.com/b.png)", mrkdwn: "<https://example.com/a.png|graph> <https://example.com/b.png>"},
+		{name: "heading", markdown: "## Release v1.2.3 ##\nbody", mrkdwn: "*Release v1.2.3*\nbody"},
+		{name: "list", markdown: "- one\n  * two\n+ three", mrkdwn: "• one\n  • two\n• three"},
+		{name: "not a list", markdown: "2 * 3 * 4", mrkdwn: "2 * 3 * 4"},
+		{name: "inline code", markdown: "run `**not bold**` **now**", mrkdwn: "run `**not bold**` *now*"},
+		{name: "unpaired backtick", markdown: "it`s **ok**", mrkdwn: "it`s *ok*"},
+		{name: "code fence", markdown: "```go\n**x** := 1\n```\n**done**", mrkdwn: "```\n**x** := 1\n```\n*done*"},
+		{name: "unterminated fence", markdown: "```\n# not heading", mrkdwn: "```\n# not heading"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.mrkdwn, markdownToMrkdwn(tt.markdown))
+		})
+	}
+}
+
+func TestConvertMarkdown(t *testing.T) {
+	payload := map[string]interface{}{
+		"text":        "**deploy**",
+		"attachments": []interface{}{map[string]interface{}{"text": "~~v1~~", "color": "good"}},
+		"username":    "**bot**",
+	}
+	convertMarkdown(payload)
+	assert.Equal(t, map[string]interface{}{
+		"text":        "*deploy*",
+		"attachments": []interface{}{map[string]interface{}{"text": "~v1~", "color": "good"}},
+		"username":    "**bot**",
+	}, payload)
+}
+
+func TestWebhookConvertMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		convert string
+		status  int
+	}{
+		{name: "markdown", convert: "markdown", status: http.StatusOK},
+		{name: "invalid", convert: "html", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			svc := &mockTokenService{}
+			svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+			slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), map[string]interface{}{"text": "*deploy* finished"}).Return(slack.PostMessageResult{
+				Type: slack.PostMessageResultOK,
+			}, nil)
+
+			h := ProxyHandler{
+				cfg:              appconfig.Config{},
+				slackClient:      slackClient,
+				tokenSvc:         svc,
+				channelConfigSvc: disabledChannelConfigService(),
+				mentionSvc:       disabledMentionService(),
+				digestSvc:        disabledDigestService(),
+			}
+			payload := `{"text": "**deploy** finished"}`
+			c := setupContext(&payload)
+			c.Request().URL.RawQuery = "convert=" + tt.convert
+			err := h.Webhook(c)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, c.Response().Status)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/service"
+)
+
+type membersResponse struct {
+	Ok          bool   `json:"ok"`
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	// null when belldog can't see the channel.
+	MemberCount *int `json:"member_count"`
+	IsMember    bool `json:"is_member"`
+	IsPrivate   bool `json:"is_private"`
+}
+
+// WebhookMembers responds the member count of the channel and whether belldog is a member, so setup scripts of
+// integrations can check "invite belldog" requirements before posting. Private channels without belldog are not
+// visible to belldog: they are responded as private channels without belldog and an unknown member count.
+func (h *ProxyHandler) WebhookMembers(c echo.Context) error {
+	apierror.PreferJSON(c)
+	res, ok, err := h.verifyWebhookToken(c, service.ScopePost)
+	if !ok {
+		return err
+	}
+	ctx := c.Request().Context()
+
+	membership, found, err := h.slackClient.GetChannelMembership(ctx, res.ChannelID)
+	if err != nil {
+		return err
+	}
+	resp := membersResponse{
+		Ok:          true,
+		ChannelID:   res.ChannelID,
+		ChannelName: res.ChannelName,
+	}
+	if found {
+		resp.MemberCount = &membership.MemberCount
+		resp.IsMember = membership.IsMember
+		resp.IsPrivate = membership.IsPrivate
+	} else {
+		slog.InfoContext(ctx, "channel not visible to belldog", slog.String("channel_id", res.ChannelID))
+		resp.IsPrivate = true
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestWebhookMembers(t *testing.T) {
+	tests := []struct {
+		name       string
+		membership slack.ChannelMembership
+		found      bool
+		expected   string
+	}{
+		{
+			name:       "member",
+			membership: slack.ChannelMembership{MemberCount: 42, IsMember: true},
+			found:      true,
+			expected:   `{"ok": true, "channel_id": "C123456", "channel_name": "test", "member_count": 42, "is_member": true, "is_private": false}`,
+		},
+		{
+			name:       "not member",
+			membership: slack.ChannelMembership{MemberCount: 3},
+			found:      true,
+			expected:   `{"ok": true, "channel_id": "C123456", "channel_name": "test", "member_count": 3, "is_member": false, "is_private": false}`,
+		},
+		{
+			name:     "invisible private channel",
+			expected: `{"ok": true, "channel_id": "C123456", "channel_name": "test", "member_count": null, "is_member": false, "is_private": true}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			slackClient.On("GetChannelMembership", mock.Anything, "C123456").Return(tt.membership, tt.found, nil)
+			h := newReactionTestHandler(slackClient, service.ScopePost)
+
+			c := setupContext(nil)
+			err := h.WebhookMembers(c)
+
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, c.Response().Status)
+			rec := c.Response().Writer.(*httptest.ResponseRecorder)
+			assert.JSONEq(t, tt.expected, rec.Body.String())
+		})
+	}
+}
+
+func TestWebhookMembersInvalidToken(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{}, service.ErrTokenUnmatch)
+	h := ProxyHandler{slackClient: slackClient, tokenSvc: svc}
+
+	c := setupContext(nil)
+	err := h.WebhookMembers(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, c.Response().Status)
+	slackClient.AssertNotCalled(t, "GetChannelMembership", mock.Anything, mock.Anything)
+}
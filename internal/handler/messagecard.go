@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Office 365 connector cards, which Microsoft Teams incoming webhooks accept, are translated into Slack blocks,
+// so tools posting to Teams can be moved to Slack by only replacing the URL.
+// https://learn.microsoft.com/en-us/outlook/actionable-messages/message-card-reference
+
+const messageCardType = "MessageCard"
+
+// Slack limits section blocks to 10 fields and header blocks to 150 characters.
+const (
+	maxSectionFields = 10
+	maxHeaderLength  = 150
+)
+
+var (
+	teamsBoldPattern = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	teamsLinkPattern = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+func isMessageCard(payload map[string]interface{}) bool {
+	t, _ := payload["@type"].(string)
+	return strings.EqualFold(t, messageCardType)
+}
+
+// translateMessageCard replaces the connector card fields of the payload with Slack fields in place. The title
+// becomes a header block, sections become section blocks having facts as fields, and OpenUri actions become link
+// buttons. Other actions can't be performed in Slack, so they are dropped. themeColor is kept as the attachment
+// color. Fields Slack accepts, e.g. `username`, are kept.
+func translateMessageCard(ctx context.Context, payload map[string]interface{}) {
+	title, _ := payload["title"].(string)
+	summary, _ := payload["summary"].(string)
+	text, _ := payload["text"].(string)
+	color, _ := payload["themeColor"].(string)
+
+	var blocks []interface{}
+	if title != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "header",
+			// Header blocks don't support markdown.
+			"text": plainText(truncateRunes(teamsBoldPattern.ReplaceAllString(title, "$1"), maxHeaderLength)),
+		})
+	}
+	if text != "" {
+		blocks = append(blocks, mrkdwnSection(teamsMarkdownToMrkdwn(text)))
+	}
+	sections, _ := payload["sections"].([]interface{})
+	for _, s := range sections {
+		section, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		blocks = append(blocks, messageCardSectionBlocks(section)...)
+	}
+	actions, _ := payload["potentialAction"].([]interface{})
+	if buttons := messageCardButtons(ctx, actions); len(buttons) > 0 {
+		blocks = append(blocks, map[string]interface{}{"type": "actions", "elements": buttons})
+	}
+
+	for _, key := range []string{"@type", "@context", "title", "summary", "themeColor", "sections", "potentialAction", "correlationId", "hideOriginalBody"} {
+		delete(payload, key)
+	}
+	// The fallback text of notifications.
+	fallback := summary
+	if fallback == "" {
+		fallback = title
+	}
+	if fallback == "" {
+		fallback = text
+	}
+	payload["text"] = teamsMarkdownToMrkdwn(fallback)
+	if len(blocks) == 0 {
+		return
+	}
+	if color == "" {
+		payload["blocks"] = blocks
+		return
+	}
+	if !strings.HasPrefix(color, "#") {
+		color = "#" + color
+	}
+	payload["attachments"] = []interface{}{map[string]interface{}{"color": color, "blocks": blocks}}
+}
+
+func messageCardSectionBlocks(section map[string]interface{}) []interface{} {
+	var lines []string
+	if activityTitle, _ := section["activityTitle"].(string); activityTitle != "" {
+		lines = append(lines, "*"+teamsMarkdownToMrkdwn(activityTitle)+"*")
+	}
+	if activitySubtitle, _ := section["activitySubtitle"].(string); activitySubtitle != "" {
+		lines = append(lines, teamsMarkdownToMrkdwn(activitySubtitle))
+	}
+	if activityText, _ := section["activityText"].(string); activityText != "" {
+		lines = append(lines, teamsMarkdownToMrkdwn(activityText))
+	}
+	if text, _ := section["text"].(string); text != "" {
+		lines = append(lines, teamsMarkdownToMrkdwn(text))
+	}
+
+	var blocks []interface{}
+	if title, _ := section["title"].(string); title != "" {
+		blocks = append(blocks, mrkdwnSection("*"+title+"*"))
+	}
+	if len(lines) > 0 {
+		block := mrkdwnSection(strings.Join(lines, "\n"))
+		if image, _ := section["activityImage"].(string); image != "" {
+			block["accessory"] = map[string]interface{}{"type": "image", "image_url": image, "alt_text": "activity image"}
+		}
+		blocks = append(blocks, block)
+	}
+
+	facts, _ := section["facts"].([]interface{})
+	var fields []interface{}
+	for _, f := range facts {
+		fact, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := fact["name"].(string)
+		value, _ := fact["value"].(string)
+		fields = append(fields, map[string]interface{}{"type": "mrkdwn", "text": "*" + name + "*\n" + teamsMarkdownToMrkdwn(value)})
+	}
+	for len(fields) > 0 {
+		n := min(len(fields), maxSectionFields)
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields[:n]})
+		fields = fields[n:]
+	}
+	return blocks
+}
+
+func messageCardButtons(ctx context.Context, actions []interface{}) []interface{} {
+	var buttons []interface{}
+	for _, a := range actions {
+		action, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		actionType, _ := action["@type"].(string)
+		name, _ := action["name"].(string)
+		if actionType != "OpenUri" {
+			slog.InfoContext(ctx, "unsupported MessageCard action dropped", slog.String("type", actionType), slog.String("name", name))
+			continue
+		}
+		targets, _ := action["targets"].([]interface{})
+		url := openURITarget(targets)
+		if url == "" || name == "" {
+			continue
+		}
+		buttons = append(buttons, map[string]interface{}{"type": "button", "text": plainText(name), "url": url})
+	}
+	return buttons
+}
+
+// openURITarget returns the URI of the default OS, or the first one.
+func openURITarget(targets []interface{}) string {
+	first := ""
+	for _, t := range targets {
+		target, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		uri, _ := target["uri"].(string)
+		if os, _ := target["os"].(string); os == "default" {
+			return uri
+		}
+		if first == "" {
+			first = uri
+		}
+	}
+	return first
+}
+
+// teamsMarkdownToMrkdwn converts bold and links of Teams markdown, which differ from Slack mrkdwn.
+func teamsMarkdownToMrkdwn(text string) string {
+	text = teamsBoldPattern.ReplaceAllString(text, "*$1*")
+	return teamsLinkPattern.ReplaceAllString(text, "<$2|$1>")
+}
+
+func mrkdwnSection(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "section", "text": map[string]interface{}{"type": "mrkdwn", "text": text}}
+}
+
+func plainText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "plain_text", "text": text}
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
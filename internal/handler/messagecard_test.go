@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+const messageCardJSON = `{
+  "@type": "MessageCard",
+  "@context": "http://schema.org/extensions",
+  "themeColor": "0076D7",
+  "summary": "Deploy finished",
+  "title": "Deploy **api**",
+  "sections": [{
+    "activityTitle": "Deployed by [alice](https://example.com/alice)",
+    "facts": [{"name": "Environment", "value": "production"}, {"name": "Version", "value": "v1.2.3"}]
+  }],
+  "potentialAction": [
+    {"@type": "OpenUri", "name": "Open", "targets": [{"os": "iOS", "uri": "https://example.com/ios"}, {"os": "default", "uri": "https://example.com/deploy"}]},
+    {"@type": "HttpPOST", "name": "Rollback", "target": "https://example.com/rollback"}
+  ]
+}`
+
+func TestTranslateMessageCard(t *testing.T) {
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(messageCardJSON), &payload))
+	require.True(t, isMessageCard(payload))
+
+	translateMessageCard(context.Background(), payload)
+
+	expected := `{
+	  "text": "Deploy finished",
+	  "attachments": [{
+	    "color": "#0076D7",
+	    "blocks": [
+	      {"type": "header", "text": {"type": "plain_text", "text": "Deploy api"}},
+	      {"type": "section", "text": {"type": "mrkdwn", "text": "*Deployed by <https://example.com/alice|alice>*"}},
+	      {"type": "section", "fields": [{"type": "mrkdwn", "text": "*Environment*\nproduction"}, {"type": "mrkdwn", "text": "*Version*\nv1.2.3"}]},
+	      {"type": "actions", "elements": [{"type": "button", "text": {"type": "plain_text", "text": "Open"}, "url": "https://example.com/deploy"}]}
+	    ]
+	  }]
+	}`
+	actual, err := json.Marshal(payload)
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, string(actual))
+}
+
+func TestWebhookMessageCard(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.MatchedBy(func(payload map[string]interface{}) bool {
+		_, hasType := payload["@type"]
+		return payload["text"] == "Deploy finished" && payload["attachments"] != nil && !hasType
+	})).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := messageCardJSON
+	c := setupContext(&payload)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	slackClient.AssertExpectations(t)
+}
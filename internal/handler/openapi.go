@@ -0,0 +1,439 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+// The OpenAPI document describes the endpoints registered by NewEchoHandler with the same configuration, so callers
+// can generate typed clients. Response schemas are generated from the response structs. Keep the paths in sync with
+// NewEchoHandler, tests check both match.
+// https://spec.openapis.org/oas/v3.0.3
+
+type openAPIDocument struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       openAPIInfo                     `json:"info"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components openAPIComponents               `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*schema `json:"schemas"`
+}
+
+type operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Parameters  []parameter         `json:"parameters,omitempty"`
+	RequestBody *requestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+}
+
+const openAPIVersion = "3.0.3"
+
+// OpenAPI serves the OpenAPI document at `/openapi.json`.
+func (h *ProxyHandler) OpenAPI(c echo.Context) error {
+	return c.JSON(http.StatusOK, buildOpenAPIDocument(h.cfg))
+}
+
+func buildOpenAPIDocument(cfg appconfig.Config) openAPIDocument {
+	doc := openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: openAPIInfo{
+			Title:       "Belldog",
+			Description: "Proxy of Slack incoming webhooks. Webhook URLs are generated by slash commands.",
+			Version:     "1.0.0",
+		},
+		Paths: map[string]map[string]operation{},
+		Components: openAPIComponents{Schemas: map[string]*schema{
+			"WebhookPayload":      webhookPayloadSchema(),
+			"WebhookResponse":     schemaOf(webhookResponse{}),
+			"BroadcastResponse":   schemaOf(broadcastResponse{}),
+			"HealthCheckResponse": schemaOf(deepHealthResponse{}),
+			"VerifyResponse":      schemaOf(verifyResponse{}),
+			"MembersResponse":     schemaOf(membersResponse{}),
+			"PresignRequest":      schemaOf(presignRequest{}),
+			"PresignResponse":     schemaOf(presignResponse{}),
+			"PreviewResponse":     schemaOf(previewResponse{}),
+			"ErrorResponse":       schemaOf(apierror.Response{}),
+		}},
+	}
+
+	doc.Paths["/hc"] = map[string]operation{"get": {
+		OperationID: "healthCheck",
+		Summary:     "Check Belldog is alive. With deep=1, also check DynamoDB and Slack API.",
+		Parameters:  []parameter{{Name: "deep", In: "query", Schema: &schema{Type: "string", Enum: []string{"1"}}}},
+		Responses: map[string]response{
+			"200": jsonResponse("Healthy.", "HealthCheckResponse"),
+			"503": jsonResponse("Unhealthy.", "HealthCheckResponse"),
+		},
+	}}
+	doc.Paths["/openapi.json"] = map[string]operation{"get": {
+		OperationID: "getOpenAPIDocument",
+		Summary:     "Get this document.",
+		Responses:   map[string]response{"200": {Description: "OpenAPI document.", Content: map[string]mediaType{echo.MIMEApplicationJSON: {Schema: &schema{Type: "object"}}}}},
+	}}
+
+	addWebhookPaths(doc.Paths, "/p/{channel_name}/{token}", "ByChannelName", pathParameter("channel_name", "Channel name when the token was generated."))
+	doc.Paths["/p/{channel_name}/{token}/presign"] = map[string]operation{"post": {
+		OperationID: "presignURL",
+		Summary:     "Mint a pre-signed URL posting to the channel until it expires. Requires `manage` scope.",
+		Parameters:  []parameter{pathParameter("channel_name", "Channel name when the token was generated."), pathParameter("token", "Token generated by the slash command.")},
+		RequestBody: &requestBody{Content: map[string]mediaType{echo.MIMEApplicationJSON: {Schema: &schema{Ref: "#/components/schemas/PresignRequest"}}}},
+		Responses: map[string]response{
+			"200": jsonResponse("Minted.", "PresignResponse"),
+			"400": errorResponse("Invalid ttl."),
+			"401": errorResponse("Invalid token."),
+			"403": errorResponse("The token doesn't have the required scope."),
+			"404": errorResponse("No token found for the channel."),
+		},
+	}}
+	if cfg.DdbChannelIDIndexName != "" {
+		addWebhookPaths(doc.Paths, "/c/{channel_id}/{token}", "ByChannelID", pathParameter("channel_id", "Channel ID, which survives channel renames."))
+	}
+	if cfg.BroadcastTableName != "" {
+		doc.Paths["/b/{group_name}/{token}"] = map[string]operation{"post": {
+			OperationID: "broadcast",
+			Summary:     "Post the message to all channels of the broadcast group.",
+			Parameters:  []parameter{pathParameter("group_name", "Broadcast group name."), pathParameter("token", "Group token.")},
+			RequestBody: webhookRequestBody(),
+			Responses: map[string]response{
+				"200": jsonResponse("Posted to all channels.", "BroadcastResponse"),
+				"207": jsonResponse("Posted to some channels.", "BroadcastResponse"),
+				"502": jsonResponse("Failed for all channels.", "BroadcastResponse"),
+				"400": errorResponse("Invalid body."),
+				"401": errorResponse("Invalid token."),
+				"404": errorResponse("No broadcast group found."),
+			},
+		}}
+	}
+
+	slackRequest := func(id string, summary string, contentType string) map[string]operation {
+		return map[string]operation{"post": {
+			OperationID: id,
+			Summary:     summary,
+			Parameters: []parameter{
+				{Name: "X-Slack-Signature", In: "header", Required: true, Schema: &schema{Type: "string"}},
+				{Name: "X-Slack-Request-Timestamp", In: "header", Required: true, Schema: &schema{Type: "string"}},
+			},
+			RequestBody: &requestBody{Required: true, Content: map[string]mediaType{contentType: {Schema: &schema{Type: "object"}}}},
+			Responses: map[string]response{
+				"200": {Description: "Processed."},
+				"401": errorResponse("Invalid request signature."),
+			},
+		}}
+	}
+	doc.Paths["/slash"] = slackRequest("slashCommand", "Slack slash commands. Only for Slack.", echo.MIMEApplicationForm)
+	doc.Paths["/events"] = slackRequest("events", "Slack Events API. Only for Slack.", echo.MIMEApplicationJSON)
+	doc.Paths["/interactive"] = slackRequest("interactive", "Slack interactivity. Only for Slack.", echo.MIMEApplicationForm)
+	return doc
+}
+
+func addWebhookPaths(paths map[string]map[string]operation, prefix string, suffix string, channel parameter) {
+	params := []parameter{
+		channel,
+		pathParameter("token", "Token generated by the slash command."),
+		{Name: "response", In: "query", Description: "Respond JSON instead of plain `ok.`, same as `Accept: application/json`.", Schema: &schema{Type: "string", Enum: []string{"json"}}},
+	}
+	errorResponses := map[string]response{
+		"400": errorResponse("Invalid body."),
+		"401": errorResponse("Invalid token."),
+		"403": errorResponse("The token doesn't have the required scope."),
+		"404": errorResponse("No token found for the channel."),
+		"410": errorResponse("Posts to the channel keep failing because the channel is not found or archived."),
+		"413": errorResponse("Body is larger than MAX_BODY_BYTES."),
+		"415": errorResponse("Unsupported Content-Type."),
+		"429": errorResponse("Rate limited by Slack API."),
+		"502": errorResponse("Slack API failed."),
+		"504": errorResponse("Slack API timed out."),
+	}
+	withErrors := func(responses map[string]response) map[string]response {
+		for status, resp := range errorResponses {
+			responses[status] = resp
+		}
+		return responses
+	}
+	sent := func(description string) response {
+		return response{Description: description, Content: map[string]mediaType{
+			echo.MIMETextPlain:       {Schema: &schema{Type: "string"}},
+			echo.MIMEApplicationJSON: {Schema: &schema{Ref: "#/components/schemas/WebhookResponse"}},
+		}}
+	}
+
+	testModeParam := parameter{Name: testModeQuery, In: "query", Description: "Post to the sandbox channel instead, if SANDBOX_CHANNEL_NAME is configured.", Schema: &schema{Type: "string", Enum: []string{"true"}}}
+	optionParams := []parameter{
+		{Name: convertQuery, In: "query", Description: "Convert Markdown of `text` and attachment texts into Slack mrkdwn.", Schema: &schema{Type: "string", Enum: []string{convertQueryMarkdown}}},
+		{Name: unfurlQuery, In: "query", Description: "Set both of `unfurl_links` and `unfurl_media` of the payload.", Schema: &schema{Type: "boolean"}},
+	}
+	for _, name := range stringQueryOptions {
+		optionParams = append(optionParams, parameter{Name: name, In: "query", Description: fmt.Sprintf("Set `%s` of the payload.", name), Schema: &schema{Type: "string"}})
+	}
+	for _, name := range boolQueryOptions {
+		optionParams = append(optionParams, parameter{Name: name, In: "query", Description: fmt.Sprintf("Set `%s` of the payload.", name), Schema: &schema{Type: "boolean"}})
+	}
+	postParams := append(params,
+		testModeParam,
+		parameter{Name: idempotencyKeyHeader, In: "header", Description: "Send the message only once for the key.", Schema: &schema{Type: "string"}},
+		parameter{Name: dedupWindowQuery, In: "query", Description: "Suppress identical payloads within the duration, e.g. `10m`. At most `1h`.", Schema: &schema{Type: "string"}},
+		parameter{Name: dedupModeQuery, In: "query", Description: "Suppress duplicates, or count them on the first message. Requires `" + dedupWindowQuery + "`.", Schema: &schema{Type: "string", Enum: []string{dedupModeSuppress, dedupModeCount}}},
+	)
+	postParams = append(postParams, optionParams...)
+	paths[prefix] = map[string]operation{"get": {
+		OperationID: "verifyToken" + suffix,
+		Summary:     "Check the token is valid without posting anything.",
+		Parameters:  params[:2],
+		Responses: map[string]response{
+			"200": jsonResponse("The token is valid.", "VerifyResponse"),
+			"401": jsonResponse("Invalid token.", "VerifyResponse"),
+			"404": jsonResponse("No token found for the channel.", "VerifyResponse"),
+		},
+	}, "post": {
+		OperationID: "postMessage" + suffix,
+		Summary:     "Post or schedule a message like Slack incoming webhooks.",
+		Parameters:  postParams,
+		RequestBody: webhookRequestBody(),
+		Responses: withErrors(map[string]response{
+			"200": sent("Posted or scheduled."),
+			"202": sent("Accepted but not delivered: the channel is paused, in maintenance mode or buffered as a digest."),
+			"409": errorResponse("A request having the same idempotency key is in progress."),
+		}),
+	}}
+	paths[prefix+"/members"] = map[string]operation{"get": {
+		OperationID: "getChannelMembers" + suffix,
+		Summary:     "Get the member count of the channel and whether Belldog is a member, to check Belldog is invited before posting.",
+		Parameters:  params,
+		Responses: map[string]response{
+			"200": jsonResponse("The membership. Channels invisible to Belldog are private channels without Belldog.", "MembersResponse"),
+			"401": errorResponses["401"],
+			"403": errorResponses["403"],
+			"404": errorResponses["404"],
+		},
+	}}
+	paths[prefix+"/update"] = map[string]operation{"post": {
+		OperationID: "updateMessage" + suffix,
+		Summary:     "Update a message with `ts` like chat.update. Requires `manage` scope.",
+		Parameters:  params,
+		RequestBody: webhookRequestBody(),
+		Responses:   withErrors(map[string]response{"200": jsonResponse("Updated.", "WebhookResponse")}),
+	}}
+	paths[prefix+"/delete"] = map[string]operation{"post": {
+		OperationID: "deleteMessage" + suffix,
+		Summary:     "Delete a message with `ts`. Requires `manage` scope.",
+		Parameters:  params,
+		RequestBody: webhookRequestBody(),
+		Responses:   withErrors(map[string]response{"200": jsonResponse("Deleted.", "WebhookResponse")}),
+	}}
+	messageRequestBody := func(properties map[string]*schema, required ...string) *requestBody {
+		return &requestBody{Required: true, Content: map[string]mediaType{echo.MIMEApplicationJSON: {Schema: &schema{
+			Type:       "object",
+			Properties: properties,
+			Required:   required,
+		}}}}
+	}
+	paths[prefix+"/pin"] = map[string]operation{"post": {
+		OperationID: "pinMessage" + suffix,
+		Summary:     "Pin a message with `ts` like pins.add. Requires `manage` scope.",
+		Parameters:  params,
+		RequestBody: messageRequestBody(map[string]*schema{tsKey: {Type: "string"}}, tsKey),
+		Responses:   withErrors(map[string]response{"200": jsonResponse("Pinned, or already pinned.", "WebhookResponse")}),
+	}}
+	paths[prefix+"/react"] = map[string]operation{"post": {
+		OperationID: "reactToMessage" + suffix,
+		Summary:     "Add a reaction to a message with `ts` like reactions.add. Requires `manage` scope.",
+		Parameters:  params,
+		RequestBody: messageRequestBody(map[string]*schema{
+			tsKey:           {Type: "string"},
+			reactionNameKey: {Type: "string", Description: "Emoji name, e.g. `eyes`."},
+		}, tsKey, reactionNameKey),
+		Responses: withErrors(map[string]response{"200": jsonResponse("Reacted, or already reacted.", "WebhookResponse")}),
+	}}
+	paths[prefix+"/bookmark"] = map[string]operation{"post": {
+		OperationID: "upsertBookmark" + suffix,
+		Summary:     "Add a link bookmark to the channel, or edit the bookmark having the same title. Requires `manage` scope.",
+		Parameters:  params,
+		RequestBody: messageRequestBody(map[string]*schema{
+			bookmarkTitleKey: {Type: "string"},
+			bookmarkLinkKey:  {Type: "string", Format: "uri"},
+			bookmarkEmojiKey: {Type: "string", Description: "Emoji of the bookmark, e.g. `:pager:`."},
+		}, bookmarkTitleKey, bookmarkLinkKey),
+		Responses: withErrors(map[string]response{"200": jsonResponse("Added or edited.", "WebhookResponse")}),
+	}}
+	paths[prefix+"/canvas"] = map[string]operation{"post": {
+		OperationID: "updateChannelCanvas" + suffix,
+		Summary:     "Replace the channel canvas with Markdown of `text`, creating the canvas if the channel has none. Requires `manage` scope.",
+		Parameters:  params,
+		RequestBody: messageRequestBody(map[string]*schema{"text": {Type: "string", Description: "Markdown of the canvas."}}, "text"),
+		Responses:   withErrors(map[string]response{"200": jsonResponse("Created or replaced.", "WebhookResponse")}),
+	}}
+	paths[prefix+"/files"] = map[string]operation{"post": {
+		OperationID: "uploadFile" + suffix,
+		Summary:     "Upload a file. Requires `manage` scope.",
+		Parameters:  params,
+		RequestBody: &requestBody{Required: true, Content: map[string]mediaType{echo.MIMEMultipartForm: {Schema: &schema{
+			Type: "object",
+			Properties: map[string]*schema{
+				fileFormKey:           {Type: "string", Format: "binary"},
+				filenameFormKey:       {Type: "string"},
+				titleFormKey:          {Type: "string"},
+				initialCommentFormKey: {Type: "string"},
+				threadTSFormKey:       {Type: "string"},
+			},
+			Required: []string{fileFormKey},
+		}}}},
+		Responses: withErrors(map[string]response{"200": sent("Uploaded.")}),
+	}}
+	paths[prefix+"/workflow"] = map[string]operation{"post": {
+		OperationID: "postWorkflowMessage" + suffix,
+		Summary:     "Post the variables sent by Slack Workflow Builder, rendered with `workflow_template` of the channel config.",
+		Parameters:  params,
+		RequestBody: &requestBody{Required: true, Content: map[string]mediaType{echo.MIMEApplicationJSON: {Schema: &schema{
+			Type:                 "object",
+			Description:          "Flat key/value variables.",
+			AdditionalProperties: true,
+		}}}},
+		Responses: withErrors(map[string]response{
+			"200": sent("Posted."),
+			"202": sent("Accepted but not delivered: the channel is paused, in maintenance mode or buffered as a digest."),
+		}),
+	}}
+	paths[prefix+"/preview"] = map[string]operation{"post": {
+		OperationID: "previewMessage" + suffix,
+		Summary:     "Get the Slack API request Belldog would send for the payload, without posting.",
+		Parameters:  append(append(params[:2:2], testModeParam), optionParams...),
+		RequestBody: webhookRequestBody(),
+		Responses:   withErrors(map[string]response{"200": jsonResponse("The request Belldog would send.", "PreviewResponse")}),
+	}}
+}
+
+// webhookPayloadSchema describes the fields Belldog handles. Other fields are passed to Slack API as is.
+func webhookPayloadSchema() *schema {
+	return &schema{
+		Type:        "object",
+		Description: "Payload of Slack incoming webhooks or chat.postMessage.",
+		Properties: map[string]*schema{
+			"text":         {Type: "string"},
+			"blocks":       {Type: "array", Items: &schema{Type: "object"}},
+			postAtKey:      {Type: "integer", Description: "Unix timestamp to schedule the message."},
+			tsKey:          {Type: "string", Description: "Timestamp of the message to update or delete."},
+			dedupKey:       {Type: "string", Description: "Alternative of " + idempotencyKeyHeader + " header field."},
+			"mentions":     {Type: "array", Items: &schema{Type: "string", Format: "email"}, Description: "Email addresses of users to mention."},
+			"oncall_group": {Type: "string", Description: "Handle of the user group to mention, e.g. `sre`."},
+		},
+		AdditionalProperties: true,
+	}
+}
+
+func webhookRequestBody() *requestBody {
+	ref := &schema{Ref: "#/components/schemas/WebhookPayload"}
+	return &requestBody{Required: true, Content: map[string]mediaType{
+		echo.MIMEApplicationJSON: {Schema: ref},
+		echo.MIMEApplicationForm: {Schema: &schema{Type: "object", Properties: map[string]*schema{"payload": {Type: "string", Description: "JSON of WebhookPayload."}}}},
+		echo.MIMETextPlain:       {Schema: &schema{Type: "string", Description: "JSON of WebhookPayload."}},
+	}}
+}
+
+func pathParameter(name string, description string) parameter {
+	return parameter{Name: name, In: "path", Description: description, Required: true, Schema: &schema{Type: "string"}}
+}
+
+func jsonResponse(description string, schemaName string) response {
+	return response{Description: description, Content: map[string]mediaType{echo.MIMEApplicationJSON: {Schema: &schema{Ref: "#/components/schemas/" + schemaName}}}}
+}
+
+// errorResponse is plain text, or the error envelope for callers preferring JSON.
+func errorResponse(description string) response {
+	return response{Description: description, Content: map[string]mediaType{
+		echo.MIMETextPlain:       {Schema: &schema{Type: "string"}},
+		echo.MIMEApplicationJSON: {Schema: &schema{Ref: "#/components/schemas/ErrorResponse"}},
+	}}
+}
+
+// schemaOf generates the schema of the response struct from its JSON field tags.
+func schemaOf(v interface{}) *schema {
+	return schemaOfType(reflect.TypeOf(v))
+}
+
+func schemaOfType(t reflect.Type) *schema {
+	// Raw JSON can be any value.
+	if t == reflect.TypeOf(json.RawMessage(nil)) {
+		return &schema{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return &schema{Type: "integer"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Pointer:
+		return schemaOfType(t.Elem())
+	case reflect.Slice:
+		return &schema{Type: "array", Items: schemaOfType(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: schemaOfType(t.Elem())}
+	case reflect.Struct:
+		s := &schema{Type: "object", Properties: map[string]*schema{}}
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			s.Properties[name] = schemaOfType(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				s.Required = append(s.Required, name)
+			}
+		}
+		return s
+	default:
+		return &schema{}
+	}
+}
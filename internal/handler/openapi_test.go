@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+var pathParamPattern = regexp.MustCompile(`:([a-z_]+)`)
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  appconfig.Config
+	}{
+		{name: "default", cfg: appconfig.Config{}},
+		{name: "all features", cfg: appconfig.Config{DdbChannelIDIndexName: "channel_id-index", BroadcastTableName: "broadcast"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEchoHandler(tt.cfg, &mockSlackClient{}, &mockTokenService{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+			var routes []string
+			for _, r := range e.Routes() {
+				routes = append(routes, strings.ToLower(r.Method)+" "+pathParamPattern.ReplaceAllString(r.Path, "{$1}"))
+			}
+			var documented []string
+			for path, ops := range buildOpenAPIDocument(tt.cfg).Paths {
+				for method := range ops {
+					documented = append(documented, method+" "+path)
+				}
+			}
+			sort.Strings(routes)
+			sort.Strings(documented)
+			assert.Equal(t, routes, documented)
+		})
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	cfg := appconfig.Config{}
+	e := NewEchoHandler(cfg, &mockSlackClient{}, &mockTokenService{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, openAPIVersion, doc["openapi"])
+
+	// Response schemas are generated from the structs.
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	webhook := schemas["WebhookResponse"].(map[string]interface{})
+	assert.Contains(t, webhook["properties"], "channel_id")
+	assert.Equal(t, []interface{}{"ok", "channel_id"}, webhook["required"])
+}
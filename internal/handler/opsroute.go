@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// opsClass is the class of ops notifications, which OPS_ROUTING routes to channels.
+type opsClass string
+
+const (
+	opsClassArchive      opsClass = "archive"
+	opsClassRestore      opsClass = "restore"
+	opsClassMigration    opsClass = "migration"
+	opsClassRename       opsClass = "rename"
+	opsClassStale        opsClass = "stale"
+	opsClassRotation     opsClass = "rotation"
+	opsClassPanic        opsClass = "panic"
+	opsClassBatchSummary opsClass = "batch_summary"
+	// Batch summaries having errors.
+	opsClassError opsClass = "error"
+	// State transitions of the Slack API circuit breaker.
+	opsClassCircuit opsClass = "circuit"
+	// Differences between the storages in dual-write mode.
+	opsClassDrift opsClass = "drift"
+	// Webhook requests keep failing because the channel is not found or archived.
+	opsClassUndeliverable opsClass = "undeliverable"
+)
+
+var opsClasses = []opsClass{opsClassArchive, opsClassRestore, opsClassMigration, opsClassRename, opsClassStale, opsClassRotation, opsClassPanic, opsClassBatchSummary, opsClassError, opsClassCircuit, opsClassDrift, opsClassUndeliverable}
+
+// opsRouteDocument is the JSON of each class in OPS_ROUTING.
+type opsRouteDocument struct {
+	// Empty uses the ops channel.
+	Channel  string `json:"channel"`
+	Suppress bool   `json:"suppress"`
+	// text/template having {{.Class}} and {{.Message}}. Empty posts the message as is.
+	Template string `json:"template"`
+	// Reply in the daily thread of the channel, see opsThreads.
+	Thread bool `json:"thread"`
+}
+
+type opsRoute struct {
+	channel  string
+	suppress bool
+	template *template.Template
+	thread   bool
+}
+
+// opsTemplateData is given to the templates.
+type opsTemplateData struct {
+	Class   string
+	Message string
+}
+
+// ValidateOpsRouting validates OPS_ROUTING and OPS_THREAD_TIME_ZONE, so invalid routing fails at startup instead
+// of losing notifications.
+func ValidateOpsRouting(config appconfig.Config) error {
+	if _, err := parseOpsRouting(config.OpsRouting); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(config.OpsThreadTimeZone); err != nil {
+		return errors.Wrap(err, "invalid OPS_THREAD_TIME_ZONE")
+	}
+	return nil
+}
+
+// CircuitNotifier returns the listener notifying the ops channel of the state transitions of the Slack API circuit
+// breaker. The notification bypasses the circuit, so the ops channel knows that the circuit opened.
+func CircuitNotifier(cfg appconfig.Config, slackClient slackClient, settings runtimeSettings) slack.CircuitListener {
+	m := newRecordMaintainer(cfg, slackClient, nil, settings, nil, nil, nil)
+	return func(ctx context.Context, from slack.CircuitState, to slack.CircuitState) {
+		ctx = slack.WithoutCircuitBreaker(context.WithoutCancel(ctx))
+		msg := fmt.Sprintf("Slack API circuit breaker changed from %s to %s.", from, to)
+		if to == slack.CircuitOpen {
+			msg += fmt.Sprintf(" Webhook requests fail with 503 for %s.", cfg.SlackCircuitBreakerCooldown)
+		}
+		if err := m.notifyOps(ctx, opsClassCircuit, msg); err != nil {
+			slog.ErrorContext(ctx, "failed to notify circuit breaker state change", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// DriftNotifier returns the listener notifying the ops channel of drifts between the storages in dual-write mode.
+func DriftNotifier(cfg appconfig.Config, slackClient slackClient, settings runtimeSettings) storage.DriftListener {
+	m := newRecordMaintainer(cfg, slackClient, nil, settings, nil, nil, nil)
+	return func(ctx context.Context, drift storage.Drift) {
+		ctx = context.WithoutCancel(ctx)
+		msg := fmt.Sprintf("Storage drift detected: operation=%s, key=%s\n%s\n", drift.Operation, drift.Key, drift.Detail)
+		if err := m.notifyOps(ctx, opsClassDrift, msg); err != nil {
+			slog.ErrorContext(ctx, "failed to notify storage drift", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// parseOpsRouting parses the JSON object of classes to routes, e.g. `{"panic": {"channel": "ops-alerts"}}`.
+// Classes not in the object are posted to the ops channel as is.
+func parseOpsRouting(value string) (map[opsClass]opsRoute, error) {
+	routes := map[opsClass]opsRoute{}
+	if value == "" {
+		return routes, nil
+	}
+	var doc map[string]opsRouteDocument
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "failed to parse OPS_ROUTING")
+	}
+	for name, d := range doc {
+		class := opsClass(name)
+		if !slices.Contains(opsClasses, class) {
+			return nil, errors.Newf("unknown class in OPS_ROUTING: %s", name)
+		}
+		route := opsRoute{channel: d.Channel, suppress: d.Suppress, thread: d.Thread}
+		if d.Template != "" {
+			tmpl, err := template.New(name).Option("missingkey=error").Parse(d.Template)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid template of OPS_ROUTING class: %s", name)
+			}
+			route.template = tmpl
+		}
+		routes[class] = route
+	}
+	return routes, nil
+}
+
+// render applies the template of the route to the message.
+func (r opsRoute) render(class opsClass, msg string) (string, error) {
+	if r.template == nil {
+		return msg, nil
+	}
+	var buf bytes.Buffer
+	data := opsTemplateData{Class: string(class), Message: strings.TrimSpace(msg)}
+	if err := r.template.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "failed to render ops notification template: %s", class)
+	}
+	return buf.String(), nil
+}
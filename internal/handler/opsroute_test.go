@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestParseOpsRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "valid", value: `{"panic": {"channel": "ops-alerts", "template": ":rotating_light: {{.Message}}"}, "batch_summary": {"suppress": true}}`},
+		{name: "unknown class", value: `{"unknown": {"channel": "ops"}}`, wantErr: true},
+		{name: "unknown field", value: `{"panic": {"chanel": "ops"}}`, wantErr: true},
+		{name: "invalid template", value: `{"panic": {"template": "{{.Message"}}`, wantErr: true},
+		{name: "invalid JSON", value: `panic=ops`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseOpsRouting(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNotifyOpsRouting(t *testing.T) {
+	cfg := defaultConfig
+	cfg.OpsRouting = `{"panic": {"channel": "ops-alerts", "template": ":rotating_light: {{.Class}}: {{.Message}}"}, "batch_summary": {"suppress": true}}`
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "ops-alerts", "ops-alerts", map[string]interface{}{"text": ":rotating_light: panic: boom"}).Return(slack.PostMessageResult{}, nil)
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", map[string]interface{}{"text": "migration\n"}).Return(slack.PostMessageResult{}, nil)
+	m := newRecordMaintainer(cfg, slackClient, nil, nil, nil, nil, nil)
+	ctx := context.Background()
+
+	require.NoError(t, m.notifyOps(ctx, opsClassPanic, "boom\n"))
+	require.NoError(t, m.notifyOps(ctx, opsClassBatchSummary, "summary\n"))
+	// Classes not routed are posted to the ops channel as is.
+	require.NoError(t, m.notifyOps(ctx, opsClassMigration, "migration\n"))
+
+	slackClient.AssertExpectations(t)
+	slackClient.AssertNumberOfCalls(t, "PostMessage", 2)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// opsThreadStore shares the parent messages of ops threads across processes, e.g. service.IdempotencyService.
+type opsThreadStore interface {
+	BeginOpsThread(ctx context.Context, channel string, day string) (string, bool, error)
+	CompleteOpsThread(ctx context.Context, channel string, day string, ts string, expiresAt time.Time) error
+	AbortOpsThread(ctx context.Context, channel string, day string) error
+}
+
+// opsThreads finds or creates the daily parent message of ops channels for classes routed with `"thread": true`,
+// so floods of e.g. batch summaries don't bury other notifications. Days are in OPS_THREAD_TIME_ZONE. Parents are
+// cached in the process and shared with the optional store, without which each process creates its own parent.
+type opsThreads struct {
+	store    opsThreadStore
+	location *time.Location
+	now      func() time.Time
+
+	// Creating parents is serialized, so concurrent notifications of a batch run reply in one thread.
+	mu  sync.Mutex
+	day string
+	// Channel to ts of the parent of the day.
+	parents map[string]string
+}
+
+// newOpsThreads falls back to UTC for invalid time zones, which ValidateOpsRouting rejects at startup.
+func newOpsThreads(timeZone string, store opsThreadStore) *opsThreads {
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	return &opsThreads{store: store, location: location, now: time.Now, parents: map[string]string{}}
+}
+
+// parent returns `ts` of the parent message of the day in the channel, posting it when not found. Empty `ts`
+// means another process is posting the parent, post the notification at the top level then.
+func (t *opsThreads) parent(ctx context.Context, slackClient slackClient, channel string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now().In(t.location)
+	day := now.Format(time.DateOnly)
+	if day != t.day {
+		t.day = day
+		t.parents = map[string]string{}
+	}
+	if ts, ok := t.parents[channel]; ok {
+		return ts, nil
+	}
+
+	if t.store != nil {
+		ts, found, err := t.store.BeginOpsThread(ctx, channel, day)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			if ts != "" {
+				t.parents[channel] = ts
+			}
+			return ts, nil
+		}
+	}
+	text := fmt.Sprintf(":spiral_calendar_pad: Belldog ops notifications of %s (%s). Notifications of the day are posted in this thread.", day, t.location)
+	result, err := slackClient.PostMessage(ctx, channel, channel, map[string]interface{}{"text": text})
+	if err == nil {
+		err = handlePostMessageFailure(result)
+	}
+	if err != nil {
+		if t.store != nil {
+			if abortErr := t.store.AbortOpsThread(ctx, channel, day); abortErr != nil {
+				slog.WarnContext(ctx, "failed to abort ops thread", slog.String("error", abortErr.Error()))
+			}
+		}
+		return "", errors.Wrap(err, "failed to post the parent of ops thread")
+	}
+	if t.store != nil {
+		y, m, d := now.Date()
+		endOfDay := time.Date(y, m, d+1, 0, 0, 0, 0, t.location)
+		if err := t.store.CompleteOpsThread(ctx, channel, day, result.TS, endOfDay); err != nil {
+			slog.WarnContext(ctx, "failed to save ops thread", slog.String("error", err.Error()))
+		}
+	}
+	t.parents[channel] = result.TS
+	return result.TS, nil
+}
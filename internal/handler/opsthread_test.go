@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func isOpsThreadParent(payload map[string]interface{}) bool {
+	text, _ := payload["text"].(string)
+	return strings.HasPrefix(text, ":spiral_calendar_pad:")
+}
+
+func TestNotifyOpsThread(t *testing.T) {
+	cfg := defaultConfig
+	cfg.OpsRouting = `{"batch_summary": {"thread": true}, "error": {"channel": "ops-alerts", "thread": true}}`
+	cfg.OpsThreadTimeZone = "Asia/Tokyo"
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", mock.MatchedBy(isOpsThreadParent)).Return(slack.PostMessageResult{TS: "1700000000.000100"}, nil).Once()
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", map[string]interface{}{"text": "summary\n", "thread_ts": "1700000000.000100"}).Return(slack.PostMessageResult{}, nil).Twice()
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", map[string]interface{}{"text": "migration\n"}).Return(slack.PostMessageResult{}, nil).Once()
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", map[string]interface{}{"text": "summary\n", "thread_ts": "1700086400.000100"}).Return(slack.PostMessageResult{}, nil).Once()
+	// Another process is posting the parent of ops-alerts.
+	slackClient.On("PostMessage", mock.Anything, "ops-alerts", "ops-alerts", map[string]interface{}{"text": "error\n"}).Return(slack.PostMessageResult{}, nil).Once()
+	store := &mockIdempotencyService{}
+	store.On("BeginOpsThread", mock.Anything, "ops", "2024-01-01").Return("", false, nil).Once()
+	store.On("CompleteOpsThread", mock.Anything, "ops", "2024-01-01", "1700000000.000100", mock.MatchedBy(func(expiresAt time.Time) bool {
+		return expiresAt.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.FixedZone("JST", 9*60*60)))
+	})).Return(nil).Once()
+	store.On("BeginOpsThread", mock.Anything, "ops", "2024-01-02").Return("1700086400.000100", true, nil).Once()
+	store.On("BeginOpsThread", mock.Anything, "ops-alerts", "2024-01-02").Return("", true, nil).Once()
+
+	m := newRecordMaintainer(cfg, slackClient, nil, nil, nil, store, nil)
+	// 2024-01-01T23:00:00+09:00.
+	now := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)
+	m.opsThreads.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	require.NoError(t, m.notifyOps(ctx, opsClassBatchSummary, "summary\n"))
+	// The parent is cached in the process.
+	require.NoError(t, m.notifyOps(ctx, opsClassBatchSummary, "summary\n"))
+	// Classes not routed with thread are posted at the top level.
+	require.NoError(t, m.notifyOps(ctx, opsClassMigration, "migration\n"))
+
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, m.notifyOps(ctx, opsClassBatchSummary, "summary\n"))
+	require.NoError(t, m.notifyOps(ctx, opsClassError, "error\n"))
+
+	slackClient.AssertExpectations(t)
+	store.AssertExpectations(t)
+}
+
+func TestNotifyOpsThreadWithoutStore(t *testing.T) {
+	cfg := defaultConfig
+	cfg.OpsRouting = `{"batch_summary": {"thread": true}}`
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", mock.MatchedBy(isOpsThreadParent)).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultAPIFailure, Reason: "not_in_channel",
+	}, nil).Once()
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", map[string]interface{}{"text": "summary\n"}).Return(slack.PostMessageResult{}, nil).Once()
+
+	m := newRecordMaintainer(cfg, slackClient, nil, nil, nil, nil, nil)
+	// Failing to post the parent doesn't lose the notification.
+	require.NoError(t, m.notifyOps(context.Background(), opsClassBatchSummary, "summary\n"))
+	slackClient.AssertExpectations(t)
+}
+
+func TestValidateOpsRoutingTimeZone(t *testing.T) {
+	cfg := defaultConfig
+	cfg.OpsThreadTimeZone = "Asia/Tokyo"
+	assert.NoError(t, ValidateOpsRouting(cfg))
+	cfg.OpsThreadTimeZone = "Mars/Olympus"
+	assert.Error(t, ValidateOpsRouting(cfg))
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+const auditResultPermissionDenied = "permission_denied"
+
+const permissionDeniedMessage = "Permission denied: you are not allowed to run this command. Ask the workspace admins for permission.\n"
+
+// authorizeUser restricts token operation commands to users allowed by PERMISSION_ROLES or PERMISSION_USERGROUP_ID.
+// Users in PERMISSION_ADMIN_USER_IDS bypass the checks. Without roles and the user group, all users are allowed.
+func (h *ProxyHandler) authorizeUser(spec commandSpec, next commandFunc) commandFunc {
+	return func(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+		if spec.permission != permissionTokenOperation {
+			return next(c, cmdReq)
+		}
+		ctx := c.Request().Context()
+		allowed, err := h.isAuthorized(ctx, cmdReq.UserID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			slog.InfoContext(ctx, "permission denied", slog.String("command", spec.name), slog.String("user_id", cmdReq.UserID))
+			h.recordAudit(ctx, cmdReq, auditResultPermissionDenied)
+			return ephemeralResponse(c, permissionDeniedMessage)
+		}
+		return next(c, cmdReq)
+	}
+}
+
+func (h *ProxyHandler) isAuthorized(ctx context.Context, userID string) (bool, error) {
+	if len(h.cfg.PermissionRoles) == 0 && h.cfg.PermissionUserGroupID == "" {
+		return true, nil
+	}
+	if h.isAdmin(userID) {
+		return true, nil
+	}
+	if len(h.cfg.PermissionRoles) > 0 {
+		role, err := h.slackClient.GetUserRole(ctx, userID)
+		if err != nil {
+			return false, err
+		}
+		if slices.Contains(h.cfg.PermissionRoles, string(role)) {
+			return true, nil
+		}
+	}
+	if h.cfg.PermissionUserGroupID != "" {
+		members, err := h.slackClient.GetUserGroupMembers(ctx, h.cfg.PermissionUserGroupID)
+		if err != nil {
+			return false, err
+		}
+		if slices.Contains(members, userID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isAdmin tells whether the user is in PERMISSION_ADMIN_USER_IDS.
+func (h *ProxyHandler) isAdmin(userID string) bool {
+	return slices.Contains(h.cfg.PermissionAdminUserIDs, userID)
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestIsAuthorized(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     appconfig.Config
+		role    slack.UserRole
+		members []string
+		want    bool
+	}{
+		{name: "not configured", cfg: appconfig.Config{}, want: true},
+		{name: "allowed role", cfg: appconfig.Config{PermissionRoles: []string{"owner", "admin"}}, role: slack.UserRoleAdmin, want: true},
+		{name: "denied role", cfg: appconfig.Config{PermissionRoles: []string{"owner", "admin"}}, role: slack.UserRoleMember, want: false},
+		{name: "user group member", cfg: appconfig.Config{PermissionUserGroupID: "S123456"}, members: []string{"U999999", "U123456"}, want: true},
+		{name: "not user group member", cfg: appconfig.Config{PermissionUserGroupID: "S123456"}, members: []string{"U999999"}, want: false},
+		{name: "role or user group", cfg: appconfig.Config{PermissionRoles: []string{"owner"}, PermissionUserGroupID: "S123456"}, role: slack.UserRoleGuest, members: []string{"U123456"}, want: true},
+		{name: "admin bypass", cfg: appconfig.Config{PermissionRoles: []string{"owner"}, PermissionAdminUserIDs: []string{"U123456"}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			slackClient.On("GetUserRole", mock.Anything, "U123456").Return(tt.role, nil)
+			slackClient.On("GetUserGroupMembers", mock.Anything, "S123456").Return(tt.members, nil)
+			h := ProxyHandler{cfg: tt.cfg, slackClient: slackClient}
+
+			got, err := h.isAuthorized(context.Background(), "U123456")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunCommandDeniesUnauthorizedUser(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	slackClient.On("GetUserGroupMembers", mock.Anything, "S123456").Return([]string{"U999999"}, nil)
+	svc := &mockTokenService{}
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.Command == cmdRevoke && entry.Result == auditResultPermissionDenied
+	})).Return(nil)
+	h := ProxyHandler{
+		cfg:         appconfig.Config{PermissionUserGroupID: "S123456"},
+		slackClient: slackClient,
+		tokenSvc:    svc,
+		auditSvc:    auditSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdRevoke
+	cmdReq.Text = "deadbeef"
+	spec, ok := findCommand(cmdRevoke)
+	require.True(t, ok)
+	c, rec := setupCommandContext()
+	err := h.runCommand(spec, c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "ephemeral", resp["response_type"])
+	assert.Contains(t, resp["text"], "Permission denied")
+	auditSvc.AssertExpectations(t)
+	svc.AssertNotCalled(t, "RevokeToken", mock.Anything, mock.Anything, mock.Anything)
+}
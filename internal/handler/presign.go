@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/service"
+)
+
+// Query parameters of pre-signed URLs.
+const (
+	presignExpiresQuery   = "expires"
+	presignSignatureQuery = "signature"
+)
+
+// TTL of pre-signed URLs when the request doesn't give it.
+const defaultPresignTTL = time.Hour
+
+type presignRequest struct {
+	// Duration string like `30m`. Must not be longer than PRESIGN_MAX_TTL.
+	TTL string `json:"ttl"`
+}
+
+type presignResponse struct {
+	Ok        bool   `json:"ok"`
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// WebhookPresign mints a pre-signed URL of the channel, so operators can hand out temporary posting URLs to third
+// parties without the long-lived token. Requires `manage` scope: pre-signed URLs can't mint other URLs.
+func (h *ProxyHandler) WebhookPresign(c echo.Context) error {
+	apierror.PreferJSON(c)
+	res, ok, err := h.verifyWebhookToken(c, service.ScopeManage)
+	if !ok {
+		return err
+	}
+	ctx := c.Request().Context()
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read request body")
+	}
+	var req presignRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid body given. JSON Unmarshal failed.\n")
+		}
+	}
+	ttl := min(defaultPresignTTL, h.cfg.PresignMaxTTL)
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 || ttl > h.cfg.PresignMaxTTL {
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPayload, fmt.Sprintf("Invalid ttl given. It must be a duration up to %s.\n", h.cfg.PresignMaxTTL))
+		}
+	}
+
+	presigned, err := h.tokenSvc.Presign(ctx, res.ChannelName, secret.Token(c.Param("token")), time.Now().Add(ttl))
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "pre-signed URL minted", slog.String("token_prefix", presigned.Prefix), slog.Time("expires_at", presigned.ExpiresAt))
+	return c.JSON(http.StatusOK, presignResponse{
+		Ok:        true,
+		URL:       h.buildPresignedURL(presigned, c.Request().Host),
+		ExpiresAt: presigned.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (h *ProxyHandler) buildPresignedURL(presigned service.PresignResult, domainName string) string {
+	if h.cfg.CustomDomainName != "" {
+		domainName = h.cfg.CustomDomainName
+	}
+	query := url.Values{}
+	query.Set(presignExpiresQuery, fmt.Sprint(presigned.ExpiresAt.Unix()))
+	query.Set(presignSignatureQuery, presigned.Signature)
+	return fmt.Sprintf("https://%s/p/%s/%s?%s", domainName, url.PathEscape(presigned.ChannelName), presigned.Prefix, query.Encode())
+}
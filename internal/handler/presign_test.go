@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestWebhookPresign(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	expiresAt := time.Unix(1700000000, 0)
+	svc.On("Presign", mock.Anything, "test", "deadbeef", mock.AnythingOfType("time.Time")).Return(service.PresignResult{
+		ChannelName: "test",
+		Prefix:      "deadbeef",
+		ExpiresAt:   expiresAt,
+		Signature:   "cafe",
+	}, nil)
+
+	h := ProxyHandler{cfg: appconfig.Config{PresignMaxTTL: 24 * time.Hour, CustomDomainName: "belldog.example.com"}, tokenSvc: svc}
+	payload := `{"ttl": "30m"}`
+	c := setupContext(&payload)
+	err := h.WebhookPresign(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.JSONEq(t, `{"ok": true, "url": "https://belldog.example.com/p/test/deadbeef?expires=1700000000&signature=cafe", "expires_at": "2023-11-14T22:13:20Z"}`, rec.Body.String())
+	requested := svc.Calls[1].Arguments.Get(3).(time.Time)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), requested, time.Minute)
+}
+
+func TestWebhookPresignTTLTooLong(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+
+	h := ProxyHandler{cfg: appconfig.Config{PresignMaxTTL: time.Hour}, tokenSvc: svc}
+	payload := `{"ttl": "2h"}`
+	c := setupContext(&payload)
+	err := h.WebhookPresign(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	svc.AssertNotCalled(t, "Presign", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookWithPresignedURL(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyPresigned", mock.Anything, "test", "deadbeef", "1700000000", "cafe").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", defaultPayload).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupPresignedContext(defaultPayloadJSON())
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	svc.AssertNotCalled(t, "VerifyToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookWithExpiredPresignedURL(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyPresigned", mock.Anything, "test", "deadbeef", "1700000000", "cafe").Return(service.VerifyResult{}, service.ErrPresignExpired)
+
+	h := ProxyHandler{cfg: appconfig.Config{}, tokenSvc: svc}
+	c := setupPresignedContext(defaultPayloadJSON())
+	c.Request().Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Contains(t, rec.Body.String(), `"code":"expired"`)
+}
+
+func setupPresignedContext(payload string) echo.Context {
+	req := httptest.NewRequest(http.MethodPost, "/p/test/deadbeef?expires=1700000000&signature=cafe", strings.NewReader(payload))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.SetPath("/p/:channel_name/:token")
+	c.SetParamNames("channel_name", "token")
+	c.SetParamValues("test", "deadbeef")
+	return c
+}
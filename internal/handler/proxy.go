@@ -1,36 +1,114 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
+	"github.com/Finatext/belldog/internal/apierror"
 	"github.com/Finatext/belldog/internal/appconfig"
 	"github.com/Finatext/belldog/internal/middlewares"
+	"github.com/Finatext/belldog/internal/slack"
 )
 
 type ProxyHandler struct {
-	cfg         appconfig.Config
-	slackClient slackClient
-	tokenSvc    tokenService
+	cfg              appconfig.Config
+	slackClient      slackClient
+	tokenSvc         tokenService
+	auditSvc         auditService
+	channelConfigSvc channelConfigService
+	mentionSvc       mentionService
+	idempotencySvc   idempotencyService
+	digestSvc        digestService
+	broadcastSvc     broadcastService
+	ddb              storageDDB
+	settings         runtimeSettings
+	maintainer       recordMaintainer
+	deferrer         commandDeferrer
+	receipts         receiptEmitter
+	inventorySvc     inventoryService
+	replayCache      *slack.ReplayCache
 }
 
-func NewEchoHandler(cfg appconfig.Config, slackClient slackClient, svc tokenService) *echo.Echo {
+func NewEchoHandler(cfg appconfig.Config, slackClient slackClient, svc tokenService, auditSvc auditService, channelConfigSvc channelConfigService, mentionSvc mentionService, idempotencySvc idempotencyService, digestSvc digestService, broadcastSvc broadcastService, ddb storageDDB, settings runtimeSettings, deferrer commandDeferrer, receipts receiptEmitter, lifecycleSvc lifecycleService, inventorySvc inventoryService) *echo.Echo {
 	h := ProxyHandler{
-		cfg:         cfg,
-		slackClient: slackClient,
-		tokenSvc:    svc,
+		cfg:              cfg,
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		auditSvc:         auditSvc,
+		channelConfigSvc: channelConfigSvc,
+		mentionSvc:       mentionSvc,
+		idempotencySvc:   idempotencySvc,
+		digestSvc:        digestSvc,
+		broadcastSvc:     broadcastSvc,
+		ddb:              ddb,
+		settings:         settings,
+		receipts:         receipts,
+		inventorySvc:     inventorySvc,
+		maintainer:       newRecordMaintainer(cfg, slackClient, ddb, settings, auditSvc, idempotencySvc, lifecycleSvc),
+		replayCache:      slack.NewReplayCache(),
 	}
 
+	// File uploads are not limited by MAX_BODY_BYTES, Lambda limits the request size anyway.
+	bodyLimit := middlewares.BodyLimit(cfg.MaxBodyBytes)
+	// Webhook clients may send JSON bodies without Content-Type or with text/plain.
+	webhookTypes := middlewares.AllowContentTypes("", echo.MIMEApplicationJSON, echo.MIMEApplicationForm, echo.MIMETextPlain)
+	filesTypes := middlewares.AllowContentTypes(echo.MIMEMultipartForm)
+	slackFormTypes := middlewares.AllowContentTypes(echo.MIMEApplicationForm)
+
 	e := echo.New()
+	// Without a deferrer given, e.g. server mode, deferred commands are processed in goroutines.
+	h.deferrer = deferrer
+	if h.deferrer == nil {
+		h.deferrer = &inProcessDeferrer{handler: e}
+	}
+	e.HTTPErrorHandler = apierror.HTTPErrorHandler(e)
 	e.GET("/hc", h.HealthCheck)
-	e.POST("/p/:channel_name/:token", h.Webhook)
-	e.POST("/slash", h.SlashCommand)
+	e.GET("/openapi.json", h.OpenAPI)
+	e.GET("/p/:channel_name/:token", h.WebhookVerify)
+	e.GET("/p/:channel_name/:token/members", h.WebhookMembers)
+	e.POST("/p/:channel_name/:token", h.Webhook, bodyLimit, webhookTypes)
+	e.POST("/p/:channel_name/:token/update", h.WebhookUpdate, bodyLimit, webhookTypes)
+	e.POST("/p/:channel_name/:token/delete", h.WebhookDelete, bodyLimit, webhookTypes)
+	e.POST("/p/:channel_name/:token/pin", h.WebhookPin, bodyLimit, webhookTypes)
+	e.POST("/p/:channel_name/:token/react", h.WebhookReact, bodyLimit, webhookTypes)
+	e.POST("/p/:channel_name/:token/bookmark", h.WebhookBookmark, bodyLimit, webhookTypes)
+	e.POST("/p/:channel_name/:token/canvas", h.WebhookCanvas, bodyLimit, webhookTypes)
+	e.POST("/p/:channel_name/:token/files", h.WebhookFiles, filesTypes)
+	e.POST("/p/:channel_name/:token/workflow", h.WebhookWorkflow, bodyLimit, webhookTypes)
+	e.POST("/p/:channel_name/:token/preview", h.WebhookPreview, bodyLimit, webhookTypes)
+	e.POST("/p/:channel_name/:token/presign", h.WebhookPresign, bodyLimit, middlewares.AllowContentTypes(echo.MIMEApplicationJSON))
+	if cfg.DdbChannelIDIndexName != "" {
+		e.GET("/c/:channel_id/:token", h.WebhookVerify)
+		e.GET("/c/:channel_id/:token/members", h.WebhookMembers)
+		e.POST("/c/:channel_id/:token", h.Webhook, bodyLimit, webhookTypes)
+		e.POST("/c/:channel_id/:token/update", h.WebhookUpdate, bodyLimit, webhookTypes)
+		e.POST("/c/:channel_id/:token/delete", h.WebhookDelete, bodyLimit, webhookTypes)
+		e.POST("/c/:channel_id/:token/pin", h.WebhookPin, bodyLimit, webhookTypes)
+		e.POST("/c/:channel_id/:token/react", h.WebhookReact, bodyLimit, webhookTypes)
+		e.POST("/c/:channel_id/:token/bookmark", h.WebhookBookmark, bodyLimit, webhookTypes)
+		e.POST("/c/:channel_id/:token/canvas", h.WebhookCanvas, bodyLimit, webhookTypes)
+		e.POST("/c/:channel_id/:token/files", h.WebhookFiles, filesTypes)
+		e.POST("/c/:channel_id/:token/workflow", h.WebhookWorkflow, bodyLimit, webhookTypes)
+		e.POST("/c/:channel_id/:token/preview", h.WebhookPreview, bodyLimit, webhookTypes)
+	}
+	if cfg.BroadcastTableName != "" {
+		e.POST("/b/:group_name/:token", h.WebhookBroadcast, bodyLimit, webhookTypes)
+	}
+	e.POST("/slash", h.SlashCommand, bodyLimit, slackFormTypes)
+	e.POST("/events", h.Events, bodyLimit, middlewares.AllowContentTypes(echo.MIMEApplicationJSON))
+	e.POST("/interactive", h.Interactive, bodyLimit, slackFormTypes)
 
 	e.Pre(middleware.RemoveTrailingSlash())
-	e.Use(middleware.RequestID())
-	e.Use(middlewares.RequestLogger())
+	e.Use(middlewares.RequestID())
+	e.Use(middlewares.LogAttributes)
+	e.Use(middlewares.RequestLogger(cfg))
+	// After the logger, so it logs 500 responses of panics.
+	e.Use(h.recoverPanic)
+	e.Use(middlewares.Deadline(cfg.LambdaDeadlineReserve))
+	e.Use(middlewares.StorageThrottled)
 	e.Use(addCacheControlHeader)
 
 	return e
@@ -42,3 +120,16 @@ func addCacheControlHeader(next echo.HandlerFunc) echo.HandlerFunc {
 		return next(c)
 	}
 }
+
+func (h *ProxyHandler) signingSecrets() slack.SigningSecrets {
+	return slack.SigningSecrets{Current: h.cfg.SlackSigningSecret, Previous: h.cfg.SlackSigningSecretPrevious}
+}
+
+func (h *ProxyHandler) verifySlackRequest(ctx context.Context, headers http.Header, body string) bool {
+	v := slack.Verifier{Secrets: h.signingSecrets(), Tolerance: h.cfg.SlackSignatureTolerance, Replay: h.replayCache}
+	// Deferred commands are verified again with the same signature.
+	if isDeferredRun(ctx) {
+		v.Replay = nil
+	}
+	return v.Verify(ctx, headers, body)
+}
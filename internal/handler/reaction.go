@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// Name of the reaction emoji, e.g. `eyes` or `:eyes:`.
+const reactionNameKey = "name"
+
+// WebhookPin pins the message of `ts`, e.g. to keep important alerts at hand.
+func (h *ProxyHandler) WebhookPin(c echo.Context) error {
+	return h.proxyWebhook(c, requireTS(withMessageTimestamp(h.slackClient.AddPin, "already_pinned")), service.ScopeManage, true)
+}
+
+// WebhookReact adds the reaction to the message of `ts`, e.g. to acknowledge alerts.
+func (h *ProxyHandler) WebhookReact(c echo.Context) error {
+	send := withMessageTimestamp(h.slackClient.AddReaction, "already_reacted")
+	return h.proxyWebhook(c, func(payload map[string]interface{}) (sendFunc, string) {
+		name, _ := payload[reactionNameKey].(string)
+		name = strings.Trim(name, ":")
+		if name == "" {
+			return nil, "`name` field is required.\n"
+		}
+		payload[reactionNameKey] = name
+		return requireTS(send)(payload)
+	}, service.ScopeManage, true)
+}
+
+// withMessageTimestamp sends `ts` as `timestamp`, which pins and reactions APIs require. The API failure of
+// alreadyDone reason is responded as success, so callers can retry requests safely.
+func withMessageTimestamp(send sendFunc, alreadyDone string) sendFunc {
+	return func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+		ts, _ := payload[tsKey].(string)
+		delete(payload, tsKey)
+		payload["timestamp"] = ts
+		res, err := send(ctx, channelID, channelName, payload)
+		if err == nil && res.Type == slack.PostMessageResultAPIFailure && res.Reason == alreadyDone {
+			res = slack.PostMessageResult{Type: slack.PostMessageResultOK}
+		}
+		// Respond `ts` of the message like updates.
+		if res.Type == slack.PostMessageResultOK {
+			res.TS = ts
+		}
+		return res, err
+	}
+}
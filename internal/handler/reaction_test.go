@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func newReactionTestHandler(slackClient *mockSlackClient, scope service.Scope) ProxyHandler {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: scope}, nil)
+	return ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+}
+
+func TestWebhookPin(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	slackClient.On("AddPin", mock.Anything, "C123456", "test", map[string]interface{}{"timestamp": "1405894322.002768"}).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := newReactionTestHandler(slackClient, service.ScopeManage)
+	payload := `{"ts": "1405894322.002768"}`
+	c := setupContext(&payload)
+	err := h.WebhookPin(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "ts": "1405894322.002768"}`, rec.Body.String())
+}
+
+func TestWebhookPinRequiresManageScope(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	h := newReactionTestHandler(slackClient, service.ScopePost)
+	payload := `{"ts": "1405894322.002768"}`
+	c := setupContext(&payload)
+	err := h.WebhookPin(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, c.Response().Status)
+	slackClient.AssertNotCalled(t, "AddPin", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookReact(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		result  slack.PostMessageResult
+		status  int
+	}{
+		{name: "reacted", payload: `{"ts": "1405894322.002768", "name": ":eyes:"}`, result: slack.PostMessageResult{Type: slack.PostMessageResultOK}, status: http.StatusOK},
+		{name: "already reacted", payload: `{"ts": "1405894322.002768", "name": "eyes"}`, result: slack.PostMessageResult{Type: slack.PostMessageResultAPIFailure, Reason: "already_reacted"}, status: http.StatusOK},
+		{name: "invalid name", payload: `{"ts": "1405894322.002768", "name": "eyes"}`, result: slack.PostMessageResult{Type: slack.PostMessageResultAPIFailure, Reason: "invalid_name"}, status: http.StatusBadRequest},
+		{name: "without name", payload: `{"ts": "1405894322.002768"}`, status: http.StatusBadRequest},
+		{name: "without ts", payload: `{"name": "eyes"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			slackClient.On("AddReaction", mock.Anything, "C123456", "test", map[string]interface{}{"timestamp": "1405894322.002768", "name": "eyes"}).Return(tt.result, nil)
+
+			h := newReactionTestHandler(slackClient, service.ScopeManage)
+			c := setupContext(&tt.payload)
+			err := h.WebhookReact(c)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, c.Response().Status)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/receipt"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// Emitting a receipt must not delay responses long, receipts are best effort.
+const receiptTimeout = 2 * time.Second
+
+// emitReceipt emits the delivery receipt of the webhook request when RECEIPT_DESTINATION is set. Failures are only
+// logged: delivering messages is more important than receipts.
+func (h *ProxyHandler) emitReceipt(c echo.Context, res service.VerifyResult, body []byte, result slack.PostMessageResult, sendErr error) {
+	if h.receipts == nil || !h.receipts.Enabled() {
+		return
+	}
+	ctx := c.Request().Context()
+	r := receipt.Receipt{
+		ChannelID:    res.ChannelID,
+		ChannelName:  res.ChannelName,
+		TokenPrefix:  res.TokenPrefix,
+		TokenVersion: res.Version,
+		Route:        c.Path(),
+		Outcome:      slack.Outcome(result, sendErr),
+		PayloadHash:  receipt.HashPayload(body),
+		RequestID:    logging.RequestID(ctx),
+		Timestamp:    time.Now().UTC(),
+	}
+	if sendErr == nil {
+		r.TS = result.TS
+		r.Reason = result.Reason
+	}
+	// Emitted even when the client disconnected, the message may be delivered anyway.
+	emitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), receiptTimeout)
+	defer cancel()
+	if err := h.receipts.Emit(emitCtx, r); err != nil {
+		slog.WarnContext(ctx, "failed to emit delivery receipt", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/receipt"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+type fakeReceiptEmitter struct {
+	receipts []receipt.Receipt
+	err      error
+}
+
+func (f *fakeReceiptEmitter) Enabled() bool {
+	return true
+}
+
+func (f *fakeReceiptEmitter) Emit(ctx context.Context, r receipt.Receipt) error {
+	f.receipts = append(f.receipts, r)
+	return f.err
+}
+
+func newReceiptTestHandler(slackClient *mockSlackClient, svc *mockTokenService, emitter *fakeReceiptEmitter) ProxyHandler {
+	return ProxyHandler{
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+		receipts:         emitter,
+	}
+}
+
+func TestWebhookReceipt(t *testing.T) {
+	res := service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost, Version: 2, TokenPrefix: "dead"}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(res, nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK, TS: "1700000000.000100"}, nil)
+	emitter := &fakeReceiptEmitter{}
+
+	h := newReceiptTestHandler(slackClient, svc, emitter)
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	require.Len(t, emitter.receipts, 1)
+	got := emitter.receipts[0]
+	assert.Equal(t, "C123456", got.ChannelID)
+	assert.Equal(t, "test", got.ChannelName)
+	assert.Equal(t, "dead", got.TokenPrefix)
+	assert.Equal(t, 2, got.TokenVersion)
+	assert.Equal(t, "/p/:channel_name/:token", got.Route)
+	assert.Equal(t, "1700000000.000100", got.TS)
+	assert.Equal(t, "ok", got.Outcome)
+	assert.Equal(t, receipt.HashPayload([]byte(defaultPayloadJSON())), got.PayloadHash)
+	assert.False(t, got.Timestamp.IsZero())
+}
+
+func TestWebhookReceiptAPIFailure(t *testing.T) {
+	res := service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(res, nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{Type: slack.PostMessageResultAPIFailure, Reason: "channel_not_found"}, nil)
+	emitter := &fakeReceiptEmitter{}
+
+	h := newReceiptTestHandler(slackClient, svc, emitter)
+	err := h.Webhook(setupContext(nil))
+
+	require.NoError(t, err)
+	require.Len(t, emitter.receipts, 1)
+	assert.Equal(t, "api_failure", emitter.receipts[0].Outcome)
+	assert.Equal(t, "channel_not_found", emitter.receipts[0].Reason)
+	assert.Empty(t, emitter.receipts[0].TS)
+}
+
+func TestWebhookReceiptEmitFailure(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK, TS: "1700000000.000100"}, nil)
+	emitter := &fakeReceiptEmitter{err: errors.New("stream not found")}
+
+	h := newReceiptTestHandler(slackClient, svc, emitter)
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	// The message is delivered anyway.
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	assert.Len(t, emitter.receipts, 1)
+}
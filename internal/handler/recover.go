@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// Posting the panic notification must not block the response or the event long.
+const panicNotificationTimeout = 3 * time.Second
+
+// recoverPanic converts panics in request handling into 500 responses, so one broken request doesn't take down
+// the server. The stack trace is logged, and the ops channel is notified if PANIC_NOTIFICATION is set.
+func (h *ProxyHandler) recoverPanic(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+			req := c.Request()
+			// Log the route instead of the path, which contains the token.
+			metadata := fmt.Sprintf("method=%s, route=%s, request_id=%s", req.Method, c.Path(), c.Response().Header().Get(echo.HeaderXRequestID))
+			if channelName := c.Param("channel_name"); channelName != "" {
+				metadata += ", channel_name=" + channelName
+			}
+			var notify func(context.Context, string) error
+			if h.cfg.PanicNotification {
+				notify = h.maintainer.notifyPanic
+			}
+			handlePanic(req.Context(), "http", r, metadata, notify)
+			if c.Response().Committed {
+				err = errors.Newf("panic after the response committed: %v", r)
+				return
+			}
+			err = apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternalError, "Internal server error.\n")
+		}()
+		return next(c)
+	}
+}
+
+// recoverEventPanic converts panics in event handlers, e.g. the batch job, into errors. Call with defer.
+// notify is optional.
+func recoverEventPanic(ctx context.Context, source string, notify func(context.Context, string) error, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	handlePanic(ctx, source, r, "", notify)
+	*err = errors.Newf("panic in %s: %v", source, r)
+}
+
+// handlePanic logs the stack trace, records the metric and notifies the ops channel if notify is given.
+func handlePanic(ctx context.Context, source string, r interface{}, metadata string, notify func(context.Context, string) error) {
+	slog.ErrorContext(ctx, "recovered from panic",
+		slog.String("source", source),
+		slog.String("panic", fmt.Sprint(r)),
+		slog.String("metadata", metadata),
+		slog.String("stack", string(debug.Stack())),
+	)
+	telemetry.RecordPanic(ctx, source)
+	if notify == nil {
+		return
+	}
+	// The request context may be already canceled.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), panicNotificationTimeout)
+	defer cancel()
+	msg := fmt.Sprintf("Belldog recovered from panic: source=%s, panic=%v", source, r)
+	if metadata != "" {
+		msg += ", " + metadata
+	}
+	if err := notify(ctx, msg+"\n"); err != nil {
+		slog.ErrorContext(ctx, "failed to notify panic", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	cfg := defaultConfig
+	cfg.PanicNotification = true
+	slackClient := &mockSlackClient{}
+	slackClient.On("PostMessage", mock.Anything, "ops", "ops", mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		// The token in the path must not be posted.
+		return strings.Contains(text, "panic=boom") && strings.Contains(text, "route=/p/:channel_name/:token") &&
+			strings.Contains(text, "channel_name=general") && !strings.Contains(text, "secret-token")
+	})).Return(slack.PostMessageResult{}, nil)
+	h := ProxyHandler{
+		cfg:        cfg,
+		maintainer: newRecordMaintainer(cfg, slackClient, nil, nil, nil, nil, nil),
+	}
+
+	e := echo.New()
+	e.Use(h.recoverPanic)
+	e.POST("/p/:channel_name/:token", func(c echo.Context) error { panic("boom") })
+	req := httptest.NewRequest(http.MethodPost, "/p/general/secret-token", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	slackClient.AssertExpectations(t)
+}
+
+func TestRecoverPanicWithoutNotification(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	h := ProxyHandler{
+		cfg:        defaultConfig,
+		maintainer: newRecordMaintainer(defaultConfig, slackClient, nil, nil, nil, nil, nil),
+	}
+
+	e := echo.New()
+	e.Use(h.recoverPanic)
+	e.GET("/hc", func(c echo.Context) error { panic("boom") })
+	req := httptest.NewRequest(http.MethodGet, "/hc", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBatchRecoversPanic(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	slackClient.On("GetAllChannels", mock.Anything).Run(func(mock.Arguments) { panic("boom") })
+
+	h := NewBatchHandler(defaultConfig, slackClient, &mockStorageDDB{}, nil, nil, nil, nil, nil, nil)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+
+	require.ErrorContains(t, err, "panic in batch: boom")
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+const passiveRegionMessage = "This Belldog is running in the passive region and doesn't change tokens. Retry after the failover completes.\n"
+
+// requireActiveRegion refuses token operation commands in the passive region. Tokens written in both regions
+// diverge when DynamoDB Global Tables resolves the conflicts, so only the active region writes tokens. Webhooks
+// are proxied in both regions.
+func (h *ProxyHandler) requireActiveRegion(spec commandSpec, next commandFunc) commandFunc {
+	return func(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+		if spec.permission != permissionTokenOperation {
+			return next(c, cmdReq)
+		}
+		ctx := c.Request().Context()
+		if currentSettings(ctx, h.cfg, h.settings).Passive() {
+			slog.InfoContext(ctx, "token operation refused in passive region", slog.String("command", spec.name))
+			return ephemeralResponse(c, passiveRegionMessage)
+		}
+		return next(c, cmdReq)
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/runtimeconfig"
+)
+
+func TestRunCommandRefusedInPassiveRegion(t *testing.T) {
+	svc := &mockTokenService{}
+	h := ProxyHandler{
+		cfg:         defaultConfig,
+		slackClient: &mockSlackClient{},
+		tokenSvc:    svc,
+		settings:    staticSettings{RegionRole: runtimeconfig.RegionRolePassive},
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdGenerate
+	spec, ok := findCommand(cmdGenerate)
+	require.True(t, ok)
+	c, rec := setupCommandContext()
+	err := h.runCommand(spec, c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "ephemeral", resp["response_type"])
+	assert.Contains(t, resp["text"], "passive region")
+	svc.AssertNotCalled(t, "GenerateAndSaveToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBatchSkippedInPassiveRegion(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+
+	h := NewBatchHandler(defaultConfig, slackClient, ddb, staticSettings{RegionRole: runtimeconfig.RegionRolePassive}, nil, nil, nil, nil, nil)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+
+	require.NoError(t, err)
+	slackClient.AssertNotCalled(t, "GetAllChannels", mock.Anything)
+	ddb.AssertNotCalled(t, "ForEachRecord", mock.Anything)
+}
+
+func TestHcRegionRole(t *testing.T) {
+	h := ProxyHandler{
+		cfg:      defaultConfig,
+		settings: staticSettings{RegionRole: runtimeconfig.RegionRoleActive},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hc", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	err := h.HealthCheck(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, map[string]string{"message": "ok", "region_role": "active"}, resp)
+}
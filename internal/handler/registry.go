@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+type commandFunc func(c echo.Context, cmdReq slack.SlashCommandRequest) error
+
+// commandMiddleware wraps command processing with behaviors common to all commands, configured by the spec.
+type commandMiddleware func(spec commandSpec, next commandFunc) commandFunc
+
+type commandPermission int
+
+const (
+	// Runs in any conversation, including DMs and channels Belldog can't access.
+	permissionAny commandPermission = iota
+	// Runs only in public/private channels Belldog can access, because the command operates the channel.
+	permissionChannel
+	// permissionChannel, and only by users authorized by PERMISSION_* configs because the command operates tokens.
+	permissionTokenOperation
+)
+
+// argRange is the number of positional arguments a command accepts, not counting `--public` and flags.
+type argRange struct {
+	min int
+	// Negative means unlimited.
+	max int
+}
+
+var anyArgs = argRange{min: 0, max: -1}
+
+func (r argRange) accepts(n int) bool {
+	return n >= r.min && (r.max < 0 || n <= r.max)
+}
+
+// commandSpec describes a slash command. Keep usage and description in sync with example_app_manifest.yaml.
+type commandSpec struct {
+	name        string
+	usage       string
+	description string
+	examples    []string
+	args        argRange
+	// Optional. `key=value` flags the command accepts, see cmdargs.go.
+	flags      []flagSpec
+	permission commandPermission
+	// Respond ephemeral messages by default, e.g. for commands revealing tokens.
+	ephemeral bool
+	// Processed after acknowledging the request when SLASH_COMMAND_DEFER is enabled, for commands operating tokens
+	// which may take long with DynamoDB slowness.
+	deferred bool
+	run      func(h *ProxyHandler, c echo.Context, cmdReq slack.SlashCommandRequest) error
+	// Optional. Commands disabled by the configuration are not listed in the help message.
+	enabled func(h *ProxyHandler) bool
+}
+
+// commandRegistry lists all slash commands in the order shown in the help message. Add new commands here.
+// This is a function instead of a variable because the help command refers to the registry.
+func commandRegistry() []commandSpec {
+	return []commandSpec{
+		{
+			name:        cmdShow,
+			usage:       "[--public]",
+			description: "Show all tokens connected to this channel.",
+			args:        anyArgs,
+			permission:  permissionChannel,
+			deferred:    true,
+			run:         (*ProxyHandler).processCmdShow,
+		},
+		{
+			name:        cmdGenerate,
+			usage:       "[scope=post|manage] [--public]",
+			description: "Generate token and webhook URL.",
+			examples:    []string{cmdGenerate + " scope=manage"},
+			args:        argRange{min: 0, max: 1},
+			flags:       []flagSpec{{name: "scope", validate: validateScope}},
+			permission:  permissionTokenOperation,
+			deferred:    true,
+			run:         (*ProxyHandler).processCmdGenerate,
+		},
+		{
+			name:        cmdRegenerate,
+			usage:       "[--public]",
+			description: "Regenerate another token and URL.",
+			args:        anyArgs,
+			permission:  permissionTokenOperation,
+			deferred:    true,
+			run:         (*ProxyHandler).processCmdRegenerate,
+		},
+		{
+			name:        cmdRevoke,
+			usage:       "<token> | version=<version>",
+			description: "Revoke token. Only available in the channel in which the token was generated.",
+			examples:    []string{cmdRevoke + " 0123456789abcdef", cmdRevoke + " version=0"},
+			args:        argRange{min: 0, max: 1},
+			flags:       []flagSpec{{name: "version", validate: validateVersion}},
+			permission:  permissionTokenOperation,
+			deferred:    true,
+			run:         (*ProxyHandler).processCmdRevoke,
+		},
+		{
+			name:        cmdRevokeRenamed,
+			usage:       "<old channel name> <token>",
+			description: "Revoke old token. Use this after channel name renamed.",
+			examples:    []string{cmdRevokeRenamed + " old-channel 0123456789abcdef"},
+			args:        argRange{min: 1, max: 2},
+			permission:  permissionTokenOperation,
+			deferred:    true,
+			run:         (*ProxyHandler).processCmdRevokeRenamed,
+		},
+		{
+			name:        cmdRestore,
+			usage:       "<token>",
+			description: "Restore token revoked by mistake. Only available in the channel in which the token was revoked.",
+			examples:    []string{cmdRestore + " 0123456789abcdef"},
+			args:        argRange{min: 1, max: 1},
+			permission:  permissionTokenOperation,
+			deferred:    true,
+			run:         (*ProxyHandler).processCmdRestore,
+			enabled:     func(h *ProxyHandler) bool { return h.cfg.RevokeGracePeriod > 0 },
+		},
+		{
+			name:        cmdMapping,
+			usage:       "<token> [<rule>; <rule> | clear]",
+			description: "Show or set rules mapping fields of arbitrary JSON payloads to the Slack message.",
+			examples:    []string{cmdMapping + " 0123456789abcdef text <- $.alert.description; color <- $.severity"},
+			args:        argRange{min: 1, max: -1},
+			permission:  permissionTokenOperation,
+			deferred:    true,
+			run:         (*ProxyHandler).processCmdMapping,
+		},
+		{
+			name:        cmdLookup,
+			usage:       "<token>",
+			description: "Find the channel linked to the token.",
+			args:        argRange{min: 1, max: 1},
+			permission:  permissionChannel,
+			ephemeral:   true,
+			deferred:    true,
+			run:         (*ProxyHandler).processCmdLookup,
+			enabled:     func(h *ProxyHandler) bool { return h.cfg.DdbTokenIndexName != "" },
+		},
+		{
+			name:        cmdTest,
+			usage:       "[token]",
+			description: "Post a test message to this channel through the webhook delivery path. Checks the token if given.",
+			examples:    []string{cmdTest + " 0123456789abcdef"},
+			args:        argRange{min: 0, max: 1},
+			permission:  permissionChannel,
+			ephemeral:   true,
+			run:         (*ProxyHandler).processCmdTest,
+		},
+		{
+			name:        cmdAudit,
+			description: "Show recent token operations in this channel.",
+			args:        anyArgs,
+			permission:  permissionChannel,
+			run:         (*ProxyHandler).processCmdAudit,
+			enabled:     func(h *ProxyHandler) bool { return h.auditSvc.Enabled() },
+		},
+		{
+			name:        cmdConfig,
+			usage:       "[set <key> <value> | unset <key>]",
+			description: "Show or set default message options of this channel.",
+			examples:    []string{cmdConfig + " set username Deploy Bot", cmdConfig + " unset username"},
+			args:        anyArgs,
+			permission:  permissionChannel,
+			run:         (*ProxyHandler).processCmdConfig,
+			enabled:     func(h *ProxyHandler) bool { return h.channelConfigSvc.Enabled() },
+		},
+		{
+			name:        cmdPause,
+			description: "Stop delivering webhook messages to this channel.",
+			args:        anyArgs,
+			permission:  permissionChannel,
+			run:         (*ProxyHandler).processCmdPause,
+			enabled:     func(h *ProxyHandler) bool { return h.channelConfigSvc.Enabled() },
+		},
+		{
+			name:        cmdResume,
+			description: "Resume delivering webhook messages to this channel.",
+			args:        anyArgs,
+			permission:  permissionChannel,
+			run:         (*ProxyHandler).processCmdResume,
+			enabled:     func(h *ProxyHandler) bool { return h.channelConfigSvc.Enabled() },
+		},
+		{
+			name:        cmdBroadcast,
+			usage:       "create|delete|add|remove|show <group> [--public]",
+			description: "Manage broadcast groups posting to multiple channels.",
+			examples:    []string{cmdBroadcast + " create deploys", cmdBroadcast + " add deploys"},
+			args:        argRange{min: 2, max: 2},
+			permission:  permissionTokenOperation,
+			run:         (*ProxyHandler).processCmdBroadcast,
+			enabled:     func(h *ProxyHandler) bool { return h.broadcastSvc.Enabled() },
+		},
+		{
+			name:        cmdHelp,
+			description: "Show available commands.",
+			args:        anyArgs,
+			permission:  permissionAny,
+			ephemeral:   true,
+			run:         (*ProxyHandler).processCmdHelp,
+		},
+	}
+}
+
+// findCommand returns the help command for unknown commands.
+func findCommand(name string) (commandSpec, bool) {
+	registry := commandRegistry()
+	i := slices.IndexFunc(registry, func(spec commandSpec) bool { return spec.name == name })
+	if i < 0 {
+		return registry[slices.IndexFunc(registry, func(spec commandSpec) bool { return spec.name == cmdHelp })], false
+	}
+	return registry[i], true
+}
+
+// commandMiddlewares run in this order before the command.
+func (h *ProxyHandler) commandMiddlewares() []commandMiddleware {
+	return []commandMiddleware{logCommand, setResponseType, h.deferCommand, h.retryCommand, requirePermission, h.requireActiveRegion, h.authorizeUser, validateArgs}
+}
+
+func (h *ProxyHandler) runCommand(spec commandSpec, c echo.Context, cmdReq slack.SlashCommandRequest) error {
+	next := func(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+		return spec.run(h, c, cmdReq)
+	}
+	for _, mw := range slices.Backward(h.commandMiddlewares()) {
+		next = mw(spec, next)
+	}
+	return next(c, cmdReq)
+}
+
+func logCommand(spec commandSpec, next commandFunc) commandFunc {
+	return func(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+		// Every log line of the command has the channel.
+		ctx := logging.WithChannel(c.Request().Context(), cmdReq.ChannelID, cmdReq.ChannelName)
+		c.SetRequest(c.Request().WithContext(ctx))
+		logCommandRequest(ctx, cmdReq)
+		start := time.Now()
+		err := next(c, cmdReq)
+		slog.InfoContext(ctx, "command processed",
+			slog.String("command", spec.name),
+			slog.Bool("failed", err != nil),
+			slog.Duration("duration", time.Since(start)),
+		)
+		return err
+	}
+}
+
+const ctxKeyResponseType = "belldog.response_type"
+
+func setResponseType(spec commandSpec, next commandFunc) commandFunc {
+	return func(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+		if spec.ephemeral {
+			c.Set(ctxKeyResponseType, "ephemeral")
+		}
+		return next(c, cmdReq)
+	}
+}
+
+func requirePermission(spec commandSpec, next commandFunc) commandFunc {
+	return func(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+		if spec.permission != permissionAny && !cmdReq.Supported {
+			if cmdReq.ChannelType != "" {
+				return commandResponse(c, fmt.Sprintf("Belldog is not enabled for this type of conversation: %s. Ask Belldog admins to add it to `CHANNEL_TYPES`.\n", cmdReq.ChannelType))
+			}
+			return commandResponse(c, "Belldog only supports public/private channels. If this is a private channel, invite Belldog.\n")
+		}
+		return next(c, cmdReq)
+	}
+}
+
+func validateArgs(spec commandSpec, next commandFunc) commandFunc {
+	return func(c echo.Context, cmdReq slack.SlashCommandRequest) error {
+		args, err := parseCommandArgs(cmdReq.Text)
+		if err == nil {
+			err = args.validate(spec)
+		}
+		if err != nil {
+			return usageResponse(c, spec, err)
+		}
+		return next(c, cmdReq)
+	}
+}
+
+// commandResponse responds with the default response type of the command: in_channel unless the command
+// is marked as ephemeral.
+func commandResponse(c echo.Context, msg string) error {
+	if t, ok := c.Get(ctxKeyResponseType).(string); ok && t == "ephemeral" {
+		return ephemeralResponse(c, msg)
+	}
+	return inChannelResponse(c, msg)
+}
+
+func commandUsage(spec commandSpec) string {
+	if spec.usage == "" {
+		return spec.name
+	}
+	return spec.name + " " + spec.usage
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestCommandRegistryNamesUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, spec := range commandRegistry() {
+		assert.False(t, seen[spec.name], "duplicate command: %s", spec.name)
+		assert.NotNil(t, spec.run, "command without run: %s", spec.name)
+		seen[spec.name] = true
+	}
+}
+
+func TestRunCommandRejectsUnsupportedChannel(t *testing.T) {
+	h := ProxyHandler{cfg: appconfig.Config{}}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdGenerate
+	cmdReq.Supported = false
+	spec, ok := findCommand(cmdGenerate)
+	require.True(t, ok)
+	c, rec := setupCommandContext()
+	err := h.runCommand(spec, c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "Belldog only supports public/private channels.")
+}
+
+func TestRunCommandRejectsDisabledChannelType(t *testing.T) {
+	h := ProxyHandler{cfg: appconfig.Config{}}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdGenerate
+	cmdReq.ChannelType = slack.ChannelTypeShared
+	cmdReq.Supported = false
+	spec, ok := findCommand(cmdGenerate)
+	require.True(t, ok)
+	c, rec := setupCommandContext()
+	err := h.runCommand(spec, c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Contains(t, resp["text"], "Belldog is not enabled for this type of conversation: shared.")
+}
+
+func TestRunCommandValidatesArgs(t *testing.T) {
+	h := ProxyHandler{cfg: appconfig.Config{DdbTokenIndexName: "token-index"}}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdLookup
+	cmdReq.Text = "deadbeef extra"
+	spec, ok := findCommand(cmdLookup)
+	require.True(t, ok)
+	c, rec := setupCommandContext()
+	err := h.runCommand(spec, c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "ephemeral", resp["response_type"])
+	assert.Equal(t, "Invalid arguments for the slash command: too many arguments. Usage: `/belldog-lookup <token>`\n", resp["text"])
+}
+
+func TestFindCommandUnknownReturnsHelp(t *testing.T) {
+	auditSvc := &mockAuditService{}
+	auditSvc.On("Enabled").Return(false)
+	broadcastSvc := service.NewBroadcastService(nil)
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		auditSvc:         auditSvc,
+		channelConfigSvc: disabledChannelConfigService(),
+		broadcastSvc:     &broadcastSvc,
+	}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = "/belldog-unknown"
+	// Help is available outside of channels.
+	cmdReq.Supported = false
+	spec, ok := findCommand(cmdReq.Command)
+	require.False(t, ok)
+	c, rec := setupCommandContext()
+	err := h.runCommand(spec, c, cmdReq)
+
+	require.NoError(t, err)
+	assert.Contains(t, rec.Body.String(), "Belldog commands")
+}
+
+func TestRunCommandRejectsInvalidFlag(t *testing.T) {
+	h := ProxyHandler{cfg: appconfig.Config{}}
+	cmdReq := defaultCmdReq
+	cmdReq.Command = cmdGenerate
+	cmdReq.Text = "scope=admin"
+	spec, ok := findCommand(cmdGenerate)
+	require.True(t, ok)
+	c, rec := setupCommandContext()
+	err := h.runCommand(spec, c, cmdReq)
+
+	require.NoError(t, err)
+	resp := decodeCommandResponse(t, rec)
+	assert.Equal(t, "Invalid arguments for the slash command: invalid scope=admin: available scopes: post, manage. Usage: `/belldog-generate [scope=post|manage] [--public]`\n", resp["text"])
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+const auditResultRotationRevoked = "rotation_revoked"
+
+type rotationEvent struct {
+	record storage.Record
+	// created_at of tokens to rotate, rotated_at of tokens to revoke.
+	since time.Time
+	// Revoke the rotated token if true, otherwise generate the replacement of the token with nextVersion.
+	revoke      bool
+	nextVersion int
+}
+
+// detectRotations applies the rotation policy to the live records of a channel. The latest token older than
+// maxAge is rotated: the replacement is generated and the token is marked rotated. Rotated tokens are revoked
+// when the grace period passes, unless the replacement has been revoked meanwhile. Channels having
+// maxTokenCount tokens are skipped, they are in migration already.
+func detectRotations(ctx context.Context, recs []storage.Record, maxAge time.Duration, grace time.Duration, maxTokenCount int, now time.Time) []rotationEvent {
+	if len(recs) == 0 {
+		return nil
+	}
+	latest := recs[0]
+	for _, rec := range recs[1:] {
+		if rec.Version > latest.Version {
+			latest = rec
+		}
+	}
+
+	var events []rotationEvent
+	for _, rec := range recs {
+		if rec.RotatedAt == "" || rec.Version == latest.Version {
+			continue
+		}
+		rotatedAt, err := time.Parse(time.RFC3339Nano, rec.RotatedAt)
+		if err != nil {
+			slog.WarnContext(ctx, "invalid rotated_at, skip rotation revoke", slog.String("channel_name", rec.ChannelName), slog.Int("version", rec.Version))
+			continue
+		}
+		if now.Sub(rotatedAt) >= grace {
+			events = append(events, rotationEvent{record: rec, since: rotatedAt, revoke: true})
+		}
+	}
+
+	if latest.RotatedAt != "" {
+		// The replacement has been revoked, keep the token until users generate another one.
+		return events
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, latest.CreatedAt)
+	if err != nil {
+		slog.WarnContext(ctx, "no valid created_at, skip token rotation", slog.String("channel_name", latest.ChannelName), slog.Int("version", latest.Version))
+		return events
+	}
+	if now.Sub(createdAt) < maxAge {
+		return events
+	}
+	if len(recs) >= maxTokenCount {
+		slog.InfoContext(ctx, "channel has the max number of tokens, skip token rotation", slog.String("channel_name", latest.ChannelName), slog.Int("token_count", len(recs)))
+		return events
+	}
+	return append(events, rotationEvent{record: latest, since: createdAt, nextVersion: latest.Version + 1})
+}
+
+// processRotation saves the replacement before marking the token rotated, so tokens are never revoked without
+// a replacement.
+func (m *recordMaintainer) processRotation(ctx context.Context, evt rotationEvent) error {
+	rec := evt.record
+	slog.InfoContext(ctx, "Token is old, rotating", slog.String("channel_name", rec.ChannelName), slog.String("channel_id", rec.ChannelID), slog.Time("created_at", evt.since))
+	token, err := secret.GenerateToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	replacement := storage.Record{
+		ChannelID:   rec.ChannelID,
+		ChannelName: rec.ChannelName,
+		Token:       token.Reveal(),
+		TokenPrefix: token.Prefix(),
+		Version:     evt.nextVersion,
+		CreatedAt:   now.UTC().Format(time.RFC3339Nano),
+		Scope:       rec.Scope,
+		Mappings:    rec.Mappings,
+	}
+	if err := m.ddb.Save(ctx, replacement); err != nil {
+		return err
+	}
+	if err := m.ddb.UpdateRotatedAt(ctx, rec, now.UTC().Format(time.RFC3339Nano)); err != nil {
+		return err
+	}
+	m.publishLifecycle(ctx, service.LifecycleEvent{
+		Type:         service.LifecycleTokenGenerated,
+		ChannelID:    rec.ChannelID,
+		ChannelName:  rec.ChannelName,
+		TokenPrefix:  token.Prefix(),
+		TokenVersion: evt.nextVersion,
+		Reason:       service.LifecycleReasonRotation,
+	})
+
+	revokeAfter := now.Add(m.cfg.TokenRotationGracePeriod).Format(time.DateOnly)
+	oldPrefix := secret.Token(rec.Token).Prefix()
+	msg := fmt.Sprintf("This token was generated on %s and has been rotated: channel_name=%s, old_token=%s, new_token=%s\n",
+		evt.since.Format(time.DateOnly), rec.ChannelName, oldPrefix, token.Prefix())
+	msg += fmt.Sprintf("Replace webhook URLs having the old token with the URLs shown by `%s`. The old token will be revoked automatically after %s.\n", cmdShow, revokeAfter)
+	msgOps := fmt.Sprintf("Token rotated: channel_name=%s, channel_id=%s, version=%d, revoke_after=%s\n", rec.ChannelName, rec.ChannelID, evt.nextVersion, revokeAfter)
+	return m.notify(ctx, opsClassRotation, rec.ChannelID, rec.ChannelName, msg, msgOps)
+}
+
+func (m *recordMaintainer) processRotationRevoke(ctx context.Context, evt rotationEvent) error {
+	rec := evt.record
+	slog.InfoContext(ctx, "Rotation grace period passed, revoking", slog.String("channel_name", rec.ChannelName), slog.String("channel_id", rec.ChannelID), slog.Time("rotated_at", evt.since))
+	if err := m.revoke(ctx, rec); err != nil {
+		return err
+	}
+	entry := service.AuditEntry{
+		ChannelID:   rec.ChannelID,
+		ChannelName: rec.ChannelName,
+		UserName:    "belldog",
+		Command:     "batch",
+		Result:      auditResultRotationRevoked,
+	}
+	if err := m.auditSvc.Record(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "failed to record audit entry", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("channel_id", rec.ChannelID), slog.String("result", auditResultRotationRevoked))
+	}
+	m.publishLifecycle(ctx, service.LifecycleEvent{
+		Type:         service.LifecycleTokenRevoked,
+		ChannelID:    rec.ChannelID,
+		ChannelName:  rec.ChannelName,
+		TokenPrefix:  secret.Token(rec.Token).Prefix(),
+		TokenVersion: rec.Version,
+		Reason:       service.LifecycleReasonRotation,
+	})
+	prefix := secret.Token(rec.Token).Prefix()
+	msg := fmt.Sprintf("Rotated token revoked automatically: channel_name=%s, token=%s\nUse the URLs shown by `%s`.\n", rec.ChannelName, prefix, cmdShow)
+	if m.cfg.RevokeGracePeriod > 0 {
+		msg += fmt.Sprintf("To keep using the token, restore it with `%s %s` within %s.\n", cmdRestore, prefix, m.cfg.RevokeGracePeriod)
+	}
+	msgOps := fmt.Sprintf("Rotated token revoked: channel_name=%s, channel_id=%s, version=%d\n", rec.ChannelName, rec.ChannelID, rec.Version)
+	return m.notify(ctx, opsClassRotation, rec.ChannelID, rec.ChannelName, msg, msgOps)
+}
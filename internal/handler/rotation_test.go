@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	slackgo "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+func TestDetectRotations(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	maxAge := 90 * 24 * time.Hour
+	grace := 14 * 24 * time.Hour
+	ts := func(daysAgo int) string {
+		return now.Add(-time.Duration(daysAgo) * 24 * time.Hour).Format(time.RFC3339Nano)
+	}
+
+	type event struct {
+		version int
+		revoke  bool
+	}
+	tests := []struct {
+		name   string
+		recs   []storage.Record
+		events []event
+	}{
+		{name: "new token", recs: []storage.Record{{Version: 0, CreatedAt: ts(10)}}},
+		{name: "old token", recs: []storage.Record{{Version: 0, CreatedAt: ts(90)}}, events: []event{{version: 0}}},
+		{name: "old latest token", recs: []storage.Record{{Version: 2, CreatedAt: ts(100)}, {Version: 3, CreatedAt: ts(95)}}, events: []event{{version: 3}}},
+		{name: "max tokens", recs: []storage.Record{{Version: 0, CreatedAt: ts(200)}, {Version: 1, CreatedAt: ts(100)}, {Version: 2, CreatedAt: ts(95)}}},
+		{name: "in grace period", recs: []storage.Record{{Version: 0, CreatedAt: ts(100), RotatedAt: ts(10)}, {Version: 1, CreatedAt: ts(10)}}},
+		{name: "grace period passed", recs: []storage.Record{{Version: 0, CreatedAt: ts(104), RotatedAt: ts(14)}, {Version: 1, CreatedAt: ts(14)}}, events: []event{{version: 0, revoke: true}}},
+		{name: "replacement revoked", recs: []storage.Record{{Version: 0, CreatedAt: ts(120), RotatedAt: ts(30)}}},
+		{name: "invalid timestamps", recs: []storage.Record{{Version: 0, RotatedAt: "invalid"}, {Version: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []event
+			for _, evt := range detectRotations(context.Background(), tt.recs, maxAge, grace, 3, now) {
+				events = append(events, event{version: evt.record.Version, revoke: evt.revoke})
+			}
+			assert.Equal(t, tt.events, events)
+		})
+	}
+}
+
+func TestBatchTokenRotation(t *testing.T) {
+	cfg := defaultConfig
+	cfg.TokenRotationDays = 90
+	cfg.TokenRotationGracePeriod = 14 * 24 * time.Hour
+	cfg.MaxTokenCount = 2
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	auditSvc := &mockAuditService{}
+
+	daysAgo := func(days int) string {
+		return time.Now().Add(-time.Duration(days) * 24 * time.Hour).UTC().Format(time.RFC3339Nano)
+	}
+	old := storage.Record{ChannelID: "C111111", ChannelName: "first", Token: "token_a", Version: 0, CreatedAt: daysAgo(100), Scope: "post", Mappings: []string{"text <- $.message"}}
+	rotated := storage.Record{ChannelID: "C222222", ChannelName: "second", Token: "token_b", Version: 0, CreatedAt: daysAgo(110), RotatedAt: daysAgo(15)}
+	replacement := storage.Record{ChannelID: "C222222", ChannelName: "second", Token: "token_c", Version: 1, CreatedAt: daysAgo(15)}
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{old, rotated, replacement}, nil)
+	slackClient.On("GetAllChannels", mock.Anything).Return([]slackgo.Channel{}, nil)
+
+	ddb.On("Save", mock.Anything, mock.MatchedBy(func(rec storage.Record) bool {
+		return rec.ChannelID == "C111111" && rec.Version == 1 && rec.Token != old.Token && rec.Scope == "post" && assert.ObjectsAreEqual(old.Mappings, rec.Mappings)
+	})).Return(nil)
+	ddb.On("UpdateRotatedAt", mock.Anything, old, mock.AnythingOfType("string")).Return(nil)
+	slackClient.On("PostMessage", mock.Anything, "C111111", "first", mock.Anything).Return(slack.PostMessageResult{}, nil)
+	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		return strings.HasPrefix(text, "Token rotated")
+	})).Return(slack.PostMessageResult{}, nil)
+
+	ddb.On("Delete", mock.Anything, rotated).Return(nil)
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.ChannelID == "C222222" && entry.Result == auditResultRotationRevoked
+	})).Return(nil)
+	slackClient.On("PostMessage", mock.Anything, "C222222", "second", mock.Anything).Return(slack.PostMessageResult{}, nil)
+	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		return strings.HasPrefix(text, "Rotated token revoked")
+	})).Return(slack.PostMessageResult{}, nil)
+
+	// The rotated token doesn't count as a token in migration.
+	expectBatchSummary(slackClient, cfg, "Batch process completed: records=3, archived=0, restored=0, purged=0, migrations=0, renames=0, stale_notices=0, stale_revokes=0, rotations=1, rotation_revokes=1, errors=0\n")
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, auditSvc, nil, nil, nil, nil)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+	require.NoError(t, err)
+	slackClient.AssertExpectations(t)
+	ddb.AssertExpectations(t)
+	auditSvc.AssertExpectations(t)
+}
+
+func TestRotationRevokeRestoreHint(t *testing.T) {
+	cfg := defaultConfig
+	cfg.RevokeGracePeriod = 24 * time.Hour
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	auditSvc := &mockAuditService{}
+
+	rec := storage.Record{ChannelID: "C222222", ChannelName: "second", Token: "bd_bb22_0123456789abcdef0123456789abcdef", Version: 0}
+	ddb.On("Revoke", mock.Anything, rec, mock.AnythingOfType("string"), mock.AnythingOfType("int64")).Return(nil)
+	auditSvc.On("Record", mock.Anything, mock.Anything).Return(nil)
+	// The restore hint references the token by its prefix, never by the token.
+	slackClient.On("PostMessage", mock.Anything, "C222222", "second", mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		return strings.Contains(text, "`/belldog-restore bd_bb22`") && !strings.Contains(text, "0123456789abcdef")
+	})).Return(slack.PostMessageResult{}, nil)
+	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, mock.Anything).Return(slack.PostMessageResult{}, nil)
+
+	m := newRecordMaintainer(cfg, slackClient, ddb, nil, auditSvc, nil, nil)
+	err := m.processRotationRevoke(context.Background(), rotationEvent{record: rec, since: time.Now(), revoke: true})
+	require.NoError(t, err)
+	slackClient.AssertExpectations(t)
+	ddb.AssertExpectations(t)
+}
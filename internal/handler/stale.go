@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// The channel is notified this period before the unused token is revoked.
+const staleNoticePeriod = 7 * 24 * time.Hour
+
+const auditResultStaleRevoked = "stale_revoked"
+
+type staleEvent struct {
+	record   storage.Record
+	lastUsed time.Time
+	// Revoke the token if true, otherwise notify the channel that the token will be revoked.
+	revoke bool
+}
+
+// detectStaleToken applies the retention policy to the record. Tokens unused for `retention - staleNoticePeriod`
+// are noticed, then revoked when the notice period passes without use. Tokens never used since usage tracking
+// was introduced count from created_at.
+func detectStaleToken(ctx context.Context, rec storage.Record, retention time.Duration, now time.Time) (staleEvent, bool) {
+	lastUsed, err := time.Parse(time.RFC3339Nano, rec.LastUsedAt)
+	if err != nil {
+		lastUsed, err = time.Parse(time.RFC3339Nano, rec.CreatedAt)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "no valid last_used_at nor created_at, skip stale token check", slog.String("channel_name", rec.ChannelName), slog.Int("version", rec.Version))
+		return staleEvent{}, false
+	}
+	if now.Sub(lastUsed) < retention-staleNoticePeriod {
+		return staleEvent{}, false
+	}
+	// Notices before the last use are void: the token is used again after the notice.
+	notifiedAt, err := time.Parse(time.RFC3339Nano, rec.StaleNotifiedAt)
+	if err != nil || !notifiedAt.After(lastUsed) {
+		return staleEvent{record: rec, lastUsed: lastUsed}, true
+	}
+	if now.Sub(notifiedAt) >= staleNoticePeriod && now.Sub(lastUsed) >= retention {
+		return staleEvent{record: rec, lastUsed: lastUsed, revoke: true}, true
+	}
+	return staleEvent{}, false
+}
+
+func (m *recordMaintainer) processStaleNotice(ctx context.Context, evt staleEvent) error {
+	rec := evt.record
+	slog.InfoContext(ctx, "Token is unused, notifying revocation", slog.String("channel_name", rec.ChannelName), slog.String("channel_id", rec.ChannelID), slog.Time("last_used", evt.lastUsed))
+	msg := fmt.Sprintf("This token has not been used since %s and will be revoked automatically after %s: channel_name=%s, token=%s\nSend a webhook request with the token to keep it.\n",
+		evt.lastUsed.Format(time.DateOnly), time.Now().Add(staleNoticePeriod).Format(time.DateOnly), rec.ChannelName, secret.Token(rec.Token).Prefix())
+	result, err := m.slackClient.PostMessage(ctx, rec.ChannelID, rec.ChannelName, map[string]interface{}{"text": msg})
+	if err != nil {
+		return err
+	}
+	if e := handlePostMessageFailure(result); e != nil {
+		return e
+	}
+	return m.ddb.UpdateStaleNotifiedAt(ctx, rec, time.Now().UTC().Format(time.RFC3339Nano))
+}
+
+func (m *recordMaintainer) processStaleRevoke(ctx context.Context, evt staleEvent) error {
+	rec := evt.record
+	slog.InfoContext(ctx, "Token is unused, revoking", slog.String("channel_name", rec.ChannelName), slog.String("channel_id", rec.ChannelID), slog.Time("last_used", evt.lastUsed))
+	if err := m.revoke(ctx, rec); err != nil {
+		return err
+	}
+	entry := service.AuditEntry{
+		ChannelID:   rec.ChannelID,
+		ChannelName: rec.ChannelName,
+		UserName:    "belldog",
+		Command:     "batch",
+		Result:      auditResultStaleRevoked,
+	}
+	if err := m.auditSvc.Record(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "failed to record audit entry", slog.String("error", fmt.Sprintf("%+v", err)), slog.String("channel_id", rec.ChannelID), slog.String("result", auditResultStaleRevoked))
+	}
+	m.publishLifecycle(ctx, service.LifecycleEvent{
+		Type:         service.LifecycleTokenRevoked,
+		ChannelID:    rec.ChannelID,
+		ChannelName:  rec.ChannelName,
+		TokenPrefix:  secret.Token(rec.Token).Prefix(),
+		TokenVersion: rec.Version,
+		Reason:       service.LifecycleReasonStale,
+	})
+	prefix := secret.Token(rec.Token).Prefix()
+	msg := fmt.Sprintf("Unused token revoked automatically: channel_name=%s, token=%s\nGenerate a new token with `%s` if needed.\n", rec.ChannelName, prefix, cmdGenerate)
+	if m.cfg.RevokeGracePeriod > 0 {
+		msg += fmt.Sprintf("To keep using the token, restore it with `%s %s` within %s.\n", cmdRestore, prefix, m.cfg.RevokeGracePeriod)
+	}
+	msgOps := fmt.Sprintf("Unused token revoked: channel_name=%s, channel_id=%s, last_used=%s\n", rec.ChannelName, rec.ChannelID, evt.lastUsed.Format(time.RFC3339))
+	return m.notify(ctx, opsClassStale, rec.ChannelID, rec.ChannelName, msg, msgOps)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	slackgo "github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+func TestDetectStaleToken(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	retention := 30 * 24 * time.Hour
+	ts := func(daysAgo int) string {
+		return now.Add(-time.Duration(daysAgo) * 24 * time.Hour).Format(time.RFC3339Nano)
+	}
+
+	tests := []struct {
+		name   string
+		rec    storage.Record
+		stale  bool
+		revoke bool
+	}{
+		{name: "recently used", rec: storage.Record{CreatedAt: ts(100), LastUsedAt: ts(1)}},
+		{name: "never used, recently created", rec: storage.Record{CreatedAt: ts(10)}},
+		{name: "never used, old", rec: storage.Record{CreatedAt: ts(23)}, stale: true},
+		{name: "unused", rec: storage.Record{CreatedAt: ts(100), LastUsedAt: ts(25)}, stale: true},
+		{name: "noticed recently", rec: storage.Record{CreatedAt: ts(100), LastUsedAt: ts(28), StaleNotifiedAt: ts(5)}},
+		{name: "noticed a week ago", rec: storage.Record{CreatedAt: ts(100), LastUsedAt: ts(30), StaleNotifiedAt: ts(7)}, stale: true, revoke: true},
+		{name: "used after notice", rec: storage.Record{CreatedAt: ts(100), LastUsedAt: ts(2), StaleNotifiedAt: ts(8)}},
+		{name: "unused again after notice", rec: storage.Record{CreatedAt: ts(100), LastUsedAt: ts(25), StaleNotifiedAt: ts(40)}, stale: true},
+		{name: "invalid timestamps", rec: storage.Record{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evt, stale := detectStaleToken(context.Background(), tt.rec, retention, now)
+			assert.Equal(t, tt.stale, stale)
+			assert.Equal(t, tt.revoke, evt.revoke)
+		})
+	}
+}
+
+func TestBatchStaleTokens(t *testing.T) {
+	cfg := defaultConfig
+	cfg.StaleTokenRetentionDays = 30
+	slackClient := &mockSlackClient{}
+	ddb := &mockStorageDDB{}
+	auditSvc := &mockAuditService{}
+
+	daysAgo := func(days int) string {
+		return time.Now().Add(-time.Duration(days) * 24 * time.Hour).UTC().Format(time.RFC3339Nano)
+	}
+	noticed := storage.Record{ChannelID: "C111111", ChannelName: "first", Token: "bd_aa11_0123456789abcdef0123456789abcdef", CreatedAt: daysAgo(100), LastUsedAt: daysAgo(31), StaleNotifiedAt: daysAgo(8)}
+	unused := storage.Record{ChannelID: "C222222", ChannelName: "second", Token: "bd_bb22_0123456789abcdef0123456789abcdef", CreatedAt: daysAgo(100), LastUsedAt: daysAgo(24)}
+	// Channel messages reference tokens by their prefixes, never by the tokens.
+	prefixOnly := func(prefix string) interface{} {
+		return mock.MatchedBy(func(payload map[string]interface{}) bool {
+			text, _ := payload["text"].(string)
+			return strings.Contains(text, prefix) && !strings.Contains(text, "0123456789abcdef")
+		})
+	}
+	ddb.On("ForEachRecord", mock.Anything).Return([]storage.Record{noticed, unused}, nil)
+	slackClient.On("GetAllChannels", mock.Anything).Return([]slackgo.Channel{}, nil)
+
+	ddb.On("Delete", mock.Anything, noticed).Return(nil)
+	auditSvc.On("Record", mock.Anything, mock.MatchedBy(func(entry service.AuditEntry) bool {
+		return entry.ChannelID == "C111111" && entry.Result == auditResultStaleRevoked
+	})).Return(nil)
+	slackClient.On("PostMessage", mock.Anything, "C111111", "first", prefixOnly("token=bd_aa11")).Return(slack.PostMessageResult{}, nil)
+	slackClient.On("PostMessage", mock.Anything, cfg.OpsNotificationChannelName, cfg.OpsNotificationChannelName, mock.MatchedBy(func(payload map[string]interface{}) bool {
+		text, _ := payload["text"].(string)
+		return strings.HasPrefix(text, "Unused token revoked")
+	})).Return(slack.PostMessageResult{}, nil)
+
+	slackClient.On("PostMessage", mock.Anything, "C222222", "second", prefixOnly("token=bd_bb22")).Return(slack.PostMessageResult{}, nil)
+	ddb.On("UpdateStaleNotifiedAt", mock.Anything, unused, mock.AnythingOfType("string")).Return(nil)
+
+	expectBatchSummary(slackClient, cfg, "Batch process completed: records=2, archived=0, restored=0, purged=0, migrations=0, renames=0, stale_notices=1, stale_revokes=1, rotations=0, rotation_revokes=0, errors=0\n")
+	h := NewBatchHandler(cfg, slackClient, ddb, nil, auditSvc, nil, nil, nil, nil)
+	err := h.HandleCloudWatchEvent(context.Background(), events.CloudWatchEvent{})
+	require.NoError(t, err)
+	slackClient.AssertExpectations(t)
+	ddb.AssertExpectations(t)
+	auditSvc.AssertExpectations(t)
+}
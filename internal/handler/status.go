@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// Fields of WebhookBookmark payloads.
+const (
+	bookmarkTitleKey = "title"
+	bookmarkLinkKey  = "link"
+	bookmarkEmojiKey = "emoji"
+)
+
+// WebhookBookmark adds or edits the link bookmark of the title, so the channel header shows the current status,
+// e.g. the on-call schedule or the latest deploy.
+func (h *ProxyHandler) WebhookBookmark(c echo.Context) error {
+	return h.proxyWebhook(c, func(payload map[string]interface{}) (sendFunc, string) {
+		title, _ := payload[bookmarkTitleKey].(string)
+		link, _ := payload[bookmarkLinkKey].(string)
+		emoji, _ := payload[bookmarkEmojiKey].(string)
+		if strings.TrimSpace(title) == "" {
+			return nil, "`title` field is required.\n"
+		}
+		if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, "`link` field must be an http or https URL.\n"
+		}
+		params := slack.BookmarkParams{Title: title, Link: link, Emoji: emoji}
+		return func(ctx context.Context, channelID string, channelName string, _ map[string]interface{}) (slack.PostMessageResult, error) {
+			return h.slackClient.UpsertBookmark(ctx, channelID, channelName, params)
+		}, ""
+	}, service.ScopeManage, true)
+}
+
+// WebhookCanvas replaces the channel canvas with Markdown of `text`, for status boards updated in place instead of
+// streaming messages.
+func (h *ProxyHandler) WebhookCanvas(c echo.Context) error {
+	return h.proxyWebhook(c, func(payload map[string]interface{}) (sendFunc, string) {
+		text, _ := payload["text"].(string)
+		if strings.TrimSpace(text) == "" {
+			return nil, "`text` field is required.\n"
+		}
+		return func(ctx context.Context, channelID string, channelName string, _ map[string]interface{}) (slack.PostMessageResult, error) {
+			return h.slackClient.UpdateChannelCanvas(ctx, channelID, channelName, text)
+		}, ""
+	}, service.ScopeManage, true)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestWebhookBookmark(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		params   *slack.BookmarkParams
+		status   int
+		expected string
+	}{
+		{
+			name:     "upserted",
+			payload:  `{"title": "On-call", "link": "https://example.com/oncall", "emoji": ":pager:"}`,
+			params:   &slack.BookmarkParams{Title: "On-call", Link: "https://example.com/oncall", Emoji: ":pager:"},
+			status:   http.StatusOK,
+			expected: `{"ok": true, "channel_id": "C123456", "bookmark_id": "Bk123"}`,
+		},
+		{name: "without title", payload: `{"link": "https://example.com/oncall"}`, status: http.StatusBadRequest},
+		{name: "without link", payload: `{"title": "On-call"}`, status: http.StatusBadRequest},
+		{name: "invalid link", payload: `{"title": "On-call", "link": "javascript:alert(1)"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			if tt.params != nil {
+				slackClient.On("UpsertBookmark", mock.Anything, "C123456", "test", *tt.params).Return(slack.PostMessageResult{
+					Type:       slack.PostMessageResultOK,
+					BookmarkID: "Bk123",
+				}, nil)
+			}
+			h := newReactionTestHandler(slackClient, service.ScopeManage)
+			c := setupContext(&tt.payload)
+			err := h.WebhookBookmark(c)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, c.Response().Status)
+			if tt.expected != "" {
+				rec := c.Response().Writer.(*httptest.ResponseRecorder)
+				assert.JSONEq(t, tt.expected, rec.Body.String())
+			}
+			if tt.params == nil {
+				slackClient.AssertNotCalled(t, "UpsertBookmark", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestWebhookCanvas(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	slackClient.On("UpdateChannelCanvas", mock.Anything, "C123456", "test", "# Deploy\n- api: v1.2.3").Return(slack.PostMessageResult{
+		Type:     slack.PostMessageResultOK,
+		CanvasID: "F123",
+	}, nil)
+
+	h := newReactionTestHandler(slackClient, service.ScopeManage)
+	payload := `{"text": "# Deploy\n- api: v1.2.3"}`
+	c := setupContext(&payload)
+	err := h.WebhookCanvas(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "canvas_id": "F123"}`, rec.Body.String())
+}
+
+func TestWebhookCanvasRequiresManageScope(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	h := newReactionTestHandler(slackClient, service.ScopePost)
+	payload := `{"text": "# Deploy"}`
+	c := setupContext(&payload)
+	err := h.WebhookCanvas(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, c.Response().Status)
+	slackClient.AssertNotCalled(t, "UpdateChannelCanvas", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Slack requires escaping these characters in text, otherwise `<` starts links and mentions.
+var plainTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// parseTextPayload parses `{"text": "..."}`, the most common payload, without encoding/json reflection. ok is
+// false for other payloads, even valid ones: parse them with encoding/json.
+func parseTextPayload(body []byte) (map[string]interface{}, bool) {
+	rest, ok := consumeJSON(body, `{`)
+	if !ok {
+		return nil, false
+	}
+	if rest, ok = consumeJSON(rest, `"text"`); !ok {
+		return nil, false
+	}
+	if rest, ok = consumeJSON(rest, `:`); !ok {
+		return nil, false
+	}
+	raw, escaped, rest, ok := cutJSONString(skipJSONSpace(rest))
+	if !ok {
+		return nil, false
+	}
+	if rest, ok = consumeJSON(rest, `}`); !ok || len(skipJSONSpace(rest)) > 0 {
+		return nil, false
+	}
+
+	inner := raw[1 : len(raw)-1]
+	if !escaped && utf8.Valid(inner) {
+		return map[string]interface{}{"text": string(inner)}, true
+	}
+	// Escapes and invalid UTF-8 are rare, leave them to encoding/json.
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return nil, false
+	}
+	return map[string]interface{}{"text": text}, true
+}
+
+// consumeJSON skips whitespace and the token.
+func consumeJSON(b []byte, token string) ([]byte, bool) {
+	b = skipJSONSpace(b)
+	if len(b) < len(token) || string(b[:len(token)]) != token {
+		return nil, false
+	}
+	return b[len(token):], true
+}
+
+func skipJSONSpace(b []byte) []byte {
+	for len(b) > 0 && (b[0] == ' ' || b[0] == '\t' || b[0] == '\n' || b[0] == '\r') {
+		b = b[1:]
+	}
+	return b
+}
+
+// cutJSONString cuts the string literal including the quotes at the beginning of b. escaped tells whether the
+// literal has escape sequences.
+func cutJSONString(b []byte) (raw json.RawMessage, escaped bool, rest []byte, ok bool) {
+	if len(b) == 0 || b[0] != '"' {
+		return nil, false, nil, false
+	}
+	for i := 1; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == '\\':
+			escaped = true
+			i++
+		case c == '"':
+			return b[:i+1], escaped, b[i+1:], true
+		case c < 0x20:
+			// Control characters must be escaped.
+			return nil, false, nil, false
+		}
+	}
+	return nil, false, nil, false
+}
+
+// parsePlainTextPayload wraps the plain text body as `{"text": ...}`. The text is escaped, so it is posted as is
+// without links and mentions. Over-long text is handled by `truncate_mode` like other payloads.
+func parsePlainTextPayload(body []byte) (map[string]interface{}, error) {
+	text := strings.TrimRight(string(body), "\r\n")
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("empty plain text body")
+	}
+	if !utf8.ValidString(text) {
+		return nil, errors.New("plain text body is not valid UTF-8")
+	}
+	return map[string]interface{}{"text": plainTextEscaper.Replace(text)}, nil
+}
+
+// looksLikeJSON tells whether the body is meant to be JSON, so broken JSON bodies are rejected instead of posted
+// as text.
+func looksLikeJSON(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	return len(body) > 0 && (body[0] == '{' || body[0] == '[' || body[0] == '"')
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTextPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{name: "text", body: `{"text": "hello"}`, ok: true},
+		{name: "compact", body: `{"text":"hello"}`, ok: true},
+		{name: "whitespace", body: " \n{\t\"text\" :\r\n \"hello\" }\n", ok: true},
+		{name: "empty text", body: `{"text": ""}`, ok: true},
+		{name: "escapes", body: `{"text": "line1\nline2 \"quoted\" あ \\"}`, ok: true},
+		{name: "escaped quote at the end", body: `{"text": "a\""}`, ok: true},
+		{name: "unicode", body: `{"text": "デプロイ完了 🎉"}`, ok: true},
+		{name: "invalid utf-8", body: "{\"text\": \"a\xffb\"}", ok: true},
+		{name: "other fields", body: `{"text": "hello", "username": "bot"}`},
+		{name: "other field first", body: `{"username": "bot", "text": "hello"}`},
+		{name: "not string", body: `{"text": 1}`},
+		{name: "blocks", body: `{"blocks": []}`},
+		{name: "raw control character", body: "{\"text\": \"a\tb\"}"},
+		{name: "unterminated", body: `{"text": "hello`},
+		{name: "trailing data", body: `{"text": "hello"} {}`},
+		{name: "empty", body: ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseTextPayload([]byte(tt.body))
+			require.Equal(t, tt.ok, ok)
+			if !ok {
+				return
+			}
+			var want map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &want))
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestParsePlainTextPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		text string
+		err  bool
+	}{
+		{name: "text", body: "deploy finished", text: "deploy finished"},
+		{name: "trailing newline", body: "deploy finished\n", text: "deploy finished"},
+		{name: "multiline", body: "line1\nline2\n", text: "line1\nline2"},
+		{name: "escaped", body: "a < b && <!here>", text: "a &lt; b &amp;&amp; &lt;!here&gt;"},
+		{name: "empty", body: "", err: true},
+		{name: "blank", body: " \n", err: true},
+		{name: "invalid utf-8", body: "a\xffb", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePlainTextPayload([]byte(tt.body))
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"text": tt.text}, got)
+		})
+	}
+}
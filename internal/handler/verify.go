@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+type verifyResponse struct {
+	Valid       bool   `json:"valid"`
+	ChannelID   string `json:"channel_id,omitempty"`
+	ChannelName string `json:"channel_name,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+	// Only for valid tokens. Pointer to respond version 0.
+	Version   *int   `json:"version,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	// Only for invalid tokens: "not_found" or "unmatch".
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// WebhookVerify responds whether the token of the webhook URL is valid without posting anything, so integrators
+// can check stored URLs during setup and in CI. Verification counts as token usage like posting does, so
+// regularly verified URLs of rarely posting integrations are not revoked as stale tokens.
+func (h *ProxyHandler) WebhookVerify(c echo.Context) error {
+	ctx := c.Request().Context()
+	res, channel, err := h.verifyPathToken(c)
+	if err != nil {
+		code, ok := service.CodeOf(err)
+		if !ok {
+			return err
+		}
+		telemetry.RecordVerifyFailure(ctx, channel, string(code))
+		status, _, msg := webhookError(code, channel)
+		slog.InfoContext(ctx, "token self-verification failed", slog.String("code", string(code)), slog.String("channel", channel))
+		return c.JSON(status, verifyResponse{Valid: false, Reason: string(code), Message: msg})
+	}
+
+	resp := verifyResponse{
+		Valid:       true,
+		ChannelID:   res.ChannelID,
+		ChannelName: res.ChannelName,
+		Scope:       string(res.Scope),
+		Version:     &res.Version,
+	}
+	if !res.CreatedAt.IsZero() {
+		resp.CreatedAt = res.CreatedAt.Format(time.RFC3339)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
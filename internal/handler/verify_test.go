@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/service"
+)
+
+func TestWebhookVerify(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{
+		ChannelID:   "C123456",
+		ChannelName: "test",
+		Scope:       service.ScopePost,
+		Version:     0,
+		CreatedAt:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, nil)
+	h := ProxyHandler{tokenSvc: svc}
+
+	c := setupContext(nil)
+	err := h.WebhookVerify(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.JSONEq(t, `{"valid": true, "channel_id": "C123456", "channel_name": "test", "scope": "post", "version": 0, "created_at": "2024-01-02T03:04:05Z"}`, rec.Body.String())
+}
+
+func TestWebhookVerifyInvalid(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{}, service.ErrTokenUnmatch)
+	h := ProxyHandler{tokenSvc: svc}
+
+	c := setupContext(nil)
+	err := h.WebhookVerify(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.JSONEq(t, `{"valid": false, "reason": "unmatch", "message": "Invalid token given. Check generated URL.\n"}`, rec.Body.String())
+}
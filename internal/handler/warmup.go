@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/cockroachdb/errors"
+)
+
+// WarmupDetailType is the `detail-type` of warmer events. Schedule an EventBridge rule with the constant input
+// `{"detail-type": "belldog.warmup"}` targeting the proxy function to keep connections to DynamoDB and Slack API
+// open while no webhook requests come, e.g. with provisioned concurrency.
+const WarmupDetailType = "belldog.warmup"
+
+type WarmupHandler struct {
+	slackClient slackClient
+	ddb         storageDDB
+}
+
+func NewWarmupHandler(slackClient slackClient, ddb storageDDB) WarmupHandler {
+	return WarmupHandler{
+		slackClient: slackClient,
+		ddb:         ddb,
+	}
+}
+
+// Wrap returns the Lambda handler responding warmer events, and passing other events to the next handler.
+func (h *WarmupHandler) Wrap(next lambda.Handler) lambda.Handler {
+	return warmupInvoker{h: h, next: next}
+}
+
+// HandleWarmupEvent calls DynamoDB DescribeTable and Slack auth.test, which have no side effects. Failures are
+// logged and responded but not returned, so warmer events don't count as invocation errors.
+func (h *WarmupHandler) HandleWarmupEvent(ctx context.Context) deepHealthResponse {
+	deps := checkDependencies(ctx, h.ddb, h.slackClient)
+	resp := deepHealthResponse{Message: overallHealth(deps), Dependencies: deps}
+	slog.DebugContext(ctx, "warmed up", slog.Any("dependencies", resp.Dependencies))
+	return resp
+}
+
+type warmupInvoker struct {
+	h    *WarmupHandler
+	next lambda.Handler
+}
+
+func (w warmupInvoker) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	if !isWarmupEvent(payload) {
+		return w.next.Invoke(ctx, payload)
+	}
+	b, err := json.Marshal(w.h.HandleWarmupEvent(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal warmup response")
+	}
+	return b, nil
+}
+
+// HTTP events don't have `detail-type`, so other events are never taken as warmer events.
+func isWarmupEvent(payload []byte) bool {
+	var probe struct {
+		DetailType string `json:"detail-type"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return false
+	}
+	return probe.DetailType == WarmupDetailType
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmupEvent(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	slackClient.On("AuthTest", mock.Anything).Return(errors.New("invalid_auth"))
+	ddb := &mockStorageDDB{}
+	ddb.On("Ping", mock.Anything).Return(nil)
+	h := NewWarmupHandler(slackClient, ddb)
+	next := lambda.NewHandler(func(context.Context, json.RawMessage) (string, error) {
+		t.Fatal("warmer events must not be passed to the next handler")
+		return "", nil
+	})
+
+	b, err := h.Wrap(next).Invoke(context.Background(), []byte(`{"source":"aws.events","detail-type":"belldog.warmup","detail":{}}`))
+
+	require.NoError(t, err)
+	var resp deepHealthResponse
+	require.NoError(t, json.Unmarshal(b, &resp))
+	assert.Equal(t, "ng", resp.Message)
+	assert.Equal(t, "ok", resp.Dependencies["dynamodb"].Status)
+	assert.Equal(t, "ng", resp.Dependencies["slack"].Status)
+	slackClient.AssertExpectations(t)
+	ddb.AssertExpectations(t)
+}
+
+func TestWarmupPassesOtherEvents(t *testing.T) {
+	h := NewWarmupHandler(&mockSlackClient{}, &mockStorageDDB{})
+	next := lambda.NewHandler(func(context.Context, json.RawMessage) (string, error) {
+		return "next", nil
+	})
+
+	for _, payload := range []string{
+		`{"version":"2.0","rawPath":"/hc","requestContext":{"http":{"method":"GET"}}}`,
+		`{"source":"aws.events","detail-type":"Scheduled Event","detail":{}}`,
+	} {
+		b, err := h.Wrap(next).Invoke(context.Background(), []byte(payload))
+		require.NoError(t, err, payload)
+		assert.Equal(t, `"next"`, string(b), payload)
+	}
+}
@@ -1,97 +1,706 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/labstack/echo/v4"
 
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/deadline"
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/service"
 	"github.com/Finatext/belldog/internal/slack"
+	"github.com/Finatext/belldog/internal/telemetry"
 )
 
+const (
+	// Payloads having this field are scheduled with chat.scheduleMessage instead of posted immediately.
+	postAtKey = "post_at"
+	// Timestamp of the message to update or delete.
+	tsKey = "ts"
+	// Alternative of X-Idempotency-Key header field for callers unable to set header fields.
+	dedupKey = "dedup_key"
+	// Slack message metadata.
+	metadataKey = "metadata"
+)
+
+// Event type of the message metadata having the request ID.
+const requestMetadataEventType = "belldog_request"
+
+// Webhook requests with `test=true` query parameter are posted to the sandbox channel.
+const testModeQuery = "test"
+
+const idempotencyKeyHeader = "X-Idempotency-Key"
+
+// Query parameters of webhook URLs merged into the payload, for callers unable to change the payload, e.g.
+// third-party tools posting fixed payloads.
+var (
+	stringQueryOptions = []string{"thread_ts", "icon_emoji", "icon_url", "username"}
+	boolQueryOptions   = []string{"reply_broadcast", "unfurl_links", "unfurl_media", "mrkdwn"}
+)
+
+// `unfurl` query parameter sets both of unfurl_links and unfurl_media.
+const unfurlQuery = "unfurl"
+
+type sendFunc func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error)
+
+// webhookAction selects Slack API to call with the given payload. It returns non-empty message when
+// the payload is invalid for the API.
+type webhookAction func(payload map[string]interface{}) (sendFunc, string)
+
+// The MessagePreview of preview requests, see WebhookPreview.
+const ctxKeyPreview = "belldog.preview"
+
 func (h *ProxyHandler) Webhook(c echo.Context) error {
+	return h.proxyWebhook(c, h.messageAction(c, h.slackClient, true), service.ScopePost, apierror.WantsJSON(c))
+}
+
+// WebhookPreview responds with the Slack API request Belldog would send for the webhook request, without posting.
+// The payload goes through the same pipeline: MessageCards, mapping rules, channel defaults, mentions and test
+// mode. Paused channels, digests and idempotency keys are ignored, so integrators can debug formatting any time.
+func (h *ProxyHandler) WebhookPreview(c echo.Context) error {
+	preview := &slack.MessagePreview{}
+	c.Set(ctxKeyPreview, preview)
+	return h.proxyWebhook(c, h.messageAction(c, preview, false), service.ScopePost, true)
+}
+
+// messageSender posts or schedules messages: the Slack client, or slack.MessagePreview for preview requests.
+type messageSender interface {
+	PostMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error)
+	ScheduleMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error)
+}
+
+// messageAction posts the payload with the sender, or schedules it when `post_at` is given. Without digest,
+// payloads are never buffered for digests nor deferred by quiet hours.
+func (h *ProxyHandler) messageAction(c echo.Context, sender messageSender, digest bool) webhookAction {
+	testMode := c.QueryParam(testModeQuery) == "true"
+	return func(payload map[string]interface{}) (sendFunc, string) {
+		if isMessageCard(payload) {
+			translateMessageCard(c.Request().Context(), payload)
+		}
+		if testMode {
+			if h.cfg.SandboxChannelName == "" {
+				return nil, "Test mode is not enabled for this Belldog instance.\n"
+			}
+			// Test messages are not buffered for digests to check the payload immediately.
+			if _, ok := payload[postAtKey]; ok {
+				return h.withMentions(h.withChannelDefaults(h.withSandbox(h.withRequestMetadata(sender.ScheduleMessage)))), ""
+			}
+			return h.withMentions(h.withChannelDefaults(h.withSandbox(h.withRequestMetadata(sender.PostMessage)))), ""
+		}
+		if _, ok := payload[postAtKey]; ok {
+			return h.withMentions(h.withChannelDefaults(h.withRequestMetadata(sender.ScheduleMessage))), ""
+		}
+		if !digest {
+			return h.withMentions(h.withChannelDefaults(h.withRequestMetadata(sender.PostMessage))), ""
+		}
+		schedule := h.withChannelDefaults(h.withRequestMetadata(sender.ScheduleMessage))
+		return h.withMentions(h.withQuietHours(h.withDigest(h.withChannelDefaults(h.withRequestMetadata(sender.PostMessage))), schedule)), ""
+	}
+}
+
+// withSandbox posts to the sandbox channel instead of the channel of the token, so teams can check how their
+// payloads look without spamming production channels. The message is annotated with the intended channel.
+// Wrap the Slack API call directly to apply channel defaults of the intended channel.
+func (h *ProxyHandler) withSandbox(send sendFunc) sendFunc {
+	return func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+		annotateSandboxMessage(payload, channelID, channelName)
+		sandbox := h.cfg.SandboxChannelName
+		slog.InfoContext(ctx, "test mode, post to sandbox channel",
+			slog.String("sandbox_channel_name", sandbox),
+		)
+		return send(ctx, sandbox, sandbox, payload)
+	}
+}
+
+func annotateSandboxMessage(payload map[string]interface{}, channelID string, channelName string) {
+	note := fmt.Sprintf(":test_tube: Test message for <#%s|%s>", channelID, channelName)
+	if text, ok := payload["text"].(string); ok && text != "" {
+		payload["text"] = note + "\n" + text
+	} else {
+		payload["text"] = note
+	}
+	// Text is not shown when blocks are given.
+	if blocks, ok := payload["blocks"].([]interface{}); ok {
+		annotation := map[string]interface{}{
+			"type":     "context",
+			"elements": []interface{}{map[string]interface{}{"type": "mrkdwn", "text": note}},
+		}
+		payload["blocks"] = append([]interface{}{annotation}, blocks...)
+	}
+}
+
+// withRequestMetadata attaches the request ID to the message as Slack message metadata with
+// SLACK_REQUEST_ID_METADATA=true, so the message can be traced back to the request. Metadata given by the
+// caller is kept as is.
+func (h *ProxyHandler) withRequestMetadata(send sendFunc) sendFunc {
+	return func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+		id := logging.RequestID(ctx)
+		if _, ok := payload[metadataKey]; h.cfg.SlackRequestIDMetadata && id != "" && !ok {
+			payload[metadataKey] = map[string]interface{}{
+				"event_type":    requestMetadataEventType,
+				"event_payload": map[string]interface{}{"request_id": id},
+			}
+		}
+		return send(ctx, channelID, channelName, payload)
+	}
+}
+
+// withDigest buffers the payload instead of posting when the channel has digest_window configured. Buffered
+// payloads are posted as a digest message by DigestHandler, which applies the channel defaults then.
+// The response of buffered payloads has no ts.
+func (h *ProxyHandler) withDigest(send sendFunc) sendFunc {
+	return func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+		if !h.digestSvc.Enabled() {
+			return send(ctx, channelID, channelName, payload)
+		}
+		defaults, err := h.channelConfigSvc.GetDefaults(ctx, channelID)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to get channel defaults, post without digest", slog.String("error", err.Error()))
+			return send(ctx, channelID, channelName, payload)
+		}
+		if defaults.DigestWindow == 0 {
+			return send(ctx, channelID, channelName, payload)
+		}
+		if err := h.digestSvc.Buffer(ctx, channelID, channelName, payload); err != nil {
+			return slack.PostMessageResult{}, err
+		}
+		slog.InfoContext(ctx, "message buffered for digest", slog.Duration("digest_window", defaults.DigestWindow))
+		return slack.PostMessageResult{Type: slack.PostMessageResultOK}, nil
+	}
+}
+
+// withQuietHours schedules the payload to the end of quiet_hours of the channel with schedule instead of
+// sending it, when the message is received within the window. Messages of critical severity are sent
+// immediately. Deferred messages are not buffered for digests.
+func (h *ProxyHandler) withQuietHours(send sendFunc, schedule sendFunc) sendFunc {
+	return func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+		value, _ := payload[service.SeverityField].(string)
+		if severity, _ := service.ParseSeverity(value); severity == service.SeverityCritical {
+			return send(ctx, channelID, channelName, payload)
+		}
+		defaults, err := h.channelConfigSvc.GetDefaults(ctx, channelID)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to get channel defaults, post without quiet hours", slog.String("error", err.Error()))
+			return send(ctx, channelID, channelName, payload)
+		}
+		if defaults.QuietHours == nil {
+			return send(ctx, channelID, channelName, payload)
+		}
+		end, quiet := defaults.QuietHours.WindowEnd(time.Now())
+		if !quiet {
+			return send(ctx, channelID, channelName, payload)
+		}
+		slog.InfoContext(ctx, "quiet hours, message scheduled to the end", slog.Time("post_at", end))
+		payload[postAtKey] = end.Unix()
+		return schedule(ctx, channelID, channelName, payload)
+	}
+}
+
+// withChannelDefaults merges the per-channel defaults configured with the config command into the payload.
+// Failing to get the defaults doesn't fail the request: delivering the message is more important.
+func (h *ProxyHandler) withChannelDefaults(send sendFunc) sendFunc {
+	return func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+		defaults, err := h.channelConfigSvc.GetDefaults(ctx, channelID)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to get channel defaults", slog.String("error", err.Error()))
+		} else {
+			defaults.ApplyTo(payload)
+		}
+		// The default colors are applied even without the defaults.
+		defaults.ApplySeverity(payload)
+		return send(ctx, channelID, channelName, payload)
+	}
+}
+
+type webhookResponse struct {
+	Ok        bool   `json:"ok"`
+	ChannelID string `json:"channel_id"`
+	TS        string `json:"ts,omitempty"`
+	// Only for scheduled messages
+	ScheduledMessageID string `json:"scheduled_message_id,omitempty"`
+	// Only for uploaded files
+	FileID string `json:"file_id,omitempty"`
+	// Only for added or edited bookmarks
+	BookmarkID string `json:"bookmark_id,omitempty"`
+	// Only for created or edited channel canvases
+	CanvasID string `json:"canvas_id,omitempty"`
+	// The request is acknowledged but not delivered.
+	Paused bool `json:"paused,omitempty"`
+}
+
+type previewResponse struct {
+	Ok        bool   `json:"ok"`
+	ChannelID string `json:"channel_id"`
+	// Slack API method, e.g. chat.postMessage.
+	Method  string          `json:"method"`
+	Payload json.RawMessage `json:"payload"`
+	// The full text would be uploaded as a snippet, see truncate_mode.
+	Snippet bool `json:"snippet,omitempty"`
+}
+
+// withMentions translates email addresses in the payload to user mentions. Failing to lookup users doesn't
+// fail the request: the addresses are posted as plain text.
+func (h *ProxyHandler) withMentions(send sendFunc) sendFunc {
+	return func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+		if err := h.mentionSvc.ResolveMentions(ctx, payload); err != nil {
+			if errors.Is(err, service.ErrInvalidMentions) {
+				slog.InfoContext(ctx, "invalid mentions given", slog.String("error", err.Error()))
+				return slack.PostMessageResult{
+					Type:        slack.PostMessageResultAPIFailure,
+					Reason:      string(service.CodeInvalidMentions),
+					ChannelID:   channelID,
+					ChannelName: channelName,
+				}, nil
+			}
+			slog.WarnContext(ctx, "failed to resolve mentions", slog.String("error", err.Error()))
+		}
+		return send(ctx, channelID, channelName, payload)
+	}
+}
+
+// WebhookUpdate updates the message posted through Belldog. The response contains `ts` of the message,
+// so callers can keep updating a single status message.
+func (h *ProxyHandler) WebhookUpdate(c echo.Context) error {
+	return h.proxyWebhook(c, requireTS(h.withMentions(h.slackClient.UpdateMessage)), service.ScopeManage, true)
+}
+
+// WebhookDelete deletes the message posted through Belldog.
+func (h *ProxyHandler) WebhookDelete(c echo.Context) error {
+	return h.proxyWebhook(c, requireTS(h.slackClient.DeleteMessage), service.ScopeManage, true)
+}
+
+func requireTS(send sendFunc) webhookAction {
+	return func(payload map[string]interface{}) (sendFunc, string) {
+		if ts, ok := payload[tsKey].(string); !ok || ts == "" {
+			return nil, "`ts` field is required.\n"
+		}
+		return send, ""
+	}
+}
+
+// verifyWebhookToken verifies the token in the path and its scope. When ok is false, the response has been written.
+// Both of `/p/:channel_name/:token` and `/c/:channel_id/:token` paths are supported.
+func (h *ProxyHandler) verifyWebhookToken(c echo.Context, scope service.Scope) (res service.VerifyResult, ok bool, err error) {
 	ctx := c.Request().Context()
-	channelName := c.Param("channel_name")
-	token := c.Param("token")
+	res, channel, err := h.verifyPathToken(c)
+	if err != nil {
+		code, ok := service.CodeOf(err)
+		if !ok {
+			return res, false, err
+		}
+		telemetry.RecordVerifyFailure(ctx, channel, string(code))
+		status, errCode, msg := webhookError(code, channel)
+		slog.InfoContext(ctx, "token verification failed", slog.String("code", string(code)), slog.String("channel", channel), slog.Int("status", status))
+		return res, false, apierror.Respond(c, status, errCode, msg)
+	}
+	if !res.Scope.Allows(scope) {
+		telemetry.RecordVerifyFailure(ctx, channel, "scope_unmatch")
+		slog.InfoContext(ctx, "token scope not allowed", slog.String("channel", channel), slog.String("scope", string(res.Scope)), slog.String("required", string(scope)))
+		msg := fmt.Sprintf("This token is not allowed for this endpoint: scope=%s, required=%s. Generate a token with `%s %s`.\n", res.Scope, scope, cmdGenerate, service.ScopeManage)
+		return res, false, apierror.Respond(c, http.StatusForbidden, apierror.CodeScopeUnmatch, msg)
+	}
+	// Every log line of the request has the channel of the token.
+	c.SetRequest(c.Request().WithContext(logging.WithChannel(ctx, res.ChannelID, res.ChannelName)))
+	return res, true, nil
+}
+
+// verifyPathToken verifies the token in the path. channel is the channel name or the channel ID in the path.
+func (h *ProxyHandler) verifyPathToken(c echo.Context) (res service.VerifyResult, channel string, err error) {
+	ctx, done := deadline.Begin(c.Request().Context(), deadline.StepStorage)
+	defer done()
+	token := secret.Token(c.Param("token"))
 
-	res, err := h.tokenSvc.VerifyToken(ctx, channelName, token)
+	// Channel ID based URLs survive channel renames.
+	channel = c.Param("channel_id")
+	if channel != "" {
+		res, err = h.tokenSvc.VerifyTokenByChannelID(ctx, channel, token)
+		return res, channel, err
+	}
+	channel = c.Param("channel_name")
+	// Pre-signed URLs have the token prefix instead of the token.
+	if signature := c.QueryParam(presignSignatureQuery); signature != "" {
+		res, err = h.tokenSvc.VerifyPresigned(ctx, channel, c.Param("token"), c.QueryParam(presignExpiresQuery), signature)
+		return res, channel, err
+	}
+	res, err = h.tokenSvc.VerifyToken(ctx, channel, token)
+	code, _ := service.CodeOf(err)
+	if h.cfg.DdbTokenIndexName == "" || (code != service.CodeTokenNotFound && code != service.CodeTokenUnmatch) {
+		return res, channel, err
+	}
+	return h.redirectRenamedChannel(c, channel, token, err)
+}
+
+// redirectRenamedChannel verifies the token with the token GSI when the channel name in the path doesn't match
+// the token, e.g. the URL has the channel name before renaming. Such requests are delivered to the channel of
+// the token with the Deprecation header field instead of failing, so integrators can replace URLs without
+// outage. verifyErr is returned when the token is unknown.
+func (h *ProxyHandler) redirectRenamedChannel(c echo.Context, channel string, token secret.Token, verifyErr error) (service.VerifyResult, string, error) {
+	ctx := c.Request().Context()
+	res, err := h.tokenSvc.VerifyTokenByToken(ctx, token)
+	if errors.Is(err, service.ErrTokenNotFound) {
+		return res, channel, verifyErr
+	}
 	if err != nil {
-		return err
+		return res, channel, err
 	}
 
-	if res.NotFound {
-		slog.InfoContext(ctx, "No token generated, response not found", slog.String("channel_name", channelName))
-		msg := fmt.Sprintf("No token generated for %s, generate token with `%s` slash command.\n", channelName, cmdGenerate)
-		return c.String(http.StatusNotFound, msg)
+	telemetry.RecordRenamedChannelRedirect(ctx, channel)
+	slog.InfoContext(ctx, "channel name unmatch, redirect to the channel of the token",
+		slog.String("channel", channel),
+		slog.String("channel_id", res.ChannelID),
+		slog.String("token_channel_name", res.ChannelName),
+	)
+	c.Response().Header().Set("Deprecation", "true")
+	c.Response().Header().Set("Warning", fmt.Sprintf(`299 belldog "The channel name %s doesn't match the token. Replace the URL with a URL generated in the channel."`, channel))
+	return res, channel, nil
+}
+
+func (h *ProxyHandler) proxyWebhook(c echo.Context, action webhookAction, scope service.Scope, jsonResponse bool) (err error) {
+	if jsonResponse {
+		apierror.PreferJSON(c)
 	}
-	if res.Unmatch {
-		slog.InfoContext(ctx, "Invalid token given, response unauthorized", slog.String("channel_name", channelName), slog.String("token", token))
-		return c.String(http.StatusUnauthorized, "Invalid token given. Check generated URL.\n")
+	defer func() { recordWebhookRequest(c, err) }()
+	res, ok, err := h.verifyWebhookToken(c, scope)
+	if !ok {
+		return err
 	}
+	ctx := c.Request().Context()
 
 	body, err := io.ReadAll(c.Request().Body)
 	if err != nil {
 		return errors.Wrap(err, "failed to read request body")
 	}
+	telemetry.RecordPayloadSize(ctx, webhookChannelLabel(c), len(body))
 	payload, err := parseRequestBody(c.Request(), body)
 	if err != nil {
 		slog.InfoContext(ctx, "parseRequestBody failed, response bad request", slog.String("error", err.Error()), slog.String("body", string(body)))
-		return c.String(http.StatusBadRequest, "Invalid body given. JSON Unmarshal failed.\n")
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid body given. JSON Unmarshal failed.\n")
 	}
 
-	result, err := h.slackClient.PostMessage(ctx, res.ChannelID, res.ChannelName, payload)
+	key, ok := popIdempotencyKey(c.Request(), payload)
+	if !ok {
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidIdempotencyKey, fmt.Sprintf("Invalid %s given. It must be a string.\n", dedupKey))
+	}
+	// Only payloads posting messages are validated: updates and deletions have their own fields, e.g. `ts`.
+	if scope == service.ScopePost {
+		if msg := h.validatePayloadSchema(ctx, res.ChannelID, payload); msg != "" {
+			slog.InfoContext(ctx, "payload does not match the schema, response bad request", slog.String("reason", msg))
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeSchemaViolation, msg)
+		}
+	}
+	// Mapped payloads are built by the action like Slack payloads.
+	if len(res.Mappings) > 0 {
+		payload = service.ApplyMappings(res.Mappings, payload)
+	}
+	var dedup dedupOptions
+	if scope == service.ScopePost {
+		var msg string
+		if dedup, msg = parseDedupOptions(c.QueryParams()); msg != "" {
+			slog.InfoContext(ctx, "invalid dedup query parameter given, response bad request", slog.String("reason", msg))
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPayload, msg)
+		}
+		if msg := applyQueryOptions(c.QueryParams(), payload); msg != "" {
+			slog.InfoContext(ctx, "invalid query parameter given, response bad request", slog.String("reason", msg))
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPayload, msg)
+		}
+		switch convert := c.QueryParam(convertQuery); convert {
+		case "":
+		case convertQueryMarkdown:
+			if !isMessageCard(payload) {
+				convertMarkdown(payload)
+			}
+		default:
+			slog.InfoContext(ctx, "invalid convert query parameter given, response bad request", slog.String("convert", convert))
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPayload, fmt.Sprintf("Invalid %s query parameter given. It must be %s.\n", convertQuery, convertQueryMarkdown))
+		}
+	}
+	if msg := validateSeverity(payload); msg != "" {
+		slog.InfoContext(ctx, "invalid severity given, response bad request", slog.Any("severity", payload[service.SeverityField]))
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPayload, msg)
+	}
+	send, invalidMsg := action(payload)
+	if invalidMsg != "" {
+		slog.InfoContext(ctx, "invalid payload given, response bad request", slog.String("reason", invalidMsg))
+		return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPayload, invalidMsg)
+	}
+	preview, previewing := c.Get(ctxKeyPreview).(*slack.MessagePreview)
+	if !previewing && dedup.window > 0 {
+		send = h.withDedup(c, send, res, dedup)
+	}
+	if previewing {
+		key = ""
+	} else if paused, err := h.respondIfPaused(c, res, jsonResponse); paused {
+		return err
+	}
+	if key != "" {
+		replay, found, err := h.idempotencySvc.Begin(ctx, res.ChannelID, key)
+		switch code, _ := service.CodeOf(err); {
+		case code == service.CodeInvalidIdempotencyKey:
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidIdempotencyKey, "Idempotency key too long.\n")
+		case code == service.CodeIdempotencyKeyInProgress:
+			return apierror.Respond(c, http.StatusConflict, apierror.CodeIdempotencyKeyInProgress, "A request with the same idempotency key is in progress.\n")
+		case err != nil:
+			// Senders retry with the same key only when a request failed, so a duplicate post is a rare and visible
+			// nuisance, while refusing the request would drop the alert while the idempotency table is unavailable.
+			slog.WarnContext(ctx, "failed to begin idempotent request, process without deduplication", slog.String("error", err.Error()))
+			key = ""
+		case found:
+			slog.InfoContext(ctx, "duplicate request, respond the previous result", slog.String("idempotency_key", key))
+			c.Response().Header().Set("Idempotent-Replayed", "true")
+			return respondSendResult(c, res, slack.PostMessageResult{
+				Type:               slack.PostMessageResultOK,
+				TS:                 replay.TS,
+				ScheduledMessageID: replay.ScheduledMessageID,
+			}, jsonResponse)
+		}
+	}
+	sendCtx, done := deadline.Begin(ctx, deadline.StepSlack)
+	result, err := send(sendCtx, res.ChannelID, res.ChannelName, payload)
+	done()
+	if key != "" {
+		h.finishIdempotentRequest(ctx, res.ChannelID, key, result, err)
+	}
+	if !previewing {
+		h.emitReceipt(c, res, body, result, err)
+	}
 	if err != nil {
 		slog.ErrorContext(ctx, "PostMessage failed",
 			slog.String("error", err.Error()),
-			slog.String("channel_id", res.ChannelID),
-			slog.String("channel_name", res.ChannelName),
 			slog.Int("body size", len(body)),
 		)
 		slog.DebugContext(ctx, "failed PostMessage body", slog.String("body", string(body)))
 		return err
 	}
+	if previewing && result.Type == slack.PostMessageResultOK {
+		slog.InfoContext(ctx, "preview built", slog.String("method", preview.Method))
+		return c.JSON(http.StatusOK, previewResponse{Ok: true, ChannelID: res.ChannelID, Method: preview.Method, Payload: preview.Body, Snippet: preview.Snippet})
+	}
+	if !previewing {
+		if failures := h.trackDelivery(ctx, res, result); failures > 0 {
+			return respondUndeliverable(c, result, failures)
+		}
+	}
+	return respondSendResult(c, res, result, jsonResponse)
+}
+
+// respondIfPaused acknowledges the request with 202 without delivering when the channel is paused.
+func (h *ProxyHandler) respondIfPaused(c echo.Context, res service.VerifyResult, jsonResponse bool) (bool, error) {
+	ctx := c.Request().Context()
+	if !h.isPaused(ctx, res.ChannelID) {
+		return false, nil
+	}
+
+	slog.InfoContext(ctx, "channel paused, request not delivered",
+		slog.Bool("maintenance_mode", currentSettings(ctx, h.cfg, h.settings).MaintenanceMode),
+	)
+	if jsonResponse {
+		return true, c.JSON(http.StatusAccepted, webhookResponse{Ok: true, ChannelID: res.ChannelID, Paused: true})
+	}
+	return true, c.String(http.StatusAccepted, "Channel paused. The request is not delivered.\n")
+}
+
+// isPaused tells whether the channel is paused with the pause command or the instance is in maintenance mode.
+// Failing to get the pause state doesn't pause the channel.
+func (h *ProxyHandler) isPaused(ctx context.Context, channelID string) bool {
+	if currentSettings(ctx, h.cfg, h.settings).MaintenanceMode {
+		return true
+	}
+	state, err := h.channelConfigSvc.GetPauseState(ctx, channelID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to get pause state", slog.String("error", err.Error()))
+	}
+	return state.Paused
+}
+
+// validatePayloadSchema returns the message listing the violations of the payload_schema of the channel, or empty.
+// Payloads are validated as given, before mapping rules are applied. Schema validation is skipped when the channel
+// config can't be read: the schema guards payload shapes, it's not a reason to drop alerts.
+func (h *ProxyHandler) validatePayloadSchema(ctx context.Context, channelID string, payload map[string]interface{}) string {
+	defaults, err := h.channelConfigSvc.GetDefaults(ctx, channelID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to get channel defaults, skip payload schema validation", slog.String("error", err.Error()))
+		return ""
+	}
+	if defaults.PayloadSchema == nil {
+		return ""
+	}
+	violations := defaults.PayloadSchema.Validate(payload)
+	if len(violations) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Payload does not match the %s of the channel:\n- %s\n", service.ChannelConfigKeyPayloadSchema, strings.Join(violations, "\n- "))
+}
+
+// applyQueryOptions merges the query options into the payload. Query parameters override the payload fields:
+// whoever configures the URL knows the destination better than fixed payloads. It returns non-empty message when
+// the values are invalid.
+func applyQueryOptions(query url.Values, payload map[string]interface{}) string {
+	for _, name := range stringQueryOptions {
+		if v := query.Get(name); v != "" {
+			payload[name] = v
+		}
+	}
+	if v := query.Get(unfurlQuery); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Sprintf("Invalid %s query parameter given. It must be true or false.\n", unfurlQuery)
+		}
+		payload["unfurl_links"] = b
+		payload["unfurl_media"] = b
+	}
+	for _, name := range boolQueryOptions {
+		if v := query.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Sprintf("Invalid %s query parameter given. It must be true or false.\n", name)
+			}
+			payload[name] = b
+		}
+	}
+	return ""
+}
+
+// validateSeverity returns the message for invalid severity fields, or empty.
+func validateSeverity(payload map[string]interface{}) string {
+	value, exists := payload[service.SeverityField]
+	if !exists {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		if _, ok := service.ParseSeverity(s); ok {
+			return ""
+		}
+	}
+	return fmt.Sprintf("Invalid %s given. Available severities: %s, %s, %s, %s\n", service.SeverityField, service.SeverityInfo, service.SeverityWarning, service.SeverityCritical, service.SeverityOK)
+}
+
+// popIdempotencyKey returns the key in the header field or the payload field, and removes the field from the payload.
+// ok is false when the payload field is not a string.
+func popIdempotencyKey(req *http.Request, payload map[string]interface{}) (key string, ok bool) {
+	v, exists := payload[dedupKey]
+	delete(payload, dedupKey)
+	if header := req.Header.Get(idempotencyKeyHeader); header != "" {
+		return header, true
+	}
+	if !exists {
+		return "", true
+	}
+	key, ok = v.(string)
+	return key, ok
+}
+
+// finishIdempotentRequest saves the result for duplicates only when the message has been sent. Failed requests
+// release the key, so retries are processed.
+func (h *ProxyHandler) finishIdempotentRequest(ctx context.Context, channelID string, key string, result slack.PostMessageResult, sendErr error) {
+	if sendErr == nil && result.Type == slack.PostMessageResultOK {
+		idempotentResult := service.IdempotentResult{TS: result.TS, ScheduledMessageID: result.ScheduledMessageID}
+		if err := h.idempotencySvc.Complete(ctx, channelID, key, idempotentResult); err != nil {
+			slog.ErrorContext(ctx, "failed to save idempotent result", slog.String("error", err.Error()))
+		}
+		return
+	}
+	if err := h.idempotencySvc.Abort(ctx, channelID, key); err != nil {
+		slog.ErrorContext(ctx, "failed to abort idempotent request", slog.String("error", err.Error()))
+	}
+}
+
+// recordWebhookRequest records the response status. Returned errors are responded by echo's error handler later.
+func recordWebhookRequest(c echo.Context, err error) {
+	status := c.Response().Status
+	if err != nil {
+		status = http.StatusInternalServerError
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			status = he.Code
+		}
+	}
+	telemetry.RecordWebhookRequest(c.Request().Context(), webhookChannelLabel(c), status)
+}
 
+// Channel name, channel ID or broadcast group name in the path.
+func webhookChannelLabel(c echo.Context) string {
+	if id := c.Param("channel_id"); id != "" {
+		return id
+	}
+	if group := c.Param("group_name"); group != "" {
+		return group
+	}
+	return c.Param("channel_name")
+}
+
+func respondSendResult(c echo.Context, res service.VerifyResult, result slack.PostMessageResult, jsonResponse bool) error {
+	ctx := c.Request().Context()
 	switch result.Type {
 	case slack.PostMessageResultOK:
-		slog.InfoContext(ctx, "PostMessage succeeded",
-			slog.String("channel_id", res.ChannelID),
-			slog.String("channel_name", res.ChannelName),
-		)
+		slog.InfoContext(ctx, "PostMessage succeeded")
+		if jsonResponse {
+			return c.JSON(http.StatusOK, webhookResponse{
+				Ok:                 true,
+				ChannelID:          res.ChannelID,
+				TS:                 result.TS,
+				ScheduledMessageID: result.ScheduledMessageID,
+				FileID:             result.FileID,
+				BookmarkID:         result.BookmarkID,
+				CanvasID:           result.CanvasID,
+			})
+		}
 		return c.String(http.StatusOK, "ok.\n")
 	case slack.PostMessageResultServerTimeoutFailure:
-		slog.WarnContext(ctx, "PostMessage timeout",
-			slog.String("channel_id", res.ChannelID),
-			slog.String("channel_name", res.ChannelName),
-		)
-		return c.String(http.StatusGatewayTimeout, "Slack API timeout.\n")
+		slog.WarnContext(ctx, "PostMessage timeout")
+		return apierror.Respond(c, http.StatusGatewayTimeout, apierror.CodeSlackTimeout, "Slack API timeout.\n")
 	case slack.PostMessageResultServerFailure:
 		msg := fmt.Sprintf("Slack API error: status=%d, body=%s\n", result.StatusCode, result.Body)
 		if result.StatusCode >= 500 && result.StatusCode < 600 {
 			slog.WarnContext(ctx, "PostMessage server error", slog.Int("status_code", result.StatusCode), slog.String("body", result.Body))
-			return c.String(http.StatusBadGateway, msg)
+			return apierror.Respond(c, http.StatusBadGateway, apierror.CodeSlackServerError, msg)
 		} else if result.StatusCode >= 400 && result.StatusCode < 500 {
 			slog.InfoContext(ctx, "PostMessage client error", slog.Int("status_code", result.StatusCode), slog.String("body", result.Body))
-			return c.String(result.StatusCode, msg)
+			return apierror.Respond(c, result.StatusCode, apierror.CodeSlackClientError, msg)
 		} else {
 			return errors.Newf("unexpected status code from Slack API: code=%d, body=%s", result.StatusCode, result.Body)
 		}
+	case slack.PostMessageResultRateLimited:
+		slog.WarnContext(ctx, "PostMessage rate limited",
+			slog.Duration("retry_after", result.RetryAfter),
+		)
+		if result.RetryAfter > 0 {
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+		}
+		return apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeSlackRateLimited, "Slack API rate limited. Retry later.\n")
+	case slack.PostMessageResultCircuitOpen:
+		slog.WarnContext(ctx, "PostMessage short-circuited",
+			slog.Duration("retry_after", result.RetryAfter),
+		)
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+		return apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeSlackUnavailable, "Slack API is failing. Retry later.\n")
 	case slack.PostMessageResultAPIFailure:
 		if result.Reason == "channel_not_found" {
 			msg := fmt.Sprintf("invite bot to the channel: channelName=%s, channelID=%s, reason=%s", result.ChannelName, result.ChannelID, result.Reason)
-			return c.String(http.StatusBadRequest, msg)
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeChannelNotFound, msg)
+		} else if result.Reason == "not_in_channel" {
+			// Slack Connect channels and conversations other than public channels require membership.
+			msg := fmt.Sprintf("invite bot to the channel: channelName=%s, channelID=%s, reason=%s", result.ChannelName, result.ChannelID, result.Reason)
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotInChannel, msg)
 		} else {
 			slog.WarnContext(ctx, "PostMessage Slack API responses error response",
-				slog.String("channel_id", res.ChannelID),
-				slog.String("channel_name", res.ChannelName),
 				slog.String("reason", result.Reason),
 			)
 			msg := fmt.Sprintf("Slack API responses error: reason=%s", result.Reason)
-			return c.String(http.StatusBadRequest, msg)
+			return apierror.Respond(c, http.StatusBadRequest, apierror.CodeSlackAPIError, msg)
 		}
 	default:
 		return errors.Newf("unexpected PostMessageResult type: %v", result.Type)
@@ -104,16 +713,29 @@ func (h *ProxyHandler) Webhook(c echo.Context) error {
 // encoded as form-data, the JSON payload will be at `payload` key.
 //
 // This behavior is not documented now. Some old clients needs this behavior.
+//
+// Bodies of "text/plain" and "application/x-www-form-urlencoded" requests not looking like JSON are posted as
+// text, so shell scripts can `curl -d "deploy finished"` without composing JSON.
 func parseRequestBody(req *http.Request, body []byte) (map[string]interface{}, error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+	plainText := mediaType == echo.MIMETextPlain
 	contentType, ok := req.Header[http.CanonicalHeaderKey("content-type")]
 	if ok && contains(contentType, "application/x-www-form-urlencoded") {
-		b, err := extractPayloadValue(body)
+		b, found, err := extractPayloadValue(body)
 		if err != nil {
 			return nil, err
 		}
 		body = b
+		// `payload` values are always JSON.
+		plainText = !found
 	}
 
+	if payload, ok := parseTextPayload(body); ok {
+		return payload, nil
+	}
+	if plainText && !looksLikeJSON(body) {
+		return parsePlainTextPayload(body)
+	}
 	var payload map[string]interface{}
 	if err := json.Unmarshal(body, &payload); err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal JSON")
@@ -121,10 +743,10 @@ func parseRequestBody(req *http.Request, body []byte) (map[string]interface{}, e
 	return payload, nil
 }
 
-func extractPayloadValue(body []byte) ([]byte, error) {
+func extractPayloadValue(body []byte) (value []byte, found bool, err error) {
 	// Use url.ParseQuery like http package.
 	// https://cs.opensource.google/go/go/+/refs/tags/go1.19.2:src/net/http/request.go;l=1246;drc=61f0409c31cad8729d7982425d353d7b2ea80534
-	vs, err := url.ParseQuery(string(body))
+	vs, parseErr := url.ParseQuery(string(body))
 	// The clients may send raw JSON, but url.ParseQuery doesn't fail if raw JSON was passed in most cases.
 	//
 	// >A setting without an equals sign is interpreted as a key set to an empty value.
@@ -132,21 +754,21 @@ func extractPayloadValue(body []byte) ([]byte, error) {
 	// https://cs.opensource.google/go/go/+/refs/tags/go1.19.2:src/net/url/url.go;l=928
 	//
 	// url.ParseQuery fails when parsing invalid semicolon separators or escapes.
-	if err != nil {
+	if parseErr != nil {
 		// Fallback to parse as raw JSON.
 		//nolint:nilerr
-		return body, nil
+		return body, false, nil
 	}
 	v, ok := vs["payload"]
 	if !ok {
 		// The client may send raw JSON request body with form-data content-type header field, so continue
 		// to parse as JSON.
-		return body, nil
+		return body, false, nil
 	}
 	if len(v) != 1 {
-		return nil, errors.Newf("the HTTP query `payload` value must be a single value: len=%d", len(v))
+		return nil, false, errors.Newf("the HTTP query `payload` value must be a single value: len=%d", len(v))
 	}
-	return []byte(v[0]), nil
+	return []byte(v[0]), true, nil
 }
 
 func contains(slice []string, item string) bool {
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,13 +9,18 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/Finatext/belldog/internal/apierror"
 	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/runtimeconfig"
 	"github.com/Finatext/belldog/internal/service"
 	"github.com/Finatext/belldog/internal/slack"
 )
@@ -52,35 +58,171 @@ func setupContext(payload *string) echo.Context {
 func TestWebhookOk(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	svc := &mockTokenService{}
-	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{}, nil)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
 	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
 		Type: slack.PostMessageResultOK,
 	}, nil)
 
 	h := ProxyHandler{
-		cfg:         appconfig.Config{},
-		slackClient: slackClient,
-		tokenSvc:    svc,
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+}
+
+func TestWebhookNotInChannel(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
+		Type:   slack.PostMessageResultAPIFailure,
+		Reason: "not_in_channel",
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Contains(t, c.Response().Writer.(*httptest.ResponseRecorder).Body.String(), "invite bot to the channel")
+	assert.Contains(t, c.Response().Writer.(*httptest.ResponseRecorder).Body.String(), string(apierror.CodeNotInChannel))
+}
+
+func TestWebhookRequestIDMetadata(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+	expected := map[string]interface{}{
+		"text": "hello",
+		"metadata": map[string]interface{}{
+			"event_type":    "belldog_request",
+			"event_payload": map[string]interface{}{"request_id": "req-123"},
+		},
+	}
+	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), expected).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{SlackRequestIDMetadata: true},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
 	}
 	c := setupContext(nil)
+	c.SetRequest(c.Request().WithContext(logging.WithRequestID(c.Request().Context(), "req-123")))
 	err := h.Webhook(c)
 
 	require.NoError(t, err)
 	assert.Equal(t, http.StatusOK, c.Response().Status)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookMappings(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	rules, err := service.ParseMappingRules("text <- $.alert.description")
+	require.NoError(t, err)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost, Mappings: rules}, nil)
+	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), map[string]interface{}{"text": "CPU usage is high"}).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"alert": {"description": "CPU usage is high"}}`
+	c := setupContext(&payload)
+	err = h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookSeverity(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+	expected := map[string]interface{}{
+		"attachments": []interface{}{map[string]interface{}{"color": "warning", "text": "hello", "fallback": "hello"}},
+	}
+	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), expected).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"text": "hello", "severity": "warning"}`
+	c := setupContext(&payload)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookInvalidSeverity(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+	}
+	payload := `{"text": "hello", "severity": "fatal"}`
+	c := setupContext(&payload)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
 }
 
 func TestWebhookFormData(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	svc := &mockTokenService{}
-	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{}, nil)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
 	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
 		Type: slack.PostMessageResultOK,
 	}, nil)
 
 	h := ProxyHandler{
-		cfg:         appconfig.Config{},
-		slackClient: slackClient,
-		tokenSvc:    svc,
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
 	}
 	f := make(url.Values)
 	f.Set("payload", defaultPayloadJSON())
@@ -96,15 +238,18 @@ func TestWebhookFormData(t *testing.T) {
 func TestWebhookJSONWithFormContentType(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	svc := &mockTokenService{}
-	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{}, nil)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
 	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
 		Type: slack.PostMessageResultOK,
 	}, nil)
 
 	h := ProxyHandler{
-		cfg:         appconfig.Config{},
-		slackClient: slackClient,
-		tokenSvc:    svc,
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
 	}
 	c := setupContext(nil)
 	c.Request().Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
@@ -114,18 +259,64 @@ func TestWebhookJSONWithFormContentType(t *testing.T) {
 	assert.Equal(t, http.StatusOK, c.Response().Status)
 }
 
+func TestWebhookPlainText(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{name: "text/plain", contentType: "text/plain; charset=utf-8", body: "deploy <finished>\n", status: http.StatusOK},
+		// `curl -d` sends form content type.
+		{name: "form", contentType: echo.MIMEApplicationForm, body: "deploy <finished>", status: http.StatusOK},
+		{name: "JSON in text/plain", contentType: echo.MIMETextPlain, body: `{"text": "deploy &lt;finished&gt;"}`, status: http.StatusOK},
+		{name: "broken JSON", contentType: echo.MIMETextPlain, body: `{"text": "deploy`, status: http.StatusBadRequest},
+		{name: "without content type", body: "deploy finished", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			svc := &mockTokenService{}
+			svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+			slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), map[string]interface{}{"text": "deploy &lt;finished&gt;"}).Return(slack.PostMessageResult{
+				Type: slack.PostMessageResultOK,
+			}, nil)
+
+			h := ProxyHandler{
+				cfg:              appconfig.Config{},
+				slackClient:      slackClient,
+				tokenSvc:         svc,
+				channelConfigSvc: disabledChannelConfigService(),
+				mentionSvc:       disabledMentionService(),
+				digestSvc:        disabledDigestService(),
+			}
+			c := setupContext(&tt.body)
+			if tt.contentType != "" {
+				c.Request().Header.Set(echo.HeaderContentType, tt.contentType)
+			}
+			err := h.Webhook(c)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, c.Response().Status)
+		})
+	}
+}
+
 func TestWebhookSlackTimeout(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	svc := &mockTokenService{}
-	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{}, nil)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
 	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
 		Type: slack.PostMessageResultServerTimeoutFailure,
 	}, nil)
 
 	h := ProxyHandler{
-		cfg:         appconfig.Config{},
-		slackClient: slackClient,
-		tokenSvc:    svc,
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
 	}
 	c := setupContext(nil)
 	err := h.Webhook(c)
@@ -137,16 +328,19 @@ func TestWebhookSlackTimeout(t *testing.T) {
 func TestWebhookSlackServerFailure(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	svc := &mockTokenService{}
-	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{}, nil)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
 	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
 		Type:       slack.PostMessageResultServerFailure,
 		StatusCode: 500,
 	}, nil)
 
 	h := ProxyHandler{
-		cfg:         appconfig.Config{},
-		slackClient: slackClient,
-		tokenSvc:    svc,
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
 	}
 	c := setupContext(nil)
 	err := h.Webhook(c)
@@ -155,19 +349,72 @@ func TestWebhookSlackServerFailure(t *testing.T) {
 	assert.Equal(t, http.StatusBadGateway, c.Response().Status)
 }
 
+func TestWebhookSlackRateLimited(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
+		Type:       slack.PostMessageResultRateLimited,
+		RetryAfter: 30 * time.Second,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, c.Response().Status)
+	assert.Equal(t, "30", c.Response().Header().Get("Retry-After"))
+}
+
+func TestWebhookSlackCircuitOpen(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
+		Type:       slack.PostMessageResultCircuitOpen,
+		RetryAfter: 12500 * time.Millisecond,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, c.Response().Status)
+	assert.Equal(t, "13", c.Response().Header().Get("Retry-After"))
+}
+
 func TestWebhookSlackBadRequest(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	svc := &mockTokenService{}
-	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{}, nil)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
 	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
 		Type:       slack.PostMessageResultServerFailure,
 		StatusCode: 400,
 	}, nil)
 
 	h := ProxyHandler{
-		cfg:         appconfig.Config{},
-		slackClient: slackClient,
-		tokenSvc:    svc,
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
 	}
 	c := setupContext(nil)
 	err := h.Webhook(c)
@@ -179,16 +426,19 @@ func TestWebhookSlackBadRequest(t *testing.T) {
 func TestWebhookSlackUnexpectedResponse(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	svc := &mockTokenService{}
-	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{}, nil)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
 	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
 		Type:       slack.PostMessageResultServerFailure,
 		StatusCode: 301,
 	}, nil)
 
 	h := ProxyHandler{
-		cfg:         appconfig.Config{},
-		slackClient: slackClient,
-		tokenSvc:    svc,
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
 	}
 	c := setupContext(nil)
 	err := h.Webhook(c)
@@ -200,7 +450,7 @@ func TestWebhookSlackUnexpectedResponse(t *testing.T) {
 func TestWebhookSlackAPIFailure(t *testing.T) {
 	slackClient := &mockSlackClient{}
 	svc := &mockTokenService{}
-	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{}, nil)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
 	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
 		Type:        slack.PostMessageResultAPIFailure,
 		Reason:      "invalid_blocks",
@@ -209,13 +459,913 @@ func TestWebhookSlackAPIFailure(t *testing.T) {
 	}, nil)
 
 	h := ProxyHandler{
-		cfg:         appconfig.Config{},
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+}
+
+func TestWebhookScheduleMessage(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+	scheduledPayload := map[string]interface{}{
+		"text":    "hello",
+		"post_at": float64(1893456000),
+	}
+	slackClient.On("ScheduleMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), scheduledPayload).Return(slack.PostMessageResult{
+		Type:               slack.PostMessageResultOK,
+		ScheduledMessageID: "Q1298393284",
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"text": "hello", "post_at": 1893456000}`
+	c := setupContext(&payload)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	slackClient.AssertExpectations(t)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookUpdate(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	updatePayload := map[string]interface{}{
+		"text": "deploying: 50%",
+		"ts":   "1405894322.002768",
+	}
+	slackClient.On("UpdateMessage", mock.Anything, "C123456", "test", updatePayload).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+		TS:   "1405894322.002768",
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"text": "deploying: 50%", "ts": "1405894322.002768"}`
+	c := setupContext(&payload)
+	err := h.WebhookUpdate(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "ts": "1405894322.002768"}`, rec.Body.String())
+}
+
+func TestWebhookDeleteWithoutTS(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopeManage}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	err := h.WebhookDelete(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	// Errors of JSON only endpoints are always JSON.
+	var resp apierror.Response
+	require.NoError(t, json.Unmarshal(c.Response().Writer.(*httptest.ResponseRecorder).Body.Bytes(), &resp))
+	assert.Equal(t, apierror.CodeInvalidPayload, resp.Code)
+	slackClient.AssertNotCalled(t, "DeleteMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookJSONResponse(t *testing.T) {
+	cases := []struct {
+		name   string
+		accept string
+		query  string
+	}{
+		{name: "accept header", accept: echo.MIMEApplicationJSON},
+		{name: "query parameter", query: "?response=json"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			svc := &mockTokenService{}
+			svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+			slackClient.On("PostMessage", mock.Anything, "C123456", "test", defaultPayload).Return(slack.PostMessageResult{
+				Type: slack.PostMessageResultOK,
+				TS:   "1405894322.002768",
+			}, nil)
+
+			h := ProxyHandler{
+				cfg:              appconfig.Config{},
+				slackClient:      slackClient,
+				tokenSvc:         svc,
+				channelConfigSvc: disabledChannelConfigService(),
+				mentionSvc:       disabledMentionService(),
+				digestSvc:        disabledDigestService(),
+			}
+			c := setupContext(nil)
+			c.Request().URL.RawQuery = strings.TrimPrefix(tc.query, "?")
+			if tc.accept != "" {
+				c.Request().Header.Set(echo.HeaderAccept, tc.accept)
+			}
+			err := h.Webhook(c)
+
+			require.NoError(t, err)
+			rec := c.Response().Writer.(*httptest.ResponseRecorder)
+			assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "ts": "1405894322.002768"}`, rec.Body.String())
+		})
+	}
+}
+
+func TestWebhookPlainResponseByDefault(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{Scope: service.ScopePost}, nil)
+	slackClient.On("PostMessage", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), defaultPayload).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	c.Request().Header.Set(echo.HeaderAccept, "*/*")
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, "ok.\n", rec.Body.String())
+}
+
+func TestWebhookAppliesChannelDefaults(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	configSvc := &mockChannelConfigService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	configSvc.On("GetDefaults", mock.Anything, "C123456").Return(service.ChannelDefaults{IconEmoji: ":robot_face:", Username: "CI"}, nil)
+	configSvc.On("GetPauseState", mock.Anything, "C123456").Return(service.PauseState{}, nil)
+	expected := map[string]interface{}{"text": "hello", "username": "deploy bot", "icon_emoji": ":robot_face:"}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", expected).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: configSvc,
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"text": "hello", "username": "deploy bot"}`
+	c := setupContext(&payload)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookPayloadSchemaViolation(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	configSvc := &mockChannelConfigService{}
+	schema, err := service.ParsePayloadSchema(`{"required": ["text"], "properties": {"severity": {"enum": ["info", "critical"]}}}`)
+	require.NoError(t, err)
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	configSvc.On("GetDefaults", mock.Anything, "C123456").Return(service.ChannelDefaults{PayloadSchema: schema}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: configSvc,
+	}
+	payload := `{"blocks": [], "severity": "warning"}`
+	c := setupContext(&payload)
+	c.Request().Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	err = h.Webhook(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var resp apierror.Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, apierror.CodeSchemaViolation, resp.Code)
+	assert.Equal(t, "Payload does not match the payload_schema of the channel:\n- $.text: required\n- $.severity: must be one of \"info\", \"critical\"", resp.Message)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookInvalidMentions(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	mentionSvc := &mockMentionService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	mentionSvc.On("ResolveMentions", mock.Anything, mock.Anything).Return(errors.Wrap(service.ErrInvalidMentions, "not an array"))
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       mentionSvc,
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"text": "hello", "mentions": "alice@example.com"}`
+	c := setupContext(&payload)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_mentions")
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookMentionLookupFailureStillPosts(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	mentionSvc := &mockMentionService{}
+	svc.On("VerifyToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	mentionSvc.On("ResolveMentions", mock.Anything, mock.Anything).Return(errors.New("ratelimited"))
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       mentionSvc,
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"text": "cc @alice@example.com"}`
+	c := setupContext(&payload)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookByChannelID(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyTokenByChannelID", mock.Anything, "C123456", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "old-name", Scope: service.ScopeManage}, nil)
+	slackClient.On("PostMessage", mock.Anything, "C123456", "old-name", defaultPayload).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	c.SetPath("/c/:channel_id/:token")
+	c.SetParamNames("channel_id", "token")
+	c.SetParamValues("C123456", "deadbeef")
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	svc.AssertNotCalled(t, "VerifyToken", mock.Anything, mock.Anything, mock.Anything)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookVerifyFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "not found", err: service.ErrTokenNotFound, wantStatus: http.StatusNotFound},
+		{name: "unmatch", err: service.ErrTokenUnmatch, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			svc := &mockTokenService{}
+			svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{}, tt.err)
+
+			h := ProxyHandler{
+				cfg:         appconfig.Config{},
+				slackClient: slackClient,
+				tokenSvc:    svc,
+			}
+			c := setupContext(nil)
+			err := h.Webhook(c)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, c.Response().Status)
+			slackClient.AssertNotCalled(t, "PostMessage")
+		})
+	}
+}
+
+func TestWebhookVerifyFailureJSON(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{}, service.ErrTokenUnmatch)
+	h := ProxyHandler{cfg: appconfig.Config{}, tokenSvc: svc}
+
+	c := setupContext(nil)
+	c.Request().Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.JSONEq(t, `{"ok": false, "code": "unmatch", "message": "Invalid token given. Check generated URL.", "request_id": "req-1", "docs_url": "https://github.com/Finatext/belldog#error-responses"}`, rec.Body.String())
+}
+
+func TestWebhookVerifyFailurePlainByDefault(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{}, service.ErrTokenUnmatch)
+	h := ProxyHandler{cfg: appconfig.Config{}, tokenSvc: svc}
+
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, "Invalid token given. Check generated URL.\n", rec.Body.String())
+}
+
+func TestWebhookRenamedChannelRedirect(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{}, service.ErrTokenNotFound)
+	svc.On("VerifyTokenByToken", mock.Anything, "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "old-name", Scope: service.ScopePost}, nil)
+	slackClient.On("PostMessage", mock.Anything, "C123456", "old-name", defaultPayload).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{DdbTokenIndexName: "token-index"},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	assert.Equal(t, "true", c.Response().Header().Get("Deprecation"))
+	assert.Contains(t, c.Response().Header().Get("Warning"), "test")
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookRenamedChannelRedirectUnknownToken(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{}, service.ErrTokenUnmatch)
+	svc.On("VerifyTokenByToken", mock.Anything, "deadbeef").Return(service.VerifyResult{}, service.ErrTokenNotFound)
+
+	h := ProxyHandler{
+		cfg:         appconfig.Config{DdbTokenIndexName: "token-index"},
 		slackClient: slackClient,
 		tokenSvc:    svc,
 	}
 	c := setupContext(nil)
 	err := h.Webhook(c)
 
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, c.Response().Status)
+	assert.Empty(t, c.Response().Header().Get("Deprecation"))
+	slackClient.AssertNotCalled(t, "PostMessage")
+}
+
+func TestWebhookVerifyUnexpectedError(t *testing.T) {
+	svc := &mockTokenService{}
+	storageErr := errors.New("storage failure")
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{}, storageErr)
+
+	h := ProxyHandler{
+		cfg:      appconfig.Config{},
+		tokenSvc: svc,
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.ErrorIs(t, err, storageErr)
+}
+
+func TestWebhookIdempotencyKey(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", defaultPayload).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+		TS:   "1405894322.002768",
+	}, nil)
+	idempotencySvc := &mockIdempotencyService{}
+	idempotencySvc.On("Begin", mock.Anything, "C123456", "job-42").Return(service.IdempotentResult{}, false, nil)
+	idempotencySvc.On("Complete", mock.Anything, "C123456", "job-42", service.IdempotentResult{TS: "1405894322.002768"}).Return(nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+		idempotencySvc:   idempotencySvc,
+	}
+	// dedup_key field must not be sent to Slack.
+	payload := `{"text": "hello", "dedup_key": "job-42"}`
+	c := setupContext(&payload)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	idempotencySvc.AssertExpectations(t)
+}
+
+func TestWebhookIdempotencyKeyDuplicate(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	idempotencySvc := &mockIdempotencyService{}
+	idempotencySvc.On("Begin", mock.Anything, "C123456", "job-42").Return(service.IdempotentResult{TS: "1405894322.002768"}, true, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+		idempotencySvc:   idempotencySvc,
+	}
+	c := setupContext(nil)
+	c.Request().Header.Set("X-Idempotency-Key", "job-42")
+	c.Request().Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "ts": "1405894322.002768"}`, rec.Body.String())
+}
+
+func TestWebhookIdempotencyKeyInProgress(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	idempotencySvc := &mockIdempotencyService{}
+	idempotencySvc.On("Begin", mock.Anything, "C123456", "job-42").Return(service.IdempotentResult{}, false, errors.Wrap(service.ErrIdempotencyKeyInProgress, "key=job-42"))
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      &mockSlackClient{},
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+		idempotencySvc:   idempotencySvc,
+	}
+	c := setupContext(nil)
+	c.Request().Header.Set("X-Idempotency-Key", "job-42")
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, c.Response().Status)
+}
+
+func TestWebhookIdempotencyKeyAbortOnFailure(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", defaultPayload).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultServerTimeoutFailure,
+	}, nil)
+	idempotencySvc := &mockIdempotencyService{}
+	idempotencySvc.On("Begin", mock.Anything, "C123456", "job-42").Return(service.IdempotentResult{}, false, nil)
+	idempotencySvc.On("Abort", mock.Anything, "C123456", "job-42").Return(nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+		idempotencySvc:   idempotencySvc,
+	}
+	c := setupContext(nil)
+	c.Request().Header.Set("X-Idempotency-Key", "job-42")
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGatewayTimeout, c.Response().Status)
+	idempotencySvc.AssertExpectations(t)
+}
+
+func TestWebhookPaused(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("GetDefaults", mock.Anything, "C123456").Return(service.ChannelDefaults{}, nil)
+	configSvc.On("GetPauseState", mock.Anything, "C123456").Return(service.PauseState{Paused: true, UserID: "U123456"}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: configSvc,
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	c.Request().Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "paused": true}`, rec.Body.String())
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookPreview(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("GetDefaults", mock.Anything, "C123456").Return(service.ChannelDefaults{Username: "CI"}, nil)
+	digestSvc := &mockDigestService{}
+	digestSvc.On("Enabled").Return(true)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: configSvc,
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        digestSvc,
+	}
+	payload := `{"text": "hello", "dedup_key": "deploy-1"}`
+	c := setupContext(&payload)
+	err := h.WebhookPreview(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "method": "chat.postMessage", "payload": {"channel": "C123456", "text": "hello", "username": "CI"}}`, rec.Body.String())
+	// Neither paused state, digests nor idempotency keys are checked.
+	configSvc.AssertNotCalled(t, "GetPauseState", mock.Anything, mock.Anything)
+	digestSvc.AssertNotCalled(t, "Buffer", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookPreviewScheduleMessage(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"text": "hello", "post_at": 1700000000}`
+	c := setupContext(&payload)
+	err := h.WebhookPreview(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"ok": true, "channel_id": "C123456", "method": "chat.scheduleMessage", "payload": {"channel": "C123456", "post_at": 1700000000, "text": "hello"}}`, rec.Body.String())
+	slackClient.AssertNotCalled(t, "ScheduleMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookPreviewInvalidTruncateMode(t *testing.T) {
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      &mockSlackClient{},
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"text": "hello", "truncate_mode": "unknown"}`
+	c := setupContext(&payload)
+	err := h.WebhookPreview(c)
+
+	require.NoError(t, err)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_truncate_mode")
+}
+
+func TestWebhookMaintenanceMode(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{MaintenanceMode: true},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+type staticSettings runtimeconfig.Settings
+
+func (s staticSettings) Settings(ctx context.Context) runtimeconfig.Settings {
+	return runtimeconfig.Settings(s)
+}
+
+func TestWebhookRuntimeMaintenanceMode(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{MaintenanceMode: false},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+		settings:         staticSettings{MaintenanceMode: true},
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookTestMode(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	expected := map[string]interface{}{"text": ":test_tube: Test message for <#C123456|test>\nhello"}
+	slackClient.On("PostMessage", mock.Anything, "sandbox", "sandbox", expected).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{SandboxChannelName: "sandbox"},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	c.Request().URL.RawQuery = "test=true"
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookTestModeDisabled(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	c.Request().URL.RawQuery = "test=true"
+	err := h.Webhook(c)
+
 	require.NoError(t, err)
 	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookQueryOptions(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	expected := map[string]interface{}{
+		"text":         "hello",
+		"thread_ts":    "1700000000.000100",
+		"icon_emoji":   ":rocket:",
+		"username":     "deploy",
+		"unfurl_links": false,
+		"unfurl_media": true,
+	}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", expected).Return(slack.PostMessageResult{
+		Type: slack.PostMessageResultOK,
+	}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"text": "hello", "username": "fixed"}`
+	c := setupContext(&payload)
+	// unfurl_media overrides unfurl.
+	c.Request().URL.RawQuery = "thread_ts=1700000000.000100&unfurl=false&unfurl_media=true&icon_emoji=:rocket:&username=deploy&unknown=1"
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookInvalidQueryOption(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: disabledChannelConfigService(),
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	c := setupContext(nil)
+	c.Request().URL.RawQuery = "unfurl=no"
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, "Invalid unfurl query parameter given. It must be true or false.\n", c.Response().Writer.(*httptest.ResponseRecorder).Body.String())
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAnnotateSandboxMessageWithBlocks(t *testing.T) {
+	payload := map[string]interface{}{
+		"blocks": []interface{}{map[string]interface{}{"type": "divider"}},
+	}
+	annotateSandboxMessage(payload, "C123456", "test")
+
+	assert.Equal(t, ":test_tube: Test message for <#C123456|test>", payload["text"])
+	blocks := payload["blocks"].([]interface{})
+	require.Len(t, blocks, 2)
+	assert.Equal(t, "context", blocks[0].(map[string]interface{})["type"])
+}
+
+func TestWebhookDigest(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopeManage}, nil)
+	configSvc := &mockChannelConfigService{}
+	configSvc.On("GetPauseState", mock.Anything, "C123456").Return(service.PauseState{}, nil)
+	configSvc.On("GetDefaults", mock.Anything, "C123456").Return(service.ChannelDefaults{DigestWindow: time.Minute}, nil)
+	digestSvc := &mockDigestService{}
+	digestSvc.On("Enabled").Return(true)
+	digestSvc.On("Buffer", mock.Anything, "C123456", "test", defaultPayload).Return(nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: configSvc,
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        digestSvc,
+	}
+	c := setupContext(nil)
+	err := h.Webhook(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	digestSvc.AssertExpectations(t)
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookUpdateRequiresManageScope(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+
+	h := ProxyHandler{
+		cfg:         appconfig.Config{},
+		slackClient: slackClient,
+		tokenSvc:    svc,
+	}
+	payload := `{"ts":"1700000000.000100","text":"updated"}`
+	c := setupContext(&payload)
+	err := h.WebhookUpdate(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, c.Response().Status)
+	slackClient.AssertNotCalled(t, "UpdateMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookQuietHours(t *testing.T) {
+	// The window always contains now.
+	now := time.Now().UTC()
+	minutes := now.Hour()*60 + now.Minute()
+	quietHours := &service.QuietHours{Start: (minutes + 23*60) % (24 * 60), End: (minutes + 60) % (24 * 60), Location: time.UTC}
+	end, _ := quietHours.WindowEnd(now)
+
+	tests := []struct {
+		name      string
+		payload   string
+		scheduled bool
+	}{
+		{name: "deferred", payload: `{"text": "nightly batch finished"}`, scheduled: true},
+		{name: "warning deferred", payload: `{"text": "disk usage 80%", "severity": "warning"}`, scheduled: true},
+		{name: "critical bypasses", payload: `{"text": "database down", "severity": "critical"}`, scheduled: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackClient := &mockSlackClient{}
+			slackClient.On("ScheduleMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK, ScheduledMessageID: "Q123"}, nil)
+			slackClient.On("PostMessage", mock.Anything, "C123456", "test", mock.Anything).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK, TS: "1405894322.002768"}, nil)
+			svc := &mockTokenService{}
+			svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+			configSvc := &mockChannelConfigService{}
+			configSvc.On("GetPauseState", mock.Anything, "C123456").Return(service.PauseState{}, nil)
+			configSvc.On("GetDefaults", mock.Anything, "C123456").Return(service.ChannelDefaults{QuietHours: quietHours}, nil)
+
+			h := ProxyHandler{
+				cfg:              appconfig.Config{},
+				slackClient:      slackClient,
+				tokenSvc:         svc,
+				channelConfigSvc: configSvc,
+				mentionSvc:       disabledMentionService(),
+				digestSvc:        disabledDigestService(),
+			}
+			c := setupContext(&tt.payload)
+			err := h.Webhook(c)
+
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, c.Response().Status)
+			if tt.scheduled {
+				slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				payload := slackClient.Calls[0].Arguments.Get(3).(map[string]interface{})
+				assert.Equal(t, end.Unix(), payload["post_at"])
+			} else {
+				slackClient.AssertNotCalled(t, "ScheduleMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
 }
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+// Placeholders of workflow templates: `{{variable}}`, same as variables in Workflow Builder.
+var workflowPlaceholderPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// WebhookWorkflow accepts the flat key/value JSON sent by "Send a webhook" steps of Slack Workflow Builder. The
+// variables are rendered into a message with `workflow_template` of the channel config, so workflows can notify
+// through Belldog tokens without building Slack payloads.
+func (h *ProxyHandler) WebhookWorkflow(c echo.Context) error {
+	return h.proxyWebhook(c, func(payload map[string]interface{}) (sendFunc, string) {
+		for key, value := range payload {
+			switch value.(type) {
+			case string, float64, bool, nil:
+			default:
+				return nil, fmt.Sprintf("Workflow variables must be strings, numbers or booleans: %s\n", key)
+			}
+		}
+		schedule := h.withChannelDefaults(h.slackClient.ScheduleMessage)
+		return h.withWorkflowTemplate(h.withMentions(h.withQuietHours(h.withDigest(h.withChannelDefaults(h.slackClient.PostMessage)), schedule))), ""
+	}, service.ScopePost, apierror.WantsJSON(c))
+}
+
+// withWorkflowTemplate replaces the variables with the message rendered with the template of the channel.
+// Failing to get the template doesn't fail the request: the variables are listed instead.
+func (h *ProxyHandler) withWorkflowTemplate(send sendFunc) sendFunc {
+	return func(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (slack.PostMessageResult, error) {
+		defaults, err := h.channelConfigSvc.GetDefaults(ctx, channelID)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to get workflow template", slog.String("error", err.Error()))
+		}
+		text := renderWorkflowTemplate(defaults.WorkflowTemplate, payload)
+		return send(ctx, channelID, channelName, map[string]interface{}{"text": text})
+	}
+}
+
+// renderWorkflowTemplate replaces placeholders with the variables. Unknown placeholders are kept as is, so
+// typos are visible in the message. Empty template lists the variables.
+func renderWorkflowTemplate(tmpl string, vars map[string]interface{}) string {
+	if tmpl == "" {
+		keys := make([]string, 0, len(vars))
+		for key := range vars {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		lines := make([]string, 0, len(keys))
+		for _, key := range keys {
+			lines = append(lines, fmt.Sprintf("*%s*: %s", key, workflowValue(vars[key])))
+		}
+		return strings.Join(lines, "\n")
+	}
+	return workflowPlaceholderPattern.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		key := workflowPlaceholderPattern.FindStringSubmatch(placeholder)[1]
+		value, ok := vars[key]
+		if !ok {
+			return placeholder
+		}
+		return workflowValue(value)
+	})
+}
+
+func workflowValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
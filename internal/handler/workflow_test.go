@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/service"
+	"github.com/Finatext/belldog/internal/slack"
+)
+
+func TestWebhookWorkflow(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	configSvc := &mockChannelConfigService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+	configSvc.On("GetDefaults", mock.Anything, "C123456").Return(service.ChannelDefaults{Username: "Workflow", WorkflowTemplate: "New request from {{requester}}: {{ summary }} {{unknown}}"}, nil)
+	configSvc.On("GetPauseState", mock.Anything, "C123456").Return(service.PauseState{}, nil)
+	expected := map[string]interface{}{"text": "New request from <@U123>: disk full {{unknown}}", "username": "Workflow"}
+	slackClient.On("PostMessage", mock.Anything, "C123456", "test", expected).Return(slack.PostMessageResult{Type: slack.PostMessageResultOK}, nil)
+
+	h := ProxyHandler{
+		cfg:              appconfig.Config{},
+		slackClient:      slackClient,
+		tokenSvc:         svc,
+		channelConfigSvc: configSvc,
+		mentionSvc:       disabledMentionService(),
+		digestSvc:        disabledDigestService(),
+	}
+	payload := `{"requester": "<@U123>", "summary": "disk full"}`
+	c := setupContext(&payload)
+	err := h.WebhookWorkflow(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	slackClient.AssertExpectations(t)
+}
+
+func TestWebhookWorkflowNestedVariables(t *testing.T) {
+	slackClient := &mockSlackClient{}
+	svc := &mockTokenService{}
+	svc.On("VerifyToken", mock.Anything, "test", "deadbeef").Return(service.VerifyResult{ChannelID: "C123456", ChannelName: "test", Scope: service.ScopePost}, nil)
+
+	h := ProxyHandler{cfg: appconfig.Config{}, slackClient: slackClient, tokenSvc: svc, channelConfigSvc: disabledChannelConfigService()}
+	payload := `{"summary": {"nested": true}}`
+	c := setupContext(&payload)
+	err := h.WebhookWorkflow(c)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, "Workflow variables must be strings, numbers or booleans: summary\n", rec.Body.String())
+	slackClient.AssertNotCalled(t, "PostMessage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRenderWorkflowTemplateWithoutTemplate(t *testing.T) {
+	text := renderWorkflowTemplate("", map[string]interface{}{"summary": "disk full", "count": float64(3), "empty": nil})
+	assert.Equal(t, "*count*: 3\n*empty*: \n*summary*: disk full", text)
+}
@@ -0,0 +1,262 @@
+// Package kmsenvelope encrypts values with envelope encryption: values are encrypted with AES-256-GCM data keys
+// generated by AWS KMS, and the data key encrypted by KMS is stored with each value.
+package kmsenvelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/cockroachdb/errors"
+)
+
+// Encrypted values are formatted as `kms:v1:<encrypted data key>:<nonce and ciphertext>` with base64 encoding.
+const prefix = "kms:v1:"
+
+const (
+	// Encrypting with the same data key for a while limits GenerateDataKey calls to one per process and TTL.
+	dataKeyTTL = 5 * time.Minute
+	// Decrypted data keys are cached to call Decrypt once per data key. Values are encrypted with a few data keys
+	// unless the table is huge, so clear the cache when it grows instead of evicting.
+	maxCachedDataKeys = 1024
+)
+
+type kmsClient interface {
+	// GenerateDataKey returns a 256-bit data key in plaintext and encrypted with the KMS key.
+	GenerateDataKey(ctx context.Context, keyID string) (plaintext []byte, ciphertextBlob []byte, err error)
+	Decrypt(ctx context.Context, ciphertextBlob []byte) ([]byte, error)
+}
+
+type dataKey struct {
+	plaintext      []byte
+	ciphertextBlob []byte
+	expiresAt      time.Time
+}
+
+// Cipher encrypts and decrypts values with data keys of the KMS key. Safe for concurrent use.
+type Cipher struct {
+	client kmsClient
+	keyID  string
+
+	mu      sync.Mutex
+	current *dataKey
+	// Decrypted data keys by the encrypted data key.
+	decrypted map[string][]byte
+}
+
+// NewCipher creates Cipher. keyID is the key ID, key ARN or alias of the KMS key.
+func NewCipher(client kmsClient, keyID string) *Cipher {
+	return &Cipher{client: client, keyID: keyID, decrypted: map[string][]byte{}}
+}
+
+// IsEncrypted reports whether the value is encrypted by Cipher.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func (c *Cipher) Encrypt(ctx context.Context, plaintext string) (string, error) {
+	key, err := c.currentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key.plaintext)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "failed to generate nonce")
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	enc := base64.StdEncoding
+	return prefix + enc.EncodeToString(key.ciphertextBlob) + ":" + enc.EncodeToString(sealed), nil
+}
+
+// Decrypt returns values not encrypted by Cipher as is, so values saved before enabling encryption keep working.
+func (c *Cipher) Decrypt(ctx context.Context, value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return value, nil
+	}
+	encodedKey, encodedSealed, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", errors.New("invalid encrypted value format")
+	}
+	enc := base64.StdEncoding
+	blob, err := enc.DecodeString(encodedKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode encrypted data key")
+	}
+	sealed, err := enc.DecodeString(encodedSealed)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode ciphertext")
+	}
+	key, err := c.decryptKey(ctx, blob)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt value")
+	}
+	return string(plaintext), nil
+}
+
+func (c *Cipher) currentKey(ctx context.Context) (*dataKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current != nil && time.Now().Before(c.current.expiresAt) {
+		return c.current, nil
+	}
+	plaintext, blob, err := c.client.GenerateDataKey(ctx, c.keyID)
+	if err != nil {
+		return nil, err
+	}
+	c.current = &dataKey{plaintext: plaintext, ciphertextBlob: blob, expiresAt: time.Now().Add(dataKeyTTL)}
+	c.cacheKey(blob, plaintext)
+	return c.current, nil
+}
+
+func (c *Cipher) decryptKey(ctx context.Context, blob []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.decrypted[string(blob)]; ok {
+		return key, nil
+	}
+	key, err := c.client.Decrypt(ctx, blob)
+	if err != nil {
+		return nil, err
+	}
+	c.cacheKey(blob, key)
+	return key, nil
+}
+
+// Call with mu locked.
+func (c *Cipher) cacheKey(blob []byte, plaintext []byte) {
+	if len(c.decrypted) >= maxCachedDataKeys {
+		clear(c.decrypted)
+	}
+	c.decrypted[string(blob)] = plaintext
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create AES cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create GCM")
+	}
+	return aead, nil
+}
+
+// Client calls GenerateDataKey and Decrypt APIs of KMS. Like secretenv.Client, the APIs are called directly with
+// SigV4 signed requests because only two APIs are needed.
+type Client struct {
+	cfg    aws.Config
+	signer *v4.Signer
+}
+
+func NewClient(cfg aws.Config) *Client {
+	return &Client{cfg: cfg, signer: v4.NewSigner()}
+}
+
+// GenerateDataKey generates an AES-256 data key.
+// https://docs.aws.amazon.com/kms/latest/APIReference/API_GenerateDataKey.html
+func (c *Client) GenerateDataKey(ctx context.Context, keyID string) ([]byte, []byte, error) {
+	var out struct {
+		// []byte fields are base64 encoded in JSON like the KMS API.
+		Plaintext      []byte `json:"Plaintext"`
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+	}
+	in := map[string]string{"KeyId": keyID, "KeySpec": "AES_256"}
+	if err := c.call(ctx, "GenerateDataKey", in, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Plaintext, out.CiphertextBlob, nil
+}
+
+// Decrypt decrypts the data key. The KMS key is identified by the metadata in the ciphertext blob.
+// https://docs.aws.amazon.com/kms/latest/APIReference/API_Decrypt.html
+func (c *Client) Decrypt(ctx context.Context, ciphertextBlob []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	in := map[string][]byte{"CiphertextBlob": ciphertextBlob}
+	if err := c.call(ctx, "Decrypt", in, &out); err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+func (c *Client) call(ctx context.Context, action string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve AWS credentials")
+	}
+	sum := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "kms", c.cfg.Region, time.Now()); err != nil {
+		return errors.Wrap(err, "failed to sign request")
+	}
+
+	var httpClient aws.HTTPClient = http.DefaultClient
+	if c.cfg.HTTPClient != nil {
+		httpClient = c.cfg.HTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to call %s", action)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Newf("%s failed: status=%d, body=%s", action, resp.StatusCode, respBody)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal %s response", action)
+	}
+	return nil
+}
+
+func (c *Client) endpoint() string {
+	if c.cfg.BaseEndpoint != nil {
+		return *c.cfg.BaseEndpoint
+	}
+	return fmt.Sprintf("https://kms.%s.amazonaws.com/", c.cfg.Region)
+}
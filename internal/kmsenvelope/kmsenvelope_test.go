@@ -0,0 +1,114 @@
+package kmsenvelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKMS "encrypts" data keys by reversing bytes.
+type fakeKMS struct {
+	generateCalls int
+	decryptCalls  int
+}
+
+func (f *fakeKMS) GenerateDataKey(ctx context.Context, keyID string) ([]byte, []byte, error) {
+	f.generateCalls++
+	key := bytes.Repeat([]byte{byte(f.generateCalls)}, 32)
+	key[0] = 0xff
+	return key, reverse(key), nil
+}
+
+func (f *fakeKMS) Decrypt(ctx context.Context, ciphertextBlob []byte) ([]byte, error) {
+	f.decryptCalls++
+	return reverse(ciphertextBlob), nil
+}
+
+func reverse(b []byte) []byte {
+	ret := make([]byte, len(b))
+	for i := range b {
+		ret[len(b)-1-i] = b[i]
+	}
+	return ret
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	kms := &fakeKMS{}
+	c := NewCipher(kms, "alias/belldog")
+
+	first, err := c.Encrypt(ctx, "bd_ab12_secret")
+	require.NoError(t, err)
+	second, err := c.Encrypt(ctx, "bd_cd34_secret")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(first))
+	assert.NotContains(t, first, "secret")
+
+	// Another process decrypts the data key once.
+	other := NewCipher(kms, "alias/belldog")
+	got, err := other.Decrypt(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, "bd_ab12_secret", got)
+	got, err = other.Decrypt(ctx, second)
+	require.NoError(t, err)
+	assert.Equal(t, "bd_cd34_secret", got)
+
+	assert.Equal(t, 1, kms.generateCalls)
+	assert.Equal(t, 1, kms.decryptCalls)
+}
+
+func TestCipherDecryptPlaintext(t *testing.T) {
+	kms := &fakeKMS{}
+	c := NewCipher(kms, "alias/belldog")
+
+	got, err := c.Decrypt(context.Background(), "0123456789abcdef")
+
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", got)
+	assert.Equal(t, 0, kms.decryptCalls)
+}
+
+func TestCipherDecryptTampered(t *testing.T) {
+	ctx := context.Background()
+	c := NewCipher(&fakeKMS{}, "alias/belldog")
+	encrypted, err := c.Encrypt(ctx, "bd_ab12_secret")
+	require.NoError(t, err)
+
+	_, err = c.Decrypt(ctx, encrypted[:len(encrypted)-4]+"AAAA")
+
+	require.Error(t, err)
+}
+
+func TestClientGenerateDataKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "TrentService.GenerateDataKey", r.Header.Get("X-Amz-Target"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/kms/aws4_request")
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]string
+		require.NoError(t, json.Unmarshal(body, &req))
+		assert.Equal(t, map[string]string{"KeyId": "alias/belldog", "KeySpec": "AES_256"}, req)
+		_, _ = w.Write([]byte(`{"KeyId":"arn:aws:kms:ap-northeast-1:123456789012:key/test","Plaintext":"a2V5","CiphertextBlob":"YmxvYg=="}`))
+	}))
+	defer srv.Close()
+
+	cfg := aws.Config{
+		Region:       "ap-northeast-1",
+		BaseEndpoint: aws.String(srv.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+	plaintext, blob, err := NewClient(cfg).GenerateDataKey(context.Background(), "alias/belldog")
+
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key"), plaintext)
+	assert.Equal(t, []byte("blob"), blob)
+}
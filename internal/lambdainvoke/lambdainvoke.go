@@ -0,0 +1,81 @@
+// Package lambdainvoke invokes Lambda functions asynchronously, e.g. the running function itself to process
+// work after responding.
+package lambdainvoke
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/cockroachdb/errors"
+)
+
+// Client calls Invoke API of Lambda. The API is called directly with SigV4 signed requests because only a single
+// API is needed.
+type Client struct {
+	cfg    aws.Config
+	signer *v4.Signer
+}
+
+func NewClient(cfg aws.Config) *Client {
+	return &Client{cfg: cfg, signer: v4.NewSigner()}
+}
+
+// InvokeAsync queues the event to the function with `Event` invocation type, so this returns without waiting
+// for the invocation. qualifier is the version or the alias, empty for `$LATEST`.
+// https://docs.aws.amazon.com/lambda/latest/api/API_Invoke.html
+func (c *Client) InvokeAsync(ctx context.Context, functionName string, qualifier string, payload []byte) error {
+	u := c.endpoint() + "/2015-03-31/functions/" + url.PathEscape(functionName) + "/invocations"
+	if qualifier != "" {
+		u += "?" + url.Values{"Qualifier": {qualifier}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Amz-Invocation-Type", "Event")
+
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve AWS credentials")
+	}
+	sum := sha256.Sum256(payload)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "lambda", c.cfg.Region, time.Now()); err != nil {
+		return errors.Wrap(err, "failed to sign request")
+	}
+
+	var httpClient aws.HTTPClient = http.DefaultClient
+	if c.cfg.HTTPClient != nil {
+		httpClient = c.cfg.HTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to call Invoke")
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response body")
+	}
+	// Asynchronous invocations respond 202 once the event is queued.
+	if resp.StatusCode != http.StatusAccepted {
+		return errors.Newf("Invoke failed: function=%s, status=%d, body=%s", functionName, resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+func (c *Client) endpoint() string {
+	if c.cfg.BaseEndpoint != nil {
+		return *c.cfg.BaseEndpoint
+	}
+	return fmt.Sprintf("https://lambda.%s.amazonaws.com", c.cfg.Region)
+}
@@ -0,0 +1,55 @@
+package lambdainvoke
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientInvokeAsync(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/2015-03-31/functions/belldog-proxy/invocations", r.URL.Path)
+		assert.Equal(t, "3", r.URL.Query().Get("Qualifier"))
+		assert.Equal(t, "Event", r.Header.Get("X-Amz-Invocation-Type"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/lambda/aws4_request")
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"detail-type":"test"}`, string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := aws.Config{
+		Region:       "ap-northeast-1",
+		BaseEndpoint: aws.String(srv.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+	err := NewClient(cfg).InvokeAsync(context.Background(), "belldog-proxy", "3", []byte(`{"detail-type":"test"}`))
+	require.NoError(t, err)
+}
+
+func TestClientInvokeAsyncFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"Message":"not authorized"}`))
+	}))
+	defer srv.Close()
+
+	cfg := aws.Config{
+		Region:       "ap-northeast-1",
+		BaseEndpoint: aws.String(srv.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+	err := NewClient(cfg).InvokeAsync(context.Background(), "belldog-proxy", "", []byte(`{}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status=403")
+}
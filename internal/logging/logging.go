@@ -0,0 +1,120 @@
+// Package logging carries request attributes in contexts and adds them to every log line written with the
+// context, e.g. slog.InfoContext, so logs of a request can be correlated with the logs of other systems and call
+// sites don't have to repeat the attributes.
+//
+// Contexts carry the token prefix, never tokens, so the attributes never expose tokens.
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type attrsKey struct{}
+
+// requestAttrs are the attributes of the request. Empty attributes are not logged.
+type requestAttrs struct {
+	requestID   string
+	traceID     string
+	spanID      string
+	channelID   string
+	channelName string
+	tokenPrefix string
+}
+
+func attrsOf(ctx context.Context) requestAttrs {
+	attrs, _ := ctx.Value(attrsKey{}).(requestAttrs)
+	return attrs
+}
+
+func withAttrs(ctx context.Context, update func(*requestAttrs)) context.Context {
+	attrs := attrsOf(ctx)
+	update(&attrs)
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// WithRequestID returns the context having the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return withAttrs(ctx, func(a *requestAttrs) { a.requestID = id })
+}
+
+// RequestID returns the request ID of the context, or empty string.
+func RequestID(ctx context.Context) string {
+	return attrsOf(ctx).requestID
+}
+
+// WithTrace returns the context having the W3C trace context of the caller.
+func WithTrace(ctx context.Context, traceID string, spanID string) context.Context {
+	return withAttrs(ctx, func(a *requestAttrs) {
+		a.traceID = traceID
+		a.spanID = spanID
+	})
+}
+
+// WithChannel returns the context having the channel of the request. Empty arguments keep the current values,
+// e.g. the channel name in the path is kept when only the channel ID is known.
+func WithChannel(ctx context.Context, channelID string, channelName string) context.Context {
+	return withAttrs(ctx, func(a *requestAttrs) {
+		if channelID != "" {
+			a.channelID = channelID
+		}
+		if channelName != "" {
+			a.channelName = channelName
+		}
+	})
+}
+
+// WithTokenPrefix returns the context having the token prefix, see secret.Token.Prefix.
+func WithTokenPrefix(ctx context.Context, prefix string) context.Context {
+	return withAttrs(ctx, func(a *requestAttrs) { a.tokenPrefix = prefix })
+}
+
+// ContextHandler adds the request attributes of the context to the records. Logs without contexts, e.g.
+// slog.Info, have no request attributes. Attributes given to the log call take precedence, e.g. the access log
+// having request_id or logs of another channel.
+type ContextHandler struct {
+	inner slog.Handler
+}
+
+func NewContextHandler(inner slog.Handler) *ContextHandler {
+	return &ContextHandler{inner: inner}
+}
+
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := attrsOf(ctx)
+	candidates := [...]slog.Attr{
+		slog.String("request_id", attrs.requestID),
+		slog.String("trace_id", attrs.traceID),
+		slog.String("span_id", attrs.spanID),
+		slog.String("channel_id", attrs.channelID),
+		slog.String("channel_name", attrs.channelName),
+		slog.String("token_prefix", attrs.tokenPrefix),
+	}
+	for _, attr := range candidates {
+		if attr.Value.String() != "" && !hasAttr(r, attr.Key) {
+			r.AddAttrs(attr)
+		}
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{inner: h.inner.WithGroup(name)}
+}
+
+func hasAttr(r slog.Record, key string) bool {
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		found = a.Key == key
+		return !found
+	})
+	return found
+}
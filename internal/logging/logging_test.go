@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewContextHandler(slog.NewTextHandler(&buf, nil))).With(slog.String("component", "test"))
+	ctx := WithRequestID(context.Background(), "req-123")
+	ctx = WithTrace(ctx, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	ctx = WithChannel(ctx, "", "general")
+	ctx = WithTokenPrefix(ctx, "bd_ab12")
+
+	logger.InfoContext(ctx, "with context")
+	logger.InfoContext(WithChannel(ctx, "C123456", ""), "with channel ID")
+	logger.Info("without context")
+	logger.InfoContext(ctx, "given explicitly", slog.String("request_id", "req-456"), slog.String("channel_name", "random"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "component=test request_id=req-123 trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=00f067aa0ba902b7 channel_name=general token_prefix=bd_ab12")
+	assert.NotContains(t, lines[0], "channel_id")
+	assert.Contains(t, lines[1], "channel_id=C123456 channel_name=general")
+	assert.NotContains(t, lines[2], "request_id")
+	assert.Equal(t, 1, strings.Count(lines[3], "request_id"), lines[3])
+	assert.Contains(t, lines[3], "request_id=req-456")
+	assert.Equal(t, 1, strings.Count(lines[3], "channel_name"), lines[3])
+	assert.Contains(t, lines[3], "channel_name=random")
+}
@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+)
+
+// BodyLimit rejects requests having larger bodies than limit bytes with 413. Bodies without Content-Length
+// are limited while reading, so handlers' read errors are also converted to 413.
+func BodyLimit(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength > limit {
+				return respondTooLarge(c, limit)
+			}
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, limit)
+
+			err := next(c)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) && !c.Response().Committed {
+				return respondTooLarge(c, limit)
+			}
+			return err
+		}
+	}
+}
+
+func respondTooLarge(c echo.Context, limit int64) error {
+	msg := fmt.Sprintf("Request body too large. The limit is %d bytes.\n", limit)
+	return apierror.Respond(c, http.StatusRequestEntityTooLarge, apierror.CodeBodyTooLarge, msg)
+}
+
+// AllowContentTypes rejects requests having other media types than the given ones with 415. Empty string
+// in types allows requests without Content-Type header.
+func AllowContentTypes(types ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			contentType := c.Request().Header.Get(echo.HeaderContentType)
+			mediaType := ""
+			if contentType != "" {
+				t, _, err := mime.ParseMediaType(contentType)
+				if err != nil {
+					return apierror.Respond(c, http.StatusUnsupportedMediaType, apierror.CodeUnsupportedContentType, "Invalid Content-Type given.\n")
+				}
+				mediaType = t
+			}
+			if !slices.Contains(types, mediaType) {
+				msg := fmt.Sprintf("Unsupported Content-Type given: %s\n", contentType)
+				return apierror.Respond(c, http.StatusUnsupportedMediaType, apierror.CodeUnsupportedContentType, msg)
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBodyTestServer() *echo.Echo {
+	e := echo.New()
+	e.POST("/", func(c echo.Context) error {
+		if _, err := io.ReadAll(c.Request().Body); err != nil {
+			return errors.Wrap(err, "failed to read request body")
+		}
+		return c.String(http.StatusOK, "ok")
+	}, BodyLimit(8), AllowContentTypes("", echo.MIMEApplicationJSON))
+	return e
+}
+
+func TestBodyLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       io.Reader
+		wantStatus int
+	}{
+		{name: "within limit", body: strings.NewReader("12345678"), wantStatus: http.StatusOK},
+		{name: "content length exceeded", body: strings.NewReader("123456789"), wantStatus: http.StatusRequestEntityTooLarge},
+		// No Content-Length, so the limit is applied while reading.
+		{name: "chunked exceeded", body: io.MultiReader(strings.NewReader("123456789")), wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", tt.body)
+			rec := httptest.NewRecorder()
+			newBodyTestServer().ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestAllowContentTypes(t *testing.T) {
+	tests := []struct {
+		contentType string
+		wantStatus  int
+	}{
+		{contentType: "", wantStatus: http.StatusOK},
+		{contentType: "application/json; charset=utf-8", wantStatus: http.StatusOK},
+		{contentType: "text/xml", wantStatus: http.StatusUnsupportedMediaType},
+		{contentType: "invalid;;", wantStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+			if tt.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			newBodyTestServer().ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
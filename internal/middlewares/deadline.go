@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/deadline"
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// Deadline limits requests to the remaining execution time of the Lambda invocation minus reserve. Requests
+// running out of the time are responded with 504 unless the handler has responded, instead of being killed by
+// Lambda without any response. Requests without deadlines, e.g. in server mode, are not limited.
+func Deadline(reserve time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx, cancel := deadline.WithBudget(c.Request().Context(), reserve)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			err := next(c)
+			if !deadline.Exceeded(ctx) || c.Response().Committed {
+				return err
+			}
+			telemetry.RecordDeadlineExceeded(ctx, "request")
+			attrs := []any{slog.String("route", c.Path())}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			slog.WarnContext(ctx, "execution time budget exhausted, response gateway timeout", attrs...)
+			return apierror.Respond(c, http.StatusGatewayTimeout, apierror.CodeDeadlineExceeded, "Request aborted: the execution time ran out. Retry later.\n")
+		}
+	}
+}
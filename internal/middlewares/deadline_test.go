@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDeadlineTestServer(handler echo.HandlerFunc) *echo.Echo {
+	e := echo.New()
+	e.POST("/", handler, Deadline(50*time.Millisecond))
+	return e
+}
+
+func TestDeadlineAbortsWithGatewayTimeout(t *testing.T) {
+	e := newDeadlineTestServer(func(c echo.Context) error {
+		<-c.Request().Context().Done()
+		return c.Request().Context().Err()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	// Aborted with the reserve left before the invocation deadline.
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestDeadlineKeepsHandlerResponse(t *testing.T) {
+	e := newDeadlineTestServer(func(c echo.Context) error {
+		<-c.Request().Context().Done()
+		return c.String(http.StatusOK, "ok")
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestDeadlineWithoutDeadline(t *testing.T) {
+	e := newDeadlineTestServer(func(c echo.Context) error {
+		_, ok := c.Request().Context().Deadline()
+		assert.False(t, ok)
+		return c.String(http.StatusOK, "ok")
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -3,13 +3,74 @@ package middlewares
 import (
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
 
 	"github.com/cockroachdb/errors"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/logging"
+	"github.com/Finatext/belldog/internal/secret"
 )
 
-func RequestLogger() echo.MiddlewareFunc {
+// Optional attributes of the access log, which can be excluded with ACCESS_LOG_EXCLUDE_ATTRIBUTES.
+var accessLogAttributes = []string{"authority", "request_id", "latency", "response_size", "payload_size", "channel", "user_agent", "remote_ip"}
+
+// ValidateAccessLog validates ACCESS_LOG_* settings, so invalid settings fail at startup.
+func ValidateAccessLog(config appconfig.Config) error {
+	if config.AccessLogSampleRate < 1 {
+		return errors.Newf("ACCESS_LOG_SAMPLE_RATE must be positive: %d", config.AccessLogSampleRate)
+	}
+	if _, err := parseAccessLogLevels(config.AccessLogLevels); err != nil {
+		return err
+	}
+	for _, attr := range config.AccessLogExcludeAttributes {
+		if !slices.Contains(accessLogAttributes, attr) {
+			return errors.Newf("unknown access log attribute: %s, available attributes: %s", attr, strings.Join(accessLogAttributes, ", "))
+		}
+	}
+	return nil
+}
+
+// parseAccessLogLevels parses `<route>=<level>` entries, e.g. `/hc=debug`. Routes are echo route paths like
+// `/p/:channel_name/:token`.
+func parseAccessLogLevels(entries []string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level, len(entries))
+	for _, entry := range entries {
+		route, levelStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, errors.Newf("invalid ACCESS_LOG_LEVELS entry, expected <route>=<level>: %s", entry)
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(levelStr)); err != nil {
+			return nil, errors.Wrapf(err, "invalid level of ACCESS_LOG_LEVELS entry: %s", entry)
+		}
+		levels[route] = level
+	}
+	return levels, nil
+}
+
+type accessLogger struct {
+	sampleRate uint64
+	levels     map[string]slog.Level
+	exclude    []string
+	// Successful requests logged or skipped so far, for sampling.
+	successes atomic.Uint64
+}
+
+// RequestLogger logs each request at info level, or the level configured for the route with ACCESS_LOG_LEVELS.
+// With ACCESS_LOG_SAMPLE_RATE=N, only 1 of N successful requests is logged. Failed requests are always logged.
+// Settings must be validated with ValidateAccessLog.
+func RequestLogger(config appconfig.Config) echo.MiddlewareFunc {
+	levels, _ := parseAccessLogLevels(config.AccessLogLevels)
+	l := &accessLogger{
+		sampleRate: uint64(max(config.AccessLogSampleRate, 1)),
+		levels:     levels,
+		exclude:    config.AccessLogExcludeAttributes,
+	}
 	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogError:        true,
 		HandleError:     true,
@@ -22,30 +83,97 @@ func RequestLogger() echo.MiddlewareFunc {
 		LogUserAgent:    true,
 		LogRemoteIP:     true,
 		LogStatus:       true,
-		LogValuesFunc:   requestLoggerFunc,
+		LogValuesFunc:   l.log,
 	})
 }
 
-func requestLoggerFunc(c echo.Context, v middleware.RequestLoggerValues) error {
+func (l *accessLogger) log(c echo.Context, v middleware.RequestLoggerValues) error {
+	ctx := c.Request().Context()
 	if v.Error != nil {
 		var httpError *echo.HTTPError
 		// Log only non-HTTP errors, so the "not operator" `!` is used here.
 		if !errors.As(v.Error, &httpError) {
-			slog.ErrorContext(c.Request().Context(), "failed to handle request", slog.String("err", fmt.Sprintf("%+v", v.Error)))
+			slog.ErrorContext(ctx, "failed to handle request", slog.String("err", fmt.Sprintf("%+v", v.Error)))
 		}
 	}
 
-	slog.LogAttrs(c.Request().Context(), slog.LevelInfo, "REQUEST",
+	failed := v.Error != nil || v.Status >= 400
+	if !failed && l.successes.Add(1)%l.sampleRate != 0 {
+		return nil
+	}
+	level, ok := l.levels[c.Path()]
+	if !ok {
+		level = slog.LevelInfo
+	}
+	// Failed requests are worth logging even for quiet routes.
+	if failed {
+		level = max(level, slog.LevelInfo)
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return nil
+	}
+
+	attrs := []slog.Attr{
 		slog.String("method", v.Method),
-		slog.String("path", v.URIPath),
+		slog.String("path", maskTokenInPath(c, v.URIPath)),
 		slog.Int("status", v.Status),
+	}
+	optional := []slog.Attr{
 		slog.String("authority", v.Host),
 		slog.String("request_id", v.RequestID),
 		slog.String("latency", fmt.Sprintf("%s", v.Latency)),
 		slog.Int64("response_size", v.ResponseSize),
+		// -1 for unknown size, e.g. chunked requests.
+		slog.Int64("payload_size", c.Request().ContentLength),
+		slog.String("channel", channelParam(c)),
 		slog.String("user_agent", v.UserAgent),
 		slog.String("remote_ip", v.RemoteIP),
-	)
+	}
+	for _, attr := range optional {
+		if !slices.Contains(l.exclude, attr.Key) {
+			attrs = append(attrs, attr)
+		}
+	}
+	if slices.Contains(l.exclude, "request_id") {
+		// Otherwise the request ID is added from the context.
+		ctx = logging.WithRequestID(ctx, "")
+	}
+	if l.sampleRate > 1 && !failed {
+		attrs = append(attrs, slog.Uint64("sample_rate", l.sampleRate))
+	}
+	slog.LogAttrs(ctx, level, "REQUEST", attrs...)
 
 	return nil
 }
+
+// LogAttributes adds the channel and the token prefix in the path to the request context, so every log line of
+// the request has them. Handlers add the channel ID after verifying the token.
+func LogAttributes(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := logging.WithChannel(c.Request().Context(), c.Param("channel_id"), c.Param("channel_name"))
+		if token := c.Param("token"); token != "" {
+			ctx = logging.WithTokenPrefix(ctx, secret.Token(token).Prefix())
+		}
+		c.SetRequest(c.Request().WithContext(ctx))
+		return next(c)
+	}
+}
+
+// Channel name, channel ID or broadcast group name of webhook requests.
+func channelParam(c echo.Context) string {
+	for _, name := range []string{"channel_id", "channel_name", "group_name"} {
+		if v := c.Param(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// maskTokenInPath replaces the token in webhook URL paths with its prefix, so logs don't expose tokens.
+func maskTokenInPath(c echo.Context, path string) string {
+	token := c.Param("token")
+	if token == "" {
+		return path
+	}
+	return strings.Replace(path, token, secret.Token(token).Prefix(), 1)
+}
@@ -0,0 +1,103 @@
+package middlewares
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func newLoggingTestServer(config appconfig.Config) *echo.Echo {
+	e := echo.New()
+	e.Use(RequestLogger(config))
+	e.GET("/hc", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+	e.POST("/p/:channel_name/:token", func(c echo.Context) error {
+		if c.Request().Header.Get("X-Fail") != "" {
+			return c.String(http.StatusNotFound, "not found")
+		}
+		return c.String(http.StatusOK, "ok")
+	})
+	return e
+}
+
+func serve(e *echo.Echo, method string, path string, fail bool) {
+	req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+	if fail {
+		req.Header.Set("X-Fail", "1")
+	}
+	e.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestRequestLoggerSampling(t *testing.T) {
+	buf := captureLogs(t)
+	e := newLoggingTestServer(appconfig.Config{AccessLogSampleRate: 3})
+
+	for range 6 {
+		serve(e, http.MethodPost, "/p/general/bd_ab12_secret", false)
+	}
+	serve(e, http.MethodPost, "/p/general/bd_ab12_secret", true)
+
+	logs := buf.String()
+	assert.Equal(t, 3, strings.Count(logs, "msg=REQUEST"), logs)
+	assert.Equal(t, 1, strings.Count(logs, "status=404"), logs)
+	assert.Contains(t, logs, "sample_rate=3")
+	assert.Contains(t, logs, "path=/p/general/bd_ab12 ")
+	assert.Contains(t, logs, "channel=general")
+	assert.NotContains(t, logs, "secret")
+}
+
+func TestRequestLoggerRouteLevels(t *testing.T) {
+	buf := captureLogs(t)
+	e := newLoggingTestServer(appconfig.Config{AccessLogSampleRate: 1, AccessLogLevels: []string{"/hc=debug", "/p/:channel_name/:token=warn"}})
+
+	serve(e, http.MethodGet, "/hc", false)
+	serve(e, http.MethodPost, "/p/general/bd_ab12_secret", false)
+
+	logs := buf.String()
+	assert.NotContains(t, logs, "path=/hc")
+	assert.Contains(t, logs, "level=WARN msg=REQUEST method=POST")
+}
+
+func TestRequestLoggerExcludeAttributes(t *testing.T) {
+	buf := captureLogs(t)
+	e := newLoggingTestServer(appconfig.Config{AccessLogSampleRate: 1, AccessLogExcludeAttributes: []string{"user_agent", "remote_ip", "channel"}})
+
+	serve(e, http.MethodPost, "/p/general/bd_ab12_secret", false)
+
+	logs := buf.String()
+	assert.Contains(t, logs, "payload_size=2")
+	assert.NotContains(t, logs, "user_agent=")
+	assert.NotContains(t, logs, "remote_ip=")
+	assert.NotContains(t, logs, "channel=")
+}
+
+func TestValidateAccessLog(t *testing.T) {
+	valid := appconfig.Config{AccessLogSampleRate: 10, AccessLogLevels: []string{"/hc=debug"}, AccessLogExcludeAttributes: []string{"user_agent"}}
+	require.NoError(t, ValidateAccessLog(valid))
+
+	for _, invalid := range []appconfig.Config{
+		{AccessLogSampleRate: 0},
+		{AccessLogSampleRate: 1, AccessLogLevels: []string{"/hc"}},
+		{AccessLogSampleRate: 1, AccessLogLevels: []string{"/hc=verbose"}},
+		{AccessLogSampleRate: 1, AccessLogExcludeAttributes: []string{"method"}},
+	} {
+		assert.Error(t, ValidateAccessLog(invalid), "%+v", invalid)
+	}
+}
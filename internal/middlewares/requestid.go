@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/logging"
+)
+
+const (
+	headerTraceparent  = "Traceparent"
+	maxRequestIDLength = 128
+)
+
+// RequestID takes the request ID from `X-Request-Id`, or the trace ID of W3C `traceparent`, so logs of Belldog
+// can be correlated with the logs of the caller. Otherwise a random ID is generated. The ID is set to the
+// request header, the response header and the request context for logging, with the trace context if given.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			traceID, spanID := traceContextOf(req.Header.Get(headerTraceparent))
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !isValidRequestID(id) {
+				id = traceID
+			}
+			if id == "" {
+				id = generateRequestID()
+			}
+			req.Header.Set(echo.HeaderXRequestID, id)
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			ctx := logging.WithRequestID(req.Context(), id)
+			if traceID != "" {
+				ctx = logging.WithTrace(ctx, traceID, spanID)
+			}
+			c.SetRequest(req.WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// isValidRequestID rejects IDs which could forge log lines or response headers.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// traceContextOf returns the trace ID and the parent span ID of the `traceparent` header, e.g.
+// `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`, or empty strings if the header is invalid.
+func traceContextOf(traceparent string) (traceID string, spanID string) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", ""
+	}
+	if !isLowerHex(parts[1]) || !isLowerHex(parts[2]) || parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", ""
+	}
+	return parts[1], parts[2]
+}
+
+func isLowerHex(s string) bool {
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func generateRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never returns an error.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
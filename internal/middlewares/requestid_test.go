@@ -0,0 +1,86 @@
+package middlewares
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Finatext/belldog/internal/logging"
+)
+
+func serveRequestID(t *testing.T, header http.Header) (string, string) {
+	t.Helper()
+	e := echo.New()
+	e.Use(RequestID())
+	var fromContext string
+	e.GET("/hc", func(c echo.Context) error {
+		fromContext = logging.RequestID(c.Request().Context())
+		assert.Equal(t, fromContext, c.Request().Header.Get(echo.HeaderXRequestID))
+		return c.String(http.StatusOK, "ok")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/hc", nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec.Header().Get(echo.HeaderXRequestID), fromContext
+}
+
+func TestRequestID(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected string
+	}{
+		{"X-Request-Id", http.Header{"X-Request-Id": {"req-123"}, "Traceparent": {traceparent}}, "req-123"},
+		{"traceparent", http.Header{"Traceparent": {traceparent}}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"invalid X-Request-Id", http.Header{"X-Request-Id": {"forged\nline"}, "Traceparent": {traceparent}}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, fromContext := serveRequestID(t, tt.header)
+			assert.Equal(t, tt.expected, response)
+			assert.Equal(t, tt.expected, fromContext)
+		})
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	for _, traceparent := range []string{"", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"} {
+		response, fromContext := serveRequestID(t, http.Header{"Traceparent": {traceparent}})
+		assert.Len(t, response, 32, traceparent)
+		assert.Equal(t, response, fromContext)
+	}
+	first, _ := serveRequestID(t, nil)
+	second, _ := serveRequestID(t, nil)
+	assert.NotEqual(t, first, second)
+}
+
+func TestLogAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(logging.NewContextHandler(slog.NewTextHandler(&buf, nil))))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	e := echo.New()
+	e.Use(RequestID())
+	e.Use(LogAttributes)
+	e.POST("/p/:channel_name/:token", func(c echo.Context) error {
+		slog.InfoContext(c.Request().Context(), "handled")
+		return c.String(http.StatusOK, "ok")
+	})
+	req := httptest.NewRequest(http.MethodPost, "/p/general/bd_ab12_secret", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	logs := buf.String()
+	assert.Contains(t, logs, "request_id=4bf92f3577b34da6a3ce929d0e0e4736 trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=00f067aa0ba902b7 channel_name=general token_prefix=bd_ab12")
+	assert.NotContains(t, logs, "secret")
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Finatext/belldog/internal/apierror"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// Callers are asked to retry after this when DynamoDB keeps throttling after the retries.
+const storageThrottledRetryAfter = time.Second
+
+// StorageThrottled responds 503 with Retry-After instead of 500 when DynamoDB keeps throttling the request after
+// the retries of the SDK, so callers retry later like for the Slack API circuit breaker.
+func StorageThrottled(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		if err == nil || c.Response().Committed || !storage.IsThrottled(err) {
+			return err
+		}
+		slog.WarnContext(c.Request().Context(), "storage throttled, response service unavailable", slog.String("route", c.Path()), slog.String("error", err.Error()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(storageThrottledRetryAfter.Seconds())))
+		return apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeStorageThrottled, "Storage is busy. Retry later.\n")
+	}
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageThrottled(t *testing.T) {
+	e := echo.New()
+	e.POST("/throttled", func(c echo.Context) error {
+		return errors.Wrap(&types.ProvisionedThroughputExceededException{}, "failed to query")
+	}, StorageThrottled)
+	e.POST("/failed", func(c echo.Context) error {
+		return errors.New("broken record")
+	}, StorageThrottled)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/throttled", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/failed", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,187 @@
+// Package receipt emits delivery receipts of webhook requests to Kinesis Data Streams, Data Firehose or
+// EventBridge, so security teams can analyze who posts what via Belldog.
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/eventbridge"
+)
+
+// Receipt describes a delivery. Payloads are not included, only their hashes.
+type Receipt struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	// Prefix of the token, same as the one shown with the list command.
+	TokenPrefix  string `json:"token_prefix"`
+	TokenVersion int    `json:"token_version"`
+	// Route of the request, e.g. "/p/:channel_name/:token/update".
+	Route string `json:"route"`
+	// Empty when no message was posted, e.g. failed deliveries.
+	TS string `json:"ts,omitempty"`
+	// See slack.Outcome.
+	Outcome string `json:"outcome"`
+	// Error code of Slack API failures, e.g. "channel_not_found".
+	Reason string `json:"reason,omitempty"`
+	// Hex encoded SHA-256 of the request body.
+	PayloadHash string    `json:"payload_hash"`
+	RequestID   string    `json:"request_id,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// HashPayload returns the payload hash of receipts.
+func HashPayload(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Destination kinds, given as the scheme of RECEIPT_DESTINATION.
+const (
+	KindKinesis     = "kinesis"
+	KindFirehose    = "firehose"
+	KindEventBridge = "eventbridge"
+)
+
+// Destination is a stream or an event bus given as `<kind>://<name>`, e.g. `firehose://belldog-receipts`.
+type Destination struct {
+	Kind string
+	// Stream name of Kinesis and Firehose, event bus name or ARN of EventBridge.
+	Name string
+}
+
+// ParseDestination returns the zero Destination, which disables receipts, for the empty string.
+func ParseDestination(s string) (Destination, error) {
+	if s == "" {
+		return Destination{}, nil
+	}
+	kind, name, ok := strings.Cut(s, "://")
+	if !ok || name == "" {
+		return Destination{}, errors.Newf("invalid receipt destination, it must be `<kind>://<name>`: %s", s)
+	}
+	switch kind {
+	case KindKinesis, KindFirehose, KindEventBridge:
+		return Destination{Kind: kind, Name: name}, nil
+	default:
+		return Destination{}, errors.Newf("unknown receipt destination kind, it must be %s, %s or %s: %s", KindKinesis, KindFirehose, KindEventBridge, kind)
+	}
+}
+
+func (d Destination) String() string {
+	return d.Kind + "://" + d.Name
+}
+
+// Source and DetailType of EventBridge events, for matching them with event rules.
+const (
+	EventSource     = "belldog"
+	EventDetailType = "Belldog Delivery Receipt"
+)
+
+// Client puts receipts to the destination. Like secretenv.Client, the APIs are called directly with SigV4 signed
+// requests because only a single API of each service is needed.
+type Client struct {
+	cfg    aws.Config
+	signer *v4.Signer
+	events *eventbridge.Client
+	dest   Destination
+}
+
+// NewClient returns the client. The zero Destination disables receipts, see Enabled.
+func NewClient(cfg aws.Config, dest Destination) *Client {
+	return &Client{cfg: cfg, signer: v4.NewSigner(), events: eventbridge.NewClient(cfg), dest: dest}
+}
+
+func (c *Client) Enabled() bool {
+	return c.dest.Kind != ""
+}
+
+// Emit puts a receipt as a JSON record or event.
+func (c *Client) Emit(ctx context.Context, r Receipt) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal receipt")
+	}
+	switch c.dest.Kind {
+	case KindKinesis:
+		// https://docs.aws.amazon.com/kinesis/latest/APIReference/API_PutRecord.html
+		// Records of the same channel go to the same shard, so their order is kept.
+		input := map[string]interface{}{"StreamName": c.dest.Name, "Data": data, "PartitionKey": r.ChannelID}
+		_, err := c.call(ctx, "kinesis", "Kinesis_20131202.PutRecord", input)
+		return err
+	case KindFirehose:
+		// https://docs.aws.amazon.com/firehose/latest/APIReference/API_PutRecord.html
+		// Newline delimited, so records delivered to S3 can be queried with Athena as is.
+		input := map[string]interface{}{"DeliveryStreamName": c.dest.Name, "Record": map[string]interface{}{"Data": append(data, '\n')}}
+		_, err := c.call(ctx, "firehose", "Firehose_20150804.PutRecord", input)
+		return err
+	case KindEventBridge:
+		return c.events.PutEvents(ctx, []eventbridge.Entry{{
+			Source:       EventSource,
+			DetailType:   EventDetailType,
+			Detail:       string(data),
+			EventBusName: c.dest.Name,
+		}})
+	default:
+		return errors.New("receipt destination not configured")
+	}
+}
+
+// call calls the JSON API of the service and returns the response body.
+func (c *Client) call(ctx context.Context, service string, target string, input interface{}) ([]byte, error) {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(service), bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve AWS credentials")
+	}
+	sum := sha256.Sum256(payload)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), service, c.cfg.Region, time.Now()); err != nil {
+		return nil, errors.Wrap(err, "failed to sign request")
+	}
+
+	var httpClient aws.HTTPClient = http.DefaultClient
+	if c.cfg.HTTPClient != nil {
+		httpClient = c.cfg.HTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to call %s", target)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Newf("%s failed: destination=%s, status=%d, body=%s", target, c.dest, resp.StatusCode, respBody)
+	}
+	return respBody, nil
+}
+
+func (c *Client) endpoint(service string) string {
+	if c.cfg.BaseEndpoint != nil {
+		return *c.cfg.BaseEndpoint
+	}
+	return fmt.Sprintf("https://%s.%s.amazonaws.com", service, c.cfg.Region)
+}
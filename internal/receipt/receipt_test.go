@@ -0,0 +1,156 @@
+package receipt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(url string) aws.Config {
+	return aws.Config{
+		Region:       "ap-northeast-1",
+		BaseEndpoint: aws.String(url),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+}
+
+var testReceipt = Receipt{
+	ChannelID:    "C01",
+	ChannelName:  "alerts",
+	TokenPrefix:  "abcd",
+	TokenVersion: 1,
+	Route:        "/p/:channel_name/:token",
+	TS:           "1700000000.000100",
+	Outcome:      "ok",
+	PayloadHash:  HashPayload([]byte(`{"text":"hello"}`)),
+	Timestamp:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+func TestParseDestination(t *testing.T) {
+	dest, err := ParseDestination("firehose://belldog-receipts")
+	require.NoError(t, err)
+	assert.Equal(t, Destination{Kind: KindFirehose, Name: "belldog-receipts"}, dest)
+
+	dest, err = ParseDestination("eventbridge://arn:aws:events:ap-northeast-1:123456789012:event-bus/security")
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:events:ap-northeast-1:123456789012:event-bus/security", dest.Name)
+
+	dest, err = ParseDestination("")
+	require.NoError(t, err)
+	assert.False(t, NewClient(aws.Config{}, dest).Enabled())
+
+	for _, s := range []string{"belldog-receipts", "firehose://", "sqs://queue"} {
+		_, err := ParseDestination(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestEmitKinesis(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Kinesis_20131202.PutRecord", r.Header.Get("X-Amz-Target"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/kinesis/aws4_request")
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			StreamName   string
+			Data         []byte
+			PartitionKey string
+		}
+		require.NoError(t, json.Unmarshal(body, &req))
+		assert.Equal(t, "belldog-receipts", req.StreamName)
+		assert.Equal(t, "C01", req.PartitionKey)
+		var got Receipt
+		require.NoError(t, json.Unmarshal(req.Data, &got))
+		assert.Equal(t, testReceipt, got)
+		_, _ = w.Write([]byte(`{"SequenceNumber":"1","ShardId":"shardId-000000000000"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(testConfig(srv.URL), Destination{Kind: KindKinesis, Name: "belldog-receipts"})
+	require.NoError(t, client.Emit(context.Background(), testReceipt))
+}
+
+func TestEmitFirehose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Firehose_20150804.PutRecord", r.Header.Get("X-Amz-Target"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/firehose/aws4_request")
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			DeliveryStreamName string
+			Record             struct{ Data string }
+		}
+		require.NoError(t, json.Unmarshal(body, &req))
+		assert.Equal(t, "belldog-receipts", req.DeliveryStreamName)
+		data, err := base64.StdEncoding.DecodeString(req.Record.Data)
+		require.NoError(t, err)
+		assert.Equal(t, byte('\n'), data[len(data)-1])
+		assert.Contains(t, string(data), `"payload_hash":"`+testReceipt.PayloadHash+`"`)
+		_, _ = w.Write([]byte(`{"RecordId":"1"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(testConfig(srv.URL), Destination{Kind: KindFirehose, Name: "belldog-receipts"})
+	require.NoError(t, client.Emit(context.Background(), testReceipt))
+}
+
+func TestEmitEventBridge(t *testing.T) {
+	failed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AWSEvents.PutEvents", r.Header.Get("X-Amz-Target"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/events/aws4_request")
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Entries []struct {
+				Source       string
+				DetailType   string
+				Detail       string
+				EventBusName string
+			}
+		}
+		require.NoError(t, json.Unmarshal(body, &req))
+		require.Len(t, req.Entries, 1)
+		assert.Equal(t, EventSource, req.Entries[0].Source)
+		assert.Equal(t, EventDetailType, req.Entries[0].DetailType)
+		assert.Equal(t, "security", req.Entries[0].EventBusName)
+		var got Receipt
+		require.NoError(t, json.Unmarshal([]byte(req.Entries[0].Detail), &got))
+		assert.Equal(t, testReceipt, got)
+		if failed {
+			_, _ = w.Write([]byte(`{"FailedEntryCount":1,"Entries":[{"ErrorCode":"InternalFailure","ErrorMessage":"failed"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"FailedEntryCount":0,"Entries":[{"EventId":"1"}]}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(testConfig(srv.URL), Destination{Kind: KindEventBridge, Name: "security"})
+	require.NoError(t, client.Emit(context.Background(), testReceipt))
+
+	failed = true
+	err := client.Emit(context.Background(), testReceipt)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "InternalFailure")
+}
+
+func TestEmitFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Stream belldog-receipts not found"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(testConfig(srv.URL), Destination{Kind: KindKinesis, Name: "belldog-receipts"})
+	err := client.Emit(context.Background(), testReceipt)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ResourceNotFoundException")
+}
@@ -0,0 +1,182 @@
+// Package runtimeconfig refreshes selected settings from a SSM parameter, so operators can change them without
+// deploying belldog again.
+package runtimeconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+// Region roles for active-passive deployments with DynamoDB Global Tables. Empty means a single region deployment.
+const (
+	RegionRoleActive  = "active"
+	RegionRolePassive = "passive"
+)
+
+// Settings are the settings changeable at runtime. The env config gives the initial values.
+type Settings struct {
+	GoLog                      slog.Level
+	MaintenanceMode            bool
+	OpsNotificationChannelName string
+	RegionRole                 string
+}
+
+// Passive tells whether this region is the standby. Changing the role to active takes over the active region.
+func (s Settings) Passive() bool {
+	return s.RegionRole == RegionRolePassive
+}
+
+// ValidateRegionRole returns an error for unknown roles.
+func ValidateRegionRole(role string) error {
+	switch role {
+	case "", RegionRoleActive, RegionRolePassive:
+		return nil
+	default:
+		return errors.Newf("unknown region role: %s", role)
+	}
+}
+
+// document is the JSON stored in the parameter. Omitted fields keep the values of the env config.
+type document struct {
+	GoLog                      *slog.Level `json:"go_log"`
+	MaintenanceMode            *bool       `json:"maintenance_mode"`
+	OpsNotificationChannelName *string     `json:"ops_notification_channel_name"`
+	RegionRole                 *string     `json:"region_role"`
+}
+
+type parameterGetter interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// Store caches the settings and fetches the parameter again when the TTL passes. Fetching lazily on access
+// instead of a background ticker works with Lambda, which freezes the process between invocations.
+type Store struct {
+	client        parameterGetter
+	parameterName string
+	ttl           time.Duration
+	defaults      Settings
+	// Optional. Updated with the fetched log level.
+	logLevel *slog.LevelVar
+	now      func() time.Time
+
+	mu        sync.Mutex
+	current   Settings
+	expiresAt time.Time
+}
+
+// FromConfig returns the settings given by the env config.
+func FromConfig(cfg appconfig.Config) Settings {
+	return Settings{
+		GoLog:                      cfg.GoLog,
+		MaintenanceMode:            cfg.MaintenanceMode,
+		OpsNotificationChannelName: cfg.OpsNotificationChannelName,
+		RegionRole:                 cfg.RegionRole,
+	}
+}
+
+// NewStore returns a store always returning the env config when RUNTIME_CONFIG_PARAMETER_NAME is not set.
+func NewStore(cfg appconfig.Config, client parameterGetter, logLevel *slog.LevelVar) *Store {
+	defaults := FromConfig(cfg)
+	return &Store{
+		client:        client,
+		parameterName: cfg.RuntimeConfigParameterName,
+		ttl:           cfg.RuntimeConfigTTL,
+		defaults:      defaults,
+		logLevel:      logLevel,
+		now:           time.Now,
+		current:       defaults,
+	}
+}
+
+// Settings returns the cached settings, refreshing them when expired. Failing to refresh keeps the last
+// settings until the next TTL to not make belldog unavailable due to a broken parameter.
+func (s *Store) Settings(ctx context.Context) Settings {
+	if s.parameterName == "" {
+		return s.defaults
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Before(s.expiresAt) {
+		return s.current
+	}
+	s.expiresAt = now.Add(s.ttl)
+	settings, err := s.fetch(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to refresh runtime config, keeping current settings", slog.String("error", err.Error()), slog.String("parameter_name", s.parameterName))
+		return s.current
+	}
+	if settings != s.current {
+		slog.InfoContext(ctx, "runtime config changed",
+			slog.String("go_log", settings.GoLog.String()),
+			slog.Bool("maintenance_mode", settings.MaintenanceMode),
+			slog.String("ops_notification_channel_name", settings.OpsNotificationChannelName),
+			slog.String("region_role", settings.RegionRole),
+		)
+	}
+	s.current = settings
+	if s.logLevel != nil {
+		s.logLevel.Set(settings.GoLog)
+	}
+	return s.current
+}
+
+func (s *Store) fetch(ctx context.Context) (Settings, error) {
+	out, err := s.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(s.parameterName),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return Settings{}, errors.Wrapf(err, "failed to get parameter: %s", s.parameterName)
+	}
+	if out.Parameter == nil {
+		return Settings{}, errors.Newf("parameter has no value: %s", s.parameterName)
+	}
+	return parse(s.defaults, aws.ToString(out.Parameter.Value))
+}
+
+func parse(defaults Settings, value string) (Settings, error) {
+	var doc document
+	dec := json.NewDecoder(bytes.NewBufferString(value))
+	// Reject typos in field names instead of silently ignoring them.
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return Settings{}, errors.Wrap(err, "failed to parse runtime config")
+	}
+
+	settings := defaults
+	if doc.GoLog != nil {
+		settings.GoLog = *doc.GoLog
+	}
+	if doc.MaintenanceMode != nil {
+		settings.MaintenanceMode = *doc.MaintenanceMode
+	}
+	if doc.OpsNotificationChannelName != nil {
+		if *doc.OpsNotificationChannelName == "" {
+			return Settings{}, errors.New("ops_notification_channel_name must not be empty")
+		}
+		settings.OpsNotificationChannelName = *doc.OpsNotificationChannelName
+	}
+	if doc.RegionRole != nil {
+		// Switching a region deployment to the single region deployment at runtime is not supported.
+		if *doc.RegionRole == "" {
+			return Settings{}, errors.New("region_role must not be empty")
+		}
+		if err := ValidateRegionRole(*doc.RegionRole); err != nil {
+			return Settings{}, err
+		}
+		settings.RegionRole = *doc.RegionRole
+	}
+	return settings, nil
+}
@@ -0,0 +1,115 @@
+package runtimeconfig
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+type fakeParameterGetter struct {
+	value string
+	err   error
+	calls int
+}
+
+func (f *fakeParameterGetter) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ssm.GetParameterOutput{Parameter: &types.Parameter{Value: aws.String(f.value)}}, nil
+}
+
+var testConfig = appconfig.Config{
+	GoLog:                      slog.LevelInfo,
+	OpsNotificationChannelName: "ops",
+	RuntimeConfigParameterName: "/belldog/runtime",
+	RuntimeConfigTTL:           time.Minute,
+}
+
+func newTestStore(getter *fakeParameterGetter, now *time.Time) (*Store, *slog.LevelVar) {
+	logLevel := new(slog.LevelVar)
+	s := NewStore(testConfig, getter, logLevel)
+	s.now = func() time.Time { return *now }
+	return s, logLevel
+}
+
+func TestSettings(t *testing.T) {
+	getter := &fakeParameterGetter{value: `{"go_log": "debug", "maintenance_mode": true}`}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, logLevel := newTestStore(getter, &now)
+
+	got := s.Settings(context.Background())
+
+	assert.Equal(t, Settings{GoLog: slog.LevelDebug, MaintenanceMode: true, OpsNotificationChannelName: "ops"}, got)
+	assert.Equal(t, slog.LevelDebug, logLevel.Level())
+}
+
+func TestSettingsCached(t *testing.T) {
+	getter := &fakeParameterGetter{value: `{"maintenance_mode": true}`}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, _ := newTestStore(getter, &now)
+	ctx := context.Background()
+
+	require.True(t, s.Settings(ctx).MaintenanceMode)
+	getter.value = `{"maintenance_mode": false}`
+	assert.True(t, s.Settings(ctx).MaintenanceMode)
+	assert.Equal(t, 1, getter.calls)
+
+	now = now.Add(time.Minute)
+	assert.False(t, s.Settings(ctx).MaintenanceMode)
+	assert.Equal(t, 2, getter.calls)
+}
+
+func TestSettingsKeepsCurrentOnFailure(t *testing.T) {
+	getter := &fakeParameterGetter{value: `{"ops_notification_channel_name": "ops-alerts"}`}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, _ := newTestStore(getter, &now)
+	ctx := context.Background()
+	require.Equal(t, "ops-alerts", s.Settings(ctx).OpsNotificationChannelName)
+
+	now = now.Add(time.Minute)
+	getter.err = errors.New("throttled")
+	assert.Equal(t, "ops-alerts", s.Settings(ctx).OpsNotificationChannelName)
+
+	now = now.Add(time.Minute)
+	getter.err = nil
+	getter.value = `{"ops_channel": "typo"}`
+	assert.Equal(t, "ops-alerts", s.Settings(ctx).OpsNotificationChannelName)
+}
+
+func TestSettingsWithoutParameter(t *testing.T) {
+	getter := &fakeParameterGetter{}
+	cfg := testConfig
+	cfg.RuntimeConfigParameterName = ""
+	s := NewStore(cfg, getter, nil)
+
+	assert.Equal(t, FromConfig(cfg), s.Settings(context.Background()))
+	assert.Equal(t, 0, getter.calls)
+}
+
+func TestParseRejectsEmptyOpsChannel(t *testing.T) {
+	_, err := parse(FromConfig(testConfig), `{"ops_notification_channel_name": ""}`)
+	assert.Error(t, err)
+}
+
+func TestParseRegionRole(t *testing.T) {
+	got, err := parse(FromConfig(testConfig), `{"region_role": "passive"}`)
+	require.NoError(t, err)
+	assert.True(t, got.Passive())
+
+	_, err = parse(FromConfig(testConfig), `{"region_role": "standby"}`)
+	assert.Error(t, err)
+	_, err = parse(FromConfig(testConfig), `{"region_role": ""}`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,123 @@
+// Package s3object reads and writes S3 objects, e.g. to store exported records.
+package s3object
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/cockroachdb/errors"
+)
+
+// Location is an object location given as `s3://bucket/key`.
+type Location struct {
+	Bucket string
+	Key    string
+}
+
+// ParseLocation returns false when the string is not an S3 URI, e.g. a file path.
+func ParseLocation(s string) (Location, bool) {
+	rest, ok := strings.CutPrefix(s, "s3://")
+	if !ok {
+		return Location{}, false
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return Location{}, false
+	}
+	return Location{Bucket: bucket, Key: key}, true
+}
+
+func (l Location) String() string {
+	return "s3://" + l.Bucket + "/" + l.Key
+}
+
+// Client calls GetObject and PutObject APIs of S3. Like secretenv.Client, the APIs are called directly with SigV4
+// signed requests because only two APIs are needed. Objects are read and written whole in memory.
+type Client struct {
+	cfg    aws.Config
+	signer *v4.Signer
+}
+
+func NewClient(cfg aws.Config) *Client {
+	// S3 signs the URI path as is, unlike other services.
+	signer := v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true })
+	return &Client{cfg: cfg, signer: signer}
+}
+
+// GetObject returns the body of the object.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObject.html
+func (c *Client) GetObject(ctx context.Context, loc Location) ([]byte, error) {
+	body, err := c.do(ctx, http.MethodGet, loc, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetObject failed: %s", loc)
+	}
+	return body, nil
+}
+
+// PutObject creates or overwrites the object.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObject.html
+func (c *Client) PutObject(ctx context.Context, loc Location, body []byte) error {
+	if _, err := c.do(ctx, http.MethodPut, loc, body); err != nil {
+		return errors.Wrapf(err, "PutObject failed: %s", loc)
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method string, loc Location, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.objectURL(loc), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve AWS credentials")
+	}
+	if err := c.signer.SignHTTP(ctx, creds, req, payloadHash, "s3", c.cfg.Region, time.Now()); err != nil {
+		return nil, errors.Wrap(err, "failed to sign request")
+	}
+
+	var httpClient aws.HTTPClient = http.DefaultClient
+	if c.cfg.HTTPClient != nil {
+		httpClient = c.cfg.HTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call S3")
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Newf("status=%d, body=%s", resp.StatusCode, respBody)
+	}
+	return respBody, nil
+}
+
+// objectURL uses path-style URLs, which work with bucket names including dots and with S3 compatible endpoints.
+func (c *Client) objectURL(loc Location) string {
+	endpoint := fmt.Sprintf("https://s3.%s.amazonaws.com", c.cfg.Region)
+	if c.cfg.BaseEndpoint != nil {
+		endpoint = strings.TrimSuffix(*c.cfg.BaseEndpoint, "/")
+	}
+	segments := strings.Split(loc.Key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return endpoint + "/" + url.PathEscape(loc.Bucket) + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,67 @@
+package s3object
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLocation(t *testing.T) {
+	loc, ok := ParseLocation("s3://bucket/path/to/records.jsonl")
+	require.True(t, ok)
+	assert.Equal(t, Location{Bucket: "bucket", Key: "path/to/records.jsonl"}, loc)
+	assert.Equal(t, "s3://bucket/path/to/records.jsonl", loc.String())
+
+	for _, s := range []string{"records.jsonl", "s3://bucket", "s3://bucket/", "s3:///key"} {
+		_, ok := ParseLocation(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestClientPutGetObject(t *testing.T) {
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Authorization"), "/s3/aws4_request")
+		assert.NotEmpty(t, r.Header.Get("X-Amz-Content-Sha256"))
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+				return
+			}
+			_, _ = w.Write(body)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := aws.Config{
+		Region:       "ap-northeast-1",
+		BaseEndpoint: aws.String(srv.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+	client := NewClient(cfg)
+	ctx := context.Background()
+	loc := Location{Bucket: "bucket", Key: "backup/records.jsonl"}
+
+	require.NoError(t, client.PutObject(ctx, loc, []byte("{}\n")))
+	assert.Contains(t, objects, "/bucket/backup/records.jsonl")
+	got, err := client.GetObject(ctx, loc)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("{}\n"), got)
+
+	_, err = client.GetObject(ctx, Location{Bucket: "bucket", Key: "missing"})
+	require.ErrorContains(t, err, "NoSuchKey")
+}
@@ -0,0 +1,97 @@
+// Package secret has types of secrets which can't be logged or formatted by accident. Formatting them with fmt
+// or slog gives the masked value, and the value is only available through Reveal.
+package secret
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	randomStringLen = 16
+	// Tokens are formatted as `bd_<prefix>_<secret>`. The prefix is not a secret and identifies the token in
+	// logs and messages.
+	tokenLabel     = "bd"
+	tokenPrefixLen = 2
+)
+
+// Token is a webhook token. String, GoString, LogValue and MarshalText give the prefix of the token, so JSON
+// encoding masks it too. Use Reveal for fields of responses having the token.
+type Token string
+
+// GenerateToken returns a new random token.
+func GenerateToken() (Token, error) {
+	k := make([]byte, tokenPrefixLen+randomStringLen)
+	if _, err := rand.Read(k); err != nil {
+		return "", errors.Wrap(err, "failed to generate random string")
+	}
+	return Token(fmt.Sprintf("%s_%x_%x", tokenLabel, k[:tokenPrefixLen], k[tokenPrefixLen:])), nil
+}
+
+// Reveal returns the token to save, compare or show it to the owner. Never log the returned value.
+func (t Token) Reveal() string {
+	return string(t)
+}
+
+// Prefix returns the non-secret prefix of the token, e.g. `bd_ab12` of `bd_ab12_<secret>`, to reference the
+// token without exposing it. Tokens generated before prefixes were introduced are referenced by their first
+// characters, e.g. `0123...`.
+func (t Token) Prefix() string {
+	token := string(t)
+	if label, rest, ok := strings.Cut(token, "_"); ok && label == tokenLabel {
+		if prefix, _, ok := strings.Cut(rest, "_"); ok {
+			return tokenLabel + "_" + prefix
+		}
+	}
+	const legacyPrefixLen = tokenPrefixLen * 2
+	// Don't reveal most of short strings, e.g. mistyped tokens.
+	if len(token) < legacyPrefixLen*4 {
+		return "..."
+	}
+	return token[:legacyPrefixLen] + "..."
+}
+
+func (t Token) String() string {
+	return t.Prefix()
+}
+
+func (t Token) GoString() string {
+	return fmt.Sprintf("secret.Token(%q)", t.Prefix())
+}
+
+func (t Token) LogValue() slog.Value {
+	return slog.StringValue(t.Prefix())
+}
+
+func (t Token) MarshalText() ([]byte, error) {
+	return []byte(t.Prefix()), nil
+}
+
+// MaskTokens replaces tokens in the text, e.g. slash command text, with their prefixes for logging. Any word
+// looking like a token is masked because the text is not parsed yet.
+func MaskTokens(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		if isTokenLike(word) {
+			words[i] = Token(word).Prefix()
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func isTokenLike(word string) bool {
+	if strings.HasPrefix(word, tokenLabel+"_") {
+		return true
+	}
+	// Legacy tokens are hex encoded random bytes.
+	if len(word) != randomStringLen*2 {
+		return false
+	}
+	_, err := hex.DecodeString(word)
+	return err == nil
+}
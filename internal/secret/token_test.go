@@ -0,0 +1,50 @@
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, err := GenerateToken()
+	require.NoError(t, err)
+	assert.Len(t, token.Reveal(), len("bd_ab12_0123456789abcdef0123456789abcdef"))
+	assert.True(t, strings.HasPrefix(token.Reveal(), token.Prefix()+"_"))
+	assert.True(t, isTokenLike(token.Reveal()))
+}
+
+func TestTokenPrefix(t *testing.T) {
+	cases := map[string]string{
+		"bd_ab12_0123456789abcdef0123456789abcdef": "bd_ab12",
+		"0123456789abcdef0123456789abcdef":         "0123...",
+		"deadbeef":                                 "...",
+	}
+	for token, expected := range cases {
+		assert.Equal(t, expected, Token(token).Prefix(), token)
+	}
+}
+
+func TestTokenIsMasked(t *testing.T) {
+	token := Token("bd_ab12_0123456789abcdef0123456789abcdef")
+	for _, format := range []string{"%s", "%v", "%+v", "%#v", "%q", "%x"} {
+		assert.NotContains(t, fmt.Sprintf(format, token), "0123456789abcdef", format)
+	}
+	assert.NotContains(t, fmt.Sprintf("%+v", struct{ Token Token }{token}), "0123456789abcdef")
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.Info("token", slog.Any("token", token), slog.Any("nested", map[string]any{"token": token}))
+	assert.NotContains(t, buf.String(), "0123456789abcdef")
+	assert.Contains(t, buf.String(), `"token":"bd_ab12"`)
+}
+
+func TestMaskTokens(t *testing.T) {
+	actual := MaskTokens("old-channel bd_ab12_0123456789abcdef0123456789abcdef 0123456789abcdef0123456789abcdef --public")
+	assert.Equal(t, "old-channel bd_ab12 0123... --public", actual)
+}
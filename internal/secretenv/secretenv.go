@@ -0,0 +1,149 @@
+// Package secretenv resolves environment variable values referring to AWS Secrets Manager secrets, like
+// ssmenv-go does for SSM Parameter Store.
+package secretenv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/cockroachdb/errors"
+)
+
+// Values having this prefix are resolved: `secretsmanager://<secret name or ARN>` for the whole secret string,
+// `secretsmanager://<secret name or ARN>#<key>` for a key of the JSON secret.
+const prefix = "secretsmanager://"
+
+type secretGetter interface {
+	GetSecretValue(ctx context.Context, secretID string) (string, error)
+}
+
+// ReplacedEnv returns a copy of env having referring values replaced with the secret values. Each secret is
+// fetched once even when referred from multiple variables.
+func ReplacedEnv(ctx context.Context, client secretGetter, env map[string]string) (map[string]string, error) {
+	ret := make(map[string]string, len(env))
+	secrets := map[string]string{}
+	for name, value := range env {
+		ref, ok := strings.CutPrefix(value, prefix)
+		if !ok {
+			ret[name] = value
+			continue
+		}
+		secretID, key, hasKey := strings.Cut(ref, "#")
+		secret, ok := secrets[secretID]
+		if !ok {
+			s, err := client.GetSecretValue(ctx, secretID)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get secret for %s", name)
+			}
+			secrets[secretID] = s
+			secret = s
+		}
+		if !hasKey {
+			ret[name] = secret
+			continue
+		}
+		v, err := lookupJSONKey(secret, key)
+		if err != nil {
+			// Don't include the secret value in the error.
+			return nil, errors.Wrapf(err, "failed to resolve %s: secret_id=%s, key=%s", name, secretID, key)
+		}
+		ret[name] = v
+	}
+	return ret, nil
+}
+
+func lookupJSONKey(secret string, key string) (string, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &m); err != nil {
+		return "", errors.New("secret string is not a JSON object")
+	}
+	v, ok := m[key]
+	if !ok {
+		return "", errors.New("key not found in secret")
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.New("value of the key is not a string")
+	}
+	return s, nil
+}
+
+// Client calls GetSecretValue API of Secrets Manager. The API is called directly with SigV4 signed requests
+// because only a single API is needed.
+type Client struct {
+	cfg    aws.Config
+	signer *v4.Signer
+}
+
+func NewClient(cfg aws.Config) *Client {
+	return &Client{cfg: cfg, signer: v4.NewSigner()}
+}
+
+// GetSecretValue returns SecretString of the current version. Binary secrets are not supported.
+// https://docs.aws.amazon.com/secretsmanager/latest/apireference/API_GetSecretValue.html
+func (c *Client) GetSecretValue(ctx context.Context, secretID string) (string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to retrieve AWS credentials")
+	}
+	sum := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "secretsmanager", c.cfg.Region, time.Now()); err != nil {
+		return "", errors.Wrap(err, "failed to sign request")
+	}
+
+	var httpClient aws.HTTPClient = http.DefaultClient
+	if c.cfg.HTTPClient != nil {
+		httpClient = c.cfg.HTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to call GetSecretValue")
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Newf("GetSecretValue failed: secret_id=%s, status=%d, body=%s", secretID, resp.StatusCode, respBody)
+	}
+
+	var out struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return "", errors.Wrap(err, "failed to unmarshal GetSecretValue response")
+	}
+	if out.SecretString == nil {
+		return "", errors.Newf("secret has no SecretString, binary secrets are not supported: secret_id=%s", secretID)
+	}
+	return *out.SecretString, nil
+}
+
+func (c *Client) endpoint() string {
+	if c.cfg.BaseEndpoint != nil {
+		return *c.cfg.BaseEndpoint
+	}
+	return fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", c.cfg.Region)
+}
@@ -0,0 +1,83 @@
+package secretenv
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeGetter struct {
+	secrets map[string]string
+	calls   int
+}
+
+func (f *fakeGetter) GetSecretValue(ctx context.Context, secretID string) (string, error) {
+	f.calls++
+	return f.secrets[secretID], nil
+}
+
+func TestReplacedEnv(t *testing.T) {
+	getter := &fakeGetter{secrets: map[string]string{
+		"belldog/slack": `{"token":"xoxb-test","signing_secret":"deadbeef"}`,
+		"plain":         "plain-secret",
+	}}
+	env := map[string]string{
+		"SLACK_TOKEN":          "secretsmanager://belldog/slack#token",
+		"SLACK_SIGNING_SECRET": "secretsmanager://belldog/slack#signing_secret",
+		"OTHER_SECRET":         "secretsmanager://plain",
+		"MODE":                 "lambda",
+	}
+
+	got, err := ReplacedEnv(context.Background(), getter, env)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"SLACK_TOKEN":          "xoxb-test",
+		"SLACK_SIGNING_SECRET": "deadbeef",
+		"OTHER_SECRET":         "plain-secret",
+		"MODE":                 "lambda",
+	}, got)
+	assert.Equal(t, 2, getter.calls)
+}
+
+func TestReplacedEnvMissingKey(t *testing.T) {
+	getter := &fakeGetter{secrets: map[string]string{"belldog/slack": `{"token":"xoxb-test"}`}}
+	env := map[string]string{"SLACK_SIGNING_SECRET": "secretsmanager://belldog/slack#signing_secret"}
+
+	_, err := ReplacedEnv(context.Background(), getter, env)
+
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "xoxb-test")
+}
+
+func TestClientGetSecretValue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/secretsmanager/aws4_request")
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]string
+		require.NoError(t, json.Unmarshal(body, &req))
+		assert.Equal(t, "belldog/slack", req["SecretId"])
+		_, _ = w.Write([]byte(`{"Name":"belldog/slack","SecretString":"xoxb-test"}`))
+	}))
+	defer srv.Close()
+
+	cfg := aws.Config{
+		Region:       "ap-northeast-1",
+		BaseEndpoint: aws.String(srv.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+	got, err := NewClient(cfg).GetSecretValue(context.Background(), "belldog/slack")
+
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-test", got)
+}
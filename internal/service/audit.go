@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+type AuditEntry struct {
+	ChannelID   string
+	ChannelName string
+	UserID      string
+	UserName    string
+	Command     string
+	Result      string
+	// Prefix of the operated token. Empty for operations not operating a single token.
+	TokenPrefix string
+	Timestamp   time.Time
+}
+
+// AuditService records token lifecycle operations. When the underlying storage is nil, auditing is
+// disabled and Record does nothing.
+type AuditService struct {
+	ddb auditDDB
+}
+
+func NewAuditService(ddb auditDDB) AuditService {
+	return AuditService{ddb: ddb}
+}
+
+func (a *AuditService) Enabled() bool {
+	return a.ddb != nil
+}
+
+// Record saves the given entry with the current timestamp.
+func (a *AuditService) Record(ctx context.Context, entry AuditEntry) error {
+	if !a.Enabled() {
+		return nil
+	}
+	rec := storage.AuditRecord{
+		ChannelID:   entry.ChannelID,
+		Timestamp:   currentTimestamp(),
+		ChannelName: entry.ChannelName,
+		UserID:      entry.UserID,
+		UserName:    entry.UserName,
+		Command:     entry.Command,
+		Result:      entry.Result,
+		TokenPrefix: entry.TokenPrefix,
+	}
+	return a.ddb.SaveAuditRecord(ctx, rec)
+}
+
+const recentAuditEntryCount = 20
+
+// GetRecentEntries returns recent entries for the channel, newest first.
+func (a *AuditService) GetRecentEntries(ctx context.Context, channelID string) ([]AuditEntry, error) {
+	if !a.Enabled() {
+		return []AuditEntry{}, nil
+	}
+	recs, err := a.ddb.QueryAuditRecordsByChannelID(ctx, channelID, recentAuditEntryCount)
+	if err != nil {
+		return []AuditEntry{}, err
+	}
+	entries := make([]AuditEntry, 0, len(recs))
+	for _, rec := range recs {
+		t, err := time.Parse(time.RFC3339Nano, rec.Timestamp)
+		if err != nil {
+			return []AuditEntry{}, errors.Wrapf(err, "failed to parse timestamp: %s", rec.Timestamp)
+		}
+		entries = append(entries, AuditEntry{
+			ChannelID:   rec.ChannelID,
+			ChannelName: rec.ChannelName,
+			UserID:      rec.UserID,
+			UserName:    rec.UserName,
+			Command:     rec.Command,
+			Result:      rec.Result,
+			TokenPrefix: rec.TokenPrefix,
+			Timestamp:   t,
+		})
+	}
+	return entries, nil
+}
+
+type auditDDB interface {
+	SaveAuditRecord(ctx context.Context, rec storage.AuditRecord) error
+	// QueryAuditRecordsByChannelID returns recent records first.
+	QueryAuditRecordsByChannelID(ctx context.Context, channelID string, limit int32) ([]storage.AuditRecord, error)
+}
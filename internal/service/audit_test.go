@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+type testAuditStorage struct {
+	recs []storage.AuditRecord
+}
+
+func (t *testAuditStorage) SaveAuditRecord(ctx context.Context, rec storage.AuditRecord) error {
+	t.recs = append(t.recs, rec)
+	return nil
+}
+
+func (t *testAuditStorage) QueryAuditRecordsByChannelID(ctx context.Context, channelID string, limit int32) ([]storage.AuditRecord, error) {
+	ret := []storage.AuditRecord{}
+	for i := len(t.recs) - 1; i >= 0 && len(ret) < int(limit); i-- {
+		if t.recs[i].ChannelID == channelID {
+			ret = append(ret, t.recs[i])
+		}
+	}
+	return ret, nil
+}
+
+func TestAuditRecord(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testAuditStorage{}
+	svc := NewAuditService(&stg)
+
+	entry := AuditEntry{ChannelID: channelID, ChannelName: channelName, UserID: "U123", UserName: "alice", Command: "/belldog-generate", Result: "generated"}
+	if err := svc.Record(ctx, entry); err != nil {
+		t.Fatalf("Record failed: %s", err)
+	}
+	if err := svc.Record(ctx, AuditEntry{ChannelID: "C999", Command: "/belldog-revoke", Result: "revoked"}); err != nil {
+		t.Fatalf("Record failed: %s", err)
+	}
+
+	entries, err := svc.GetRecentEntries(ctx, channelID)
+	if err != nil {
+		t.Fatalf("GetRecentEntries failed: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Unexpected entry count: %v", entries)
+	}
+	got := entries[0]
+	if got.UserID != entry.UserID || got.Command != entry.Command || got.Result != entry.Result {
+		t.Fatalf("Returned entry doesn't match to recorded entry: returned=%v, recorded=%v", got, entry)
+	}
+	if got.Timestamp.IsZero() {
+		t.Fatal("Timestamp must be set")
+	}
+}
+
+func TestAuditDisabled(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svc := NewAuditService(nil)
+
+	if svc.Enabled() {
+		t.Fatal("AuditService without storage must be disabled")
+	}
+	if err := svc.Record(ctx, AuditEntry{ChannelID: channelID}); err != nil {
+		t.Fatalf("Record must be no-op when disabled: %s", err)
+	}
+	entries, err := svc.GetRecentEntries(ctx, channelID)
+	if err != nil {
+		t.Fatalf("GetRecentEntries failed: %s", err)
+	}
+	if len(entries) != 0 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"log/slog"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// Group names are used in URLs.
+var groupNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,80}$`)
+
+// Posting to a group calls Slack API for each member in a request, so keep groups small.
+const maxBroadcastMembers = 20
+
+type BroadcastGroup struct {
+	Name      string
+	Token     secret.Token
+	Members   []BroadcastMember
+	CreatedAt time.Time
+	// Slack user ID who created the group.
+	CreatedBy string
+}
+
+type BroadcastMember struct {
+	ChannelID   string
+	ChannelName string
+}
+
+// BroadcastService manages broadcast groups, which fan out webhook messages to member channels. When the
+// underlying storage is nil, the feature is disabled.
+type BroadcastService struct {
+	ddb broadcastDDB
+}
+
+func NewBroadcastService(ddb broadcastDDB) BroadcastService {
+	return BroadcastService{ddb: ddb}
+}
+
+func (s *BroadcastService) Enabled() bool {
+	return s.ddb != nil
+}
+
+// CreateGroup creates an empty group with a new token. Returns ErrInvalidGroupName or ErrGroupAlreadyExists.
+func (s *BroadcastService) CreateGroup(ctx context.Context, groupName string, userID string) (BroadcastGroup, error) {
+	if !s.Enabled() {
+		return BroadcastGroup{}, errors.New("broadcast is not enabled")
+	}
+	if !groupNamePattern.MatchString(groupName) {
+		return BroadcastGroup{}, ErrInvalidGroupName
+	}
+	gen := generatorImpl{}
+	token, err := gen.generate()
+	if err != nil {
+		return BroadcastGroup{}, err
+	}
+	rec := storage.BroadcastGroupRecord{
+		GroupName: groupName,
+		Token:     token.Reveal(),
+		Members:   []storage.BroadcastMember{},
+		CreatedAt: currentTimestamp(),
+		CreatedBy: userID,
+	}
+	if err := s.ddb.CreateBroadcastGroup(ctx, rec); err != nil {
+		if errors.Is(err, storage.ErrRecordAlreadyExists) {
+			return BroadcastGroup{}, ErrGroupAlreadyExists
+		}
+		return BroadcastGroup{}, err
+	}
+	return recordToGroup(rec)
+}
+
+// GetGroup returns ErrGroupNotFound when no group has the name.
+func (s *BroadcastService) GetGroup(ctx context.Context, groupName string) (BroadcastGroup, error) {
+	rec, err := s.get(ctx, groupName)
+	if err != nil {
+		return BroadcastGroup{}, err
+	}
+	return recordToGroup(rec)
+}
+
+// VerifyGroupToken returns ErrTokenNotFound when no group has the name, ErrTokenUnmatch when the token doesn't
+// match, same as TokenService.VerifyToken.
+func (s *BroadcastService) VerifyGroupToken(ctx context.Context, groupName string, givenToken secret.Token) (BroadcastGroup, error) {
+	group, err := s.GetGroup(ctx, groupName)
+	if errors.Is(err, ErrGroupNotFound) {
+		return BroadcastGroup{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return BroadcastGroup{}, err
+	}
+	if !hmac.Equal([]byte(group.Token.Reveal()), []byte(givenToken.Reveal())) {
+		return BroadcastGroup{}, ErrTokenUnmatch
+	}
+	return group, nil
+}
+
+// AddMember adds the channel to the group and returns the updated group. Adding a member channel again updates
+// its channel name. Returns ErrGroupNotFound or ErrTooManyMembers.
+func (s *BroadcastService) AddMember(ctx context.Context, groupName string, channelID string, channelName string) (BroadcastGroup, error) {
+	return s.updateMembers(ctx, groupName, func(members []storage.BroadcastMember) ([]storage.BroadcastMember, error) {
+		member := storage.BroadcastMember{ChannelID: channelID, ChannelName: channelName}
+		i := slices.IndexFunc(members, func(m storage.BroadcastMember) bool { return m.ChannelID == channelID })
+		switch {
+		case i >= 0:
+			members[i] = member
+		case len(members) >= maxBroadcastMembers:
+			return nil, ErrTooManyMembers
+		default:
+			members = append(members, member)
+		}
+		return members, nil
+	})
+}
+
+// RemoveMember removes the channel from the group and returns the updated group. Returns ErrGroupNotFound.
+func (s *BroadcastService) RemoveMember(ctx context.Context, groupName string, channelID string) (BroadcastGroup, error) {
+	return s.updateMembers(ctx, groupName, func(members []storage.BroadcastMember) ([]storage.BroadcastMember, error) {
+		return slices.DeleteFunc(members, func(m storage.BroadcastMember) bool { return m.ChannelID == channelID }), nil
+	})
+}
+
+// updateMembers saves the members returned by update. When another request updates or deletes the group
+// concurrently, this reads the group again and retries, so the group deleted concurrently isn't saved again.
+func (s *BroadcastService) updateMembers(ctx context.Context, groupName string, update func([]storage.BroadcastMember) ([]storage.BroadcastMember, error)) (BroadcastGroup, error) {
+	for i := 0; i < maxSaveAttempts; i++ {
+		rec, err := s.get(ctx, groupName)
+		if err != nil {
+			return BroadcastGroup{}, err
+		}
+		rec.Members, err = update(rec.Members)
+		if err != nil {
+			return BroadcastGroup{}, err
+		}
+		if err := s.ddb.SaveBroadcastGroup(ctx, rec); err != nil {
+			if errors.Is(err, storage.ErrRecordConflict) {
+				slog.InfoContext(ctx, "broadcast group saved concurrently, retrying", slog.String("group_name", groupName), slog.Int("attempt", i+1))
+				continue
+			}
+			return BroadcastGroup{}, err
+		}
+		return recordToGroup(rec)
+	}
+	return BroadcastGroup{}, errors.Newf("failed to save broadcast group due to conflicts: group_name=%s, attempts=%d", groupName, maxSaveAttempts)
+}
+
+// DeleteGroup deletes the group, the group URL stops working. Returns ErrGroupNotFound.
+func (s *BroadcastService) DeleteGroup(ctx context.Context, groupName string) error {
+	if _, err := s.get(ctx, groupName); err != nil {
+		return err
+	}
+	return s.ddb.DeleteBroadcastGroup(ctx, groupName)
+}
+
+func (s *BroadcastService) get(ctx context.Context, groupName string) (storage.BroadcastGroupRecord, error) {
+	if !s.Enabled() {
+		return storage.BroadcastGroupRecord{}, errors.New("broadcast is not enabled")
+	}
+	rec, found, err := s.ddb.GetBroadcastGroup(ctx, groupName)
+	if err != nil {
+		return storage.BroadcastGroupRecord{}, err
+	}
+	if !found {
+		return storage.BroadcastGroupRecord{}, ErrGroupNotFound
+	}
+	return rec, nil
+}
+
+func recordToGroup(rec storage.BroadcastGroupRecord) (BroadcastGroup, error) {
+	t, err := time.Parse(time.RFC3339Nano, rec.CreatedAt)
+	if err != nil {
+		return BroadcastGroup{}, errors.Wrapf(err, "failed to parse created_at: %s", rec.CreatedAt)
+	}
+	members := make([]BroadcastMember, 0, len(rec.Members))
+	for _, m := range rec.Members {
+		members = append(members, BroadcastMember{ChannelID: m.ChannelID, ChannelName: m.ChannelName})
+	}
+	return BroadcastGroup{
+		Name:      rec.GroupName,
+		Token:     secret.Token(rec.Token),
+		Members:   members,
+		CreatedAt: t,
+		CreatedBy: rec.CreatedBy,
+	}, nil
+}
+
+type broadcastDDB interface {
+	// GetBroadcastGroup returns found=false when no group has the name.
+	GetBroadcastGroup(ctx context.Context, groupName string) (storage.BroadcastGroupRecord, bool, error)
+	// CreateBroadcastGroup returns storage.ErrRecordAlreadyExists when the group exists.
+	CreateBroadcastGroup(ctx context.Context, rec storage.BroadcastGroupRecord) error
+	// SaveBroadcastGroup returns storage.ErrRecordConflict when the group is deleted or saved after reading.
+	SaveBroadcastGroup(ctx context.Context, rec storage.BroadcastGroupRecord) error
+	DeleteBroadcastGroup(ctx context.Context, groupName string) error
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+type testBroadcastStorage struct {
+	recs map[string]storage.BroadcastGroupRecord
+	// Called before saving, to simulate concurrent updates.
+	beforeSave func()
+}
+
+func (t *testBroadcastStorage) GetBroadcastGroup(ctx context.Context, groupName string) (storage.BroadcastGroupRecord, bool, error) {
+	rec, ok := t.recs[groupName]
+	return rec, ok, nil
+}
+
+func (t *testBroadcastStorage) CreateBroadcastGroup(ctx context.Context, rec storage.BroadcastGroupRecord) error {
+	if _, ok := t.recs[rec.GroupName]; ok {
+		return storage.ErrRecordAlreadyExists
+	}
+	t.recs[rec.GroupName] = rec
+	return nil
+}
+
+func (t *testBroadcastStorage) SaveBroadcastGroup(ctx context.Context, rec storage.BroadcastGroupRecord) error {
+	if t.beforeSave != nil {
+		t.beforeSave()
+		t.beforeSave = nil
+	}
+	current, ok := t.recs[rec.GroupName]
+	if !ok || current.Revision != rec.Revision {
+		return storage.ErrRecordConflict
+	}
+	rec.Revision++
+	t.recs[rec.GroupName] = rec
+	return nil
+}
+
+func (t *testBroadcastStorage) DeleteBroadcastGroup(ctx context.Context, groupName string) error {
+	delete(t.recs, groupName)
+	return nil
+}
+
+func TestBroadcastGroupLifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testBroadcastStorage{recs: map[string]storage.BroadcastGroupRecord{}}
+	svc := NewBroadcastService(&stg)
+
+	group, err := svc.CreateGroup(ctx, "deploys", "U123")
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %s", err)
+	}
+	if _, err := svc.CreateGroup(ctx, "deploys", "U123"); !errors.Is(err, ErrGroupAlreadyExists) {
+		t.Fatalf("Existing group must not be overwritten: %v", err)
+	}
+	if _, err := svc.CreateGroup(ctx, "Deploys/prod", "U123"); !errors.Is(err, ErrInvalidGroupName) {
+		t.Fatalf("Invalid group name must be rejected: %v", err)
+	}
+
+	if _, err := svc.AddMember(ctx, "deploys", channelID, channelName); err != nil {
+		t.Fatalf("AddMember failed: %s", err)
+	}
+	updated, err := svc.AddMember(ctx, "deploys", "C999", "other")
+	if err != nil {
+		t.Fatalf("AddMember failed: %s", err)
+	}
+	if len(updated.Members) != 2 {
+		t.Fatalf("Unexpected members: %+v", updated.Members)
+	}
+	if _, err := svc.AddMember(ctx, "unknown", channelID, channelName); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("Unknown group must be rejected: %v", err)
+	}
+
+	verified, err := svc.VerifyGroupToken(ctx, "deploys", group.Token)
+	if err != nil {
+		t.Fatalf("VerifyGroupToken failed: %s", err)
+	}
+	if len(verified.Members) != 2 {
+		t.Fatalf("Unexpected members: %+v", verified.Members)
+	}
+	if _, err := svc.VerifyGroupToken(ctx, "deploys", "invalid"); !errors.Is(err, ErrTokenUnmatch) {
+		t.Fatalf("Invalid token must be rejected: %v", err)
+	}
+
+	removed, err := svc.RemoveMember(ctx, "deploys", channelID)
+	if err != nil {
+		t.Fatalf("RemoveMember failed: %s", err)
+	}
+	if len(removed.Members) != 1 || removed.Members[0].ChannelID != "C999" {
+		t.Fatalf("Unexpected members: %+v", removed.Members)
+	}
+
+	if err := svc.DeleteGroup(ctx, "deploys"); err != nil {
+		t.Fatalf("DeleteGroup failed: %s", err)
+	}
+	if _, err := svc.VerifyGroupToken(ctx, "deploys", group.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Deleted group must not be verified: %v", err)
+	}
+}
+
+func TestBroadcastTooManyMembers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	members := make([]storage.BroadcastMember, maxBroadcastMembers)
+	stg := testBroadcastStorage{recs: map[string]storage.BroadcastGroupRecord{
+		"full": {GroupName: "full", Members: members, CreatedAt: currentTimestamp()},
+	}}
+	svc := NewBroadcastService(&stg)
+
+	if _, err := svc.AddMember(ctx, "full", channelID, channelName); !errors.Is(err, ErrTooManyMembers) {
+		t.Fatalf("Too many members must be rejected: %v", err)
+	}
+}
+
+func TestBroadcastConcurrentUpdates(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testBroadcastStorage{recs: map[string]storage.BroadcastGroupRecord{
+		"deploys": {GroupName: "deploys", Members: []storage.BroadcastMember{}, CreatedAt: currentTimestamp()},
+	}}
+	svc := NewBroadcastService(&stg)
+
+	// Another channel is added after reading the group, so the first save conflicts and is retried.
+	stg.beforeSave = func() {
+		rec := stg.recs["deploys"]
+		rec.Members = append(rec.Members, storage.BroadcastMember{ChannelID: "C999", ChannelName: "other"})
+		rec.Revision++
+		stg.recs["deploys"] = rec
+	}
+	group, err := svc.AddMember(ctx, "deploys", channelID, channelName)
+	if err != nil {
+		t.Fatalf("AddMember failed: %s", err)
+	}
+	if len(group.Members) != 2 || len(stg.recs["deploys"].Members) != 2 {
+		t.Fatalf("Concurrently added member must not be lost: %+v", stg.recs["deploys"].Members)
+	}
+
+	// The group is deleted after reading it, so adding a member must not save the group again.
+	stg.beforeSave = func() { delete(stg.recs, "deploys") }
+	if _, err := svc.AddMember(ctx, "deploys", "C888", "another"); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("Concurrently deleted group must not be saved again: %v", err)
+	}
+	if _, ok := stg.recs["deploys"]; ok {
+		t.Fatal("Deleted group is saved again")
+	}
+}
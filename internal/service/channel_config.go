@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// Keys of message options configurable per channel. These are the same as chat.postMessage arguments.
+const (
+	ChannelConfigKeyIconEmoji   = "icon_emoji"
+	ChannelConfigKeyUsername    = "username"
+	ChannelConfigKeyUnfurlLinks = "unfurl_links"
+	ChannelConfigKeyLinkNames   = "link_names"
+	// Not a chat.postMessage argument: messages received within the window are posted as one digest message.
+	ChannelConfigKeyDigestWindow = "digest_window"
+	// Not a chat.postMessage argument: the message template of Workflow Builder requests.
+	ChannelConfigKeyWorkflowTemplate = "workflow_template"
+	// Not chat.postMessage arguments: colors and emoji prefixes of payloads having the severity field.
+	ChannelConfigKeySeverityColors = "severity_colors"
+	ChannelConfigKeySeverityEmoji  = "severity_emoji"
+	// Not a chat.postMessage argument: webhook payloads not matching the JSON schema are rejected.
+	ChannelConfigKeyPayloadSchema = "payload_schema"
+	// Not a chat.postMessage argument: overrides MAX_TOKEN_COUNT for the channel.
+	ChannelConfigKeyMaxTokenCount = "max_token_count"
+	// Not a chat.postMessage argument: non-critical messages received within the window are scheduled to its end.
+	ChannelConfigKeyQuietHours = "quiet_hours"
+)
+
+var ChannelConfigKeys = []string{
+	ChannelConfigKeyIconEmoji,
+	ChannelConfigKeyUsername,
+	ChannelConfigKeyUnfurlLinks,
+	ChannelConfigKeyLinkNames,
+	ChannelConfigKeyDigestWindow,
+	ChannelConfigKeyWorkflowTemplate,
+	ChannelConfigKeySeverityColors,
+	ChannelConfigKeySeverityEmoji,
+	ChannelConfigKeyPayloadSchema,
+	ChannelConfigKeyMaxTokenCount,
+	ChannelConfigKeyQuietHours,
+}
+
+// Digest windows longer than this are rejected not to delay messages too long.
+const maxDigestWindow = time.Hour
+
+// Channels can't have more tokens than this, so listing and verifying tokens of a channel stay cheap.
+const maxChannelTokenCount = 10
+
+// ChannelDefaults are message options merged into webhook payloads lacking those fields.
+type ChannelDefaults struct {
+	IconEmoji   string
+	Username    string
+	UnfurlLinks *bool
+	LinkNames   *bool
+	// Zero when messages are posted immediately.
+	DigestWindow time.Duration
+	// Text having `{{variable}}` placeholders. Empty lists the variables.
+	WorkflowTemplate string
+	// Overrides of the default colors.
+	SeverityColors map[Severity]string
+	// Severities without emoji are not prefixed.
+	SeverityEmoji map[Severity]string
+	// Nil when payloads are not validated.
+	PayloadSchema *PayloadSchema
+	// Zero uses MAX_TOKEN_COUNT.
+	MaxTokenCount int
+	// Nil when messages are posted any time.
+	QuietHours *QuietHours
+}
+
+// ApplyTo sets the defaults to the payload. Fields given by the payload take precedence.
+func (d ChannelDefaults) ApplyTo(payload map[string]interface{}) {
+	setIfAbsent := func(key string, value interface{}) {
+		if _, ok := payload[key]; !ok {
+			payload[key] = value
+		}
+	}
+	if d.IconEmoji != "" {
+		setIfAbsent(ChannelConfigKeyIconEmoji, d.IconEmoji)
+	}
+	if d.Username != "" {
+		setIfAbsent(ChannelConfigKeyUsername, d.Username)
+	}
+	if d.UnfurlLinks != nil {
+		setIfAbsent(ChannelConfigKeyUnfurlLinks, *d.UnfurlLinks)
+	}
+	if d.LinkNames != nil {
+		setIfAbsent(ChannelConfigKeyLinkNames, *d.LinkNames)
+	}
+}
+
+// Values returns configured options keyed by ChannelConfigKeys.
+func (d ChannelDefaults) Values() map[string]string {
+	ret := map[string]string{}
+	if d.IconEmoji != "" {
+		ret[ChannelConfigKeyIconEmoji] = d.IconEmoji
+	}
+	if d.Username != "" {
+		ret[ChannelConfigKeyUsername] = d.Username
+	}
+	if d.UnfurlLinks != nil {
+		ret[ChannelConfigKeyUnfurlLinks] = strconv.FormatBool(*d.UnfurlLinks)
+	}
+	if d.LinkNames != nil {
+		ret[ChannelConfigKeyLinkNames] = strconv.FormatBool(*d.LinkNames)
+	}
+	if d.DigestWindow > 0 {
+		ret[ChannelConfigKeyDigestWindow] = d.DigestWindow.String()
+	}
+	if d.WorkflowTemplate != "" {
+		ret[ChannelConfigKeyWorkflowTemplate] = d.WorkflowTemplate
+	}
+	if len(d.SeverityColors) > 0 {
+		ret[ChannelConfigKeySeverityColors] = formatSeverityMap(d.SeverityColors)
+	}
+	if len(d.SeverityEmoji) > 0 {
+		ret[ChannelConfigKeySeverityEmoji] = formatSeverityMap(d.SeverityEmoji)
+	}
+	if d.PayloadSchema != nil {
+		ret[ChannelConfigKeyPayloadSchema] = d.PayloadSchema.String()
+	}
+	if d.MaxTokenCount > 0 {
+		ret[ChannelConfigKeyMaxTokenCount] = strconv.Itoa(d.MaxTokenCount)
+	}
+	if d.QuietHours != nil {
+		ret[ChannelConfigKeyQuietHours] = d.QuietHours.String()
+	}
+	return ret
+}
+
+// PauseState tells whether webhook requests to the channel are paused.
+type PauseState struct {
+	Paused bool
+	// Slack user ID who paused the channel.
+	UserID   string
+	PausedAt time.Time
+}
+
+// ChannelConfigService manages per-channel default message options and the pause state. When the underlying
+// storage is nil, the feature is disabled: GetDefaults returns empty defaults and channels are never paused.
+type ChannelConfigService struct {
+	ddb channelConfigDDB
+}
+
+func NewChannelConfigService(ddb channelConfigDDB) ChannelConfigService {
+	return ChannelConfigService{ddb: ddb}
+}
+
+func (s *ChannelConfigService) Enabled() bool {
+	return s.ddb != nil
+}
+
+func (s *ChannelConfigService) GetDefaults(ctx context.Context, channelID string) (ChannelDefaults, error) {
+	if !s.Enabled() {
+		return ChannelDefaults{}, nil
+	}
+	rec, err := s.get(ctx, channelID)
+	if err != nil {
+		return ChannelDefaults{}, err
+	}
+	return defaultsOf(rec), nil
+}
+
+// SetDefault sets the option and returns the updated defaults. Boolean options accept values strconv.ParseBool
+// accepts. Returns ErrInvalidConfigKey or ErrInvalidConfigValue for invalid input.
+func (s *ChannelConfigService) SetDefault(ctx context.Context, channelID string, key string, value string) (ChannelDefaults, error) {
+	if value == "" {
+		return ChannelDefaults{}, ErrInvalidConfigValue
+	}
+	return s.update(ctx, channelID, key, value)
+}
+
+func (s *ChannelConfigService) UnsetDefault(ctx context.Context, channelID string, key string) (ChannelDefaults, error) {
+	return s.update(ctx, channelID, key, "")
+}
+
+// Empty value unsets the option.
+func (s *ChannelConfigService) update(ctx context.Context, channelID string, key string, value string) (ChannelDefaults, error) {
+	if !s.Enabled() {
+		return ChannelDefaults{}, errors.New("channel config is not enabled")
+	}
+	rec, err := s.get(ctx, channelID)
+	if err != nil {
+		return ChannelDefaults{}, err
+	}
+
+	switch key {
+	case ChannelConfigKeyIconEmoji:
+		rec.IconEmoji = value
+	case ChannelConfigKeyUsername:
+		rec.Username = value
+	case ChannelConfigKeyUnfurlLinks:
+		b, ok := parseOptionalBool(value)
+		if !ok {
+			return ChannelDefaults{}, ErrInvalidConfigValue
+		}
+		rec.UnfurlLinks = b
+	case ChannelConfigKeyLinkNames:
+		b, ok := parseOptionalBool(value)
+		if !ok {
+			return ChannelDefaults{}, ErrInvalidConfigValue
+		}
+		rec.LinkNames = b
+	case ChannelConfigKeyDigestWindow:
+		if value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 || d > maxDigestWindow {
+				return ChannelDefaults{}, ErrInvalidConfigValue
+			}
+			value = d.String()
+		}
+		rec.DigestWindow = value
+	case ChannelConfigKeyWorkflowTemplate:
+		rec.WorkflowTemplate = value
+	case ChannelConfigKeySeverityColors:
+		m, ok := parseSeverityMap(value, severityColorPattern)
+		if !ok {
+			return ChannelDefaults{}, ErrInvalidConfigValue
+		}
+		rec.SeverityColors = formatSeverityMap(m)
+	case ChannelConfigKeySeverityEmoji:
+		m, ok := parseSeverityMap(value, severityEmojiPattern)
+		if !ok {
+			return ChannelDefaults{}, ErrInvalidConfigValue
+		}
+		rec.SeverityEmoji = formatSeverityMap(m)
+	case ChannelConfigKeyPayloadSchema:
+		if value != "" {
+			schema, err := ParsePayloadSchema(value)
+			if err != nil {
+				return ChannelDefaults{}, err
+			}
+			value = schema.String()
+		}
+		rec.PayloadSchema = value
+	case ChannelConfigKeyMaxTokenCount:
+		n := 0
+		if value != "" {
+			var err error
+			n, err = strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxChannelTokenCount {
+				return ChannelDefaults{}, ErrInvalidConfigValue
+			}
+		}
+		rec.MaxTokenCount = n
+	case ChannelConfigKeyQuietHours:
+		if value != "" {
+			q, ok := ParseQuietHours(value)
+			if !ok {
+				return ChannelDefaults{}, ErrInvalidConfigValue
+			}
+			value = q.String()
+		}
+		rec.QuietHours = value
+	default:
+		return ChannelDefaults{}, ErrInvalidConfigKey
+	}
+
+	if err := s.ddb.SaveChannelConfig(ctx, rec); err != nil {
+		return ChannelDefaults{}, err
+	}
+	return defaultsOf(rec), nil
+}
+
+func (s *ChannelConfigService) GetPauseState(ctx context.Context, channelID string) (PauseState, error) {
+	if !s.Enabled() {
+		return PauseState{}, nil
+	}
+	rec, err := s.get(ctx, channelID)
+	if err != nil {
+		return PauseState{}, err
+	}
+	return pauseStateOf(rec)
+}
+
+// Pause pauses webhook requests to the channel. Returns the state before pausing: when the channel has already
+// been paused, the state is kept as is.
+func (s *ChannelConfigService) Pause(ctx context.Context, channelID string, userID string) (PauseState, error) {
+	if !s.Enabled() {
+		return PauseState{}, errors.New("channel config is not enabled")
+	}
+	rec, err := s.get(ctx, channelID)
+	if err != nil {
+		return PauseState{}, err
+	}
+	state, err := pauseStateOf(rec)
+	if err != nil || state.Paused {
+		return state, err
+	}
+	rec.PausedAt = currentTimestamp()
+	rec.PausedBy = userID
+	if err := s.ddb.SaveChannelConfig(ctx, rec); err != nil {
+		return PauseState{}, err
+	}
+	return state, nil
+}
+
+// Resume resumes webhook requests to the channel. Returns the state before resuming.
+func (s *ChannelConfigService) Resume(ctx context.Context, channelID string) (PauseState, error) {
+	if !s.Enabled() {
+		return PauseState{}, errors.New("channel config is not enabled")
+	}
+	rec, err := s.get(ctx, channelID)
+	if err != nil {
+		return PauseState{}, err
+	}
+	state, err := pauseStateOf(rec)
+	if err != nil || !state.Paused {
+		return state, err
+	}
+	rec.PausedAt = ""
+	rec.PausedBy = ""
+	if err := s.ddb.SaveChannelConfig(ctx, rec); err != nil {
+		return PauseState{}, err
+	}
+	return state, nil
+}
+
+// get returns an empty record of the channel when no config has been saved.
+func (s *ChannelConfigService) get(ctx context.Context, channelID string) (storage.ChannelConfigRecord, error) {
+	rec, found, err := s.ddb.GetChannelConfig(ctx, channelID)
+	if err != nil {
+		return storage.ChannelConfigRecord{}, err
+	}
+	if !found {
+		return storage.ChannelConfigRecord{ChannelID: channelID}, nil
+	}
+	return rec, nil
+}
+
+func defaultsOf(rec storage.ChannelConfigRecord) ChannelDefaults {
+	// Saved values have been validated, so ignore parse errors.
+	digestWindow, _ := time.ParseDuration(rec.DigestWindow)
+	severityColors, _ := parseSeverityMap(rec.SeverityColors, severityColorPattern)
+	severityEmoji, _ := parseSeverityMap(rec.SeverityEmoji, severityEmojiPattern)
+	var payloadSchema *PayloadSchema
+	if rec.PayloadSchema != "" {
+		payloadSchema, _ = ParsePayloadSchema(rec.PayloadSchema)
+	}
+	var quietHours *QuietHours
+	if q, ok := ParseQuietHours(rec.QuietHours); ok {
+		quietHours = &q
+	}
+	return ChannelDefaults{
+		IconEmoji:        rec.IconEmoji,
+		Username:         rec.Username,
+		UnfurlLinks:      rec.UnfurlLinks,
+		LinkNames:        rec.LinkNames,
+		DigestWindow:     digestWindow,
+		WorkflowTemplate: rec.WorkflowTemplate,
+		SeverityColors:   severityColors,
+		SeverityEmoji:    severityEmoji,
+		PayloadSchema:    payloadSchema,
+		MaxTokenCount:    rec.MaxTokenCount,
+		QuietHours:       quietHours,
+	}
+}
+
+func pauseStateOf(rec storage.ChannelConfigRecord) (PauseState, error) {
+	if rec.PausedAt == "" {
+		return PauseState{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, rec.PausedAt)
+	if err != nil {
+		return PauseState{}, errors.Wrapf(err, "failed to parse paused_at: %s", rec.PausedAt)
+	}
+	return PauseState{Paused: true, UserID: rec.PausedBy, PausedAt: t}, nil
+}
+
+// Returns nil for empty value.
+func parseOptionalBool(value string) (*bool, bool) {
+	if value == "" {
+		return nil, true
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, false
+	}
+	return &b, true
+}
+
+type channelConfigDDB interface {
+	// GetChannelConfig returns found=false when no config has been saved.
+	GetChannelConfig(ctx context.Context, channelID string) (storage.ChannelConfigRecord, bool, error)
+	SaveChannelConfig(ctx context.Context, rec storage.ChannelConfigRecord) error
+}
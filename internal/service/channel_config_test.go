@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+type testChannelConfigStorage struct {
+	recs map[string]storage.ChannelConfigRecord
+}
+
+func (t *testChannelConfigStorage) GetChannelConfig(ctx context.Context, channelID string) (storage.ChannelConfigRecord, bool, error) {
+	rec, ok := t.recs[channelID]
+	return rec, ok, nil
+}
+
+func (t *testChannelConfigStorage) SaveChannelConfig(ctx context.Context, rec storage.ChannelConfigRecord) error {
+	t.recs[rec.ChannelID] = rec
+	return nil
+}
+
+func TestChannelConfigSetAndUnset(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testChannelConfigStorage{recs: map[string]storage.ChannelConfigRecord{}}
+	svc := NewChannelConfigService(&stg)
+
+	if _, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyIconEmoji, ":robot_face:"); err != nil {
+		t.Fatalf("SetDefault failed: %s", err)
+	}
+	updated, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyUnfurlLinks, "false")
+	if err != nil {
+		t.Fatalf("SetDefault failed: %s", err)
+	}
+	if updated.IconEmoji != ":robot_face:" || updated.UnfurlLinks == nil || *updated.UnfurlLinks {
+		t.Fatalf("Previous options must be kept: %+v", updated)
+	}
+
+	if _, err := svc.UnsetDefault(ctx, channelID, ChannelConfigKeyIconEmoji); err != nil {
+		t.Fatalf("UnsetDefault failed: %s", err)
+	}
+	defaults, err := svc.GetDefaults(ctx, channelID)
+	if err != nil {
+		t.Fatalf("GetDefaults failed: %s", err)
+	}
+	if defaults.IconEmoji != "" || defaults.UnfurlLinks == nil {
+		t.Fatalf("Unexpected defaults: %+v", defaults)
+	}
+}
+
+func TestChannelConfigInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testChannelConfigStorage{recs: map[string]storage.ChannelConfigRecord{}}
+	svc := NewChannelConfigService(&stg)
+
+	if _, err := svc.SetDefault(ctx, channelID, "channel", "C999"); !errors.Is(err, ErrInvalidConfigKey) {
+		t.Fatalf("Unknown key must be rejected: %v", err)
+	}
+	if _, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyLinkNames, "maybe"); !errors.Is(err, ErrInvalidConfigValue) {
+		t.Fatalf("Non boolean value must be rejected: %v", err)
+	}
+	if _, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyDigestWindow, "2h"); !errors.Is(err, ErrInvalidConfigValue) {
+		t.Fatalf("Too long digest window must be rejected: %v", err)
+	}
+	if _, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyPayloadSchema, `{"type": "map"}`); !errors.Is(err, ErrInvalidConfigValue) {
+		t.Fatalf("Invalid schema must be rejected: %v", err)
+	}
+	for _, value := range []string{"0", "11", "two"} {
+		if _, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyMaxTokenCount, value); !errors.Is(err, ErrInvalidConfigValue) {
+			t.Fatalf("Invalid max token count must be rejected: value=%s, err=%v", value, err)
+		}
+	}
+	if _, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyQuietHours, "22:00-07:00 JST"); !errors.Is(err, ErrInvalidConfigValue) {
+		t.Fatalf("Unknown time zone must be rejected: %v", err)
+	}
+	if len(stg.recs) != 0 {
+		t.Fatalf("Invalid input must not be saved: %v", stg.recs)
+	}
+}
+
+func TestChannelDefaultsApplyTo(t *testing.T) {
+	t.Parallel()
+
+	f := false
+	defaults := ChannelDefaults{IconEmoji: ":robot_face:", Username: "CI", UnfurlLinks: &f}
+	payload := map[string]interface{}{"text": "hello", "username": "deploy bot"}
+	defaults.ApplyTo(payload)
+
+	if payload["username"] != "deploy bot" {
+		t.Fatalf("Payload fields must take precedence: %v", payload)
+	}
+	if payload["icon_emoji"] != ":robot_face:" || payload["unfurl_links"] != false {
+		t.Fatalf("Defaults must be applied: %v", payload)
+	}
+	if _, ok := payload["link_names"]; ok {
+		t.Fatalf("Unset option must not be applied: %v", payload)
+	}
+}
+
+func TestChannelConfigDisabled(t *testing.T) {
+	t.Parallel()
+
+	svc := NewChannelConfigService(nil)
+	if svc.Enabled() {
+		t.Fatal("Service must be disabled without storage")
+	}
+	defaults, err := svc.GetDefaults(context.Background(), channelID)
+	if err != nil {
+		t.Fatalf("GetDefaults failed: %s", err)
+	}
+	if len(defaults.Values()) != 0 {
+		t.Fatalf("Defaults must be empty: %+v", defaults)
+	}
+}
+
+func TestChannelConfigPauseAndResume(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testChannelConfigStorage{recs: map[string]storage.ChannelConfigRecord{}}
+	svc := NewChannelConfigService(&stg)
+
+	if _, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyIconEmoji, ":robot_face:"); err != nil {
+		t.Fatalf("SetDefault failed: %s", err)
+	}
+	if prev, err := svc.Pause(ctx, channelID, "U123"); err != nil || prev.Paused {
+		t.Fatalf("Pause must return the previous state: %+v, %v", prev, err)
+	}
+	state, err := svc.GetPauseState(ctx, channelID)
+	if err != nil {
+		t.Fatalf("GetPauseState failed: %s", err)
+	}
+	if !state.Paused || state.UserID != "U123" {
+		t.Fatalf("Unexpected state: %+v", state)
+	}
+	if prev, err := svc.Pause(ctx, channelID, "U999"); err != nil || prev != state {
+		t.Fatalf("Pausing paused channel must keep the state: %+v, %v", prev, err)
+	}
+	if _, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyUsername, "CI"); err != nil {
+		t.Fatalf("SetDefault failed: %s", err)
+	}
+	if current, err := svc.GetPauseState(ctx, channelID); err != nil || !current.Paused {
+		t.Fatalf("Updating defaults must keep the state: %+v, %v", current, err)
+	}
+
+	prev, err := svc.Resume(ctx, channelID)
+	if err != nil {
+		t.Fatalf("Resume failed: %s", err)
+	}
+	if !prev.Paused {
+		t.Fatalf("Resume must return the previous state: %+v", prev)
+	}
+	if current, err := svc.GetPauseState(ctx, channelID); err != nil || current.Paused {
+		t.Fatalf("Channel must be resumed: %+v, %v", current, err)
+	}
+	defaults, err := svc.GetDefaults(ctx, channelID)
+	if err != nil {
+		t.Fatalf("GetDefaults failed: %s", err)
+	}
+	if defaults.IconEmoji != ":robot_face:" || defaults.Username != "CI" {
+		t.Fatalf("Pausing must keep the defaults: %+v", defaults)
+	}
+}
+
+func TestChannelConfigPayloadSchema(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testChannelConfigStorage{recs: map[string]storage.ChannelConfigRecord{}}
+	svc := NewChannelConfigService(&stg)
+
+	if _, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyPayloadSchema, `{"required": ["text"]}`); err != nil {
+		t.Fatalf("SetDefault failed: %s", err)
+	}
+	if got := stg.recs[channelID].PayloadSchema; got != `{"required":["text"]}` {
+		t.Fatalf("Schema must be saved compacted: %s", got)
+	}
+	defaults, err := svc.GetDefaults(ctx, channelID)
+	if err != nil {
+		t.Fatalf("GetDefaults failed: %s", err)
+	}
+	if defaults.PayloadSchema == nil || len(defaults.PayloadSchema.Validate(map[string]interface{}{})) != 1 {
+		t.Fatalf("Unexpected schema: %+v", defaults.PayloadSchema)
+	}
+	if defaults.Values()[ChannelConfigKeyPayloadSchema] != `{"required":["text"]}` {
+		t.Fatalf("Schema must be shown: %v", defaults.Values())
+	}
+}
+
+func TestChannelConfigMaxTokenCount(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testChannelConfigStorage{recs: map[string]storage.ChannelConfigRecord{}}
+	svc := NewChannelConfigService(&stg)
+
+	defaults, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyMaxTokenCount, "4")
+	if err != nil {
+		t.Fatalf("SetDefault failed: %s", err)
+	}
+	if defaults.MaxTokenCount != 4 || defaults.Values()[ChannelConfigKeyMaxTokenCount] != "4" {
+		t.Fatalf("Unexpected defaults: %+v", defaults)
+	}
+	defaults, err = svc.UnsetDefault(ctx, channelID, ChannelConfigKeyMaxTokenCount)
+	if err != nil {
+		t.Fatalf("UnsetDefault failed: %s", err)
+	}
+	if defaults.MaxTokenCount != 0 {
+		t.Fatalf("Max token count must be unset: %+v", defaults)
+	}
+}
+
+func TestChannelConfigQuietHours(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testChannelConfigStorage{recs: map[string]storage.ChannelConfigRecord{}}
+	svc := NewChannelConfigService(&stg)
+
+	defaults, err := svc.SetDefault(ctx, channelID, ChannelConfigKeyQuietHours, "22:00-7:00 Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("SetDefault failed: %s", err)
+	}
+	if defaults.QuietHours == nil || defaults.Values()[ChannelConfigKeyQuietHours] != "22:00-07:00 Asia/Tokyo" {
+		t.Fatalf("Unexpected defaults: %+v", defaults)
+	}
+	defaults, err = svc.UnsetDefault(ctx, channelID, ChannelConfigKeyQuietHours)
+	if err != nil {
+		t.Fatalf("UnsetDefault failed: %s", err)
+	}
+	if defaults.QuietHours != nil {
+		t.Fatalf("Quiet hours must be unset: %+v", defaults)
+	}
+}
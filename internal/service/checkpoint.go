@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// Checkpoints of checkpointed batch runs expire after this without progress, e.g. of aborted executions.
+const batchCheckpointTTL = 7 * 24 * time.Hour
+
+var errCheckpointDisabled = errors.New("checkpointed batch runs require the idempotency table")
+
+// SaveBatchCheckpoint saves the state of the checkpointed batch run given by the caller. Records are stored in the
+// idempotency table, so it must be configured.
+func (s *IdempotencyService) SaveBatchCheckpoint(ctx context.Context, id string, state string) error {
+	if !s.Enabled() {
+		return errCheckpointDisabled
+	}
+	rec := storage.IdempotencyRecord{
+		Key:        batchCheckpointRecordKey(id),
+		Completed:  true,
+		Checkpoint: state,
+		ExpiresAt:  time.Now().Add(batchCheckpointTTL).Unix(),
+	}
+	return s.ddb.SaveIdempotencyRecord(ctx, rec)
+}
+
+// GetBatchCheckpoint returns found=false for unknown and expired checkpoints.
+func (s *IdempotencyService) GetBatchCheckpoint(ctx context.Context, id string) (string, bool, error) {
+	if !s.Enabled() {
+		return "", false, errCheckpointDisabled
+	}
+	rec, found, err := s.ddb.GetIdempotencyRecord(ctx, batchCheckpointRecordKey(id))
+	if err != nil || !found {
+		return "", false, err
+	}
+	// DynamoDB TTL deletes expired items lazily.
+	if rec.ExpiresAt <= time.Now().Unix() {
+		return "", false, nil
+	}
+	return rec.Checkpoint, true, nil
+}
+
+func batchCheckpointRecordKey(id string) string {
+	return "batch-checkpoint#" + id
+}
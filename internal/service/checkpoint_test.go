@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+func TestBatchCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testIdempotencyStorage{recs: map[string]storage.IdempotencyRecord{}}
+	svc := NewIdempotencyService(&stg, time.Hour)
+
+	if _, found, err := svc.GetBatchCheckpoint(ctx, "run1"); err != nil || found {
+		t.Fatalf("Unknown checkpoint must not be found: found=%v, err=%v", found, err)
+	}
+	if err := svc.SaveBatchCheckpoint(ctx, "run1", `{"cursor":"alerts"}`); err != nil {
+		t.Fatalf("SaveBatchCheckpoint failed: %s", err)
+	}
+	state, found, err := svc.GetBatchCheckpoint(ctx, "run1")
+	if err != nil || !found || state != `{"cursor":"alerts"}` {
+		t.Fatalf("Unexpected checkpoint: state=%s, found=%v, err=%v", state, found, err)
+	}
+
+	// Expired checkpoints not deleted by DynamoDB TTL yet.
+	rec := stg.recs[batchCheckpointRecordKey("run1")]
+	rec.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	stg.recs[batchCheckpointRecordKey("run1")] = rec
+	if _, found, err := svc.GetBatchCheckpoint(ctx, "run1"); err != nil || found {
+		t.Fatalf("Expired checkpoint must not be found: found=%v, err=%v", found, err)
+	}
+}
+
+func TestBatchCheckpointDisabled(t *testing.T) {
+	t.Parallel()
+
+	svc := NewIdempotencyService(nil, time.Hour)
+	if err := svc.SaveBatchCheckpoint(context.Background(), "run1", "{}"); err == nil {
+		t.Fatal("Checkpoints require the idempotency table")
+	}
+}
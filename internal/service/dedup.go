@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// Dedup windows longer than this are rejected not to suppress recurring alerts for too long.
+const MaxDedupWindow = time.Hour
+
+// Duplicate is the first message of identical payloads, see BeginDedup.
+type Duplicate struct {
+	// Empty while the first message is being posted, or when it was not posted immediately, e.g. buffered.
+	TS string
+	// Number of identical payloads received within the window, including the first one.
+	Count int
+}
+
+// ContentHash identifies identical payloads sent with the same token. Keys of JSON objects are sorted by
+// json.Marshal, so the order of fields doesn't matter.
+func ContentHash(version int, payload map[string]interface{}) (string, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal payload")
+	}
+	sum := sha256.Sum256(b)
+	return fmt.Sprintf("%d#%s", version, hex.EncodeToString(sum[:])), nil
+}
+
+// BeginDedup reserves the content hash for the window from now. found=true means an identical payload has been
+// received within the window: the count is incremented and the first message is returned. Otherwise post the
+// payload, then call CompleteDedup or AbortDedup. Records are stored in the idempotency table.
+func (s *IdempotencyService) BeginDedup(ctx context.Context, channelID string, hash string, window time.Duration) (Duplicate, bool, error) {
+	if !s.Enabled() {
+		return Duplicate{}, false, nil
+	}
+
+	now := time.Now()
+	rec := storage.IdempotencyRecord{
+		Key:       dedupRecordKey(channelID, hash),
+		Count:     1,
+		ExpiresAt: now.Add(window).Unix(),
+	}
+	err := s.ddb.ReserveIdempotencyRecord(ctx, rec, now.Unix())
+	if err == nil {
+		return Duplicate{}, false, nil
+	}
+	if !errors.Is(err, storage.ErrRecordAlreadyExists) {
+		return Duplicate{}, false, err
+	}
+
+	existing, found, err := s.ddb.IncrementIdempotencyCount(ctx, rec.Key, now.Unix())
+	if err != nil {
+		return Duplicate{}, false, err
+	}
+	// Expired or aborted just now: post the payload without deduplication.
+	if !found {
+		return Duplicate{}, false, nil
+	}
+	return Duplicate{TS: existing.TS, Count: existing.Count}, true, nil
+}
+
+// CompleteDedup saves `ts` of the first message for counter updates of duplicates.
+func (s *IdempotencyService) CompleteDedup(ctx context.Context, channelID string, hash string, ts string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	return s.ddb.CompleteIdempotencyRecord(ctx, dedupRecordKey(channelID, hash), ts)
+}
+
+// AbortDedup releases the content hash so that retries of failed requests are posted.
+func (s *IdempotencyService) AbortDedup(ctx context.Context, channelID string, hash string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	return s.ddb.DeleteIdempotencyRecord(ctx, dedupRecordKey(channelID, hash))
+}
+
+// Idempotency keys are scoped by channel IDs too, so the prefix avoids collisions with them.
+func dedupRecordKey(channelID string, hash string) string {
+	return "dedup#" + channelID + "/" + hash
+}
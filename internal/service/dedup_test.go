@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+func TestContentHash(t *testing.T) {
+	t.Parallel()
+
+	a, err := ContentHash(0, map[string]interface{}{"text": "disk full", "username": "monitor"})
+	if err != nil {
+		t.Fatalf("ContentHash failed: %s", err)
+	}
+	b, _ := ContentHash(0, map[string]interface{}{"username": "monitor", "text": "disk full"})
+	if a != b {
+		t.Fatalf("Order of fields must not matter: %s, %s", a, b)
+	}
+	c, _ := ContentHash(1, map[string]interface{}{"text": "disk full", "username": "monitor"})
+	if a == c {
+		t.Fatalf("Hashes must be scoped by token version: %s", a)
+	}
+	d, _ := ContentHash(0, map[string]interface{}{"text": "disk ok", "username": "monitor"})
+	if a == d {
+		t.Fatalf("Different payloads must have different hashes: %s", a)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testIdempotencyStorage{recs: map[string]storage.IdempotencyRecord{}}
+	svc := NewIdempotencyService(&stg, time.Hour)
+
+	if _, found, err := svc.BeginDedup(ctx, channelID, "0#abc", time.Minute); err != nil || found {
+		t.Fatalf("First payload must be posted: found=%v, err=%v", found, err)
+	}
+	// Duplicates while the first one is being posted are suppressed without ts.
+	duplicate, found, err := svc.BeginDedup(ctx, channelID, "0#abc", time.Minute)
+	if err != nil || !found || duplicate.TS != "" || duplicate.Count != 2 {
+		t.Fatalf("Unexpected duplicate: duplicate=%+v, found=%v, err=%v", duplicate, found, err)
+	}
+	if err := svc.CompleteDedup(ctx, channelID, "0#abc", "1405894322.002768"); err != nil {
+		t.Fatalf("CompleteDedup failed: %s", err)
+	}
+	duplicate, found, err = svc.BeginDedup(ctx, channelID, "0#abc", time.Minute)
+	if err != nil || !found || duplicate.TS != "1405894322.002768" || duplicate.Count != 3 {
+		t.Fatalf("Unexpected duplicate: duplicate=%+v, found=%v, err=%v", duplicate, found, err)
+	}
+	if _, found, _ := svc.BeginDedup(ctx, "C999", "0#abc", time.Minute); found {
+		t.Fatal("Hashes must be scoped by channel")
+	}
+	if _, found, _ := svc.Begin(ctx, channelID, "0#abc"); found {
+		t.Fatal("Hashes must not collide with idempotency keys")
+	}
+
+	if err := svc.AbortDedup(ctx, channelID, "0#def"); err != nil {
+		t.Fatalf("AbortDedup failed: %s", err)
+	}
+	if _, found, _ := svc.BeginDedup(ctx, channelID, "0#def", time.Minute); found {
+		t.Fatal("Aborted hash must be posted")
+	}
+}
+
+func TestDedupExpired(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testIdempotencyStorage{recs: map[string]storage.IdempotencyRecord{
+		dedupRecordKey(channelID, "0#abc"): {Key: dedupRecordKey(channelID, "0#abc"), Completed: true, Count: 5, ExpiresAt: time.Now().Add(-time.Second).Unix()},
+	}}
+	svc := NewIdempotencyService(&stg, time.Hour)
+
+	if _, found, err := svc.BeginDedup(ctx, channelID, "0#abc", time.Minute); err != nil || found {
+		t.Fatalf("Payload after the window must be posted: found=%v, err=%v", found, err)
+	}
+	if rec := stg.recs[dedupRecordKey(channelID, "0#abc")]; rec.Count != 1 || rec.Completed {
+		t.Fatalf("Expired record must be reset: %+v", rec)
+	}
+}
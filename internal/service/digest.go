@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// Slack rejects messages having more blocks or attachments than these.
+const (
+	maxDigestBlocks      = 50
+	maxDigestAttachments = 100
+	maxSectionTextLength = 3000
+)
+
+// PendingDigest is a set of buffered messages of a channel, posted as one digest message.
+type PendingDigest struct {
+	ChannelID string
+	// The channel name when the latest message was received.
+	ChannelName string
+	// When the oldest message was received.
+	Since    time.Time
+	Payloads []map[string]interface{}
+	recs     []storage.DigestRecord
+}
+
+// DigestService buffers webhook payloads to coalesce high-frequency messages into digest messages. When the
+// underlying storage is nil, the feature is disabled and messages are posted immediately.
+type DigestService struct {
+	ddb digestDDB
+}
+
+func NewDigestService(ddb digestDDB) DigestService {
+	return DigestService{ddb: ddb}
+}
+
+func (s *DigestService) Enabled() bool {
+	return s.ddb != nil
+}
+
+// Buffer saves the payload to be posted by the next flush.
+func (s *DigestService) Buffer(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) error {
+	if !s.Enabled() {
+		return errors.New("digest is not enabled")
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal payload")
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return errors.Wrap(err, "failed to generate random string")
+	}
+	rec := storage.DigestRecord{
+		ChannelID:   channelID,
+		ReceivedAt:  fmt.Sprintf("%s#%x", currentTimestamp(), suffix),
+		ChannelName: channelName,
+		Payload:     string(b),
+	}
+	return s.ddb.SaveDigestRecord(ctx, rec)
+}
+
+// Pending returns buffered messages grouped by channel. Messages are sorted by the received time.
+func (s *DigestService) Pending(ctx context.Context) ([]PendingDigest, error) {
+	if !s.Enabled() {
+		return []PendingDigest{}, nil
+	}
+	recs, err := s.ddb.ScanDigestRecords(ctx)
+	if err != nil {
+		return []PendingDigest{}, err
+	}
+	slices.SortFunc(recs, func(a, b storage.DigestRecord) int {
+		if c := strings.Compare(a.ChannelID, b.ChannelID); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ReceivedAt, b.ReceivedAt)
+	})
+
+	var digests []PendingDigest
+	for _, rec := range recs {
+		payload := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(rec.Payload), &payload); err != nil {
+			return []PendingDigest{}, errors.Wrapf(err, "failed to unmarshal buffered payload: channel_id=%s, received_at=%s", rec.ChannelID, rec.ReceivedAt)
+		}
+		if len(digests) == 0 || digests[len(digests)-1].ChannelID != rec.ChannelID {
+			ts, _, _ := strings.Cut(rec.ReceivedAt, "#")
+			since, err := time.Parse(time.RFC3339Nano, ts)
+			if err != nil {
+				return []PendingDigest{}, errors.Wrapf(err, "failed to parse received_at: %s", rec.ReceivedAt)
+			}
+			digests = append(digests, PendingDigest{ChannelID: rec.ChannelID, Since: since})
+		}
+		d := &digests[len(digests)-1]
+		d.ChannelName = rec.ChannelName
+		d.Payloads = append(d.Payloads, payload)
+		d.recs = append(d.recs, rec)
+	}
+	return digests, nil
+}
+
+// Ack deletes the messages of the digest after posting it. Messages buffered after Pending are kept.
+func (s *DigestService) Ack(ctx context.Context, digest PendingDigest) error {
+	for _, rec := range digest.recs {
+		if err := s.ddb.DeleteDigestRecord(ctx, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeDigest coalesces payloads into one message. Texts are listed under a header line with the count. When
+// any payload has blocks, text-only payloads are converted to section blocks and all blocks are concatenated
+// with dividers. Blocks and attachments over Slack's limits are dropped. Other fields like username are taken
+// from the first payload.
+func MergeDigest(payloads []map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	if len(payloads) == 0 {
+		return merged
+	}
+	for k, v := range payloads[0] {
+		merged[k] = v
+	}
+	header := fmt.Sprintf("%d messages received:", len(payloads))
+
+	texts := []string{header}
+	hasBlocks := false
+	var attachments []interface{}
+	for _, p := range payloads {
+		if text, ok := p["text"].(string); ok && text != "" {
+			texts = append(texts, text)
+		}
+		if blocks, ok := p["blocks"].([]interface{}); ok && len(blocks) > 0 {
+			hasBlocks = true
+		}
+		if as, ok := p["attachments"].([]interface{}); ok {
+			attachments = append(attachments, as...)
+		}
+	}
+	merged["text"] = strings.Join(texts, "\n\n")
+	delete(merged, "blocks")
+	delete(merged, "attachments")
+	if len(attachments) > 0 {
+		merged["attachments"] = attachments[:min(len(attachments), maxDigestAttachments)]
+	}
+	if !hasBlocks {
+		return merged
+	}
+
+	blocks := []interface{}{sectionBlock(header)}
+	for _, p := range payloads {
+		blocks = append(blocks, map[string]interface{}{"type": "divider"})
+		if bs, ok := p["blocks"].([]interface{}); ok && len(bs) > 0 {
+			blocks = append(blocks, bs...)
+		} else if text, ok := p["text"].(string); ok && text != "" {
+			blocks = append(blocks, sectionBlock(text))
+		}
+	}
+	merged["blocks"] = blocks[:min(len(blocks), maxDigestBlocks)]
+	return merged
+}
+
+func sectionBlock(text string) map[string]interface{} {
+	if r := []rune(text); len(r) > maxSectionTextLength {
+		text = string(r[:maxSectionTextLength-1]) + "…"
+	}
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": text},
+	}
+}
+
+type digestDDB interface {
+	// SaveDigestRecord returns storage.ErrRecordAlreadyExists when the record exists.
+	SaveDigestRecord(ctx context.Context, rec storage.DigestRecord) error
+	ScanDigestRecords(ctx context.Context) ([]storage.DigestRecord, error)
+	DeleteDigestRecord(ctx context.Context, rec storage.DigestRecord) error
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+type testDigestStorage struct {
+	recs []storage.DigestRecord
+}
+
+func (t *testDigestStorage) SaveDigestRecord(ctx context.Context, rec storage.DigestRecord) error {
+	t.recs = append(t.recs, rec)
+	return nil
+}
+
+func (t *testDigestStorage) ScanDigestRecords(ctx context.Context) ([]storage.DigestRecord, error) {
+	return append([]storage.DigestRecord{}, t.recs...), nil
+}
+
+func (t *testDigestStorage) DeleteDigestRecord(ctx context.Context, rec storage.DigestRecord) error {
+	for i, r := range t.recs {
+		if r == rec {
+			t.recs = append(t.recs[:i], t.recs[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestDigestBufferAndAck(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testDigestStorage{}
+	svc := NewDigestService(&stg)
+
+	for _, text := range []string{"first", "second"} {
+		if err := svc.Buffer(ctx, channelID, channelName, map[string]interface{}{"text": text}); err != nil {
+			t.Fatalf("Buffer failed: %s", err)
+		}
+	}
+	if err := svc.Buffer(ctx, "C999", "other", map[string]interface{}{"text": "other"}); err != nil {
+		t.Fatalf("Buffer failed: %s", err)
+	}
+
+	digests, err := svc.Pending(ctx)
+	if err != nil {
+		t.Fatalf("Pending failed: %s", err)
+	}
+	if len(digests) != 2 {
+		t.Fatalf("Messages must be grouped by channel: %+v", digests)
+	}
+	var target PendingDigest
+	for _, d := range digests {
+		if d.ChannelID == channelID {
+			target = d
+		}
+	}
+	if len(target.Payloads) != 2 || target.Payloads[0]["text"] != "first" || target.Since.IsZero() {
+		t.Fatalf("Unexpected digest: %+v", target)
+	}
+
+	// Buffered after Pending, must be kept.
+	if err := svc.Buffer(ctx, channelID, channelName, map[string]interface{}{"text": "third"}); err != nil {
+		t.Fatalf("Buffer failed: %s", err)
+	}
+	if err := svc.Ack(ctx, target); err != nil {
+		t.Fatalf("Ack failed: %s", err)
+	}
+	if len(stg.recs) != 2 {
+		t.Fatalf("Only acked messages must be deleted: %+v", stg.recs)
+	}
+}
+
+func TestMergeDigest(t *testing.T) {
+	t.Parallel()
+
+	merged := MergeDigest([]map[string]interface{}{
+		{"text": "deploy started", "username": "CI"},
+		{"text": "deploy failed", "blocks": []interface{}{map[string]interface{}{"type": "header"}}},
+	})
+
+	if merged["text"] != "2 messages received:\n\ndeploy started\n\ndeploy failed" {
+		t.Fatalf("Unexpected text: %v", merged["text"])
+	}
+	if merged["username"] != "CI" {
+		t.Fatalf("Fields of the first payload must be kept: %v", merged)
+	}
+	blocks, ok := merged["blocks"].([]interface{})
+	// header section, divider, converted section, divider, given block
+	if !ok || len(blocks) != 5 {
+		t.Fatalf("Unexpected blocks: %v", merged["blocks"])
+	}
+}
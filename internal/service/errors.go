@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Code classifies expected failures of service operations. They are caused by user input rather than storage
+// or network failures, so handlers respond them as client errors. Codes are also used as audit results and
+// metric attributes, so don't change existing values.
+type Code string
+
+const (
+	CodeTokenNotFound    Code = "not_found"
+	CodeTokenUnmatch     Code = "unmatch"
+	CodeNoTokenFound     Code = "no_token_found"
+	CodeTooManyToken     Code = "too_many_token"
+	CodeChannelIDUnmatch Code = "channel_id_unmatch"
+	CodeInvalidMentions  Code = "invalid_mentions"
+	CodeInvalidKey       Code = "invalid_key"
+	CodeInvalidValue     Code = "invalid_value"
+	CodeInvalidScope     Code = "invalid_scope"
+	CodeInvalidMapping   Code = "invalid_mapping"
+	CodePresignExpired   Code = "expired"
+
+	CodeInvalidIdempotencyKey    Code = "invalid_idempotency_key"
+	CodeIdempotencyKeyInProgress Code = "idempotency_key_in_progress"
+
+	CodeGroupNotFound      Code = "group_not_found"
+	CodeGroupAlreadyExists Code = "group_already_exists"
+	CodeInvalidGroupName   Code = "invalid_group_name"
+	CodeTooManyMembers     Code = "too_many_members"
+)
+
+// Error is an expected failure having a Code. Use errors.Is with the sentinel errors below, or CodeOf to handle
+// failures centrally.
+type Error struct {
+	code Code
+	msg  string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func (e *Error) Code() Code {
+	return e.code
+}
+
+var (
+	// No token found for the channel or no pair of the channel and the token found.
+	ErrTokenNotFound = &Error{code: CodeTokenNotFound, msg: "token not found"}
+	// Tokens found for the channel but none of them matches the given token.
+	ErrTokenUnmatch = &Error{code: CodeTokenUnmatch, msg: "token unmatch"}
+	// No token to regenerate from.
+	ErrNoTokenFound = &Error{code: CodeNoTokenFound, msg: "no token found"}
+	// The channel already has the max number of tokens.
+	ErrTooManyToken = &Error{code: CodeTooManyToken, msg: "too many token"}
+	// The token is linked to another channel. The returned error is ChannelIDUnmatchError.
+	ErrChannelIDUnmatch   = &Error{code: CodeChannelIDUnmatch, msg: "channel id unmatch"}
+	ErrInvalidMentions    = &Error{code: CodeInvalidMentions, msg: "invalid mentions field"}
+	ErrInvalidConfigKey   = &Error{code: CodeInvalidKey, msg: "invalid config key"}
+	ErrInvalidConfigValue = &Error{code: CodeInvalidValue, msg: "invalid config value"}
+	ErrInvalidScope       = &Error{code: CodeInvalidScope, msg: "invalid token scope"}
+	ErrInvalidMapping     = &Error{code: CodeInvalidMapping, msg: "invalid mapping rule"}
+	// The pre-signed URL is valid but expired.
+	ErrPresignExpired = &Error{code: CodePresignExpired, msg: "pre-signed url expired"}
+	// The idempotency key is too long.
+	ErrInvalidIdempotencyKey = &Error{code: CodeInvalidIdempotencyKey, msg: "invalid idempotency key"}
+	// Another request having the same idempotency key is being processed.
+	ErrIdempotencyKeyInProgress = &Error{code: CodeIdempotencyKeyInProgress, msg: "idempotency key in progress"}
+	ErrGroupNotFound            = &Error{code: CodeGroupNotFound, msg: "broadcast group not found"}
+	ErrGroupAlreadyExists       = &Error{code: CodeGroupAlreadyExists, msg: "broadcast group already exists"}
+	ErrInvalidGroupName         = &Error{code: CodeInvalidGroupName, msg: "invalid broadcast group name"}
+	// The group already has maxBroadcastMembers channels.
+	ErrTooManyMembers = &Error{code: CodeTooManyMembers, msg: "too many broadcast group members"}
+)
+
+// ChannelIDUnmatchError is returned when the token is linked to another channel, which is treated as a permission
+// error. errors.Is(err, ErrChannelIDUnmatch) works for this error.
+type ChannelIDUnmatchError struct {
+	LinkedChannelID string
+}
+
+func (e *ChannelIDUnmatchError) Error() string {
+	return fmt.Sprintf("%s: linked_channel_id=%s", ErrChannelIDUnmatch.msg, e.LinkedChannelID)
+}
+
+func (e *ChannelIDUnmatchError) Code() Code {
+	return CodeChannelIDUnmatch
+}
+
+func (e *ChannelIDUnmatchError) Is(target error) bool {
+	return target == ErrChannelIDUnmatch
+}
+
+// CodeOf returns the Code of the expected failure in the err chain. ok is false for nil and unexpected errors.
+func CodeOf(err error) (code Code, ok bool) {
+	var coded interface{ Code() Code }
+	if errors.As(err, &coded) {
+		return coded.Code(), true
+	}
+	return "", false
+}
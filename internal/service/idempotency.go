@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+const (
+	maxIdempotencyKeyLength = 256
+	// Reservations of crashed requests expire after this, so retries are not rejected until the TTL.
+	idempotencyReservationTTL = 5 * time.Minute
+)
+
+// IdempotentResult is the result of the first request having the idempotency key, responded to duplicates.
+type IdempotentResult struct {
+	TS                 string
+	ScheduledMessageID string
+}
+
+// IdempotencyService deduplicates webhook requests by idempotency keys given by callers. Keys are scoped by
+// channel ID. When the underlying storage is nil, deduplication is disabled and all requests are processed.
+type IdempotencyService struct {
+	ddb idempotencyDDB
+	ttl time.Duration
+}
+
+func NewIdempotencyService(ddb idempotencyDDB, ttl time.Duration) IdempotencyService {
+	return IdempotencyService{ddb: ddb, ttl: ttl}
+}
+
+func (s *IdempotencyService) Enabled() bool {
+	return s.ddb != nil
+}
+
+// Begin reserves the key before processing the request. found=true means a previous request having the key
+// has completed, respond the returned result instead of processing. Returns ErrIdempotencyKeyInProgress when
+// another request having the key is being processed. Call Complete or Abort after processing.
+func (s *IdempotencyService) Begin(ctx context.Context, channelID string, key string) (IdempotentResult, bool, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return IdempotentResult{}, false, ErrInvalidIdempotencyKey
+	}
+	if !s.Enabled() {
+		return IdempotentResult{}, false, nil
+	}
+
+	now := time.Now()
+	rec := storage.IdempotencyRecord{
+		Key:       idempotencyRecordKey(channelID, key),
+		ExpiresAt: now.Add(idempotencyReservationTTL).Unix(),
+	}
+	err := s.ddb.ReserveIdempotencyRecord(ctx, rec, now.Unix())
+	if err == nil {
+		return IdempotentResult{}, false, nil
+	}
+	if !errors.Is(err, storage.ErrRecordAlreadyExists) {
+		return IdempotentResult{}, false, err
+	}
+
+	existing, found, err := s.ddb.GetIdempotencyRecord(ctx, rec.Key)
+	if err != nil {
+		return IdempotentResult{}, false, err
+	}
+	// Not found means the record has been deleted by Abort just now, treat it as in progress to let the caller retry.
+	if !found || !existing.Completed {
+		return IdempotentResult{}, false, ErrIdempotencyKeyInProgress
+	}
+	return IdempotentResult{TS: existing.TS, ScheduledMessageID: existing.ScheduledMessageID}, true, nil
+}
+
+// Complete saves the result of the request for the TTL.
+func (s *IdempotencyService) Complete(ctx context.Context, channelID string, key string, result IdempotentResult) error {
+	if !s.Enabled() {
+		return nil
+	}
+	rec := storage.IdempotencyRecord{
+		Key:                idempotencyRecordKey(channelID, key),
+		Completed:          true,
+		TS:                 result.TS,
+		ScheduledMessageID: result.ScheduledMessageID,
+		ExpiresAt:          time.Now().Add(s.ttl).Unix(),
+	}
+	return s.ddb.SaveIdempotencyRecord(ctx, rec)
+}
+
+// Abort releases the key so that retries of failed requests are processed.
+func (s *IdempotencyService) Abort(ctx context.Context, channelID string, key string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	return s.ddb.DeleteIdempotencyRecord(ctx, idempotencyRecordKey(channelID, key))
+}
+
+func idempotencyRecordKey(channelID string, key string) string {
+	return channelID + "/" + key
+}
+
+type idempotencyDDB interface {
+	// ReserveIdempotencyRecord returns storage.ErrRecordAlreadyExists when unexpired record exists at `now`.
+	ReserveIdempotencyRecord(ctx context.Context, rec storage.IdempotencyRecord, now int64) error
+	// GetIdempotencyRecord returns found=false when no record has the key.
+	GetIdempotencyRecord(ctx context.Context, key string) (storage.IdempotencyRecord, bool, error)
+	SaveIdempotencyRecord(ctx context.Context, rec storage.IdempotencyRecord) error
+	DeleteIdempotencyRecord(ctx context.Context, key string) error
+	// IncrementIdempotencyCount returns found=false when no unexpired record at `now` has the key.
+	IncrementIdempotencyCount(ctx context.Context, key string, now int64) (storage.IdempotencyRecord, bool, error)
+	CompleteIdempotencyRecord(ctx context.Context, key string, ts string) error
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+type testIdempotencyStorage struct {
+	recs map[string]storage.IdempotencyRecord
+}
+
+func (t *testIdempotencyStorage) ReserveIdempotencyRecord(ctx context.Context, rec storage.IdempotencyRecord, now int64) error {
+	if existing, ok := t.recs[rec.Key]; ok && existing.ExpiresAt > now {
+		return storage.ErrRecordAlreadyExists
+	}
+	t.recs[rec.Key] = rec
+	return nil
+}
+
+func (t *testIdempotencyStorage) GetIdempotencyRecord(ctx context.Context, key string) (storage.IdempotencyRecord, bool, error) {
+	rec, ok := t.recs[key]
+	return rec, ok, nil
+}
+
+func (t *testIdempotencyStorage) SaveIdempotencyRecord(ctx context.Context, rec storage.IdempotencyRecord) error {
+	t.recs[rec.Key] = rec
+	return nil
+}
+
+func (t *testIdempotencyStorage) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	delete(t.recs, key)
+	return nil
+}
+
+func (t *testIdempotencyStorage) IncrementIdempotencyCount(ctx context.Context, key string, now int64) (storage.IdempotencyRecord, bool, error) {
+	rec, ok := t.recs[key]
+	if !ok || rec.ExpiresAt <= now {
+		return storage.IdempotencyRecord{}, false, nil
+	}
+	rec.Count++
+	t.recs[key] = rec
+	return rec, true, nil
+}
+
+func (t *testIdempotencyStorage) CompleteIdempotencyRecord(ctx context.Context, key string, ts string) error {
+	if rec, ok := t.recs[key]; ok {
+		rec.Completed = true
+		rec.TS = ts
+		t.recs[key] = rec
+	}
+	return nil
+}
+
+func TestIdempotencyBeginAndComplete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testIdempotencyStorage{recs: map[string]storage.IdempotencyRecord{}}
+	svc := NewIdempotencyService(&stg, time.Hour)
+
+	if _, found, err := svc.Begin(ctx, channelID, "key1"); err != nil || found {
+		t.Fatalf("First request must be processed: found=%v, err=%v", found, err)
+	}
+	if _, _, err := svc.Begin(ctx, channelID, "key1"); !errors.Is(err, ErrIdempotencyKeyInProgress) {
+		t.Fatalf("Duplicate of in-progress request must be rejected: %v", err)
+	}
+	if _, found, err := svc.Begin(ctx, "C999", "key1"); err != nil || found {
+		t.Fatalf("Keys must be scoped by channel: found=%v, err=%v", found, err)
+	}
+
+	if err := svc.Complete(ctx, channelID, "key1", IdempotentResult{TS: "1405894322.002768"}); err != nil {
+		t.Fatalf("Complete failed: %s", err)
+	}
+	result, found, err := svc.Begin(ctx, channelID, "key1")
+	if err != nil || !found {
+		t.Fatalf("Duplicate of completed request must be found: found=%v, err=%v", found, err)
+	}
+	if result.TS != "1405894322.002768" {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+}
+
+func TestIdempotencyAbort(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testIdempotencyStorage{recs: map[string]storage.IdempotencyRecord{}}
+	svc := NewIdempotencyService(&stg, time.Hour)
+
+	if _, _, err := svc.Begin(ctx, channelID, "key1"); err != nil {
+		t.Fatalf("Begin failed: %s", err)
+	}
+	if err := svc.Abort(ctx, channelID, "key1"); err != nil {
+		t.Fatalf("Abort failed: %s", err)
+	}
+	if _, found, err := svc.Begin(ctx, channelID, "key1"); err != nil || found {
+		t.Fatalf("Retry of aborted request must be processed: found=%v, err=%v", found, err)
+	}
+}
+
+func TestIdempotencyInvalidKey(t *testing.T) {
+	t.Parallel()
+
+	svc := NewIdempotencyService(nil, time.Hour)
+	if _, _, err := svc.Begin(context.Background(), channelID, strings.Repeat("a", 257)); !errors.Is(err, ErrInvalidIdempotencyKey) {
+		t.Fatalf("Too long key must be rejected: %v", err)
+	}
+}
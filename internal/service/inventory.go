@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// InventoryChannel is a Slack channel in the channel inventory.
+type InventoryChannel struct {
+	ID         string
+	Name       string
+	IsArchived bool
+	IsPrivate  bool
+}
+
+type inventoryStorage interface {
+	ScanChannels(ctx context.Context) ([]storage.ChannelInventoryRecord, error)
+	PutChannels(ctx context.Context, recs []storage.ChannelInventoryRecord) error
+	DeleteChannels(ctx context.Context, channelIDs []string) error
+	UpdateChannelName(ctx context.Context, channelID string, name string, updatedAt string) error
+	UpdateChannelArchived(ctx context.Context, channelID string, archived bool, updatedAt string) error
+	GetInventorySyncedAt(ctx context.Context) (time.Time, bool, error)
+	SaveInventorySyncedAt(ctx context.Context, syncedAt time.Time) error
+}
+
+// InventoryService caches Slack channels in DynamoDB, so the batch job doesn't list all channels every run. The
+// inventory is replaced by a full sync after maxAge, and kept up to date with Events API in between. When the
+// underlying storage is nil, the inventory is disabled.
+type InventoryService struct {
+	ddb    inventoryStorage
+	maxAge time.Duration
+}
+
+func NewInventoryService(ddb inventoryStorage, maxAge time.Duration) InventoryService {
+	return InventoryService{ddb: ddb, maxAge: maxAge}
+}
+
+func (s *InventoryService) Enabled() bool {
+	return s.ddb != nil
+}
+
+// Cached returns found=false when the inventory is disabled or not synced within maxAge, callers need a full sync.
+func (s *InventoryService) Cached(ctx context.Context) ([]InventoryChannel, bool, error) {
+	if !s.Enabled() {
+		return nil, false, nil
+	}
+	syncedAt, found, err := s.ddb.GetInventorySyncedAt(ctx)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	if time.Since(syncedAt) > s.maxAge {
+		return nil, false, nil
+	}
+	recs, err := s.ddb.ScanChannels(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	channels := make([]InventoryChannel, 0, len(recs))
+	for _, rec := range recs {
+		channels = append(channels, InventoryChannel{ID: rec.ChannelID, Name: rec.Name, IsArchived: rec.IsArchived, IsPrivate: rec.IsPrivate})
+	}
+	return channels, true, nil
+}
+
+// Replace saves the channels of a full sync, and deletes channels not in them, e.g. deleted channels or channels
+// belldog was removed from.
+func (s *InventoryService) Replace(ctx context.Context, channels []InventoryChannel) error {
+	if !s.Enabled() {
+		return nil
+	}
+	existing, err := s.ddb.ScanChannels(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	updatedAt := now.Format(time.RFC3339Nano)
+	recs := make([]storage.ChannelInventoryRecord, 0, len(channels))
+	seen := make(map[string]bool, len(channels))
+	for _, ch := range channels {
+		seen[ch.ID] = true
+		recs = append(recs, storage.ChannelInventoryRecord{ChannelID: ch.ID, Name: ch.Name, IsArchived: ch.IsArchived, IsPrivate: ch.IsPrivate, UpdatedAt: updatedAt})
+	}
+	var deleted []string
+	for _, rec := range existing {
+		if !seen[rec.ChannelID] {
+			deleted = append(deleted, rec.ChannelID)
+		}
+	}
+	if err := s.ddb.PutChannels(ctx, recs); err != nil {
+		return err
+	}
+	if err := s.ddb.DeleteChannels(ctx, deleted); err != nil {
+		return err
+	}
+	return s.ddb.SaveInventorySyncedAt(ctx, now)
+}
+
+// Rename applies channel rename events.
+func (s *InventoryService) Rename(ctx context.Context, channelID string, name string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	return s.ddb.UpdateChannelName(ctx, channelID, name, currentTimestamp())
+}
+
+// SetArchived applies channel archive and unarchive events.
+func (s *InventoryService) SetArchived(ctx context.Context, channelID string, archived bool) error {
+	if !s.Enabled() {
+		return nil
+	}
+	return s.ddb.UpdateChannelArchived(ctx, channelID, archived, currentTimestamp())
+}
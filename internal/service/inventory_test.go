@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+type testInventoryStorage struct {
+	recs     map[string]storage.ChannelInventoryRecord
+	syncedAt time.Time
+}
+
+func (t *testInventoryStorage) ScanChannels(ctx context.Context) ([]storage.ChannelInventoryRecord, error) {
+	var recs []storage.ChannelInventoryRecord
+	for _, rec := range t.recs {
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func (t *testInventoryStorage) PutChannels(ctx context.Context, recs []storage.ChannelInventoryRecord) error {
+	for _, rec := range recs {
+		t.recs[rec.ChannelID] = rec
+	}
+	return nil
+}
+
+func (t *testInventoryStorage) DeleteChannels(ctx context.Context, channelIDs []string) error {
+	for _, id := range channelIDs {
+		delete(t.recs, id)
+	}
+	return nil
+}
+
+func (t *testInventoryStorage) UpdateChannelName(ctx context.Context, channelID string, name string, updatedAt string) error {
+	rec := t.recs[channelID]
+	rec.ChannelID, rec.Name, rec.UpdatedAt = channelID, name, updatedAt
+	t.recs[channelID] = rec
+	return nil
+}
+
+func (t *testInventoryStorage) UpdateChannelArchived(ctx context.Context, channelID string, archived bool, updatedAt string) error {
+	rec := t.recs[channelID]
+	rec.ChannelID, rec.IsArchived, rec.UpdatedAt = channelID, archived, updatedAt
+	t.recs[channelID] = rec
+	return nil
+}
+
+func (t *testInventoryStorage) GetInventorySyncedAt(ctx context.Context) (time.Time, bool, error) {
+	return t.syncedAt, !t.syncedAt.IsZero(), nil
+}
+
+func (t *testInventoryStorage) SaveInventorySyncedAt(ctx context.Context, syncedAt time.Time) error {
+	t.syncedAt = syncedAt
+	return nil
+}
+
+func TestInventoryReplaceAndEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testInventoryStorage{recs: map[string]storage.ChannelInventoryRecord{
+		"C0": {ChannelID: "C0", Name: "deleted"},
+	}}
+	svc := NewInventoryService(&stg, time.Hour)
+
+	if _, found, err := svc.Cached(ctx); err != nil || found {
+		t.Fatalf("Inventory must not be found before the full sync: found=%v, err=%v", found, err)
+	}
+	err := svc.Replace(ctx, []InventoryChannel{{ID: "C1", Name: "alerts"}, {ID: "C2", Name: "secret", IsPrivate: true}})
+	if err != nil {
+		t.Fatalf("Replace failed: %s", err)
+	}
+	if _, ok := stg.recs["C0"]; ok {
+		t.Fatal("Channels not in the full sync must be deleted")
+	}
+
+	if err := svc.Rename(ctx, "C1", "alerts-prod"); err != nil {
+		t.Fatalf("Rename failed: %s", err)
+	}
+	if err := svc.SetArchived(ctx, "C2", true); err != nil {
+		t.Fatalf("SetArchived failed: %s", err)
+	}
+	channels, found, err := svc.Cached(ctx)
+	if err != nil || !found {
+		t.Fatalf("Inventory must be found after the full sync: found=%v, err=%v", found, err)
+	}
+	byID := map[string]InventoryChannel{}
+	for _, ch := range channels {
+		byID[ch.ID] = ch
+	}
+	if len(byID) != 2 || byID["C1"].Name != "alerts-prod" || !byID["C2"].IsArchived || !byID["C2"].IsPrivate {
+		t.Fatalf("Unexpected channels: %+v", channels)
+	}
+
+	// Stale inventory needs the full sync again.
+	stg.syncedAt = time.Now().Add(-2 * time.Hour)
+	if _, found, err := svc.Cached(ctx); err != nil || found {
+		t.Fatalf("Stale inventory must not be found: found=%v, err=%v", found, err)
+	}
+}
+
+func TestInventoryDisabled(t *testing.T) {
+	t.Parallel()
+
+	svc := NewInventoryService(nil, time.Hour)
+	if svc.Enabled() {
+		t.Fatal("expected disabled")
+	}
+	if _, found, err := svc.Cached(context.Background()); err != nil || found {
+		t.Fatalf("Disabled inventory must not be found: found=%v, err=%v", found, err)
+	}
+	if err := svc.Rename(context.Background(), "C1", "alerts"); err != nil {
+		t.Fatalf("Rename failed: %s", err)
+	}
+}
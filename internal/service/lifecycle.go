@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/eventbridge"
+)
+
+// Detail types of lifecycle events.
+const (
+	LifecycleTokenGenerated         = "TokenGenerated"
+	LifecycleTokenRevoked           = "TokenRevoked"
+	LifecycleChannelRenamedDetected = "ChannelRenamedDetected"
+	LifecycleRecordDeletedArchived  = "RecordDeletedArchived"
+)
+
+// LifecycleEventSource is the source of lifecycle events, for matching them with event rules.
+const LifecycleEventSource = "belldog"
+
+// LifecycleEvent is published as the detail of the event. Tokens are never published, only their prefixes.
+type LifecycleEvent struct {
+	Type        string `json:"-"`
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	// Empty for events not about a single token, e.g. channel renames.
+	TokenPrefix string `json:"token_prefix,omitempty"`
+	// Zero when unknown, e.g. tokens given to commands.
+	TokenVersion int `json:"token_version,omitempty"`
+	// Only for ChannelRenamedDetected.
+	OldChannelName string `json:"old_channel_name,omitempty"`
+	// Slack user ID operating the command, empty for operations by Belldog itself, e.g. the batch job.
+	UserID string `json:"user_id,omitempty"`
+	// Why the event happened, e.g. "command", "rotation" or "stale".
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Reasons of lifecycle events.
+const (
+	LifecycleReasonCommand         = "command"
+	LifecycleReasonRotation        = "rotation"
+	LifecycleReasonStale           = "stale"
+	LifecycleReasonChannelRenamed  = "channel_renamed"
+	LifecycleReasonChannelArchived = "channel_archived"
+	LifecycleReasonPurged          = "purged"
+)
+
+type eventPutter interface {
+	PutEvents(ctx context.Context, entries []eventbridge.Entry) error
+}
+
+// LifecycleService publishes token lifecycle events to EventBridge, so other systems can react to them, e.g.
+// updating CMDB. When the underlying client is nil, publishing is disabled and Publish does nothing.
+type LifecycleService struct {
+	events eventPutter
+	// Name or ARN, empty for the default event bus.
+	eventBusName string
+}
+
+func NewLifecycleService(events eventPutter, eventBusName string) LifecycleService {
+	return LifecycleService{events: events, eventBusName: eventBusName}
+}
+
+func (s *LifecycleService) Enabled() bool {
+	return s.events != nil
+}
+
+// Publish puts the event with the current timestamp.
+func (s *LifecycleService) Publish(ctx context.Context, evt LifecycleEvent) error {
+	if !s.Enabled() {
+		return nil
+	}
+	evt.Timestamp = time.Now().UTC()
+	detail, err := json.Marshal(evt)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal lifecycle event")
+	}
+	return s.events.PutEvents(ctx, []eventbridge.Entry{{
+		Source:       LifecycleEventSource,
+		DetailType:   evt.Type,
+		Detail:       string(detail),
+		EventBusName: s.eventBusName,
+	}})
+}
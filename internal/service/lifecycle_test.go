@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Finatext/belldog/internal/eventbridge"
+)
+
+type testEventPutter struct {
+	entries []eventbridge.Entry
+}
+
+func (t *testEventPutter) PutEvents(ctx context.Context, entries []eventbridge.Entry) error {
+	t.entries = append(t.entries, entries...)
+	return nil
+}
+
+func TestLifecyclePublish(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	putter := testEventPutter{}
+	svc := NewLifecycleService(&putter, "security")
+
+	evt := LifecycleEvent{Type: LifecycleTokenRevoked, ChannelID: channelID, ChannelName: channelName, TokenPrefix: "abcd", TokenVersion: 2, Reason: LifecycleReasonStale}
+	if err := svc.Publish(ctx, evt); err != nil {
+		t.Fatalf("Publish failed: %s", err)
+	}
+	if len(putter.entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(putter.entries))
+	}
+	entry := putter.entries[0]
+	if entry.Source != LifecycleEventSource || entry.DetailType != LifecycleTokenRevoked || entry.EventBusName != "security" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	var got LifecycleEvent
+	if err := json.Unmarshal([]byte(entry.Detail), &got); err != nil {
+		t.Fatalf("failed to unmarshal detail: %s", err)
+	}
+	if got.ChannelID != channelID || got.TokenPrefix != "abcd" || got.TokenVersion != 2 || got.Reason != LifecycleReasonStale || got.Timestamp.IsZero() {
+		t.Fatalf("unexpected detail: %s", entry.Detail)
+	}
+	if strings.Contains(entry.Detail, "old_channel_name") || strings.Contains(entry.Detail, "user_id") {
+		t.Fatalf("empty fields must be omitted: %s", entry.Detail)
+	}
+}
+
+func TestLifecycleDisabled(t *testing.T) {
+	t.Parallel()
+
+	svc := NewLifecycleService(nil, "")
+	if svc.Enabled() {
+		t.Fatal("expected disabled")
+	}
+	if err := svc.Publish(context.Background(), LifecycleEvent{Type: LifecycleTokenGenerated}); err != nil {
+		t.Fatalf("Publish failed: %s", err)
+	}
+}
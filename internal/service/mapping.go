@@ -0,0 +1,156 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Mapping rules build Slack payloads from arbitrary JSON payloads, e.g. alerts of monitoring tools, as a lighter
+// alternative to templates. A rule is `<field> <- <path>`, e.g. `text <- $.alert.description`. Paths are a subset
+// of JSONPath: `$`, `.key`, `['key']` and `[index]`.
+
+// Rules more than this are rejected to keep mappings simple.
+const maxMappingRules = 10
+
+// MappingFieldColor is not a chat.postMessage argument: the value is the color of the attachment having the text.
+const MappingFieldColor = "color"
+
+var (
+	mappingFieldPattern = regexp.MustCompile(`^[a-z_]+$`)
+	// One segment of paths: `.key`, `['key']` or `[0]`.
+	mappingSegmentPattern = regexp.MustCompile(`^(?:\.([A-Za-z0-9_-]+)|\['([^']*)'\]|\[(\d+)\])`)
+)
+
+// MappingRule maps the value at the path of the payload to the field of the Slack payload.
+type MappingRule struct {
+	Field string
+	// Keys (string) and indexes (int) from the root.
+	path []interface{}
+	// The original path to show.
+	rawPath string
+}
+
+func (r MappingRule) String() string {
+	return r.Field + " <- " + r.rawPath
+}
+
+// ParseMappingRule returns ErrInvalidMapping for invalid rules.
+func ParseMappingRule(s string) (MappingRule, error) {
+	field, rawPath, ok := strings.Cut(s, "<-")
+	field = strings.TrimSpace(field)
+	rawPath = strings.TrimSpace(rawPath)
+	if !ok || !mappingFieldPattern.MatchString(field) || !strings.HasPrefix(rawPath, "$") {
+		return MappingRule{}, ErrInvalidMapping
+	}
+	var path []interface{}
+	rest := rawPath[1:]
+	for rest != "" {
+		m := mappingSegmentPattern.FindStringSubmatch(rest)
+		if m == nil {
+			return MappingRule{}, ErrInvalidMapping
+		}
+		switch {
+		case m[1] != "":
+			path = append(path, m[1])
+		case m[3] != "":
+			i, err := strconv.Atoi(m[3])
+			if err != nil {
+				return MappingRule{}, ErrInvalidMapping
+			}
+			path = append(path, i)
+		default:
+			path = append(path, m[2])
+		}
+		rest = rest[len(m[0]):]
+	}
+	return MappingRule{Field: field, path: path, rawPath: rawPath}, nil
+}
+
+// ParseMappingRules parses rules separated by `;` or newlines. Returns ErrInvalidMapping for invalid rules.
+func ParseMappingRules(s string) ([]MappingRule, error) {
+	var rules []MappingRule
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '\n' }) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rule, err := ParseMappingRule(line)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 || len(rules) > maxMappingRules {
+		return nil, ErrInvalidMapping
+	}
+	return rules, nil
+}
+
+// parseStoredMappingRules ignores invalid rules, which have been validated when saved.
+func parseStoredMappingRules(stored []string) []MappingRule {
+	rules := make([]MappingRule, 0, len(stored))
+	for _, s := range stored {
+		if rule, err := ParseMappingRule(s); err == nil {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// ApplyMappings builds the Slack payload from the values of the payload. Paths not found in the payload are
+// skipped. When no text is mapped, the payload is posted as JSON text, so nothing is lost.
+func ApplyMappings(rules []MappingRule, payload map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for _, rule := range rules {
+		value, ok := lookupPath(payload, rule.path)
+		if !ok || value == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case string, bool, float64:
+			ret[rule.Field] = v
+		default:
+			b, _ := json.Marshal(v)
+			ret[rule.Field] = string(b)
+		}
+	}
+	if _, ok := ret["text"]; !ok {
+		b, _ := json.Marshal(payload)
+		ret["text"] = "```" + string(b) + "```"
+	} else if _, ok := ret["text"].(string); !ok {
+		ret["text"] = fmt.Sprint(ret["text"])
+	}
+	// The text is moved into the attachment not to be shown twice.
+	if color, ok := ret[MappingFieldColor]; ok {
+		text := ret["text"]
+		delete(ret, MappingFieldColor)
+		delete(ret, "text")
+		ret["attachments"] = []interface{}{map[string]interface{}{"color": fmt.Sprint(color), "text": text, "fallback": text}}
+	}
+	return ret
+}
+
+func lookupPath(doc interface{}, path []interface{}) (interface{}, bool) {
+	current := doc
+	for _, segment := range path {
+		switch s := segment.(type) {
+		case string:
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if current, ok = obj[s]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := current.([]interface{})
+			if !ok || s >= len(arr) {
+				return nil, false
+			}
+			current = arr[s]
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseMappingRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseMappingRules("text <- $.alert.description; color <- $.labels['severity']\nusername <- $.sources[0]")
+	if err != nil {
+		t.Fatalf("ParseMappingRules failed: %s", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("Unexpected rules: %+v", rules)
+	}
+	if rules[1].String() != "color <- $.labels['severity']" {
+		t.Fatalf("Rules must keep the original path: %s", rules[1])
+	}
+	if !reflect.DeepEqual(rules[2].path, []interface{}{"sources", 0}) {
+		t.Fatalf("Unexpected path: %+v", rules[2].path)
+	}
+
+	for _, invalid := range []string{"", "text", "text <- alert", "text <- $.alert..description", "Text <- $.alert", "text <- $[x]"} {
+		if _, err := ParseMappingRules(invalid); !errors.Is(err, ErrInvalidMapping) {
+			t.Fatalf("Invalid rules must be rejected: %q, %v", invalid, err)
+		}
+	}
+}
+
+func TestApplyMappings(t *testing.T) {
+	t.Parallel()
+
+	payload := map[string]interface{}{
+		"alert":    map[string]interface{}{"description": "CPU usage is high", "tags": []interface{}{"prod"}},
+		"severity": "danger",
+	}
+	rules, err := ParseMappingRules("text <- $.alert.description; color <- $.severity; username <- $.missing; icon_emoji <- $.alert.tags")
+	if err != nil {
+		t.Fatalf("ParseMappingRules failed: %s", err)
+	}
+
+	got := ApplyMappings(rules, payload)
+	expected := map[string]interface{}{
+		"icon_emoji": `["prod"]`,
+		"attachments": []interface{}{map[string]interface{}{
+			"color":    "danger",
+			"text":     "CPU usage is high",
+			"fallback": "CPU usage is high",
+		}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Unexpected payload: %+v", got)
+	}
+}
+
+func TestApplyMappingsWithoutText(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseMappingRules("username <- $.source")
+	if err != nil {
+		t.Fatalf("ParseMappingRules failed: %s", err)
+	}
+
+	got := ApplyMappings(rules, map[string]interface{}{"source": "monitor"})
+	if got["username"] != "monitor" || got["text"] != "```{\"source\":\"monitor\"}```" {
+		t.Fatalf("The payload must be posted as JSON: %+v", got)
+	}
+}
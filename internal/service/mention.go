@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	textKey     = "text"
+	mentionsKey = "mentions"
+	// Handle of the user group to mention, e.g. `sre` or `@sre`.
+	oncallGroupKey = "oncall_group"
+)
+
+// Matches `@user@example.com` style mentions. Plain email addresses without the leading `@` are kept as is.
+var emailMentionPattern = regexp.MustCompile(`@([A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+
+type cachedUserID struct {
+	userID    string
+	found     bool
+	expiresAt time.Time
+}
+
+// MentionService translates email addresses in webhook payloads to Slack user mentions, so senders don't have
+// to know Slack user IDs. When the underlying lookup is nil, the feature is disabled and payloads are kept as is.
+//
+// Lookup results including not found ones are cached for the TTL to avoid hitting rate limits of
+// users.lookupByEmail.
+type MentionService struct {
+	lookup userLookup
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedUserID
+	// User group IDs by handles. usergroups.list returns all user groups, so the whole list is cached.
+	groupIDs          map[string]string
+	groupIDsExpiresAt time.Time
+}
+
+func NewMentionService(lookup userLookup, ttl time.Duration) *MentionService {
+	return &MentionService{lookup: lookup, ttl: ttl, cache: map[string]cachedUserID{}}
+}
+
+func (m *MentionService) Enabled() bool {
+	return m.lookup != nil
+}
+
+// ResolveMentions rewrites `@user@example.com` in `text` field to `<@U…>`, and prepends mentions of users in
+// `mentions` field (array of email addresses) and the user group of `oncall_group` field (handle) to `text`
+// field. `mentions` and `oncall_group` fields are removed from the payload. Unknown addresses and handles are kept
+// as plain text. Returns ErrInvalidMentions when `mentions` or `oncall_group` field is malformed.
+func (m *MentionService) ResolveMentions(ctx context.Context, payload map[string]interface{}) error {
+	if !m.Enabled() {
+		return nil
+	}
+
+	text, _ := payload[textKey].(string)
+	var resolveErr error
+	resolved := emailMentionPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if resolveErr != nil {
+			return match
+		}
+		email := strings.TrimPrefix(match, "@")
+		mention, err := m.mention(ctx, email)
+		if err != nil {
+			resolveErr = err
+			return match
+		}
+		return mention
+	})
+	if resolveErr != nil {
+		return resolveErr
+	}
+
+	if v, ok := payload[mentionsKey]; ok {
+		emails, ok := v.([]interface{})
+		if !ok {
+			return errors.Wrapf(ErrInvalidMentions, "`%s` field must be an array of email addresses: %v", mentionsKey, v)
+		}
+		mentions := make([]string, 0, len(emails))
+		for _, e := range emails {
+			email, ok := e.(string)
+			if !ok {
+				return errors.Wrapf(ErrInvalidMentions, "`%s` field must be an array of email addresses: %v", mentionsKey, v)
+			}
+			mention, err := m.mention(ctx, email)
+			if err != nil {
+				return err
+			}
+			mentions = append(mentions, mention)
+		}
+		delete(payload, mentionsKey)
+		if len(mentions) > 0 {
+			resolved = strings.TrimSpace(strings.Join(mentions, " ") + " " + resolved)
+		}
+	}
+
+	if v, ok := payload[oncallGroupKey]; ok {
+		handle, ok := v.(string)
+		handle = strings.TrimPrefix(strings.TrimSpace(handle), "@")
+		if !ok || handle == "" {
+			return errors.Wrapf(ErrInvalidMentions, "`%s` field must be a user group handle: %v", oncallGroupKey, v)
+		}
+		mention, err := m.groupMention(ctx, handle)
+		if err != nil {
+			return err
+		}
+		delete(payload, oncallGroupKey)
+		resolved = strings.TrimSpace(mention + " " + resolved)
+	}
+
+	if resolved != text {
+		payload[textKey] = resolved
+	}
+	return nil
+}
+
+// Returns the handle as plain text when no user group found.
+func (m *MentionService) groupMention(ctx context.Context, handle string) (string, error) {
+	now := time.Now()
+	m.mu.Lock()
+	groupIDs, expiresAt := m.groupIDs, m.groupIDsExpiresAt
+	m.mu.Unlock()
+	if groupIDs == nil || !now.Before(expiresAt) {
+		var err error
+		groupIDs, err = m.lookup.GetUserGroupIDsByHandle(ctx)
+		if err != nil {
+			return "", err
+		}
+		m.mu.Lock()
+		m.groupIDs, m.groupIDsExpiresAt = groupIDs, now.Add(m.ttl)
+		m.mu.Unlock()
+	}
+	id, ok := groupIDs[strings.ToLower(handle)]
+	if !ok {
+		return "@" + handle, nil
+	}
+	return fmt.Sprintf("<!subteam^%s>", id), nil
+}
+
+// Returns the email as is when no user found.
+func (m *MentionService) mention(ctx context.Context, email string) (string, error) {
+	userID, found, err := m.lookupUserID(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return email, nil
+	}
+	return fmt.Sprintf("<@%s>", userID), nil
+}
+
+func (m *MentionService) lookupUserID(ctx context.Context, email string) (string, bool, error) {
+	key := strings.ToLower(email)
+	now := time.Now()
+	m.mu.Lock()
+	cached, ok := m.cache[key]
+	m.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.userID, cached.found, nil
+	}
+
+	userID, found, err := m.lookup.LookupUserIDByEmail(ctx, email)
+	if err != nil {
+		return "", false, err
+	}
+	m.mu.Lock()
+	m.cache[key] = cachedUserID{userID: userID, found: found, expiresAt: now.Add(m.ttl)}
+	m.mu.Unlock()
+	return userID, found, nil
+}
+
+type userLookup interface {
+	// LookupUserIDByEmail returns found=false when no user has the email.
+	LookupUserIDByEmail(ctx context.Context, email string) (string, bool, error)
+	GetUserGroupIDsByHandle(ctx context.Context) (map[string]string, error)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+type testUserLookup struct {
+	users      map[string]string
+	groups     map[string]string
+	calls      int
+	groupCalls int
+}
+
+func (t *testUserLookup) LookupUserIDByEmail(ctx context.Context, email string) (string, bool, error) {
+	t.calls++
+	id, ok := t.users[email]
+	return id, ok, nil
+}
+
+func (t *testUserLookup) GetUserGroupIDsByHandle(ctx context.Context) (map[string]string, error) {
+	t.groupCalls++
+	return t.groups, nil
+}
+
+func TestResolveMentionsInText(t *testing.T) {
+	t.Parallel()
+
+	lookup := testUserLookup{users: map[string]string{"alice@example.com": "U111"}}
+	svc := NewMentionService(&lookup, time.Hour)
+	payload := map[string]interface{}{"text": "deploy failed, cc @alice@example.com @bob@example.com, contact ops@example.com"}
+	if err := svc.ResolveMentions(context.Background(), payload); err != nil {
+		t.Fatalf("ResolveMentions failed: %s", err)
+	}
+
+	expected := "deploy failed, cc <@U111> bob@example.com, contact ops@example.com"
+	if payload["text"] != expected {
+		t.Fatalf("Unexpected text: expected=%q, actual=%q", expected, payload["text"])
+	}
+}
+
+func TestResolveMentionsArray(t *testing.T) {
+	t.Parallel()
+
+	lookup := testUserLookup{users: map[string]string{"alice@example.com": "U111", "bob@example.com": "U222"}}
+	svc := NewMentionService(&lookup, time.Hour)
+	payload := map[string]interface{}{"text": "deploy failed", "mentions": []interface{}{"alice@example.com", "bob@example.com"}}
+	if err := svc.ResolveMentions(context.Background(), payload); err != nil {
+		t.Fatalf("ResolveMentions failed: %s", err)
+	}
+
+	if payload["text"] != "<@U111> <@U222> deploy failed" {
+		t.Fatalf("Unexpected text: %q", payload["text"])
+	}
+	if _, ok := payload["mentions"]; ok {
+		t.Fatalf("mentions field must be removed: %v", payload)
+	}
+}
+
+func TestResolveMentionsInvalidArray(t *testing.T) {
+	t.Parallel()
+
+	svc := NewMentionService(&testUserLookup{}, time.Hour)
+	payload := map[string]interface{}{"text": "hello", "mentions": "alice@example.com"}
+	if err := svc.ResolveMentions(context.Background(), payload); !errors.Is(err, ErrInvalidMentions) {
+		t.Fatalf("Non array mentions field must be rejected: %v", err)
+	}
+}
+
+func TestResolveMentionsCache(t *testing.T) {
+	t.Parallel()
+
+	lookup := testUserLookup{users: map[string]string{"alice@example.com": "U111"}}
+	svc := NewMentionService(&lookup, time.Hour)
+	for range 3 {
+		payload := map[string]interface{}{"text": "@alice@example.com @nobody@example.com"}
+		if err := svc.ResolveMentions(context.Background(), payload); err != nil {
+			t.Fatalf("ResolveMentions failed: %s", err)
+		}
+	}
+	if lookup.calls != 2 {
+		t.Fatalf("Lookup results including not found ones must be cached: calls=%d", lookup.calls)
+	}
+}
+
+func TestResolveMentionsDisabled(t *testing.T) {
+	t.Parallel()
+
+	svc := NewMentionService(nil, time.Hour)
+	payload := map[string]interface{}{"text": "@alice@example.com", "mentions": []interface{}{"alice@example.com"}}
+	if err := svc.ResolveMentions(context.Background(), payload); err != nil {
+		t.Fatalf("ResolveMentions failed: %s", err)
+	}
+	if payload["text"] != "@alice@example.com" {
+		t.Fatalf("Payload must be kept as is: %v", payload)
+	}
+}
+
+func TestResolveMentionsOncallGroup(t *testing.T) {
+	t.Parallel()
+
+	lookup := testUserLookup{
+		users:  map[string]string{"alice@example.com": "U111"},
+		groups: map[string]string{"sre": "S111"},
+	}
+	svc := NewMentionService(&lookup, time.Hour)
+	tests := []struct {
+		payload  map[string]interface{}
+		expected string
+	}{
+		{payload: map[string]interface{}{"text": "disk full", "oncall_group": "sre"}, expected: "<!subteam^S111> disk full"},
+		{payload: map[string]interface{}{"text": "disk full", "oncall_group": "@SRE", "mentions": []interface{}{"alice@example.com"}}, expected: "<!subteam^S111> <@U111> disk full"},
+		{payload: map[string]interface{}{"text": "disk full", "oncall_group": "dba"}, expected: "@dba disk full"},
+	}
+	for _, tt := range tests {
+		if err := svc.ResolveMentions(context.Background(), tt.payload); err != nil {
+			t.Fatalf("ResolveMentions failed: %s", err)
+		}
+		if tt.payload["text"] != tt.expected {
+			t.Fatalf("Unexpected text: expected=%q, actual=%q", tt.expected, tt.payload["text"])
+		}
+		if _, ok := tt.payload["oncall_group"]; ok {
+			t.Fatalf("oncall_group field must be removed: %v", tt.payload)
+		}
+	}
+	if lookup.groupCalls != 1 {
+		t.Fatalf("User groups must be cached: calls=%d", lookup.groupCalls)
+	}
+}
+
+func TestResolveMentionsInvalidOncallGroup(t *testing.T) {
+	t.Parallel()
+
+	svc := NewMentionService(&testUserLookup{}, time.Hour)
+	for _, v := range []interface{}{"", "@", 1, []interface{}{"sre"}} {
+		payload := map[string]interface{}{"text": "hello", "oncall_group": v}
+		if err := svc.ResolveMentions(context.Background(), payload); !errors.Is(err, ErrInvalidMentions) {
+			t.Fatalf("Invalid oncall_group field must be rejected: value=%v, err=%v", v, err)
+		}
+	}
+}
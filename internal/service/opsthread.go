@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// BeginOpsThread reserves the parent message of the ops thread of the channel for the day, so notifiers of
+// concurrent processes reply in one thread. found=true returns `ts` of the parent, which is empty while another
+// notifier is posting it. Otherwise post the parent, then call CompleteOpsThread or AbortOpsThread. Records are
+// stored in the idempotency table.
+func (s *IdempotencyService) BeginOpsThread(ctx context.Context, channel string, day string) (string, bool, error) {
+	if !s.Enabled() {
+		return "", false, nil
+	}
+
+	now := time.Now()
+	rec := storage.IdempotencyRecord{
+		Key:       opsThreadRecordKey(channel, day),
+		ExpiresAt: now.Add(idempotencyReservationTTL).Unix(),
+	}
+	err := s.ddb.ReserveIdempotencyRecord(ctx, rec, now.Unix())
+	if err == nil {
+		return "", false, nil
+	}
+	if !errors.Is(err, storage.ErrRecordAlreadyExists) {
+		return "", false, err
+	}
+
+	existing, found, err := s.ddb.GetIdempotencyRecord(ctx, rec.Key)
+	if err != nil {
+		return "", false, err
+	}
+	// Not found means the record has been deleted by AbortOpsThread just now, treat it as in progress.
+	if !found || !existing.Completed {
+		return "", true, nil
+	}
+	return existing.TS, true, nil
+}
+
+// CompleteOpsThread saves `ts` of the parent message until expiresAt, the end of the day.
+func (s *IdempotencyService) CompleteOpsThread(ctx context.Context, channel string, day string, ts string, expiresAt time.Time) error {
+	if !s.Enabled() {
+		return nil
+	}
+	rec := storage.IdempotencyRecord{
+		Key:       opsThreadRecordKey(channel, day),
+		Completed: true,
+		TS:        ts,
+		ExpiresAt: expiresAt.Unix(),
+	}
+	return s.ddb.SaveIdempotencyRecord(ctx, rec)
+}
+
+// AbortOpsThread releases the reservation so that the next notification posts the parent message.
+func (s *IdempotencyService) AbortOpsThread(ctx context.Context, channel string, day string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	return s.ddb.DeleteIdempotencyRecord(ctx, opsThreadRecordKey(channel, day))
+}
+
+// Ops channels are given by names, unlike channel IDs of idempotency keys, and the prefix avoids collisions anyway.
+func opsThreadRecordKey(channel string, day string) string {
+	return "ops-thread#" + channel + "/" + day
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+func TestOpsThread(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testIdempotencyStorage{recs: map[string]storage.IdempotencyRecord{}}
+	svc := NewIdempotencyService(&stg, time.Hour)
+
+	if _, found, err := svc.BeginOpsThread(ctx, "ops", "2024-01-01"); err != nil || found {
+		t.Fatalf("First notifier must post the parent: found=%v, err=%v", found, err)
+	}
+	// Notifiers while the parent is being posted get no ts.
+	ts, found, err := svc.BeginOpsThread(ctx, "ops", "2024-01-01")
+	if err != nil || !found || ts != "" {
+		t.Fatalf("Unexpected parent: ts=%s, found=%v, err=%v", ts, found, err)
+	}
+	if err := svc.CompleteOpsThread(ctx, "ops", "2024-01-01", "1405894322.002768", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CompleteOpsThread failed: %s", err)
+	}
+	ts, found, err = svc.BeginOpsThread(ctx, "ops", "2024-01-01")
+	if err != nil || !found || ts != "1405894322.002768" {
+		t.Fatalf("Unexpected parent: ts=%s, found=%v, err=%v", ts, found, err)
+	}
+	if _, found, _ := svc.BeginOpsThread(ctx, "ops", "2024-01-02"); found {
+		t.Fatal("Threads must be scoped by day")
+	}
+	if _, found, _ := svc.BeginOpsThread(ctx, "ops-alerts", "2024-01-01"); found {
+		t.Fatal("Threads must be scoped by channel")
+	}
+
+	if err := svc.AbortOpsThread(ctx, "ops-alerts", "2024-01-01"); err != nil {
+		t.Fatalf("AbortOpsThread failed: %s", err)
+	}
+	if _, found, _ := svc.BeginOpsThread(ctx, "ops-alerts", "2024-01-01"); found {
+		t.Fatal("Aborted parent must be posted")
+	}
+}
+
+func TestOpsThreadDisabled(t *testing.T) {
+	t.Parallel()
+
+	svc := NewIdempotencyService(nil, time.Hour)
+	if _, found, err := svc.BeginOpsThread(context.Background(), "ops", "2024-01-01"); err != nil || found {
+		t.Fatalf("Disabled service must not find parents: found=%v, err=%v", found, err)
+	}
+}
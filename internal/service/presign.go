@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/Finatext/belldog/internal/channelname"
+	"github.com/Finatext/belldog/internal/secret"
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+// Pre-signed URLs let third parties post to the channel for a while without the long-lived token: the URL has
+// the token prefix instead of the token, the expiry and the HMAC of them keyed by the token. Revoking the
+// token invalidates its pre-signed URLs.
+
+// PresignResult has the parts of the pre-signed URL: `/p/<channel_name>/<prefix>?expires=<unix>&signature=<hex>`.
+type PresignResult struct {
+	ChannelName string
+	Prefix      string
+	ExpiresAt   time.Time
+	Signature   string
+}
+
+// Presign signs the channel name and the expiry with the token. Returns ErrTokenNotFound or ErrTokenUnmatch when
+// the token is not valid for the channel.
+func (d *TokenService) Presign(ctx context.Context, channelName string, givenToken secret.Token, expiresAt time.Time) (PresignResult, error) {
+	channelName = channelname.Normalize(channelName)
+	recs, err := d.ddb.QueryByChannelName(ctx, channelName)
+	if err != nil {
+		return PresignResult{}, err
+	}
+	if len(recs) == 0 {
+		return PresignResult{}, ErrTokenNotFound
+	}
+	for _, rec := range recs {
+		if matches(rec, givenToken) {
+			return PresignResult{
+				ChannelName: channelName,
+				Prefix:      entryPrefix(rec),
+				ExpiresAt:   expiresAt,
+				Signature:   presignSignature(rec, expiresAt.Unix()),
+			}, nil
+		}
+	}
+	return PresignResult{}, ErrTokenUnmatch
+}
+
+// VerifyPresigned verifies the pre-signed URL. The result has ScopePost regardless of the token scope: pre-signed
+// URLs only post messages. Returns ErrPresignExpired after the expiry, and ErrTokenNotFound or ErrTokenUnmatch
+// for invalid URLs.
+func (d *TokenService) VerifyPresigned(ctx context.Context, channelName string, prefix string, expires string, signature string) (VerifyResult, error) {
+	channelName = channelname.Normalize(channelName)
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return VerifyResult{}, ErrTokenUnmatch
+	}
+	recs, err := d.ddb.QueryByChannelName(ctx, channelName)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	if len(recs) == 0 {
+		return VerifyResult{}, ErrTokenNotFound
+	}
+	for _, rec := range recs {
+		if entryPrefix(rec) != prefix || !hmac.Equal([]byte(presignSignature(rec, expiresAt)), []byte(signature)) {
+			continue
+		}
+		// Check the expiry after the signature not to tell anything about invalid URLs.
+		if time.Now().Unix() > expiresAt {
+			return VerifyResult{}, ErrPresignExpired
+		}
+		d.recordUsage(ctx, rec)
+		res := verifyResultOf(rec)
+		res.Scope = ScopePost
+		return res, nil
+	}
+	return VerifyResult{}, ErrTokenUnmatch
+}
+
+func presignSignature(rec storage.Record, expiresAt int64) string {
+	mac := hmac.New(sha256.New, []byte(rec.Token))
+	mac.Write([]byte("belldog-presign\n" + rec.ChannelName + "\n" + strconv.FormatInt(expiresAt, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+func TestPresignAndVerify(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopeManage)
+	if err != nil {
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
+	}
+	presigned, err := svc.Presign(ctx, channelName, res.Token, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Presign failed: %s", err)
+	}
+	if presigned.Prefix != res.Token.Prefix() {
+		t.Fatalf("Unexpected prefix: %s", presigned.Prefix)
+	}
+
+	verified, err := svc.VerifyPresigned(ctx, channelName, presigned.Prefix, presignedExpires(presigned), presigned.Signature)
+	if err != nil {
+		t.Fatalf("VerifyPresigned failed: %s", err)
+	}
+	if verified.ChannelID != channelID || verified.Scope != ScopePost {
+		t.Fatalf("Pre-signed URLs must only post: %+v", verified)
+	}
+
+	// Extending the expiry invalidates the signature.
+	if _, err := svc.VerifyPresigned(ctx, channelName, presigned.Prefix, presignedExpires(presigned)+"0", presigned.Signature); !errors.Is(err, ErrTokenUnmatch) {
+		t.Fatalf("Tampered expiry must be rejected: %v", err)
+	}
+	if _, err := svc.VerifyPresigned(ctx, anotherChannelName, presigned.Prefix, presignedExpires(presigned), presigned.Signature); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Other channels must be rejected: %v", err)
+	}
+	if _, err := svc.Presign(ctx, channelName, "invalid token", time.Now()); !errors.Is(err, ErrTokenUnmatch) {
+		t.Fatalf("Invalid tokens must not presign: %v", err)
+	}
+}
+
+func TestVerifyPresignedExpired(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
+	if err != nil {
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
+	}
+	presigned, err := svc.Presign(ctx, channelName, res.Token, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Presign failed: %s", err)
+	}
+	if _, err := svc.VerifyPresigned(ctx, channelName, presigned.Prefix, presignedExpires(presigned), presigned.Signature); !errors.Is(err, ErrPresignExpired) {
+		t.Fatalf("Expired URLs must be rejected: %v", err)
+	}
+}
+
+func presignedExpires(p PresignResult) string {
+	return strconv.FormatInt(p.ExpiresAt.Unix(), 10)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// Lambda runtimes don't have the time zone database.
+	_ "time/tzdata"
+)
+
+// QuietHours is a daily window of a channel in which non-critical messages are deferred to the end of the window.
+// Windows whose start is after the end span midnight, e.g. 22:00-07:00.
+type QuietHours struct {
+	// Minutes from midnight.
+	Start    int
+	End      int
+	Location *time.Location
+}
+
+// ParseQuietHours parses `HH:MM-HH:MM` with an optional IANA time zone, e.g. `22:00-07:00 Asia/Tokyo`. The time
+// zone defaults to UTC.
+func ParseQuietHours(value string) (QuietHours, bool) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return QuietHours{}, false
+	}
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return QuietHours{}, false
+	}
+	q := QuietHours{Location: time.UTC}
+	if q.Start, ok = parseClock(start); !ok {
+		return QuietHours{}, false
+	}
+	if q.End, ok = parseClock(end); !ok || q.Start == q.End {
+		return QuietHours{}, false
+	}
+	if len(fields) == 2 {
+		loc, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return QuietHours{}, false
+		}
+		q.Location = loc
+	}
+	return q, true
+}
+
+// Returns minutes from midnight of `HH:MM`.
+func parseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// WindowEnd returns the end of the window when now is in the window.
+func (q QuietHours) WindowEnd(now time.Time) (time.Time, bool) {
+	local := now.In(q.Location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, q.Location)
+	minutes := local.Hour()*60 + local.Minute()
+	at := func(day int, minutes int) time.Time {
+		// AddDate keeps the wall clock across DST changes.
+		return midnight.AddDate(0, 0, day).Add(time.Duration(minutes) * time.Minute)
+	}
+	switch {
+	case q.Start < q.End:
+		if q.Start <= minutes && minutes < q.End {
+			return at(0, q.End), true
+		}
+	case minutes >= q.Start:
+		return at(1, q.End), true
+	case minutes < q.End:
+		return at(0, q.End), true
+	}
+	return time.Time{}, false
+}
+
+func (q QuietHours) String() string {
+	clock := func(minutes int) string { return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60) }
+	return fmt.Sprintf("%s-%s %s", clock(q.Start), clock(q.End), q.Location)
+}
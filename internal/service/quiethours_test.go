@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value    string
+		expected string
+		ok       bool
+	}{
+		{value: "22:00-07:00 Asia/Tokyo", expected: "22:00-07:00 Asia/Tokyo", ok: true},
+		{value: "9:30-12:00", expected: "09:30-12:00 UTC", ok: true},
+		{value: " 22:00-07:00   UTC ", expected: "22:00-07:00 UTC", ok: true},
+		{value: "22:00-22:00"},
+		{value: "22:00"},
+		{value: "25:00-07:00"},
+		{value: "22:00-07:00 Mars/Olympus"},
+		{value: "22:00-07:00 Asia/Tokyo extra"},
+		{value: ""},
+	}
+	for _, tt := range tests {
+		q, ok := ParseQuietHours(tt.value)
+		if ok != tt.ok {
+			t.Fatalf("Unexpected result: value=%q, ok=%v", tt.value, ok)
+		}
+		if ok && q.String() != tt.expected {
+			t.Fatalf("Unexpected quiet hours: expected=%q, actual=%q", tt.expected, q.String())
+		}
+	}
+}
+
+func TestQuietHoursWindowEnd(t *testing.T) {
+	t.Parallel()
+
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	overnight, _ := ParseQuietHours("22:00-07:00 Asia/Tokyo")
+	daytime, _ := ParseQuietHours("12:00-13:00 Asia/Tokyo")
+	tests := []struct {
+		quietHours QuietHours
+		now        time.Time
+		expected   time.Time
+	}{
+		{quietHours: overnight, now: time.Date(2024, 1, 1, 23, 30, 0, 0, tokyo), expected: time.Date(2024, 1, 2, 7, 0, 0, 0, tokyo)},
+		{quietHours: overnight, now: time.Date(2024, 1, 2, 6, 59, 0, 0, tokyo), expected: time.Date(2024, 1, 2, 7, 0, 0, 0, tokyo)},
+		{quietHours: overnight, now: time.Date(2024, 1, 1, 22, 0, 0, 0, tokyo), expected: time.Date(2024, 1, 2, 7, 0, 0, 0, tokyo)},
+		// Given in UTC: 2024-01-01 14:00 UTC is 23:00 JST.
+		{quietHours: overnight, now: time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC), expected: time.Date(2024, 1, 2, 7, 0, 0, 0, tokyo)},
+		{quietHours: overnight, now: time.Date(2024, 1, 2, 7, 0, 0, 0, tokyo)},
+		{quietHours: overnight, now: time.Date(2024, 1, 2, 12, 0, 0, 0, tokyo)},
+		{quietHours: daytime, now: time.Date(2024, 1, 2, 12, 30, 0, 0, tokyo), expected: time.Date(2024, 1, 2, 13, 0, 0, 0, tokyo)},
+		{quietHours: daytime, now: time.Date(2024, 1, 2, 23, 0, 0, 0, tokyo)},
+	}
+	for _, tt := range tests {
+		end, ok := tt.quietHours.WindowEnd(tt.now)
+		if ok != !tt.expected.IsZero() || !end.Equal(tt.expected) {
+			t.Fatalf("Unexpected window end: now=%s, expected=%s, actual=%s, ok=%v", tt.now, tt.expected, end, ok)
+		}
+	}
+}
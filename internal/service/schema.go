@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Payload schemas reject malformed webhook payloads of automated callers before posting to the channel. Schemas
+// are a subset of JSON Schema: `type`, `enum`, `const`, `properties`, `required`, `additionalProperties` (boolean
+// only), `items`, `minItems`, `maxItems`, `minLength`, `maxLength`, `pattern`, `minimum` and `maximum`. Other
+// keywords are rejected, so schemas never pass silently because of unsupported keywords.
+
+// Schemas longer than this are rejected to keep channel configs small.
+const maxPayloadSchemaLen = 4000
+
+// Violations more than this are not reported.
+const maxSchemaViolations = 10
+
+var schemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// PayloadSchema is the compiled schema of webhook payloads.
+type PayloadSchema struct {
+	root *schemaNode
+	// The compacted schema to show and save.
+	raw string
+}
+
+type schemaNode struct {
+	types                []string
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	properties           map[string]*schemaNode
+	required             []string
+	additionalProperties *bool
+	items                *schemaNode
+	minItems             *int
+	maxItems             *int
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	minimum              *float64
+	maximum              *float64
+}
+
+func (s *PayloadSchema) String() string {
+	return s.raw
+}
+
+// ParsePayloadSchema compiles the JSON schema. Returns ErrInvalidConfigValue for invalid or unsupported schemas.
+func ParsePayloadSchema(s string) (*PayloadSchema, error) {
+	var compacted bytes.Buffer
+	if len(s) > maxPayloadSchemaLen || json.Compact(&compacted, []byte(s)) != nil {
+		return nil, ErrInvalidConfigValue
+	}
+	var v interface{}
+	if err := json.Unmarshal(compacted.Bytes(), &v); err != nil {
+		return nil, ErrInvalidConfigValue
+	}
+	root, err := compileSchemaNode(v)
+	if err != nil {
+		return nil, err
+	}
+	return &PayloadSchema{root: root, raw: compacted.String()}, nil
+}
+
+func compileSchemaNode(v interface{}) (*schemaNode, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidConfigValue
+	}
+	node := &schemaNode{}
+	for key, value := range obj {
+		var ok bool
+		switch key {
+		// Annotations, not validated.
+		case "$schema", "$id", "title", "description", "examples":
+			ok = true
+		case "type":
+			node.types, ok = compileSchemaTypes(value)
+		case "enum":
+			node.enum, ok = value.([]interface{})
+		case "const":
+			node.constValue, node.hasConst, ok = value, true, true
+		case "properties":
+			var props map[string]interface{}
+			if props, ok = value.(map[string]interface{}); ok {
+				node.properties = make(map[string]*schemaNode, len(props))
+				for name, prop := range props {
+					child, err := compileSchemaNode(prop)
+					if err != nil {
+						return nil, err
+					}
+					node.properties[name] = child
+				}
+			}
+		case "required":
+			node.required, ok = compileStrings(value)
+		case "additionalProperties":
+			var b bool
+			b, ok = value.(bool)
+			node.additionalProperties = &b
+		case "items":
+			child, err := compileSchemaNode(value)
+			if err != nil {
+				return nil, err
+			}
+			node.items, ok = child, true
+		case "minItems":
+			node.minItems, ok = compileCount(value)
+		case "maxItems":
+			node.maxItems, ok = compileCount(value)
+		case "minLength":
+			node.minLength, ok = compileCount(value)
+		case "maxLength":
+			node.maxLength, ok = compileCount(value)
+		case "pattern":
+			var p string
+			if p, ok = value.(string); ok {
+				re, err := regexp.Compile(p)
+				node.pattern, ok = re, err == nil
+			}
+		case "minimum":
+			node.minimum, ok = compileNumber(value)
+		case "maximum":
+			node.maximum, ok = compileNumber(value)
+		}
+		if !ok {
+			return nil, ErrInvalidConfigValue
+		}
+	}
+	return node, nil
+}
+
+func compileSchemaTypes(v interface{}) ([]string, bool) {
+	if s, ok := v.(string); ok {
+		v = []interface{}{s}
+	}
+	types, ok := compileStrings(v)
+	if !ok || len(types) == 0 {
+		return nil, false
+	}
+	for _, t := range types {
+		if !slices.Contains(schemaTypes, t) {
+			return nil, false
+		}
+	}
+	return types, true
+}
+
+func compileStrings(v interface{}) ([]string, bool) {
+	values, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	ret := make([]string, 0, len(values))
+	for _, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, s)
+	}
+	return ret, true
+}
+
+func compileCount(v interface{}) (*int, bool) {
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, false
+	}
+	n := int(f)
+	return &n, true
+}
+
+func compileNumber(v interface{}) (*float64, bool) {
+	f, ok := v.(float64)
+	return &f, ok
+}
+
+// Validate returns the violations of the payload, e.g. `$.text: required`. Empty when the payload is valid.
+func (s *PayloadSchema) Validate(payload map[string]interface{}) []string {
+	var violations []string
+	s.root.validate("$", payload, &violations)
+	return violations
+}
+
+func (n *schemaNode) validate(path string, v interface{}, violations *[]string) {
+	report := func(format string, args ...interface{}) {
+		*violations = appendViolation(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+	if len(n.types) > 0 && !slices.ContainsFunc(n.types, func(t string) bool { return isSchemaType(t, v) }) {
+		report("must be %s", strings.Join(n.types, " or "))
+		// Other keywords would report confusing violations of the wrong type.
+		return
+	}
+	if n.hasConst && !reflect.DeepEqual(n.constValue, v) {
+		report("must be %s", formatSchemaValue(n.constValue))
+	}
+	if len(n.enum) > 0 && !slices.ContainsFunc(n.enum, func(e interface{}) bool { return reflect.DeepEqual(e, v) }) {
+		values := make([]string, 0, len(n.enum))
+		for _, e := range n.enum {
+			values = append(values, formatSchemaValue(e))
+		}
+		report("must be one of %s", strings.Join(values, ", "))
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range n.required {
+			if _, ok := v[name]; !ok {
+				*violations = appendViolation(*violations, childPath(path, name)+": required")
+			}
+		}
+		// Sort to report in a stable order.
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if child, ok := n.properties[name]; ok {
+				child.validate(childPath(path, name), v[name], violations)
+			} else if n.additionalProperties != nil && !*n.additionalProperties {
+				*violations = appendViolation(*violations, childPath(path, name)+": not allowed")
+			}
+		}
+	case []interface{}:
+		if n.minItems != nil && len(v) < *n.minItems {
+			report("must have at least %d items", *n.minItems)
+		}
+		if n.maxItems != nil && len(v) > *n.maxItems {
+			report("must have at most %d items", *n.maxItems)
+		}
+		if n.items != nil {
+			for i, item := range v {
+				n.items.validate(path+"["+strconv.Itoa(i)+"]", item, violations)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n.minLength != nil && length < *n.minLength {
+			report("must be at least %d characters", *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			report("must be at most %d characters", *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			report("must match %s", n.pattern.String())
+		}
+	case float64:
+		if n.minimum != nil && v < *n.minimum {
+			report("must be >= %s", formatSchemaValue(*n.minimum))
+		}
+		if n.maximum != nil && v > *n.maximum {
+			report("must be <= %s", formatSchemaValue(*n.maximum))
+		}
+	}
+}
+
+func appendViolation(violations []string, violation string) []string {
+	if len(violations) >= maxSchemaViolations {
+		return violations
+	}
+	return append(violations, violation)
+}
+
+var schemaPathKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// childPath returns the path of the property in the same syntax as mapping rules.
+func childPath(path string, name string) string {
+	if schemaPathKeyPattern.MatchString(name) {
+		return path + "." + name
+	}
+	return path + "['" + name + "']"
+}
+
+func isSchemaType(t string, v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return t == "object"
+	case []interface{}:
+		return t == "array"
+	case string:
+		return t == "string"
+	case float64:
+		return t == "number" || (t == "integer" && v == math.Trunc(v))
+	case bool:
+		return t == "boolean"
+	case nil:
+		return t == "null"
+	default:
+		return false
+	}
+}
+
+func formatSchemaValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
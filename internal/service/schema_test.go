@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPayloadSchema = `{
+  "type": "object",
+  "required": ["text", "severity"],
+  "additionalProperties": false,
+  "properties": {
+    "text": {"type": "string", "minLength": 1, "maxLength": 20},
+    "severity": {"enum": ["info", "critical"]},
+    "count": {"type": "integer", "minimum": 0},
+    "tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "pattern": "^[a-z]+$"}},
+    "source": {"const": "ci"}
+  }
+}`
+
+func TestParsePayloadSchema(t *testing.T) {
+	t.Parallel()
+
+	schema, err := ParsePayloadSchema(testPayloadSchema)
+	if err != nil {
+		t.Fatalf("ParsePayloadSchema failed: %s", err)
+	}
+	if strings.ContainsAny(schema.String(), " \n") {
+		t.Fatalf("Schema must be compacted: %s", schema)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"{",
+		`"object"`,
+		`{"type": "map"}`,
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"properties": {"text": {"type": "str"}}}`,
+		`{"additionalProperties": {"type": "string"}}`,
+		`{"minLength": -1}`,
+		`{"pattern": "("}`,
+	} {
+		if _, err := ParsePayloadSchema(invalid); !errors.Is(err, ErrInvalidConfigValue) {
+			t.Fatalf("Invalid schema must be rejected: %q, %v", invalid, err)
+		}
+	}
+}
+
+func TestPayloadSchemaValidate(t *testing.T) {
+	t.Parallel()
+
+	schema, err := ParsePayloadSchema(testPayloadSchema)
+	if err != nil {
+		t.Fatalf("ParsePayloadSchema failed: %s", err)
+	}
+	valid := map[string]interface{}{"text": "deployed", "severity": "info", "count": float64(3), "tags": []interface{}{"prod"}, "source": "ci"}
+	if violations := schema.Validate(valid); len(violations) != 0 {
+		t.Fatalf("Valid payload must pass: %v", violations)
+	}
+
+	invalid := map[string]interface{}{
+		"text":     "",
+		"count":    1.5,
+		"tags":     []interface{}{"prod", "Staging", "dev"},
+		"source":   "cron",
+		"channel":  "C999",
+		"severity": "warning",
+	}
+	expected := []string{
+		"$.channel: not allowed",
+		"$.count: must be integer",
+		"$.severity: must be one of \"info\", \"critical\"",
+		"$.source: must be \"ci\"",
+		"$.tags: must have at most 2 items",
+		"$.tags[1]: must match ^[a-z]+$",
+		"$.text: must be at least 1 characters",
+	}
+	if violations := schema.Validate(invalid); !reflect.DeepEqual(violations, expected) {
+		t.Fatalf("Unexpected violations: %q", violations)
+	}
+	if violations := schema.Validate(map[string]interface{}{}); !reflect.DeepEqual(violations, []string{"$.text: required", "$.severity: required"}) {
+		t.Fatalf("Missing fields must be reported: %q", violations)
+	}
+}
+
+func TestPayloadSchemaValidateLimitsViolations(t *testing.T) {
+	t.Parallel()
+
+	schema, err := ParsePayloadSchema(`{"additionalProperties": false}`)
+	if err != nil {
+		t.Fatalf("ParsePayloadSchema failed: %s", err)
+	}
+	payload := map[string]interface{}{}
+	for _, key := range "abcdefghijkl" {
+		payload[string(key)] = true
+	}
+	if violations := schema.Validate(payload); len(violations) != maxSchemaViolations {
+		t.Fatalf("Violations must be limited: %q", violations)
+	}
+}
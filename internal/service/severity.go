@@ -0,0 +1,117 @@
+package service
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Severity is the `severity` field of webhook payloads, which senders give instead of attachment colors, so
+// messages of heterogeneous senders look consistent.
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+	SeverityOK       Severity = "ok"
+)
+
+// SeverityField is not a chat.postMessage argument: it is removed from payloads.
+const SeverityField = "severity"
+
+var Severities = []Severity{SeverityInfo, SeverityWarning, SeverityCritical, SeverityOK}
+
+// Colors used unless the channel overrides them. `good`, `warning` and `danger` are Slack's named colors.
+var defaultSeverityColors = map[Severity]string{
+	SeverityInfo:     "#439FE0",
+	SeverityWarning:  "warning",
+	SeverityCritical: "danger",
+	SeverityOK:       "good",
+}
+
+var (
+	severityColorPattern = regexp.MustCompile(`^(?:#[0-9A-Fa-f]{6}|good|warning|danger)$`)
+	severityEmojiPattern = regexp.MustCompile(`^:[a-z0-9_+'-]+:$`)
+)
+
+func ParseSeverity(s string) (Severity, bool) {
+	severity := Severity(strings.ToLower(strings.TrimSpace(s)))
+	return severity, slices.Contains(Severities, severity)
+}
+
+// ApplySeverity removes the severity field of the payload and colors the message with the severity. The text
+// is prefixed with the emoji of the severity if the channel configures it. Attachments having their own colors
+// are kept as is. Invalid severities are ignored, which have been rejected by webhook handlers.
+func (d ChannelDefaults) ApplySeverity(payload map[string]interface{}) {
+	value, exists := payload[SeverityField]
+	if !exists {
+		return
+	}
+	delete(payload, SeverityField)
+	s, _ := value.(string)
+	severity, ok := ParseSeverity(s)
+	if !ok {
+		return
+	}
+	color := defaultSeverityColors[severity]
+	if c, ok := d.SeverityColors[severity]; ok {
+		color = c
+	}
+	text, _ := payload["text"].(string)
+	if emoji, ok := d.SeverityEmoji[severity]; ok && text != "" {
+		text = emoji + " " + text
+		payload["text"] = text
+	}
+
+	if attachments, ok := payload["attachments"].([]interface{}); ok && len(attachments) > 0 {
+		for _, a := range attachments {
+			if attachment, ok := a.(map[string]interface{}); ok {
+				if _, ok := attachment["color"]; !ok {
+					attachment["color"] = color
+				}
+			}
+		}
+		return
+	}
+	// Colors are only available for attachments: move the blocks or the text into an attachment. The text is
+	// kept as the notification text of blocks.
+	if blocks, ok := payload["blocks"]; ok {
+		delete(payload, "blocks")
+		payload["attachments"] = []interface{}{map[string]interface{}{"color": color, "blocks": blocks}}
+		return
+	}
+	if text != "" {
+		delete(payload, "text")
+		payload["attachments"] = []interface{}{map[string]interface{}{"color": color, "text": text, "fallback": text}}
+	}
+}
+
+// parseSeverityMap parses `<severity>=<value>` pairs separated by commas, e.g. `critical=danger,ok=good`.
+func parseSeverityMap(value string, valid *regexp.Regexp) (map[Severity]string, bool) {
+	ret := map[Severity]string{}
+	if value == "" {
+		return ret, true
+	}
+	for _, pair := range strings.Split(value, ",") {
+		k, v, found := strings.Cut(pair, "=")
+		severity, ok := ParseSeverity(k)
+		v = strings.TrimSpace(v)
+		if !found || !ok || !valid.MatchString(v) {
+			return nil, false
+		}
+		ret[severity] = v
+	}
+	return ret, true
+}
+
+// formatSeverityMap formats the map in the order of Severities, the inverse of parseSeverityMap.
+func formatSeverityMap(m map[Severity]string) string {
+	pairs := make([]string, 0, len(m))
+	for _, severity := range Severities {
+		if v, ok := m[severity]; ok {
+			pairs = append(pairs, string(severity)+"="+v)
+		}
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/storage"
+)
+
+func TestApplySeverity(t *testing.T) {
+	t.Parallel()
+
+	defaults := ChannelDefaults{SeverityEmoji: map[Severity]string{SeverityCritical: ":rotating_light:"}}
+	payload := map[string]interface{}{"text": "Disk full", "severity": "CRITICAL"}
+	defaults.ApplySeverity(payload)
+	expected := map[string]interface{}{
+		"attachments": []interface{}{map[string]interface{}{
+			"color":    "danger",
+			"text":     ":rotating_light: Disk full",
+			"fallback": ":rotating_light: Disk full",
+		}},
+	}
+	if !reflect.DeepEqual(payload, expected) {
+		t.Fatalf("Unexpected payload: %+v", payload)
+	}
+
+	defaults = ChannelDefaults{SeverityColors: map[Severity]string{SeverityOK: "#00FF00"}}
+	blocks := []interface{}{map[string]interface{}{"type": "divider"}}
+	payload = map[string]interface{}{"text": "Recovered", "blocks": blocks, "severity": "ok"}
+	defaults.ApplySeverity(payload)
+	expected = map[string]interface{}{
+		"text":        "Recovered",
+		"attachments": []interface{}{map[string]interface{}{"color": "#00FF00", "blocks": blocks}},
+	}
+	if !reflect.DeepEqual(payload, expected) {
+		t.Fatalf("Blocks must be moved into the attachment: %+v", payload)
+	}
+
+	payload = map[string]interface{}{
+		"severity":    "warning",
+		"attachments": []interface{}{map[string]interface{}{"text": "a"}, map[string]interface{}{"text": "b", "color": "good"}},
+	}
+	ChannelDefaults{}.ApplySeverity(payload)
+	expected = map[string]interface{}{
+		"attachments": []interface{}{map[string]interface{}{"text": "a", "color": "warning"}, map[string]interface{}{"text": "b", "color": "good"}},
+	}
+	if !reflect.DeepEqual(payload, expected) {
+		t.Fatalf("Colors of attachments must be kept: %+v", payload)
+	}
+}
+
+func TestChannelConfigSeverity(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := testChannelConfigStorage{recs: map[string]storage.ChannelConfigRecord{}}
+	svc := NewChannelConfigService(&stg)
+
+	updated, err := svc.SetDefault(ctx, channelID, ChannelConfigKeySeverityColors, "ok=#00ff00, Critical=danger")
+	if err != nil {
+		t.Fatalf("SetDefault failed: %s", err)
+	}
+	if got := updated.Values()[ChannelConfigKeySeverityColors]; got != "critical=danger,ok=#00ff00" {
+		t.Fatalf("Colors must be normalized: %s", got)
+	}
+
+	for _, invalid := range [][2]string{
+		{ChannelConfigKeySeverityColors, "critical=red"},
+		{ChannelConfigKeySeverityColors, "fatal=danger"},
+		{ChannelConfigKeySeverityEmoji, "critical=fire"},
+	} {
+		if _, err := svc.SetDefault(ctx, channelID, invalid[0], invalid[1]); !errors.Is(err, ErrInvalidConfigValue) {
+			t.Fatalf("Invalid value must be rejected: %v, %v", invalid, err)
+		}
+	}
+}
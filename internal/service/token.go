@@ -3,59 +3,101 @@ package service
 import (
 	"context"
 	"crypto/hmac"
-	"crypto/rand"
-	"fmt"
+	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/cockroachdb/errors"
 
+	"github.com/Finatext/belldog/internal/channelname"
+	"github.com/Finatext/belldog/internal/secret"
 	"github.com/Finatext/belldog/internal/storage"
 )
 
+// Scope restricts what a token can do.
+type Scope string
+
+const (
+	// Only posts and schedules messages.
+	ScopePost Scope = "post"
+	// Also updates and deletes messages and uploads files.
+	ScopeManage Scope = "manage"
+)
+
+// ParseScope returns ErrInvalidScope for unknown scopes.
+func ParseScope(s string) (Scope, error) {
+	switch Scope(s) {
+	case ScopePost, ScopeManage:
+		return Scope(s), nil
+	default:
+		return "", ErrInvalidScope
+	}
+}
+
+// Allows tells whether a token having this scope can do operations requiring the given scope.
+func (s Scope) Allows(required Scope) bool {
+	return s == ScopeManage || s == required
+}
+
+// Tokens generated before scopes were introduced keep working for all endpoints.
+func scopeOf(rec storage.Record) Scope {
+	if rec.Scope == "" {
+		return ScopeManage
+	}
+	return Scope(rec.Scope)
+}
+
 // TODO: Remove this extra layer, merge this to storage.Record.
 type Entry struct {
-	Token     string
+	Token secret.Token
+	// Non-secret prefix of the token to reference it in messages.
+	Prefix    string
 	Version   int
 	CreatedAt time.Time
+	Scope     Scope
+	Mappings  []MappingRule
 }
 
 type VerifyResult struct {
-	NotFound    bool
-	Unmatch     bool
 	ChannelID   string
 	ChannelName string
+	Scope       Scope
+	Version     int
+	TokenPrefix string
+	// Zero for records having invalid created_at.
+	CreatedAt time.Time
+	// Empty when the payload is a Slack payload.
+	Mappings []MappingRule
+	// Consecutive delivery failures of the token, see RecordDeliveryFailure.
+	DeliveryFailures int
 }
 
 type GenerateResult struct {
 	IsGenerated bool
-	Token       string
+	Token       secret.Token
 }
 
 type RegenerateResult struct {
-	NoTokenFound bool
-	TooManyToken bool
-	Token        string
-}
-
-type RevokeResult struct {
-	NotFound bool
+	Token secret.Token
 }
 
-type RevokeRenamedResult struct {
-	NotFound         bool
-	ChannelIDUnmatch bool
-	LinkedChannelID  string
+type LookupResult struct {
+	ChannelID   string
+	ChannelName string
 }
 
 type TokenService struct {
 	ddb ddb
+	// Revoked tokens can be restored during this period. Zero deletes revoked tokens immediately.
+	revokeGracePeriod time.Duration
 }
 
-func NewTokenService(ddb ddb) TokenService {
-	return TokenService{ddb: ddb}
+func NewTokenService(ddb ddb, revokeGracePeriod time.Duration) TokenService {
+	return TokenService{ddb: ddb, revokeGracePeriod: revokeGracePeriod}
 }
 
 func (d *TokenService) GetTokens(ctx context.Context, channelName string) ([]Entry, error) {
+	channelName = channelname.Normalize(channelName)
 	recs, err := d.ddb.QueryByChannelName(ctx, channelName)
 	if err != nil {
 		return []Entry{}, err
@@ -72,145 +114,356 @@ func (d *TokenService) GetTokens(ctx context.Context, channelName string) ([]Ent
 }
 
 // VerifyToken checks given token and existin token. It returns VerifyResult.
-// Need to check the returned VerifyResult.NotFound and .Unmatch.
-// Returns an error when underlying storage goes wrong.
-func (d *TokenService) VerifyToken(ctx context.Context, channelName string, givenToken string) (VerifyResult, error) {
+// Returns ErrTokenNotFound or ErrTokenUnmatch when the token is not valid, other errors when underlying
+// storage goes wrong.
+func (d *TokenService) VerifyToken(ctx context.Context, channelName string, givenToken secret.Token) (VerifyResult, error) {
+	channelName = channelname.Normalize(channelName)
 	recs, err := d.ddb.QueryByChannelName(ctx, channelName)
 	if err != nil {
 		return VerifyResult{}, err
 	}
-	if len(recs) == 0 {
-		return VerifyResult{NotFound: true}, nil
+	return d.verifyRecords(ctx, recs, givenToken)
+}
+
+// VerifyTokenByChannelID is VerifyToken for channel ID based URLs, which survive channel renames.
+// The returned ChannelName is the channel name when the token was generated.
+func (d *TokenService) VerifyTokenByChannelID(ctx context.Context, channelID string, givenToken secret.Token) (VerifyResult, error) {
+	recs, err := d.ddb.QueryByChannelID(ctx, channelID)
+	if err != nil {
+		return VerifyResult{}, err
 	}
+	return d.verifyRecords(ctx, recs, givenToken)
+}
 
+func (d *TokenService) verifyRecords(ctx context.Context, recs []storage.Record, givenToken secret.Token) (VerifyResult, error) {
+	if len(recs) == 0 {
+		return VerifyResult{}, ErrTokenNotFound
+	}
 	for _, rec := range recs {
-		existingToken := rec.Token
-		res := hmac.Equal([]byte(existingToken), []byte(givenToken))
-		if res {
-			return VerifyResult{NotFound: false, ChannelID: rec.ChannelID, ChannelName: rec.ChannelName}, nil
+		if matches(rec, givenToken) {
+			d.recordUsage(ctx, rec)
+			return verifyResultOf(rec), nil
 		}
 	}
-	return VerifyResult{Unmatch: true}, nil
+	return VerifyResult{}, ErrTokenUnmatch
+}
+
+// Stale tokens are revoked after days of inactivity, so updating hourly is precise enough and saves writes.
+const usageUpdateInterval = time.Hour
+
+// recordUsage updates last_used_at of the record for the stale token cleanup. Failures are only logged to not
+// fail webhook requests.
+func (d *TokenService) recordUsage(ctx context.Context, rec storage.Record) {
+	if last, err := time.Parse(time.RFC3339Nano, rec.LastUsedAt); err == nil && time.Since(last) < usageUpdateInterval {
+		return
+	}
+	if err := d.ddb.UpdateLastUsedAt(ctx, rec, currentTimestamp()); err != nil {
+		slog.WarnContext(ctx, "failed to record token usage", slog.String("error", err.Error()), slog.String("channel_name", rec.ChannelName))
+	}
 }
 
 // GenerateAndSaveToken returns a GenerateResult which contains secure random string as token.
 // Then it saves the generated token to storage. This checks existing generated token in storage.
-// If found, returns the generated token.
-func (d *TokenService) GenerateAndSaveToken(ctx context.Context, channelID string, channelName string) (GenerateResult, error) {
+// If found, returns the generated token. When another request saves a token concurrently, this
+// returns the token saved by the other request. The scope of the existing token is not changed.
+func (d *TokenService) GenerateAndSaveToken(ctx context.Context, channelID string, channelName string, scope Scope) (GenerateResult, error) {
+	channelName = channelname.Normalize(channelName)
+	for i := 0; i < maxSaveAttempts; i++ {
+		recs, err := d.ddb.QueryByChannelName(ctx, channelName)
+		if err != nil {
+			return GenerateResult{}, err
+		}
+		if len(recs) > 0 {
+			rec := recs[0]
+			res := GenerateResult{IsGenerated: false, Token: secret.Token(rec.Token)}
+			return res, nil
+		}
+
+		gen := generatorImpl{}
+		token, err := gen.generate()
+		if err != nil {
+			return GenerateResult{}, err
+		}
+
+		record := storage.Record{
+			ChannelID:   channelID,
+			ChannelName: channelName,
+			Token:       token.Reveal(),
+			TokenPrefix: token.Prefix(),
+			Version:     0,
+			CreatedAt:   currentTimestamp(),
+			Scope:       string(scope),
+		}
+		if err := d.ddb.Save(ctx, record); err != nil {
+			if errors.Is(err, storage.ErrRecordAlreadyExists) {
+				slog.InfoContext(ctx, "token saved concurrently, retrying", slog.String("channel_name", channelName), slog.Int("attempt", i+1))
+				continue
+			}
+			return GenerateResult{}, err
+		}
+
+		res := GenerateResult{IsGenerated: true, Token: token}
+		return res, nil
+	}
+	return GenerateResult{}, errors.Newf("failed to save token due to conflicts: channel_name=%s, attempts=%d", channelName, maxSaveAttempts)
+}
+
+// Concurrent slash commands for the same channel are rare, so a few attempts are enough.
+const maxSaveAttempts = 3
+
+// RegenerateToken allows generate another token for the given channel. If the channel already has
+// maxTokenCount tokens, it returns ErrTooManyToken. When another request saves a token
+// with the same version concurrently, this retries with the next version. The new token has the same scope
+// as the latest token, so clients can be migrated to the new token.
+func (d *TokenService) RegenerateToken(ctx context.Context, channelID string, channelName string, maxTokenCount int) (RegenerateResult, error) {
+	channelName = channelname.Normalize(channelName)
+	for i := 0; i < maxSaveAttempts; i++ {
+		recs, err := d.ddb.QueryByChannelName(ctx, channelName)
+		if err != nil {
+			return RegenerateResult{}, err
+		}
+		if len(recs) == 0 {
+			return RegenerateResult{}, ErrNoTokenFound
+		}
+		if len(recs) >= maxTokenCount {
+			return RegenerateResult{}, ErrTooManyToken
+		}
+
+		gen := generatorImpl{}
+		token, err := generateWithRetry(recs, &gen)
+		if err != nil {
+			return RegenerateResult{}, errors.Wrapf(err, "same token generated: token=%s", token)
+		}
+
+		record := storage.Record{
+			ChannelID:   channelID,
+			ChannelName: channelName,
+			Token:       token.Reveal(),
+			TokenPrefix: token.Prefix(),
+			Version:     latestVersion(recs) + 1,
+			CreatedAt:   currentTimestamp(),
+			Scope:       string(scopeOf(latestRecord(recs))),
+			Mappings:    latestRecord(recs).Mappings,
+		}
+		if err := d.ddb.Save(ctx, record); err != nil {
+			if errors.Is(err, storage.ErrRecordAlreadyExists) {
+				slog.InfoContext(ctx, "token saved concurrently, retrying", slog.String("channel_name", channelName), slog.Int("attempt", i+1))
+				continue
+			}
+			return RegenerateResult{}, err
+		}
+		return RegenerateResult{Token: token}, nil
+	}
+	return RegenerateResult{}, errors.Newf("failed to save token due to conflicts: channel_name=%s, attempts=%d", channelName, maxSaveAttempts)
+}
+
+// RevokeToken returns ErrTokenNotFound when no pair of the channel name and the token found.
+func (d *TokenService) RevokeToken(ctx context.Context, channelName string, givenToken secret.Token) error {
+	channelName = channelname.Normalize(channelName)
 	recs, err := d.ddb.QueryByChannelName(ctx, channelName)
 	if err != nil {
-		return GenerateResult{}, err
+		return err
 	}
-	if len(recs) > 0 {
-		rec := recs[0]
-		res := GenerateResult{IsGenerated: false, Token: rec.Token}
-		return res, nil
+
+	for _, rec := range recs {
+		if matches(rec, givenToken) {
+			return d.revoke(ctx, rec)
+		}
 	}
+	return ErrTokenNotFound
+}
 
-	gen := generatorImpl{}
-	token, err := gen.generate()
+// Revoke given token for the given channel name. If then token is not linked to another channel's id, treat as permission error
+// and return ChannelIDUnmatchError. Returns ErrTokenNotFound when no pair found.
+func (d *TokenService) RevokeRenamedToken(ctx context.Context, channelID string, givenChannelName string, givenToken secret.Token) error {
+	givenChannelName = channelname.Normalize(givenChannelName)
+	recs, err := d.ddb.QueryByChannelName(ctx, givenChannelName)
 	if err != nil {
-		return GenerateResult{}, err
+		return err
 	}
 
-	record := storage.Record{
-		ChannelID:   channelID,
-		ChannelName: channelName,
-		Token:       token,
-		Version:     0,
-		CreatedAt:   currentTimestamp(),
-	}
-	if err := d.ddb.Save(ctx, record); err != nil {
-		return GenerateResult{}, err
+	for _, rec := range recs {
+		if matches(rec, givenToken) {
+			if rec.ChannelID != channelID {
+				return &ChannelIDUnmatchError{LinkedChannelID: rec.ChannelID}
+			}
+			return d.revoke(ctx, rec)
+		}
 	}
+	return ErrTokenNotFound
+}
 
-	res := GenerateResult{IsGenerated: true, Token: token}
-	return res, nil
+// revoke soft-deletes the record to allow restoring it during the grace period. The batch job purges the
+// tombstone after the period if DynamoDB TTL hasn't deleted it yet.
+func (d *TokenService) revoke(ctx context.Context, rec storage.Record) error {
+	if d.revokeGracePeriod <= 0 {
+		return d.ddb.Delete(ctx, rec)
+	}
+	now := time.Now()
+	return d.ddb.Revoke(ctx, rec, now.UTC().Format(time.RFC3339Nano), now.Add(d.revokeGracePeriod).Unix())
 }
 
-const maxTokenCount = 2
+// RestoreToken restores the token revoked in the grace period and returns it. The token is given as the token or
+// its prefix, so notices can reference the token without exposing it. Returns ErrTokenNotFound when no revoked token
+// found, e.g. the grace period passed or a new token has replaced the revoked one, and ErrTooManyToken when the
+// channel already has maxTokenCount tokens.
+func (d *TokenService) RestoreToken(ctx context.Context, channelName string, givenToken secret.Token, maxTokenCount int) (secret.Token, error) {
+	channelName = channelname.Normalize(channelName)
+	tombstones, err := d.ddb.QueryTombstonesByChannelName(ctx, channelName)
+	if err != nil {
+		return "", err
+	}
+	i := slices.IndexFunc(tombstones, func(rec storage.Record) bool {
+		return rec.Revoked() && !rec.Expired(time.Now()) && (matches(rec, givenToken) || entryPrefix(rec) == givenToken.Reveal())
+	})
+	if i < 0 {
+		return "", ErrTokenNotFound
+	}
 
-// RegenerateToken allows generate another token for the given channel. If another
-// token has been already generated, it returns "too many token" result. So users
-// can have 2 tokens for each channel name maximum.
-func (d *TokenService) RegenerateToken(ctx context.Context, channelID string, channelName string) (RegenerateResult, error) {
 	recs, err := d.ddb.QueryByChannelName(ctx, channelName)
 	if err != nil {
-		return RegenerateResult{}, err
-	}
-	if len(recs) == 0 {
-		return RegenerateResult{NoTokenFound: true}, nil
+		return "", err
 	}
 	if len(recs) >= maxTokenCount {
-		return RegenerateResult{TooManyToken: true}, nil
+		return "", ErrTooManyToken
+	}
+	if err := d.ddb.Restore(ctx, tombstones[i]); err != nil {
+		return "", err
 	}
+	return secret.Token(tombstones[i].Token), nil
+}
 
-	gen := generatorImpl{}
-	token, err := generateWithRetry(recs, &gen)
+// SetMappings replaces the mapping rules of the token in the channel. The token is given as the token or its
+// prefix. Empty rules remove the mappings. Returns ErrTokenNotFound when no token found, and ErrInvalidMapping for
+// invalid rules.
+func (d *TokenService) SetMappings(ctx context.Context, channelName string, givenToken secret.Token, rules string) ([]MappingRule, error) {
+	channelName = channelname.Normalize(channelName)
+	var parsed []MappingRule
+	if rules != "" {
+		var err error
+		if parsed, err = ParseMappingRules(rules); err != nil {
+			return nil, err
+		}
+	}
+	rec, err := d.findInChannel(ctx, channelName, givenToken)
 	if err != nil {
-		return RegenerateResult{}, errors.Wrapf(err, "same token generated: token=%s", token)
+		return nil, err
 	}
-
-	// QueryByChannelName returns sorted records.
-	latestRec := recs[0]
-	record := storage.Record{
-		ChannelID:   channelID,
-		ChannelName: channelName,
-		Token:       token,
-		Version:     latestRec.Version + 1,
-		CreatedAt:   currentTimestamp(),
+	mappings := make([]string, 0, len(parsed))
+	for _, rule := range parsed {
+		mappings = append(mappings, rule.String())
 	}
-	if err := d.ddb.Save(ctx, record); err != nil {
-		return RegenerateResult{}, err
+	if err := d.ddb.UpdateMappings(ctx, rec, mappings); err != nil {
+		return nil, err
 	}
-	return RegenerateResult{Token: token}, nil
+	return parsed, nil
 }
 
-func (d *TokenService) RevokeToken(ctx context.Context, channelName string, givenToken string) (RevokeResult, error) {
+// findInChannel finds the token of the channel by the token or its prefix.
+func (d *TokenService) findInChannel(ctx context.Context, channelName string, givenToken secret.Token) (storage.Record, error) {
 	recs, err := d.ddb.QueryByChannelName(ctx, channelName)
 	if err != nil {
-		return RevokeResult{}, err
-	}
-	if len(recs) == 0 {
-		return RevokeResult{NotFound: true}, nil
+		return storage.Record{}, err
 	}
-
 	for _, rec := range recs {
-		if rec.Token == givenToken {
-			if err := d.ddb.Delete(ctx, rec); err != nil {
-				return RevokeResult{}, err
-			}
-			// Success.
-			return RevokeResult{}, nil
+		if matches(rec, givenToken) || entryPrefix(rec) == givenToken.Reveal() {
+			return rec, nil
 		}
 	}
-	return RevokeResult{NotFound: true}, nil
+	return storage.Record{}, ErrTokenNotFound
 }
 
-// Revoke given token for the given channel name. If then token is not linked to another channel's id, treat as permission error.
-func (d *TokenService) RevokeRenamedToken(ctx context.Context, channelID string, givenChannelName string, givenToken string) (RevokeRenamedResult, error) {
-	recs, err := d.ddb.QueryByChannelName(ctx, givenChannelName)
+// RecordDeliveryFailure counts the failure to deliver to the channel with the verified token, e.g. the channel is
+// archived, and returns the number of consecutive failures including this one. Returns ErrTokenNotFound when the
+// token has been revoked in the meantime.
+func (d *TokenService) RecordDeliveryFailure(ctx context.Context, res VerifyResult, reason string) (int, error) {
+	rec, err := d.findVersion(ctx, res)
 	if err != nil {
-		return RevokeRenamedResult{}, err
+		return 0, err
 	}
-	if len(recs) == 0 {
-		return RevokeRenamedResult{NotFound: true}, nil
+	return d.ddb.AddDeliveryFailure(ctx, rec, reason)
+}
+
+// MarkUndeliverable records that the delivery failures of the verified token were escalated.
+func (d *TokenService) MarkUndeliverable(ctx context.Context, res VerifyResult) error {
+	rec, err := d.findVersion(ctx, res)
+	if err != nil {
+		return err
 	}
+	return d.ddb.UpdateUndeliverableAt(ctx, rec, currentTimestamp())
+}
 
-	for _, rec := range recs {
-		if rec.Token == givenToken {
-			if rec.ChannelID != channelID {
-				return RevokeRenamedResult{ChannelIDUnmatch: true, LinkedChannelID: rec.ChannelID}, nil
-			}
+// ResetDeliveryFailures clears the delivery failures of the verified token after a successful delivery.
+func (d *TokenService) ResetDeliveryFailures(ctx context.Context, res VerifyResult) error {
+	rec, err := d.findVersion(ctx, res)
+	if err != nil {
+		return err
+	}
+	return d.ddb.ResetDeliveryFailures(ctx, rec)
+}
 
-			if err := d.ddb.Delete(ctx, rec); err != nil {
-				return RevokeRenamedResult{}, err
-			}
-			// Success.
-			return RevokeRenamedResult{}, nil
+// findVersion finds the record of the verified token. Records are keyed by the channel name and the version.
+func (d *TokenService) findVersion(ctx context.Context, res VerifyResult) (storage.Record, error) {
+	recs, err := d.ddb.QueryByChannelName(ctx, res.ChannelName)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	i := slices.IndexFunc(recs, func(rec storage.Record) bool { return rec.Version == res.Version })
+	if i < 0 {
+		return storage.Record{}, ErrTokenNotFound
+	}
+	return recs[i], nil
+}
+
+// LookupToken finds the channel linked to the token regardless of the channel name, e.g. to find the owner
+// of a leaked token. Returns ErrTokenNotFound when no channel found.
+func (d *TokenService) LookupToken(ctx context.Context, givenToken secret.Token) (LookupResult, error) {
+	rec, err := d.findByToken(ctx, givenToken)
+	if err != nil {
+		return LookupResult{}, err
+	}
+	return LookupResult{ChannelID: rec.ChannelID, ChannelName: rec.ChannelName}, nil
+}
+
+// VerifyTokenByToken is VerifyToken ignoring the channel name, for URLs having a channel name which no longer
+// matches the token, e.g. the channel name before renaming. The returned ChannelName is the channel name of
+// the record. Returns ErrTokenNotFound when no channel found.
+func (d *TokenService) VerifyTokenByToken(ctx context.Context, givenToken secret.Token) (VerifyResult, error) {
+	rec, err := d.findByToken(ctx, givenToken)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	d.recordUsage(ctx, rec)
+	return verifyResultOf(rec), nil
+}
+
+func verifyResultOf(rec storage.Record) VerifyResult {
+	createdAt, _ := time.Parse(time.RFC3339Nano, rec.CreatedAt)
+	return VerifyResult{
+		ChannelID:   rec.ChannelID,
+		ChannelName: rec.ChannelName,
+		Scope:       scopeOf(rec),
+		Version:     rec.Version,
+		TokenPrefix: entryPrefix(rec),
+		CreatedAt:   createdAt,
+		Mappings:    parseStoredMappingRules(rec.Mappings),
+
+		DeliveryFailures: rec.DeliveryFailures,
+	}
+}
+
+func (d *TokenService) findByToken(ctx context.Context, givenToken secret.Token) (storage.Record, error) {
+	recs, err := d.ddb.QueryByToken(ctx, givenToken.Reveal())
+	if err != nil {
+		return storage.Record{}, err
+	}
+	for _, rec := range recs {
+		// Tokens are random, but check anyway because GSI keys are not unique.
+		if matches(rec, givenToken) {
+			return rec, nil
 		}
 	}
-	return RevokeRenamedResult{NotFound: true}, nil
+	return storage.Record{}, ErrTokenNotFound
 }
 
 type ddb interface {
@@ -218,26 +471,34 @@ type ddb interface {
 	// QueryByChannelName returns found records having the same channel name.
 	// It returns empty slice when no record found.
 	QueryByChannelName(ctx context.Context, channelName string) ([]storage.Record, error)
+	// QueryTombstonesByChannelName returns revoked or archived records having the same channel name.
+	QueryTombstonesByChannelName(ctx context.Context, channelName string) ([]storage.Record, error)
+	// QueryByChannelID returns found records linked to the channel ID, possibly having different channel names.
+	// It returns empty slice when no record found.
+	QueryByChannelID(ctx context.Context, channelID string) ([]storage.Record, error)
+	// QueryByToken returns found records having the token. It returns empty slice when no record found.
+	QueryByToken(ctx context.Context, token string) ([]storage.Record, error)
 	Delete(ctx context.Context, record storage.Record) error
+	Revoke(ctx context.Context, record storage.Record, revokedAt string, expiresAt int64) error
+	Restore(ctx context.Context, record storage.Record) error
+	UpdateLastUsedAt(ctx context.Context, record storage.Record, timestamp string) error
+	UpdateMappings(ctx context.Context, record storage.Record, mappings []string) error
+	UpdateUndeliverableAt(ctx context.Context, record storage.Record, timestamp string) error
+	AddDeliveryFailure(ctx context.Context, record storage.Record, reason string) (int, error)
+	ResetDeliveryFailures(ctx context.Context, record storage.Record) error
 }
 
 type generator interface {
-	generate() (string, error)
+	generate() (secret.Token, error)
 }
 
 type generatorImpl struct{}
 
-const randomStringLen = 16
-
-func (g *generatorImpl) generate() (string, error) {
-	k := make([]byte, randomStringLen)
-	if _, err := rand.Read(k); err != nil {
-		return "", errors.Wrap(err, "failed to generate random string")
-	}
-	return fmt.Sprintf("%x", k), nil
+func (g *generatorImpl) generate() (secret.Token, error) {
+	return secret.GenerateToken()
 }
 
-func generateWithRetry(recs []storage.Record, gen generator) (string, error) {
+func generateWithRetry(recs []storage.Record, gen generator) (secret.Token, error) {
 	for i := 0; i <= 3; i++ {
 		pass := true
 
@@ -246,7 +507,7 @@ func generateWithRetry(recs []storage.Record, gen generator) (string, error) {
 			return "", errors.Wrap(err, "failed to generate token")
 		}
 		for _, rec := range recs {
-			if token == rec.Token {
+			if matches(rec, token) {
 				pass = false
 				break
 			}
@@ -259,14 +520,45 @@ func generateWithRetry(recs []storage.Record, gen generator) (string, error) {
 	return "", errors.New("generate token 3 times but same token generated")
 }
 
+func latestVersion(recs []storage.Record) int {
+	return latestRecord(recs).Version
+}
+
+func latestRecord(recs []storage.Record) storage.Record {
+	latest := recs[0]
+	for _, rec := range recs[1:] {
+		if rec.Version > latest.Version {
+			latest = rec
+		}
+	}
+	return latest
+}
+
 func recordToEntry(rec storage.Record) (Entry, error) {
 	t, err := time.Parse(time.RFC3339Nano, rec.CreatedAt)
 	if err != nil {
 		return Entry{}, errors.Wrapf(err, "failed to parse created_at: %s", rec.CreatedAt)
 	}
-	return Entry{Token: rec.Token, Version: rec.Version, CreatedAt: t}, nil
+	return Entry{Token: secret.Token(rec.Token), Prefix: entryPrefix(rec), Version: rec.Version, CreatedAt: t, Scope: scopeOf(rec), Mappings: parseStoredMappingRules(rec.Mappings)}, nil
+}
+
+// timestampLayout is RFC 3339 with fixed width fractional seconds, unlike time.RFC3339Nano trimming trailing zeros,
+// so timestamps compare lexicographically in DynamoDB condition expressions and sort keys. time.RFC3339Nano
+// parses it.
+const timestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+func entryPrefix(rec storage.Record) string {
+	if rec.TokenPrefix != "" {
+		return rec.TokenPrefix
+	}
+	return secret.Token(rec.Token).Prefix()
+}
+
+// matches compares in constant time, so the token can't be guessed from response times.
+func matches(rec storage.Record, givenToken secret.Token) bool {
+	return hmac.Equal([]byte(rec.Token), []byte(givenToken.Reveal()))
 }
 
 func currentTimestamp() string {
-	return time.Now().UTC().Format(time.RFC3339Nano)
+	return time.Now().UTC().Format(timestampLayout)
 }
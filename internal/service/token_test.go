@@ -2,10 +2,13 @@ package service
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/errors"
 
+	"github.com/Finatext/belldog/internal/secret"
 	"github.com/Finatext/belldog/internal/storage"
 )
 
@@ -19,10 +22,32 @@ func newTestStorage() testStorage {
 }
 
 func (t *testStorage) Save(ctx context.Context, rec storage.Record) error {
+	for _, v := range t.m[rec.ChannelName] {
+		if v.Version == rec.Version {
+			return errors.Wrapf(storage.ErrRecordAlreadyExists, "channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+		}
+	}
 	t.m[rec.ChannelName] = append(t.m[rec.ChannelName], rec)
 	return nil
 }
 
+// racingStorage saves the competitor record right before the first Save call to emulate concurrent requests.
+type racingStorage struct {
+	testStorage
+	competitor *storage.Record
+}
+
+func (r *racingStorage) Save(ctx context.Context, rec storage.Record) error {
+	if r.competitor != nil {
+		competitor := *r.competitor
+		r.competitor = nil
+		if err := r.testStorage.Save(ctx, competitor); err != nil {
+			return err
+		}
+	}
+	return r.testStorage.Save(ctx, rec)
+}
+
 func (t *testStorage) QueryByChannelName(ctx context.Context, channelName string) ([]storage.Record, error) {
 	recs, ok := t.m[channelName]
 	if !ok {
@@ -31,6 +56,30 @@ func (t *testStorage) QueryByChannelName(ctx context.Context, channelName string
 	return recs, nil
 }
 
+func (t *testStorage) QueryByChannelID(ctx context.Context, channelID string) ([]storage.Record, error) {
+	ret := []storage.Record{}
+	for _, recs := range t.m {
+		for _, rec := range recs {
+			if rec.ChannelID == channelID {
+				ret = append(ret, rec)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (t *testStorage) QueryByToken(ctx context.Context, token string) ([]storage.Record, error) {
+	ret := []storage.Record{}
+	for _, recs := range t.m {
+		for _, rec := range recs {
+			if rec.Token == token {
+				ret = append(ret, rec)
+			}
+		}
+	}
+	return ret, nil
+}
+
 func (t *testStorage) Delete(ctx context.Context, rec storage.Record) error {
 	recs, ok := t.m[rec.ChannelName]
 	if !ok {
@@ -47,6 +96,71 @@ func (t *testStorage) Delete(ctx context.Context, rec storage.Record) error {
 	return nil
 }
 
+// testStorage doesn't keep tombstones, tests of soft deletes use storage.Memory.
+func (t *testStorage) QueryTombstonesByChannelName(ctx context.Context, channelName string) ([]storage.Record, error) {
+	return []storage.Record{}, nil
+}
+
+func (t *testStorage) Revoke(ctx context.Context, rec storage.Record, revokedAt string, expiresAt int64) error {
+	return t.Delete(ctx, rec)
+}
+
+func (t *testStorage) Restore(ctx context.Context, rec storage.Record) error {
+	return errors.Newf("No tombstone found for %s", rec.ChannelName)
+}
+
+func (t *testStorage) UpdateLastUsedAt(ctx context.Context, rec storage.Record, timestamp string) error {
+	for i, v := range t.m[rec.ChannelName] {
+		if v.Version == rec.Version && v.Token == rec.Token {
+			t.m[rec.ChannelName][i].LastUsedAt = timestamp
+			return nil
+		}
+	}
+	return errors.Newf("No record found for %s", rec.ChannelName)
+}
+
+func (t *testStorage) UpdateMappings(ctx context.Context, rec storage.Record, mappings []string) error {
+	for i, v := range t.m[rec.ChannelName] {
+		if v.Version == rec.Version && v.Token == rec.Token {
+			t.m[rec.ChannelName][i].Mappings = mappings
+			return nil
+		}
+	}
+	return errors.Newf("No record found for %s", rec.ChannelName)
+}
+
+func (t *testStorage) UpdateUndeliverableAt(ctx context.Context, rec storage.Record, timestamp string) error {
+	return t.update(rec, func(r *storage.Record) { r.UndeliverableAt = timestamp })
+}
+
+func (t *testStorage) AddDeliveryFailure(ctx context.Context, rec storage.Record, reason string) (int, error) {
+	var count int
+	err := t.update(rec, func(r *storage.Record) {
+		r.DeliveryFailures++
+		r.DeliveryFailureReason = reason
+		count = r.DeliveryFailures
+	})
+	return count, err
+}
+
+func (t *testStorage) ResetDeliveryFailures(ctx context.Context, rec storage.Record) error {
+	return t.update(rec, func(r *storage.Record) {
+		r.DeliveryFailures = 0
+		r.DeliveryFailureReason = ""
+		r.UndeliverableAt = ""
+	})
+}
+
+func (t *testStorage) update(rec storage.Record, f func(*storage.Record)) error {
+	for i, v := range t.m[rec.ChannelName] {
+		if v.Version == rec.Version && v.Token == rec.Token {
+			f(&t.m[rec.ChannelName][i])
+			return nil
+		}
+	}
+	return errors.Newf("No record found for %s", rec.ChannelName)
+}
+
 const (
 	channelID          = "C03T4AU1755"
 	channelName        = "random"
@@ -59,9 +173,9 @@ func TestGenerateAndSaveTokenNew(t *testing.T) {
 
 	ctx := context.Background()
 	stg := newTestStorage()
-	svc := NewTokenService(&stg)
+	svc := NewTokenService(&stg, 0)
 
-	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName)
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
 	if err != nil {
 		t.Fatalf("GenerateAndSaveToken failed: %s", err)
 	}
@@ -70,7 +184,7 @@ func TestGenerateAndSaveTokenNew(t *testing.T) {
 		t.FailNow()
 	}
 	rec := recs[0]
-	if res.Token != rec.Token {
+	if res.Token.Reveal() != rec.Token {
 		t.Fatalf("Returned token and saved token unmatch: returned=%s, saved=%s", res.Token, rec.Token)
 	}
 	if !res.IsGenerated {
@@ -83,15 +197,15 @@ func TestGenerateAndSaveTokenAgain(t *testing.T) {
 
 	ctx := context.Background()
 	stg := newTestStorage()
-	svc := NewTokenService(&stg)
+	svc := NewTokenService(&stg, 0)
 
-	resOld, err := svc.GenerateAndSaveToken(ctx, channelID, channelName)
+	resOld, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
 	if err != nil {
 		t.Fatalf("GenerateAndSaveToken failed: %s", err)
 	}
 	token := resOld.Token
 	// GenerateAgain
-	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName)
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
 	if err != nil {
 		t.Fatalf("GenerateAndSaveToken failed: %s", err)
 	}
@@ -106,49 +220,124 @@ func TestGenerateAndSaveTokenAgain(t *testing.T) {
 	}
 }
 
+func TestGenerateAndSaveTokenConflict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	competitor := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: "competitor token", Version: 0}
+	stg := racingStorage{testStorage: newTestStorage(), competitor: &competitor}
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
+	if err != nil {
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
+	}
+	if res.IsGenerated {
+		t.Fatal("Token must not be generated when another request saved token concurrently")
+	}
+	if res.Token.Reveal() != competitor.Token {
+		t.Fatalf("Returned token must be the concurrently saved token: returned=%s, saved=%s", res.Token, competitor.Token)
+	}
+	if len(stg.m[channelName]) != 1 {
+		t.Fatalf("Duplicated records saved: %v", stg.m[channelName])
+	}
+}
+
 func TestVerifyToken(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
 	stg := newTestStorage()
-	svc := NewTokenService(&stg)
+	svc := NewTokenService(&stg, 0)
 
 	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 1}
 	if err := stg.Save(ctx, rec); err != nil {
 		t.Fatalf("Failed to save record: %s", err)
 	}
 
-	res1, err := svc.VerifyToken(ctx, anotherChannelName, token)
+	if _, err := svc.VerifyToken(ctx, anotherChannelName, token); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("VerifyToken must return ErrTokenNotFound: %v", err)
+	}
+
+	if _, err := svc.VerifyToken(ctx, channelName, "invalid token"); !errors.Is(err, ErrTokenUnmatch) {
+		t.Fatalf("VerifyToken must return ErrTokenUnmatch: %v", err)
+	}
+
+	res3, err := svc.VerifyToken(ctx, channelName, token)
 	if err != nil {
 		t.Fatalf("VerifyToken failed: %s", err)
 	}
-	if !res1.NotFound {
-		t.Fatal("VerifyResult.NotFound must be true")
+	if res3.ChannelID != channelID {
+		t.Fatal("Saved ChannelID and channelID must be same")
 	}
+}
+
+func TestTokenScope(t *testing.T) {
+	t.Parallel()
 
-	res2, err := svc.VerifyToken(ctx, channelName, "invalid token")
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
 	if err != nil {
-		t.Fatalf("VerifyToken failed: %s", err)
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
 	}
-	if res2.NotFound {
-		t.Fatal("VerifyResult.NotFound must be false")
+	verified, err := svc.VerifyToken(ctx, channelName, res.Token)
+	if err != nil {
+		t.Fatalf("VerifyToken failed: %s", err)
 	}
-	if !res2.Unmatch {
-		t.Fatal("VerifyResult.Unmatch must be true")
+	if verified.Scope != ScopePost || verified.Scope.Allows(ScopeManage) {
+		t.Fatalf("Post scope must not allow manage: %s", verified.Scope)
 	}
 
-	res3, err := svc.VerifyToken(ctx, channelName, token)
+	regenerated, err := svc.RegenerateToken(ctx, channelID, channelName, 2)
 	if err != nil {
+		t.Fatalf("RegenerateToken failed: %s", err)
+	}
+	if verified, err := svc.VerifyToken(ctx, channelName, regenerated.Token); err != nil || verified.Scope != ScopePost {
+		t.Fatalf("Regenerated token must inherit the scope: scope=%s, err=%v", verified.Scope, err)
+	}
+
+	// Records saved before scopes were introduced.
+	legacy := storage.Record{ChannelID: channelID, ChannelName: anotherChannelName, Token: token, Version: 0}
+	if err := stg.Save(ctx, legacy); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+	if verified, err := svc.VerifyToken(ctx, anotherChannelName, token); err != nil || !verified.Scope.Allows(ScopeManage) {
+		t.Fatalf("Legacy token must allow manage: scope=%s, err=%v", verified.Scope, err)
+	}
+
+	if _, err := ParseScope("admin"); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("ParseScope must return ErrInvalidScope: %v", err)
+	}
+}
+
+func TestVerifyTokenRecordsUsage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	recent := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano)
+	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 0, LastUsedAt: recent}
+	if err := stg.Save(ctx, rec); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+	if _, err := svc.VerifyToken(ctx, channelName, token); err != nil {
 		t.Fatalf("VerifyToken failed: %s", err)
 	}
-	if res3.NotFound {
-		t.Fatal("VerifyResult.NotFound must be false")
+	if got := stg.m[channelName][0].LastUsedAt; got != recent {
+		t.Fatalf("last_used_at must not be updated within the interval: %s", got)
 	}
-	if res3.Unmatch {
-		t.Fatal("VerifyResult.Unmatch must be false")
+
+	stg.m[channelName][0].LastUsedAt = ""
+	if _, err := svc.VerifyToken(ctx, channelName, token); err != nil {
+		t.Fatalf("VerifyToken failed: %s", err)
 	}
-	if res3.ChannelID != channelID {
-		t.Fatal("Saved ChannelID and channelID must be same")
+	if stg.m[channelName][0].LastUsedAt == "" {
+		t.Fatal("last_used_at must be recorded")
 	}
 }
 
@@ -157,14 +346,14 @@ func TestVerifyTokenMultipleItems(t *testing.T) {
 
 	ctx := context.Background()
 	stg := newTestStorage()
-	svc := NewTokenService(&stg)
+	svc := NewTokenService(&stg, 0)
 
 	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 1}
 	if err := stg.Save(ctx, rec); err != nil {
 		t.Fatalf("Failed to save record: %s", err)
 	}
-	token2 := "test token 2"
-	rec2 := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token2, Version: 2}
+	token2 := secret.Token("test token 2")
+	rec2 := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token2.Reveal(), Version: 2}
 	if err := stg.Save(ctx, rec2); err != nil {
 		t.Fatalf("Failed to save record: %s", err)
 	}
@@ -173,12 +362,6 @@ func TestVerifyTokenMultipleItems(t *testing.T) {
 	if err != nil {
 		t.Fatalf("VerifyToken failed: %s", err)
 	}
-	if res1.NotFound {
-		t.Fatal("VerifyResult.NotFound must be false")
-	}
-	if res1.Unmatch {
-		t.Fatal("VerifyResult.Unmatch must be false")
-	}
 	if res1.ChannelID != channelID {
 		t.Fatalf("Saved ChannelID and channelID must be same: saved=%s, init=%s, rec=%v", res1.ChannelID, channelID, res1)
 	}
@@ -189,15 +372,11 @@ func TestRegenerateToken(t *testing.T) {
 
 	ctx := context.Background()
 	stg := newTestStorage()
-	svc := NewTokenService(&stg)
+	svc := NewTokenService(&stg, 0)
 
 	// Case: no token saved.
-	res1, err := svc.RegenerateToken(ctx, channelID, channelName)
-	if err != nil {
-		t.Fatalf("Failed to RegenerateToken: %s", err)
-	}
-	if !res1.NoTokenFound {
-		t.FailNow()
+	if _, err := svc.RegenerateToken(ctx, channelID, channelName, 2); !errors.Is(err, ErrNoTokenFound) {
+		t.Fatalf("RegenerateToken must return ErrNoTokenFound: %v", err)
 	}
 
 	// Case: regular pass.
@@ -205,17 +384,11 @@ func TestRegenerateToken(t *testing.T) {
 	if err := stg.Save(ctx, rec); err != nil {
 		t.Fatalf("Failed to save record: %s", err)
 	}
-	res2, err := svc.RegenerateToken(ctx, channelID, channelName)
+	res2, err := svc.RegenerateToken(ctx, channelID, channelName, 2)
 	if err != nil {
 		t.Fatalf("Failed to RegenerateToken: %s", err)
 	}
-	if res2.NoTokenFound {
-		t.FailNow()
-	}
-	if res2.TooManyToken {
-		t.FailNow()
-	}
-	if res2.Token == rec.Token {
+	if res2.Token.Reveal() == rec.Token {
 		t.Fatalf("NewToken has same value as existing token: token=%s", rec.Token)
 	}
 	recs, ok := stg.m[channelName]
@@ -233,12 +406,32 @@ func TestRegenerateToken(t *testing.T) {
 	}
 
 	// Case: too many token.
-	res3, err := svc.RegenerateToken(ctx, channelID, channelName)
-	if err != nil {
-		t.Fatalf("Failed to RegenerateToken: %s", err)
+	if _, err := svc.RegenerateToken(ctx, channelID, channelName, 2); !errors.Is(err, ErrTooManyToken) {
+		t.Fatalf("RegenerateToken must return ErrTooManyToken: %v", err)
 	}
-	if !res3.TooManyToken {
-		t.FailNow()
+}
+
+func TestRegenerateTokenMaxTokenCount(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 0}
+	if err := stg.Save(ctx, rec); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := svc.RegenerateToken(ctx, channelID, channelName, 3); err != nil {
+			t.Fatalf("Failed to RegenerateToken: %s", err)
+		}
+	}
+	if _, err := svc.RegenerateToken(ctx, channelID, channelName, 3); !errors.Is(err, ErrTooManyToken) {
+		t.Fatalf("RegenerateToken must return ErrTooManyToken: %v", err)
+	}
+	if recs := stg.m[channelName]; len(recs) != 3 || recs[2].Version != 2 {
+		t.Fatalf("Unexpected records saved: %v", recs)
 	}
 }
 
@@ -247,26 +440,178 @@ func TestRevokeToken(t *testing.T) {
 
 	ctx := context.Background()
 	stg := newTestStorage()
-	svc := NewTokenService(&stg)
+	svc := NewTokenService(&stg, 0)
 
-	res, err := svc.RevokeToken(ctx, channelName, token)
-	if err != nil {
+	if err := svc.RevokeToken(ctx, channelName, token); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("RevokeToken must return ErrTokenNotFound: %v", err)
+	}
+
+	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 1}
+	if err := stg.Save(ctx, rec); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+	if err := svc.RevokeToken(ctx, channelName, token); err != nil {
 		t.Fatalf("RevokeToken failed: %s", err)
 	}
-	if !res.NotFound {
-		t.FailNow()
+	if len(stg.m[channelName]) != 0 {
+		t.Fatalf("Token must be deleted: %v", stg.m[channelName])
 	}
+}
 
-	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 1}
+func TestRestoreToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := storage.NewMemory()
+	svc := NewTokenService(stg, time.Hour)
+
+	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 0}
 	if err := stg.Save(ctx, rec); err != nil {
 		t.Fatalf("Failed to save record: %s", err)
 	}
-	res2, err := svc.RevokeToken(ctx, channelName, token)
+	if err := svc.RevokeToken(ctx, channelName, token); err != nil {
+		t.Fatalf("RevokeToken failed: %s", err)
+	}
+	if recs, _ := stg.QueryByChannelName(ctx, channelName); len(recs) != 0 {
+		t.Fatalf("Revoked token must not be returned: %v", recs)
+	}
+
+	if _, err := svc.RestoreToken(ctx, channelName, "invalid token", 2); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("RestoreToken must return ErrTokenNotFound: %v", err)
+	}
+	restored, err := svc.RestoreToken(ctx, channelName, token, 2)
 	if err != nil {
+		t.Fatalf("RestoreToken failed: %s", err)
+	}
+	if restored != token {
+		t.Fatalf("Unexpected restored token: %s", restored)
+	}
+	recs, _ := stg.QueryByChannelName(ctx, channelName)
+	if len(recs) != 1 || recs[0].Token != token || recs[0].Tombstone() {
+		t.Fatalf("Token must be restored: %v", recs)
+	}
+}
+
+func TestRestoreTokenByPrefix(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := storage.NewMemory()
+	svc := NewTokenService(stg, time.Hour)
+
+	tok := secret.Token("bd_ab12_0123456789abcdef0123456789abcdef")
+	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: tok.Reveal(), TokenPrefix: tok.Prefix(), Version: 0}
+	if err := stg.Save(ctx, rec); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+	if err := svc.RevokeToken(ctx, channelName, tok); err != nil {
 		t.Fatalf("RevokeToken failed: %s", err)
 	}
-	if res2.NotFound {
-		t.FailNow()
+	restored, err := svc.RestoreToken(ctx, channelName, secret.Token(tok.Prefix()), 2)
+	if err != nil {
+		t.Fatalf("RestoreToken failed: %s", err)
+	}
+	if restored != tok {
+		t.Fatalf("Unexpected restored token: %s", restored)
+	}
+}
+
+func TestRestoreTokenExpired(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := storage.NewMemory()
+	svc := NewTokenService(stg, time.Hour)
+
+	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 0}
+	if err := stg.Save(ctx, rec); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+	// Expired but not deleted by DynamoDB TTL yet.
+	if err := stg.Revoke(ctx, rec, "2024-01-01T00:00:00Z", time.Now().Add(-time.Minute).Unix()); err != nil {
+		t.Fatalf("Failed to revoke record: %s", err)
+	}
+	if _, err := svc.RestoreToken(ctx, channelName, token, 2); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("RestoreToken must return ErrTokenNotFound: %v", err)
+	}
+}
+
+func TestRestoreTokenTooMany(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := storage.NewMemory()
+	svc := NewTokenService(stg, time.Hour)
+
+	revoked := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 0}
+	if err := stg.Save(ctx, revoked); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+	if err := svc.RevokeToken(ctx, channelName, token); err != nil {
+		t.Fatalf("RevokeToken failed: %s", err)
+	}
+	for i, tok := range []string{"token a", "token b"} {
+		if err := stg.Save(ctx, storage.Record{ChannelID: channelID, ChannelName: channelName, Token: tok, Version: i + 1}); err != nil {
+			t.Fatalf("Failed to save record: %s", err)
+		}
+	}
+	if _, err := svc.RestoreToken(ctx, channelName, token, 2); !errors.Is(err, ErrTooManyToken) {
+		t.Fatalf("RestoreToken must return ErrTooManyToken: %v", err)
+	}
+}
+
+func TestRevokeRenamedToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 1}
+	if err := stg.Save(ctx, rec); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+
+	if err := svc.RevokeRenamedToken(ctx, channelID, channelName, "invalid token"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("RevokeRenamedToken must return ErrTokenNotFound: %v", err)
+	}
+
+	err := svc.RevokeRenamedToken(ctx, "C999", channelName, token)
+	var unmatchErr *ChannelIDUnmatchError
+	if !errors.As(err, &unmatchErr) || unmatchErr.LinkedChannelID != channelID {
+		t.Fatalf("RevokeRenamedToken must return ChannelIDUnmatchError: %v", err)
+	}
+	if !errors.Is(err, ErrChannelIDUnmatch) {
+		t.Fatalf("ChannelIDUnmatchError must be ErrChannelIDUnmatch: %v", err)
+	}
+	if code, ok := CodeOf(err); !ok || code != CodeChannelIDUnmatch {
+		t.Fatalf("Unexpected code: %s", code)
+	}
+
+	if err := svc.RevokeRenamedToken(ctx, channelID, channelName, token); err != nil {
+		t.Fatalf("RevokeRenamedToken failed: %s", err)
+	}
+}
+
+func TestRegenerateTokenConflict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := racingStorage{testStorage: newTestStorage()}
+	svc := NewTokenService(&stg, 0)
+
+	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 0}
+	if err := stg.Save(ctx, rec); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+	stg.competitor = &storage.Record{ChannelID: channelID, ChannelName: channelName, Token: "competitor token", Version: 1}
+
+	// Retried, then found the concurrently generated token.
+	if _, err := svc.RegenerateToken(ctx, channelID, channelName, 2); !errors.Is(err, ErrTooManyToken) {
+		t.Fatalf("RegenerateToken must return ErrTooManyToken after conflict: %v", err)
+	}
+	if len(stg.m[channelName]) != 2 {
+		t.Fatalf("Unexpected records saved: %v", stg.m[channelName])
 	}
 }
 
@@ -274,7 +619,7 @@ const sameToken = "same token"
 
 type testGenerator struct{}
 
-func (g *testGenerator) generate() (string, error) {
+func (g *testGenerator) generate() (secret.Token, error) {
 	return sameToken, nil
 }
 
@@ -296,3 +641,235 @@ func TestGenerateWithRetry(t *testing.T) {
 		t.Fatal("generateWithRetry must return an error when same token found continuously.")
 	}
 }
+
+func TestGeneratedTokenPrefix(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
+	if err != nil {
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
+	}
+	prefix := res.Token.Prefix()
+	if len(prefix) != len("bd_ab12") || !strings.HasPrefix(res.Token.Reveal(), prefix+"_") {
+		t.Fatalf("Unexpected token format: %s", res.Token)
+	}
+	entries, err := svc.GetTokens(ctx, channelName)
+	if err != nil {
+		t.Fatalf("GetTokens failed: %s", err)
+	}
+	if entries[0].Prefix != prefix || stg.m[channelName][0].TokenPrefix != prefix {
+		t.Fatalf("Prefix must be saved: %+v", entries[0])
+	}
+}
+
+func TestVerifyTokenByChannelIDAfterRename(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
+	if err != nil {
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
+	}
+
+	// The record keeps the old channel name after the channel is renamed.
+	verified, err := svc.VerifyTokenByChannelID(ctx, channelID, res.Token)
+	if err != nil {
+		t.Fatalf("VerifyTokenByChannelID failed: %s", err)
+	}
+	if verified.ChannelID != channelID || verified.ChannelName != channelName {
+		t.Fatalf("Unexpected result: %+v", verified)
+	}
+
+	if _, err := svc.VerifyTokenByChannelID(ctx, channelID, "invalid token"); !errors.Is(err, ErrTokenUnmatch) {
+		t.Fatalf("Invalid token must be rejected: %v", err)
+	}
+
+	if _, err := svc.VerifyTokenByChannelID(ctx, "C999", res.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Token of another channel must not be found: %v", err)
+	}
+}
+
+func TestLookupToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
+	if err != nil {
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
+	}
+
+	found, err := svc.LookupToken(ctx, res.Token)
+	if err != nil {
+		t.Fatalf("LookupToken failed: %s", err)
+	}
+	if found.ChannelID != channelID || found.ChannelName != channelName {
+		t.Fatalf("Unexpected result: %+v", found)
+	}
+
+	if _, err := svc.LookupToken(ctx, "unknown token"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Unknown token must not be found: %v", err)
+	}
+}
+
+func TestVerifyTokenByToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
+	if err != nil {
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
+	}
+
+	verified, err := svc.VerifyTokenByToken(ctx, res.Token)
+	if err != nil {
+		t.Fatalf("VerifyTokenByToken failed: %s", err)
+	}
+	if verified.ChannelID != channelID || verified.ChannelName != channelName || verified.Scope != ScopePost {
+		t.Fatalf("Unexpected result: %+v", verified)
+	}
+
+	if _, err := svc.VerifyTokenByToken(ctx, "unknown token"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Unknown token must not be verified: %v", err)
+	}
+}
+
+func TestSetMappings(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, channelName, ScopePost)
+	if err != nil {
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
+	}
+
+	if _, err := svc.SetMappings(ctx, channelName, secret.Token(res.Token.Prefix()), "text <- $.message"); err != nil {
+		t.Fatalf("SetMappings failed: %s", err)
+	}
+	verified, err := svc.VerifyToken(ctx, channelName, res.Token)
+	if err != nil {
+		t.Fatalf("VerifyToken failed: %s", err)
+	}
+	if len(verified.Mappings) != 1 || verified.Mappings[0].String() != "text <- $.message" {
+		t.Fatalf("Mappings must be set: %+v", verified.Mappings)
+	}
+
+	regenerated, err := svc.RegenerateToken(ctx, channelID, channelName, 2)
+	if err != nil {
+		t.Fatalf("RegenerateToken failed: %s", err)
+	}
+	verified, err = svc.VerifyToken(ctx, channelName, regenerated.Token)
+	if err != nil {
+		t.Fatalf("VerifyToken failed: %s", err)
+	}
+	if len(verified.Mappings) != 1 {
+		t.Fatalf("Regenerated token must keep mappings: %+v", verified.Mappings)
+	}
+
+	if _, err := svc.SetMappings(ctx, channelName, res.Token, ""); err != nil {
+		t.Fatalf("SetMappings failed: %s", err)
+	}
+	verified, err = svc.VerifyToken(ctx, channelName, res.Token)
+	if err != nil {
+		t.Fatalf("VerifyToken failed: %s", err)
+	}
+	if len(verified.Mappings) != 0 {
+		t.Fatalf("Mappings must be cleared: %+v", verified.Mappings)
+	}
+
+	if _, err := svc.SetMappings(ctx, channelName, res.Token, "text"); !errors.Is(err, ErrInvalidMapping) {
+		t.Fatalf("Invalid rules must be rejected: %v", err)
+	}
+	if _, err := svc.SetMappings(ctx, anotherChannelName, res.Token, "text <- $.message"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Tokens of other channels must not be found: %v", err)
+	}
+}
+
+func TestVerifyTokenNormalizesChannelName(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	res, err := svc.GenerateAndSaveToken(ctx, channelID, "開発-通知", ScopePost)
+	if err != nil {
+		t.Fatalf("GenerateAndSaveToken failed: %s", err)
+	}
+
+	for _, given := range []string{"開発-通知", "%E9%96%8B%E7%99%BA-%E9%80%9A%E7%9F%A5", "開発　通知"} {
+		verified, err := svc.VerifyToken(ctx, given, res.Token)
+		if err != nil {
+			t.Fatalf("VerifyToken failed: %s, %s", given, err)
+		}
+		if verified.ChannelName != "開発-通知" {
+			t.Fatalf("Unexpected channel name: %s", verified.ChannelName)
+		}
+	}
+}
+
+func TestDeliveryFailures(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stg := newTestStorage()
+	svc := NewTokenService(&stg, 0)
+
+	rec := storage.Record{ChannelID: channelID, ChannelName: channelName, Token: token, Version: 0}
+	if err := stg.Save(ctx, rec); err != nil {
+		t.Fatalf("Failed to save record: %s", err)
+	}
+	res, err := svc.VerifyToken(ctx, channelName, token)
+	if err != nil {
+		t.Fatalf("VerifyToken failed: %s", err)
+	}
+	for want := 1; want <= 2; want++ {
+		count, err := svc.RecordDeliveryFailure(ctx, res, "is_archived")
+		if err != nil {
+			t.Fatalf("RecordDeliveryFailure failed: %s", err)
+		}
+		if count != want {
+			t.Fatalf("Failures must be counted: want=%d, got=%d", want, count)
+		}
+	}
+	if err := svc.MarkUndeliverable(ctx, res); err != nil {
+		t.Fatalf("MarkUndeliverable failed: %s", err)
+	}
+	if got := stg.m[channelName][0]; got.UndeliverableAt == "" || got.DeliveryFailureReason != "is_archived" {
+		t.Fatalf("Record must be marked undeliverable: %+v", got)
+	}
+	res, err = svc.VerifyToken(ctx, channelName, token)
+	if err != nil {
+		t.Fatalf("VerifyToken failed: %s", err)
+	}
+	if res.DeliveryFailures != 2 {
+		t.Fatalf("VerifyResult must have the failures: %+v", res)
+	}
+
+	if err := svc.ResetDeliveryFailures(ctx, res); err != nil {
+		t.Fatalf("ResetDeliveryFailures failed: %s", err)
+	}
+	if got := stg.m[channelName][0]; got.DeliveryFailures != 0 || got.UndeliverableAt != "" {
+		t.Fatalf("Failures must be reset: %+v", got)
+	}
+
+	res.Version = 1
+	if _, err := svc.RecordDeliveryFailure(ctx, res, "is_archived"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Unknown versions must not be found: %v", err)
+	}
+}
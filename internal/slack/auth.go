@@ -0,0 +1,22 @@
+package slack
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/cockroachdb/errors"
+)
+
+// AuthTest checks the token is valid and Slack API is reachable. Used by health checks.
+// https://api.slack.com/methods/auth.test
+func (s *Client) AuthTest(ctx context.Context) error {
+	if s.stub {
+		slog.DebugContext(ctx, "[slack stub] auth test")
+		return nil
+	}
+	client := s.api
+	if _, err := client.AuthTestContext(ctx); err != nil {
+		return errors.Wrap(err, "failed to call auth.test")
+	}
+	return nil
+}
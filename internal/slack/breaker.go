@@ -0,0 +1,156 @@
+package slack
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// The circuit breaker stops calling chat.* methods after SLACK_CIRCUIT_BREAKER_THRESHOLD consecutive server
+// failures and timeouts, so webhook requests fail fast while Slack is down instead of waiting for retries and
+// timeouts. After SLACK_CIRCUIT_BREAKER_COOLDOWN, one trial request is let through: the circuit closes when it
+// succeeds and opens again otherwise. The state is per process.
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitListener is called on state transitions, after the request causing the transition.
+type CircuitListener func(ctx context.Context, from CircuitState, to CircuitState)
+
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// The half-open trial request is in flight.
+	trial    bool
+	listener CircuitListener
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now, state: CircuitClosed}
+}
+
+// SetCircuitListener sets the listener of the circuit breaker. No-op when the circuit breaker is disabled.
+func (s Client) SetCircuitListener(listener CircuitListener) {
+	if s.breaker == nil {
+		return
+	}
+	s.breaker.mu.Lock()
+	defer s.breaker.mu.Unlock()
+	s.breaker.listener = listener
+}
+
+type bypassCircuitKey struct{}
+
+// WithoutCircuitBreaker lets calls with the context through the open circuit, e.g. to notify the ops channel
+// that the circuit opened.
+func WithoutCircuitBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCircuitKey{}, true)
+}
+
+// allow tells whether the call may proceed. Otherwise, retryAfter is the time until the next trial request.
+func (b *circuitBreaker) allow(ctx context.Context) (retryAfter time.Duration, ok bool) {
+	if ctx.Value(bypassCircuitKey{}) != nil {
+		return 0, true
+	}
+	b.mu.Lock()
+	switch b.state {
+	case CircuitClosed:
+		b.mu.Unlock()
+		return 0, true
+	case CircuitOpen:
+		remaining := b.cooldown - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			b.mu.Unlock()
+			return remaining, false
+		}
+		b.state = CircuitHalfOpen
+		b.trial = true
+		b.mu.Unlock()
+		b.transition(ctx, CircuitOpen, CircuitHalfOpen)
+		return 0, true
+	default:
+		if b.trial {
+			b.mu.Unlock()
+			return b.cooldown, false
+		}
+		b.trial = true
+		b.mu.Unlock()
+		return 0, true
+	}
+}
+
+// record records the result of the allowed call. Only server failures and timeouts are failures: other errors,
+// e.g. invalid payloads, tell that Slack API is working.
+func (b *circuitBreaker) record(ctx context.Context, failed bool) {
+	if ctx.Value(bypassCircuitKey{}) != nil {
+		return
+	}
+	b.mu.Lock()
+	from := b.state
+	switch {
+	case from == CircuitHalfOpen && failed:
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+		b.trial = false
+	case from == CircuitHalfOpen:
+		b.state = CircuitClosed
+		b.failures = 0
+		b.trial = false
+	case from == CircuitClosed && failed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.state = CircuitOpen
+			b.openedAt = b.now()
+		}
+	case from == CircuitClosed:
+		b.failures = 0
+	}
+	to := b.state
+	b.mu.Unlock()
+	if from != to {
+		b.transition(ctx, from, to)
+	}
+}
+
+func (b *circuitBreaker) transition(ctx context.Context, from CircuitState, to CircuitState) {
+	slog.WarnContext(ctx, "Slack API circuit breaker state changed", slog.String("from", string(from)), slog.String("to", string(to)))
+	telemetry.RecordSlackCircuitTransition(ctx, string(from), string(to))
+	b.mu.Lock()
+	listener := b.listener
+	b.mu.Unlock()
+	if listener != nil {
+		listener(ctx, from, to)
+	}
+}
+
+// isServerFailure tells whether the result counts as a failure of Slack API for the circuit breaker.
+func isServerFailure(res PostMessageResult, err error) bool {
+	if err != nil {
+		// Canceled by the caller, not a failure of Slack API.
+		return !errors.Is(err, context.Canceled)
+	}
+	switch res.Type {
+	case PostMessageResultServerTimeoutFailure:
+		return true
+	case PostMessageResultServerFailure:
+		return res.StatusCode >= 500
+	default:
+		return false
+	}
+}
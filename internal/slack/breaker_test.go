@@ -0,0 +1,151 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+type transition struct {
+	from CircuitState
+	to   CircuitState
+}
+
+// setupBreakerClient returns the client calling the server, which responds with 500 while failing is true.
+func setupBreakerClient(t *testing.T, failing *atomic.Bool, calls *atomic.Int32) (Client, *time.Time, *[]transition) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "ts": "1405894322.002768"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(appconfig.Config{
+		SlackAPIBaseURL:              server.URL,
+		SlackCircuitBreakerCooldown:  30 * time.Second,
+		SlackCircuitBreakerThreshold: 3,
+		SlackToken:                   "xoxb-test",
+	})
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client.breaker.now = func() time.Time { return now }
+	var transitions []transition
+	client.SetCircuitListener(func(_ context.Context, from CircuitState, to CircuitState) {
+		transitions = append(transitions, transition{from, to})
+	})
+	return client, &now, &transitions
+}
+
+func postMessage(t *testing.T, ctx context.Context, client Client) PostMessageResult {
+	t.Helper()
+	res, err := client.PostMessage(ctx, "C123456", "test", map[string]interface{}{"text": "hello"})
+	require.NoError(t, err)
+	return res
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	ctx := context.Background()
+	var failing atomic.Bool
+	var calls atomic.Int32
+	client, now, transitions := setupBreakerClient(t, &failing, &calls)
+
+	failing.Store(true)
+	for range 3 {
+		assert.Equal(t, PostMessageResultServerFailure, postMessage(t, ctx, client).Type)
+	}
+	assert.Equal(t, []transition{{CircuitClosed, CircuitOpen}}, *transitions)
+
+	*now = now.Add(10 * time.Second)
+	res := postMessage(t, ctx, client)
+	assert.Equal(t, PostMessageResultCircuitOpen, res.Type)
+	assert.Equal(t, 20*time.Second, res.RetryAfter)
+	assert.Equal(t, "C123456", res.ChannelID)
+	assert.Equal(t, int32(3), calls.Load(), "short-circuited requests must not call Slack API")
+
+	// The ops notification bypasses the circuit.
+	assert.Equal(t, PostMessageResultServerFailure, postMessage(t, WithoutCircuitBreaker(ctx), client).Type)
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestCircuitBreakerResetsOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	var failing atomic.Bool
+	var calls atomic.Int32
+	client, _, transitions := setupBreakerClient(t, &failing, &calls)
+
+	for range 3 {
+		failing.Store(true)
+		postMessage(t, ctx, client)
+		postMessage(t, ctx, client)
+		failing.Store(false)
+		assert.Equal(t, PostMessageResultOK, postMessage(t, ctx, client).Type)
+	}
+	assert.Empty(t, *transitions)
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	ctx := context.Background()
+	var failing atomic.Bool
+	var calls atomic.Int32
+	client, now, transitions := setupBreakerClient(t, &failing, &calls)
+
+	failing.Store(true)
+	for range 3 {
+		postMessage(t, ctx, client)
+	}
+
+	// The trial request fails, so the circuit opens again for the cooldown.
+	*now = now.Add(30 * time.Second)
+	assert.Equal(t, PostMessageResultServerFailure, postMessage(t, ctx, client).Type)
+	res := postMessage(t, ctx, client)
+	assert.Equal(t, PostMessageResultCircuitOpen, res.Type)
+	assert.Equal(t, 30*time.Second, res.RetryAfter)
+
+	// The trial request succeeds, so the circuit closes.
+	*now = now.Add(30 * time.Second)
+	failing.Store(false)
+	assert.Equal(t, PostMessageResultOK, postMessage(t, ctx, client).Type)
+	assert.Equal(t, PostMessageResultOK, postMessage(t, ctx, client).Type)
+
+	assert.Equal(t, []transition{
+		{CircuitClosed, CircuitOpen},
+		{CircuitOpen, CircuitHalfOpen},
+		{CircuitHalfOpen, CircuitOpen},
+		{CircuitOpen, CircuitHalfOpen},
+		{CircuitHalfOpen, CircuitClosed},
+	}, *transitions)
+}
+
+func TestCircuitBreakerIgnoresAPIFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(appconfig.Config{SlackAPIBaseURL: server.URL, SlackCircuitBreakerThreshold: 1, SlackToken: "xoxb-test"})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for range 3 {
+		assert.Equal(t, PostMessageResultAPIFailure, postMessage(t, ctx, client).Type)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	client, err := NewClient(appconfig.Config{})
+	require.NoError(t, err)
+	assert.Nil(t, client.breaker)
+	// No-op without the circuit breaker.
+	client.SetCircuitListener(func(context.Context, CircuitState, CircuitState) {})
+}
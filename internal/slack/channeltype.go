@@ -0,0 +1,65 @@
+package slack
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/slack-go/slack"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+// Conversation types configurable with CHANNEL_TYPES.
+const (
+	ChannelTypePublic  = "public"
+	ChannelTypePrivate = "private"
+	// Slack Connect channels shared with other organizations, either public or private.
+	ChannelTypeShared = "shared"
+	// Direct messages with Belldog.
+	ChannelTypeIM = "im"
+	// Group direct messages including Belldog.
+	ChannelTypeMPIM = "mpim"
+)
+
+var channelTypes = []string{ChannelTypePublic, ChannelTypePrivate, ChannelTypeShared, ChannelTypeIM, ChannelTypeMPIM}
+
+// Same as the default of CHANNEL_TYPES, for configs not parsed from env.
+var defaultChannelTypes = []string{ChannelTypePublic, ChannelTypePrivate, ChannelTypeShared}
+
+// ValidateChannelTypes validates CHANNEL_TYPES, so invalid settings fail at startup.
+func ValidateChannelTypes(config appconfig.Config) error {
+	for _, typ := range config.ChannelTypes {
+		if !slices.Contains(channelTypes, typ) {
+			return errors.Newf("unknown channel type: %s, available types: %s", typ, strings.Join(channelTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// channelType returns the type of the conversation, empty for unknown types. Slack Connect channels are "shared"
+// regardless of their visibility, so they can be disabled separately.
+func channelType(channel *slack.Channel) string {
+	switch {
+	case channel.IsIM:
+		return ChannelTypeIM
+	case channel.IsMpIM:
+		return ChannelTypeMPIM
+	case channel.IsExtShared || channel.IsPendingExtShared:
+		return ChannelTypeShared
+	case channel.IsGroup || channel.IsPrivate:
+		return ChannelTypePrivate
+	case channel.IsChannel:
+		return ChannelTypePublic
+	default:
+		return ""
+	}
+}
+
+// channelName returns the name to save tokens with. Direct messages have no names, so their IDs are used.
+func channelName(channel *slack.Channel) string {
+	if channel.IsIM {
+		return channel.ID
+	}
+	return channel.Name
+}
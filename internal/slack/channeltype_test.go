@@ -0,0 +1,54 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+func TestValidateChannelTypes(t *testing.T) {
+	require.NoError(t, ValidateChannelTypes(appconfig.Config{ChannelTypes: []string{"public", "private", "shared", "im", "mpim"}}))
+	assert.Error(t, ValidateChannelTypes(appconfig.Config{ChannelTypes: []string{"public", "dm"}}))
+}
+
+func TestGetFullCommandRequestChannelTypes(t *testing.T) {
+	tests := []struct {
+		name         string
+		channel      string
+		channelTypes []string
+		wantName     string
+		wantType     string
+		wantOK       bool
+	}{
+		{"public", `{"id": "C1", "name": "alerts", "is_channel": true}`, nil, "alerts", ChannelTypePublic, true},
+		{"private", `{"id": "C1", "name": "secret", "is_channel": true, "is_private": true}`, nil, "secret", ChannelTypePrivate, true},
+		{"shared", `{"id": "C1", "name": "partner", "is_channel": true, "is_ext_shared": true}`, nil, "partner", ChannelTypeShared, true},
+		{"shared private", `{"id": "G1", "name": "partner", "is_group": true, "is_private": true, "is_ext_shared": true}`, nil, "partner", ChannelTypeShared, true},
+		{"shared disabled", `{"id": "C1", "name": "partner", "is_channel": true, "is_ext_shared": true}`, []string{"public", "private"}, "partner", ChannelTypeShared, false},
+		{"im", `{"id": "D1", "is_im": true, "user": "U1"}`, []string{"im"}, "D1", ChannelTypeIM, true},
+		{"mpim disabled", `{"id": "G1", "name": "mpdm-a--b-1", "is_mpim": true, "is_private": true}`, nil, "mpdm-a--b-1", ChannelTypeMPIM, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"ok": true, "channel": ` + tt.channel + `}`))
+			}))
+			t.Cleanup(server.Close)
+			client, err := NewClient(appconfig.Config{SlackAPIBaseURL: server.URL, SlackToken: "xoxb-test", ChannelTypes: tt.channelTypes})
+			require.NoError(t, err)
+
+			cmdReq, err := client.GetFullCommandRequest(context.Background(), "command=%2Fbelldog-show&channel_id=C1&channel_name=x&text=")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, cmdReq.ChannelName)
+			assert.Equal(t, tt.wantType, cmdReq.ChannelType)
+			assert.Equal(t, tt.wantOK, cmdReq.Supported)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package slack
+
+import (
+	"encoding/json"
+
+	"github.com/cockroachdb/errors"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Pack all neccessary fields into one struct to work-around no enum.
+type Event struct {
+	Type EventType
+	// Only when Type is URLVerification
+	Challenge string
+	// Only when Type is ChannelRename, ChannelArchive or ChannelUnarchive
+	ChannelID string
+	// Only when Type is ChannelRename
+	ChannelName string
+	// Only when Type is ChannelArchive or ChannelUnarchive of public channels
+	UserID string
+	// Only when Type is Unsupported
+	Name string
+}
+
+type EventType int
+
+const (
+	EventURLVerification EventType = iota
+	EventChannelRename
+	EventChannelArchive
+	EventChannelUnarchive
+	EventUnsupported
+)
+
+// ParseEvent parses Events API request body. Both of public channel events (channel_*) and private
+// channel events (group_*) are mapped to the same EventType. The request signature must be verified
+// before calling this.
+// https://api.slack.com/apis/connections/events-api
+func ParseEvent(body string) (Event, error) {
+	// The deprecated verification token is not used, use signing secret instead.
+	outer, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		return Event{}, errors.Wrap(err, "failed to parse Events API request")
+	}
+
+	switch outer.Type {
+	case slackevents.URLVerification:
+		v, ok := outer.Data.(*slackevents.EventsAPIURLVerificationEvent)
+		if !ok {
+			return Event{}, errors.Newf("unexpected url_verification data: %T", outer.Data)
+		}
+		return Event{Type: EventURLVerification, Challenge: v.Challenge}, nil
+	case slackevents.CallbackEvent:
+		return parseInnerEvent(outer.InnerEvent), nil
+	default:
+		return Event{Type: EventUnsupported, Name: outer.Type}, nil
+	}
+}
+
+func parseInnerEvent(inner slackevents.EventsAPIInnerEvent) Event {
+	switch ev := inner.Data.(type) {
+	case *slackevents.ChannelRenameEvent:
+		return Event{Type: EventChannelRename, ChannelID: ev.Channel.ID, ChannelName: ev.Channel.Name}
+	case *slackevents.GroupRenameEvent:
+		return Event{Type: EventChannelRename, ChannelID: ev.Channel.ID, ChannelName: ev.Channel.Name}
+	case *slackevents.ChannelArchiveEvent:
+		return Event{Type: EventChannelArchive, ChannelID: ev.Channel, UserID: ev.User}
+	case *slackevents.GroupArchiveEvent:
+		return Event{Type: EventChannelArchive, ChannelID: ev.Channel}
+	case *slackevents.ChannelUnarchiveEvent:
+		return Event{Type: EventChannelUnarchive, ChannelID: ev.Channel, UserID: ev.User}
+	case *slackevents.GroupUnarchiveEvent:
+		return Event{Type: EventChannelUnarchive, ChannelID: ev.Channel}
+	default:
+		return Event{Type: EventUnsupported, Name: inner.Type}
+	}
+}
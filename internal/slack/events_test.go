@@ -0,0 +1,63 @@
+package slack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEventURLVerification(t *testing.T) {
+	body := `{"token": "x", "challenge": "challenge_value", "type": "url_verification"}`
+	evt, err := ParseEvent(body)
+	require.NoError(t, err)
+	assert.Equal(t, EventURLVerification, evt.Type)
+	assert.Equal(t, "challenge_value", evt.Challenge)
+}
+
+func TestParseEventChannelEvents(t *testing.T) {
+	cases := []struct {
+		name     string
+		inner    string
+		expected Event
+	}{
+		{
+			name:     "channel_rename",
+			inner:    `{"type": "channel_rename", "channel": {"id": "C123456", "name": "renamed", "created": 1360782804}}`,
+			expected: Event{Type: EventChannelRename, ChannelID: "C123456", ChannelName: "renamed"},
+		},
+		{
+			name:     "group_rename",
+			inner:    `{"type": "group_rename", "channel": {"id": "G123456", "name": "renamed", "created": 1360782804}}`,
+			expected: Event{Type: EventChannelRename, ChannelID: "G123456", ChannelName: "renamed"},
+		},
+		{
+			name:     "channel_archive",
+			inner:    `{"type": "channel_archive", "channel": "C123456", "user": "U123456"}`,
+			expected: Event{Type: EventChannelArchive, ChannelID: "C123456", UserID: "U123456"},
+		},
+		{
+			name:     "channel_unarchive",
+			inner:    `{"type": "channel_unarchive", "channel": "C123456", "user": "U123456"}`,
+			expected: Event{Type: EventChannelUnarchive, ChannelID: "C123456", UserID: "U123456"},
+		},
+		{
+			name:     "unsupported",
+			inner:    `{"type": "channel_created", "channel": {"id": "C123456", "name": "new"}}`,
+			expected: Event{Type: EventUnsupported, Name: "channel_created"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"token": "x", "team_id": "T123456", "type": "event_callback", "event": ` + tc.inner + `}`
+			evt, err := ParseEvent(body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, evt)
+		})
+	}
+}
+
+func TestParseEventInvalidBody(t *testing.T) {
+	_, err := ParseEvent("invalid")
+	require.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package slack
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/slack-go/slack"
+
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// UploadFileParams is a file to share in the channel.
+type UploadFileParams struct {
+	Reader   io.Reader
+	Size     int
+	Filename string
+	// Optional
+	Title string
+	// Optional
+	InitialComment string
+	// Optional
+	ThreadTS string
+}
+
+// UploadFile uploads the file with files.uploadV2 flow (files.getUploadURLExternal and files.completeUploadExternal).
+// The result is packed into PostMessageResult like other message APIs, FileID is set when succeeded.
+// https://api.slack.com/messaging/files#uploading_files
+//
+// Required scopes:
+//   - files:write
+func (s Client) UploadFile(ctx context.Context, channelID string, channelName string, params UploadFileParams) (res PostMessageResult, err error) {
+	if params.Size <= 0 {
+		return PostMessageResult{
+			Type:        PostMessageResultAPIFailure,
+			Reason:      "empty_file",
+			ChannelID:   channelID,
+			ChannelName: channelName,
+		}, nil
+	}
+
+	if s.stub {
+		return stubUploadFile(ctx, channelID, params), nil
+	}
+
+	start := time.Now()
+	defer func() {
+		telemetry.RecordSlackAPICall(ctx, "files.uploadV2", Outcome(res, err), time.Since(start))
+	}()
+	// The file content is streamed, so don't use the retrying HTTP client.
+	client := s.api
+	summary, err := client.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		Reader:          params.Reader,
+		FileSize:        params.Size,
+		Filename:        params.Filename,
+		Title:           params.Title,
+		InitialComment:  params.InitialComment,
+		Channel:         channelID,
+		ThreadTimestamp: params.ThreadTS,
+	})
+	if err != nil {
+		return apiCallResult(ctx, "files.uploadV2", channelID, channelName, err)
+	}
+	return PostMessageResult{Type: PostMessageResultOK, FileID: summary.ID}, nil
+}
+
+// apiCallResult packs the error of slack-go API calls into PostMessageResult like sendMessage does.
+func apiCallResult(ctx context.Context, method string, channelID string, channelName string, err error) (PostMessageResult, error) {
+	var apiErr slack.SlackErrorResponse
+	if errors.As(err, &apiErr) {
+		return PostMessageResult{
+			Type:        PostMessageResultAPIFailure,
+			Reason:      apiErr.Err,
+			ChannelID:   channelID,
+			ChannelName: channelName,
+		}, nil
+	}
+	var rateLimitedErr *slack.RateLimitedError
+	if errors.As(err, &rateLimitedErr) {
+		slog.WarnContext(ctx, "Slack API rate limited", slog.String("endpoint", method), slog.Duration("retry_after", rateLimitedErr.RetryAfter))
+		telemetry.RecordSlackRateLimited(ctx, method)
+		return PostMessageResult{Type: PostMessageResultRateLimited, RetryAfter: rateLimitedErr.RetryAfter}, nil
+	}
+	var statusErr slack.StatusCodeError
+	if errors.As(err, &statusErr) {
+		return PostMessageResult{
+			Type:       PostMessageResultServerFailure,
+			StatusCode: statusErr.Code,
+			Body:       statusErr.Status,
+		}, nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.InfoContext(ctx, "Slack API timeout", slog.String("error", err.Error()))
+		return PostMessageResult{Type: PostMessageResultServerTimeoutFailure}, nil
+	}
+	return PostMessageResult{}, errors.Wrap(err, "unexpected error from Slack API")
+}
@@ -0,0 +1,84 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/slack-go/slack"
+)
+
+// BlockAction is a button click on a message sent by Belldog.
+// https://api.slack.com/reference/interaction-payloads/block-actions
+type BlockAction struct {
+	ActionID    string
+	Value       string
+	ChannelID   string
+	UserID      string
+	UserName    string
+	ResponseURL string
+}
+
+// ParseBlockAction parses the interaction payload. The request signature must be verified before calling this.
+func ParseBlockAction(body string) (BlockAction, error) {
+	query, err := url.ParseQuery(body)
+	if err != nil {
+		return BlockAction{}, errors.Wrapf(err, "failed to parse HTTP query: %s", body)
+	}
+	var cb slack.InteractionCallback
+	if err := json.Unmarshal([]byte(query.Get("payload")), &cb); err != nil {
+		return BlockAction{}, errors.Wrap(err, "failed to unmarshal interaction payload")
+	}
+	if cb.Type != slack.InteractionTypeBlockActions {
+		return BlockAction{}, errors.Newf("unsupported interaction type: %s", cb.Type)
+	}
+	if len(cb.ActionCallback.BlockActions) != 1 {
+		return BlockAction{}, errors.Newf("unexpected action count: %d", len(cb.ActionCallback.BlockActions))
+	}
+	action := cb.ActionCallback.BlockActions[0]
+	return BlockAction{
+		ActionID:    action.ActionID,
+		Value:       action.Value,
+		ChannelID:   cb.Channel.ID,
+		UserID:      cb.User.ID,
+		UserName:    cb.User.Name,
+		ResponseURL: cb.ResponseURL,
+	}, nil
+}
+
+// PostResponse sends a message to the `response_url` of slash commands or interactions.
+// https://api.slack.com/interactivity/handling#message_responses
+func (s Client) PostResponse(ctx context.Context, responseURL string, payload map[string]interface{}) error {
+	jsonStr, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal payload")
+	}
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] post response", slog.String("response_url", responseURL), slog.String("payload", string(jsonStr)))
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, strings.NewReader(string(jsonStr)))
+	if err != nil {
+		return errors.Wrap(err, "failed to create response_url request")
+	}
+	req.Header.Add("content-type", "application/json")
+
+	resp, err := s.inner.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to post to response_url")
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response_url response body")
+	}
+	if resp.StatusCode != statusCodeSuccess {
+		return errors.Newf("unexpected response from response_url: code=%d, body=%s", resp.StatusCode, string(b))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package slack
+
+import (
+	"encoding/json"
+	"slices"
+	"unicode/utf8"
+)
+
+// Payloads having more fields are marshaled with encoding/json.
+const maxFlatPayloadFields = 8
+
+// marshalPayload encodes the payload as encoding/json does. Most payloads are flat, e.g. `text` and `channel`
+// with the channel defaults like `username`: they are encoded without reflection, the hot path of webhooks.
+func marshalPayload(payload map[string]interface{}) ([]byte, error) {
+	if len(payload) > maxFlatPayloadFields {
+		return json.Marshal(payload)
+	}
+	var keysBuf [maxFlatPayloadFields]string
+	keys := keysBuf[:0]
+	size := 2
+	for k, v := range payload {
+		s, ok := v.(string)
+		if !ok {
+			return json.Marshal(payload)
+		}
+		keys = append(keys, k)
+		size += len(k) + len(s) + 6
+	}
+	// encoding/json sorts map keys.
+	slices.Sort(keys)
+
+	b := make([]byte, 0, size)
+	b = append(b, '{')
+	for i, k := range keys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, k)
+		b = append(b, ':')
+		b = appendJSONString(b, payload[k].(string))
+	}
+	return append(b, '}'), nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends the quoted string escaped as encoding/json does by default: HTML characters and line
+// separators are escaped, and invalid UTF-8 is replaced with U+FFFD.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
@@ -0,0 +1,45 @@
+package slack
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload map[string]interface{}
+	}{
+		{name: "text", payload: map[string]interface{}{"channel": "C123456", "text": "hello"}},
+		{name: "empty", payload: map[string]interface{}{}},
+		{name: "escapes", payload: map[string]interface{}{"text": "quote \" backslash \\ newline \n tab \t cr \r bs \b ff \f nul \x00 esc \x1b"}},
+		{name: "html", payload: map[string]interface{}{"text": "<https://example.com?a=1&b=2|link>"}},
+		{name: "unicode", payload: map[string]interface{}{"text": "デプロイ完了 :tada: 🎉", "username": "ベルドッグ"}},
+		{name: "line separators", payload: map[string]interface{}{"text": "a b c"}},
+		{name: "invalid utf-8", payload: map[string]interface{}{"text": "a\xffb\xe3\x81c"}},
+		{name: "unsorted keys", payload: map[string]interface{}{"username": "bot", "text": "hi", "icon_emoji": ":dog:", "channel": "C1"}},
+		{name: "blocks", payload: map[string]interface{}{"text": "hi", "blocks": []interface{}{map[string]interface{}{"type": "divider"}}}},
+		{name: "bool", payload: map[string]interface{}{"text": "hi", "mrkdwn": false}},
+		{name: "many fields", payload: map[string]interface{}{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5", "f": "6", "g": "7", "h": "8", "i": "9"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := json.Marshal(tt.payload)
+			require.NoError(t, err)
+			got, err := marshalPayload(tt.payload)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), string(got))
+		})
+	}
+}
+
+func TestMarshalPayloadAllocs(t *testing.T) {
+	payload := map[string]interface{}{"channel": "C123456", "text": "hello"}
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = marshalPayload(payload)
+	})
+	assert.Equal(t, float64(1), allocs)
+}
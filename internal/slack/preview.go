@@ -0,0 +1,42 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cockroachdb/errors"
+)
+
+// MessagePreview records the Slack API request instead of sending it, so integrators can check the payload Belldog
+// would send. PostMessage and ScheduleMessage have the same signature and failure results as the ones of Client.
+type MessagePreview struct {
+	// Web API method, e.g. chat.postMessage.
+	Method string
+	// Request body sent to the method.
+	Body json.RawMessage
+	// The full text would be uploaded as a snippet in the thread of the posted message.
+	Snippet bool
+}
+
+func (p *MessagePreview) PostMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (PostMessageResult, error) {
+	return p.record(ctx, slackAPIPostMessageMethod, channelID, channelName, payload)
+}
+
+func (p *MessagePreview) ScheduleMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (PostMessageResult, error) {
+	return p.record(ctx, slackAPIScheduleMessageMethod, channelID, channelName, payload)
+}
+
+func (p *MessagePreview) record(ctx context.Context, method string, channelID string, channelName string, payload map[string]interface{}) (PostMessageResult, error) {
+	mode, _, truncated, failure := prepareMessage(ctx, channelID, channelName, payload)
+	if failure != nil {
+		return *failure, nil
+	}
+	body, err := marshalPayload(payload)
+	if err != nil {
+		return PostMessageResult{}, errors.Wrap(err, "failed to marshal payload")
+	}
+	p.Method = method
+	p.Body = body
+	p.Snippet = truncated && mode == TruncateModeSnippet
+	return PostMessageResult{Type: PostMessageResultOK}, nil
+}
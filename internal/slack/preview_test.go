@@ -0,0 +1,47 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagePreview(t *testing.T) {
+	ctx := context.Background()
+	preview := &MessagePreview{}
+	res, err := preview.PostMessage(ctx, "C123456", "test", map[string]interface{}{"text": "hello", "truncate_mode": "none"})
+	require.NoError(t, err)
+	assert.Equal(t, PostMessageResultOK, res.Type)
+	assert.Equal(t, "chat.postMessage", preview.Method)
+	assert.JSONEq(t, `{"channel": "C123456", "text": "hello"}`, string(preview.Body))
+	assert.False(t, preview.Snippet)
+}
+
+func TestMessagePreviewSnippet(t *testing.T) {
+	ctx := context.Background()
+	preview := &MessagePreview{}
+	payload := map[string]interface{}{"text": strings.Repeat("a", maxMessageTextLength+1), "truncate_mode": "snippet", "post_at": 1700000000}
+	res, err := preview.ScheduleMessage(ctx, "C123456", "test", payload)
+	require.NoError(t, err)
+	assert.Equal(t, PostMessageResultOK, res.Type)
+	assert.Equal(t, "chat.scheduleMessage", preview.Method)
+	assert.True(t, preview.Snippet)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(preview.Body, &body))
+	assert.True(t, strings.HasSuffix(body["text"].(string), truncatedMarker))
+	assert.NotContains(t, body, "truncate_mode")
+}
+
+func TestMessagePreviewInvalidTruncateMode(t *testing.T) {
+	preview := &MessagePreview{}
+	res, err := preview.PostMessage(context.Background(), "C123456", "test", map[string]interface{}{"text": "hello", "truncate_mode": "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, PostMessageResultAPIFailure, res.Type)
+	assert.Equal(t, "invalid_truncate_mode", res.Reason)
+	assert.Empty(t, preview.Body)
+}
@@ -0,0 +1,40 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// Slack responds 429 with Retry-After header in seconds when rate limited.
+// https://api.slack.com/apis/rate-limits
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	sec, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || sec < 0 {
+		return 0, false
+	}
+	return time.Duration(sec) * time.Second, true
+}
+
+// newRetryPolicy wraps the default retry policy not to wait rate limited requests longer than maxWait or beyond
+// the context deadline, e.g. the Lambda time budget. Then the 429 response is returned to the caller as
+// PostMessageResultRateLimited, so webhook clients can retry later instead of timing out.
+func newRetryPolicy(maxWait time.Duration) retryablehttp.CheckRetry {
+	return func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if wait, ok := retryAfter(resp); ok && err == nil {
+			if wait > maxWait {
+				return false, nil
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				return false, nil
+			}
+		}
+		return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	}
+}
@@ -0,0 +1,45 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitedResponse(retryAfter string) *http.Response {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := newRetryPolicy(10 * time.Second)
+	shortDeadline, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		resp *http.Response
+		want bool
+	}{
+		{name: "short wait", ctx: context.Background(), resp: rateLimitedResponse("5"), want: true},
+		{name: "longer than max wait", ctx: context.Background(), resp: rateLimitedResponse("30"), want: false},
+		{name: "beyond deadline", ctx: shortDeadline, resp: rateLimitedResponse("5"), want: false},
+		{name: "no retry-after", ctx: context.Background(), resp: rateLimitedResponse(""), want: true},
+		{name: "server error", ctx: context.Background(), resp: &http.Response{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "ok", ctx: context.Background(), resp: &http.Response{StatusCode: http.StatusOK}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry, err := policy(tt.ctx, tt.resp, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, retry)
+		})
+	}
+}
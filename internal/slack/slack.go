@@ -1,6 +1,7 @@
 package slack
 
 import (
+	"bytes"
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
@@ -11,8 +12,10 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -20,17 +23,28 @@ import (
 	"github.com/slack-go/slack"
 
 	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/telemetry"
 )
 
+// Web API methods, called under SLACK_API_BASE_URL.
 const (
-	slackAPIPostMessageEndpoint = "https://slack.com/api/chat.postMessage"
-	statusCodeSuccess           = 200
+	slackAPIPostMessageMethod     = "chat.postMessage"
+	slackAPIScheduleMessageMethod = "chat.scheduleMessage"
+	slackAPIUpdateMessageMethod   = "chat.update"
+	slackAPIDeleteMessageMethod   = "chat.delete"
+	slackAPIAddPinMethod          = "pins.add"
+	slackAPIAddReactionMethod     = "reactions.add"
+	slackAPITestMethod            = "api.test"
+	statusCodeSuccess             = 200
 )
 
 type SlashCommandRequest struct {
 	OriginalSlashCommandRequest
 	ChannelName string
-	Supported   bool
+	// Empty when belldog can't see the conversation.
+	ChannelType string
+	// The conversation type is enabled with CHANNEL_TYPES.
+	Supported bool
 }
 
 type OriginalSlashCommandRequest struct {
@@ -38,6 +52,10 @@ type OriginalSlashCommandRequest struct {
 	ChannelID           string
 	OriginalChannelName string
 	Text                string
+	UserID              string
+	UserName            string
+	// Valid for 30 minutes, up to 5 responses.
+	ResponseURL string
 }
 
 // Pack all neccessary fields into one struct to work-around no enum.
@@ -53,52 +71,220 @@ type PostMessageResult struct {
 	ChannelID string
 	// Only when Type is APIFailure
 	ChannelName string
+	// Only when Type is OK and the message was posted, updated or deleted
+	TS string
+	// Only when Type is OK and the message was scheduled
+	ScheduledMessageID string
+	// Only when Type is OK and the file was uploaded
+	FileID string
+	// Only when Type is OK and the bookmark was added or edited
+	BookmarkID string
+	// Only when Type is OK and the channel canvas was created or edited
+	CanvasID string
+	// Only when Type is RateLimited or CircuitOpen, zero when Slack didn't tell
+	RetryAfter time.Duration
 }
 
 type PostMessageResultType int
 
+// Outcome describes the result, used as metric attribute values and in delivery receipts.
+func Outcome(res PostMessageResult, err error) string {
+	if err != nil {
+		return "error"
+	}
+	switch res.Type {
+	case PostMessageResultOK:
+		return "ok"
+	case PostMessageResultServerTimeoutFailure:
+		return "timeout"
+	case PostMessageResultServerFailure:
+		return "server_failure"
+	case PostMessageResultAPIFailure:
+		return "api_failure"
+	case PostMessageResultRateLimited:
+		return "rate_limited"
+	case PostMessageResultCircuitOpen:
+		return "circuit_open"
+	default:
+		return "unknown"
+	}
+}
+
 const (
 	PostMessageResultOK PostMessageResultType = iota
 	PostMessageResultServerTimeoutFailure
 	PostMessageResultServerFailure
 	PostMessageResultAPIFailure
+	// Slack responded 429 and the Retry-After was too long to wait.
+	PostMessageResultRateLimited
+	// Slack API was not called because the circuit breaker is open. See breaker.go.
+	PostMessageResultCircuitOpen
 )
 
 type Client struct {
 	token string
-	inner *http.Client
+	// Base URL of Web API methods with the trailing slash.
+	apiURL string
+	inner  *http.Client
+	// slack-go client for Web API methods other than chat.*. Shares the connection pool with inner, so
+	// connections opened by Prewarm are reused by both.
+	api *slack.Client
+	// Without retries and timeouts, for api and Prewarm: file uploads stream large bodies. Limited by contexts.
+	plain *http.Client
+	// Nil when SLACK_CIRCUIT_BREAKER_THRESHOLD is 0.
+	breaker *circuitBreaker
+	// See stub.go
+	stub bool
+	// CHANNEL_TYPES, validated with ValidateChannelTypes.
+	channelTypes []string
 }
 
-func NewClient(config appconfig.Config) Client {
+func NewClient(config appconfig.Config) (Client, error) {
+	transport, err := newTransport(config)
+	if err != nil {
+		return Client{}, err
+	}
 	// Default config values: https://github.com/hashicorp/go-retryablehttp/blob/v0.7.5/client.go#L429-L439
 	retryClient := retryablehttp.NewClient()
 	retryClient.RetryMax = config.RetryMax
 	retryClient.RetryWaitMin = config.RetryWaitMinDuration
 	retryClient.RetryWaitMax = config.RetryWaitMaxDuration
+	retryClient.CheckRetry = newRetryPolicy(config.RetryWaitMaxDuration)
 	retryClient.ErrorHandler = returnResponseHandler
 	retryClient.HTTPClient.Timeout = config.RetryReadTimeoutDuration
+	retryClient.HTTPClient.Transport = transport
 	retryClient.Logger = slog.Default()
 
 	httpClient := retryClient.StandardClient()
-	return Client{token: config.SlackToken, inner: httpClient}
+	plain := &http.Client{Transport: transport}
+	apiURL := config.SlackAPIBaseURL
+	if !strings.HasSuffix(apiURL, "/") {
+		apiURL += "/"
+	}
+	if config.SlackStub {
+		slog.Warn("Slack stub mode is enabled, Slack API is not called")
+	}
+	channelTypes := config.ChannelTypes
+	if len(channelTypes) == 0 {
+		channelTypes = defaultChannelTypes
+	}
+	var breaker *circuitBreaker
+	if config.SlackCircuitBreakerThreshold > 0 {
+		breaker = newCircuitBreaker(config.SlackCircuitBreakerThreshold, config.SlackCircuitBreakerCooldown)
+	}
+	return Client{
+		token:        config.SlackToken,
+		apiURL:       apiURL,
+		inner:        httpClient,
+		api:          slack.New(config.SlackToken, slack.OptionHTTPClient(plain), slack.OptionAPIURL(apiURL)),
+		plain:        plain,
+		breaker:      breaker,
+		stub:         config.SlackStub,
+		channelTypes: channelTypes,
+	}, nil
+}
+
+// Prewarm opens a connection to Slack API in advance, so the first request of the Lambda execution environment
+// doesn't pay for the TLS handshake. Call this during the init phase, which isn't billed up to 10 seconds.
+// https://api.slack.com/methods/api.test
+func (s *Client) Prewarm(ctx context.Context) error {
+	if s.stub {
+		return nil
+	}
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.apiURL+slackAPITestMethod, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Slack API request")
+	}
+	resp, err := s.plain.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to prewarm Slack API connection")
+	}
+	defer resp.Body.Close()
+	// Drain the body to return the connection to the pool.
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return errors.Wrap(err, "failed to read Slack response body")
+	}
+	slog.DebugContext(ctx, "Slack API connection prewarmed", slog.Int("status", resp.StatusCode), slog.Duration("duration", time.Since(start)))
+	return nil
 }
 
 // https://api.slack.com/methods/chat.postMessage#examples
 type slackPostMessageResponse struct {
 	Ok    bool   `json:"ok"`
 	Error string `json:"error"`
+	TS    string `json:"ts"`
+	// Only for chat.scheduleMessage
+	ScheduledMessageID string `json:"scheduled_message_id"`
 	// Omit unnecessary fields
 }
 
 // https://api.slack.com/methods/chat.postMessage
+//
+// Over-long `text` field is handled as specified by `truncate_mode` payload field. See TruncateMode.
 func (s Client) PostMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (PostMessageResult, error) {
-	payload["channel"] = channelID
-	jsonStr, err := json.Marshal(payload)
+	return s.sendMessage(ctx, slackAPIPostMessageMethod, channelID, channelName, payload)
+}
+
+// ScheduleMessage schedules the message to be posted at `post_at` payload field (Unix timestamp). Slack validates
+// the timestamp: it must be in the future and within 120 days. Snippets of truncated messages are not uploaded
+// for scheduled messages.
+// https://api.slack.com/methods/chat.scheduleMessage
+func (s Client) ScheduleMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (PostMessageResult, error) {
+	return s.sendMessage(ctx, slackAPIScheduleMessageMethod, channelID, channelName, payload)
+}
+
+// UpdateMessage updates the message specified by `ts` payload field.
+// https://api.slack.com/methods/chat.update
+func (s Client) UpdateMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (PostMessageResult, error) {
+	return s.sendMessage(ctx, slackAPIUpdateMessageMethod, channelID, channelName, payload)
+}
+
+// DeleteMessage deletes the message specified by `ts` payload field.
+// https://api.slack.com/methods/chat.delete
+func (s Client) DeleteMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (PostMessageResult, error) {
+	return s.sendMessage(ctx, slackAPIDeleteMessageMethod, channelID, channelName, payload)
+}
+
+// AddPin pins the message specified by `timestamp` payload field.
+// https://api.slack.com/methods/pins.add
+func (s Client) AddPin(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (PostMessageResult, error) {
+	return s.sendMessage(ctx, slackAPIAddPinMethod, channelID, channelName, payload)
+}
+
+// AddReaction adds the reaction of `name` payload field to the message specified by `timestamp` payload field.
+// https://api.slack.com/methods/reactions.add
+func (s Client) AddReaction(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (PostMessageResult, error) {
+	return s.sendMessage(ctx, slackAPIAddReactionMethod, channelID, channelName, payload)
+}
+
+// sendMessage calls chat.postMessage compatible API.
+func (s Client) sendMessage(ctx context.Context, method string, channelID string, channelName string, payload map[string]interface{}) (res PostMessageResult, err error) {
+	mode, fullText, truncated, failure := prepareMessage(ctx, channelID, channelName, payload)
+	if failure != nil {
+		return *failure, nil
+	}
+	if s.stub {
+		return stubSend(ctx, method, channelID, payload), nil
+	}
+	if s.breaker != nil {
+		retryAfter, ok := s.breaker.allow(ctx)
+		if !ok {
+			telemetry.RecordSlackShortCircuited(ctx, method)
+			return PostMessageResult{Type: PostMessageResultCircuitOpen, RetryAfter: retryAfter, ChannelID: channelID, ChannelName: channelName}, nil
+		}
+		defer func() { s.breaker.record(ctx, isServerFailure(res, err)) }()
+	}
+	start := time.Now()
+	defer func() {
+		telemetry.RecordSlackAPICall(ctx, method, Outcome(res, err), time.Since(start))
+	}()
+	jsonStr, err := marshalPayload(payload)
 	if err != nil {
 		return PostMessageResult{}, errors.Wrap(err, "failed to marshal payload")
 	}
-	body := strings.NewReader(string(jsonStr))
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slackAPIPostMessageEndpoint, body)
+	body := bytes.NewReader(jsonStr)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+method, body)
 	if err != nil {
 		return PostMessageResult{}, errors.Wrap(err, "failed to create Slack API request")
 	}
@@ -121,6 +307,12 @@ func (s Client) PostMessage(ctx context.Context, channelID string, channelName s
 		return PostMessageResult{}, errors.Wrap(err, "failed to read Slack response body")
 	}
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait, _ := retryAfter(resp)
+		slog.WarnContext(ctx, "Slack API rate limited", slog.String("endpoint", method), slog.Duration("retry_after", wait))
+		telemetry.RecordSlackRateLimited(ctx, method)
+		return PostMessageResult{Type: PostMessageResultRateLimited, RetryAfter: wait}, nil
+	}
 	// After retrying, if response status code is not 200, it's server failure.
 	if resp.StatusCode != statusCodeSuccess {
 		return PostMessageResult{
@@ -130,21 +322,49 @@ func (s Client) PostMessage(ctx context.Context, channelID string, channelName s
 		}, nil
 	}
 
-	res := slackPostMessageResponse{}
-	if err := json.Unmarshal(b, &res); err != nil {
+	apiRes := slackPostMessageResponse{}
+	if err := json.Unmarshal(b, &apiRes); err != nil {
 		return PostMessageResult{}, errors.Wrap(err, "failed to unmarshal Slack response")
 	}
 
-	if !res.Ok {
+	if !apiRes.Ok {
 		return PostMessageResult{
 			Type:        PostMessageResultAPIFailure,
-			Reason:      res.Error,
+			Reason:      apiRes.Error,
 			ChannelID:   channelID,
 			ChannelName: channelName,
 		}, nil
 	}
 
-	return PostMessageResult{Type: PostMessageResultOK}, nil
+	if truncated && mode == TruncateModeSnippet && apiRes.TS != "" {
+		// The message itself has been posted, so don't fail the request.
+		if err := s.uploadSnippet(ctx, channelID, apiRes.TS, fullText); err != nil {
+			slog.WarnContext(ctx, "failed to upload full message as snippet", slog.String("error", err.Error()), slog.String("channel_id", channelID))
+		}
+	}
+
+	return PostMessageResult{Type: PostMessageResultOK, TS: apiRes.TS, ScheduledMessageID: apiRes.ScheduledMessageID}, nil
+}
+
+// prepareMessage applies truncate_mode to the payload and sets the channel, so the payload is sent to Slack API
+// as is. It returns the API failure result when truncate_mode is invalid.
+func prepareMessage(ctx context.Context, channelID string, channelName string, payload map[string]interface{}) (mode TruncateMode, fullText string, truncated bool, failure *PostMessageResult) {
+	mode, err := popTruncateMode(payload)
+	if err != nil {
+		slog.InfoContext(ctx, "invalid truncate_mode given", slog.String("error", err.Error()))
+		return "", "", false, &PostMessageResult{
+			Type:        PostMessageResultAPIFailure,
+			Reason:      "invalid_truncate_mode",
+			ChannelID:   channelID,
+			ChannelName: channelName,
+		}
+	}
+	fullText, truncated = truncatePayloadText(payload, mode)
+	if truncated {
+		slog.InfoContext(ctx, "message text truncated", slog.String("channel_id", channelID), slog.Int("length", len(fullText)), slog.String("truncate_mode", string(mode)))
+	}
+	payload["channel"] = channelID
+	return mode, fullText, truncated, nil
 }
 
 const slackPaginationLimit = 200
@@ -156,8 +376,11 @@ const slackPaginationLimit = 200
 //   - channels:read (public channels)
 //   - groups:read (private channels)
 func (s *Client) GetAllChannels(ctx context.Context) ([]slack.Channel, error) {
-	// XXX: If more actions are defined to Kit, move embed this to Kit struct value.
-	client := slack.New(s.token)
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] get conversations")
+		return []slack.Channel{}, nil
+	}
+	client := s.api
 
 	cursor := ""
 	channels := []slack.Channel{}
@@ -194,6 +417,46 @@ func (s *Client) GetAllChannels(ctx context.Context) ([]slack.Channel, error) {
 	return channels, nil
 }
 
+// GetChannelsByID returns the channels of the IDs with conversations.info, for callers processing a part of
+// channels, e.g. a chunk of checkpointed batch runs. Channels belldog can't see are omitted like GetAllChannels.
+// https://api.slack.com/methods/conversations.info
+//
+// Required scopes:
+//   - channels:read (public channels)
+//   - groups:read (private channels)
+func (s *Client) GetChannelsByID(ctx context.Context, channelIDs []string) ([]slack.Channel, error) {
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] get conversations by ID", slog.Int("size", len(channelIDs)))
+		return []slack.Channel{}, nil
+	}
+	client := s.api
+
+	channels := make([]slack.Channel, 0, len(channelIDs))
+	for i := 0; i < len(channelIDs); i++ {
+		channel, err := client.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channelIDs[i]})
+		if err != nil {
+			var e *slack.RateLimitedError
+			if errors.As(err, &e) && e.Retryable() {
+				select {
+				case <-ctx.Done():
+					return nil, errors.Wrap(ctx.Err(), "failed to get conversation info")
+				case <-time.After(e.RetryAfter):
+					// Retry the same channel.
+					i--
+					continue
+				}
+			}
+			var serr slack.SlackErrorResponse
+			if errors.As(err, &serr) && serr.Err == "channel_not_found" {
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to get conversation info: %s", channelIDs[i])
+		}
+		channels = append(channels, *channel)
+	}
+	return channels, nil
+}
+
 // GetFullCommandRequest to retrieve correct channel name for "private group"s. Before March 2021,
 // a private channel was "private group" in Slack implementation. And slash command payloads which Slack
 // sends to us, contains wrong channel name info for private groups. So we need retrieve the correct
@@ -204,6 +467,9 @@ func (s *Client) GetFullCommandRequest(ctx context.Context, body string) (SlashC
 	if err != nil {
 		return SlashCommandRequest{}, err
 	}
+	if s.stub {
+		return stubCommandRequest(ctx, cmdReq), nil
+	}
 	channel, err := s.getChannelInfo(ctx, cmdReq.ChannelID)
 	if err != nil {
 		// Belldog doesn't have permissions to read the conversation info.
@@ -220,16 +486,18 @@ func (s *Client) GetFullCommandRequest(ctx context.Context, body string) (SlashC
 		}
 		return SlashCommandRequest{}, err
 	}
+	typ := channelType(channel)
 	return SlashCommandRequest{
 		OriginalSlashCommandRequest: cmdReq,
-		ChannelName:                 channel.Name,
-		Supported:                   channel.IsChannel || channel.IsGroup,
+		ChannelName:                 channelName(channel),
+		ChannelType:                 typ,
+		Supported:                   typ != "" && slices.Contains(s.channelTypes, typ),
 	}, nil
 }
 
 // https://api.slack.com/methods/conversations.info
 func (s *Client) getChannelInfo(ctx context.Context, channelID string) (*slack.Channel, error) {
-	client := slack.New(s.token)
+	client := s.api
 
 	input := slack.GetConversationInfoInput{
 		ChannelID:         channelID,
@@ -251,53 +519,131 @@ const (
 	bitSize              = 64
 )
 
+// SigningSecrets are the signing secrets of the Slack app. Previous is optional: set it while rotating the
+// signing secret, so requests signed with either secret are accepted.
+type SigningSecrets struct {
+	Current  string
+	Previous string
+}
+
+// Slack recommends rejecting requests older than 5 minutes.
+const defaultSignatureTolerance = 5 * time.Minute
+
+// Verifier verifies requests from Slack.
 // https://api.slack.com/authentication/verifying-requests-from-slack
-func VerifySlackRequest(ctx context.Context, key string, headers http.Header, body string) bool {
-	givenSigs, ok := headers[http.CanonicalHeaderKey("x-slack-signature")]
+type Verifier struct {
+	Secrets SigningSecrets
+	// Requests having timestamps farther than this from now are rejected. Zero means 5 minutes.
+	Tolerance time.Duration
+	// Optional. Rejects requests having signatures already verified, i.e. replayed requests.
+	Replay *ReplayCache
+}
+
+// Verify looks up the headers regardless of the case of the keys, so headers built from Lambda events without
+// canonicalization are also verified.
+func (v Verifier) Verify(ctx context.Context, headers http.Header, body string) bool {
+	givenSig, ok := headerValue(headers, "x-slack-signature")
 	if !ok {
 		slog.InfoContext(ctx, "missing x-slack-signature header")
 		return false
 	}
-	if len(givenSigs) < 1 {
-		slog.InfoContext(ctx, "empty x-slack-signature header")
-		return false
-	}
-	givenSig := givenSigs[0]
-
-	timestampStrs, ok := headers[http.CanonicalHeaderKey("x-slack-request-timestamp")]
+	timestampStr, ok := headerValue(headers, "x-slack-request-timestamp")
 	if !ok {
 		slog.InfoContext(ctx, "missing x-slack-request-timestamp header")
 		return false
 	}
-	if len(timestampStrs) < 1 {
-		slog.InfoContext(ctx, "empty x-slack-request-timestamp header")
-		return false
-	}
-	timestampStr := timestampStrs[0]
 	timestamp, err := strconv.ParseInt(timestampStr, base, bitSize)
 	if err != nil {
 		slog.InfoContext(ctx, "failed to parse timestamp", slog.String("error", err.Error()), slog.String("timestamp", timestampStr))
 		return false
 	}
+	tolerance := v.Tolerance
+	if tolerance <= 0 {
+		tolerance = defaultSignatureTolerance
+	}
 	now := time.Now().UTC().Unix()
 	diff := abs(now - timestamp)
-	if diff > 60*5 {
+	if diff > int64(tolerance.Seconds()) {
 		slog.InfoContext(ctx, "expired timestamp given", slog.Int64("now", now), slog.Int64("timestamp", timestamp), slog.Int64("diff", diff))
 		return false
 	}
 
 	baseString := fmt.Sprintf("%s:%d:%s", currentVersionString, timestamp, body)
+	secret := ""
+	switch {
+	case hmac.Equal([]byte(givenSig), []byte(sign(v.Secrets.Current, baseString))):
+		secret = "current"
+	case v.Secrets.Previous != "" && hmac.Equal([]byte(givenSig), []byte(sign(v.Secrets.Previous, baseString))):
+		slog.InfoContext(ctx, "request signed with previous signing secret")
+		secret = "previous"
+	default:
+		// Don't log the expected signature, which is valid for the request.
+		slog.InfoContext(ctx, "verify failed", slog.String("givenSig", givenSig))
+		return false
+	}
+	// Check replays after verifying, so invalid requests don't fill the cache.
+	if v.Replay != nil && !v.Replay.add(givenSig, time.Unix(timestamp, 0).Add(tolerance)) {
+		slog.WarnContext(ctx, "replayed request given", slog.Int64("timestamp", timestamp))
+		return false
+	}
+	telemetry.RecordSigningSecretMatch(ctx, secret)
+	return true
+}
+
+func headerValue(headers http.Header, key string) (string, bool) {
+	if v := headers.Get(key); v != "" {
+		return v, true
+	}
+	for k, vs := range headers {
+		if strings.EqualFold(k, key) && len(vs) > 0 && vs[0] != "" {
+			return vs[0], true
+		}
+	}
+	return "", false
+}
+
+// Caps memory usage under floods of valid requests. Entries expire in the tolerance anyway.
+const maxReplayCacheEntries = 10000
+
+// ReplayCache remembers verified signatures until their timestamps expire. The cache is per process: on Lambda,
+// replays reaching other execution environments are not detected.
+type ReplayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{entries: map[string]time.Time{}}
+}
+
+// add returns false when the signature is already in the cache.
+func (c *ReplayCache) add(signature string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if e, ok := c.entries[signature]; ok && now.Before(e) {
+		return false
+	}
+	if len(c.entries) >= maxReplayCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= maxReplayCacheEntries {
+		slog.Warn("replay cache is full, clear it", slog.Int("size", len(c.entries)))
+		clear(c.entries)
+	}
+	c.entries[signature] = expiresAt
+	return true
+}
+
+func sign(key string, baseString string) string {
 	h := hmac.New(sha256.New, []byte(key))
 	// This Write() never returns error. https://pkg.go.dev/hash#Hash
 	h.Write([]byte(baseString))
-	computed := hex.EncodeToString(h.Sum(nil))
-	formatted := signaturePrefix + computed
-	ret := hmac.Equal([]byte(givenSig), []byte(formatted))
-	if !ret {
-		slog.InfoContext(ctx, "verify failed", slog.String("givenSig", givenSig), slog.String("formatted", formatted))
-		return false
-	}
-	return ret
+	return signaturePrefix + hex.EncodeToString(h.Sum(nil))
 }
 
 func parseSlashCommandRequest(body string) (OriginalSlashCommandRequest, error) {
@@ -311,6 +657,9 @@ func parseSlashCommandRequest(body string) (OriginalSlashCommandRequest, error)
 		ChannelID:           query["channel_id"][0],
 		OriginalChannelName: query["channel_name"][0],
 		Text:                query["text"][0],
+		UserID:              query.Get("user_id"),
+		UserName:            query.Get("user_name"),
+		ResponseURL:         query.Get("response_url"),
 	}
 	return req, nil
 }
@@ -0,0 +1,147 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+func signedHeaders(secret string, body string) http.Header {
+	timestamp := time.Now().Unix()
+	headers := http.Header{}
+	headers.Set("X-Slack-Signature", sign(secret, fmt.Sprintf("v0:%d:%s", timestamp, body)))
+	headers.Set("X-Slack-Request-Timestamp", fmt.Sprintf("%d", timestamp))
+	return headers
+}
+
+func TestVerifySlackRequestDuringRotation(t *testing.T) {
+	ctx := context.Background()
+	body := "token=x&command=%2Fbelldog-show"
+	secrets := SigningSecrets{Current: "new_secret", Previous: "old_secret"}
+
+	assert.True(t, Verifier{Secrets: secrets}.Verify(ctx, signedHeaders("new_secret", body), body))
+	assert.True(t, Verifier{Secrets: secrets}.Verify(ctx, signedHeaders("old_secret", body), body))
+	assert.False(t, Verifier{Secrets: secrets}.Verify(ctx, signedHeaders("other_secret", body), body))
+	// Without the previous secret, only the current secret is accepted.
+	assert.False(t, Verifier{Secrets: SigningSecrets{Current: "new_secret"}}.Verify(ctx, signedHeaders("old_secret", body), body))
+}
+
+func TestVerify(t *testing.T) {
+	body := "token=x&command=%2Fbelldog-show"
+	now := time.Now().Unix()
+	signature := func(timestamp int64) string {
+		return sign("secret", fmt.Sprintf("v0:%d:%s", timestamp, body))
+	}
+	tests := []struct {
+		name      string
+		headers   http.Header
+		tolerance time.Duration
+		want      bool
+	}{
+		{
+			name:    "canonical headers",
+			headers: http.Header{"X-Slack-Signature": {signature(now)}, "X-Slack-Request-Timestamp": {fmt.Sprint(now)}},
+			want:    true,
+		},
+		{
+			name:    "lowercase headers",
+			headers: http.Header{"x-slack-signature": {signature(now)}, "x-slack-request-timestamp": {fmt.Sprint(now)}},
+			want:    true,
+		},
+		{
+			name:    "missing signature",
+			headers: http.Header{"X-Slack-Request-Timestamp": {fmt.Sprint(now)}},
+		},
+		{
+			name:    "empty signature",
+			headers: http.Header{"X-Slack-Signature": {}, "X-Slack-Request-Timestamp": {fmt.Sprint(now)}},
+		},
+		{
+			name:    "missing timestamp",
+			headers: http.Header{"X-Slack-Signature": {signature(now)}},
+		},
+		{
+			name:    "invalid timestamp",
+			headers: http.Header{"X-Slack-Signature": {signature(now)}, "X-Slack-Request-Timestamp": {"now"}},
+		},
+		{
+			name:    "expired",
+			headers: http.Header{"X-Slack-Signature": {signature(now - 301)}, "X-Slack-Request-Timestamp": {fmt.Sprint(now - 301)}},
+		},
+		{
+			name:    "future",
+			headers: http.Header{"X-Slack-Signature": {signature(now + 301)}, "X-Slack-Request-Timestamp": {fmt.Sprint(now + 301)}},
+		},
+		{
+			name:      "within custom tolerance",
+			headers:   http.Header{"X-Slack-Signature": {signature(now - 301)}, "X-Slack-Request-Timestamp": {fmt.Sprint(now - 301)}},
+			tolerance: 10 * time.Minute,
+			want:      true,
+		},
+		{
+			name:      "beyond custom tolerance",
+			headers:   http.Header{"X-Slack-Signature": {signature(now - 61)}, "X-Slack-Request-Timestamp": {fmt.Sprint(now - 61)}},
+			tolerance: time.Minute,
+		},
+		{
+			name:    "timestamp not signed",
+			headers: http.Header{"X-Slack-Signature": {signature(now)}, "X-Slack-Request-Timestamp": {fmt.Sprint(now - 1)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Verifier{Secrets: SigningSecrets{Current: "secret"}, Tolerance: tt.tolerance, Replay: NewReplayCache()}
+			assert.Equal(t, tt.want, v.Verify(context.Background(), tt.headers, body))
+		})
+	}
+}
+
+func TestVerifyRejectsReplays(t *testing.T) {
+	ctx := context.Background()
+	body := "token=x&command=%2Fbelldog-show"
+	headers := signedHeaders("secret", body)
+	v := Verifier{Secrets: SigningSecrets{Current: "secret"}, Replay: NewReplayCache()}
+
+	assert.True(t, v.Verify(ctx, headers, body))
+	assert.False(t, v.Verify(ctx, headers, body))
+	// Invalid requests don't fill the cache.
+	assert.False(t, v.Verify(ctx, headers, "tampered"))
+	other := "token=x&command=%2Fbelldog-help"
+	assert.True(t, v.Verify(ctx, signedHeaders("secret", other), other))
+	// Without the cache, replays are not detected.
+	assert.True(t, Verifier{Secrets: SigningSecrets{Current: "secret"}}.Verify(ctx, headers, body))
+}
+
+func TestGetChannelsByID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("channel") {
+		case "C1":
+			_, _ = w.Write([]byte(`{"ok": true, "channel": {"id": "C1", "name": "alerts"}}`))
+		case "C2":
+			_, _ = w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+		default:
+			_, _ = w.Write([]byte(`{"ok": false, "error": "internal_error"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	client, err := NewClient(appconfig.Config{SlackAPIBaseURL: server.URL, SlackToken: "xoxb-test"})
+	require.NoError(t, err)
+
+	channels, err := client.GetChannelsByID(context.Background(), []string{"C1", "C2"})
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, "alerts", channels[0].Name)
+
+	_, err = client.GetChannelsByID(context.Background(), []string{"C1", "C3"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package slack
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// BookmarkParams is a link bookmark of the channel. Bookmarks are identified by the title, so status boards like
+// "On-call" keep a single bookmark.
+type BookmarkParams struct {
+	Title string
+	Link  string
+	// Optional, e.g. `:pager:`.
+	Emoji string
+}
+
+// UpsertBookmark edits the bookmark having the same title, or adds a new bookmark. The result is packed into
+// PostMessageResult like other message APIs, BookmarkID is set when succeeded.
+// https://api.slack.com/methods/bookmarks.edit
+//
+// Required scopes:
+//   - bookmarks:read
+//   - bookmarks:write
+func (s Client) UpsertBookmark(ctx context.Context, channelID string, channelName string, params BookmarkParams) (res PostMessageResult, err error) {
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] upsert bookmark", slog.String("channel_id", channelID), slog.String("title", params.Title), slog.String("link", params.Link))
+		return PostMessageResult{Type: PostMessageResultOK, BookmarkID: "Bk" + stubTS()}, nil
+	}
+
+	start := time.Now()
+	defer func() {
+		telemetry.RecordSlackAPICall(ctx, "bookmarks.edit", Outcome(res, err), time.Since(start))
+	}()
+	client := s.api
+	bookmarks, err := client.ListBookmarksContext(ctx, channelID)
+	if err != nil {
+		return apiCallResult(ctx, "bookmarks.list", channelID, channelName, err)
+	}
+	for _, b := range bookmarks {
+		if b.Type != "link" || b.Title != params.Title {
+			continue
+		}
+		edited, err := client.EditBookmarkContext(ctx, channelID, b.ID, slack.EditBookmarkParameters{
+			Title: &params.Title,
+			Emoji: &params.Emoji,
+			Link:  params.Link,
+		})
+		if err != nil {
+			return apiCallResult(ctx, "bookmarks.edit", channelID, channelName, err)
+		}
+		return PostMessageResult{Type: PostMessageResultOK, BookmarkID: edited.ID}, nil
+	}
+	added, err := client.AddBookmarkContext(ctx, channelID, slack.AddBookmarkParameters{
+		Title: params.Title,
+		Type:  "link",
+		Link:  params.Link,
+		Emoji: params.Emoji,
+	})
+	if err != nil {
+		return apiCallResult(ctx, "bookmarks.add", channelID, channelName, err)
+	}
+	return PostMessageResult{Type: PostMessageResultOK, BookmarkID: added.ID}, nil
+}
+
+// UpdateChannelCanvas replaces the whole content of the channel canvas with the Markdown, or creates the channel
+// canvas when the channel doesn't have one. The result is packed into PostMessageResult like other message APIs,
+// CanvasID is set when succeeded.
+// https://api.slack.com/methods/canvases.edit
+//
+// Required scopes:
+//   - canvases:write
+//   - channels:read
+//   - groups:read
+func (s Client) UpdateChannelCanvas(ctx context.Context, channelID string, channelName string, markdown string) (res PostMessageResult, err error) {
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] update channel canvas", slog.String("channel_id", channelID), slog.Int("size", len(markdown)))
+		return PostMessageResult{Type: PostMessageResultOK, CanvasID: "F" + stubTS()}, nil
+	}
+
+	start := time.Now()
+	defer func() {
+		telemetry.RecordSlackAPICall(ctx, "canvases.edit", Outcome(res, err), time.Since(start))
+	}()
+	client := s.api
+	content := slack.DocumentContent{Type: "markdown", Markdown: markdown}
+	channel, err := client.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channelID})
+	if err != nil {
+		return apiCallResult(ctx, "conversations.info", channelID, channelName, err)
+	}
+	if channel.Properties == nil || channel.Properties.Canvas.FileId == "" {
+		canvasID, err := client.CreateChannelCanvasContext(ctx, channelID, content)
+		if err != nil {
+			return apiCallResult(ctx, "conversations.canvases.create", channelID, channelName, err)
+		}
+		return PostMessageResult{Type: PostMessageResultOK, CanvasID: canvasID}, nil
+	}
+	canvasID := channel.Properties.Canvas.FileId
+	// Changes without section_id replace the whole canvas.
+	err = client.EditCanvasContext(ctx, slack.EditCanvasParams{
+		CanvasID: canvasID,
+		Changes:  []slack.CanvasChange{{Operation: "replace", DocumentContent: content}},
+	})
+	if err != nil {
+		return apiCallResult(ctx, "canvases.edit", channelID, channelName, err)
+	}
+	return PostMessageResult{Type: PostMessageResultOK, CanvasID: canvasID}, nil
+}
@@ -0,0 +1,104 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+// setupStatusClient returns the client calling the server, which responds with responses by API method and
+// records the called methods with their forms.
+func setupStatusClient(t *testing.T, responses map[string]string) (Client, *[]string, map[string]map[string]string) {
+	t.Helper()
+	var methods []string
+	forms := map[string]map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		method := r.URL.Path[1:]
+		methods = append(methods, method)
+		form := map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		forms[method] = form
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(responses[method]))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(appconfig.Config{SlackAPIBaseURL: server.URL, SlackToken: "xoxb-test"})
+	require.NoError(t, err)
+	return client, &methods, forms
+}
+
+func TestUpsertBookmark(t *testing.T) {
+	params := BookmarkParams{Title: "On-call", Link: "https://example.com/oncall", Emoji: ":pager:"}
+
+	t.Run("edit", func(t *testing.T) {
+		client, methods, forms := setupStatusClient(t, map[string]string{
+			"bookmarks.list": `{"ok": true, "bookmarks": [{"id": "Bk1", "title": "Deploy", "type": "link"}, {"id": "Bk2", "title": "On-call", "type": "link"}]}`,
+			"bookmarks.edit": `{"ok": true, "bookmark": {"id": "Bk2"}}`,
+		})
+		res, err := client.UpsertBookmark(context.Background(), "C123456", "test", params)
+		require.NoError(t, err)
+		assert.Equal(t, PostMessageResult{Type: PostMessageResultOK, BookmarkID: "Bk2"}, res)
+		assert.Equal(t, []string{"bookmarks.list", "bookmarks.edit"}, *methods)
+		assert.Equal(t, "Bk2", forms["bookmarks.edit"]["bookmark_id"])
+		assert.Equal(t, "https://example.com/oncall", forms["bookmarks.edit"]["link"])
+	})
+
+	t.Run("add", func(t *testing.T) {
+		client, methods, forms := setupStatusClient(t, map[string]string{
+			"bookmarks.list": `{"ok": true, "bookmarks": [{"id": "Bk1", "title": "Deploy", "type": "link"}]}`,
+			"bookmarks.add":  `{"ok": true, "bookmark": {"id": "Bk3"}}`,
+		})
+		res, err := client.UpsertBookmark(context.Background(), "C123456", "test", params)
+		require.NoError(t, err)
+		assert.Equal(t, PostMessageResult{Type: PostMessageResultOK, BookmarkID: "Bk3"}, res)
+		assert.Equal(t, []string{"bookmarks.list", "bookmarks.add"}, *methods)
+		assert.Equal(t, "On-call", forms["bookmarks.add"]["title"])
+		assert.Equal(t, ":pager:", forms["bookmarks.add"]["emoji"])
+	})
+
+	t.Run("api failure", func(t *testing.T) {
+		client, _, _ := setupStatusClient(t, map[string]string{
+			"bookmarks.list": `{"ok": false, "error": "missing_scope"}`,
+		})
+		res, err := client.UpsertBookmark(context.Background(), "C123456", "test", params)
+		require.NoError(t, err)
+		assert.Equal(t, PostMessageResult{Type: PostMessageResultAPIFailure, Reason: "missing_scope", ChannelID: "C123456", ChannelName: "test"}, res)
+	})
+}
+
+func TestUpdateChannelCanvas(t *testing.T) {
+	t.Run("edit", func(t *testing.T) {
+		client, methods, forms := setupStatusClient(t, map[string]string{
+			"conversations.info": `{"ok": true, "channel": {"id": "C123456", "properties": {"canvas": {"file_id": "F123"}}}}`,
+			"canvases.edit":      `{"ok": true}`,
+		})
+		res, err := client.UpdateChannelCanvas(context.Background(), "C123456", "test", "# Status")
+		require.NoError(t, err)
+		assert.Equal(t, PostMessageResult{Type: PostMessageResultOK, CanvasID: "F123"}, res)
+		assert.Equal(t, []string{"conversations.info", "canvases.edit"}, *methods)
+		assert.Equal(t, "F123", forms["canvases.edit"]["canvas_id"])
+		assert.JSONEq(t, `[{"operation": "replace", "document_content": {"type": "markdown", "markdown": "# Status"}}]`, forms["canvases.edit"]["changes"])
+	})
+
+	t.Run("create", func(t *testing.T) {
+		client, methods, forms := setupStatusClient(t, map[string]string{
+			"conversations.info":            `{"ok": true, "channel": {"id": "C123456"}}`,
+			"conversations.canvases.create": `{"ok": true, "canvas_id": "F456"}`,
+		})
+		res, err := client.UpdateChannelCanvas(context.Background(), "C123456", "test", "# Status")
+		require.NoError(t, err)
+		assert.Equal(t, PostMessageResult{Type: PostMessageResultOK, CanvasID: "F456"}, res)
+		assert.Equal(t, []string{"conversations.info", "conversations.canvases.create"}, *methods)
+		assert.JSONEq(t, `{"type": "markdown", "markdown": "# Status"}`, forms["conversations.canvases.create"]["document_content"])
+	})
+}
@@ -0,0 +1,47 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Stub mode (SLACK_STUB=true) logs requests instead of calling Slack API, so Belldog can run locally
+// without a Slack workspace. All requests succeed.
+
+func stubSend(ctx context.Context, method string, channelID string, payload map[string]interface{}) PostMessageResult {
+	b, err := marshalPayload(payload)
+	if err != nil {
+		b = []byte(fmt.Sprintf("%v", payload))
+	}
+	slog.InfoContext(ctx, "[slack stub] send message", slog.String("endpoint", method), slog.String("channel_id", channelID), slog.String("payload", string(b)))
+	ts := stubTS()
+	if method == slackAPIScheduleMessageMethod {
+		return PostMessageResult{Type: PostMessageResultOK, ScheduledMessageID: "Q" + ts}
+	}
+	if givenTS, ok := payload["ts"].(string); ok {
+		ts = givenTS
+	}
+	return PostMessageResult{Type: PostMessageResultOK, TS: ts}
+}
+
+func stubUploadFile(ctx context.Context, channelID string, params UploadFileParams) PostMessageResult {
+	slog.InfoContext(ctx, "[slack stub] upload file", slog.String("channel_id", channelID), slog.String("filename", params.Filename), slog.Int("size", params.Size))
+	return PostMessageResult{Type: PostMessageResultOK, FileID: "F" + stubTS()}
+}
+
+// Slash commands contain correct channel names except for legacy private groups.
+func stubCommandRequest(ctx context.Context, cmdReq OriginalSlashCommandRequest) SlashCommandRequest {
+	slog.InfoContext(ctx, "[slack stub] get conversation info", slog.String("channel_id", cmdReq.ChannelID))
+	return SlashCommandRequest{
+		OriginalSlashCommandRequest: cmdReq,
+		ChannelName:                 cmdReq.OriginalChannelName,
+		Supported:                   true,
+	}
+}
+
+func stubTS() string {
+	now := time.Now()
+	return fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/int(time.Microsecond))
+}
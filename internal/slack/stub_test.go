@@ -0,0 +1,37 @@
+package slack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+func TestStubClient(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewClient(appconfig.Config{SlackStub: true})
+	require.NoError(t, err)
+
+	res, err := client.PostMessage(ctx, "C123456", "test", map[string]interface{}{"text": "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, PostMessageResultOK, res.Type)
+	assert.NotEmpty(t, res.TS)
+
+	res, err = client.UpdateMessage(ctx, "C123456", "test", map[string]interface{}{"text": "hello", "ts": "1405894322.002768"})
+	require.NoError(t, err)
+	assert.Equal(t, "1405894322.002768", res.TS)
+
+	res, err = client.ScheduleMessage(ctx, "C123456", "test", map[string]interface{}{"text": "hello", "post_at": 1893456000})
+	require.NoError(t, err)
+	assert.NotEmpty(t, res.ScheduledMessageID)
+
+	cmdReq, err := client.GetFullCommandRequest(ctx, "command=%2Fbelldog-show&channel_id=C123456&channel_name=test&text=")
+	require.NoError(t, err)
+	assert.Equal(t, "test", cmdReq.ChannelName)
+	assert.True(t, cmdReq.Supported)
+
+	require.NoError(t, client.Prewarm(ctx))
+}
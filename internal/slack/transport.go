@@ -0,0 +1,41 @@
+package slack
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+
+	"github.com/cockroachdb/errors"
+	"github.com/hashicorp/go-cleanhttp"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+// newTransport returns the transport shared by Slack API clients. Requests go through the proxy given by
+// HTTPS_PROXY unless the host matches NO_PROXY. SLACK_CA_BUNDLE adds CAs to the system ones, e.g. the CA of
+// the egress proxy intercepting TLS.
+func newTransport(config appconfig.Config) (*http.Transport, error) {
+	transport := cleanhttp.DefaultPooledTransport()
+	transport.Proxy = http.ProxyFromEnvironment
+	if config.SlackCABundle == "" {
+		return transport, nil
+	}
+
+	pem, err := os.ReadFile(config.SlackCABundle)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read SLACK_CA_BUNDLE")
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Newf("no PEM certificates found in SLACK_CA_BUNDLE: %s", config.SlackCABundle)
+	}
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+	return transport, nil
+}
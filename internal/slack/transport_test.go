@@ -0,0 +1,54 @@
+package slack
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+func TestNewClientWithCABundle(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat.postMessage", r.URL.Path)
+		_, _ = w.Write([]byte(`{"ok": true, "ts": "1405894322.002768"}`))
+	}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, cert, 0o600))
+	cfg := appconfig.Config{SlackAPIBaseURL: server.URL + "/api", SlackToken: "xoxb-test"}
+
+	// The self-signed certificate of the server is not trusted without the bundle.
+	client, err := NewClient(cfg)
+	require.NoError(t, err)
+	_, err = client.PostMessage(ctx, "C123456", "test", map[string]interface{}{"text": "hello"})
+	require.Error(t, err)
+
+	cfg.SlackCABundle = bundle
+	client, err = NewClient(cfg)
+	require.NoError(t, err)
+	res, err := client.PostMessage(ctx, "C123456", "test", map[string]interface{}{"text": "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, PostMessageResultOK, res.Type)
+	assert.Equal(t, "1405894322.002768", res.TS)
+}
+
+func TestNewClientWithInvalidCABundle(t *testing.T) {
+	_, err := NewClient(appconfig.Config{SlackCABundle: filepath.Join(t.TempDir(), "missing.pem")})
+	require.Error(t, err)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, []byte("not a certificate"), 0o600))
+	_, err = NewClient(appconfig.Config{SlackCABundle: bundle})
+	require.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package slack
+
+import (
+	"context"
+	"log/slog"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+	"github.com/slack-go/slack"
+)
+
+// Slack rejects messages with too long `text` field with `msg_too_long` error.
+// https://api.slack.com/methods/chat.postMessage#truncating
+const (
+	maxMessageTextLength = 40000
+	truncatedMarker      = "\n…(truncated)"
+	truncateModeKey      = "truncate_mode"
+	snippetFilename      = "message.txt"
+)
+
+// TruncateMode controls how PostMessage handles over-long `text` field. Callers specify this with
+// `truncate_mode` payload field. Belldog removes the field before sending the payload to Slack.
+type TruncateMode string
+
+const (
+	// Truncate the text with the marker. Default.
+	TruncateModeTruncate TruncateMode = "truncate"
+	// Truncate the text, then upload the full text as a snippet in the thread of the posted message.
+	TruncateModeSnippet TruncateMode = "snippet"
+	// Send the payload as is. Slack will reject over-long messages.
+	TruncateModeNone TruncateMode = "none"
+)
+
+func popTruncateMode(payload map[string]interface{}) (TruncateMode, error) {
+	v, ok := payload[truncateModeKey]
+	if !ok {
+		return TruncateModeTruncate, nil
+	}
+	delete(payload, truncateModeKey)
+
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.Newf("truncate_mode must be a string: %v", v)
+	}
+	switch mode := TruncateMode(s); mode {
+	case TruncateModeTruncate, TruncateModeSnippet, TruncateModeNone:
+		return mode, nil
+	default:
+		return "", errors.Newf("unknown truncate_mode: %s", s)
+	}
+}
+
+// truncatePayloadText truncates `text` field in place when it exceeds the limit. It returns the original
+// text and true when truncated.
+func truncatePayloadText(payload map[string]interface{}, mode TruncateMode) (string, bool) {
+	if mode == TruncateModeNone {
+		return "", false
+	}
+	text, ok := payload["text"].(string)
+	if !ok || utf8.RuneCountInString(text) <= maxMessageTextLength {
+		return "", false
+	}
+	payload["text"] = truncateText(text, maxMessageTextLength)
+	return text, true
+}
+
+// truncateText cuts the text by rune, so multi-byte characters are not broken.
+func truncateText(text string, limit int) string {
+	keep := limit - utf8.RuneCountInString(truncatedMarker)
+	count := 0
+	for i := range text {
+		if count == keep {
+			return text[:i] + truncatedMarker
+		}
+		count++
+	}
+	return text
+}
+
+// https://api.slack.com/methods/files.getUploadURLExternal
+//
+// Required scopes:
+//   - files:write
+func (s Client) uploadSnippet(ctx context.Context, channelID string, threadTS string, content string) error {
+	client := s.api
+	params := slack.UploadFileV2Parameters{
+		Content:         content,
+		FileSize:        len(content),
+		Filename:        snippetFilename,
+		Title:           "Full message",
+		Channel:         channelID,
+		ThreadTimestamp: threadTS,
+	}
+	if _, err := client.UploadFileV2Context(ctx, params); err != nil {
+		return errors.Wrap(err, "failed to upload snippet")
+	}
+	slog.InfoContext(ctx, "uploaded truncated message as snippet", slog.String("channel_id", channelID), slog.Int("size", len(content)))
+	return nil
+}
@@ -0,0 +1,51 @@
+package slack
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPopTruncateMode(t *testing.T) {
+	payload := map[string]interface{}{"text": "hello"}
+	mode, err := popTruncateMode(payload)
+	require.NoError(t, err)
+	assert.Equal(t, TruncateModeTruncate, mode)
+
+	payload = map[string]interface{}{"text": "hello", "truncate_mode": "snippet"}
+	mode, err = popTruncateMode(payload)
+	require.NoError(t, err)
+	assert.Equal(t, TruncateModeSnippet, mode)
+	assert.NotContains(t, payload, "truncate_mode")
+
+	_, err = popTruncateMode(map[string]interface{}{"truncate_mode": "unknown"})
+	require.Error(t, err)
+	_, err = popTruncateMode(map[string]interface{}{"truncate_mode": 1})
+	require.Error(t, err)
+}
+
+func TestTruncatePayloadText(t *testing.T) {
+	short := map[string]interface{}{"text": "hello"}
+	_, truncated := truncatePayloadText(short, TruncateModeTruncate)
+	assert.False(t, truncated)
+	assert.Equal(t, "hello", short["text"])
+
+	// Multi-byte characters must not be broken.
+	long := strings.Repeat("あ", maxMessageTextLength+1)
+	payload := map[string]interface{}{"text": long}
+	full, truncated := truncatePayloadText(payload, TruncateModeSnippet)
+	assert.True(t, truncated)
+	assert.Equal(t, long, full)
+	text := payload["text"].(string)
+	assert.True(t, utf8.ValidString(text))
+	assert.Equal(t, maxMessageTextLength, utf8.RuneCountInString(text))
+	assert.True(t, strings.HasSuffix(text, truncatedMarker))
+
+	payload = map[string]interface{}{"text": long}
+	_, truncated = truncatePayloadText(payload, TruncateModeNone)
+	assert.False(t, truncated)
+	assert.Equal(t, long, payload["text"])
+}
@@ -0,0 +1,152 @@
+package slack
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/slack-go/slack"
+)
+
+// LookupUserIDByEmail returns found=false when no user has the email.
+// https://api.slack.com/methods/users.lookupByEmail
+//
+// Required scopes:
+//   - users:read.email
+func (s *Client) LookupUserIDByEmail(ctx context.Context, email string) (string, bool, error) {
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] lookup user by email", slog.String("email", email))
+		return "", false, nil
+	}
+	client := s.api
+	user, err := client.GetUserByEmailContext(ctx, email)
+	if err != nil {
+		var serr slack.SlackErrorResponse
+		if errors.As(err, &serr) && serr.Err == "users_not_found" {
+			return "", false, nil
+		}
+		return "", false, errors.Wrap(err, "failed to lookup user by email")
+	}
+	return user.ID, true, nil
+}
+
+// UserRole is the role of a workspace user, used by slash command permission checks.
+type UserRole string
+
+const (
+	UserRoleOwner  UserRole = "owner"
+	UserRoleAdmin  UserRole = "admin"
+	UserRoleMember UserRole = "member"
+	// Multi-channel and single-channel guests.
+	UserRoleGuest UserRole = "guest"
+)
+
+// GetUserRole returns the highest role of the user.
+// https://api.slack.com/methods/users.info
+//
+// Required scopes:
+//   - users:read
+func (s *Client) GetUserRole(ctx context.Context, userID string) (UserRole, error) {
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] get user info", slog.String("user_id", userID))
+		return UserRoleMember, nil
+	}
+	client := s.api
+	user, err := client.GetUserInfoContext(ctx, userID)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get user info: %s", userID)
+	}
+	switch {
+	case user.IsOwner || user.IsPrimaryOwner:
+		return UserRoleOwner, nil
+	case user.IsAdmin:
+		return UserRoleAdmin, nil
+	case user.IsRestricted || user.IsUltraRestricted:
+		return UserRoleGuest, nil
+	default:
+		return UserRoleMember, nil
+	}
+}
+
+// GetUserGroupMembers returns user IDs of the user group.
+// https://api.slack.com/methods/usergroups.users.list
+//
+// Required scopes:
+//   - usergroups:read
+func (s *Client) GetUserGroupMembers(ctx context.Context, userGroupID string) ([]string, error) {
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] list user group members", slog.String("usergroup_id", userGroupID))
+		return []string{}, nil
+	}
+	client := s.api
+	members, err := client.GetUserGroupMembersContext(ctx, userGroupID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list user group members: %s", userGroupID)
+	}
+	return members, nil
+}
+
+// ChannelMembership is the membership summary of a channel.
+type ChannelMembership struct {
+	MemberCount int
+	// Whether belldog is a member of the channel.
+	IsMember  bool
+	IsPrivate bool
+}
+
+// GetChannelMembership returns found=false when belldog can't see the channel, e.g. a private channel belldog is
+// not invited to.
+// https://api.slack.com/methods/conversations.info
+//
+// Required scopes:
+//   - channels:read
+//   - groups:read
+func (s *Client) GetChannelMembership(ctx context.Context, channelID string) (ChannelMembership, bool, error) {
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] get channel membership", slog.String("channel_id", channelID))
+		return ChannelMembership{IsMember: true}, true, nil
+	}
+	client := s.api
+	input := slack.GetConversationInfoInput{
+		ChannelID:         channelID,
+		IncludeLocale:     false,
+		IncludeNumMembers: true,
+	}
+	channel, err := client.GetConversationInfoContext(ctx, &input)
+	if err != nil {
+		var serr slack.SlackErrorResponse
+		if errors.As(err, &serr) && serr.Err == "channel_not_found" {
+			return ChannelMembership{}, false, nil
+		}
+		return ChannelMembership{}, false, errors.Wrapf(err, "failed to get conversation info: %s", channelID)
+	}
+	return ChannelMembership{
+		MemberCount: channel.NumMembers,
+		IsMember:    channel.IsMember,
+		IsPrivate:   channel.IsPrivate,
+	}, true, nil
+}
+
+// GetUserGroupIDsByHandle returns IDs of enabled user groups by their lowercased handles, e.g. `sre`.
+// https://api.slack.com/methods/usergroups.list
+//
+// Required scopes:
+//   - usergroups:read
+func (s *Client) GetUserGroupIDsByHandle(ctx context.Context) (map[string]string, error) {
+	if s.stub {
+		slog.InfoContext(ctx, "[slack stub] list user groups")
+		return map[string]string{}, nil
+	}
+	client := s.api
+	groups, err := client.GetUserGroupsContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list user groups")
+	}
+	ids := make(map[string]string, len(groups))
+	for _, g := range groups {
+		// Handles are case-insensitive like user names.
+		ids[strings.ToLower(g.Handle)] = g.ID
+	}
+	return ids, nil
+}
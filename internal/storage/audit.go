@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	av "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+)
+
+// AuditRecord is an immutable record of a token lifecycle operation. Audit records are stored in
+// a separate table from token records: partition key is `channel_id` and sort key is `timestamp`.
+type AuditRecord struct {
+	ChannelID   string `dynamodbav:"channel_id"`
+	Timestamp   string `dynamodbav:"timestamp"`
+	ChannelName string `dynamodbav:"channel_name"`
+	UserID      string `dynamodbav:"user_id"`
+	UserName    string `dynamodbav:"user_name"`
+	Command     string `dynamodbav:"command"`
+	Result      string `dynamodbav:"result"`
+	TokenPrefix string `dynamodbav:"token_prefix,omitempty"`
+}
+
+type AuditDDB struct {
+	inner     *dynamodb.Client
+	tableName *string
+}
+
+func NewAuditDDB(ctx context.Context, awsConfig aws.Config, tableName string) (AuditDDB, error) {
+	inner := dynamodb.NewFromConfig(awsConfig)
+	return AuditDDB{inner: inner, tableName: &tableName}, nil
+}
+
+// SaveAuditRecord appends an audit record. Existing records are never overwritten.
+func (s *AuditDDB) SaveAuditRecord(ctx context.Context, rec AuditRecord) error {
+	m, err := av.MarshalMap(rec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal audit record: %+v", rec)
+	}
+	input := dynamodb.PutItemInput{
+		Item:                m,
+		TableName:           s.tableName,
+		ConditionExpression: aws.String("attribute_not_exists(channel_id) AND attribute_not_exists(#ts)"),
+		// `timestamp` is a DynamoDB reserved word.
+		ExpressionAttributeNames: map[string]string{"#ts": "timestamp"},
+	}
+	if _, err := s.inner.PutItem(ctx, &input); err != nil {
+		return errors.Wrap(err, "failed to put audit item")
+	}
+	return nil
+}
+
+// QueryAuditRecordsByChannelID returns at most `limit` recent AuditRecords sorted by .Timestamp with descending order.
+func (s *AuditDDB) QueryAuditRecordsByChannelID(ctx context.Context, channelID string, limit int32) ([]AuditRecord, error) {
+	input := dynamodb.QueryInput{
+		TableName:                 s.tableName,
+		KeyConditionExpression:    aws.String("channel_id = :channel_id"),
+		ExpressionAttributeValues: itemMap{":channel_id": &types.AttributeValueMemberS{Value: channelID}},
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int32(limit),
+	}
+	out, err := s.inner.Query(ctx, &input)
+	if err != nil {
+		return []AuditRecord{}, errors.Wrap(err, "failed to query audit records")
+	}
+
+	recs := make([]AuditRecord, len(out.Items))
+	for i, item := range out.Items {
+		rec := AuditRecord{}
+		if err := av.UnmarshalMap(item, &rec); err != nil {
+			return []AuditRecord{}, errors.Wrapf(err, "failed to unmarshal audit item: %v", item)
+		}
+		recs[i] = rec
+	}
+	return recs, nil
+}
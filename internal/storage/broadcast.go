@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	av "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+)
+
+// ErrRecordConflict is returned by SaveBroadcastGroup when the group is deleted or saved by another request after
+// reading it.
+var ErrRecordConflict = errors.New("record updated concurrently")
+
+// BroadcastGroupRecord links channels into a group posted at once with the group token. Broadcast group records
+// are stored in a separate table from token records: partition key is `group_name`.
+type BroadcastGroupRecord struct {
+	GroupName string            `dynamodbav:"group_name"`
+	Token     string            `dynamodbav:"token"`
+	Members   []BroadcastMember `dynamodbav:"members"`
+	CreatedAt string            `dynamodbav:"created_at"`
+	// Slack user ID who created the group.
+	CreatedBy string `dynamodbav:"created_by"`
+	// Incremented on each save, so concurrent member updates don't overwrite each other.
+	Revision int `dynamodbav:"revision"`
+}
+
+type BroadcastMember struct {
+	ChannelID   string `dynamodbav:"channel_id"`
+	ChannelName string `dynamodbav:"channel_name"`
+}
+
+type BroadcastDDB struct {
+	inner     *dynamodb.Client
+	tableName *string
+}
+
+func NewBroadcastDDB(ctx context.Context, awsConfig aws.Config, tableName string) (BroadcastDDB, error) {
+	inner := dynamodb.NewFromConfig(awsConfig)
+	return BroadcastDDB{inner: inner, tableName: &tableName}, nil
+}
+
+// GetBroadcastGroup returns found=false when no group has the name.
+func (s *BroadcastDDB) GetBroadcastGroup(ctx context.Context, groupName string) (BroadcastGroupRecord, bool, error) {
+	input := dynamodb.GetItemInput{
+		TableName: s.tableName,
+		Key:       itemMap{"group_name": &types.AttributeValueMemberS{Value: groupName}},
+	}
+	out, err := s.inner.GetItem(ctx, &input)
+	if err != nil {
+		return BroadcastGroupRecord{}, false, errors.Wrap(err, "failed to get broadcast group item")
+	}
+	if out.Item == nil {
+		return BroadcastGroupRecord{}, false, nil
+	}
+	rec := BroadcastGroupRecord{}
+	if err := av.UnmarshalMap(out.Item, &rec); err != nil {
+		return BroadcastGroupRecord{}, false, errors.Wrapf(err, "failed to unmarshal broadcast group item: group_name=%s", groupName)
+	}
+	return rec, true, nil
+}
+
+// CreateBroadcastGroup puts a new group. It never overwrites existing group, returns ErrRecordAlreadyExists instead.
+func (s *BroadcastDDB) CreateBroadcastGroup(ctx context.Context, rec BroadcastGroupRecord) error {
+	m, err := av.MarshalMap(rec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal broadcast group record: group_name=%s", rec.GroupName)
+	}
+	input := dynamodb.PutItemInput{
+		Item:                m,
+		TableName:           s.tableName,
+		ConditionExpression: aws.String("attribute_not_exists(group_name)"),
+	}
+	if _, err := s.inner.PutItem(ctx, &input); err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return errors.Wrapf(ErrRecordAlreadyExists, "group_name=%s", rec.GroupName)
+		}
+		return errors.Wrap(err, "failed to put broadcast group item")
+	}
+	return nil
+}
+
+// SaveBroadcastGroup overwrites the group read with GetBroadcastGroup and increments its revision. When the group is
+// deleted or saved by another request after reading, it returns ErrRecordConflict instead.
+func (s *BroadcastDDB) SaveBroadcastGroup(ctx context.Context, rec BroadcastGroupRecord) error {
+	revision := rec.Revision
+	rec.Revision++
+	m, err := av.MarshalMap(rec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal broadcast group record: group_name=%s", rec.GroupName)
+	}
+	input := dynamodb.PutItemInput{
+		Item:      m,
+		TableName: s.tableName,
+		// Groups created before revisions were introduced have no revision attribute.
+		ConditionExpression: aws.String("attribute_exists(group_name) AND (revision = :revision OR attribute_not_exists(revision))"),
+		ExpressionAttributeValues: itemMap{
+			":revision": &types.AttributeValueMemberN{Value: strconv.Itoa(revision)},
+		},
+	}
+	if _, err := s.inner.PutItem(ctx, &input); err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return errors.Wrapf(ErrRecordConflict, "group_name=%s, revision=%d", rec.GroupName, revision)
+		}
+		return errors.Wrap(err, "failed to put broadcast group item")
+	}
+	return nil
+}
+
+func (s *BroadcastDDB) DeleteBroadcastGroup(ctx context.Context, groupName string) error {
+	input := dynamodb.DeleteItemInput{
+		TableName: s.tableName,
+		Key:       itemMap{"group_name": &types.AttributeValueMemberS{Value: groupName}},
+	}
+	if _, err := s.inner.DeleteItem(ctx, &input); err != nil {
+		return errors.Wrap(err, "failed to delete broadcast group item")
+	}
+	return nil
+}
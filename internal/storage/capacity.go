@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// newRetryer returns the retryer of DynamoDB clients. The adaptive mode slows down attempts of the process while
+// DynamoDB throttles them, so bursts are spread over time instead of failing. The retry quota of the standard
+// mode is disabled: it fails requests immediately once many requests are throttled, which is the burst the
+// adaptive mode handles.
+func newRetryer(maxAttempts int, maxBackoff time.Duration) func() aws.Retryer {
+	return func() aws.Retryer {
+		return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, func(so *retry.StandardOptions) {
+				so.MaxAttempts = max(maxAttempts, 1)
+				so.MaxBackoff = maxBackoff
+				so.RateLimiter = ratelimit.None
+			})
+		})
+	}
+}
+
+// addCapacityMiddlewares makes DynamoDB operations return the consumed capacity and records it, and records
+// throttled attempts.
+func addCapacityMiddlewares(stack *middleware.Stack) error {
+	if err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ConsumedCapacity", recordConsumedCapacity), middleware.After); err != nil {
+		return err
+	}
+	// After the retry middleware to see every attempt.
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("ThrottledAttempts", recordThrottledAttempt), "Retry", middleware.After)
+}
+
+func recordConsumedCapacity(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	kind := "read"
+	switch params := in.Parameters.(type) {
+	case *dynamodb.GetItemInput:
+		params.ReturnConsumedCapacity = types.ReturnConsumedCapacityTotal
+	case *dynamodb.QueryInput:
+		params.ReturnConsumedCapacity = types.ReturnConsumedCapacityTotal
+	case *dynamodb.ScanInput:
+		params.ReturnConsumedCapacity = types.ReturnConsumedCapacityTotal
+	case *dynamodb.PutItemInput:
+		params.ReturnConsumedCapacity = types.ReturnConsumedCapacityTotal
+		kind = "write"
+	case *dynamodb.UpdateItemInput:
+		params.ReturnConsumedCapacity = types.ReturnConsumedCapacityTotal
+		kind = "write"
+	case *dynamodb.DeleteItemInput:
+		params.ReturnConsumedCapacity = types.ReturnConsumedCapacityTotal
+		kind = "write"
+	default:
+		return next.HandleInitialize(ctx, in)
+	}
+
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	if consumed := consumedCapacityOf(out.Result); consumed != nil && consumed.CapacityUnits != nil {
+		telemetry.RecordDynamoDBConsumedCapacity(ctx, aws.ToString(consumed.TableName), awsmiddleware.GetOperationName(ctx), kind, *consumed.CapacityUnits)
+	}
+	return out, metadata, err
+}
+
+func consumedCapacityOf(result interface{}) *types.ConsumedCapacity {
+	switch result := result.(type) {
+	case *dynamodb.GetItemOutput:
+		return result.ConsumedCapacity
+	case *dynamodb.QueryOutput:
+		return result.ConsumedCapacity
+	case *dynamodb.ScanOutput:
+		return result.ConsumedCapacity
+	case *dynamodb.PutItemOutput:
+		return result.ConsumedCapacity
+	case *dynamodb.UpdateItemOutput:
+		return result.ConsumedCapacity
+	case *dynamodb.DeleteItemOutput:
+		return result.ConsumedCapacity
+	default:
+		return nil
+	}
+}
+
+func recordThrottledAttempt(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	out, metadata, err := next.HandleFinalize(ctx, in)
+	if err != nil && IsThrottled(err) {
+		operation := awsmiddleware.GetOperationName(ctx)
+		telemetry.RecordDynamoDBThrottle(ctx, operation)
+		slog.DebugContext(ctx, "DynamoDB throttled the attempt", slog.String("operation", operation))
+	}
+	return out, metadata, err
+}
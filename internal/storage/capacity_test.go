@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+func TestDynamoDBConfigRetriesThrottledOperations(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var input map[string]interface{}
+		_ = json.Unmarshal(body, &input)
+		assert.Equal(t, "TOTAL", input["ReturnConsumedCapacity"])
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if calls.Add(1) < 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type": "com.amazonaws.dynamodb.v20120810#ProvisionedThroughputExceededException", "message": "throttled"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ConsumedCapacity": {"TableName": "belldog", "CapacityUnits": 1.5}}`))
+	}))
+	defer server.Close()
+
+	awsConfig := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "dummy", SecretAccessKey: "dummy"}, nil
+		}),
+	}
+	client := dynamodb.NewFromConfig(DynamoDBConfig(awsConfig, appconfig.Config{
+		DdbEndpointURL:      server.URL,
+		DdbRetryMaxAttempts: 3,
+		DdbRetryMaxBackoff:  10 * time.Millisecond,
+	}))
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("belldog"),
+		Item:      itemMap{"channel_name": &types.AttributeValueMemberS{Value: "test"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	got := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+	capacity, ok := got["belldog.dynamodb.consumed_capacity"].(metricdata.Sum[float64])
+	require.True(t, ok)
+	require.Len(t, capacity.DataPoints, 1)
+	assert.Equal(t, 1.5, capacity.DataPoints[0].Value)
+	table, _ := capacity.DataPoints[0].Attributes.Value("table")
+	assert.Equal(t, "belldog", table.AsString())
+	kind, _ := capacity.DataPoints[0].Attributes.Value("capacity")
+	assert.Equal(t, "write", kind.AsString())
+
+	throttles, ok := got["belldog.dynamodb.throttles"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, throttles.DataPoints, 1)
+	assert.Equal(t, int64(1), throttles.DataPoints[0].Value)
+}
+
+func TestIsThrottled(t *testing.T) {
+	assert.True(t, IsThrottled(&types.ProvisionedThroughputExceededException{}))
+	assert.False(t, IsThrottled(&types.InternalServerError{}))
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	av "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+)
+
+// ChannelConfigRecord holds per-channel default message options and the pause state. Channel config records are
+// stored in a separate table from token records: partition key is `channel_id`.
+type ChannelConfigRecord struct {
+	ChannelID   string `dynamodbav:"channel_id"`
+	IconEmoji   string `dynamodbav:"icon_emoji,omitempty"`
+	Username    string `dynamodbav:"username,omitempty"`
+	UnfurlLinks *bool  `dynamodbav:"unfurl_links,omitempty"`
+	LinkNames   *bool  `dynamodbav:"link_names,omitempty"`
+	// Duration string like `60s`.
+	DigestWindow string `dynamodbav:"digest_window,omitempty"`
+	// Message template of Workflow Builder requests.
+	WorkflowTemplate string `dynamodbav:"workflow_template,omitempty"`
+	// `<severity>=<value>` pairs separated by commas.
+	SeverityColors string `dynamodbav:"severity_colors,omitempty"`
+	SeverityEmoji  string `dynamodbav:"severity_emoji,omitempty"`
+	// Compacted JSON schema of webhook payloads.
+	PayloadSchema string `dynamodbav:"payload_schema,omitempty"`
+	// Zero uses MAX_TOKEN_COUNT.
+	MaxTokenCount int `dynamodbav:"max_token_count,omitempty"`
+	// `HH:MM-HH:MM <time zone>` like `22:00-07:00 Asia/Tokyo`.
+	QuietHours string `dynamodbav:"quiet_hours,omitempty"`
+	// Non-empty while webhook requests to the channel are paused.
+	PausedAt string `dynamodbav:"paused_at,omitempty"`
+	// Slack user ID who paused the channel.
+	PausedBy string `dynamodbav:"paused_by,omitempty"`
+}
+
+type ChannelConfigDDB struct {
+	inner     *dynamodb.Client
+	tableName *string
+}
+
+func NewChannelConfigDDB(ctx context.Context, awsConfig aws.Config, tableName string) (ChannelConfigDDB, error) {
+	inner := dynamodb.NewFromConfig(awsConfig)
+	return ChannelConfigDDB{inner: inner, tableName: &tableName}, nil
+}
+
+// GetChannelConfig returns found=false when no config has been saved for the channel.
+func (s *ChannelConfigDDB) GetChannelConfig(ctx context.Context, channelID string) (ChannelConfigRecord, bool, error) {
+	input := dynamodb.GetItemInput{
+		TableName: s.tableName,
+		Key:       itemMap{"channel_id": &types.AttributeValueMemberS{Value: channelID}},
+	}
+	out, err := s.inner.GetItem(ctx, &input)
+	if err != nil {
+		return ChannelConfigRecord{}, false, errors.Wrap(err, "failed to get channel config item")
+	}
+	if out.Item == nil {
+		return ChannelConfigRecord{}, false, nil
+	}
+	rec := ChannelConfigRecord{}
+	if err := av.UnmarshalMap(out.Item, &rec); err != nil {
+		return ChannelConfigRecord{}, false, errors.Wrapf(err, "failed to unmarshal channel config item: %v", out.Item)
+	}
+	return rec, true, nil
+}
+
+// SaveChannelConfig overwrites the config of the channel.
+func (s *ChannelConfigDDB) SaveChannelConfig(ctx context.Context, rec ChannelConfigRecord) error {
+	m, err := av.MarshalMap(rec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal channel config record: %+v", rec)
+	}
+	input := dynamodb.PutItemInput{
+		Item:      m,
+		TableName: s.tableName,
+	}
+	if _, err := s.inner.PutItem(ctx, &input); err != nil {
+		return errors.Wrap(err, "failed to put channel config item")
+	}
+	return nil
+}
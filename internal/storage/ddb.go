@@ -2,53 +2,188 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"math"
 	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	av "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/cockroachdb/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Finatext/belldog/internal/secret"
 )
 
 type itemMap map[string]types.AttributeValue
 
+// ErrRecordAlreadyExists is returned by Save when a record with the same channel name and version exists.
+// This happens when another request saved a record concurrently.
+var ErrRecordAlreadyExists = errors.New("record already exists")
+
 type Record struct {
-	ChannelID   string `dynamodbav:"channel_id"`
-	ChannelName string `dynamodbav:"channel_name"`
-	Token       string `dynamodbav:"token"`
-	Version     int    `dynamodbav:"version"`
-	CreatedAt   string `dynamodbav:"created_at"`
+	ChannelID   string `dynamodbav:"channel_id" json:"channel_id"`
+	ChannelName string `dynamodbav:"channel_name" json:"channel_name"`
+	Token       string `dynamodbav:"token" json:"token"`
+	// Non-secret prefix of the token. Empty for tokens generated before prefixes were introduced.
+	TokenPrefix string `dynamodbav:"token_prefix,omitempty" json:"token_prefix,omitempty"`
+	Version     int    `dynamodbav:"version" json:"version"`
+	CreatedAt   string `dynamodbav:"created_at" json:"created_at"`
+	// Empty for records saved before token scopes were introduced.
+	Scope string `dynamodbav:"scope,omitempty" json:"scope,omitempty"`
+	// Updated at most hourly by webhook requests. Empty until the token is used.
+	LastUsedAt string `dynamodbav:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	// When the channel was notified that the unused token will be revoked.
+	StaleNotifiedAt string `dynamodbav:"stale_notified_at,omitempty" json:"stale_notified_at,omitempty"`
+	// When the batch job generated the replacement of this token. The token is revoked after the rotation grace
+	// period.
+	RotatedAt string `dynamodbav:"rotated_at,omitempty" json:"rotated_at,omitempty"`
+	// Non-empty for tombstones of archived channels, which are restored when the channel is unarchived.
+	// Queries don't return tombstones.
+	ArchivedAt string `dynamodbav:"archived_at,omitempty" json:"archived_at,omitempty"`
+	// Non-empty for tombstones of revoked tokens, which can be restored by users until expires_at.
+	RevokedAt string `dynamodbav:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	// DynamoDB TTL attribute (Unix time in seconds) to delete tombstones.
+	ExpiresAt int64 `dynamodbav:"expires_at,omitempty" json:"expires_at,omitempty"`
+	// Rules like `text <- $.alert.description` to build Slack payloads from arbitrary JSON payloads.
+	Mappings []string `dynamodbav:"mappings,omitempty" json:"mappings,omitempty"`
+	// Consecutive webhook requests failed because the channel is not found or archived. Reset by a successful
+	// request.
+	DeliveryFailures      int    `dynamodbav:"delivery_failures,omitempty" json:"delivery_failures,omitempty"`
+	DeliveryFailureReason string `dynamodbav:"delivery_failure_reason,omitempty" json:"delivery_failure_reason,omitempty"`
+	// When the delivery failures were escalated to ops.
+	UndeliverableAt string `dynamodbav:"undeliverable_at,omitempty" json:"undeliverable_at,omitempty"`
+
+	// The token attribute as stored in the table when the token is encrypted, for condition expressions.
+	storedToken string
+}
+
+// String, GoString and LogValue give the prefix of the token instead of the token, so formatting records in logs
+// and errors never leaks tokens.
+func (r Record) String() string {
+	return fmt.Sprintf("{channel_id=%s channel_name=%s token=%s version=%d created_at=%s}", r.ChannelID, r.ChannelName, secret.Token(r.Token), r.Version, r.CreatedAt)
+}
+
+func (r Record) GoString() string {
+	return "storage.Record" + r.String()
+}
+
+func (r Record) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("channel_id", r.ChannelID),
+		slog.String("channel_name", r.ChannelName),
+		slog.Any("token", secret.Token(r.Token)),
+		slog.Int("version", r.Version),
+		slog.String("created_at", r.CreatedAt),
+	)
+}
+
+func (r Record) Archived() bool {
+	return r.ArchivedAt != ""
+}
+
+func (r Record) Revoked() bool {
+	return r.RevokedAt != ""
+}
+
+// Tombstone reports whether the record works as a deleted record: archived or revoked.
+func (r Record) Tombstone() bool {
+	return r.Archived() || r.Revoked()
+}
+
+// Expired reports whether DynamoDB TTL may delete the tombstone. TTL deletes items lazily, so expired tombstones
+// can be still in the table.
+func (r Record) Expired(now time.Time) bool {
+	return r.ExpiresAt > 0 && now.Unix() >= r.ExpiresAt
 }
 
 type DDB struct {
 	inner     *dynamodb.Client
 	tableName *string
+	// Optional GSI having `channel_id` as partition key.
+	channelIDIndexName string
+	// Optional GSI having `token` as partition key.
+	tokenIndexName string
+	// Save overwrites records created later than the given record, see Save.
+	createdAtTiebreak bool
+	// Optional, encrypts the token attribute.
+	cipher TokenCipher
+}
+
+// TokenCipher encrypts the token attribute of records, e.g. kmsenvelope.Cipher. Decrypt must return values not
+// encrypted as is, so records saved before enabling encryption keep working.
+type TokenCipher interface {
+	Encrypt(ctx context.Context, plaintext string) (string, error)
+	Decrypt(ctx context.Context, value string) (string, error)
 }
 
-func NewDDB(ctx context.Context, awsConfig aws.Config, tableName string) (DDB, error) {
+// EncryptTokens enables encryption of the token attribute: tokens are encrypted on Save and decrypted on queries
+// and scans. Encrypted tokens can't be queried, so this fails when the token index is configured.
+func (s *DDB) EncryptTokens(cipher TokenCipher) error {
+	if s.tokenIndexName != "" {
+		return errors.New("token index can't be used with token encryption")
+	}
+	s.cipher = cipher
+	return nil
+}
+
+// NewDDB creates DDB. Index names are optional, empty string disables QueryByChannelID and QueryByToken.
+func NewDDB(ctx context.Context, awsConfig aws.Config, tableName string, channelIDIndexName string, tokenIndexName string) (DDB, error) {
 	inner := dynamodb.NewFromConfig(awsConfig)
-	return DDB{inner: inner, tableName: &tableName}, nil
+	return DDB{inner: inner, tableName: &tableName, channelIDIndexName: channelIDIndexName, tokenIndexName: tokenIndexName}, nil
 }
 
+// Save puts a new record. It never overwrites existing record except tombstones, returns ErrRecordAlreadyExists
+// instead. With the created_at tiebreak enabled for Global Tables, a record created earlier also overwrites the
+// existing one: when both regions save the same version during a failover, every region keeps the record created
+// first regardless of the write order, so the regions don't diverge.
 func (s *DDB) Save(ctx context.Context, rec Record) error {
+	if s.cipher != nil {
+		encrypted, err := s.cipher.Encrypt(ctx, rec.Token)
+		if err != nil {
+			return errors.Wrapf(err, "failed to encrypt token: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+		}
+		rec.Token = encrypted
+	}
 	m, err := av.MarshalMap(rec)
 	if err != nil {
-		return errors.Wrapf(err, "failed to marshal record: %+v", rec)
+		return errors.Wrapf(err, "failed to marshal record: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
 	}
 	input := dynamodb.PutItemInput{
-		Item:      m,
-		TableName: s.tableName,
+		Item:                m,
+		TableName:           s.tableName,
+		ConditionExpression: aws.String("(attribute_not_exists(channel_name) AND attribute_not_exists(version)) OR attribute_exists(archived_at) OR attribute_exists(revoked_at)"),
+	}
+	if s.createdAtTiebreak && rec.CreatedAt != "" {
+		input.ConditionExpression = aws.String(*input.ConditionExpression + " OR created_at > :created_at")
+		input.ExpressionAttributeValues = itemMap{":created_at": &types.AttributeValueMemberS{Value: rec.CreatedAt}}
 	}
 	if _, err := s.inner.PutItem(ctx, &input); err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return errors.Wrapf(ErrRecordAlreadyExists, "channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+		}
 		return errors.Wrap(err, "failed to put item")
 	}
 	return nil
 }
 
-// QueryByChannelName returns found Records sorted by .Version with descending order.
+// QueryByChannelName returns found Records sorted by .Version with descending order. Tombstones are excluded.
 // https://docs.aws.amazon.com/amazondynamodb/latest/APIReference/API_Query.html
 func (s *DDB) QueryByChannelName(ctx context.Context, channelName string) ([]Record, error) {
+	return s.queryChannelName(ctx, channelName, func(rec Record) bool { return !rec.Tombstone() })
+}
+
+// QueryTombstonesByChannelName returns tombstones having the channel name sorted by .Version, including expired
+// ones not deleted by DynamoDB TTL yet.
+func (s *DDB) QueryTombstonesByChannelName(ctx context.Context, channelName string) ([]Record, error) {
+	return s.queryChannelName(ctx, channelName, Record.Tombstone)
+}
+
+func (s *DDB) queryChannelName(ctx context.Context, channelName string, keep func(Record) bool) ([]Record, error) {
 	input := dynamodb.QueryInput{
 		TableName:                 s.tableName,
 		KeyConditionExpression:    aws.String("channel_name = :channel_name"),
@@ -59,18 +194,249 @@ func (s *DDB) QueryByChannelName(ctx context.Context, channelName string) ([]Rec
 	if err != nil {
 		return []Record{}, errors.Wrap(err, "failed to query")
 	}
+	return s.unmarshalRecords(ctx, out.Items, keep)
+}
+
+// QueryByChannelID returns records linked to the channel ID using the channel ID GSI. The GSI must project
+// all attributes. Tombstones are excluded.
+func (s *DDB) QueryByChannelID(ctx context.Context, channelID string) ([]Record, error) {
+	if s.channelIDIndexName == "" {
+		return []Record{}, errors.New("channel ID index is not configured")
+	}
+	return s.queryIndex(ctx, s.channelIDIndexName, "channel_id", channelID)
+}
+
+// QueryByToken returns records having the token using the token GSI regardless of the channel name.
+// The GSI must project all attributes. Tombstones are excluded.
+func (s *DDB) QueryByToken(ctx context.Context, token string) ([]Record, error) {
+	if s.tokenIndexName == "" {
+		return []Record{}, errors.New("token index is not configured")
+	}
+	return s.queryIndex(ctx, s.tokenIndexName, "token", token)
+}
+
+func (s *DDB) queryIndex(ctx context.Context, indexName string, keyName string, value string) ([]Record, error) {
+	input := dynamodb.QueryInput{
+		TableName:                 s.tableName,
+		IndexName:                 aws.String(indexName),
+		KeyConditionExpression:    aws.String("#k = :v"),
+		ExpressionAttributeNames:  map[string]string{"#k": keyName},
+		ExpressionAttributeValues: itemMap{":v": &types.AttributeValueMemberS{Value: value}},
+	}
+	out, err := s.inner.Query(ctx, &input)
+	if err != nil {
+		return []Record{}, errors.Wrapf(err, "failed to query index: %s", indexName)
+	}
+	// Tombstones work as deleted records until restored.
+	return s.unmarshalRecords(ctx, out.Items, func(rec Record) bool { return !rec.Tombstone() })
+}
 
-	recs := make([]Record, len(out.Items))
-	for i, item := range out.Items {
-		rec := Record{}
-		if err := av.UnmarshalMap(item, &rec); err != nil {
-			return []Record{}, errors.Wrapf(err, "failed to unmarshal item: %v", item)
+func (s *DDB) unmarshalRecords(ctx context.Context, items []map[string]types.AttributeValue, keep func(Record) bool) ([]Record, error) {
+	recs := make([]Record, 0, len(items))
+	for _, item := range items {
+		rec, err := s.unmarshalRecord(ctx, item)
+		if err != nil {
+			return []Record{}, err
 		}
-		recs[i] = rec
+		if !keep(rec) {
+			continue
+		}
+		recs = append(recs, rec)
 	}
 	return recs, nil
 }
 
+func (s *DDB) unmarshalRecord(ctx context.Context, item map[string]types.AttributeValue) (Record, error) {
+	rec := Record{}
+	if err := av.UnmarshalMap(item, &rec); err != nil {
+		return Record{}, errors.Wrapf(err, "failed to unmarshal item: channel_name=%v, version=%v", item["channel_name"], item["version"])
+	}
+	if s.cipher == nil {
+		return rec, nil
+	}
+	token, err := s.cipher.Decrypt(ctx, rec.Token)
+	if err != nil {
+		return Record{}, errors.Wrapf(err, "failed to decrypt token: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+	}
+	rec.storedToken = rec.Token
+	rec.Token = token
+	return rec, nil
+}
+
+// tokenCondition returns the token attribute value to match in condition expressions.
+func tokenCondition(rec Record) *types.AttributeValueMemberS {
+	if rec.storedToken != "" {
+		return &types.AttributeValueMemberS{Value: rec.storedToken}
+	}
+	return &types.AttributeValueMemberS{Value: rec.Token}
+}
+
+// UpdateLastUsedAt sets last_used_at of the record. The record must be in the table.
+func (s *DDB) UpdateLastUsedAt(ctx context.Context, rec Record, timestamp string) error {
+	return s.updateTimestamp(ctx, rec, "last_used_at", timestamp)
+}
+
+// UpdateStaleNotifiedAt sets stale_notified_at of the record. The record must be in the table.
+func (s *DDB) UpdateStaleNotifiedAt(ctx context.Context, rec Record, timestamp string) error {
+	return s.updateTimestamp(ctx, rec, "stale_notified_at", timestamp)
+}
+
+// UpdateRotatedAt sets rotated_at of the record. The record must be in the table.
+func (s *DDB) UpdateRotatedAt(ctx context.Context, rec Record, timestamp string) error {
+	return s.updateTimestamp(ctx, rec, "rotated_at", timestamp)
+}
+
+// UpdateUndeliverableAt sets undeliverable_at of the record. The record must be in the table.
+func (s *DDB) UpdateUndeliverableAt(ctx context.Context, rec Record, timestamp string) error {
+	return s.updateTimestamp(ctx, rec, "undeliverable_at", timestamp)
+}
+
+// AddDeliveryFailure increments delivery_failures of the record atomically, so concurrent requests see distinct
+// counts, and returns the incremented count. The record must be in the table.
+func (s *DDB) AddDeliveryFailure(ctx context.Context, rec Record, reason string) (int, error) {
+	input := dynamodb.UpdateItemInput{
+		TableName:           s.tableName,
+		Key:                 recordKey(rec),
+		ConditionExpression: aws.String("#t = :token"),
+		UpdateExpression:    aws.String("ADD delivery_failures :one SET delivery_failure_reason = :reason"),
+		ExpressionAttributeValues: itemMap{
+			":token":  tokenCondition(rec),
+			":one":    &types.AttributeValueMemberN{Value: "1"},
+			":reason": &types.AttributeValueMemberS{Value: reason},
+		},
+		ExpressionAttributeNames: map[string]string{"#t": "token"},
+		ReturnValues:             types.ReturnValueUpdatedNew,
+	}
+	out, err := s.inner.UpdateItem(ctx, &input)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to add delivery failure: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+	}
+	var updated Record
+	if err := av.UnmarshalMap(out.Attributes, &updated); err != nil {
+		return 0, errors.Wrapf(err, "failed to unmarshal updated attributes: %v", out.Attributes)
+	}
+	return updated.DeliveryFailures, nil
+}
+
+// ResetDeliveryFailures removes the delivery failures and undeliverable_at of the record. The record must be in
+// the table.
+func (s *DDB) ResetDeliveryFailures(ctx context.Context, rec Record) error {
+	input := dynamodb.UpdateItemInput{
+		TableName:                 s.tableName,
+		Key:                       recordKey(rec),
+		ConditionExpression:       aws.String("#t = :token"),
+		UpdateExpression:          aws.String("REMOVE delivery_failures, delivery_failure_reason, undeliverable_at"),
+		ExpressionAttributeValues: itemMap{":token": tokenCondition(rec)},
+		ExpressionAttributeNames:  map[string]string{"#t": "token"},
+	}
+	if _, err := s.inner.UpdateItem(ctx, &input); err != nil {
+		return errors.Wrapf(err, "failed to reset delivery failures: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+	}
+	return nil
+}
+
+func (s *DDB) updateTimestamp(ctx context.Context, rec Record, attribute string, timestamp string) error {
+	input := dynamodb.UpdateItemInput{
+		TableName: s.tableName,
+		Key:       recordKey(rec),
+		// Don't create an item for revoked tokens.
+		ConditionExpression: aws.String("#t = :token"),
+		UpdateExpression:    aws.String("SET #a = :timestamp"),
+		ExpressionAttributeValues: itemMap{
+			":token":     tokenCondition(rec),
+			":timestamp": &types.AttributeValueMemberS{Value: timestamp},
+		},
+		ExpressionAttributeNames: map[string]string{"#t": "token", "#a": attribute},
+	}
+	if _, err := s.inner.UpdateItem(ctx, &input); err != nil {
+		return errors.Wrapf(err, "failed to update %s: channel_name=%s, version=%d", attribute, rec.ChannelName, rec.Version)
+	}
+	return nil
+}
+
+// UpdateMappings sets the mapping rules of the record. Empty mappings remove the rules. The record must be in
+// the table.
+func (s *DDB) UpdateMappings(ctx context.Context, rec Record, mappings []string) error {
+	input := dynamodb.UpdateItemInput{
+		TableName:                 s.tableName,
+		Key:                       recordKey(rec),
+		ConditionExpression:       aws.String("#t = :token"),
+		UpdateExpression:          aws.String("REMOVE mappings"),
+		ExpressionAttributeValues: itemMap{":token": tokenCondition(rec)},
+		ExpressionAttributeNames:  map[string]string{"#t": "token"},
+	}
+	if len(mappings) > 0 {
+		input.UpdateExpression = aws.String("SET mappings = :mappings")
+		input.ExpressionAttributeValues[":mappings"] = &types.AttributeValueMemberL{Value: stringList(mappings)}
+	}
+	if _, err := s.inner.UpdateItem(ctx, &input); err != nil {
+		return errors.Wrapf(err, "failed to update mappings: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+	}
+	return nil
+}
+
+func stringList(values []string) []types.AttributeValue {
+	ret := make([]types.AttributeValue, 0, len(values))
+	for _, v := range values {
+		ret = append(ret, &types.AttributeValueMemberS{Value: v})
+	}
+	return ret
+}
+
+// Archive turns the record into a tombstone deleted by DynamoDB TTL at expiresAt (Unix time in seconds).
+func (s *DDB) Archive(ctx context.Context, rec Record, archivedAt string, expiresAt int64) error {
+	return s.tombstone(ctx, rec, "archived_at", archivedAt, expiresAt)
+}
+
+// Revoke soft-deletes the record: turns the record into a tombstone deleted by DynamoDB TTL at expiresAt.
+func (s *DDB) Revoke(ctx context.Context, rec Record, revokedAt string, expiresAt int64) error {
+	return s.tombstone(ctx, rec, "revoked_at", revokedAt, expiresAt)
+}
+
+func (s *DDB) tombstone(ctx context.Context, rec Record, attribute string, timestamp string, expiresAt int64) error {
+	input := dynamodb.UpdateItemInput{
+		TableName:           s.tableName,
+		Key:                 recordKey(rec),
+		ConditionExpression: aws.String("#t = :token"),
+		UpdateExpression:    aws.String("SET #a = :timestamp, expires_at = :expires_at"),
+		ExpressionAttributeValues: itemMap{
+			":token":      tokenCondition(rec),
+			":timestamp":  &types.AttributeValueMemberS{Value: timestamp},
+			":expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)},
+		},
+		ExpressionAttributeNames: map[string]string{"#t": "token", "#a": attribute},
+	}
+	if _, err := s.inner.UpdateItem(ctx, &input); err != nil {
+		return errors.Wrapf(err, "failed to set %s: channel_name=%s, version=%d", attribute, rec.ChannelName, rec.Version)
+	}
+	return nil
+}
+
+// Restore turns the tombstone back into a live record. Restored tokens are no longer rotated, so the token
+// rotation doesn't revoke them again.
+func (s *DDB) Restore(ctx context.Context, rec Record) error {
+	input := dynamodb.UpdateItemInput{
+		TableName: s.tableName,
+		Key:       recordKey(rec),
+		// The tombstone may have been overwritten by a new record.
+		ConditionExpression:       aws.String("#t = :token AND (attribute_exists(archived_at) OR attribute_exists(revoked_at))"),
+		UpdateExpression:          aws.String("REMOVE archived_at, revoked_at, expires_at, rotated_at"),
+		ExpressionAttributeValues: itemMap{":token": tokenCondition(rec)},
+		ExpressionAttributeNames:  map[string]string{"#t": "token"},
+	}
+	if _, err := s.inner.UpdateItem(ctx, &input); err != nil {
+		return errors.Wrapf(err, "failed to restore: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+	}
+	return nil
+}
+
+func recordKey(rec Record) itemMap {
+	return itemMap{
+		"channel_name": &types.AttributeValueMemberS{Value: rec.ChannelName},
+		"version":      &types.AttributeValueMemberN{Value: strconv.Itoa(rec.Version)},
+	}
+}
+
 // Delete removes a record. The record must be in the table.
 func (s *DDB) Delete(ctx context.Context, rec Record) error {
 	input := dynamodb.DeleteItemInput{
@@ -80,7 +446,7 @@ func (s *DDB) Delete(ctx context.Context, rec Record) error {
 			"version":      &types.AttributeValueMemberN{Value: strconv.Itoa(rec.Version)},
 		},
 		ConditionExpression:       aws.String("#t = :token"),
-		ExpressionAttributeValues: itemMap{":token": &types.AttributeValueMemberS{Value: rec.Token}},
+		ExpressionAttributeValues: itemMap{":token": tokenCondition(rec)},
 		ExpressionAttributeNames:  map[string]string{"#t": "token"},
 		ReturnValues:              types.ReturnValueAllOld,
 	}
@@ -89,41 +455,124 @@ func (s *DDB) Delete(ctx context.Context, rec Record) error {
 		return errors.Wrap(err, "failed to delete")
 	}
 	if len(out.Attributes) == 0 {
-		return errors.Newf("no item deleted: rec=%v", rec)
+		return errors.Newf("no item deleted: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
 	}
 	// Success.
 	return nil
 }
 
+// Ping checks the table is reachable with DescribeTable, which doesn't consume capacity units.
+func (s *DDB) Ping(ctx context.Context) error {
+	if _, err := s.inner.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: s.tableName}); err != nil {
+		return errors.Wrapf(err, "failed to describe table: %s", *s.tableName)
+	}
+	return nil
+}
+
+// ScanAll returns all records including tombstones.
 func (s *DDB) ScanAll(ctx context.Context) ([]Record, error) {
-	var (
-		recs              []Record
-		exclusiveStartKey itemMap
-	)
+	return s.scan(ctx, dynamodb.ScanInput{TableName: s.tableName})
+}
 
-	for {
-		input := dynamodb.ScanInput{
-			TableName:         s.tableName,
-			ExclusiveStartKey: exclusiveStartKey,
+// ScanByChannelID returns all records linked to the channel ID including tombstones. This scans whole table,
+// so use this only for infrequent operations like handling channel lifecycle events.
+func (s *DDB) ScanByChannelID(ctx context.Context, channelID string) ([]Record, error) {
+	return s.scan(ctx, dynamodb.ScanInput{
+		TableName:                 s.tableName,
+		FilterExpression:          aws.String("channel_id = :channel_id"),
+		ExpressionAttributeValues: itemMap{":channel_id": &types.AttributeValueMemberS{Value: channelID}},
+	})
+}
+
+// ForEachRecord calls fn with each record including tombstones page by page, without loading whole table into memory. segments > 1
+// scans the table with parallel scan: fn is called concurrently from each segment. Scanning stops at the first
+// error returned by fn.
+func (s *DDB) ForEachRecord(ctx context.Context, segments int, fn func(Record) error) error {
+	if segments <= 1 {
+		return s.forEach(ctx, dynamodb.ScanInput{TableName: s.tableName}, fn)
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	for i := range segments {
+		g.Go(func() error {
+			return s.forEach(ctx, dynamodb.ScanInput{
+				TableName:     s.tableName,
+				Segment:       aws.Int32(int32(i)),
+				TotalSegments: aws.Int32(int32(segments)),
+			}, fn)
+		})
+	}
+	return g.Wait()
+}
+
+// Sort key of ExclusiveStartKey of chunks: greater than any version, so chunks start at the next channel.
+const maxVersion = math.MaxInt32
+
+// ScanChunk uses the channel name of the last record as the cursor. Scans return records of a partition, i.e. a
+// channel name, in a row, so the chunk ends before the first record of another channel after limit records.
+// Records added to scanned channels after the chunk, e.g. rotated tokens, are not returned by later chunks.
+func (s *DDB) ScanChunk(ctx context.Context, cursor string, limit int) ([]Record, string, error) {
+	input := dynamodb.ScanInput{TableName: s.tableName, Limit: aws.Int32(int32(limit))}
+	if cursor != "" {
+		input.ExclusiveStartKey = itemMap{
+			"channel_name": &types.AttributeValueMemberS{Value: cursor},
+			"version":      &types.AttributeValueMemberN{Value: strconv.Itoa(maxVersion)},
 		}
+	}
+	var recs []Record
+	for {
 		out, err := s.inner.Scan(ctx, &input)
 		if err != nil {
-			return []Record{}, errors.Wrap(err, "failed to scan")
+			return nil, "", errors.Wrap(err, "failed to scan")
 		}
-
 		for _, item := range out.Items {
-			rec := Record{}
-			if err := av.UnmarshalMap(item, &rec); err != nil {
-				return []Record{}, errors.Wrapf(err, "failed to unmarshal item: %v", item)
+			rec, err := s.unmarshalRecord(ctx, item)
+			if err != nil {
+				return nil, "", err
+			}
+			if last := len(recs) - 1; len(recs) >= limit && recs[last].ChannelName != rec.ChannelName {
+				return recs, recs[last].ChannelName, nil
 			}
 			recs = append(recs, rec)
 		}
-
 		if len(out.LastEvaluatedKey) == 0 {
-			break
+			return recs, "", nil
 		}
-		exclusiveStartKey = out.LastEvaluatedKey
+		input.ExclusiveStartKey = out.LastEvaluatedKey
 	}
+}
 
+func (s *DDB) scan(ctx context.Context, input dynamodb.ScanInput) ([]Record, error) {
+	var recs []Record
+	err := s.forEach(ctx, input, func(rec Record) error {
+		recs = append(recs, rec)
+		return nil
+	})
+	if err != nil {
+		return []Record{}, err
+	}
 	return recs, nil
 }
+
+func (s *DDB) forEach(ctx context.Context, input dynamodb.ScanInput, fn func(Record) error) error {
+	for {
+		out, err := s.inner.Scan(ctx, &input)
+		if err != nil {
+			return errors.Wrap(err, "failed to scan")
+		}
+
+		for _, item := range out.Items {
+			rec, err := s.unmarshalRecord(ctx, item)
+			if err != nil {
+				return err
+			}
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+// Integration tests against DynamoDB Local. Skipped unless DDB_ENDPOINT_URL is set:
+//
+//	docker run --rm -p 8000:8000 amazon/dynamodb-local
+//	DDB_ENDPOINT_URL=http://localhost:8000 go test ./internal/storage
+const (
+	testChannelIDIndexName = "channel_id-index"
+	testTokenIndexName     = "token-index"
+)
+
+func setupDDB(t *testing.T) DDB {
+	t.Helper()
+	endpointURL := os.Getenv("DDB_ENDPOINT_URL")
+	if endpointURL == "" {
+		t.Skip("DDB_ENDPOINT_URL is not set, skipping DynamoDB Local integration test")
+	}
+
+	ctx := context.Background()
+	// DynamoDB Local accepts any credentials.
+	awsConfig := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "dummy", SecretAccessKey: "dummy"}, nil
+		}),
+	}
+	awsConfig = DynamoDBConfig(awsConfig, appconfig.Config{DdbEndpointURL: endpointURL})
+	tableName := fmt.Sprintf("belldog-test-%d", time.Now().UnixNano())
+	createTestTable(ctx, t, dynamodb.NewFromConfig(awsConfig), tableName)
+
+	ddb, err := NewDDB(ctx, awsConfig, tableName, testChannelIDIndexName, testTokenIndexName)
+	require.NoError(t, err)
+	return ddb
+}
+
+func createTestTable(ctx context.Context, t *testing.T, client *dynamodb.Client, tableName string) {
+	t.Helper()
+	gsi := func(name string, key string) types.GlobalSecondaryIndex {
+		return types.GlobalSecondaryIndex{
+			IndexName:  aws.String(name),
+			KeySchema:  []types.KeySchemaElement{{AttributeName: aws.String(key), KeyType: types.KeyTypeHash}},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}
+	}
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("channel_name"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("version"), AttributeType: types.ScalarAttributeTypeN},
+			{AttributeName: aws.String("channel_id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("token"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("channel_name"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("version"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			gsi(testChannelIDIndexName, "channel_id"),
+			gsi(testTokenIndexName, "token"),
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(tableName)})
+		assert.NoError(t, err)
+	})
+
+	waiter := dynamodb.NewTableExistsWaiter(client)
+	require.NoError(t, waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)}, time.Minute))
+}
+
+func TestDDBSaveQueryDelete(t *testing.T) {
+	ctx := context.Background()
+	ddb := setupDDB(t)
+
+	rec0 := Record{ChannelID: "C1", ChannelName: "test", Token: "token0", Version: 0, CreatedAt: "2024-01-01T00:00:00Z"}
+	rec1 := Record{ChannelID: "C1", ChannelName: "test", Token: "token1", Version: 1, CreatedAt: "2024-01-02T00:00:00Z"}
+	require.NoError(t, ddb.Save(ctx, rec1))
+	require.NoError(t, ddb.Save(ctx, rec0))
+
+	err := ddb.Save(ctx, Record{ChannelID: "C1", ChannelName: "test", Token: "conflict", Version: 1})
+	require.True(t, errors.Is(err, ErrRecordAlreadyExists), "unexpected error: %v", err)
+
+	recs, err := ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{rec0, rec1}, recs)
+
+	recs, err = ddb.QueryByChannelID(ctx, "C1")
+	require.NoError(t, err)
+	assert.Len(t, recs, 2)
+
+	recs, err = ddb.QueryByToken(ctx, "token1")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{rec1}, recs)
+
+	// Token condition.
+	require.Error(t, ddb.Delete(ctx, Record{ChannelName: "test", Token: "wrong", Version: 0}))
+	require.NoError(t, ddb.Delete(ctx, rec0))
+	recs, err = ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{rec1}, recs)
+}
+
+func TestDDBSaveCreatedAtTiebreak(t *testing.T) {
+	ctx := context.Background()
+	ddb := setupDDB(t)
+	ddb.createdAtTiebreak = true
+
+	later := Record{ChannelID: "C1", ChannelName: "test", Token: "later", Version: 0, CreatedAt: "2024-01-01T00:00:01.000000000Z"}
+	earlier := Record{ChannelID: "C1", ChannelName: "test", Token: "earlier", Version: 0, CreatedAt: "2024-01-01T00:00:00.000000000Z"}
+	require.NoError(t, ddb.Save(ctx, later))
+	require.NoError(t, ddb.Save(ctx, earlier))
+	err := ddb.Save(ctx, later)
+	require.True(t, errors.Is(err, ErrRecordAlreadyExists), "unexpected error: %v", err)
+
+	recs, err := ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{earlier}, recs)
+}
+
+func TestDDBScanPagination(t *testing.T) {
+	ctx := context.Background()
+	ddb := setupDDB(t)
+
+	const size = 7
+	for i := 0; i < size; i++ {
+		rec := Record{ChannelID: fmt.Sprintf("C%d", i%2), ChannelName: fmt.Sprintf("channel-%d", i), Token: fmt.Sprintf("token%d", i)}
+		require.NoError(t, ddb.Save(ctx, rec))
+	}
+
+	recs, err := ddb.ScanAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, recs, size)
+
+	// Force small pages to follow LastEvaluatedKey.
+	recs, err = ddb.scan(ctx, dynamodb.ScanInput{TableName: ddb.tableName, Limit: aws.Int32(2)})
+	require.NoError(t, err)
+	assert.Len(t, recs, size)
+
+	recs, err = ddb.ScanByChannelID(ctx, "C0")
+	require.NoError(t, err)
+	assert.Len(t, recs, 4)
+}
+
+func TestDDBForEachRecordSegments(t *testing.T) {
+	ctx := context.Background()
+	ddb := setupDDB(t)
+
+	const size = 9
+	for i := 0; i < size; i++ {
+		rec := Record{ChannelID: fmt.Sprintf("C%d", i), ChannelName: fmt.Sprintf("channel-%d", i), Token: fmt.Sprintf("token%d", i)}
+		require.NoError(t, ddb.Save(ctx, rec))
+	}
+
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	err := ddb.ForEachRecord(ctx, 3, func(rec Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		names = append(names, rec.ChannelName)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, names, size)
+
+	// Errors of fn stop scanning.
+	stop := errors.New("stop")
+	err = ddb.ForEachRecord(ctx, 1, func(Record) error { return stop })
+	assert.True(t, errors.Is(err, stop))
+}
+
+func TestDDBScanChunk(t *testing.T) {
+	ctx := context.Background()
+	ddb := setupDDB(t)
+
+	const size = 9
+	for i := 0; i < size; i++ {
+		for v := 0; v < 2; v++ {
+			rec := Record{ChannelID: fmt.Sprintf("C%d", i), ChannelName: fmt.Sprintf("channel-%d", i), Token: fmt.Sprintf("token%d-%d", i, v), Version: v}
+			require.NoError(t, ddb.Save(ctx, rec))
+		}
+	}
+
+	versions := map[string]int{}
+	cursor := ""
+	for chunks := 1; ; chunks++ {
+		recs, next, err := ddb.ScanChunk(ctx, cursor, 3)
+		require.NoError(t, err)
+		for _, rec := range recs {
+			versions[rec.ChannelName]++
+		}
+		// Records of a channel are never split into chunks.
+		for _, rec := range recs {
+			assert.Equal(t, 2, versions[rec.ChannelName])
+		}
+		if next == "" {
+			assert.Equal(t, 5, chunks)
+			break
+		}
+		cursor = next
+	}
+	assert.Len(t, versions, size)
+}
+
+func TestDDBArchiveRestore(t *testing.T) {
+	ctx := context.Background()
+	ddb := setupDDB(t)
+
+	rec := Record{ChannelID: "C1", ChannelName: "test", Token: "token0", Version: 0}
+	require.NoError(t, ddb.Save(ctx, rec))
+	require.NoError(t, ddb.Archive(ctx, rec, "2024-01-01T00:00:00Z", 1706745600))
+
+	// Tombstones are only visible to scans.
+	recs, err := ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+	recs, err = ddb.ScanByChannelID(ctx, "C1")
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.True(t, recs[0].Archived())
+
+	require.NoError(t, ddb.Restore(ctx, recs[0]))
+	recs, err = ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{rec}, recs)
+	// Only tombstones can be restored.
+	require.Error(t, ddb.Restore(ctx, rec))
+
+	// New records overwrite tombstones.
+	require.NoError(t, ddb.Archive(ctx, rec, "2024-01-01T00:00:00Z", 1706745600))
+	regenerated := Record{ChannelID: "C1", ChannelName: "test", Token: "token1", Version: 0}
+	require.NoError(t, ddb.Save(ctx, regenerated))
+	recs, err = ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{regenerated}, recs)
+}
+
+func TestDDBRevokeTombstones(t *testing.T) {
+	ctx := context.Background()
+	ddb := setupDDB(t)
+
+	rec := Record{ChannelID: "C1", ChannelName: "test", Token: "token0", Version: 0}
+	require.NoError(t, ddb.Save(ctx, rec))
+	require.NoError(t, ddb.Revoke(ctx, rec, "2024-01-01T00:00:00Z", 1706745600))
+
+	recs, err := ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+	recs, err = ddb.QueryTombstonesByChannelName(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.True(t, recs[0].Revoked())
+
+	require.NoError(t, ddb.Restore(ctx, recs[0]))
+	recs, err = ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{rec}, recs)
+}
+
+func TestDDBDeliveryFailures(t *testing.T) {
+	ctx := context.Background()
+	ddb := setupDDB(t)
+
+	rec := Record{ChannelID: "C1", ChannelName: "test", Token: "token0", Version: 0}
+	require.NoError(t, ddb.Save(ctx, rec))
+	for want := 1; want <= 2; want++ {
+		count, err := ddb.AddDeliveryFailure(ctx, rec, "channel_not_found")
+		require.NoError(t, err)
+		assert.Equal(t, want, count)
+	}
+	require.NoError(t, ddb.UpdateUndeliverableAt(ctx, rec, "2024-01-01T00:00:00Z"))
+	recs, err := ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, 2, recs[0].DeliveryFailures)
+	assert.Equal(t, "channel_not_found", recs[0].DeliveryFailureReason)
+	assert.Equal(t, "2024-01-01T00:00:00Z", recs[0].UndeliverableAt)
+
+	require.NoError(t, ddb.ResetDeliveryFailures(ctx, rec))
+	recs, err = ddb.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{rec}, recs)
+
+	// Don't create items for revoked tokens.
+	_, err = ddb.AddDeliveryFailure(ctx, Record{ChannelName: "test", Token: "wrong", Version: 0}, "channel_not_found")
+	require.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	av "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+)
+
+// DigestRecord is a webhook payload buffered to be posted as a part of a digest message. Digest records are
+// stored in a separate table from token records: partition key is `channel_id` and sort key is `received_at`.
+type DigestRecord struct {
+	ChannelID string `dynamodbav:"channel_id"`
+	// RFC3339 timestamp with a random suffix to keep records received at the same time.
+	ReceivedAt  string `dynamodbav:"received_at"`
+	ChannelName string `dynamodbav:"channel_name"`
+	// JSON encoded payload.
+	Payload string `dynamodbav:"payload"`
+}
+
+type DigestDDB struct {
+	inner     *dynamodb.Client
+	tableName *string
+}
+
+func NewDigestDDB(ctx context.Context, awsConfig aws.Config, tableName string) (DigestDDB, error) {
+	inner := dynamodb.NewFromConfig(awsConfig)
+	return DigestDDB{inner: inner, tableName: &tableName}, nil
+}
+
+// SaveDigestRecord puts a new record. It never overwrites existing record, returns ErrRecordAlreadyExists instead.
+func (s *DigestDDB) SaveDigestRecord(ctx context.Context, rec DigestRecord) error {
+	m, err := av.MarshalMap(rec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal digest record: %+v", rec)
+	}
+	input := dynamodb.PutItemInput{
+		Item:                m,
+		TableName:           s.tableName,
+		ConditionExpression: aws.String("attribute_not_exists(channel_id) AND attribute_not_exists(received_at)"),
+	}
+	if _, err := s.inner.PutItem(ctx, &input); err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return errors.Wrapf(ErrRecordAlreadyExists, "channel_id=%s, received_at=%s", rec.ChannelID, rec.ReceivedAt)
+		}
+		return errors.Wrap(err, "failed to put digest item")
+	}
+	return nil
+}
+
+// ScanDigestRecords returns all buffered records. The table holds only records waiting to be flushed, so
+// scanning is cheap.
+func (s *DigestDDB) ScanDigestRecords(ctx context.Context) ([]DigestRecord, error) {
+	input := dynamodb.ScanInput{TableName: s.tableName}
+	var recs []DigestRecord
+	for {
+		out, err := s.inner.Scan(ctx, &input)
+		if err != nil {
+			return []DigestRecord{}, errors.Wrap(err, "failed to scan digest items")
+		}
+		for _, item := range out.Items {
+			rec := DigestRecord{}
+			if err := av.UnmarshalMap(item, &rec); err != nil {
+				return []DigestRecord{}, errors.Wrapf(err, "failed to unmarshal digest item: %v", item)
+			}
+			recs = append(recs, rec)
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	return recs, nil
+}
+
+func (s *DigestDDB) DeleteDigestRecord(ctx context.Context, rec DigestRecord) error {
+	input := dynamodb.DeleteItemInput{
+		TableName: s.tableName,
+		Key: itemMap{
+			"channel_id":  &types.AttributeValueMemberS{Value: rec.ChannelID},
+			"received_at": &types.AttributeValueMemberS{Value: rec.ReceivedAt},
+		},
+	}
+	if _, err := s.inner.DeleteItem(ctx, &input); err != nil {
+		return errors.Wrap(err, "failed to delete digest item")
+	}
+	return nil
+}
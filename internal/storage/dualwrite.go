@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Finatext/belldog/internal/telemetry"
+)
+
+// Drifts of the same operation and key are reported at most once in this interval, so webhook requests of a
+// drifted channel don't flood the ops channel.
+const driftReportInterval = time.Hour
+
+// Drift is a difference between the primary and the secondary storage of DualWrite.
+type Drift struct {
+	// Storage method, e.g. "QueryByChannelName".
+	Operation string
+	// The queried or written key, e.g. the channel name.
+	Key    string
+	Detail string
+}
+
+// DriftListener is called on drifts, after the operation causing the drift.
+type DriftListener func(ctx context.Context, drift Drift)
+
+// DualWrite is a Storage for migrating records from the primary to the secondary storage, e.g. to another table.
+// Writes go to the primary, then to the secondary. Reads return the primary records and compare them with the
+// secondary ones. Failures and differences of the secondary are reported as drifts and never fail operations, so
+// the primary stays the source of truth until switching the backends.
+//
+// Scans read the primary only. Records of the secondary are matched by the plaintext token, so the secondary
+// must not encrypt tokens.
+type DualWrite struct {
+	primary   Storage
+	secondary Storage
+
+	mu       sync.Mutex
+	listener DriftListener
+	reported map[string]time.Time
+	now      func() time.Time
+}
+
+func NewDualWrite(primary Storage, secondary Storage) *DualWrite {
+	return &DualWrite{primary: primary, secondary: secondary, reported: map[string]time.Time{}, now: time.Now}
+}
+
+// SetDriftListener sets the listener of drifts. Drifts are logged without the listener.
+func (s *DualWrite) SetDriftListener(listener DriftListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listener = listener
+}
+
+func (s *DualWrite) Save(ctx context.Context, rec Record) error {
+	if err := s.primary.Save(ctx, rec); err != nil {
+		return err
+	}
+	s.write(ctx, "Save", rec, func(sec Record) error { return s.secondary.Save(ctx, sec) })
+	return nil
+}
+
+func (s *DualWrite) QueryByChannelName(ctx context.Context, channelName string) ([]Record, error) {
+	return s.read(ctx, "QueryByChannelName", channelName, s.primary.QueryByChannelName, s.secondary.QueryByChannelName)
+}
+
+func (s *DualWrite) QueryTombstonesByChannelName(ctx context.Context, channelName string) ([]Record, error) {
+	return s.read(ctx, "QueryTombstonesByChannelName", channelName, s.primary.QueryTombstonesByChannelName, s.secondary.QueryTombstonesByChannelName)
+}
+
+func (s *DualWrite) QueryByChannelID(ctx context.Context, channelID string) ([]Record, error) {
+	return s.read(ctx, "QueryByChannelID", channelID, s.primary.QueryByChannelID, s.secondary.QueryByChannelID)
+}
+
+// QueryByToken reports the channel names instead of the token as the key of drifts.
+func (s *DualWrite) QueryByToken(ctx context.Context, token string) ([]Record, error) {
+	recs, err := s.primary.QueryByToken(ctx, token)
+	if err != nil {
+		return recs, err
+	}
+	secRecs, secErr := s.secondary.QueryByToken(ctx, token)
+	key := "token"
+	if len(recs) > 0 {
+		key = recs[0].ChannelName
+	}
+	s.compare(ctx, "QueryByToken", key, recs, secRecs, secErr)
+	return recs, nil
+}
+
+func (s *DualWrite) Delete(ctx context.Context, rec Record) error {
+	if err := s.primary.Delete(ctx, rec); err != nil {
+		return err
+	}
+	s.write(ctx, "Delete", rec, func(sec Record) error { return s.secondary.Delete(ctx, sec) })
+	return nil
+}
+
+func (s *DualWrite) UpdateLastUsedAt(ctx context.Context, rec Record, timestamp string) error {
+	if err := s.primary.UpdateLastUsedAt(ctx, rec, timestamp); err != nil {
+		return err
+	}
+	s.write(ctx, "UpdateLastUsedAt", rec, func(sec Record) error { return s.secondary.UpdateLastUsedAt(ctx, sec, timestamp) })
+	return nil
+}
+
+func (s *DualWrite) UpdateStaleNotifiedAt(ctx context.Context, rec Record, timestamp string) error {
+	if err := s.primary.UpdateStaleNotifiedAt(ctx, rec, timestamp); err != nil {
+		return err
+	}
+	s.write(ctx, "UpdateStaleNotifiedAt", rec, func(sec Record) error { return s.secondary.UpdateStaleNotifiedAt(ctx, sec, timestamp) })
+	return nil
+}
+
+func (s *DualWrite) UpdateRotatedAt(ctx context.Context, rec Record, timestamp string) error {
+	if err := s.primary.UpdateRotatedAt(ctx, rec, timestamp); err != nil {
+		return err
+	}
+	s.write(ctx, "UpdateRotatedAt", rec, func(sec Record) error { return s.secondary.UpdateRotatedAt(ctx, sec, timestamp) })
+	return nil
+}
+
+func (s *DualWrite) UpdateUndeliverableAt(ctx context.Context, rec Record, timestamp string) error {
+	if err := s.primary.UpdateUndeliverableAt(ctx, rec, timestamp); err != nil {
+		return err
+	}
+	s.write(ctx, "UpdateUndeliverableAt", rec, func(sec Record) error { return s.secondary.UpdateUndeliverableAt(ctx, sec, timestamp) })
+	return nil
+}
+
+// AddDeliveryFailure returns the count of the primary.
+func (s *DualWrite) AddDeliveryFailure(ctx context.Context, rec Record, reason string) (int, error) {
+	count, err := s.primary.AddDeliveryFailure(ctx, rec, reason)
+	if err != nil {
+		return count, err
+	}
+	s.write(ctx, "AddDeliveryFailure", rec, func(sec Record) error {
+		_, err := s.secondary.AddDeliveryFailure(ctx, sec, reason)
+		return err
+	})
+	return count, nil
+}
+
+func (s *DualWrite) ResetDeliveryFailures(ctx context.Context, rec Record) error {
+	if err := s.primary.ResetDeliveryFailures(ctx, rec); err != nil {
+		return err
+	}
+	s.write(ctx, "ResetDeliveryFailures", rec, func(sec Record) error { return s.secondary.ResetDeliveryFailures(ctx, sec) })
+	return nil
+}
+
+func (s *DualWrite) UpdateMappings(ctx context.Context, rec Record, mappings []string) error {
+	if err := s.primary.UpdateMappings(ctx, rec, mappings); err != nil {
+		return err
+	}
+	s.write(ctx, "UpdateMappings", rec, func(sec Record) error { return s.secondary.UpdateMappings(ctx, sec, mappings) })
+	return nil
+}
+
+func (s *DualWrite) Archive(ctx context.Context, rec Record, archivedAt string, expiresAt int64) error {
+	if err := s.primary.Archive(ctx, rec, archivedAt, expiresAt); err != nil {
+		return err
+	}
+	s.write(ctx, "Archive", rec, func(sec Record) error { return s.secondary.Archive(ctx, sec, archivedAt, expiresAt) })
+	return nil
+}
+
+func (s *DualWrite) Revoke(ctx context.Context, rec Record, revokedAt string, expiresAt int64) error {
+	if err := s.primary.Revoke(ctx, rec, revokedAt, expiresAt); err != nil {
+		return err
+	}
+	s.write(ctx, "Revoke", rec, func(sec Record) error { return s.secondary.Revoke(ctx, sec, revokedAt, expiresAt) })
+	return nil
+}
+
+func (s *DualWrite) Restore(ctx context.Context, rec Record) error {
+	if err := s.primary.Restore(ctx, rec); err != nil {
+		return err
+	}
+	s.write(ctx, "Restore", rec, func(sec Record) error { return s.secondary.Restore(ctx, sec) })
+	return nil
+}
+
+func (s *DualWrite) ScanAll(ctx context.Context) ([]Record, error) {
+	return s.primary.ScanAll(ctx)
+}
+
+func (s *DualWrite) ForEachRecord(ctx context.Context, segments int, fn func(Record) error) error {
+	return s.primary.ForEachRecord(ctx, segments, fn)
+}
+
+func (s *DualWrite) ScanChunk(ctx context.Context, cursor string, limit int) ([]Record, string, error) {
+	return s.primary.ScanChunk(ctx, cursor, limit)
+}
+
+func (s *DualWrite) ScanByChannelID(ctx context.Context, channelID string) ([]Record, error) {
+	return s.primary.ScanByChannelID(ctx, channelID)
+}
+
+// Ping checks both storages: the secondary receives all writes.
+func (s *DualWrite) Ping(ctx context.Context) error {
+	if err := s.primary.Ping(ctx); err != nil {
+		return err
+	}
+	return s.secondary.Ping(ctx)
+}
+
+// write applies the operation to the secondary with the record without the token stored in the primary.
+func (s *DualWrite) write(ctx context.Context, operation string, rec Record, f func(Record) error) {
+	rec.storedToken = ""
+	if err := f(rec); err != nil {
+		s.report(ctx, Drift{Operation: operation, Key: rec.ChannelName, Detail: fmt.Sprintf("secondary write failed: version=%d, error=%s", rec.Version, err)})
+	}
+}
+
+func (s *DualWrite) read(ctx context.Context, operation string, key string, primary func(context.Context, string) ([]Record, error), secondary func(context.Context, string) ([]Record, error)) ([]Record, error) {
+	recs, err := primary(ctx, key)
+	if err != nil {
+		return recs, err
+	}
+	secRecs, secErr := secondary(ctx, key)
+	s.compare(ctx, operation, key, recs, secRecs, secErr)
+	return recs, nil
+}
+
+func (s *DualWrite) compare(ctx context.Context, operation string, key string, recs []Record, secRecs []Record, secErr error) {
+	if secErr != nil {
+		s.report(ctx, Drift{Operation: operation, Key: key, Detail: fmt.Sprintf("secondary read failed: %s", secErr)})
+		return
+	}
+	if !slices.EqualFunc(recs, secRecs, sameRecord) {
+		s.report(ctx, Drift{Operation: operation, Key: key, Detail: fmt.Sprintf("records differ: primary=%s, secondary=%s", versions(recs), versions(secRecs))})
+	}
+}
+
+// sameRecord compares records ignoring how the token is stored, and empty and nil mappings.
+func sameRecord(a Record, b Record) bool {
+	a.storedToken, b.storedToken = "", ""
+	if len(a.Mappings) == 0 {
+		a.Mappings = nil
+	}
+	if len(b.Mappings) == 0 {
+		b.Mappings = nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// versions describes records without tokens for drift reports.
+func versions(recs []Record) string {
+	vs := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		vs = append(vs, fmt.Sprintf("%s/%d", rec.ChannelName, rec.Version))
+	}
+	return fmt.Sprintf("%v", vs)
+}
+
+func (s *DualWrite) report(ctx context.Context, drift Drift) {
+	telemetry.RecordStorageDrift(ctx, drift.Operation)
+	slog.WarnContext(ctx, "storage drift detected", slog.String("operation", drift.Operation), slog.String("key", drift.Key), slog.String("detail", drift.Detail))
+
+	s.mu.Lock()
+	listener := s.listener
+	id := drift.Operation + "/" + drift.Key
+	now := s.now()
+	for k, last := range s.reported {
+		if now.Sub(last) >= driftReportInterval {
+			delete(s.reported, k)
+		}
+	}
+	if last, ok := s.reported[id]; ok && now.Sub(last) < driftReportInterval {
+		listener = nil
+	} else {
+		s.reported[id] = now
+	}
+	s.mu.Unlock()
+	if listener != nil {
+		listener(ctx, drift)
+	}
+}
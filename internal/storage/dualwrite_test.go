@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDualWrite() (*DualWrite, *Memory, *Memory, *[]Drift) {
+	primary, secondary := NewMemory(), NewMemory()
+	s := NewDualWrite(primary, secondary)
+	var drifts []Drift
+	s.SetDriftListener(func(_ context.Context, drift Drift) {
+		drifts = append(drifts, drift)
+	})
+	return s, primary, secondary, &drifts
+}
+
+func TestDualWriteWritesBoth(t *testing.T) {
+	ctx := context.Background()
+	s, primary, secondary, drifts := newTestDualWrite()
+
+	rec := Record{ChannelID: "C1", ChannelName: "test", Token: "a", Version: 0, Mappings: []string{}}
+	require.NoError(t, s.Save(ctx, rec))
+	require.NoError(t, s.UpdateLastUsedAt(ctx, rec, "2024-01-01T00:00:00Z"))
+	require.NoError(t, s.Archive(ctx, rec, "2024-01-02T00:00:00Z", 1))
+
+	for _, m := range []*Memory{primary, secondary} {
+		recs, err := m.QueryTombstonesByChannelName(ctx, "test")
+		require.NoError(t, err)
+		require.Len(t, recs, 1)
+		assert.Equal(t, "2024-01-01T00:00:00Z", recs[0].LastUsedAt)
+		assert.Equal(t, "2024-01-02T00:00:00Z", recs[0].ArchivedAt)
+	}
+	recs, err := s.QueryTombstonesByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Len(t, recs, 1)
+	assert.Empty(t, *drifts)
+}
+
+func TestDualWriteReportsDrifts(t *testing.T) {
+	ctx := context.Background()
+	s, primary, secondary, drifts := newTestDualWrite()
+
+	// Records saved before enabling dual-write mode.
+	rec := Record{ChannelID: "C1", ChannelName: "test", Token: "a", Version: 0}
+	require.NoError(t, primary.Save(ctx, rec))
+
+	recs, err := s.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{rec}, recs)
+	// The secondary failure doesn't fail the operation.
+	require.NoError(t, s.UpdateLastUsedAt(ctx, rec, "2024-01-01T00:00:00Z"))
+	require.Len(t, *drifts, 2)
+	assert.Equal(t, Drift{Operation: "QueryByChannelName", Key: "test", Detail: "records differ: primary=[test/0], secondary=[]"}, (*drifts)[0])
+	assert.Equal(t, "UpdateLastUsedAt", (*drifts)[1].Operation)
+	assert.Contains(t, (*drifts)[1].Detail, "secondary write failed")
+
+	// Reported once in the interval.
+	_, err = s.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Len(t, *drifts, 2)
+	s.now = func() time.Time { return time.Now().Add(driftReportInterval) }
+	_, err = s.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Len(t, *drifts, 3)
+
+	// Backfilled.
+	require.NoError(t, secondary.Save(ctx, Record{ChannelID: "C1", ChannelName: "test", Token: "a", Version: 0, LastUsedAt: "2024-01-01T00:00:00Z"}))
+	_, err = s.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	_, err = s.QueryByChannelID(ctx, "C1")
+	require.NoError(t, err)
+	assert.Len(t, *drifts, 3)
+}
+
+func TestDualWritePrimaryFailure(t *testing.T) {
+	ctx := context.Background()
+	s, _, secondary, drifts := newTestDualWrite()
+
+	require.Error(t, s.Delete(ctx, Record{ChannelName: "test", Token: "a", Version: 0}))
+	require.NoError(t, secondary.Save(ctx, Record{ChannelName: "test", Token: "a", Version: 0}))
+	require.Error(t, s.Delete(ctx, Record{ChannelName: "test", Token: "a", Version: 0}))
+	// Writes to the secondary are skipped.
+	recs, err := secondary.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Len(t, recs, 1)
+	assert.Empty(t, *drifts)
+}
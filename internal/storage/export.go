@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ImportResult is the number of records imported. Records already existing are skipped.
+type ImportResult struct {
+	Saved   int
+	Skipped int
+}
+
+// Export writes all records including tombstones to w as JSON lines, e.g. to move records to another table or
+// region. Returns the number of records written. Records are streamed without loading whole table into memory.
+func Export(ctx context.Context, s Storage, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	count := 0
+	// Single segment, so fn isn't called concurrently. Lock anyway to not depend on it.
+	var mu sync.Mutex
+	err := s.ForEachRecord(ctx, 1, func(rec Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(rec); err != nil {
+			return errors.Wrapf(err, "failed to write record: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// Import saves records read from r written by Export. Existing records are kept as is, so importing the same
+// export again is safe. Stops at the first invalid line or storage error.
+func Import(ctx context.Context, s Storage, r io.Reader) (ImportResult, error) {
+	var result ImportResult
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return result, errors.Wrapf(err, "failed to decode record at line %d", line)
+		}
+		if rec.ChannelName == "" || rec.Token == "" {
+			return result, errors.Newf("record at line %d has no channel_name or token", line)
+		}
+		if err := s.Save(ctx, rec); err != nil {
+			if errors.Is(err, ErrRecordAlreadyExists) {
+				slog.WarnContext(ctx, "record already exists, skipping", slog.String("channel_name", rec.ChannelName), slog.Int("version", rec.Version))
+				result.Skipped++
+				continue
+			}
+			return result, err
+		}
+		result.Saved++
+	}
+	if err := scanner.Err(); err != nil {
+		return result, errors.Wrap(err, "failed to read records")
+	}
+	return result, nil
+}
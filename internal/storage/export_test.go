@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := NewMemory()
+	require.NoError(t, src.Save(ctx, Record{ChannelID: "C1", ChannelName: "test", Token: "a", Version: 0, Scope: "post"}))
+	require.NoError(t, src.Save(ctx, Record{ChannelID: "C1", ChannelName: "test", Token: "b", Version: 1}))
+	require.NoError(t, src.Revoke(ctx, Record{ChannelName: "test", Token: "b", Version: 1}, "2024-01-01T00:00:00Z", 1704067200))
+
+	var buf bytes.Buffer
+	count, err := Export(ctx, src, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+
+	dst := NewMemory()
+	require.NoError(t, dst.Save(ctx, Record{ChannelID: "C1", ChannelName: "test", Token: "a", Version: 0}))
+	result, err := Import(ctx, dst, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Saved: 1, Skipped: 1}, result)
+
+	recs, err := dst.ScanAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+	tombstones, err := dst.QueryTombstonesByChannelName(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, tombstones, 1)
+	assert.Equal(t, "2024-01-01T00:00:00Z", tombstones[0].RevokedAt)
+	assert.Equal(t, int64(1704067200), tombstones[0].ExpiresAt)
+}
+
+func TestImportInvalid(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	_, err := Import(ctx, m, strings.NewReader("{\"channel_name\":\"test\",\"token\":\"a\"}\n\nnot json\n"))
+	require.ErrorContains(t, err, "line 3")
+
+	_, err = Import(ctx, m, strings.NewReader("{\"channel_id\":\"C1\"}\n"))
+	require.ErrorContains(t, err, "no channel_name or token")
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	av "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+)
+
+// IdempotencyRecord remembers the result of a webhook request having an idempotency key. Idempotency records
+// are stored in a separate table from token records: partition key is `key`. Enable DynamoDB TTL on
+// `expires_at` (Unix time in seconds) to delete expired records.
+type IdempotencyRecord struct {
+	Key string `dynamodbav:"key"`
+	// False while the request is being processed.
+	Completed          bool   `dynamodbav:"completed"`
+	TS                 string `dynamodbav:"ts,omitempty"`
+	ScheduledMessageID string `dynamodbav:"scheduled_message_id,omitempty"`
+	// Number of identical payloads of content-hash deduplication records.
+	Count int `dynamodbav:"count,omitempty"`
+	// JSON state of checkpointed batch runs.
+	Checkpoint string `dynamodbav:"checkpoint,omitempty"`
+	ExpiresAt  int64  `dynamodbav:"expires_at"`
+}
+
+type IdempotencyDDB struct {
+	inner     *dynamodb.Client
+	tableName *string
+}
+
+func NewIdempotencyDDB(ctx context.Context, awsConfig aws.Config, tableName string) (IdempotencyDDB, error) {
+	inner := dynamodb.NewFromConfig(awsConfig)
+	return IdempotencyDDB{inner: inner, tableName: &tableName}, nil
+}
+
+// ReserveIdempotencyRecord puts the record unless a record having the same key exists and doesn't expire
+// at `now`, returns ErrRecordAlreadyExists instead. DynamoDB TTL deletes expired items lazily, so expired
+// records are overwritten.
+func (s *IdempotencyDDB) ReserveIdempotencyRecord(ctx context.Context, rec IdempotencyRecord, now int64) error {
+	m, err := av.MarshalMap(rec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal idempotency record: %+v", rec)
+	}
+	input := dynamodb.PutItemInput{
+		Item:                m,
+		TableName:           s.tableName,
+		ConditionExpression: aws.String("attribute_not_exists(#key) OR expires_at <= :now"),
+		// `key` is a DynamoDB reserved word.
+		ExpressionAttributeNames:  map[string]string{"#key": "key"},
+		ExpressionAttributeValues: itemMap{":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now, 10)}},
+	}
+	if _, err := s.inner.PutItem(ctx, &input); err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return errors.Wrapf(ErrRecordAlreadyExists, "key=%s", rec.Key)
+		}
+		return errors.Wrap(err, "failed to put idempotency item")
+	}
+	return nil
+}
+
+// GetIdempotencyRecord returns found=false when no record has the key. Returned records may be expired.
+func (s *IdempotencyDDB) GetIdempotencyRecord(ctx context.Context, key string) (IdempotencyRecord, bool, error) {
+	input := dynamodb.GetItemInput{
+		TableName:      s.tableName,
+		Key:            itemMap{"key": &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	}
+	out, err := s.inner.GetItem(ctx, &input)
+	if err != nil {
+		return IdempotencyRecord{}, false, errors.Wrap(err, "failed to get idempotency item")
+	}
+	if out.Item == nil {
+		return IdempotencyRecord{}, false, nil
+	}
+	rec := IdempotencyRecord{}
+	if err := av.UnmarshalMap(out.Item, &rec); err != nil {
+		return IdempotencyRecord{}, false, errors.Wrapf(err, "failed to unmarshal idempotency item: %v", out.Item)
+	}
+	return rec, true, nil
+}
+
+// SaveIdempotencyRecord overwrites the record having the same key.
+func (s *IdempotencyDDB) SaveIdempotencyRecord(ctx context.Context, rec IdempotencyRecord) error {
+	m, err := av.MarshalMap(rec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal idempotency record: %+v", rec)
+	}
+	input := dynamodb.PutItemInput{
+		Item:      m,
+		TableName: s.tableName,
+	}
+	if _, err := s.inner.PutItem(ctx, &input); err != nil {
+		return errors.Wrap(err, "failed to put idempotency item")
+	}
+	return nil
+}
+
+func (s *IdempotencyDDB) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	input := dynamodb.DeleteItemInput{
+		TableName: s.tableName,
+		Key:       itemMap{"key": &types.AttributeValueMemberS{Value: key}},
+	}
+	if _, err := s.inner.DeleteItem(ctx, &input); err != nil {
+		return errors.Wrap(err, "failed to delete idempotency item")
+	}
+	return nil
+}
+
+// IncrementIdempotencyCount increments the count of the record unless it expires at `now`, and returns the
+// updated record. Returns found=false when no unexpired record has the key.
+func (s *IdempotencyDDB) IncrementIdempotencyCount(ctx context.Context, key string, now int64) (IdempotencyRecord, bool, error) {
+	input := dynamodb.UpdateItemInput{
+		TableName:           s.tableName,
+		Key:                 itemMap{"key": &types.AttributeValueMemberS{Value: key}},
+		UpdateExpression:    aws.String("ADD #count :one"),
+		ConditionExpression: aws.String("attribute_exists(#key) AND expires_at > :now"),
+		// `key` and `count` are DynamoDB reserved words.
+		ExpressionAttributeNames: map[string]string{"#key": "key", "#count": "count"},
+		ExpressionAttributeValues: itemMap{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now, 10)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	}
+	out, err := s.inner.UpdateItem(ctx, &input)
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return IdempotencyRecord{}, false, nil
+		}
+		return IdempotencyRecord{}, false, errors.Wrap(err, "failed to increment idempotency item count")
+	}
+	rec := IdempotencyRecord{}
+	if err := av.UnmarshalMap(out.Attributes, &rec); err != nil {
+		return IdempotencyRecord{}, false, errors.Wrapf(err, "failed to unmarshal idempotency item: %v", out.Attributes)
+	}
+	return rec, true, nil
+}
+
+// CompleteIdempotencyRecord marks the record completed with `ts`, keeping the count and the expiry. Records
+// deleted in the meantime are not recreated.
+func (s *IdempotencyDDB) CompleteIdempotencyRecord(ctx context.Context, key string, ts string) error {
+	input := dynamodb.UpdateItemInput{
+		TableName:                s.tableName,
+		Key:                      itemMap{"key": &types.AttributeValueMemberS{Value: key}},
+		UpdateExpression:         aws.String("SET completed = :completed, ts = :ts"),
+		ConditionExpression:      aws.String("attribute_exists(#key)"),
+		ExpressionAttributeNames: map[string]string{"#key": "key"},
+		ExpressionAttributeValues: itemMap{
+			":completed": &types.AttributeValueMemberBOOL{Value: true},
+			":ts":        &types.AttributeValueMemberS{Value: ts},
+		},
+	}
+	if _, err := s.inner.UpdateItem(ctx, &input); err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to complete idempotency item")
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	av "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+)
+
+// ChannelInventoryRecord is a Slack channel cached by the channel inventory. Inventory records are stored in a
+// separate table from token records: partition key is `channel_id`.
+type ChannelInventoryRecord struct {
+	ChannelID  string `dynamodbav:"channel_id"`
+	Name       string `dynamodbav:"name"`
+	IsArchived bool   `dynamodbav:"is_archived"`
+	IsPrivate  bool   `dynamodbav:"is_private"`
+	// RFC3339 timestamp of the full sync or the event which updated the record.
+	UpdatedAt string `dynamodbav:"updated_at"`
+}
+
+// The item keeping the time of the last full sync, which is not a channel.
+const inventorySyncKey = "#sync"
+
+// BatchWriteItem accepts up to 25 items per request.
+const maxBatchWriteItems = 25
+
+const unprocessedItemsBackoff = 100 * time.Millisecond
+
+type InventoryDDB struct {
+	inner     *dynamodb.Client
+	tableName *string
+}
+
+func NewInventoryDDB(ctx context.Context, awsConfig aws.Config, tableName string) (InventoryDDB, error) {
+	inner := dynamodb.NewFromConfig(awsConfig)
+	return InventoryDDB{inner: inner, tableName: &tableName}, nil
+}
+
+// ScanChannels returns all cached channels.
+func (s *InventoryDDB) ScanChannels(ctx context.Context) ([]ChannelInventoryRecord, error) {
+	input := dynamodb.ScanInput{TableName: s.tableName}
+	var recs []ChannelInventoryRecord
+	for {
+		out, err := s.inner.Scan(ctx, &input)
+		if err != nil {
+			return []ChannelInventoryRecord{}, errors.Wrap(err, "failed to scan inventory items")
+		}
+		for _, item := range out.Items {
+			rec := ChannelInventoryRecord{}
+			if err := av.UnmarshalMap(item, &rec); err != nil {
+				return []ChannelInventoryRecord{}, errors.Wrapf(err, "failed to unmarshal inventory item: %v", item)
+			}
+			if rec.ChannelID == inventorySyncKey {
+				continue
+			}
+			recs = append(recs, rec)
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	return recs, nil
+}
+
+// PutChannels overwrites the channels with BatchWriteItem.
+func (s *InventoryDDB) PutChannels(ctx context.Context, recs []ChannelInventoryRecord) error {
+	requests := make([]types.WriteRequest, 0, len(recs))
+	for _, rec := range recs {
+		m, err := av.MarshalMap(rec)
+		if err != nil {
+			return errors.Wrapf(err, "failed to marshal inventory record: %+v", rec)
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: m}})
+	}
+	return s.batchWrite(ctx, requests)
+}
+
+func (s *InventoryDDB) DeleteChannels(ctx context.Context, channelIDs []string) error {
+	requests := make([]types.WriteRequest, 0, len(channelIDs))
+	for _, id := range channelIDs {
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{
+			Key: itemMap{"channel_id": &types.AttributeValueMemberS{Value: id}},
+		}})
+	}
+	return s.batchWrite(ctx, requests)
+}
+
+// UpdateChannelName updates only the name, so other attributes of the channel are kept. Unknown channels are
+// created with the name.
+func (s *InventoryDDB) UpdateChannelName(ctx context.Context, channelID string, name string, updatedAt string) error {
+	return s.update(ctx, channelID, "SET #name = :name, updated_at = :updated_at", map[string]string{"#name": "name"}, itemMap{
+		":name":       &types.AttributeValueMemberS{Value: name},
+		":updated_at": &types.AttributeValueMemberS{Value: updatedAt},
+	})
+}
+
+// UpdateChannelArchived updates only the archived state like UpdateChannelName.
+func (s *InventoryDDB) UpdateChannelArchived(ctx context.Context, channelID string, archived bool, updatedAt string) error {
+	return s.update(ctx, channelID, "SET is_archived = :is_archived, updated_at = :updated_at", nil, itemMap{
+		":is_archived": &types.AttributeValueMemberBOOL{Value: archived},
+		":updated_at":  &types.AttributeValueMemberS{Value: updatedAt},
+	})
+}
+
+// GetInventorySyncedAt returns found=false before the first full sync.
+func (s *InventoryDDB) GetInventorySyncedAt(ctx context.Context) (time.Time, bool, error) {
+	input := dynamodb.GetItemInput{
+		TableName: s.tableName,
+		Key:       itemMap{"channel_id": &types.AttributeValueMemberS{Value: inventorySyncKey}},
+	}
+	out, err := s.inner.GetItem(ctx, &input)
+	if err != nil {
+		return time.Time{}, false, errors.Wrap(err, "failed to get inventory sync item")
+	}
+	if out.Item == nil {
+		return time.Time{}, false, nil
+	}
+	rec := ChannelInventoryRecord{}
+	if err := av.UnmarshalMap(out.Item, &rec); err != nil {
+		return time.Time{}, false, errors.Wrapf(err, "failed to unmarshal inventory sync item: %v", out.Item)
+	}
+	syncedAt, err := time.Parse(time.RFC3339Nano, rec.UpdatedAt)
+	if err != nil {
+		return time.Time{}, false, errors.Wrapf(err, "failed to parse inventory sync time: %s", rec.UpdatedAt)
+	}
+	return syncedAt, true, nil
+}
+
+func (s *InventoryDDB) SaveInventorySyncedAt(ctx context.Context, syncedAt time.Time) error {
+	m, err := av.MarshalMap(ChannelInventoryRecord{ChannelID: inventorySyncKey, UpdatedAt: syncedAt.UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal inventory sync item")
+	}
+	if _, err := s.inner.PutItem(ctx, &dynamodb.PutItemInput{TableName: s.tableName, Item: m}); err != nil {
+		return errors.Wrap(err, "failed to put inventory sync item")
+	}
+	return nil
+}
+
+func (s *InventoryDDB) update(ctx context.Context, channelID string, expr string, names map[string]string, values itemMap) error {
+	input := dynamodb.UpdateItemInput{
+		TableName:                 s.tableName,
+		Key:                       itemMap{"channel_id": &types.AttributeValueMemberS{Value: channelID}},
+		UpdateExpression:          aws.String(expr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+	if _, err := s.inner.UpdateItem(ctx, &input); err != nil {
+		return errors.Wrapf(err, "failed to update inventory item: channel_id=%s", channelID)
+	}
+	return nil
+}
+
+// batchWrite retries unprocessed items, which DynamoDB returns when throttled.
+func (s *InventoryDDB) batchWrite(ctx context.Context, requests []types.WriteRequest) error {
+	for len(requests) > 0 {
+		n := min(len(requests), maxBatchWriteItems)
+		pending := requests[:n]
+		requests = requests[n:]
+		for len(pending) > 0 {
+			out, err := s.inner.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{*s.tableName: pending},
+			})
+			if err != nil {
+				return errors.Wrap(err, "failed to batch write inventory items")
+			}
+			pending = out.UnprocessedItems[*s.tableName]
+			if len(pending) > 0 {
+				select {
+				case <-ctx.Done():
+					return errors.Wrap(ctx.Err(), "failed to batch write inventory items")
+				case <-time.After(unprocessedItemsBackoff):
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Memory is an in-memory implementation of Storage for local development. Records are lost on exit.
+// This emulates conditional writes of DDB.
+type Memory struct {
+	mu   sync.Mutex
+	recs []Record
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Save(ctx context.Context, rec Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.recs {
+		if r.ChannelName == rec.ChannelName && r.Version == rec.Version {
+			if r.Tombstone() {
+				m.recs[i] = rec
+				return nil
+			}
+			return errors.Wrapf(ErrRecordAlreadyExists, "channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+		}
+	}
+	m.recs = append(m.recs, rec)
+	return nil
+}
+
+// QueryByChannelName returns found Records sorted by .Version like DDB.
+func (m *Memory) QueryByChannelName(ctx context.Context, channelName string) ([]Record, error) {
+	recs := m.filter(func(r Record) bool { return r.ChannelName == channelName && !r.Tombstone() })
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Version < recs[j].Version })
+	return recs, nil
+}
+
+func (m *Memory) QueryTombstonesByChannelName(ctx context.Context, channelName string) ([]Record, error) {
+	recs := m.filter(func(r Record) bool { return r.ChannelName == channelName && r.Tombstone() })
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Version < recs[j].Version })
+	return recs, nil
+}
+
+func (m *Memory) QueryByChannelID(ctx context.Context, channelID string) ([]Record, error) {
+	return m.filter(func(r Record) bool { return r.ChannelID == channelID && !r.Tombstone() }), nil
+}
+
+func (m *Memory) QueryByToken(ctx context.Context, token string) ([]Record, error) {
+	return m.filter(func(r Record) bool { return r.Token == token && !r.Tombstone() }), nil
+}
+
+func (m *Memory) UpdateLastUsedAt(ctx context.Context, rec Record, timestamp string) error {
+	return m.update(rec, func(r *Record) { r.LastUsedAt = timestamp })
+}
+
+func (m *Memory) UpdateStaleNotifiedAt(ctx context.Context, rec Record, timestamp string) error {
+	return m.update(rec, func(r *Record) { r.StaleNotifiedAt = timestamp })
+}
+
+func (m *Memory) UpdateRotatedAt(ctx context.Context, rec Record, timestamp string) error {
+	return m.update(rec, func(r *Record) { r.RotatedAt = timestamp })
+}
+
+func (m *Memory) UpdateUndeliverableAt(ctx context.Context, rec Record, timestamp string) error {
+	return m.update(rec, func(r *Record) { r.UndeliverableAt = timestamp })
+}
+
+func (m *Memory) AddDeliveryFailure(ctx context.Context, rec Record, reason string) (int, error) {
+	var count int
+	err := m.update(rec, func(r *Record) {
+		r.DeliveryFailures++
+		r.DeliveryFailureReason = reason
+		count = r.DeliveryFailures
+	})
+	return count, err
+}
+
+func (m *Memory) ResetDeliveryFailures(ctx context.Context, rec Record) error {
+	return m.update(rec, func(r *Record) {
+		r.DeliveryFailures = 0
+		r.DeliveryFailureReason = ""
+		r.UndeliverableAt = ""
+	})
+}
+
+func (m *Memory) UpdateMappings(ctx context.Context, rec Record, mappings []string) error {
+	return m.update(rec, func(r *Record) { r.Mappings = mappings })
+}
+
+func (m *Memory) Archive(ctx context.Context, rec Record, archivedAt string, expiresAt int64) error {
+	return m.update(rec, func(r *Record) {
+		r.ArchivedAt = archivedAt
+		r.ExpiresAt = expiresAt
+	})
+}
+
+func (m *Memory) Revoke(ctx context.Context, rec Record, revokedAt string, expiresAt int64) error {
+	return m.update(rec, func(r *Record) {
+		r.RevokedAt = revokedAt
+		r.ExpiresAt = expiresAt
+	})
+}
+
+// Restore doesn't check the record is a tombstone unlike DDB.
+func (m *Memory) Restore(ctx context.Context, rec Record) error {
+	return m.update(rec, func(r *Record) {
+		r.ArchivedAt = ""
+		r.RevokedAt = ""
+		r.ExpiresAt = 0
+		r.RotatedAt = ""
+	})
+}
+
+func (m *Memory) update(rec Record, f func(*Record)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.recs {
+		if r.ChannelName == rec.ChannelName && r.Version == rec.Version && r.Token == rec.Token {
+			f(&m.recs[i])
+			return nil
+		}
+	}
+	return errors.Newf("no item updated: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+}
+
+func (m *Memory) Delete(ctx context.Context, rec Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.recs {
+		if r.ChannelName == rec.ChannelName && r.Version == rec.Version && r.Token == rec.Token {
+			m.recs = append(m.recs[:i], m.recs[i+1:]...)
+			return nil
+		}
+	}
+	return errors.Newf("no item deleted: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) ScanAll(ctx context.Context) ([]Record, error) {
+	return m.filter(func(Record) bool { return true }), nil
+}
+
+// ForEachRecord calls fn with a snapshot of records, so fn can modify the storage. segments is ignored.
+func (m *Memory) ForEachRecord(ctx context.Context, segments int, fn func(Record) error) error {
+	for _, rec := range m.filter(func(Record) bool { return true }) {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanChunk returns channels in the order of their names, and uses the last channel name as the cursor like DDB.
+func (m *Memory) ScanChunk(ctx context.Context, cursor string, limit int) ([]Record, string, error) {
+	recs := m.filter(func(r Record) bool { return cursor == "" || r.ChannelName > cursor })
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].ChannelName != recs[j].ChannelName {
+			return recs[i].ChannelName < recs[j].ChannelName
+		}
+		return recs[i].Version < recs[j].Version
+	})
+	for i := max(limit, 1); i < len(recs); i++ {
+		if recs[i].ChannelName != recs[i-1].ChannelName {
+			return recs[:i], recs[i-1].ChannelName, nil
+		}
+	}
+	return recs, "", nil
+}
+
+func (m *Memory) ScanByChannelID(ctx context.Context, channelID string) ([]Record, error) {
+	return m.filter(func(r Record) bool { return r.ChannelID == channelID }), nil
+}
+
+func (m *Memory) filter(pred func(Record) bool) []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := []Record{}
+	for _, r := range m.recs {
+		if pred(r) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	require.NoError(t, m.Save(ctx, Record{ChannelID: "C1", ChannelName: "test", Token: "b", Version: 1}))
+	require.NoError(t, m.Save(ctx, Record{ChannelID: "C1", ChannelName: "test", Token: "a", Version: 0}))
+	err := m.Save(ctx, Record{ChannelID: "C1", ChannelName: "test", Token: "c", Version: 1})
+	require.True(t, errors.Is(err, ErrRecordAlreadyExists))
+
+	recs, err := m.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+	assert.Equal(t, 0, recs[0].Version)
+
+	recs, err = m.QueryByToken(ctx, "b")
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, 1, recs[0].Version)
+
+	// Token condition like DDB.
+	require.Error(t, m.Delete(ctx, Record{ChannelName: "test", Token: "wrong", Version: 1}))
+	require.NoError(t, m.Delete(ctx, Record{ChannelName: "test", Token: "b", Version: 1}))
+	recs, err = m.ScanByChannelID(ctx, "C1")
+	require.NoError(t, err)
+	assert.Len(t, recs, 1)
+}
+
+func TestMemoryForEachRecord(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	require.NoError(t, m.Save(ctx, Record{ChannelID: "C1", ChannelName: "test", Token: "a", Version: 0}))
+	require.NoError(t, m.Save(ctx, Record{ChannelID: "C2", ChannelName: "other", Token: "b", Version: 0}))
+
+	// fn can delete records while iterating.
+	var tokens []string
+	err := m.ForEachRecord(ctx, 1, func(rec Record) error {
+		tokens = append(tokens, rec.Token)
+		return m.Delete(ctx, rec)
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, tokens)
+
+	recs, err := m.ScanAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+}
+
+func TestMemoryArchiveRestore(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	rec := Record{ChannelID: "C1", ChannelName: "test", Token: "a", Version: 0}
+	require.NoError(t, m.Save(ctx, rec))
+	require.NoError(t, m.Archive(ctx, rec, "2024-01-01T00:00:00Z", 1706745600))
+
+	recs, err := m.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+	recs, err = m.ScanByChannelID(ctx, "C1")
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.True(t, recs[0].Archived())
+
+	require.NoError(t, m.Restore(ctx, recs[0]))
+	recs, err = m.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{rec}, recs)
+}
+
+func TestMemoryDeliveryFailures(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	rec := Record{ChannelID: "C1", ChannelName: "test", Token: "a", Version: 0}
+	require.NoError(t, m.Save(ctx, rec))
+
+	for want := 1; want <= 2; want++ {
+		count, err := m.AddDeliveryFailure(ctx, rec, "is_archived")
+		require.NoError(t, err)
+		assert.Equal(t, want, count)
+	}
+	require.NoError(t, m.UpdateUndeliverableAt(ctx, rec, "2024-01-01T00:00:00Z"))
+	recs, err := m.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, 2, recs[0].DeliveryFailures)
+	assert.Equal(t, "is_archived", recs[0].DeliveryFailureReason)
+	assert.Equal(t, "2024-01-01T00:00:00Z", recs[0].UndeliverableAt)
+
+	require.NoError(t, m.ResetDeliveryFailures(ctx, rec))
+	recs, err = m.QueryByChannelName(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []Record{rec}, recs)
+
+	_, err = m.AddDeliveryFailure(ctx, Record{ChannelName: "test", Token: "wrong", Version: 0}, "is_archived")
+	require.Error(t, err)
+}
+
+func TestMemoryScanChunk(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	require.NoError(t, m.Save(ctx, Record{ChannelID: "C1", ChannelName: "a", Token: "a0", Version: 0}))
+	require.NoError(t, m.Save(ctx, Record{ChannelID: "C1", ChannelName: "a", Token: "a1", Version: 1}))
+	require.NoError(t, m.Save(ctx, Record{ChannelID: "C2", ChannelName: "b", Token: "b0", Version: 0}))
+	require.NoError(t, m.Save(ctx, Record{ChannelID: "C3", ChannelName: "c", Token: "c0", Version: 0}))
+
+	// Records of a channel are never split into chunks.
+	recs, cursor, err := m.ScanChunk(ctx, "", 1)
+	require.NoError(t, err)
+	assert.Len(t, recs, 2)
+	assert.Equal(t, "a", cursor)
+
+	recs, cursor, err = m.ScanChunk(ctx, cursor, 2)
+	require.NoError(t, err)
+	assert.Len(t, recs, 2)
+	assert.Equal(t, "", cursor)
+}
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/secret"
+)
+
+// Waits for the table and indexes created by Migrate at most this long.
+const migrateWaitTimeout = 10 * time.Minute
+
+var migratePollInterval = 5 * time.Second
+
+// MigrateOptions configures Migrate. The durations give expires_at of tombstones saved without it, see
+// ARCHIVED_RECORD_TTL and REVOKE_GRACE_PERIOD.
+type MigrateOptions struct {
+	ArchivedRecordTTL time.Duration
+	RevokeGracePeriod time.Duration
+	// Report what would be changed without changing the table nor records.
+	DryRun bool
+}
+
+// MigrateResult is what Migrate changed, or would change with DryRun.
+type MigrateResult struct {
+	TableCreated   bool
+	IndexesCreated []string
+	TTLEnabled     bool
+	Records        int
+	// Number of records migrated by migration name, e.g. `scope`.
+	Migrated map[string]int
+}
+
+// recordMigration backfills attributes of records saved by older versions of Belldog.
+type recordMigration struct {
+	name string
+	// attributes returns the attributes to set, or nil when the record is up to date.
+	attributes func(ctx context.Context, rec Record, opts MigrateOptions) itemMap
+}
+
+var recordMigrations = []recordMigration{
+	{
+		// Records saved before token scopes were introduced work as service.ScopeManage.
+		name: "scope",
+		attributes: func(_ context.Context, rec Record, _ MigrateOptions) itemMap {
+			if rec.Scope != "" {
+				return nil
+			}
+			return itemMap{"scope": &types.AttributeValueMemberS{Value: "manage"}}
+		},
+	},
+	{
+		name: "token_prefix",
+		attributes: func(_ context.Context, rec Record, _ MigrateOptions) itemMap {
+			if rec.TokenPrefix != "" {
+				return nil
+			}
+			return itemMap{"token_prefix": &types.AttributeValueMemberS{Value: secret.Token(rec.Token).Prefix()}}
+		},
+	},
+	{
+		// Tombstones saved before DynamoDB TTL was used are never deleted by TTL.
+		name: "expires_at",
+		attributes: func(ctx context.Context, rec Record, opts MigrateOptions) itemMap {
+			if !rec.Tombstone() || rec.ExpiresAt > 0 {
+				return nil
+			}
+			since, ttl := rec.ArchivedAt, opts.ArchivedRecordTTL
+			if rec.Revoked() {
+				since, ttl = rec.RevokedAt, opts.RevokeGracePeriod
+			}
+			t, err := time.Parse(time.RFC3339Nano, since)
+			if err != nil {
+				slog.WarnContext(ctx, "invalid timestamp of tombstone, skip expires_at migration", slog.String("channel_name", rec.ChannelName), slog.Int("version", rec.Version))
+				return nil
+			}
+			return itemMap{"expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Add(ttl).Unix(), 10)}}
+		},
+	},
+}
+
+// Migrate creates the table, the configured GSIs and the TTL setting if absent, then backfills attributes of
+// records saved by older versions. Migrating migrated tables changes nothing, so running it on every deploy is
+// safe.
+func Migrate(ctx context.Context, s *DDB, opts MigrateOptions) (MigrateResult, error) {
+	result := MigrateResult{Migrated: map[string]int{}}
+	created, err := s.ensureTable(ctx, opts.DryRun)
+	if err != nil {
+		return result, err
+	}
+	result.TableCreated = created
+	if created {
+		result.IndexesCreated = s.indexNames()
+		result.TTLEnabled = true
+		// The new table has no records. With DryRun, there is no table to continue with.
+		if !opts.DryRun {
+			_, err = s.ensureTTL(ctx, false)
+		}
+		return result, err
+	}
+	if result.IndexesCreated, err = s.ensureIndexes(ctx, opts.DryRun); err != nil {
+		return result, err
+	}
+	if result.TTLEnabled, err = s.ensureTTL(ctx, opts.DryRun); err != nil {
+		return result, err
+	}
+
+	err = s.ForEachRecord(ctx, 1, func(rec Record) error {
+		result.Records++
+		attrs, names := migrateRecord(ctx, rec, opts)
+		for _, name := range names {
+			result.Migrated[name]++
+		}
+		if len(attrs) == 0 || opts.DryRun {
+			return nil
+		}
+		return s.setAttributes(ctx, rec, attrs)
+	})
+	return result, err
+}
+
+// migrateRecord returns the attributes to set to the record and the names of the applied migrations.
+func migrateRecord(ctx context.Context, rec Record, opts MigrateOptions) (itemMap, []string) {
+	attrs := itemMap{}
+	var names []string
+	for _, m := range recordMigrations {
+		if a := m.attributes(ctx, rec, opts); a != nil {
+			names = append(names, m.name)
+			for k, v := range a {
+				attrs[k] = v
+			}
+		}
+	}
+	return attrs, names
+}
+
+func (s *DDB) indexNames() []string {
+	var names []string
+	for _, name := range []string{s.channelIDIndexName, s.tokenIndexName} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// indexes returns the GSIs configured with DDB_CHANNEL_ID_INDEX_NAME and DDB_TOKEN_INDEX_NAME by name.
+func (s *DDB) indexes() map[string]string {
+	keys := map[string]string{}
+	if s.channelIDIndexName != "" {
+		keys[s.channelIDIndexName] = "channel_id"
+	}
+	if s.tokenIndexName != "" {
+		keys[s.tokenIndexName] = "token"
+	}
+	return keys
+}
+
+func indexOf(name string, key string) types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName:  aws.String(name),
+		KeySchema:  []types.KeySchemaElement{{AttributeName: aws.String(key), KeyType: types.KeyTypeHash}},
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+	}
+}
+
+// ensureTable creates the table with on-demand capacity if absent. Returns true if the table is created.
+func (s *DDB) ensureTable(ctx context.Context, dryRun bool) (bool, error) {
+	_, err := s.inner.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: s.tableName})
+	var notFound *types.ResourceNotFoundException
+	if err == nil || !errors.As(err, &notFound) {
+		return false, errors.Wrapf(err, "failed to describe table: %s", *s.tableName)
+	}
+	if dryRun {
+		slog.InfoContext(ctx, "dry run: would create the table", slog.String("table_name", *s.tableName))
+		return true, nil
+	}
+
+	input := dynamodb.CreateTableInput{
+		TableName: s.tableName,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("channel_name"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("version"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("channel_name"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("version"), KeyType: types.KeyTypeRange},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	}
+	for _, name := range s.indexNames() {
+		key := s.indexes()[name]
+		input.AttributeDefinitions = append(input.AttributeDefinitions, types.AttributeDefinition{AttributeName: aws.String(key), AttributeType: types.ScalarAttributeTypeS})
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, indexOf(name, key))
+	}
+	if _, err := s.inner.CreateTable(ctx, &input); err != nil {
+		return false, errors.Wrapf(err, "failed to create table: %s", *s.tableName)
+	}
+	slog.InfoContext(ctx, "creating the table", slog.String("table_name", *s.tableName))
+	waiter := dynamodb.NewTableExistsWaiter(s.inner)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: s.tableName}, migrateWaitTimeout); err != nil {
+		return false, errors.Wrapf(err, "failed to wait for the table: %s", *s.tableName)
+	}
+	return true, nil
+}
+
+// ensureIndexes creates the configured GSIs absent in the table one by one, DynamoDB creates one GSI at a time.
+// Returns the names of the created GSIs.
+func (s *DDB) ensureIndexes(ctx context.Context, dryRun bool) ([]string, error) {
+	out, err := s.inner.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: s.tableName})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe table: %s", *s.tableName)
+	}
+	var created []string
+	for _, name := range s.indexNames() {
+		if slices.ContainsFunc(out.Table.GlobalSecondaryIndexes, func(gsi types.GlobalSecondaryIndexDescription) bool { return aws.ToString(gsi.IndexName) == name }) {
+			continue
+		}
+		created = append(created, name)
+		if dryRun {
+			slog.InfoContext(ctx, "dry run: would create the index", slog.String("index_name", name))
+			continue
+		}
+		key := s.indexes()[name]
+		gsi := indexOf(name, key)
+		action := types.CreateGlobalSecondaryIndexAction{IndexName: gsi.IndexName, KeySchema: gsi.KeySchema, Projection: gsi.Projection}
+		// Indexes of provisioned tables need their own capacity, start with the capacity of the table.
+		if out.Table.BillingModeSummary == nil || out.Table.BillingModeSummary.BillingMode == types.BillingModeProvisioned {
+			action.ProvisionedThroughput = &types.ProvisionedThroughput{
+				ReadCapacityUnits:  out.Table.ProvisionedThroughput.ReadCapacityUnits,
+				WriteCapacityUnits: out.Table.ProvisionedThroughput.WriteCapacityUnits,
+			}
+		}
+		_, err := s.inner.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:                   s.tableName,
+			AttributeDefinitions:        []types.AttributeDefinition{{AttributeName: aws.String(key), AttributeType: types.ScalarAttributeTypeS}},
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{Create: &action}},
+		})
+		if err != nil {
+			return created, errors.Wrapf(err, "failed to create index: %s", name)
+		}
+		slog.InfoContext(ctx, "creating the index, this may take a while for large tables", slog.String("index_name", name))
+		if err := s.waitIndexActive(ctx, name); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+func (s *DDB) waitIndexActive(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, migrateWaitTimeout)
+	defer cancel()
+	for {
+		out, err := s.inner.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: s.tableName})
+		if err != nil {
+			return errors.Wrapf(err, "failed to wait for the index: %s", name)
+		}
+		i := slices.IndexFunc(out.Table.GlobalSecondaryIndexes, func(gsi types.GlobalSecondaryIndexDescription) bool { return aws.ToString(gsi.IndexName) == name })
+		if i >= 0 && out.Table.GlobalSecondaryIndexes[i].IndexStatus == types.IndexStatusActive {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "failed to wait for the index: %s", name)
+		case <-time.After(migratePollInterval):
+		}
+	}
+}
+
+// ensureTTL enables TTL on expires_at. Returns true if TTL is enabled. Fails if TTL is enabled on another
+// attribute, DynamoDB allows one TTL attribute per table.
+func (s *DDB) ensureTTL(ctx context.Context, dryRun bool) (bool, error) {
+	out, err := s.inner.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: s.tableName})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to describe TTL: %s", *s.tableName)
+	}
+	if desc := out.TimeToLiveDescription; desc != nil && (desc.TimeToLiveStatus == types.TimeToLiveStatusEnabled || desc.TimeToLiveStatus == types.TimeToLiveStatusEnabling) {
+		if attr := aws.ToString(desc.AttributeName); attr != "expires_at" {
+			return false, errors.Newf("TTL is enabled on another attribute: %s", attr)
+		}
+		return false, nil
+	}
+	if dryRun {
+		slog.InfoContext(ctx, "dry run: would enable TTL on expires_at", slog.String("table_name", *s.tableName))
+		return true, nil
+	}
+	_, err = s.inner.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName:               s.tableName,
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{AttributeName: aws.String("expires_at"), Enabled: aws.Bool(true)},
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to enable TTL: %s", *s.tableName)
+	}
+	return true, nil
+}
+
+// setAttributes sets the attributes of the record. The record must be in the table.
+func (s *DDB) setAttributes(ctx context.Context, rec Record, attrs itemMap) error {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	values := itemMap{":token": tokenCondition(rec)}
+	attrNames := map[string]string{"#t": "token"}
+	sets := make([]string, 0, len(names))
+	for i, name := range names {
+		key := strconv.Itoa(i)
+		sets = append(sets, "#a"+key+" = :v"+key)
+		attrNames["#a"+key] = name
+		values[":v"+key] = attrs[name]
+	}
+	input := dynamodb.UpdateItemInput{
+		TableName:                 s.tableName,
+		Key:                       recordKey(rec),
+		ConditionExpression:       aws.String("#t = :token"),
+		UpdateExpression:          aws.String("SET " + strings.Join(sets, ", ")),
+		ExpressionAttributeValues: values,
+		ExpressionAttributeNames:  attrNames,
+	}
+	if _, err := s.inner.UpdateItem(ctx, &input); err != nil {
+		return errors.Wrapf(err, "failed to migrate record: channel_name=%s, version=%d", rec.ChannelName, rec.Version)
+	}
+	return nil
+}
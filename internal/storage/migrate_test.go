@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/secret"
+)
+
+func TestMigrateRecord(t *testing.T) {
+	ctx := context.Background()
+	opts := MigrateOptions{ArchivedRecordTTL: 24 * time.Hour, RevokeGracePeriod: time.Hour}
+	token := "0123456789abcdef"
+
+	tests := []struct {
+		name  string
+		rec   Record
+		attrs itemMap
+		names []string
+	}{
+		{
+			name: "up to date",
+			rec:  Record{Token: token, TokenPrefix: "0123", Scope: "post"},
+		},
+		{
+			name: "old record",
+			rec:  Record{Token: token},
+			attrs: itemMap{
+				"scope":        &types.AttributeValueMemberS{Value: "manage"},
+				"token_prefix": &types.AttributeValueMemberS{Value: secret.Token(token).Prefix()},
+			},
+			names: []string{"scope", "token_prefix"},
+		},
+		{
+			name:  "archived",
+			rec:   Record{Token: token, TokenPrefix: "0123", Scope: "post", ArchivedAt: "2024-01-01T00:00:00Z"},
+			attrs: itemMap{"expires_at": &types.AttributeValueMemberN{Value: "1704153600"}},
+			names: []string{"expires_at"},
+		},
+		{
+			name:  "revoked",
+			rec:   Record{Token: token, TokenPrefix: "0123", Scope: "post", ArchivedAt: "2024-01-01T00:00:00Z", RevokedAt: "2024-01-01T00:00:00Z"},
+			attrs: itemMap{"expires_at": &types.AttributeValueMemberN{Value: "1704070800"}},
+			names: []string{"expires_at"},
+		},
+		{
+			name: "tombstone with expires_at",
+			rec:  Record{Token: token, TokenPrefix: "0123", Scope: "post", ArchivedAt: "2024-01-01T00:00:00Z", ExpiresAt: 1},
+		},
+		{
+			name: "invalid timestamp",
+			rec:  Record{Token: token, TokenPrefix: "0123", Scope: "post", ArchivedAt: "invalid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs, names := migrateRecord(ctx, tt.rec, opts)
+			if tt.attrs == nil {
+				tt.attrs = itemMap{}
+			}
+			assert.Equal(t, tt.attrs, attrs)
+			assert.Equal(t, tt.names, names)
+		})
+	}
+}
+
+func TestDDBMigrate(t *testing.T) {
+	endpointURL := os.Getenv("DDB_ENDPOINT_URL")
+	if endpointURL == "" {
+		t.Skip("DDB_ENDPOINT_URL is not set, skipping DynamoDB Local integration test")
+	}
+	ctx := context.Background()
+	awsConfig := DynamoDBConfig(aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "dummy", SecretAccessKey: "dummy"}, nil
+		}),
+	}, appconfig.Config{DdbEndpointURL: endpointURL})
+	tableName := fmt.Sprintf("belldog-test-%d", time.Now().UnixNano())
+	ddb, err := NewDDB(ctx, awsConfig, tableName, testChannelIDIndexName, testTokenIndexName)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := ddb.inner.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(tableName)})
+		assert.NoError(t, err)
+	})
+	opts := MigrateOptions{ArchivedRecordTTL: 24 * time.Hour, RevokeGracePeriod: time.Hour}
+
+	result, err := Migrate(ctx, &ddb, MigrateOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, result.TableCreated)
+	_, err = ddb.inner.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	require.Error(t, err)
+
+	result, err = Migrate(ctx, &ddb, opts)
+	require.NoError(t, err)
+	assert.True(t, result.TableCreated)
+	assert.Equal(t, []string{testChannelIDIndexName, testTokenIndexName}, result.IndexesCreated)
+
+	// Records saved by older versions.
+	_, err = ddb.inner.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item: itemMap{
+			"channel_name": &types.AttributeValueMemberS{Value: "test"},
+			"version":      &types.AttributeValueMemberN{Value: "0"},
+			"channel_id":   &types.AttributeValueMemberS{Value: "C1"},
+			"token":        &types.AttributeValueMemberS{Value: "0123456789abcdef"},
+			"archived_at":  &types.AttributeValueMemberS{Value: "2024-01-01T00:00:00Z"},
+		},
+	})
+	require.NoError(t, err)
+
+	result, err = Migrate(ctx, &ddb, opts)
+	require.NoError(t, err)
+	assert.False(t, result.TableCreated)
+	assert.Empty(t, result.IndexesCreated)
+	assert.Equal(t, 1, result.Records)
+	assert.Equal(t, map[string]int{"scope": 1, "token_prefix": 1, "expires_at": 1}, result.Migrated)
+
+	recs, err := ddb.QueryTombstonesByChannelName(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, "manage", recs[0].Scope)
+	assert.Equal(t, secret.Token("0123456789abcdef").Prefix(), recs[0].TokenPrefix)
+	assert.Equal(t, int64(1704153600), recs[0].ExpiresAt)
+
+	result, err = Migrate(ctx, &ddb, opts)
+	require.NoError(t, err)
+	assert.Empty(t, result.Migrated)
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/cockroachdb/errors"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+	"github.com/Finatext/belldog/internal/kmsenvelope"
+)
+
+const (
+	BackendDynamoDB = "dynamodb"
+	BackendMemory   = "memory"
+)
+
+// Storage is implemented by DDB, Memory and DualWrite.
+type Storage interface {
+	Save(ctx context.Context, rec Record) error
+	QueryByChannelName(ctx context.Context, channelName string) ([]Record, error)
+	QueryTombstonesByChannelName(ctx context.Context, channelName string) ([]Record, error)
+	QueryByChannelID(ctx context.Context, channelID string) ([]Record, error)
+	QueryByToken(ctx context.Context, token string) ([]Record, error)
+	Delete(ctx context.Context, rec Record) error
+	UpdateLastUsedAt(ctx context.Context, rec Record, timestamp string) error
+	UpdateStaleNotifiedAt(ctx context.Context, rec Record, timestamp string) error
+	UpdateRotatedAt(ctx context.Context, rec Record, timestamp string) error
+	UpdateUndeliverableAt(ctx context.Context, rec Record, timestamp string) error
+	// AddDeliveryFailure returns the number of consecutive delivery failures including this one.
+	AddDeliveryFailure(ctx context.Context, rec Record, reason string) (int, error)
+	ResetDeliveryFailures(ctx context.Context, rec Record) error
+	UpdateMappings(ctx context.Context, rec Record, mappings []string) error
+	Archive(ctx context.Context, rec Record, archivedAt string, expiresAt int64) error
+	Revoke(ctx context.Context, rec Record, revokedAt string, expiresAt int64) error
+	Restore(ctx context.Context, rec Record) error
+	ScanAll(ctx context.Context) ([]Record, error)
+	// ForEachRecord streams all records to fn. fn must be safe for concurrent use when segments > 1.
+	ForEachRecord(ctx context.Context, segments int, fn func(Record) error) error
+	// ScanChunk returns records of whole channels including tombstones, at least limit records unless the end of
+	// the table. Give the returned cursor to scan the next chunk, which is empty at the end. The empty cursor scans
+	// from the beginning.
+	ScanChunk(ctx context.Context, cursor string, limit int) ([]Record, string, error)
+	ScanByChannelID(ctx context.Context, channelID string) ([]Record, error)
+	// Ping checks connectivity for health checks.
+	Ping(ctx context.Context) error
+}
+
+// DynamoDBConfig returns AWS config for DynamoDB clients. Clients retry throttled operations with the adaptive
+// retry mode and record the consumed capacity. Non-empty DDB_ENDPOINT_URL overrides the endpoint, e.g. to use
+// DynamoDB Local or LocalStack.
+func DynamoDBConfig(awsConfig aws.Config, config appconfig.Config) aws.Config {
+	c := awsConfig.Copy()
+	c.Retryer = newRetryer(config.DdbRetryMaxAttempts, config.DdbRetryMaxBackoff)
+	c.APIOptions = append(c.APIOptions, addCapacityMiddlewares)
+	if config.DdbEndpointURL != "" {
+		c.BaseEndpoint = aws.String(config.DdbEndpointURL)
+	}
+	return c
+}
+
+// NewStorage creates the storage selected by STORAGE_BACKEND. With STORAGE_SECONDARY_BACKEND, it returns
+// DualWrite writing to both backends, see DualWrite.
+func NewStorage(ctx context.Context, awsConfig aws.Config, config appconfig.Config) (Storage, error) {
+	primary, err := newBackend(ctx, awsConfig, config, config.StorageBackend, config.DdbTableName)
+	if err != nil {
+		return nil, err
+	}
+	if ddb, ok := primary.(*DDB); ok && config.DdbKmsKeyArn != "" {
+		// Use the original config: the endpoint override is only for DynamoDB.
+		if err := ddb.EncryptTokens(kmsenvelope.NewCipher(kmsenvelope.NewClient(awsConfig), config.DdbKmsKeyArn)); err != nil {
+			return nil, err
+		}
+	}
+	if config.StorageSecondaryBackend == "" {
+		return primary, nil
+	}
+	if config.StorageSecondaryBackend == BackendDynamoDB && config.DdbSecondaryTableName == "" {
+		return nil, errors.New("DDB_SECONDARY_TABLE_NAME is required for the secondary DynamoDB backend")
+	}
+	secondary, err := newBackend(ctx, awsConfig, config, config.StorageSecondaryBackend, config.DdbSecondaryTableName)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "dual-write mode enabled", slog.String("primary", config.StorageBackend), slog.String("secondary", config.StorageSecondaryBackend))
+	return NewDualWrite(primary, secondary), nil
+}
+
+func newBackend(ctx context.Context, awsConfig aws.Config, config appconfig.Config, backend string, tableName string) (Storage, error) {
+	switch backend {
+	case BackendDynamoDB:
+		ddb, err := NewDDB(ctx, DynamoDBConfig(awsConfig, config), tableName, config.DdbChannelIDIndexName, config.DdbTokenIndexName)
+		if err != nil {
+			return nil, err
+		}
+		// REGION_ROLE is set only for Global Tables.
+		ddb.createdAtTiebreak = config.RegionRole != ""
+		return &ddb, nil
+	case BackendMemory:
+		slog.WarnContext(ctx, "using in-memory storage, records are lost on exit")
+		return NewMemory(), nil
+	default:
+		return nil, errors.Newf("unknown storage backend: %s", backend)
+	}
+}
+
+// IsTransient reports whether the operation may succeed when retried later: throttling and server errors left
+// after the retries of the SDK, and timeouts.
+func IsTransient(err error) bool {
+	var internal *types.InternalServerError
+	if IsThrottled(err) || errors.As(err, &internal) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &timeout) && timeout.Timeout())
+}
+
+// IsThrottled reports whether DynamoDB throttled the operation, e.g. ProvisionedThroughputExceededException.
+func IsThrottled(err error) bool {
+	var throughput *types.ProvisionedThroughputExceededException
+	var limit *types.RequestLimitExceeded
+	if errors.As(err, &throughput) || errors.As(err, &limit) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ThrottlingException"
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(errors.Wrap(&types.ProvisionedThroughputExceededException{}, "failed to query")))
+	assert.True(t, IsTransient(&types.RequestLimitExceeded{}))
+	assert.True(t, IsTransient(&types.InternalServerError{}))
+	assert.True(t, IsTransient(&smithy.GenericAPIError{Code: "ThrottlingException"}))
+	assert.True(t, IsTransient(errors.Wrap(context.DeadlineExceeded, "failed to query")))
+
+	assert.False(t, IsTransient(&types.ConditionalCheckFailedException{}))
+	assert.False(t, IsTransient(&smithy.GenericAPIError{Code: "ValidationException"}))
+	assert.False(t, IsTransient(errors.New("broken record")))
+}
+
+func TestRecordIsMasked(t *testing.T) {
+	rec := Record{ChannelID: "C1", ChannelName: "test", Token: "bd_ab12_0123456789abcdef0123456789abcdef", Version: 1}
+	for _, format := range []string{"%s", "%v", "%+v", "%#v"} {
+		assert.NotContains(t, fmt.Sprintf(format, rec), "0123456789abcdef", format)
+		assert.NotContains(t, fmt.Sprintf(format, []Record{rec}), "0123456789abcdef", format)
+	}
+	assert.Contains(t, fmt.Sprintf("%v", rec), "token=bd_ab12")
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.Info("record", slog.Any("record", rec))
+	assert.NotContains(t, buf.String(), "0123456789abcdef")
+	assert.Contains(t, buf.String(), `"token":"bd_ab12"`)
+}
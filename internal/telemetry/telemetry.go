@@ -0,0 +1,228 @@
+// Package telemetry records OpenTelemetry metrics of webhook outcomes and Slack API calls.
+//
+// Instruments are created from the global MeterProvider, so recording is no-op until Setup installs the SDK
+// MeterProvider.
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/Finatext/belldog/internal/appconfig"
+)
+
+const instrumentationName = "github.com/Finatext/belldog"
+
+var (
+	webhookRequests     metric.Int64Counter
+	verifyFailures      metric.Int64Counter
+	payloadSize         metric.Int64Histogram
+	slackAPIDuration    metric.Float64Histogram
+	slackRateLimited    metric.Int64Counter
+	slackCircuit        metric.Int64Counter
+	slackShortCircuited metric.Int64Counter
+	signingSecrets      metric.Int64Counter
+	batchRuns           metric.Int64Counter
+	batchRecords        metric.Int64Gauge
+	batchEvents         metric.Int64Counter
+	panics              metric.Int64Counter
+	renameRedirects     metric.Int64Counter
+	deadlineExceeded    metric.Int64Counter
+	coldStarts          metric.Float64Histogram
+	dynamoDBCapacity    metric.Float64Counter
+	dynamoDBThrottles   metric.Int64Counter
+	storageDrifts       metric.Int64Counter
+)
+
+func init() {
+	meter := otel.Meter(instrumentationName)
+	// Instrument creation fails only with invalid names or options, which is a programming error.
+	webhookRequests = must(meter.Int64Counter("belldog.webhook.requests",
+		metric.WithDescription("Webhook requests by response status code.")))
+	verifyFailures = must(meter.Int64Counter("belldog.webhook.verify_failures",
+		metric.WithDescription("Webhook requests rejected by token verification.")))
+	payloadSize = must(meter.Int64Histogram("belldog.webhook.payload.size",
+		metric.WithDescription("Size of webhook request bodies."), metric.WithUnit("By")))
+	slackAPIDuration = must(meter.Float64Histogram("belldog.slack.api.duration",
+		metric.WithDescription("Latency of Slack API calls including retries."), metric.WithUnit("s")))
+	slackRateLimited = must(meter.Int64Counter("belldog.slack.api.rate_limited",
+		metric.WithDescription("Slack API calls given up due to 429 responses.")))
+	slackCircuit = must(meter.Int64Counter("belldog.slack.circuit.transitions",
+		metric.WithDescription("State transitions of the Slack API circuit breaker.")))
+	slackShortCircuited = must(meter.Int64Counter("belldog.slack.api.short_circuited",
+		metric.WithDescription("Slack API calls not made because the circuit breaker is open.")))
+	signingSecrets = must(meter.Int64Counter("belldog.slack.signing_secret.matches",
+		metric.WithDescription("Slack requests verified by signing secret.")))
+	batchRuns = must(meter.Int64Counter("belldog.batch.runs",
+		metric.WithDescription("Batch job runs by status.")))
+	batchRecords = must(meter.Int64Gauge("belldog.batch.records",
+		metric.WithDescription("Records scanned by the last batch job run.")))
+	batchEvents = must(meter.Int64Counter("belldog.batch.events",
+		metric.WithDescription("Events processed by the batch job by type and status.")))
+	panics = must(meter.Int64Counter("belldog.panics",
+		metric.WithDescription("Panics recovered by source.")))
+	renameRedirects = must(meter.Int64Counter("belldog.webhook.rename_redirects",
+		metric.WithDescription("Webhook requests delivered although the channel name in the URL doesn't match the token.")))
+	deadlineExceeded = must(meter.Int64Counter("belldog.deadline_exceeded",
+		metric.WithDescription("Requests and their steps aborted by the execution time budget of Lambda invocations.")))
+	coldStarts = must(meter.Float64Histogram("belldog.cold_start.duration",
+		metric.WithDescription("Initialization time of Lambda execution environments."), metric.WithUnit("s")))
+	dynamoDBCapacity = must(meter.Float64Counter("belldog.dynamodb.consumed_capacity",
+		metric.WithDescription("Capacity units consumed by DynamoDB operations."), metric.WithUnit("{capacity_unit}")))
+	dynamoDBThrottles = must(meter.Int64Counter("belldog.dynamodb.throttles",
+		metric.WithDescription("DynamoDB operation attempts throttled, including the attempts retried.")))
+	storageDrifts = must(meter.Int64Counter("belldog.storage.drifts",
+		metric.WithDescription("Differences between the primary and the secondary storage in dual-write mode.")))
+}
+
+func must[T any](instrument T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return instrument
+}
+
+const exporterStdout = "stdout"
+
+// Setup installs the SDK MeterProvider when METRICS_EXPORTER is set. Call the returned function to flush and
+// shutdown before exit.
+//
+// Supported exporters:
+//   - stdout: write metrics as JSON lines to stdout, e.g. to collect from CloudWatch Logs.
+func Setup(ctx context.Context, config appconfig.Config) (func(context.Context) error, error) {
+	var exporter sdkmetric.Exporter
+	switch config.MetricsExporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case exporterStdout:
+		e, err := stdoutmetric.New()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create stdout metric exporter")
+		}
+		exporter = e
+	default:
+		return nil, errors.Newf("unknown metrics exporter: %s", config.MetricsExporter)
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(config.MetricsExportInterval))),
+	)
+	otel.SetMeterProvider(provider)
+	slog.InfoContext(ctx, "OpenTelemetry metrics enabled", slog.String("exporter", config.MetricsExporter), slog.Duration("export_interval", config.MetricsExportInterval))
+	return provider.Shutdown, nil
+}
+
+func RecordWebhookRequest(ctx context.Context, channelName string, statusCode int) {
+	webhookRequests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("channel_name", channelName),
+		attribute.Int("status", statusCode),
+	))
+}
+
+// reason is "not_found", "unmatch" or "scope_unmatch".
+func RecordVerifyFailure(ctx context.Context, channelName string, reason string) {
+	verifyFailures.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("channel_name", channelName),
+		attribute.String("reason", reason),
+	))
+}
+
+// RecordRenamedChannelRedirect records requests having the stale channel name in the URL. channelName is the
+// channel name in the URL.
+func RecordRenamedChannelRedirect(ctx context.Context, channelName string) {
+	renameRedirects.Add(ctx, 1, metric.WithAttributes(attribute.String("channel_name", channelName)))
+}
+
+func RecordPayloadSize(ctx context.Context, channelName string, size int) {
+	payloadSize.Record(ctx, int64(size), metric.WithAttributes(attribute.String("channel_name", channelName)))
+}
+
+// outcome is "ok", "timeout", "server_failure", "api_failure", "rate_limited" or "error".
+func RecordSlackAPICall(ctx context.Context, method string, outcome string, duration time.Duration) {
+	slackAPIDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(
+		attribute.String("method", method),
+		attribute.String("outcome", outcome),
+	))
+}
+
+func RecordSlackRateLimited(ctx context.Context, method string) {
+	slackRateLimited.Add(ctx, 1, metric.WithAttributes(attribute.String("method", method)))
+}
+
+// from and to are "closed", "open" or "half_open".
+func RecordSlackCircuitTransition(ctx context.Context, from string, to string) {
+	slackCircuit.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("from", from),
+		attribute.String("to", to),
+	))
+}
+
+func RecordSlackShortCircuited(ctx context.Context, method string) {
+	slackShortCircuited.Add(ctx, 1, metric.WithAttributes(attribute.String("method", method)))
+}
+
+// secret is "current" or "previous". Remove the previous secret once no request matches it.
+func RecordSigningSecretMatch(ctx context.Context, secret string) {
+	signingSecrets.Add(ctx, 1, metric.WithAttributes(attribute.String("secret", secret)))
+}
+
+func RecordBatchRun(ctx context.Context, records int, ok bool) {
+	batchRuns.Add(ctx, 1, metric.WithAttributes(attribute.String("status", status(ok))))
+	batchRecords.Record(ctx, int64(records))
+}
+
+// eventType is "archived", "restored", "purged", "migration", "rename", "stale_notice", "stale_revoke", "rotation"
+// or "rotation_revoke".
+func RecordBatchEvent(ctx context.Context, eventType string, ok bool) {
+	batchEvents.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("type", eventType),
+		attribute.String("status", status(ok)),
+	))
+}
+
+// step is "request" for whole requests, or the step, e.g. "slack".
+func RecordDeadlineExceeded(ctx context.Context, step string) {
+	deadlineExceeded.Add(ctx, 1, metric.WithAttributes(attribute.String("step", step)))
+}
+
+// mode is the MODE env, e.g. "proxy".
+func RecordColdStart(ctx context.Context, mode string, duration time.Duration) {
+	coldStarts.Record(ctx, duration.Seconds(), metric.WithAttributes(attribute.String("mode", mode)))
+}
+
+// capacity is "read" or "write". operation is the DynamoDB API, e.g. "PutItem".
+func RecordDynamoDBConsumedCapacity(ctx context.Context, table string, operation string, capacity string, units float64) {
+	dynamoDBCapacity.Add(ctx, units, metric.WithAttributes(
+		attribute.String("table", table),
+		attribute.String("operation", operation),
+		attribute.String("capacity", capacity),
+	))
+}
+
+func RecordDynamoDBThrottle(ctx context.Context, operation string) {
+	dynamoDBThrottles.Add(ctx, 1, metric.WithAttributes(attribute.String("operation", operation)))
+}
+
+// operation is the storage method, e.g. "QueryByChannelName".
+func RecordStorageDrift(ctx context.Context, operation string) {
+	storageDrifts.Add(ctx, 1, metric.WithAttributes(attribute.String("operation", operation)))
+}
+
+// source is "http", "batch" or "digest".
+func RecordPanic(ctx context.Context, source string) {
+	panics.Add(ctx, 1, metric.WithAttributes(attribute.String("source", source)))
+}
+
+func status(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "failed"
+}
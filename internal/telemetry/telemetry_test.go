@@ -0,0 +1,49 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRecord(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	RecordWebhookRequest(ctx, "test", 200)
+	RecordWebhookRequest(ctx, "test", 200)
+	RecordVerifyFailure(ctx, "test", "unmatch")
+	RecordPayloadSize(ctx, "test", 128)
+	RecordSlackAPICall(ctx, "chat.postMessage", "ok", 100*time.Millisecond)
+	RecordBatchRun(ctx, 42, true)
+	RecordBatchEvent(ctx, "rename", false)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	got := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		got[m.Name] = m.Data
+	}
+
+	requests, ok := got["belldog.webhook.requests"].(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, requests.DataPoints, 1)
+	assert.Equal(t, int64(2), requests.DataPoints[0].Value)
+	assert.Contains(t, got, "belldog.webhook.verify_failures")
+	assert.Contains(t, got, "belldog.webhook.payload.size")
+	assert.Contains(t, got, "belldog.slack.api.duration")
+	assert.Contains(t, got, "belldog.batch.runs")
+	assert.Contains(t, got, "belldog.batch.events")
+	records, ok := got["belldog.batch.records"].(metricdata.Gauge[int64])
+	require.True(t, ok)
+	require.Len(t, records.DataPoints, 1)
+	assert.Equal(t, int64(42), records.DataPoints[0].Value)
+}